@@ -3,7 +3,7 @@
 BINARY_NAME="lexido"
 
 # Array of build targets
-PLATFORMS=("darwin/amd64" "darwin/arm64" "linux/amd64" "linux/arm64")
+PLATFORMS=("darwin/amd64" "darwin/arm64" "linux/amd64" "linux/arm64" "windows/amd64" "windows/arm64")
 
 # Clear previous builds
 echo "Cleaning up previous builds..."
@@ -34,4 +34,14 @@ for platform in "${PLATFORMS[@]}"; do
     fi
 done
 
+# Checksums of the binaries, lexido update refuses to install a release without them
+echo "Writing checksums..."
+cd build
+if command -v sha256sum > /dev/null; then
+    sha256sum ${BINARY_NAME}-* > checksums.txt
+else
+    shasum -a 256 ${BINARY_NAME}-* > checksums.txt
+fi
+cd ..
+
 echo "Build process completed."
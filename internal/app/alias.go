@@ -0,0 +1,83 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/aliases"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/shellinit"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// Options of `lexido alias`, which writes a shell alias or function instead of suggesting commands
+type aliasOptions struct {
+	enabled bool
+	shell   string
+}
+
+// Parses the flags of `lexido alias`, returning the remaining arguments as the description of the alias
+func parseAliasArgs(args []string) (aliasOptions, []string, error) {
+	fs := flag.NewFlagSet("alias", flag.ExitOnError)
+	shell := fs.String("shell", "", "Shell to write the alias for, bash, zsh or fish (default from $SHELL)")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return aliasOptions{}, nil, errs.Usagef("Usage: lexido alias [--shell bash|zsh|fish] <what it should do>")
+	}
+	if *shell == "" {
+		*shell = io.UserShell()
+		if !slices.Contains(shellinit.Shells, *shell) {
+			return aliasOptions{}, nil, errs.Usagef("can't tell bash, zsh or fish from $SHELL, choose one with --shell")
+		}
+	}
+	if !slices.Contains(shellinit.Shells, *shell) {
+		return aliasOptions{}, nil, errs.Usagef("unsupported shell %q, use one of %s", *shell, strings.Join(shellinit.Shells, ", "))
+	}
+	return aliasOptions{enabled: true, shell: *shell}, fs.Args(), nil
+}
+
+// Lets the user edit the generated definition and saves it to the aliases file, returning the exit code
+func (a aliasOptions) finish(description string, response string) int {
+	path, err := aliases.Path(a.shell)
+	if err != nil {
+		log.Println(err)
+		return errs.ExitFailure
+	}
+	definition, ok, err := tea.EditText(fmt.Sprintf("Add this %s definition to %s:", a.shell, path), aliases.Extract(response))
+	if err != nil {
+		log.Printf("Alas, there's been a Bubble Tea error: %v\n", err)
+		return errs.ExitFailure
+	}
+	if !ok || definition == "" {
+		fmt.Println("Not saved.")
+		return errs.ExitFailure
+	}
+
+	name, err := aliases.Name(definition)
+	if err != nil {
+		log.Println(err)
+		return errs.ExitFailure
+	}
+	_, statErr := os.Stat(path)
+	existed := statErr == nil
+	path, replaced, err := aliases.Save(a.shell, name, description, definition)
+	if err != nil {
+		log.Printf("Failed to save the alias: %v\n", err)
+		return errs.ExitFailure
+	}
+	if replaced {
+		fmt.Printf("Replaced %s in %s.\n", name, path)
+	} else {
+		fmt.Printf("Added %s to %s.\n", name, path)
+	}
+	if !existed {
+		fmt.Printf("Add this line to the rc file of %s to load it in new shells:\n    source %s\n", a.shell, path)
+	}
+	return 0
+}
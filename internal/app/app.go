@@ -0,0 +1,41 @@
+package app
+
+import (
+	"context"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+)
+
+// App is lexido without the command line, its fields are the seams tests replace
+type App struct {
+	Keyring  Store      // Where the default mode and the ollama model are kept
+	System   SystemInfo // Facts about the machine that go into the prompt
+	Provider Provider   // Replaces the real backends when set, their setup is skipped then
+}
+
+// Store keeps settings and API keys by field name, Read returns an error wrapping io.ErrNotFound for fields never saved
+type Store interface {
+	Read(field string) (string, error)
+	Save(field string, value string) error
+}
+
+// Provider streams the response to the prompt into send and returns all of it
+type Provider func(ctx context.Context, runMode string, parts prompt.Parts, send func(tearaw.Msg)) (string, error)
+
+// Returns the App the lexido binary runs, with the keyring, this machine and the real providers
+func New() *App {
+	return &App{Keyring: keyringStore{}, System: localSystem{}}
+}
+
+// The keyring, or the credentials file with --no-keyring
+type keyringStore struct{}
+
+func (keyringStore) Read(field string) (string, error) {
+	return io.ReadFromKeyring(field)
+}
+
+func (keyringStore) Save(field string, value string) error {
+	return io.SaveToKeyring(field, value)
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"flag"
+	"strings"
+)
+
+// Subcommands that parse flags of their own after their name, the arguments after them are left as they are
+var ownFlags = map[string]bool{
+	"commit":     true,
+	"alias":      true,
+	"edit":       true,
+	"batch":      true,
+	"cnf":        true,
+	"update":     true,
+	"completion": true,
+}
+
+// InterspersedArgs moves the flags of fs that come after the words of the prompt ahead of them, so
+// `lexido find big files -l` asks ollama instead of sending -l along. The standard flag package stops at the
+// first word. Everything after -- stays part of the prompt, as do words that look like flags fs doesn't know,
+// such as the -mtime of "files changed -mtime 7". The arguments of subcommands with flags of their own aren't touched.
+// literal reports a -- ahead of every word, which makes even a first word such as config part of the prompt.
+func InterspersedArgs(fs *flag.FlagSet, args []string) (parsed []string, literal bool) {
+	var flags, words []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			literal = len(words) == 0
+			words = append(words, args[i+1:]...)
+			break
+		}
+
+		if len(words) == 0 {
+			if _, ok := subcommands[arg]; (ok || ownFlags[arg]) && isSubcommand(arg, args[i+1:]) || strings.HasPrefix(arg, "__") {
+				words = append(words, args[i:]...)
+				break
+			}
+		}
+
+		name, hasValue := flagName(arg)
+		defined := name != "" && fs.Lookup(name) != nil
+		if !defined && (name == "" || len(words) > 0) {
+			// A word of the prompt, or a flag-like word after it that lexido has no flag for
+			words = append(words, arg)
+			continue
+		}
+
+		// Unknown flags before the prompt are left to fs, which reports them
+		flags = append(flags, arg)
+		if defined && !hasValue && !isBoolFlag(fs.Lookup(name)) && i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+
+	if len(words) == 0 {
+		return flags, literal
+	}
+	// The words go after --, so ones that look like flags stay words when fs parses them
+	return append(append(flags, "--"), words...), literal
+}
+
+// Returns the name of a -name, --name or --name=value argument and whether the value is part of it,
+// an empty name for arguments that aren't flags, such as - for stdin
+func flagName(arg string) (string, bool) {
+	if len(arg) < 2 || arg[0] != '-' {
+		return "", false
+	}
+	name := strings.TrimPrefix(arg[1:], "-")
+	if name == "" || name[0] == '-' || name[0] == '=' {
+		return "", false
+	}
+	name, _, hasValue := strings.Cut(name, "=")
+	return name, hasValue
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
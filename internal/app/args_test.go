@@ -0,0 +1,167 @@
+package app
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A flag that can be given several times, like --image of main
+type values []string
+
+func (v *values) String() string { return strings.Join(*v, ",") }
+func (v *values) Get() any       { return []string(*v) }
+func (v *values) Set(s string) error {
+	*v = append(*v, s)
+	return nil
+}
+
+// A few flags of main of each kind: booleans, ones with a value and a repeated one
+func testFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("lexido", flag.ContinueOnError)
+	fs.Bool("l", false, "")
+	fs.Bool("q", false, "")
+	fs.Bool("quiet", false, "")
+	fs.String("m", "", "")
+	fs.Int("history", 0, "")
+	fs.Var(&values{}, "image", "")
+	return fs
+}
+
+func TestInterspersedArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		literal bool
+	}{
+		{"flags first", []string{"-l", "find", "big", "files"}, []string{"-l", "--", "find", "big", "files"}, false},
+		{"flag after the prompt", []string{"find", "big", "files", "-l"}, []string{"-l", "--", "find", "big", "files"}, false},
+		{"flag in the middle", []string{"find", "-q", "big", "files"}, []string{"-q", "--", "find", "big", "files"}, false},
+		{"value after the prompt", []string{"list", "files", "-m", "llama3"}, []string{"-m", "llama3", "--", "list", "files"}, false},
+		{"value in the same argument", []string{"list", "files", "--m=llama3"}, []string{"--m=llama3", "--", "list", "files"}, false},
+		{"double dash flag", []string{"list", "files", "--quiet"}, []string{"--quiet", "--", "list", "files"}, false},
+		{"repeated flag", []string{"what", "is", "this", "--image", "a.png", "--image=b.png"}, []string{"--image", "a.png", "--image=b.png", "--", "what", "is", "this"}, false},
+		{"unknown flag in the prompt", []string{"files", "changed", "-mtime", "7"}, []string{"--", "files", "changed", "-mtime", "7"}, false},
+		{"unknown flag before the prompt", []string{"-x", "list", "files"}, []string{"-x", "--", "list", "files"}, false},
+		{"stdin dash", []string{"explain", "-"}, []string{"--", "explain", "-"}, false},
+		{"-l after --", []string{"ls", "--", "-l", "output"}, []string{"--", "ls", "-l", "output"}, false},
+		{"-l only after --", []string{"-q", "--", "what", "does", "ls", "-l", "do"}, []string{"-q", "--", "what", "does", "ls", "-l", "do"}, true},
+		{"-- ahead of a subcommand name", []string{"--", "config", "nginx"}, []string{"--", "config", "nginx"}, true},
+		{"only flags", []string{"-l", "-q"}, []string{"-l", "-q"}, false},
+		{"nothing", nil, nil, false},
+		{"subcommand keeps its arguments", []string{"config", "set", "history", "5"}, []string{"--", "config", "set", "history", "5"}, false},
+		{"subcommand with own flags", []string{"commit", "-l", "--conventional"}, []string{"--", "commit", "-l", "--conventional"}, false},
+		{"subcommand name starting a prompt", []string{"config", "nginx", "as", "a", "proxy", "-l"}, []string{"-l", "--", "config", "nginx", "as", "a", "proxy"}, false},
+		{"internal command", []string{"__complete", "-l"}, []string{"--", "__complete", "-l"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, literal := InterspersedArgs(testFlags(), test.args)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("InterspersedArgs(%q) = %q, want %q", test.args, got, test.want)
+			}
+			if literal != test.literal {
+				t.Errorf("InterspersedArgs(%q) literal = %v, want %v", test.args, literal, test.literal)
+			}
+		})
+	}
+}
+
+// What the flag set makes of the rearranged arguments: -l is the flag unless it comes after --
+func TestInterspersedArgsParse(t *testing.T) {
+	tests := []struct {
+		args  []string
+		local bool
+		words []string
+	}{
+		{[]string{"find", "big", "files", "-l"}, true, []string{"find", "big", "files"}},
+		{[]string{"what", "does", "--", "ls", "-l", "do"}, false, []string{"what", "does", "ls", "-l", "do"}},
+		{[]string{"-l", "--", "-l"}, true, []string{"-l"}},
+	}
+	for _, test := range tests {
+		fs := testFlags()
+		args, _ := InterspersedArgs(fs, test.args)
+		if err := fs.Parse(args); err != nil {
+			t.Fatalf("parsing %q: %v", args, err)
+		}
+		if local := fs.Lookup("l").Value.String() == "true"; local != test.local {
+			t.Errorf("%q: -l = %v, want %v", test.args, local, test.local)
+		}
+		if !reflect.DeepEqual(fs.Args(), test.words) {
+			t.Errorf("%q: prompt %q, want %q", test.args, fs.Args(), test.words)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if got := (Options{Args: []string{"config", "list"}}).command(); got != "config" {
+		t.Errorf("command() = %q, want config", got)
+	}
+	if got := (Options{Args: []string{"config", "nginx"}, Literal: true}).command(); got != "" {
+		t.Errorf("command() after -- = %q, want none", got)
+	}
+	if got := (Options{}).command(); got != "" {
+		t.Errorf("command() without arguments = %q, want none", got)
+	}
+}
+
+func TestFlagArgs(t *testing.T) {
+	fs := testFlags()
+	args := []string{"-q", "--image", "a.png", "-m", "llama3", "--image", "b c.png", "--", "word"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Set: map[string]bool{}}
+	fs.Visit(func(f *flag.Flag) { opts.Set[f.Name] = true })
+
+	got := opts.flagArgs(fs)
+	want := []string{"--image=a.png", "--image=b c.png", "--m=llama3", "--q=true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("flagArgs() = %q, want %q", got, want)
+	}
+
+	// Parsed again, the flags have the same values
+	again := testFlags()
+	if err := again.Parse(got); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"q", "m", "image"} {
+		if a, b := fs.Lookup(name).Value.String(), again.Lookup(name).Value.String(); a != b {
+			t.Errorf("--%s parsed back as %q, want %q", name, b, a)
+		}
+	}
+}
+
+func TestIsSubcommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"config"}, true},
+		{[]string{"config", "list"}, true},
+		{[]string{"config", "get", "history"}, true},
+		{[]string{"config", "set", "history", "5"}, true},
+		{[]string{"config", "nginx", "as", "a", "reverse", "proxy"}, false},
+		{[]string{"config", "list", "my", "network", "interfaces"}, false},
+		{[]string{"history", "show", "--json"}, true},
+		{[]string{"history", "of", "my", "shell"}, false},
+		{[]string{"cache", "clear"}, true},
+		{[]string{"cache", "clear", "the", "apt", "cache"}, false},
+		{[]string{"remote", "init", "openai"}, true},
+		{[]string{"remote", "desktop", "to", "my", "server"}, false},
+		{[]string{"stats", "--since", "7d"}, true},
+		{[]string{"stats", "reset"}, true},
+		{[]string{"stats", "of", "the", "cpu"}, false},
+		{[]string{"edit", "--apply", "x"}, true},
+		{[]string{"edit", "my", "crontab"}, false},
+		{[]string{"models", "anything"}, true},
+	}
+	for _, test := range tests {
+		if got := isSubcommand(test.args[0], test.args[1:]); got != test.want {
+			t.Errorf("isSubcommand(%q) = %v, want %v", test.args, got, test.want)
+		}
+	}
+}
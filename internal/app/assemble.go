@@ -0,0 +1,112 @@
+package app
+
+import (
+	"github.com/micr0-dev/lexido/pkg/git"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+)
+
+// What the prompt of a run is built from, Run fills it in from the flags and the subcommand
+type promptSources struct {
+	facts        <-chan Facts // Gathered while the provider is set up, assemble waits for them
+	opts         Options
+	runMode      string
+	runDir       string // Directory the commands run in
+	lang         string // Language of the explanations
+	preprompt    string // Instructions of the preprompt setting
+	user         string
+	instruction  string // Appended to the pre-prompt, except in chat
+	images       []io.Image
+	conversation string // Earlier turns for --continue
+	project      io.ProjectContext
+	useProject   bool
+	cnf          bool // The command-not-found handler asks
+	commit       commitOptions
+	alias        aliasOptions
+	edit         editOptions
+	summarize    bool
+	chat         bool
+	ownPrompt    bool // commit, alias and edit have a pre-prompt of their own
+}
+
+// Builds the prompt once the system facts are in, returning the pre-prompt on its own as well
+func (s promptSources) assemble() (string, prompt.Parts) {
+	facts := <-s.facts
+
+	// The command-not-found handler has a short pre-prompt of its own, more context only slows the answer down
+	if s.cnf {
+		pre_prompt := prompt.CommandNotFoundPrePrompt(facts.OperatingSystem, facts.PackageManagers)
+		return pre_prompt, prompt.Parts{System: pre_prompt, User: s.user, Label: "User: "}
+	}
+
+	// On a --target host the commands run in the home directory there, which its facts already name
+	commandDir := s.runDir
+	if s.opts.Target != "" {
+		commandDir = facts.Cwd
+	}
+	pre_prompt := systemPrompt(facts, commandDir)
+
+	// Branch and state of the repository the commands run in, skipped quietly when git isn't there
+	if !s.opts.NoGit && !s.ownPrompt && s.opts.Target == "" {
+		if info, ok := git.RepoInfo(s.runDir); ok {
+			pre_prompt += prompt.GitContext(info)
+		}
+	}
+
+	if s.useProject {
+		pre_prompt += prompt.ProjectContext(s.project.Content, s.project.Truncated)
+	}
+
+	// Shell history is private, it is only shared when asked for with --history or the history setting
+	if n := historyLength(s.opts.History, s.opts.wasSet("history")); n > 0 && !s.ownPrompt {
+		entries, err := io.ReadShellHistory()
+		if err != nil {
+			logging.Warnf("Not including shell history: %v", err)
+		} else {
+			pre_prompt += prompt.FormatHistory(prompt.FilterHistory(entries, n))
+		}
+	}
+
+	// Gemini returns alternatives as separate candidates, the other backends are asked for them in the prompt
+	if s.opts.Alternatives > 1 && s.runMode != "gemini" && !s.ownPrompt {
+		pre_prompt += prompt.AlternativesInstruction(s.opts.Alternatives)
+	}
+
+	if s.commit.enabled {
+		pre_prompt = prompt.CommitPrePrompt(s.commit.conventional)
+	} else if s.alias.enabled {
+		pre_prompt = prompt.AliasPrePrompt(s.alias.shell, facts.OperatingSystem)
+	} else if s.edit.enabled {
+		pre_prompt = prompt.EditPrePrompt()
+	} else if s.summarize {
+		pre_prompt = prompt.SummarizePrePrompt() + prompt.LanguageInstruction(s.lang)
+	} else {
+		if s.opts.NoCommands {
+			pre_prompt += prompt.NoCommandsInstruction()
+		}
+		pre_prompt += prompt.LanguageInstruction(s.lang)
+	}
+
+	if !s.ownPrompt {
+		pre_prompt += prompt.UserInstructions(s.preprompt)
+	}
+
+	if !s.chat {
+		pre_prompt += s.instruction
+	}
+
+	parts := prompt.Parts{System: pre_prompt, User: s.user, Label: "User: ", Images: s.images}
+	if s.opts.Continue {
+		// Drop the oldest turns when the continued conversation would overflow the model's context window
+		contextWindow := contextWindowFor(s.runMode)
+		budget := prompt.HistoryBudget(contextWindow, pre_prompt+s.user)
+
+		trimmed, dropped := prompt.TrimConversation(s.conversation, budget, prompt.DefaultKeepTurns)
+		if dropped > 0 {
+			logging.Infof("Dropped the %d oldest conversation turns to fit the %d token context window of %s", dropped, contextWindow, s.runMode)
+		}
+		parts.History = trimmed
+	}
+	return pre_prompt, parts
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/prompt"
+)
+
+// Assembles the prompt with the facts of testFacts already gathered
+func assembled(t *testing.T, s promptSources) (string, prompt.Parts) {
+	t.Helper()
+	isolate(t)
+	facts := make(chan Facts, 1)
+	facts <- Facts(testFacts)
+	s.facts = facts
+	s.opts.NoGit = true
+	if s.runDir == "" {
+		s.runDir = testFacts.Cwd
+	}
+	return s.assemble()
+}
+
+func TestAssemble(t *testing.T) {
+	pre, parts := assembled(t, promptSources{runMode: "mock", user: "find big files", instruction: " Infer the task."})
+	if parts.System != pre || parts.User != "find big files" || parts.Label != "User: " {
+		t.Errorf("parts = %+v, want the pre-prompt and the words", parts)
+	}
+	if !strings.HasPrefix(pre, prompt.DefaultPrePrompt) {
+		t.Errorf("the pre-prompt doesn't start with the default one: %q", pre)
+	}
+	want := " The user, tester, is currently running Test Linux 1.0 on testbox in /home/tester/project. The user has the following package managers installed: apt."
+	if !strings.Contains(pre, want) {
+		t.Errorf("the pre-prompt = %q, want the facts %q", pre, want)
+	}
+	if !strings.HasSuffix(pre, " Infer the task.") {
+		t.Errorf("the pre-prompt = %q, want the instruction last", pre)
+	}
+	if strings.Contains(pre, "will be run in") {
+		t.Errorf("the pre-prompt = %q names the directory the user is in again", pre)
+	}
+}
+
+func TestAssembleRunDir(t *testing.T) {
+	pre, _ := assembled(t, promptSources{runMode: "mock", user: "x", runDir: "/srv/www"})
+	if !strings.Contains(pre, " The suggested commands will be run in /srv/www.") {
+		t.Errorf("the pre-prompt = %q, want the --run-in directory", pre)
+	}
+
+	// On a --target host the commands run where its facts say
+	pre, _ = assembled(t, promptSources{runMode: "mock", user: "x", runDir: "/srv/www", opts: Options{Target: "web1"}})
+	if strings.Contains(pre, "/srv/www") {
+		t.Errorf("the pre-prompt = %q, want the local directory left out with --target", pre)
+	}
+}
+
+func TestAssembleModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		sources  promptSources
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "alternatives asked for in the prompt",
+			sources:  promptSources{runMode: "local", opts: Options{Alternatives: 3}},
+			contains: []string{prompt.AlternativesInstruction(3)},
+		},
+		{
+			name:     "Gemini returns alternatives as candidates",
+			sources:  promptSources{runMode: "gemini", opts: Options{Alternatives: 3}},
+			excludes: []string{prompt.AlternativesInstruction(3)},
+		},
+		{
+			name:     "no commands",
+			sources:  promptSources{runMode: "mock", opts: Options{NoCommands: true}},
+			contains: []string{prompt.NoCommandsInstruction()},
+		},
+		{
+			name:     "language",
+			sources:  promptSources{runMode: "mock", lang: "de"},
+			contains: []string{prompt.LanguageInstruction("de")},
+		},
+		{
+			name:     "preprompt setting",
+			sources:  promptSources{runMode: "mock", preprompt: "Prefer doas over sudo.", instruction: " Infer the task."},
+			contains: []string{prompt.UserInstructions("Prefer doas over sudo.") + " Infer the task."},
+		},
+		{
+			name:     "commit message keeps its own pre-prompt",
+			sources:  promptSources{runMode: "mock", commit: commitOptions{enabled: true}, ownPrompt: true, preprompt: "Prefer doas over sudo."},
+			excludes: []string{"Prefer doas over sudo."},
+		},
+		{
+			name:     "commit message",
+			sources:  promptSources{runMode: "mock", commit: commitOptions{enabled: true}, ownPrompt: true, instruction: " Staged diff."},
+			contains: []string{prompt.CommitPrePrompt(false), " Staged diff."},
+			excludes: []string{"testbox", prompt.DefaultPrePrompt},
+		},
+		{
+			name:     "command not found",
+			sources:  promptSources{runMode: "mock", cnf: true, instruction: " Infer the task."},
+			contains: []string{prompt.CommandNotFoundPrePrompt("Test Linux 1.0", []string{"apt"})},
+			excludes: []string{prompt.DefaultPrePrompt, "Infer the task."},
+		},
+		{
+			name:     "chat leaves the instruction out",
+			sources:  promptSources{runMode: "mock", chat: true, instruction: " Infer the task."},
+			excludes: []string{"Infer the task."},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.sources.user = "a prompt"
+			pre, _ := assembled(t, test.sources)
+			for _, want := range test.contains {
+				if !strings.Contains(pre, want) {
+					t.Errorf("the pre-prompt = %q, want %q", pre, want)
+				}
+			}
+			for _, unwanted := range test.excludes {
+				if strings.Contains(pre, unwanted) {
+					t.Errorf("the pre-prompt = %q, want no %q", pre, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestAssembleContinue(t *testing.T) {
+	conversation := "User: list files\nAssistant: Use @run[ls]\n"
+	_, parts := assembled(t, promptSources{runMode: "mock", user: "and hidden ones?", conversation: conversation, opts: Options{Continue: true}})
+	if parts.History != conversation {
+		t.Errorf("History = %q, want the earlier turns", parts.History)
+	}
+
+	_, parts = assembled(t, promptSources{runMode: "mock", user: "and hidden ones?", conversation: conversation})
+	if parts.History != "" {
+		t.Errorf("History = %q without --continue, want none", parts.History)
+	}
+}
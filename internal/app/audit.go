@@ -0,0 +1,57 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/audit"
+	"github.com/micr0-dev/lexido/pkg/errs"
+)
+
+func auditCommand(args []string) int {
+	if len(args) == 0 || args[0] != "tail" {
+		fmt.Println("Usage: lexido audit tail [-n 20]")
+		return errs.ExitUsage
+	}
+
+	flags := flag.NewFlagSet("audit tail", flag.ContinueOnError)
+	n := flags.Int("n", 20, "Number of entries shown")
+	if err := flags.Parse(args[1:]); err != nil {
+		return errs.ExitUsage
+	}
+	if flags.NArg() > 0 || *n <= 0 {
+		fmt.Println("Usage: lexido audit tail [-n 20]")
+		return errs.ExitUsage
+	}
+
+	entries, err := audit.Tail(*n)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the audit log: %v\n", err)
+		return errs.ExitFailure
+	}
+	if len(entries) == 0 {
+		path, _ := audit.Path()
+		fmt.Printf("No commands recorded in %s yet.\n", path)
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tEXIT\tDURATION\tPROVIDER\tDIRECTORY\tCOMMAND")
+	for _, entry := range entries {
+		provider := entry.Provider
+		if entry.Model != "" {
+			provider += " (" + entry.Model + ")"
+		}
+		exit := fmt.Sprint(entry.ExitCode)
+		duration := (time.Duration(entry.DurationMs) * time.Millisecond).Round(time.Millisecond).String()
+		if entry.Status != "" {
+			exit, duration = entry.Status, "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Time.Local().Format("2006-01-02 15:04:05"), exit, duration, provider, entry.Dir, entry.Command)
+	}
+	w.Flush()
+	return 0
+}
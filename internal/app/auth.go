@@ -0,0 +1,298 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/llms/gemini"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+	"github.com/micr0-dev/lexido/pkg/logging"
+)
+
+const authUsage = "Usage: lexido auth status | set <provider> | remove <provider>"
+
+// How long checking a key may take
+const authCheckTimeout = 30 * time.Second
+
+// Returned by the check of a provider whose keys can't be tried on their own, such as the azure preset
+var errNotChecked = errors.New("not checked")
+
+// authProvider is a provider whose API keys lexido auth manages
+type authProvider struct {
+	name   string
+	keyURL string   // Where its keys are created
+	keys   []string // Environment variables and keyring fields of its keys
+	// Tries the keys, which are exported while it runs, with a request the provider rejects bad keys for
+	check func(ctx context.Context) error
+}
+
+// Returns gemini, the built-in presets and remote for the keys remoteConfig.json refers to, when there is one
+func authProviders() []authProvider {
+	providers := []authProvider{{
+		name:   "gemini",
+		keyURL: "https://aistudio.google.com/app/apikey",
+		keys:   []string{"GOOGLE_AI_KEY"},
+		check: func(ctx context.Context) error {
+			valid, err := gemini.IsKeyValid(os.Getenv("GOOGLE_AI_KEY"))
+			if err != nil {
+				return err
+			}
+			if !valid {
+				return errs.Wrap(errs.ErrAuth, errors.New("the key was rejected"))
+			}
+			return nil
+		},
+	}}
+
+	presets, _ := remote.Presets()
+	for _, preset := range presets {
+		providers = append(providers, authProvider{
+			name:   preset.Name,
+			keyURL: preset.KeyURL,
+			keys:   []string{preset.KeyName},
+			check: func(ctx context.Context) error {
+				// The url of presets like azure is only known once its variables are filled in
+				if len(preset.Variables) > 0 {
+					return errNotChecked
+				}
+				_, err := remote.TestPreset(ctx, preset, nil)
+				return err
+			},
+		})
+	}
+
+	if cfg, err := loadRemoteConfig(); err == nil && len(cfg.KeyNames()) > 0 {
+		providers = append(providers, authProvider{
+			name: "remote",
+			keys: cfg.KeyNames(),
+			check: func(ctx context.Context) error {
+				_, err := cfg.Probe(ctx, remote.TestPrompt)
+				return err
+			},
+		})
+	}
+	return providers
+}
+
+// Loads remoteConfig.json without writing the default one when it's missing, as remote.LoadConfig does
+func loadRemoteConfig() (remote.Config, error) {
+	path, err := io.GetFilePath(io.Config, "remoteConfig.json")
+	if err != nil {
+		return remote.Config{}, err
+	}
+	return remote.LoadConfigFile(path)
+}
+
+// Finds the provider of lexido auth set and remove by name, case insensitively
+func lookupAuthProvider(name string) (authProvider, error) {
+	var names []string
+	for _, provider := range authProviders() {
+		if strings.EqualFold(provider.name, name) {
+			return provider, nil
+		}
+		names = append(names, provider.name)
+	}
+	return authProvider{}, errs.Usagef("unknown provider %q, use one of: %s", name, strings.Join(names, ", "))
+}
+
+// Names of the providers, for completion
+func authProviderNames() []string {
+	names := []string{"gemini"}
+	names = append(names, presetNames()...)
+	return append(names, "remote")
+}
+
+func authCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(authUsage)
+		return errs.ExitUsage
+	}
+	switch args[0] {
+	case "status":
+		if len(args) != 1 {
+			fmt.Println("Usage: lexido auth status")
+			return errs.ExitUsage
+		}
+		return authStatus()
+	case "set", "remove":
+		if len(args) != 2 {
+			fmt.Printf("Usage: lexido auth %s <provider>\n", args[0])
+			return errs.ExitUsage
+		}
+		provider, err := lookupAuthProvider(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		if args[0] == "set" {
+			return authSet(provider)
+		}
+		return authRemove(provider)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown auth command %q. Use status, set or remove.\n", args[0])
+		return errs.ExitUsage
+	}
+}
+
+// Lists the keys that are set up, masked and with where they come from, and whether the provider accepts them
+func authStatus() int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROVIDER\tKEY\tVALUE\tSOURCE\tSTATUS")
+	configured := 0
+	for _, provider := range authProviders() {
+		var rows []string
+		set := 0
+		for _, name := range provider.keys {
+			val, source := lookupKey(name)
+			if val == "" {
+				rows = append(rows, fmt.Sprintf("%s\t%s\t\t\tnot set", provider.name, name))
+				continue
+			}
+			set++
+			logging.AddSecret(val)
+			os.Setenv(name, val)
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s\t", provider.name, name, config.Mask(val), source))
+		}
+		if set == 0 {
+			continue
+		}
+		configured++
+
+		status := "valid"
+		if provider.name == "gemini" && geminiUsesVertex() {
+			status = "unused, gemini runs through Vertex AI"
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), authCheckTimeout)
+			err := provider.check(ctx)
+			cancel()
+			if errors.Is(err, errNotChecked) {
+				status = "not checked"
+			} else if err != nil {
+				status = "invalid: " + logging.Redact(err.Error())
+			}
+		}
+		for _, row := range rows {
+			if strings.HasSuffix(row, "\t") {
+				row += status
+			}
+			fmt.Fprintln(w, row)
+		}
+	}
+	w.Flush()
+
+	if configured == 0 {
+		fmt.Println("\nNo API keys are set up yet, add one with lexido auth set <provider>.")
+	}
+	return 0
+}
+
+// Reports whether Gemini is reached through Vertex AI rather than with an API key
+func geminiUsesVertex() bool {
+	auth, _ := config.Get("gemini_auth")
+	return auth == "vertex"
+}
+
+// Returns the key exported or kept in the keyring under name, and which of the two it came from
+func lookupKey(name string) (string, string) {
+	if val := os.Getenv(name); val != "" {
+		return val, "environment"
+	}
+	if val, _ := io.ReadFromKeyring(name); val != "" {
+		return val, io.ActiveKeyring()
+	}
+	return "", ""
+}
+
+// Asks for the keys of the provider and stores them once the provider accepted them, as the first run does for Gemini
+func authSet(provider authProvider) int {
+	reader := bufio.NewReader(os.Stdin)
+	if provider.keyURL != "" {
+		fmt.Printf("Please visit %s to obtain your API key.\n", provider.keyURL)
+	}
+
+	keys := map[string]string{}
+	exported := map[string]bool{}
+	for _, name := range provider.keys {
+		exported[name] = os.Getenv(name) != ""
+		fmt.Printf("Enter your %s here: ", name)
+		answer, err := reader.ReadString('\n')
+		key := strings.TrimSpace(answer)
+		if key == "" {
+			if err != nil {
+				log.Printf("Error reading API key: %v\n", err)
+			}
+			fmt.Println("No API key entered, nothing was changed.")
+			return errs.ExitFailure
+		}
+		logging.AddSecret(key)
+		keys[name] = key
+
+		// The check reads the keys from the environment like every later request does
+		os.Setenv(name, key)
+	}
+
+	fmt.Printf("Checking the key with %s...\n", provider.name)
+	ctx, cancel := context.WithTimeout(context.Background(), authCheckTimeout)
+	defer cancel()
+	if err := provider.check(ctx); errors.Is(err, errNotChecked) {
+		fmt.Printf("The %s key can't be checked on its own, storing it as is.\n", provider.name)
+	} else if err != nil {
+		fmt.Printf("The key doesn't work, nothing was changed: %s\n", logging.Redact(err.Error()))
+		if code := exitCode(err); code != errs.ExitFailure {
+			return code
+		}
+		return errs.ExitAuth
+	}
+
+	for _, name := range provider.keys {
+		if err := io.SaveToKeyring(name, keys[name]); err != nil {
+			log.Printf("Error saving %s: %v\n", name, err)
+			return exitCode(err)
+		}
+		if exported[name] {
+			warnExported(name)
+		}
+	}
+	fmt.Printf("API key for %s set successfully for future sessions.\n", provider.name)
+	return 0
+}
+
+// Deletes the keys of the provider from the keyring
+func authRemove(provider authProvider) int {
+	removed := 0
+	for _, name := range provider.keys {
+		err := io.DeleteFromKeyring(name)
+		if errors.Is(err, io.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error removing %s: %v\n", name, err)
+			return exitCode(err)
+		}
+		removed++
+		if os.Getenv(name) != "" {
+			warnExported(name)
+		}
+	}
+	if removed == 0 {
+		fmt.Printf("No API key for %s is stored.\n", provider.name)
+		return errs.ExitFailure
+	}
+	fmt.Printf("API key for %s removed.\n", provider.name)
+	return 0
+}
+
+// Points out a key that is also exported, since the environment wins over the keyring
+func warnExported(name string) {
+	fmt.Printf("Note: %s is also exported in your environment, which lexido uses before the keyring. Remove it from your shell's rc file too.\n", name)
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/retry"
+	"github.com/micr0-dev/lexido/pkg/runbook"
+)
+
+// Wait between the prompts of a batch unless the batch_delay setting or --delay says otherwise
+const defaultBatchDelay = time.Second
+
+// Options of `lexido batch`, which answers a list of prompts one after another and never runs anything
+type batchOptions struct {
+	enabled bool
+	source  string // File the prompts are read from, - for stdin
+	output  string // Markdown file the runbook is written to, stdout when empty or -
+	delay   time.Duration
+	prompts []string
+}
+
+// Parses the flags of `lexido batch`, which may come before or after the file of prompts
+func parseBatchArgs(args []string) (batchOptions, error) {
+	// The batch_delay setting is the default of --delay
+	defaultDelay := defaultBatchDelay
+	setting, _ := config.Get("batch_delay")
+	if d, err := time.ParseDuration(setting); err == nil && d >= 0 {
+		defaultDelay = d
+	}
+
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	output := fs.String("o", "", "Write the runbook to this markdown file instead of stdout")
+	delay := fs.Duration("delay", defaultDelay, "Wait this long between prompts, to stay below rate limits")
+	fs.Bool("dry-run", false, "Accepted for clarity, lexido batch never runs the suggested commands")
+
+	var files []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(files) > 1 {
+		return batchOptions{}, errs.Usagef("Usage: lexido batch [--delay 1s] [-o runbook.md] [file with one prompt per line, - or none for stdin]")
+	}
+
+	b := batchOptions{enabled: true, source: "-", output: *output, delay: *delay}
+	if len(files) == 1 {
+		b.source = files[0]
+	}
+	return b, nil
+}
+
+// Reads the prompts, one per line of the file or of the piped input. Empty lines and lines starting with # are skipped.
+func (b *batchOptions) load(piped string) error {
+	text := piped
+	if b.source != "-" {
+		data, err := os.ReadFile(b.source)
+		if err != nil {
+			return errs.Usagef("can't read the prompts: %v", err)
+		}
+		text = string(data)
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			b.prompts = append(b.prompts, line)
+		}
+	}
+	if len(b.prompts) == 0 {
+		if b.source == "-" {
+			return errs.Usagef("no prompts to answer, pipe them in one per line or name a file with them")
+		}
+		return errs.Usagef("no prompts to answer in %s, write one per line", b.source)
+	}
+	return nil
+}
+
+// Answers the prompts one after another with the same provider and writes the runbook. A failed prompt doesn't stop
+// the batch, the exit code is the one of the first failure. Piped input and attached files go along with every prompt.
+func (g *generator) runBatch(ctx context.Context, b batchOptions, policy retry.Policy, caching cacheSettings, runMode string, base prompt.Parts, piped string, attached string) int {
+	var sections []runbook.Section
+	var firstErr error
+	failed := 0
+	for i, task := range b.prompts {
+		if i > 0 && b.delay > 0 {
+			select {
+			case <-time.After(b.delay):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", i+1, len(b.prompts), task)
+		parts := base
+		parts.User, _, _ = prompt.BuildUserPrompt(task, piped, attached, false)
+		response, err := g.runQuiet(ctx, policy, caching, runMode, parts)
+		sections = append(sections, runbook.Section{Prompt: task, Response: response, Commands: commands.ParseCommands(response), Err: err})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		g.recordPrompt(task, response, runMode)
+	}
+
+	source := b.source
+	if source == "-" {
+		source = "stdin"
+	}
+	provider := providerLabel(runMode)
+	if model := modelName(runMode); model != "" {
+		provider += " (" + model + ")"
+	}
+	markdown := runbook.Markdown(source, provider, sections, time.Now())
+
+	destination := "on stdout"
+	if b.output == "" || b.output == "-" {
+		fmt.Print(markdown)
+	} else {
+		if err := io.WriteFileAtomic(b.output, []byte(markdown), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write the runbook: %v\n", err)
+			return errs.ExitFailure
+		}
+		destination = "in " + b.output
+	}
+
+	answered := len(sections) - failed
+	summary := fmt.Sprintf("Answered %d of %d prompts", answered, len(b.prompts))
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d failed", failed)
+	}
+	fmt.Fprintf(os.Stderr, "%s. The runbook is %s, nothing was run.\n", summary, destination)
+
+	if ctx.Err() != nil {
+		return errs.ExitInterrupted
+	}
+	if firstErr != nil {
+		return exitCode(firstErr)
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/retry"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// Runs `lexido chat` with the provider main already set up, returning the exit code
+func (g *generator) runChat(runMode string, pre_prompt string, conversation []io.Turn, initial string, runDir string, policy retry.Policy, allowRemoval bool) int {
+	contextWindow := contextWindowFor(runMode)
+
+	transcript, err := tea.RunChat(tea.ChatOptions{
+		Turns:    conversation,
+		Initial:  initial,
+		Provider: runMode,
+		RunDir:   runDir,
+		Generate: func(ctx context.Context, conversation string, send func(tearaw.Msg)) (string, error) {
+			// Older turns are dropped once the session outgrows the context window
+			trimmed, _ := prompt.TrimConversation(conversation, prompt.HistoryBudget(contextWindow, pre_prompt), prompt.DefaultKeepTurns)
+			return g.generateWithRetry(ctx, policy, runMode, prompt.Parts{System: pre_prompt, User: trimmed}, send)
+		},
+		Run: func(cmds []string) {
+			cmds = resolveInteractive(cmds, allowRemoval)
+			commands.RunCommands(cmds, runDir)
+		},
+		SetModel: func(name string) error {
+			switch runMode {
+			case "gemini":
+				gemini.SetModel(name)
+				return nil
+			case "local":
+				return ollama.Init(name)
+			default:
+				return errors.New("the remote model is set in remoteConfig.json")
+			}
+		},
+	})
+	if err != nil {
+		log.Printf("Alas, there's been a Bubble Tea error: %v\n", err)
+		return errs.ExitFailure
+	}
+
+	// The whole session is cached so -c can pick it up later
+	if len(transcript) > 0 {
+		if err := io.SaveConversation(transcript); err != nil {
+			log.Printf("Warning: Failed to cache conversation. Error: %v", err)
+		}
+	}
+	return 0
+}
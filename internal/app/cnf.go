@@ -0,0 +1,40 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/retry"
+)
+
+// How long the command-not-found handler waits for an answer, the shell is blocked until then
+const cnfTimeout = 5 * time.Second
+
+// Returned by `lexido cnf` when the model had no suggestion
+var errNoSuggestion = errors.New("no install suggestion")
+
+// Returns the retry policy of `lexido cnf`: a single short attempt unless --max-attempts or --timeout say otherwise
+func cnfPolicy(opts Options) retry.Policy {
+	policy := retryPolicy(opts.MaxAttempts, opts.Timeout)
+	if opts.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+	if opts.Timeout <= 0 {
+		policy.AttemptTimeout = cnfTimeout
+	}
+	return policy
+}
+
+// Prints the first line of the response as the install suggestion of the command-not-found handler
+func printCommandNotFound(response string) error {
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.Trim(strings.TrimSpace(line), "`")
+		if line != "" {
+			fmt.Println(line)
+			return nil
+		}
+	}
+	return errNoSuggestion
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os/exec"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/git"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// Options of `lexido commit`, which writes a commit message for the staged changes instead of suggesting commands
+type commitOptions struct {
+	enabled      bool
+	conventional bool
+	amend        bool
+}
+
+// Parses the flags of `lexido commit`, returning the remaining arguments as extra instructions
+func parseCommitArgs(args []string) (commitOptions, []string) {
+	fs := flag.NewFlagSet("commit", flag.ExitOnError)
+	conventional := fs.Bool("conventional", false, "Format the message as a Conventional Commit")
+	amend := fs.Bool("amend", false, "Rewrite the message of the last commit, taking it into account")
+	fs.Parse(args)
+
+	return commitOptions{enabled: true, conventional: *conventional, amend: *amend}, fs.Args()
+}
+
+// Builds the request for a commit message from the staged diff
+func (c commitOptions) prompt(extra string) (string, error) {
+	diff, err := git.StagedDiff()
+	if err != nil && !(c.amend && errors.Is(err, git.ErrNothingStaged)) {
+		return "", err
+	}
+	if errors.Is(err, git.ErrNothingStaged) {
+		// Amending only the message is fine, the last commit's changes are described instead
+		diff, err = git.Show("HEAD")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	previous := ""
+	if c.amend {
+		previous, err = git.LastCommitMessage()
+		if err != nil {
+			return "", err
+		}
+	}
+	return prompt.BuildCommitPrompt(diff, previous, extra), nil
+}
+
+// Lets the user edit the generated message and commits with it, returning the exit code
+func (c commitOptions) finish(response string) int {
+	message, ok, err := tea.EditText("Commit message:", git.CleanMessage(response))
+	if err != nil {
+		log.Printf("Alas, there's been a Bubble Tea error: %v\n", err)
+		return errs.ExitFailure
+	}
+	if !ok {
+		fmt.Println("Commit cancelled.")
+		return errs.ExitFailure
+	}
+	if message == "" {
+		fmt.Println("Empty commit message, not committing.")
+		return errs.ExitFailure
+	}
+
+	if err := git.Commit(message, c.amend); err != nil {
+		// git already printed why
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		log.Println(err)
+		return errs.ExitFailure
+	}
+	return 0
+}
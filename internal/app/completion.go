@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/completion"
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/help"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/shellinit"
+)
+
+// Registered here rather than in the subcommands literal, the completion spec lists the subcommands itself
+func init() {
+	subcommands["completion"] = completionCommand
+	subcommands["__complete"] = dynamicCompleteCommand
+}
+
+// How the values of flags are completed, flags not listed here complete nothing or are booleans
+var flagValues = map[string]completion.Flag{
+	"m":               {Value: completion.ValueModel},
+	"setModel":        {Value: completion.ValueModel},
+	"setDefault":      {Value: completion.ValueChoice, Choices: []string{"gemini", "local", "remote"}},
+	"setRemotePreset": {Value: completion.ValueChoice, Choices: presetNames()},
+	"run-in":          {Value: completion.ValueDirectory},
+	"with-path":       {Value: completion.ValueCommand},
+	"t":               {Value: completion.ValueChoice, Choices: templateNames()},
+	"template":        {Value: completion.ValueChoice, Choices: templateNames()},
+}
+
+// Builds the completion spec from the registered flags and subcommands, so new ones are picked up automatically
+func completionSpec() completion.Spec {
+	spec := completion.Spec{Program: "lexido"}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		cf := flagValues[f.Name]
+		cf.Name = f.Name
+		_, cf.Description = flag.UnquoteUsage(f)
+		if cf.Value == completion.ValueNone {
+			if !isBoolFlag(f) {
+				cf.Value = completion.ValueAny
+			}
+		}
+		spec.Flags = append(spec.Flags, cf)
+	})
+
+	spec.Subcommands = []completion.Subcommand{
+		{Name: "audit", Description: "Show the last commands lexido ran", Words: [][]string{{"tail"}, {"-n"}}},
+		{Name: "auth", Description: "Show, replace or remove the stored API keys", Words: [][]string{{"status", "set", "remove"}, authProviderNames()}},
+		{Name: "config", Description: "Inspect and change settings", Words: [][]string{{"list", "get", "set", "unset"}, config.Names()}},
+		{Name: "fav", Description: "List, search, run or remove the commands saved with *", Words: [][]string{{"list", "search", "run", "rm"}, {"--json"}}},
+		{Name: "history", Description: "Show or clear the cached conversation", Words: [][]string{{"show", "clear"}, {"--json"}}},
+		{Name: "cache", Description: "Clear the response cache", Words: [][]string{{"clear"}}},
+		{Name: "models", Description: "List the models of ollama or OpenRouter", Words: [][]string{{"--provider", "--search", "--json"}, modelProviders}},
+		{Name: "remote", Description: "Set up the remote config from a provider preset or test it", Words: [][]string{{"init", "test"}, presetNames()}},
+		{Name: "stats", Description: "Show the tokens used, their cost and how many suggestions ran", Words: [][]string{{"reset", "--since", "--json"}}},
+		{Name: "commit", Description: "Write a commit message for the staged changes", Words: [][]string{{"--conventional", "--amend"}}},
+		{Name: "alias", Description: "Write a shell alias or function and save it to the aliases file", Words: [][]string{{"--shell"}, shellinit.Shells}},
+		{Name: "edit", Description: "Ask for a diff of a file and apply it, keeping a .bak of the original", Words: [][]string{{"--apply"}}},
+		{Name: "batch", Description: "Answer a file of prompts, one per line, into a markdown runbook without running anything", Words: [][]string{{"-o", "--delay", "--dry-run"}}},
+		{Name: "summarize", Description: "Summarize piped text or attached files, without suggesting commands"},
+		{Name: "chat", Description: "Keep a conversation going in one session"},
+		{Name: "templates", Description: "List the prompt templates of -t", Words: [][]string{{"list"}}},
+		{Name: "fix", Description: "Suggest a corrected version of the last command, needs lexido shell-init"},
+		{Name: "completion", Description: "Print a shell completion script", Words: [][]string{completion.Shells}},
+		{Name: "help", Description: "Show the help, or a longer help topic", Words: [][]string{help.TopicNames()}},
+		{Name: "man", Description: "Print the man page, e.g. lexido man > lexido.1"},
+		{Name: "update", Description: "Replace lexido with the newest release", Words: [][]string{{"--check"}}},
+		{Name: "shell-init", Description: "Print the shell widgets to eval from your rc file", Words: [][]string{append([]string{"--command-not-found"}, shellinit.Shells...)}},
+	}
+	return spec
+}
+
+func completionCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("Usage: lexido completion bash|zsh|fish")
+		return errs.ExitUsage
+	}
+
+	script, err := completion.Generate(args[0], completionSpec())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return errs.ExitUsage
+	}
+	fmt.Print(script)
+	return 0
+}
+
+// Prints candidates for values that change at runtime, called by the completion scripts
+func dynamicCompleteCommand(args []string) int {
+	if len(args) != 1 || args[0] != "models" {
+		return errs.ExitUsage
+	}
+
+	// Completion must stay snappy when ollama isn't running
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	models, err := ollama.ListModels(ctx)
+	if err != nil {
+		return errs.ExitFailure
+	}
+	for _, model := range models {
+		fmt.Println(model)
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/patch"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+)
+
+// Options of `lexido edit`, which asks for a diff of a file instead of commands
+type editOptions struct {
+	enabled  bool
+	path     string
+	apply    bool   // Apply the diff without asking
+	original []byte // Content of the file sent to the model, the diff applies to it
+}
+
+// Takes a flag or a file that exists, `lexido edit my fstab to mount the usb disk` is a prompt
+func editTakes(args []string) bool {
+	if strings.HasPrefix(args[0], "-") {
+		return true
+	}
+	_, err := os.Stat(args[0])
+	return err == nil
+}
+
+// Parses the flags of `lexido edit` and reads the file, returning the remaining arguments as what to change
+func parseEditArgs(args []string) (editOptions, []string, error) {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "Apply the diff without asking, the original is kept as <file>.bak")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		return editOptions{}, nil, errs.Usagef("Usage: lexido edit [--apply] <file> <what to change>")
+	}
+	path := fs.Arg(0)
+	info, err := os.Stat(path)
+	if err != nil {
+		return editOptions{}, nil, errs.Usagef("can't edit %s: %v", path, err)
+	}
+	if info.IsDir() {
+		return editOptions{}, nil, errs.Usagef("can't edit %s: it is a directory", path)
+	}
+	if info.Size() > io.MaxAttachmentSize {
+		return editOptions{}, nil, errs.Usagef("can't edit %s: it is larger than %d KB", path, io.MaxAttachmentSize/1024)
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return editOptions{}, nil, errs.Usagef("can't edit %s: %v", path, err)
+	}
+	if io.IsBinary(original) {
+		return editOptions{}, nil, errs.Usagef("can't edit %s: it is a binary file", path)
+	}
+	return editOptions{enabled: true, path: path, apply: *apply, original: original}, fs.Args()[1:], nil
+}
+
+// Builds the request for a diff of the file
+func (e editOptions) prompt(instructions string) string {
+	return prompt.BuildEditPrompt(e.path, string(e.original), strings.TrimSpace(instructions))
+}
+
+// errNotApplied is returned when the user declined to apply the diff
+var errNotApplied = errors.New("not applied")
+
+// Applies the diff of the response to the file, asking first with ask. It returns what was done, or why the
+// diff wasn't applied.
+func (e editOptions) applyDiff(response string, ask bool) (string, error) {
+	diff, err := patch.Parse(response)
+	if err != nil {
+		return "", err
+	}
+	updated, err := diff.Apply(string(e.original))
+	if err != nil {
+		return "", fmt.Errorf("the diff doesn't fit %s: %w", e.path, err)
+	}
+
+	backup := e.path + ".bak"
+	if ask {
+		fmt.Printf("Apply the diff to %s, keeping the original as %s? [y/N] ", e.path, backup)
+		if answer := strings.ToLower(strings.TrimSpace(commands.ReadLine())); answer != "y" && answer != "yes" {
+			return "", errNotApplied
+		}
+	}
+
+	// The file may have changed while the model was answering, the diff was made for what it was sent
+	current, err := os.ReadFile(e.path)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(current, e.original) {
+		return "", fmt.Errorf("%s changed since it was sent", e.path)
+	}
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(backup, e.original, info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("the backup failed: %w", err)
+	}
+	if err := os.WriteFile(e.path, []byte(updated), info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("writing %s failed, the original is in %s: %w", e.path, backup, err)
+	}
+	return fmt.Sprintf("Applied the diff to %s, the original is in %s.", e.path, backup), nil
+}
+
+// Offers to apply the diff once the TUI is closed, or applies it right away with --apply. Returns the exit code.
+func (e editOptions) finish(response string) int {
+	done, err := e.applyDiff(response, !e.apply)
+	if errors.Is(err, errNotApplied) {
+		fmt.Println("Not applied.")
+		return errs.ExitFailure
+	}
+	if err != nil {
+		fmt.Printf("Not applying: %v.\n", err)
+		return errs.ExitFailure
+	}
+	fmt.Println(done)
+	return 0
+}
@@ -0,0 +1,30 @@
+package app
+
+import (
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/jsonout"
+)
+
+// Exit codes of the error codes written with --json, the others exit with errs.ExitFailure
+var exitCodes = map[string]int{
+	jsonout.CodeInvalid:     errs.ExitUsage,
+	jsonout.CodeNoPrompt:    errs.ExitUsage,
+	jsonout.CodeAuth:        errs.ExitAuth,
+	jsonout.CodeRateLimited: errs.ExitRateLimited,
+	jsonout.CodeUnavailable: errs.ExitRateLimited,
+	jsonout.CodeNetwork:     errs.ExitNetwork,
+	jsonout.CodeTimeout:     errs.ExitNetwork,
+	jsonout.CodeBlocked:     errs.ExitBlocked,
+}
+
+// Returns the exit code lexido ends with because of err, the kinds of pkg/errs first and then the classification
+// of provider errors --json reports
+func exitCode(err error) int {
+	if code := errs.ExitCode(err); code != errs.ExitFailure {
+		return code
+	}
+	if code, ok := exitCodes[jsonout.Code(err)]; ok {
+		return code
+	}
+	return errs.ExitFailure
+}
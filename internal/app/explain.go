@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// Returns the function the TUI explains commands with. It asks the provider already set up for runMode directly,
+// without retries, fallbacks or the response cache, and gives up after timeout.
+func (g *generator) explainer(runMode string, timeout time.Duration) tea.ExplainerMsg {
+	return func(ctx context.Context, command string) (string, error) {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		parts := prompt.ExplainPrompt(command)
+		var usage *tea.UsageMsg
+		// Only the usage is kept, the explanation must not stream into the response
+		discard := func(msg tearaw.Msg) {
+			if u, ok := msg.(tea.UsageMsg); ok {
+				usage = &u
+			}
+		}
+		start := time.Now()
+		explanation, err := g.provider(ctx, runMode, parts, discard)
+		if explanation != "" {
+			recordUsage(runMode, parts.Text(), explanation, usage)
+		}
+		if errors.Is(err, context.Canceled) {
+			return "", err
+		}
+		if err != nil {
+			logging.Warnf("Explaining %q failed after %s: %v", command, time.Since(start).Round(time.Millisecond), err)
+			return "", err
+		}
+		logging.Infof("Explained %q in %s", command, time.Since(start).Round(time.Millisecond))
+		return strings.TrimSpace(explanation), nil
+	}
+}
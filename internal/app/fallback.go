@@ -0,0 +1,148 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/jsonout"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	"github.com/micr0-dev/lexido/pkg/llms/mock"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+	"github.com/micr0-dev/lexido/pkg/logging"
+)
+
+// Parses a comma separated list of providers into run modes, ollama is accepted for local
+func parseProviders(list string) ([]string, error) {
+	var modes []string
+	for _, name := range strings.Split(list, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "gemini", "local", "remote", "mock":
+			modes = append(modes, name)
+		case "ollama":
+			modes = append(modes, "local")
+		default:
+			return nil, fmt.Errorf("unknown provider %q, use gemini, ollama or remote separated by commas", name)
+		}
+	}
+	return modes, nil
+}
+
+// Returns the providers to fall back to from runMode: those after it in the fallback setting,
+// or all of them when runMode isn't in it
+func fallbackChain(runMode string) []string {
+	setting, err := config.Get("fallback")
+	if err != nil || setting == "" {
+		return nil
+	}
+	modes, err := parseProviders(setting)
+	if err != nil {
+		logging.Warnf("Ignoring the fallback setting: %v", err)
+		return nil
+	}
+	for i, mode := range modes {
+		if mode == runMode {
+			modes = modes[i+1:]
+			break
+		}
+	}
+
+	var chain []string
+	seen := map[string]bool{runMode: true}
+	for _, mode := range modes {
+		if !seen[mode] {
+			seen[mode] = true
+			chain = append(chain, mode)
+		}
+	}
+	return chain
+}
+
+// Reports whether err is a hard failure worth trying the next provider for. Cancelling is never one,
+// nor are errors the next provider would run into as well, such as a blocked prompt.
+func shouldFallBack(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch jsonout.Code(err) {
+	case jsonout.CodeAuth, jsonout.CodeRateLimited, jsonout.CodeUnavailable, jsonout.CodeNetwork, jsonout.CodeTimeout:
+		return true
+	}
+	return false
+}
+
+// Sets a fallback provider up from the saved settings. Unlike the provider lexido runs with nothing is asked for,
+// a provider without its key is skipped.
+func (g *generator) setupFallback(mode string) error {
+	if g.ready[mode] {
+		return nil
+	}
+
+	var err error
+	switch mode {
+	case "gemini":
+		if setting, settingErr := config.Get("gemini_safety"); settingErr == nil {
+			if err := gemini.SetSafety(setting); err != nil {
+				return fmt.Errorf("invalid gemini_safety setting: %w", err)
+			}
+		}
+		if auth, _ := config.Get("gemini_auth"); auth == "vertex" {
+			project, _ := config.Get("gcp_project")
+			location, _ := config.Get("gcp_location")
+			err = gemini.SetupVertex(project, location)
+			break
+		}
+		apiKey := os.Getenv("GOOGLE_AI_KEY")
+		if apiKey == "" {
+			apiKey, _ = io.ReadFromKeyring("GOOGLE_AI_KEY")
+		}
+		if apiKey == "" {
+			return errors.New("no Gemini API key found")
+		}
+		logging.AddSecret(apiKey)
+		err = gemini.Setup(apiKey)
+	case "local":
+		model, modelErr := io.GetOrInit("OLLAMA_MODEL", "llama3")
+		if modelErr != nil {
+			return fmt.Errorf("reading the ollama model: %w", modelErr)
+		}
+		if setting, settingErr := config.Get("ollama_options"); settingErr == nil {
+			opts, err := ollama.ParseOptions(setting)
+			if err == nil {
+				err = ollama.SetOptions(opts)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid ollama_options setting: %w", err)
+			}
+		}
+		err = ollama.Init(model)
+	case "mock":
+		err = mock.Load()
+	case "remote":
+		cfg, loadErr := remote.LoadConfig()
+		if loadErr != nil {
+			return loadErr
+		}
+		if missing := cfg.MissingKeys(); len(missing) > 0 {
+			return &remote.MissingKeyError{Name: missing[0]}
+		}
+		err = cfg.Validate()
+	}
+	if err == nil {
+		g.ready[mode] = true
+	}
+	return err
+}
+
+// Name of a provider as the user knows it, the local mode is ollama
+func providerLabel(mode string) string {
+	if mode == "local" {
+		return "ollama"
+	}
+	return mode
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/micr0-dev/lexido/pkg/audit"
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/favorites"
+)
+
+const favUsage = "Usage: lexido fav list [--json] | search [--json] <text> | run <n> | rm <n>"
+
+// Commands saved with * in the TUI are recalled from the favorites file, without asking a provider
+func favCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(favUsage)
+		return errs.ExitUsage
+	}
+
+	switch args[0] {
+	case "list", "search":
+		flags := flag.NewFlagSet("fav "+args[0], flag.ContinueOnError)
+		asJSON := flags.Bool("json", false, "Print the favorites as JSON")
+		if err := flags.Parse(args[1:]); err != nil {
+			return errs.ExitUsage
+		}
+		text := strings.Join(flags.Args(), " ")
+		if (args[0] == "list") != (text == "") {
+			fmt.Println(favUsage)
+			return errs.ExitUsage
+		}
+		favs, err := favorites.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read the favorites: %v\n", err)
+			return errs.ExitFailure
+		}
+		return printFavorites(favs, text, *asJSON)
+	case "run", "rm":
+		if len(args) != 2 {
+			fmt.Println(favUsage)
+			return errs.ExitUsage
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%q is not a favorite number, lexido fav list shows them\n", args[1])
+			return errs.ExitUsage
+		}
+		if args[0] == "rm" {
+			removed, err := favorites.Remove(n)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to remove the favorite: %v\n", err)
+				return errs.ExitFailure
+			}
+			fmt.Printf("Removed %s from the favorites.\n", removed.Command)
+			return 0
+		}
+		return runFavorite(n)
+	}
+	fmt.Println(favUsage)
+	return errs.ExitUsage
+}
+
+// Prints the favorites matching the text, all of them for an empty text, numbered as lexido fav list numbers them
+func printFavorites(favs []favorites.Favorite, text string, asJSON bool) int {
+	type numbered struct {
+		Number int `json:"number"`
+		favorites.Favorite
+	}
+	matches := []numbered{}
+	for i, fav := range favs {
+		if text == "" || fav.Matches(text) {
+			matches = append(matches, numbered{Number: i + 1, Favorite: fav})
+		}
+	}
+
+	if asJSON {
+		out, _ := json.MarshalIndent(matches, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	if len(matches) == 0 {
+		if text != "" {
+			fmt.Printf("No favorite matches %q.\n", text)
+			return errs.ExitFailure
+		}
+		fmt.Println("No favorites yet, press * on a suggested command to save one.")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tCOMMAND\tTAGS\tPROMPT")
+	for _, fav := range matches {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", fav.Number, fav.Command, strings.Join(fav.Tags, ","), fav.Prompt)
+	}
+	w.Flush()
+	return 0
+}
+
+// Runs a favorite the way a selected suggestion runs, confirmed first and recorded in the audit log
+func runFavorite(n int) int {
+	favs, err := favorites.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the favorites: %v\n", err)
+		return errs.ExitFailure
+	}
+	if n < 1 || n > len(favs) {
+		fmt.Fprintf(os.Stderr, "There is no favorite %d, lexido fav list shows their numbers.\n", n)
+		return errs.ExitFailure
+	}
+	fav := favs[n-1]
+
+	if setting, err := config.Get("audit"); err == nil {
+		enabled, _ := strconv.ParseBool(setting)
+		audit.Disabled = !enabled
+	}
+	audit.SetSession(fav.Provider, fav.Model, fav.Prompt)
+
+	runDir := workingDir()
+	if err := commands.CheckRunDir(runDir); err != nil {
+		log.Printf("Not running the favorite: %v.\n", err)
+		return errs.ExitFailure
+	}
+	// Nothing was picked in the TUI, so the command is always confirmed before it runs
+	commands.ConfirmEach = true
+	return exitCode(commands.RunCommands(resolveInteractive([]string{fav.Command}, false), runDir))
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/retry"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// Limits of --fix-loop, so a stubborn failure can't burn through the API quota
+type fixLoopOptions struct {
+	maxIterations int
+	tokenBudget   int
+	auto          bool // -y, run every suggestion without asking
+	allowRemoval  bool
+}
+
+// Runs suggestions and feeds failures back to the model until a command succeeds or a limit is hit.
+// Every iteration is appended to the conversation cache. It returns the exit code.
+func (g *generator) runFixLoop(ctx context.Context, opts fixLoopOptions, policy retry.Policy, runMode string, pre_prompt string, conversation string, user_prompt string, runDir string) int {
+	pre_prompt += prompt.FixLoopInstruction
+	contextWindow := contextWindowFor(runMode)
+
+	message := user_prompt
+	spent := 0
+	var lastFailure error
+	for iteration := 1; iteration <= opts.maxIterations; iteration++ {
+		conversation += io.FormatTurn("user", message)
+		trimmed, _ := prompt.TrimConversation(conversation, prompt.HistoryBudget(contextWindow, pre_prompt), prompt.DefaultKeepTurns)
+		parts := prompt.Parts{System: pre_prompt, User: trimmed}
+
+		if spent+prompt.EstimateTokens(parts.Text()) > opts.tokenBudget {
+			fmt.Printf("Stopping: the next attempt would go over the budget of %d tokens (%d spent).\n", opts.tokenBudget, spent)
+			return errs.ExitFailure
+		}
+
+		header := fmt.Sprintf("Fix attempt %d/%d (about %d of %d tokens spent)", iteration, opts.maxIterations, spent, opts.tokenBudget)
+		if commands.Target != "" {
+			header += ", commands run on " + commands.Target + " over SSH"
+		}
+		response, picked, used, err := g.fixIteration(ctx, opts.auto, policy, runMode, parts, runDir, header)
+		if used == 0 {
+			used = prompt.EstimateTokens(parts.Text()) + prompt.EstimateTokens(response)
+		}
+		spent += used
+
+		if response != "" {
+			conversation += io.FormatTurn("assistant", response)
+			if err := io.AppendTurns(exchange(message, response, runMode, picked)...); err != nil {
+				log.Printf("Warning: Failed to cache conversation. Error: %v", err)
+			}
+		}
+		if err != nil {
+			if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+				return errs.ExitInterrupted
+			}
+			log.Println(err)
+			return exitCode(err)
+		}
+		if len(picked) == 0 {
+			fmt.Println("No command to run, stopping the fix loop.")
+			return errs.ExitFailure
+		}
+
+		if err := commands.CheckRunDir(runDir); err != nil {
+			log.Printf("Not running the selected commands: %v.\n", err)
+			return errs.ExitFailure
+		}
+		results := commands.RunCommandsCapture(resolveInteractive(picked, opts.allowRemoval), runDir)
+
+		failed := false
+		for _, r := range results {
+			if r.ExitCode != 0 {
+				failed = true
+				lastFailure = &errs.CommandError{Command: r.Command, ExitCode: r.ExitCode}
+			}
+		}
+		if !failed {
+			fmt.Printf("Succeeded after %d attempt(s).\n", iteration)
+			return 0
+		}
+
+		message = prompt.FixFeedback(results)
+		if ctx.Err() != nil {
+			return errs.ExitInterrupted
+		}
+	}
+
+	fmt.Printf("Giving up after %d attempts, the conversation is cached so -c can pick it up.\n", opts.maxIterations)
+	if lastFailure == nil {
+		return errs.ExitFailure
+	}
+	return exitCode(lastFailure)
+}
+
+// Generates one suggestion of the fix loop and returns it with the commands to run.
+// Unless auto is set the TUI is shown and running the commands needs a keypress there.
+func (g *generator) fixIteration(ctx context.Context, auto bool, policy retry.Policy, runMode string, parts prompt.Parts, runDir string, header string) (response string, picked []string, tokens int, err error) {
+	var usage tea.UsageMsg
+	if auto {
+		fmt.Println(header)
+		response, err = g.generateWithRetry(ctx, policy, runMode, parts, func(msg tearaw.Msg) {
+			switch msg := msg.(type) {
+			case tea.AppendResponseMsg:
+				fmt.Print(string(msg))
+			case tea.AppendCandidateMsg:
+				if msg.Index == 0 {
+					fmt.Print(msg.Text)
+				}
+			case tea.UsageMsg:
+				usage = msg
+			}
+		})
+		fmt.Println()
+		for _, cmd := range commands.ParseCommands(response) {
+			if strings.TrimSpace(cmd) != "" {
+				picked = append(picked, cmd)
+			}
+		}
+		return response, picked, usage.TotalTokens, err
+	}
+
+	genCtx, cancelGeneration := context.WithCancel(ctx)
+	defer cancelGeneration()
+
+	cmds := new([]string)
+	program := newProgram(ctx, cmds, runMode == "local", runDir)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	var finalModel tearaw.Model
+	var teaErr error
+	go func() {
+		defer wg.Done()
+		defer cancelGeneration()
+		finalModel, teaErr = program.Run()
+	}()
+
+	program.Send(tea.HeaderMsg(header))
+	program.Send(g.waitingMsg(runMode))
+	program.Send(g.explainer(runMode, policy.AttemptTimeout))
+	response, err = g.generateWithRetry(genCtx, policy, runMode, parts, func(msg tearaw.Msg) {
+		if u, ok := msg.(tea.UsageMsg); ok {
+			usage = u
+		}
+		program.Send(msg)
+	})
+	if err != nil {
+		program.Quit()
+		wg.Wait()
+		if tea.Interrupted(finalModel) {
+			return response, nil, usage.TotalTokens, context.Canceled
+		}
+		if errors.Is(err, context.Canceled) {
+			// Closed before the response was complete
+			return response, nil, usage.TotalTokens, nil
+		}
+		return response, nil, usage.TotalTokens, err
+	}
+
+	program.Send(tea.GenerationDoneMsg{})
+	wg.Wait()
+
+	if teaErr != nil && !errors.Is(teaErr, tearaw.ErrProgramKilled) {
+		return response, nil, usage.TotalTokens, teaErr
+	}
+	if tea.Interrupted(finalModel) {
+		return response, nil, usage.TotalTokens, context.Canceled
+	}
+	return response, *cmds, usage.TotalTokens, nil
+}
@@ -0,0 +1,385 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+	"github.com/google/generative-ai-go/genai"
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/format"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	"github.com/micr0-dev/lexido/pkg/llms/mock"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/retry"
+	"github.com/micr0-dev/lexido/pkg/stats"
+	"github.com/micr0-dev/lexido/pkg/tea"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// Returns the retry policy, --max-attempts and --timeout override the max_attempts and timeout settings
+func retryPolicy(maxAttempts int, timeout time.Duration) retry.Policy {
+	policy := retry.DefaultPolicy
+	if maxAttempts > 0 {
+		policy.MaxAttempts = maxAttempts
+	} else if attempts, err := config.Get("max_attempts"); err == nil {
+		if n, err := strconv.Atoi(attempts); err == nil && n > 0 {
+			policy.MaxAttempts = n
+		}
+	}
+
+	if timeout > 0 {
+		policy.AttemptTimeout = timeout
+	} else if setting, err := config.Get("timeout"); err == nil {
+		if d, err := time.ParseDuration(setting); err == nil && d > 0 {
+			policy.AttemptTimeout = d
+		}
+	}
+	return policy
+}
+
+// Default of the wait_hint setting
+const defaultWaitHint = 10 * time.Second
+
+// Returns what the TUI shows until the first chunk arrives, the wait_hint setting says when the hint about --timeout is added
+func (g *generator) waitingMsg(runMode string) tea.WaitingMsg {
+	msg := tea.WaitingMsg{Model: modelName(runMode), HintAfter: defaultWaitHint}
+	if msg.Model == "" {
+		msg.Model = providerLabel(runMode)
+	}
+	if g.racing.active() {
+		var models []string
+		for _, mode := range g.racing.modes {
+			models = append(models, providerWithModel(mode))
+		}
+		msg.Model = strings.Join(models, " and ")
+	}
+	if setting, err := config.Get("wait_hint"); err == nil {
+		if d, err := time.ParseDuration(setting); err == nil && d > 0 {
+			msg.HintAfter = d
+		}
+	}
+	return msg
+}
+
+// Returns the provider, model and mode of the run, for the status line of the TUI and the header of -q and --json
+func metadata(opts Options, runMode string) tea.SetMetadataMsg {
+	msg := tea.SetMetadataMsg{Provider: providerLabel(runMode), Model: modelName(runMode)}
+	if runMode == "local" {
+		msg.Flags = append(msg.Flags, "local")
+	}
+	if opts.Continue {
+		msg.Flags = append(msg.Flags, "continued")
+	}
+	if opts.SaveScript != "" {
+		msg.Flags = append(msg.Flags, "dry run")
+	}
+	if opts.Target != "" {
+		msg.Flags = append(msg.Flags, "on "+opts.Target)
+	}
+	if opts.NoCommands {
+		msg.Flags = append(msg.Flags, "no commands")
+	}
+	return msg
+}
+
+// Generates the response with the provider and its fallbacks, or with all providers of --race or --compare
+func (g *generator) generateWithRetry(ctx context.Context, policy retry.Policy, runMode string, parts prompt.Parts, send func(tearaw.Msg)) (string, error) {
+	if g.racing.active() {
+		if g.racing.compare {
+			return g.generateCompare(ctx, policy, g.racing.modes, parts, send)
+		}
+		return g.generateRace(ctx, policy, g.racing.modes, parts, send)
+	}
+	return g.generateWithFallback(ctx, policy, runMode, parts, send)
+}
+
+// Runs generateAttempts with the provider, and with the providers of the fallback chain in turn while they fail hard.
+// A fallback starts the prompt over, what streamed in from the failed provider is discarded.
+func (g *generator) generateWithFallback(ctx context.Context, policy retry.Policy, runMode string, parts prompt.Parts, send func(tearaw.Msg)) (string, error) {
+	responseContent, err := g.generateAttempts(ctx, policy, runMode, parts, send)
+	failed := runMode
+	for _, next := range fallbackChain(runMode) {
+		if !shouldFallBack(ctx, err) {
+			break
+		}
+		if len(parts.Images) > 0 && !visionProviders[next] {
+			logging.Warnf("Not falling back to %s: it can't read images", providerLabel(next))
+			continue
+		}
+		if setupErr := g.setupFallback(next); setupErr != nil {
+			logging.Warnf("Not falling back to %s: %v", providerLabel(next), setupErr)
+			continue
+		}
+		logging.Warnf("%s failed, falling back to %s: %v", providerLabel(failed), providerLabel(next), err)
+		send(tea.ResetResponseMsg{})
+		send(tea.FellBackMsg{Provider: next, Model: modelName(next)})
+		responseContent, err = g.generateAttempts(ctx, policy, next, parts, send)
+		failed = next
+	}
+	return responseContent, err
+}
+
+// Returns the function the TUI asks for another suggestion with. The prompt is sent again asking for a different
+// approach, with the same retries and fallbacks but past the response cache, and streams into the given candidate.
+// With --compare each candidate is asked of the provider it came from.
+func (g *generator) regenerator(policy retry.Policy, runMode string, parts prompt.Parts, send func(tearaw.Msg)) tea.RegenerateMsg {
+	return func(ctx context.Context, candidate int, previous []string) error {
+		again := parts
+		again.User += prompt.DifferentApproach(previous)
+		mode, regenerate := runMode, g.generateWithRetry
+		if g.racing.compare && candidate < len(g.racing.modes) {
+			mode, regenerate = g.racing.modes[candidate], g.generateWithFallback
+		}
+		_, err := regenerate(ctx, policy, mode, again, func(msg tearaw.Msg) {
+			switch msg := msg.(type) {
+			case tea.AppendResponseMsg:
+				send(tea.AppendCandidateMsg{Index: candidate, Text: string(msg)})
+			case tea.AppendCandidateMsg:
+				// Of the alternatives Gemini returns with --alternatives only the first one is kept
+				if msg.Index == 0 {
+					send(tea.AppendCandidateMsg{Index: candidate, Text: msg.Text})
+				}
+			case tea.ResetResponseMsg:
+				send(tea.ResetCandidateMsg{Index: candidate})
+			default:
+				send(msg)
+			}
+		})
+		return err
+	}
+}
+
+// Runs generate, restarting it with backoff when the provider is rate limited or the stream drops
+func (g *generator) generateAttempts(ctx context.Context, policy retry.Policy, runMode string, parts prompt.Parts, send func(tearaw.Msg)) (string, error) {
+	var responseContent string
+	var usage *tea.UsageMsg
+	start := time.Now()
+	logging.Debugf("Prompt is %d bytes", len(parts.Text()))
+
+	// Usage is reported once the response is complete, with its cost. The text is streamed with LF newlines only,
+	// each candidate on its own since their chunks interleave.
+	streams := map[int]*format.NewlineStream{}
+	normalize := func(candidate int, text string) string {
+		if streams[candidate] == nil {
+			streams[candidate] = &format.NewlineStream{}
+		}
+		return streams[candidate].Chunk(text)
+	}
+	forward := func(msg tearaw.Msg) {
+		switch msg := msg.(type) {
+		case tea.UsageMsg:
+			usage = &msg
+		case tea.AppendResponseMsg:
+			send(tea.AppendResponseMsg(normalize(0, string(msg))))
+		case tea.AppendCandidateMsg:
+			msg.Text = normalize(msg.Index, msg.Text)
+			send(msg)
+		default:
+			send(msg)
+		}
+	}
+
+	err := retry.Do(ctx, policy, func(ctx context.Context, attempt int) error {
+		if attempt > 1 {
+			// None of the backends can resume a stream, the retried request starts over
+			send(tea.ResetResponseMsg{})
+			usage = nil
+			streams = map[int]*format.NewlineStream{}
+		}
+		attemptStart := time.Now()
+		var err error
+		responseContent, err = g.provider(ctx, runMode, parts, forward)
+		responseContent = format.NormalizeNewlines(responseContent)
+		if err != nil {
+			logging.Infof("Attempt %d failed after %s: %v", attempt, time.Since(attemptStart).Round(time.Millisecond), err)
+		}
+		return err
+	}, func(attempt int, wait time.Duration, err *retry.Error) {
+		logging.Warnf("%s, retrying in %s (attempt %d/%d): %v", err.Reason(), wait.Round(time.Millisecond), attempt, policy.MaxAttempts, err)
+		send(tea.RetryingMsg{Attempt: attempt, Max: policy.MaxAttempts, Wait: wait, Reason: err.Reason()})
+	})
+
+	var timeout *retry.TimeoutError
+	if errors.As(err, &timeout) {
+		timeout.Provider = runMode
+	}
+
+	if err == nil {
+		logging.Infof("Response of %d bytes from %s took %s", len(responseContent), runMode, time.Since(start).Round(time.Millisecond))
+	} else {
+		logging.Errorf("Generation with %s failed after %s: %v", runMode, time.Since(start).Round(time.Millisecond), err)
+	}
+
+	if responseContent != "" {
+		send(recordUsage(runMode, parts.Text(), responseContent, usage))
+	}
+	return responseContent, err
+}
+
+// Prices the usage of a request and adds it to the stats file. Only Gemini reports its tokens,
+// for the other providers they are estimated from the prompt and response.
+func recordUsage(runMode string, str_prompt string, response string, usage *tea.UsageMsg) tea.UsageMsg {
+	var u tea.UsageMsg
+	if usage != nil {
+		u = *usage
+	} else {
+		u = tea.UsageMsg{PromptTokens: prompt.EstimateTokens(str_prompt), ResponseTokens: prompt.EstimateTokens(response), Estimated: true}
+		u.TotalTokens = u.PromptTokens + u.ResponseTokens
+	}
+
+	prices := priceTable()
+	model := modelName(runMode)
+	u.Cost, u.Priced = stats.Cost(runMode, model, u.PromptTokens, u.ResponseTokens, prices)
+	if err := stats.Record(runMode, model, u.PromptTokens, u.ResponseTokens, u.Estimated, prices); err != nil {
+		logging.Warnf("Error recording usage stats: %v", err)
+	}
+	return u
+}
+
+// Returns the prices setting, an invalid one is logged and the known prices are used instead
+func priceTable() map[string]stats.Price {
+	setting, err := config.Get("prices")
+	if err != nil || setting == "" {
+		return nil
+	}
+	prices, err := stats.ParsePrices(setting)
+	if err != nil {
+		logging.Warnf("Ignoring the prices setting: %v", err)
+		return nil
+	}
+	return prices
+}
+
+// What the prompts of a run are generated with, Run sets it up from the flags and hands it down
+// instead of leaving it in package variables for the next run
+type generator struct {
+	provider   Provider        // generate, or App.Provider when it is set
+	racing     raceOptions     // Providers of --race or --compare
+	noCommands bool            // Set by --no-commands and lexido summarize, no commands are taken from the response
+	ready      map[string]bool // Providers set up for the run, the one it runs with first and fallbacks on first use
+}
+
+// Providers that can read the images of a prompt, the others only take text
+var visionProviders = map[string]bool{"gemini": true, "local": true}
+
+// Returns the error for images sent to a provider that only reads text
+func noVisionError(runMode string) error {
+	return errs.Usagef("%s can't read images, use Gemini (-g) or an ollama vision model such as llava (-l -m llava)", providerLabel(runMode))
+}
+
+// Streams the response of the selected backend into the TUI and returns the full response.
+// It never exits the process, errors are returned so the caller can shut the TUI down first.
+func generate(ctx context.Context, runMode string, parts prompt.Parts, send func(tearaw.Msg)) (string, error) {
+	var responseContent string
+	str_prompt := parts.Text()
+	if len(parts.Images) > 0 && !visionProviders[runMode] {
+		return "", noVisionError(runMode)
+	}
+
+	switch runMode {
+	case "gemini":
+		// A fallback to Gemini starts out with gemini-pro as well
+		if len(parts.Images) > 0 && gemini.UseVision() {
+			logging.Infof("gemini-pro can't read images, using %s", gemini.VisionModel)
+		}
+		iter := gemini.Generate(ctx, str_prompt, parts.Images)
+		for {
+			resp, err := iter.Next()
+			if err != nil {
+				if err == iterator.Done {
+					break // End of stream
+				}
+				if ctx.Err() != nil {
+					return responseContent, ctx.Err()
+				}
+
+				// Check if the error is due to safety filter activation
+				var blocked *genai.BlockedError
+				if errors.As(err, &blocked) {
+					return responseContent, &gemini.SafetyError{Blocked: blocked}
+				}
+
+				if classified := gemini.ClassifyError(err); classified != err {
+					return responseContent, classified
+				}
+
+				var gerr *googleapi.Error
+				if errors.As(err, &gerr) {
+					return responseContent, fmt.Errorf("error details: %w", gerr)
+				}
+				return responseContent, err
+			}
+
+			if usage := resp.UsageMetadata; usage != nil {
+				send(tea.UsageMsg{PromptTokens: int(usage.PromptTokenCount), ResponseTokens: int(usage.CandidatesTokenCount), TotalTokens: int(usage.TotalTokenCount)})
+			}
+
+			// Each candidate streams into its own buffer, only the first one is kept in the conversation cache
+			for _, candidate := range resp.Candidates {
+				if candidate.Content == nil {
+					continue
+				}
+				for _, part := range candidate.Content.Parts {
+					send(tea.AppendCandidateMsg{Index: int(candidate.Index), Text: fmt.Sprintf("%v", part)})
+
+					if candidate.Index == 0 {
+						responseContent += fmt.Sprintf("%v", part)
+					}
+				}
+			}
+		}
+	case "local":
+		outputChan, errChan, err := ollama.GenerateContentStream(ctx, str_prompt, parts.Images)
+		if err != nil {
+			return "", err
+		}
+
+		for line := range outputChan {
+			responseContent += line
+			send(tea.AppendResponseMsg(line))
+		}
+		if err := <-errChan; err != nil {
+			return responseContent, err
+		}
+	case "remote":
+		outputChan, errChan, err := remote.GenerateContentStream(ctx, parts)
+		if err != nil {
+			return "", fmt.Errorf("error generating content remotely: %w", err)
+		}
+
+		for line := range outputChan {
+			responseContent += line
+			send(tea.AppendResponseMsg(line))
+		}
+		if err := <-errChan; err != nil {
+			return responseContent, fmt.Errorf("error generating content remotely: %w", err)
+		}
+	case "mock":
+		outputChan, errChan, err := mock.GenerateContentStream(ctx, parts)
+		if err != nil {
+			return "", err
+		}
+
+		for line := range outputChan {
+			responseContent += line
+			send(tea.AppendResponseMsg(line))
+		}
+		if err := <-errChan; err != nil {
+			return responseContent, err
+		}
+	default:
+		return "", errors.New("invalid mode, please use 'gemini', 'local', or 'remote'")
+	}
+
+	return responseContent, ctx.Err()
+}
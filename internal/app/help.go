@@ -0,0 +1,32 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/help"
+)
+
+// `lexido help` prints the help, `lexido help <topic>` one of its longer topics
+func helpCommand(args []string) int {
+	if len(args) == 0 {
+		help.Write(os.Stdout, flag.CommandLine)
+		return 0
+	}
+	topic := help.Lookup(args[0])
+	if topic == nil {
+		fmt.Fprintf(os.Stderr, "There is no help topic %q, the topics are %s.\n", args[0], strings.Join(help.TopicNames(), ", "))
+		return errs.ExitUsage
+	}
+	help.WriteTopic(os.Stdout, topic)
+	return 0
+}
+
+// `lexido man > lexido.1` writes the man page, generated from the same flags and texts as the help
+func manCommand(version string) int {
+	help.Man(os.Stdout, flag.CommandLine, version)
+	return 0
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"os"
+	"time"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/jsonout"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	"github.com/micr0-dev/lexido/pkg/llms/mock"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/retry"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// Returns the name of the model the mode's provider is using
+func modelName(runMode string) string {
+	switch runMode {
+	case "gemini":
+		return gemini.ModelName()
+	case "local":
+		return ollama.Model()
+	case "remote":
+		return remote.ModelName()
+	case "mock":
+		return mock.ModelName()
+	}
+	return ""
+}
+
+// Generates without the TUI for --json and --json-stream, writing the result to stdout.
+// Errors are written to stderr as JSON and are returned as well.
+func (g *generator) runJSON(ctx context.Context, policy retry.Policy, caching cacheSettings, runMode string, user_prompt string, parts prompt.Parts, mode []string, stream bool) (string, error) {
+	start := time.Now()
+	var usage *jsonout.Usage
+	var promptCheck *jsonout.PromptCheck
+	cached := false
+	provider, model := runMode, modelName(runMode)
+	if stream {
+		jsonout.Write(os.Stdout, jsonout.Event{Type: "start", Provider: provider, Model: model, Mode: mode})
+	}
+
+	// Only the first candidate is reported, the same one that is cached
+	send := func(msg tearaw.Msg) {
+		var event jsonout.Event
+		switch msg := msg.(type) {
+		case tea.AppendResponseMsg:
+			event = jsonout.Event{Type: "chunk", Text: string(msg)}
+		case tea.AppendCandidateMsg:
+			if msg.Index != 0 {
+				return
+			}
+			event = jsonout.Event{Type: "chunk", Text: msg.Text}
+		case tea.RetryingMsg:
+			event = jsonout.Event{Type: "retry", Attempt: msg.Attempt, WaitMs: msg.Wait.Milliseconds(), Reason: msg.Reason}
+		case tea.ResetResponseMsg:
+			event = jsonout.Event{Type: "reset"}
+		case tea.FellBackMsg:
+			provider, model = msg.Provider, msg.Model
+			event = jsonout.Event{Type: "fallback", Provider: msg.Provider, Model: msg.Model}
+		case tea.RaceWonMsg:
+			provider, model = msg.Provider, msg.Model
+			event = jsonout.Event{Type: "race", Provider: msg.Provider, Model: msg.Model}
+		case tea.CachedMsg:
+			cached = true
+			return
+		case tea.PromptSizeMsg:
+			promptCheck = &jsonout.PromptCheck{Tokens: msg.Tokens, Estimated: msg.Estimated, ContextWindow: msg.ContextWindow}
+			return
+		case tea.UsageMsg:
+			usage = &jsonout.Usage{PromptTokens: msg.PromptTokens, ResponseTokens: msg.ResponseTokens, TotalTokens: msg.TotalTokens, Estimated: msg.Estimated}
+			if msg.Priced {
+				usage.Cost = &msg.Cost
+			}
+			return
+		default:
+			return
+		}
+		if stream {
+			jsonout.Write(os.Stdout, event)
+		}
+	}
+
+	response, err := g.generateCached(ctx, policy, caching, runMode, parts, send)
+	if err != nil {
+		jsonout.WriteError(os.Stderr, jsonout.Code(err), err)
+		return response, err
+	}
+
+	cmds := g.suggestedCommands(response)
+	if cmds == nil {
+		cmds = []string{}
+	}
+	if usage != nil {
+		usage.PromptCheck = promptCheck
+	}
+	result := &jsonout.Result{
+		Provider:   provider,
+		Model:      model,
+		Mode:       mode,
+		Prompt:     user_prompt,
+		Response:   response,
+		Commands:   cmds,
+		Usage:      usage,
+		Cached:     cached,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+
+	if stream {
+		jsonout.Write(os.Stdout, jsonout.Event{Type: "done", Result: result})
+	} else {
+		jsonout.Write(os.Stdout, result)
+	}
+	return response, nil
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms/openrouter"
+)
+
+// Providers whose models lexido models can list
+var modelProviders = []string{"local", "openrouter"}
+
+// How long listing the models may take
+const modelsTimeout = 30 * time.Second
+
+func modelsCommand(args []string) int {
+	flags := flag.NewFlagSet("models", flag.ContinueOnError)
+	provider := flags.String("provider", "local", "Provider whose models are listed ("+strings.Join(modelProviders, ", ")+")")
+	asJSON := flags.Bool("json", false, "Print the models as JSON")
+	search := flags.String("search", "", "Only list models whose id contains this text")
+	if err := flags.Parse(args); err != nil {
+		return errs.ExitUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Println("Usage: lexido models [--provider local|openrouter] [--search text] [--json]")
+		return errs.ExitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), modelsTimeout)
+	defer cancel()
+
+	switch *provider {
+	case "local", "ollama":
+		names, err := ollama.ListModels(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list the ollama models: %v\n", err)
+			return exitCode(err)
+		}
+		var shown []string
+		for _, name := range names {
+			if strings.Contains(name, *search) {
+				shown = append(shown, name)
+			}
+		}
+		if *asJSON {
+			out, _ := json.MarshalIndent(shown, "", "  ")
+			fmt.Println(string(out))
+			return 0
+		}
+		for _, name := range shown {
+			fmt.Println(name)
+		}
+		return 0
+
+	case "openrouter":
+		models, err := openrouter.Models(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list the OpenRouter models: %v\n", err)
+			return exitCode(err)
+		}
+		shown := []openrouter.Model{}
+		for _, model := range models {
+			if strings.Contains(model.ID, *search) {
+				shown = append(shown, model)
+			}
+		}
+		if *asJSON {
+			out, _ := json.MarshalIndent(shown, "", "  ")
+			fmt.Println(string(out))
+			return 0
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MODEL\tCONTEXT\tPROMPT $/1M\tRESPONSE $/1M")
+		for _, model := range shown {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", model.ID, model.ContextLength, formatPrice(model.Prompt), formatPrice(model.Response))
+		}
+		w.Flush()
+		fmt.Println("\nUse one for a run with lexido -r -m <model> when the remote config has a <MODEL> placeholder, as the openrouter preset does.")
+		return 0
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown provider %q. Use %s.\n", *provider, strings.Join(modelProviders, " or "))
+		return errs.ExitUsage
+	}
+}
+
+// Formats a price per million tokens, OpenRouter marks routers whose price depends on the model picked with a negative one
+func formatPrice(price float64) string {
+	switch {
+	case price < 0:
+		return "varies"
+	case price == 0:
+		return "free"
+	}
+	return fmt.Sprintf("%.2f", price)
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/network"
+)
+
+// How long the connectivity probe before a cloud provider may take, an offline request would wait out the TCP timeout
+const onlineProbeTimeout = time.Second
+
+// Returns the host:port a cloud provider is reached at, or its proxy when it goes through one. Empty for providers
+// that run on this machine or whose address isn't known.
+func cloudAddress(mode string) string {
+	var target string
+	switch mode {
+	case "gemini":
+		auth, _ := config.Get("gemini_auth")
+		location, _ := config.Get("gcp_location")
+		target = "https://" + gemini.Address(auth == "vertex", location)
+	case "remote":
+		cfg, err := remote.LoadConfig()
+		if err != nil {
+			return ""
+		}
+		if cfg.ApiConfig.Proxy != "" {
+			return network.AddressOf(cfg.ApiConfig.Proxy)
+		}
+		target = cfg.URL()
+	default:
+		return ""
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	if proxy, err := http.ProxyFromEnvironment(&http.Request{URL: u}); err == nil && proxy != nil {
+		return network.AddressOf(proxy.String())
+	}
+	return network.AddressOf(target)
+}
+
+// Probes the cloud provider before any request is made. Offline the run fails right away, or continues with the ollama
+// on this machine when it has a model: after asking, or without asking when the offline_local setting is on.
+// Returns the ollama model to switch to, empty to carry on with the provider.
+func checkOnline(runMode string, headless bool, savedModel string) (string, error) {
+	address := cloudAddress(runMode)
+	if address == "" {
+		return "", nil
+	}
+	start := time.Now()
+	err := network.Probe(address, onlineProbeTimeout)
+	// A refused connection still means there is a network, the request reports what is wrong with the host
+	var netErr *network.Error
+	if err == nil || !errors.As(err, &netErr) || netErr.Kind == network.Refused {
+		logging.Debugf("Probed %s in %s", address, time.Since(start).Round(time.Millisecond))
+		return "", nil
+	}
+	logging.Warnf("Probing %s failed: %v", address, err)
+
+	offline := errs.Wrap(errs.ErrNetwork, fmt.Errorf("offline: can't reach %s for %s (%s); use --assume-online if the network is fine", address, providerLabel(runMode), netErr.Kind))
+	model := localModel(savedModel)
+	if model == "" {
+		return "", offline
+	}
+
+	auto, _ := config.Get("offline_local")
+	if yes, _ := strconv.ParseBool(auto); yes {
+		log.Printf("Warning: offline, using the local ollama with %s instead of %s\n", model, providerLabel(runMode))
+		return model, nil
+	}
+	if headless || !io.IsTerminal(os.Stdin) {
+		return "", fmt.Errorf("%w, or lexido config set offline_local true to use ollama with %s", offline, model)
+	}
+	fmt.Printf("offline: use local %s instead? [Y/n] ", model)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer == "" || answer == "y" || answer == "yes" {
+		return model, nil
+	}
+	return "", offline
+}
+
+// Returns the model the local ollama would run, the saved one if it is installed or else the first one it has.
+// Empty when ollama isn't installed, isn't running, or has no models.
+func localModel(savedModel string) string {
+	if !ollama.LocalAvailable() {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), onlineProbeTimeout)
+	defer cancel()
+	models, err := ollama.LocalModels(ctx)
+	if err != nil || len(models) == 0 {
+		return ""
+	}
+	for _, model := range models {
+		if model == savedModel || strings.TrimSuffix(model, ":latest") == savedModel {
+			return savedModel
+		}
+	}
+	return strings.TrimSuffix(models[0], ":latest")
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"flag"
+	"sort"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+)
+
+// Options are the flags of a run, main fills them from the command line
+type Options struct {
+	Version string          // Of the lexido binary, shown by -v
+	Args    []string        // Arguments after the flags: the prompt, or a subcommand with its arguments
+	Set     map[string]bool // Names of the flags given, for flags whose zero value is meaningful
+	Literal bool            // -- came before the prompt, so its first word never names a subcommand
+
+	// The flags, registered in main
+	Help             bool
+	Continue         bool
+	ShowVersion      bool
+	Gemini           bool
+	Local            bool
+	Model            string
+	OllamaHost       string
+	Temperature      float64
+	MaxTokens        int
+	Ctx              int
+	Seed             int
+	Remote           bool
+	SetModel         string
+	SetDefault       string
+	SetRemotePreset  string
+	SetSafety        string
+	SetFallback      string
+	SetGcpProject    string
+	SetGcpLocation   string
+	Lang             string
+	SetLang          string
+	RelaxSafety      bool
+	WithPath         string
+	Images           []string
+	YesRemovals      bool
+	RunIn            string
+	Target           string
+	Tmux             bool
+	Pager            bool
+	Accessible       bool
+	ShowAllWarnings  bool
+	Alternatives     int
+	Race             string
+	Compare          string
+	AssumeOnline     bool
+	Verbose          bool
+	Debug            bool
+	LogFile          string
+	MaxAttempts      int
+	FixLoop          bool
+	Yes              bool
+	MaxIterations    int
+	FixBudget        int
+	ConfirmEach      bool
+	SaveScript       string
+	Output           string
+	OutputCommands   bool
+	Force            bool
+	NoRedact         bool
+	NoCache          bool
+	RefreshSysinfo   bool
+	NoGit            bool
+	NoProjectContext bool
+	Template         string
+	PipeLimit        string
+	NoCapture        bool
+
+	followUpInput *io.PipedInput // Output of the commands of the previous run, asked about instead of reading stdin
+	History       int
+	Timeout       time.Duration
+	JSON          bool
+	JSONStream    bool
+	NoKeyring     bool
+	Color         string
+	Quiet         bool
+	CommandsOnly  bool
+	NoCommands    bool
+	All           bool
+	Paste         bool
+}
+
+// Returns the ith argument after the flags, empty when there are fewer
+func (o Options) arg(i int) string {
+	if i >= len(o.Args) {
+		return ""
+	}
+	return o.Args[i]
+}
+
+// Returns the subcommand or mode the first argument names, empty when -- keeps it in the prompt
+func (o Options) command() string {
+	if o.Literal {
+		return ""
+	}
+	return o.arg(0)
+}
+
+// Returns the flags given on the command line as arguments fs parses back into the same values,
+// a repeated flag once per value
+func (o Options) flagArgs(fs *flag.FlagSet) []string {
+	names := make([]string, 0, len(o.Set))
+	for name := range o.Set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if getter, ok := f.Value.(flag.Getter); ok {
+			if values, ok := getter.Get().([]string); ok {
+				for _, value := range values {
+					args = append(args, "--"+name+"="+value)
+				}
+				continue
+			}
+		}
+		args = append(args, "--"+name+"="+f.Value.String())
+	}
+	return args
+}
+
+// Checks the flags whose values are wrong whatever the run does, before anything is set up for it
+func (o Options) validate() error {
+	// Gemini returns the alternatives as candidates of one request, the other providers are held to the same number
+	if o.Alternatives < 0 || o.Alternatives > gemini.MaxCandidates {
+		return errs.Usagef("--alternatives must be between 1 and %d, Gemini returns at most %d responses to one prompt", gemini.MaxCandidates, gemini.MaxCandidates)
+	}
+	return nil
+}
+
+// Reports whether the flag was given on the command line
+func (o Options) wasSet(name string) bool {
+	return o.Set[name]
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// Lines of a new project context file shown before asking whether to use it
+const projectPreviewLines = 20
+
+// Finds the .lexido file of the project dir is in. A file that is new or changed since it was allowed is shown
+// and only used when the user agrees, so a cloned repository can't slip instructions into the prompt.
+func loadProjectContext(dir string, headless bool, quiet bool) (io.ProjectContext, bool) {
+	project, ok, err := io.FindProjectContext(dir)
+	if err != nil {
+		if !quiet {
+			log.Printf("Warning: Not using the project context: %v\n", err)
+		}
+		return io.ProjectContext{}, false
+	}
+	if !ok {
+		return io.ProjectContext{}, false
+	}
+
+	if !io.IsProjectContextAllowed(project) {
+		if headless || !io.IsTerminal(os.Stdin) {
+			if !quiet {
+				log.Printf("Warning: Not using %s, it is new or changed. Run lexido in a terminal once to allow it.\n", project.Path)
+			}
+			return io.ProjectContext{}, false
+		}
+		if !askProjectContext(project) {
+			return io.ProjectContext{}, false
+		}
+		if err := io.AllowProjectContext(project); err != nil {
+			log.Printf("Warning: Could not remember that %s is allowed: %v\n", project.Path, err)
+		}
+	}
+
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Loaded project context from %s\n", project.Path)
+	}
+	return project, true
+}
+
+// Shows the start of the project context and asks whether it may go into prompts
+func askProjectContext(project io.ProjectContext) bool {
+	fmt.Printf("Found project context in %s, which lexido adds to every prompt in this directory:\n\n", project.Path)
+	lines := strings.Split(strings.TrimRight(project.Content, "\n"), "\n")
+	for i, line := range lines {
+		if i == projectPreviewLines {
+			fmt.Printf("  ... %d more lines\n", len(lines)-i)
+			break
+		}
+		fmt.Println("  " + line)
+	}
+	fmt.Print("\nUse it, now and until it changes? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
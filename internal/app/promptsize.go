@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// How long counting the tokens with Gemini may take before the estimate is used instead
+const countTokensTimeout = 10 * time.Second
+
+// Counts the tokens of the prompt and fails when they don't fit the context window, instead of finding out from
+// the API. Gemini counts them itself once the estimate comes near the window, the others go by the estimate.
+func checkPromptSize(ctx context.Context, runMode string, parts prompt.Parts) (tea.PromptSizeMsg, error) {
+	size := tea.PromptSizeMsg{
+		Tokens:        prompt.EstimateTokens(parts.Text()) + len(parts.Images)*prompt.ImageTokens,
+		ContextWindow: contextWindowFor(runMode),
+		Estimated:     true,
+	}
+	if runMode == "gemini" && size.Tokens > size.ContextWindow/2 {
+		countCtx, cancel := context.WithTimeout(ctx, countTokensTimeout)
+		tokens, err := gemini.CountTokens(countCtx, parts.Text(), parts.Images)
+		cancel()
+		if err != nil {
+			logging.Warnf("Could not count the tokens of the prompt, going by the estimate: %v", err)
+		} else {
+			size.Tokens, size.Estimated = tokens, false
+		}
+	}
+	model := modelName(runMode)
+	if model == "" {
+		model = providerLabel(runMode)
+	}
+	logging.Infof("Prompt is %s tokens, the context window of %s is %s", tokenCount(size.Tokens, size.Estimated), model, tokenCount(size.ContextWindow, false))
+
+	if size.Tokens > size.ContextWindow {
+		return size, errs.Usagef("prompt is %s tokens, model limit is %s; use --pipe-limit or a larger model", tokenCount(size.Tokens, size.Estimated), tokenCount(size.ContextWindow, false))
+	}
+	return size, nil
+}
+
+// Formats a number of tokens like 210k, with a ~ when it was estimated
+func tokenCount(tokens int, estimated bool) string {
+	s := fmt.Sprint(tokens)
+	if tokens >= 10000 {
+		s = fmt.Sprintf("%dk", tokens/1000)
+	}
+	if estimated {
+		s = "~" + s
+	}
+	return s
+}
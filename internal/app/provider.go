@@ -0,0 +1,210 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	"github.com/micr0-dev/lexido/pkg/llms/mock"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/network"
+)
+
+// Sets up the provider of runMode from the flags, the settings and the keyring, asking for a missing API key on a
+// terminal. The error wraps the kind of failure, jsonout.Code tells it.
+func (a *App) setupProvider(runMode string, opts Options, headless bool, hasImages bool) error {
+	switch runMode {
+	case "gemini":
+		return a.setupGemini(opts, headless, hasImages)
+	case "local":
+		return a.setupOllama(opts, headless)
+	case "mock":
+		return errs.Wrap(errs.ErrUsage, mock.Load())
+	case "remote":
+		return setupRemote(opts, headless)
+	}
+	return nil
+}
+
+func (a *App) setupGemini(opts Options, headless bool, hasImages bool) error {
+	// Safety thresholds are set before the model is, Setup applies them
+	if setting, err := config.Get("gemini_safety"); err == nil {
+		if err := gemini.SetSafety(setting); err != nil {
+			return errs.Usagef("Invalid gemini_safety setting: %w", err)
+		}
+	}
+	if opts.RelaxSafety {
+		gemini.RelaxSafety()
+	}
+
+	// Access your API key from keyring or environment variable (backwards compatible with previous versions)
+	auth, _ := config.Get("gemini_auth")
+	useVertex := auth == "vertex"
+	apiKey := ""
+	if !useVertex {
+		apiKey = os.Getenv("GOOGLE_AI_KEY")
+	}
+
+	if apiKey == "" && !useVertex {
+		apiKey, _ = a.Keyring.Read("GOOGLE_AI_KEY")
+	}
+
+	// Without an API key, Application Default Credentials can reach Gemini through Vertex AI instead
+	if apiKey == "" && !headless && !useVertex && io.IsTerminal(os.Stdin) && gemini.ADCAvailable() {
+		var err error
+		if useVertex, err = offerVertex(); err != nil {
+			return err
+		}
+	}
+
+	if apiKey == "" && headless && !useVertex {
+		return errs.Wrap(errs.ErrAuth, errors.New("no Gemini API key found, set GOOGLE_AI_KEY or run lexido once interactively"))
+	}
+
+	// If no API key is found, prompt the user to enter it
+	if apiKey == "" && !useVertex {
+		fmt.Println("No API key found.")
+		fmt.Println("Please visit https://aistudio.google.com/app/apikey to obtain your API key.")
+		fmt.Print("Enter your API key here: ")
+
+		scanner := bufio.NewScanner(os.Stdin)
+		if scanner.Scan() {
+			apiKey = scanner.Text()
+
+			// Check if the API key is valid
+			isValid, err := gemini.IsKeyValid(apiKey)
+			if !isValid {
+				return errs.Wrap(errs.ErrAuth, errors.New("Invalid API key. Please try again."))
+			} else if err != nil {
+				return fmt.Errorf("Error validating API key: %w", err)
+			}
+
+			os.Setenv("GOOGLE_AI_KEY", apiKey)
+			if err := a.Keyring.Save("GOOGLE_AI_KEY", apiKey); err != nil {
+				fmt.Println("Failed to automatically append the API key to keyring. Please add the following line to your .bashrc, .zshrc, or equivalent file manually (replace the {API_KEY_HERE} with your API key):")
+				fmt.Println("export GOOGLE_AI_KEY={API_KEY_HERE}")
+			} else {
+				fmt.Print("API key set successfully for future sessions. \n\n")
+			}
+		} else if scanner.Err() != nil {
+			return fmt.Errorf("Error reading API key: %w", scanner.Err())
+		}
+	}
+
+	if useVertex {
+		project, _ := config.Get("gcp_project")
+		location, _ := config.Get("gcp_location")
+		if err := gemini.SetupVertex(project, location); err != nil {
+			return errs.Wrap(errs.ErrAuth, fmt.Errorf("Error setting up gemini through Vertex AI: %w", err))
+		}
+	} else {
+		logging.AddSecret(apiKey)
+		if err := gemini.Setup(apiKey); err != nil {
+			return errs.Wrap(errs.ErrAuth, fmt.Errorf("Error setting up gemini: %w", err))
+		}
+	}
+
+	if hasImages && gemini.UseVision() {
+		logging.Infof("gemini-pro can't read images, using %s", gemini.VisionModel)
+	}
+	if opts.Alternatives > 1 {
+		gemini.SetCandidateCount(opts.Alternatives)
+	}
+	return nil
+}
+
+func (a *App) setupOllama(opts Options, headless bool) error {
+	model := opts.Model
+	if opts.Model == "" {
+		var err error
+		model, err = io.GetOrInitIn(a.Keyring, "OLLAMA_MODEL", "llama3")
+		if err != nil {
+			return fmt.Errorf("Error reading model: %w", err)
+		}
+	}
+
+	if opts.OllamaHost != "" {
+		ollama.SetHost(opts.OllamaHost)
+	}
+
+	// The ollama_options setting first, the flags override single options of it
+	if setting, err := config.Get("ollama_options"); err == nil {
+		options, err := ollama.ParseOptions(setting)
+		if err == nil {
+			err = ollama.SetOptions(options)
+		}
+		if err != nil {
+			return errs.Usagef("Invalid ollama_options setting: %w", err)
+		}
+	}
+	flagOptions := map[string]any{}
+	if opts.wasSet("ctx") {
+		flagOptions["num_ctx"] = float64(opts.Ctx)
+	}
+	if opts.wasSet("seed") {
+		flagOptions["seed"] = float64(opts.Seed)
+	}
+	if err := ollama.SetOptions(flagOptions); err != nil {
+		return errs.Wrap(errs.ErrUsage, err)
+	}
+
+	err := ollama.Init(model)
+
+	// Offer to switch to the ollama on this machine when the configured host can't be reached
+	var netErr *network.Error
+	if errors.As(err, &netErr) && !headless && ollama.LocalAvailable() {
+		fmt.Printf("%v\nA local ollama is installed; use -m with --ollama-host local to switch.\n", err)
+		if io.IsTerminal(os.Stdin) {
+			if commands.AskYesNo("Use the local ollama for this prompt instead? [Y/n] ", true) {
+				ollama.SetHost("local")
+				err = ollama.Init(model)
+			}
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("Error initializing ollama: %w", err)
+		if netErr == nil {
+			err = errs.Wrap(errs.ErrUsage, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func setupRemote(opts Options, headless bool) error {
+	if opts.Model != "" {
+		remote.SetModel(opts.Model)
+	}
+	cfg, err := remote.LoadConfig()
+	if err != nil {
+		// Sending the prompt reports the missing or broken config
+		return nil
+	}
+	if err := remoteSamplingError(cfg, opts); err != nil {
+		return err
+	}
+
+	// Turning off certificate checks is easy to forget about, so it is pointed out every run
+	if cfg.ApiConfig.InsecureSkipVerify {
+		fmt.Fprintln(os.Stderr, remote.InsecureWarning)
+	}
+
+	// Keys the config refers to are asked for on first use, like the Gemini key
+	for _, name := range cfg.MissingKeys() {
+		if headless {
+			return errs.Wrap(errs.ErrAuth, &remote.MissingKeyError{Name: name})
+		}
+		if !askRemoteKey(name) {
+			return errs.Wrap(errs.ErrAuth, fmt.Errorf("no API key for %s", name))
+		}
+	}
+	return nil
+}
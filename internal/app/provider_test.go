@@ -0,0 +1,80 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// Invalid ollama options fail as usage errors before ollama is asked anything
+func TestInvalidOllamaOptions(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "not expected", http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		setting string
+		opts    Options
+		want    string
+	}{
+		{"zero --ctx", "", Options{Ctx: 0, Set: map[string]bool{"ctx": true}}, "num_ctx must be between"},
+		{"seed out of range", "", Options{Seed: 1 << 40, Set: map[string]bool{"seed": true}}, "seed must be between"},
+		{"broken setting", `{"temperature": 0.2`, Options{}, "Invalid ollama_options setting"},
+		{"setting out of range", `{"top_p": 2}`, Options{}, "top_p must be between 0 and 1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isolate(t)
+			t.Setenv("OLLAMA_HOST", server.URL)
+			// Saved around config set, which checks the value, like a credentials file edited by hand
+			if test.setting != "" {
+				key, _ := config.Lookup("ollama_options")
+				if err := io.SaveToKeyring(key.Field, test.setting); err != nil {
+					t.Fatal(err)
+				}
+			}
+			opts := test.opts
+			opts.Args = []string{"list", "files"}
+			opts.Local = true
+			opts.Quiet = true
+
+			r := runAppWith(t, &App{Keyring: memStore{}, System: testFacts}, opts, "")
+			if r.code != errs.ExitUsage {
+				t.Errorf("exit code %d, want %d", r.code, errs.ExitUsage)
+			}
+			if !strings.Contains(r.stderr, test.want) {
+				t.Errorf("stderr = %q, want %q", r.stderr, test.want)
+			}
+			if n := requests.Load(); n != 0 {
+				t.Errorf("ollama got %d requests, want none", n)
+			}
+		})
+	}
+}
+
+// The settings only the TUI and the providers understand are checked by them once they registered with config
+func TestRegisteredValidators(t *testing.T) {
+	isolate(t)
+	for name, value := range map[string]string{
+		"keys":           "launch=x",
+		"gemini_safety":  "harassment=block_all",
+		"ollama_options": `{"top_p": 2}`,
+	} {
+		if err := config.Set(name, value); errs.ExitCode(err) != errs.ExitUsage {
+			t.Errorf("config.Set(%q, %q) = %v, want a usage error", name, value, err)
+		}
+	}
+	if key, _ := config.Lookup("keys"); !strings.Contains(key.Description, "actions: ") || !strings.Contains(key.Description, "regenerate") {
+		t.Errorf("description of keys = %q, want the actions listed", key.Description)
+	}
+}
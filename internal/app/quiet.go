@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/retry"
+)
+
+// Returned by --commands-only when the response has nothing to run
+var errNoCommand = errors.New("the response contains no command to run")
+
+// Generates without the TUI for -q and --commands-only. Nothing is printed until the response is complete,
+// so a fallback that starts over never leaves half a response on stdout. A response cut off by the timeout is kept.
+func (g *generator) runQuiet(ctx context.Context, policy retry.Policy, caching cacheSettings, runMode string, parts prompt.Parts) (string, error) {
+	response, err := g.generateCached(ctx, policy, caching, runMode, parts, func(tearaw.Msg) {})
+	var timeoutErr *retry.TimeoutError
+	if errors.As(err, &timeoutErr) && response != "" {
+		log.Printf("Warning: %v, the response is incomplete\n", err)
+		err = nil
+	}
+	return response, err
+}
+
+// Prints the response as is, or with commandsOnly its first command or with all every command, one per line
+func printQuiet(response string, commandsOnly bool, all bool) error {
+	if !commandsOnly {
+		fmt.Print(response)
+		if !strings.HasSuffix(response, "\n") {
+			fmt.Println()
+		}
+		return nil
+	}
+
+	cmds := commands.ParseCommands(response)
+	if len(cmds) == 0 {
+		return errNoCommand
+	}
+	if !all {
+		cmds = cmds[:1]
+	}
+	for _, cmd := range cmds {
+		fmt.Println(cmd)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/retry"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// Providers a run sends every prompt to at once, set from --race or --compare
+type raceOptions struct {
+	modes   []string
+	compare bool // Keep every answer instead of the first one
+}
+
+func (r raceOptions) active() bool {
+	return len(r.modes) > 1
+}
+
+// Parses the providers of --race or --compare, which need at least two different ones
+func parseRace(flag string, list string) ([]string, error) {
+	modes, err := parseProviders(list)
+	if err != nil {
+		return nil, errs.Usagef("--%s: %v", flag, err)
+	}
+	seen := map[string]bool{}
+	for _, mode := range modes {
+		if seen[mode] {
+			return nil, errs.Usagef("--%s: %s is named twice", flag, providerLabel(mode))
+		}
+		seen[mode] = true
+	}
+	if len(modes) < 2 {
+		return nil, errs.Usagef("--%s needs two or more providers, e.g. gemini,ollama", flag)
+	}
+	return modes, nil
+}
+
+// Reports whether a message carries text of the response
+func isText(msg tearaw.Msg) bool {
+	switch msg := msg.(type) {
+	case tea.AppendResponseMsg:
+		return msg != ""
+	case tea.AppendCandidateMsg:
+		return msg.Text != ""
+	}
+	return false
+}
+
+// Returns the provider and model for the TUI, like "ollama (llama3)"
+func providerWithModel(mode string) string {
+	if model := modelName(mode); model != "" && model != providerLabel(mode) {
+		return fmt.Sprintf("%s (%s)", providerLabel(mode), model)
+	}
+	return providerLabel(mode)
+}
+
+// Sends the prompt to every provider at once and streams the one that produces text first. The others are cancelled
+// right then so they stop using quota, what they sent before is dropped. Usage is recorded for each provider on its own.
+func (g *generator) generateRace(ctx context.Context, policy retry.Policy, modes []string, parts prompt.Parts, send func(tearaw.Msg)) (string, error) {
+	var mu sync.Mutex
+	winner := ""
+	pending := map[string][]tearaw.Msg{}
+	running := map[string]bool{}
+	interrupted := map[string]bool{}
+	cancels := map[string]context.CancelFunc{}
+	contexts := map[string]context.Context{}
+	for _, mode := range modes {
+		contexts[mode], cancels[mode] = context.WithCancel(ctx)
+		running[mode] = true
+	}
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	type result struct {
+		mode     string
+		response string
+		err      error
+	}
+	results := make(chan result, len(modes))
+	for _, mode := range modes {
+		go func(mode string) {
+			response, err := g.generateAttempts(contexts[mode], policy, mode, parts, func(msg tearaw.Msg) {
+				mu.Lock()
+				defer mu.Unlock()
+				if winner == "" && isText(msg) {
+					winner = mode
+					var cancelled []string
+					for _, other := range modes {
+						if other != mode && running[other] {
+							cancels[other]()
+							interrupted[other] = true
+							cancelled = append(cancelled, providerLabel(other))
+						}
+					}
+					logging.Infof("%s answered first, cancelled: %s", providerLabel(mode), strings.Join(cancelled, ", "))
+					send(tea.RaceWonMsg{Provider: mode, Model: modelName(mode), Cancelled: cancelled})
+					for _, earlier := range pending[mode] {
+						send(earlier)
+					}
+				}
+				switch winner {
+				case mode:
+					send(msg)
+				case "":
+					pending[mode] = append(pending[mode], msg)
+				}
+			})
+			mu.Lock()
+			running[mode] = false
+			mu.Unlock()
+			results <- result{mode: mode, response: response, err: err}
+		}(mode)
+	}
+
+	byMode := map[string]result{}
+	for range modes {
+		r := <-results
+		byMode[r.mode] = r
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, mode := range modes {
+		// A provider cancelled before it sent any text has been charged for the prompt all the same
+		if interrupted[mode] && byMode[mode].response == "" {
+			recordUsage(mode, parts.Text(), "", nil)
+		}
+	}
+	if winner != "" {
+		return byMode[winner].response, byMode[winner].err
+	}
+	// Nobody produced text, the error of the first provider is as good as any
+	return byMode[modes[0]].response, byMode[modes[0]].err
+}
+
+// Sends the prompt to every provider at once and streams each answer into a candidate of its own, so they can be
+// compared and the commands picked from either. A provider that fails is reported, the others are still shown.
+func (g *generator) generateCompare(ctx context.Context, policy retry.Policy, modes []string, parts prompt.Parts, send func(tearaw.Msg)) (string, error) {
+	labels := make([]string, len(modes))
+	for i, mode := range modes {
+		labels[i] = providerWithModel(mode)
+	}
+	send(tea.CandidateLabelsMsg(labels))
+
+	responses := make([]string, len(modes))
+	failures := make([]error, len(modes))
+	var wg sync.WaitGroup
+	for i, mode := range modes {
+		wg.Add(1)
+		go func(i int, mode string) {
+			defer wg.Done()
+			responses[i], failures[i] = g.generateAttempts(ctx, policy, mode, parts, func(msg tearaw.Msg) {
+				switch msg := msg.(type) {
+				case tea.AppendResponseMsg:
+					send(tea.AppendCandidateMsg{Index: i, Text: string(msg)})
+				case tea.AppendCandidateMsg:
+					// Only the first of Gemini's --alternatives is compared
+					if msg.Index == 0 {
+						send(tea.AppendCandidateMsg{Index: i, Text: msg.Text})
+					}
+				case tea.ResetResponseMsg:
+					send(tea.ResetCandidateMsg{Index: i})
+				default:
+					send(msg)
+				}
+			})
+		}(i, mode)
+	}
+	wg.Wait()
+
+	// The first answer that arrived in full goes into the conversation cache
+	var failed []string
+	response := ""
+	for i, mode := range modes {
+		if failures[i] != nil {
+			failed = append(failed, fmt.Sprintf("%s failed: %v", providerLabel(mode), failures[i]))
+			continue
+		}
+		if response == "" {
+			response = responses[i]
+		}
+	}
+	if len(failed) == len(modes) {
+		return "", failures[0]
+	}
+	if len(failed) > 0 {
+		send(tea.StatusMsg(strings.Join(failed, "; ")))
+	}
+	return response, nil
+}
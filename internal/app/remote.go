@@ -0,0 +1,260 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+	"github.com/micr0-dev/lexido/pkg/logging"
+)
+
+// How long the test request of a preset may take
+const presetTestTimeout = 30 * time.Second
+
+const remoteUsage = "Usage: lexido remote init <preset> | test [config file or preset]"
+
+func remoteCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(remoteUsage)
+		return errs.ExitUsage
+	}
+	switch args[0] {
+	case "init":
+		if len(args) > 2 {
+			fmt.Println("Usage: lexido remote init <preset>")
+			return errs.ExitUsage
+		}
+		if len(args) == 2 {
+			return setRemotePreset(args[1])
+		}
+		presets, err := remote.Presets()
+		if err != nil {
+			log.Println(err)
+			return errs.ExitFailure
+		}
+		fmt.Println("Usage: lexido remote init <preset>")
+		fmt.Println()
+		for _, preset := range presets {
+			fmt.Printf("  %-12s %s\n", preset.Name, preset.Description)
+		}
+		return errs.ExitUsage
+	case "test":
+		if len(args) > 2 {
+			fmt.Println("Usage: lexido remote test [config file or preset]")
+			return errs.ExitUsage
+		}
+		return remoteTest(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown remote command %q. Use init or test.\n", args[0])
+		return errs.ExitUsage
+	}
+}
+
+// Most of the raw response printed by lexido remote test
+const maxRawShown = 4096
+
+// Checks a remote config and sends it a tiny request, showing the raw response next to what was extracted.
+// Without an argument remoteConfig.json is tested, otherwise the given file or built-in preset.
+func remoteTest(args []string) int {
+	var cfg remote.Config
+	var err error
+	var source string
+	switch {
+	case len(args) == 0:
+		source, err = io.GetFilePath(io.Config, "remoteConfig.json")
+		if err == nil {
+			if _, statErr := os.Stat(source); statErr != nil {
+				fmt.Printf("There is no remote config at %s yet, create one with lexido remote init.\n", source)
+				return errs.ExitFailure
+			}
+			cfg, err = remote.LoadConfigFile(source)
+		}
+	default:
+		source = args[0]
+		if _, statErr := os.Stat(source); statErr == nil {
+			cfg, err = remote.LoadConfigFile(source)
+		} else {
+			var preset remote.Preset
+			preset, err = remote.LookupPreset(source)
+			if err == nil {
+				source = "the " + preset.Name + " preset"
+				cfg, err = preset.RemoteConfig(nil, true)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		return errs.ExitFailure
+	}
+
+	fmt.Printf("Testing %s\n", source)
+	if cfg.ApiConfig.InsecureSkipVerify {
+		fmt.Fprintln(os.Stderr, remote.InsecureWarning)
+	}
+	if err := cfg.Validate(); err != nil {
+		var configErr *remote.ConfigError
+		if errors.As(err, &configErr) {
+			fmt.Println("The config has problems:")
+			for _, problem := range configErr.Problems {
+				fmt.Printf("  - %s\n", problem)
+			}
+			return errs.ExitFailure
+		}
+		fmt.Println(err)
+		return errs.ExitFailure
+	}
+
+	fmt.Printf("Sending %q to %s\n", remote.TestPrompt.User, cfg.URL())
+	ctx, cancel := context.WithTimeout(context.Background(), presetTestTimeout)
+	defer cancel()
+	result, err := cfg.Probe(ctx, remote.TestPrompt)
+
+	if result.Status != "" {
+		fmt.Printf("Status: %s\n", result.Status)
+		raw := strings.TrimSpace(string(result.Raw))
+		if len(raw) > maxRawShown {
+			raw = raw[:maxRawShown] + fmt.Sprintf("\n... (%d more bytes)", len(raw)-maxRawShown)
+		}
+		fmt.Printf("Raw response:\n%s\n", raw)
+		fmt.Printf("Extracted with %q: %q\n", cfg.ApiConfig.FieldOutput, result.Extracted)
+	}
+	if err != nil {
+		fmt.Printf("Failed: %v\n", err)
+		return exitCode(err)
+	}
+	fmt.Println("The remote config works.")
+	return 0
+}
+
+// Asks for an API key the remote config refers to and stores it in the keyring, reporting whether one was entered
+func askRemoteKey(name string) bool {
+	fmt.Printf("No API key found for %s.\n", name)
+	if preset, ok := remote.PresetForKey(name); ok {
+		fmt.Printf("Please visit %s to obtain your API key.\n", preset.KeyURL)
+	}
+	fmt.Print("Enter your API key here: ")
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	apiKey := strings.TrimSpace(answer)
+	if apiKey == "" {
+		if err != nil {
+			log.Printf("Error reading API key: %v\n", err)
+		}
+		return false
+	}
+	logging.AddSecret(apiKey)
+
+	os.Setenv(name, apiKey)
+	if err := io.SaveToKeyring(name, apiKey); err != nil {
+		fmt.Printf("Failed to save the API key to the keyring, export it in your .bashrc, .zshrc, or equivalent file instead: export %s={API_KEY_HERE}\n", name)
+	} else {
+		fmt.Print("API key set successfully for future sessions. \n\n")
+	}
+	return true
+}
+
+// Names of the built-in presets, for completion
+func presetNames() []string {
+	presets, _ := remote.Presets()
+	names := make([]string, len(presets))
+	for i, preset := range presets {
+		names[i] = preset.Name
+	}
+	return names
+}
+
+// Writes the remote config of a built-in preset once a test request went through with its API key,
+// then stores the key in the keyring and makes remote the default mode
+func setRemotePreset(name string) int {
+	preset, err := remote.LookupPreset(name)
+	if err != nil {
+		log.Println(err)
+		return errs.ExitUsage
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+
+	// A key in the environment or the keyring is reused, otherwise the user is asked for one
+	apiKey := os.Getenv(preset.KeyName)
+	if apiKey == "" {
+		apiKey, _ = io.ReadFromKeyring(preset.KeyName)
+	}
+	if apiKey == "" {
+		fmt.Printf("Please visit %s to obtain your %s.\n", preset.KeyURL, preset.KeyName)
+		fmt.Print("Enter your API key here: ")
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			log.Printf("Error reading API key: %v\n", err)
+			return errs.ExitFailure
+		}
+		apiKey = strings.TrimSpace(answer)
+		if apiKey == "" {
+			fmt.Println("No API key entered.")
+			return errs.ExitFailure
+		}
+	}
+	logging.AddSecret(apiKey)
+
+	// Parts of the url such as the Azure deployment, asked for with the default taken on an empty answer
+	var variables map[string]string
+	if len(preset.Variables) > 0 {
+		variables = map[string]string{}
+		for _, variable := range preset.Variables {
+			if variable.Default != "" {
+				fmt.Printf("%s [%s]: ", variable.Description, variable.Default)
+			} else {
+				fmt.Printf("%s: ", variable.Description)
+			}
+			answer, _ := reader.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+			if answer == "" {
+				answer = variable.Default
+			}
+			if answer == "" {
+				fmt.Printf("No %s entered.\n", variable.Name)
+				return errs.ExitFailure
+			}
+			variables[variable.Name] = answer
+		}
+	}
+
+	// The test request reads the key from the environment like every later request does
+	os.Setenv(preset.KeyName, apiKey)
+	fmt.Printf("Checking the key with a test request to %s...\n", preset.Name)
+	ctx, cancel := context.WithTimeout(context.Background(), presetTestTimeout)
+	defer cancel()
+	if _, err := remote.TestPreset(ctx, preset, variables); err != nil {
+		fmt.Printf("The test request failed, nothing was changed: %v\n", err)
+		return exitCode(err)
+	}
+
+	if err := io.SaveToKeyring(preset.KeyName, apiKey); err != nil {
+		log.Printf("Error saving %s: %v\n", preset.KeyName, err)
+		fmt.Printf("Export it instead: export %s={API_KEY_HERE}\n", preset.KeyName)
+	}
+
+	path, backup, err := remote.WritePreset(preset, variables)
+	if err != nil {
+		log.Printf("Error writing the remote config: %v\n", err)
+		return errs.ExitFailure
+	}
+	if err := io.SaveToKeyring("MODE_DEFAULT", "remote"); err != nil {
+		log.Printf("Error saving default mode: %v\n", err)
+		return errs.ExitFailure
+	}
+
+	fmt.Printf("Wrote the %s preset to %s.\n", preset.Name, path)
+	if backup != "" {
+		fmt.Printf("The previous remote config was saved to %s.\n", backup)
+	}
+	fmt.Println("Default mode set to remote, try it with: lexido \"list the largest files here\"")
+	return 0
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/cache"
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/format"
+	"github.com/micr0-dev/lexido/pkg/io"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/retry"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// Settings of the response cache, it is off unless the cache setting is true
+type cacheSettings struct {
+	enabled bool
+	ttl     time.Duration
+	maxSize int64
+}
+
+// Reads the cache, cache_ttl and cache_max_size settings, bypass turns the cache off for this run
+func responseCache(bypass bool) cacheSettings {
+	settings := cacheSettings{ttl: cache.DefaultTTL, maxSize: cache.DefaultMaxSize}
+	if bypass {
+		return settings
+	}
+	if setting, err := config.Get("cache"); err == nil {
+		settings.enabled, _ = strconv.ParseBool(setting)
+	}
+	if setting, err := config.Get("cache_ttl"); err == nil {
+		if d, err := time.ParseDuration(setting); err == nil && d > 0 {
+			settings.ttl = d
+		}
+	}
+	if setting, err := config.Get("cache_max_size"); err == nil {
+		if mb, err := strconv.Atoi(setting); err == nil && mb > 0 {
+			settings.maxSize = int64(mb) << 20
+		}
+	}
+	return settings
+}
+
+// Answers from the response cache when the same prompt was sent to the same model recently,
+// otherwise generates and caches the complete response
+func (g *generator) generateCached(ctx context.Context, policy retry.Policy, settings cacheSettings, runMode string, parts prompt.Parts, send func(tearaw.Msg)) (string, error) {
+	size, err := checkPromptSize(ctx, runMode, parts)
+	if err != nil {
+		return "", err
+	}
+	send(size)
+	// Every provider of a race has to fit the prompt, the first is the one reported
+	for _, mode := range g.racing.modes {
+		if mode == runMode {
+			continue
+		}
+		if _, err := checkPromptSize(ctx, mode, parts); err != nil {
+			return "", fmt.Errorf("%s: %w", providerLabel(mode), err)
+		}
+	}
+
+	// Which provider answers a race isn't known up front, so it is never cached
+	if !settings.enabled || g.racing.active() {
+		return g.generateWithRetry(ctx, policy, runMode, parts, send)
+	}
+
+	model := modelName(runMode)
+	key := cache.Key(runMode, model, providerSettings(runMode), parts.Text()+imageDigest(parts.Images))
+	if entry, ok := cache.Get(key, settings.ttl); ok {
+		logging.Infof("Using the response cached at %s", entry.Created.Format(time.RFC3339))
+		send(tea.CachedMsg{Created: entry.Created})
+		// Entries cached before newlines were normalized may still hold CRLF
+		response := format.NormalizeNewlines(entry.Response)
+		send(tea.AppendResponseMsg(response))
+		return response, nil
+	}
+
+	// A response of a fallback provider isn't cached under the key of runMode
+	fellBack := false
+	response, err := g.generateWithRetry(ctx, policy, runMode, parts, func(msg tearaw.Msg) {
+		if _, ok := msg.(tea.FellBackMsg); ok {
+			fellBack = true
+		}
+		send(msg)
+	})
+	if err == nil && response != "" && !fellBack {
+		entry := cache.Entry{Provider: runMode, Model: model, Created: time.Now(), Response: response}
+		if err := cache.Put(key, entry, settings.maxSize); err != nil {
+			logging.Warnf("Error caching the response: %v", err)
+		}
+	}
+	return response, err
+}
+
+// Describes the settings of the provider that change its responses besides the model, the same prompt sent with
+// another temperature, ollama options or to another host or url isn't answered from the cache
+func providerSettings(runMode string) string {
+	switch runMode {
+	case "gemini":
+		return gemini.Settings()
+	case "local":
+		return ollama.Settings()
+	case "remote":
+		cfg, err := remote.LoadConfig()
+		if err != nil {
+			return ""
+		}
+		return cfg.Settings()
+	}
+	return ""
+}
+
+// Tells prompts apart that only differ in their images
+func imageDigest(images []io.Image) string {
+	var digest strings.Builder
+	for _, img := range images {
+		sum := sha256.Sum256(img.Data)
+		digest.WriteString("\x00" + hex.EncodeToString(sum[:]))
+	}
+	return digest.String()
+}
@@ -0,0 +1,1590 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/audit"
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/favorites"
+	"github.com/micr0-dev/lexido/pkg/format"
+	"github.com/micr0-dev/lexido/pkg/help"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/jsonout"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	"github.com/micr0-dev/lexido/pkg/llms/mock"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/nag"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/redact"
+	"github.com/micr0-dev/lexido/pkg/retry"
+	"github.com/micr0-dev/lexido/pkg/shellinit"
+	"github.com/micr0-dev/lexido/pkg/shutdown"
+	"github.com/micr0-dev/lexido/pkg/ssh"
+	"github.com/micr0-dev/lexido/pkg/stats"
+	"github.com/micr0-dev/lexido/pkg/tea"
+	"github.com/micr0-dev/lexido/pkg/templates"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+)
+
+// Runs lexido with the options parsed from the command line and returns the exit code.
+// Subcommands are dispatched from here too, opts.Args holds them.
+func (a *App) Run(ctx context.Context, opts Options) int {
+	// Warnings always go to the log file, --verbose and --debug add detail and mirror it to stderr
+	logLevel := logging.LevelWarn
+	if opts.Debug {
+		logLevel = logging.LevelDebug
+	} else if opts.Verbose {
+		logLevel = logging.LevelInfo
+	}
+	logFile := opts.LogFile
+	if logFile == "" {
+		logFile, _ = io.GetFilePath(io.State, "lexido.log")
+	}
+	logging.Setup(logging.Options{Level: logLevel, File: logFile, Stderr: opts.Verbose || opts.Debug})
+	defer logging.Close()
+
+	// Each step either hands over to the next or ends the run with its exit code
+	s := a.newSession(opts)
+	for _, step := range []func() (int, bool){s.setup, s.input, s.provider} {
+		if code, done := step(); done {
+			return code
+		}
+	}
+	code, followUp := s.generate(ctx)
+
+	// A question about the output starts over with it attached like piped input, continuing the conversation
+	if followUp != nil {
+		return a.Run(ctx, *followUp)
+	}
+	return code
+}
+
+// One run of lexido: its options and what the steps of Run work out from them. What a run needs to remember lives
+// here or in the generator, the settings of other packages are set anew by reset, so a second run of the same App,
+// like the one for a question about the output, starts out like the first.
+type session struct {
+	app  *App
+	opts Options
+	g    *generator
+
+	jsonMode  bool // Tooling gets JSON on stdout and JSON errors on stderr instead of the TUI
+	quiet     bool // -q, --commands-only and cnf print the response or its commands without the TUI
+	headless  bool // Neither JSON nor -q may ask questions, whatever they would have asked for fails instead
+	cnfName   string
+	commit    commitOptions
+	alias     aliasOptions
+	edit      editOptions
+	batch     batchOptions
+	chatMode  bool
+	summarize bool
+	ownPrompt bool // Commit messages, aliases and diffs have a pre-prompt of their own
+
+	fixLast     bool // lexido fix, lastCommand failed with lastStatus
+	lastCommand string
+	lastStatus  int
+
+	runMode string
+	ledger  *nag.Ledger
+	args    []string // The words of the prompt, after the subcommand took its own
+
+	pipeLimit          int
+	piped              io.PipedInput
+	pipedInput         string
+	images             []io.Image
+	cachedTurns        []io.Turn
+	cachedConversation string
+	words              []string
+	fileRefs           []string
+	attached           string
+	userPrompt         string
+	instruction        string
+
+	auditPrompt string
+	runDir      string
+	sources     promptSources
+	ran         []string // The commands as they ran, for the conversation cache
+}
+
+// Starts a run of the App with the options
+func (a *App) newSession(opts Options) *session {
+	s := &session{app: a, opts: opts, args: opts.Args}
+
+	// Everything that asks a provider gets the generator of this run, App.Provider stands in for the real ones
+	s.g = &generator{provider: generate, ready: map[string]bool{}}
+	if a.Provider != nil {
+		s.g.provider = a.Provider
+	}
+	return s
+}
+
+// Sets what other packages keep between runs from the options and the settings, whether this run changes it or not
+func (s *session) reset() {
+	opts := s.opts
+	nag.ShowAll = opts.ShowAllWarnings
+
+	// Each selected command is confirmed on its own with --confirm-each or the confirm_each setting
+	commands.ConfirmEach = opts.ConfirmEach
+	if setting, err := config.Get("confirm_each"); err == nil && !opts.ConfirmEach {
+		commands.ConfirmEach, _ = strconv.ParseBool(setting)
+	}
+	// With --target the commands run on another host
+	commands.Target = opts.Target
+	commands.Capture = nil
+
+	// Commands that end up running are recorded in the audit log with what they were suggested for
+	audit.Disabled = false
+	if setting, err := config.Get("audit"); err == nil {
+		enabled, _ := strconv.ParseBool(setting)
+		audit.Disabled = !enabled
+	}
+
+	// Screen readers get plain lines instead of the TUI, $ACCESSIBLE turns it on as it does for other charm tools
+	tea.SetAccessible(opts.Accessible || os.Getenv("ACCESSIBLE") != "")
+	mouse := true
+	if setting, err := config.Get("mouse"); err == nil {
+		mouse, _ = strconv.ParseBool(setting)
+	}
+	tea.SetMouse(mouse)
+
+	// The providers start from their defaults, a model, sampling or candidate count of an earlier run is forgotten
+	gemini.Reset()
+	ollama.Reset()
+	remote.Reset()
+}
+
+// Reports err the way the output mode does and returns the exit code of its kind
+func (s *session) fail(code string, err error) int {
+	if s.jsonMode {
+		jsonout.WriteError(os.Stderr, code, err)
+	} else {
+		log.Println(err)
+	}
+	if exit, ok := exitCodes[code]; ok {
+		return exit
+	}
+	return exitCode(err)
+}
+
+// Logs a warning unless it was shown too often lately, -q doesn't log them at all
+func (s *session) warn(w nag.Warning) {
+	if !s.quiet && s.ledger.Check(w, time.Now()) {
+		log.Println(w.Message)
+	}
+}
+
+// Applies the settings of the terminal, works out the subcommand and the run mode and saves the settings
+// given with flags. Subcommands and flags that only save a setting are done with it.
+func (s *session) setup() (int, bool) {
+	opts := s.opts
+	if opts.NoKeyring {
+		io.DisableKeyring()
+	}
+
+	// Files of older versions move from ~/.lexido to the XDG directories once
+	moved, err := io.MigrateLegacyFiles()
+	for _, notice := range moved {
+		log.Println(notice)
+	}
+	if err != nil {
+		log.Printf("Warning: Could not move all settings to their new location: %v\n", err)
+	}
+	s.reset()
+
+	// Commands run with the terminal as it was before the TUI touched it
+	commands.SaveTerminal()
+	commands.EditCommand = func(cmd string) (string, bool, error) {
+		return tea.EditLine("edit: ", cmd)
+	}
+
+	s.jsonMode = opts.JSON || opts.JSONStream
+
+	// `lexido cnf <name>` is run by the command-not-found handler of the shell integration
+	if opts.command() == "cnf" {
+		if len(opts.Args) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: lexido cnf <command name>")
+			return errs.ExitUsage, true
+		}
+		s.cnfName = opts.Args[1]
+	}
+
+	// --commands-only is -q printing the commands instead of the response, cnf prints a single line
+	s.quiet = opts.Quiet || opts.CommandsOnly || s.cnfName != ""
+	s.headless = s.jsonMode || s.quiet
+
+	if err := format.SetColor(opts.Color); err != nil {
+		return s.fail(jsonout.CodeInvalid, err), true
+	}
+	if s.quiet || tea.IsAccessible() {
+		format.SetColor("never")
+	}
+
+	// The colors of the TUI come from the theme setting, a bad color falls back to the default with a warning
+	themeName, _ := config.Get("theme")
+	themeOverrides, _ := config.Get("theme_colors")
+	for _, warning := range format.SetTheme(themeName, themeOverrides) {
+		log.Printf("Warning: %s\n", warning)
+	}
+	keyOverrides, _ := config.Get("keys")
+	for _, warning := range tea.SetKeys(keyOverrides) {
+		log.Printf("Warning: keys: %s\n", warning)
+	}
+
+	for _, step := range []func() (int, bool){s.parseCommand, s.dispatch, s.chooseMode, s.saveSettings} {
+		if code, done := step(); done {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// Takes the arguments of the subcommands that run a prompt of their own, and checks the flags that don't go with them
+func (s *session) parseCommand() (int, bool) {
+	opts := s.opts
+	if err := opts.validate(); err != nil {
+		return s.fail(jsonout.CodeInvalid, err), true
+	}
+
+	// `lexido commit` runs the regular generation with a commit message prompt built from the staged diff
+	if opts.command() == "commit" {
+		s.commit, s.args = parseCommitArgs(s.args[1:])
+	}
+
+	// `lexido alias` does the same with a prompt for a shell alias or function, saved to the aliases file afterwards
+	if opts.command() == "alias" {
+		var err error
+		if s.alias, s.args, err = parseAliasArgs(s.args[1:]); err != nil {
+			return s.fail(jsonout.CodeInvalid, err), true
+		}
+	}
+
+	// `lexido edit` asks for a unified diff of a file, which is applied to it afterwards
+	if opts.command() == "edit" && isSubcommand("edit", opts.Args[1:]) {
+		var err error
+		if s.edit, s.args, err = parseEditArgs(s.args[1:]); err != nil {
+			return s.fail(jsonout.CodeInvalid, err), true
+		}
+	}
+
+	// `lexido batch` answers a file of prompts one after another into a markdown runbook, it never runs anything
+	if opts.command() == "batch" {
+		var err error
+		if s.batch, err = parseBatchArgs(s.args[1:]); err != nil {
+			return s.fail(jsonout.CodeInvalid, err), true
+		}
+		s.args = nil
+		for flagName, set := range map[string]bool{"json": s.jsonMode, "commands-only": opts.CommandsOnly, "fix-loop": opts.FixLoop, "save-script": opts.SaveScript != "", "tmux": opts.Tmux, "compare": opts.Compare != "", "continue": opts.Continue} {
+			if set {
+				return s.fail(jsonout.CodeInvalid, errs.Usagef("--%s can't be combined with lexido batch", flagName)), true
+			}
+		}
+		// Nobody watches the prompts go by, so nothing may ask a question
+		s.headless = true
+		if s.batch.output == "" {
+			s.batch.output = opts.Output
+		}
+	}
+
+	// Commit messages, aliases and diffs have a pre-prompt of their own, without the context gathered for commands
+	s.ownPrompt = s.commit.enabled || s.alias.enabled || s.edit.enabled
+
+	// `lexido chat` keeps a session open across turns instead of exiting after one answer
+	s.chatMode = opts.command() == "chat"
+	if s.chatMode {
+		s.args = s.args[1:]
+	}
+
+	// `lexido summarize` reads the piped text in prose, with a pre-prompt of its own and no commands like --no-commands
+	s.summarize = opts.command() == "summarize"
+	if s.summarize {
+		s.args = s.args[1:]
+		s.opts.NoCommands = true
+	}
+	if s.opts.NoCommands || s.edit.enabled {
+		for flagName, set := range map[string]bool{"commands-only": opts.CommandsOnly, "fix-loop": opts.FixLoop, "save-script": opts.SaveScript != "", "tmux": opts.Tmux} {
+			if set {
+				return s.fail(jsonout.CodeInvalid, errs.Usagef("--%s needs commands, it can't be combined with --no-commands, lexido summarize or lexido edit", flagName)), true
+			}
+		}
+		if s.opts.NoCommands && (s.chatMode || s.ownPrompt || s.cnfName != "") {
+			return s.fail(jsonout.CodeInvalid, errs.Usagef("--no-commands only applies to prompts and lexido summarize")), true
+		}
+		s.g.noCommands = true
+	}
+
+	// -o keeps the one response of a prompt, chat and --fix-loop have many and cnf prints a single command
+	if opts.Output != "" && !s.batch.enabled {
+		if s.chatMode || opts.FixLoop || s.cnfName != "" {
+			return s.fail(jsonout.CodeInvalid, errs.Usagef("-o writes a single response, it can't be combined with lexido chat, --fix-loop or lexido cnf")), true
+		}
+		if opts.Output == "-" && s.jsonMode {
+			return s.fail(jsonout.CodeInvalid, errs.Usagef("-o - would print the response into the JSON on stdout, name a file instead")), true
+		}
+	}
+
+	if s.cnfName != "" {
+		s.args = nil
+	}
+
+	// `lexido fix` asks for a corrected version of the command the shell integration saw fail last
+	s.fixLast = opts.command() == "fix" && isSubcommand("fix", opts.Args[1:])
+	if s.fixLast {
+		s.args = s.args[1:]
+		var err error
+		s.lastCommand, s.lastStatus, err = shellinit.LastCommand()
+		if err != nil {
+			return s.fail(jsonout.CodeInvalid, err), true
+		}
+	}
+	return 0, false
+}
+
+// Runs the subcommands that don't ask a provider and the flags that only print something
+func (s *session) dispatch() (int, bool) {
+	opts := s.opts
+
+	// update needs the version, which the other subcommands don't get. Like help it is only the subcommand
+	// when nothing but --check follows, `lexido update my packages` is a prompt.
+	if opts.command() == "update" && (len(opts.Args) == 1 || len(opts.Args) == 2 && (opts.Args[1] == "--check" || opts.Args[1] == "-check")) {
+		return updateCommand(opts.Version, opts.Args[1:]), true
+	}
+
+	// help and man are only subcommands when nothing but a topic follows, `lexido man page of tar` is a prompt
+	if opts.command() == "help" && len(opts.Args) <= 2 {
+		return helpCommand(opts.Args[1:]), true
+	}
+	if opts.command() == "man" && len(opts.Args) == 1 {
+		return manCommand(opts.Version), true
+	}
+
+	if command, ok := subcommands[opts.command()]; ok && isSubcommand(opts.command(), opts.Args[1:]) {
+		return command(opts.Args[1:]), true
+	}
+
+	if opts.Help {
+		help.Write(os.Stdout, flag.CommandLine)
+		return 0, true
+	}
+
+	if opts.ShowVersion {
+		io.DisplayVersion(opts.Version)
+		if note := newerVersionNote(opts.Version); note != "" {
+			fmt.Println(note)
+		}
+		return 0, true
+	}
+
+	if opts.SetDefault != "" {
+		if opts.SetDefault != "gemini" && opts.SetDefault != "local" && opts.SetDefault != "remote" {
+			fmt.Println("Invalid default mode. Please use 'gemini', 'local', or 'remote'.")
+			return errs.ExitUsage, true
+		}
+		if err := s.app.Keyring.Save("MODE_DEFAULT", opts.SetDefault); err != nil {
+			log.Printf("Error saving default mode: %v\n", err)
+			return exitCode(err), true
+		}
+		fmt.Printf("Default mode set to %s.\n", opts.SetDefault)
+		return 0, true
+	}
+
+	if opts.SetRemotePreset != "" {
+		return setRemotePreset(opts.SetRemotePreset), true
+	}
+	return 0, false
+}
+
+// Works out the provider the run asks: the saved default, the flags, --race and --compare and whether it is online
+func (s *session) chooseMode() (int, bool) {
+	opts := s.opts
+	runMode, err := s.app.defaultMode()
+	if err != nil {
+		log.Println(err)
+		return exitCode(err), true
+	}
+
+	if opts.Local {
+		runMode = "local"
+	} else if opts.Remote {
+		runMode = "remote"
+	} else if opts.Gemini {
+		runMode = "gemini"
+	}
+
+	// The mock provider replays canned responses, for trying the generation flow without credentials or a daemon
+	if mock.Enabled() {
+		runMode = "mock"
+	}
+
+	// --race and --compare run with their first provider, the others are set up after it like fallbacks
+	if opts.Race != "" && opts.Compare != "" {
+		return s.fail(jsonout.CodeInvalid, errs.Usagef("--race and --compare can't be used together")), true
+	}
+	if opts.Race != "" || opts.Compare != "" {
+		flagName, list := "race", opts.Race
+		if opts.Compare != "" {
+			flagName, list = "compare", opts.Compare
+		}
+		modes, err := parseRace(flagName, list)
+		if err != nil {
+			return s.fail(jsonout.CodeInvalid, err), true
+		}
+		if opts.Alternatives > 1 {
+			return s.fail(jsonout.CodeInvalid, errs.Usagef("--alternatives can't be combined with --%s", flagName)), true
+		}
+		// The answers are compared in the TUI, -q and --json print a single one
+		if opts.Compare != "" && s.headless {
+			return s.fail(jsonout.CodeInvalid, errs.Usagef("--compare needs the TUI, use --race with -q and --json")), true
+		}
+		s.g.racing = raceOptions{modes: modes, compare: opts.Compare != ""}
+		runMode = modes[0]
+	}
+
+	// Offline a cloud provider fails right away instead of after the TCP timeout, or hands over to the local ollama
+	if !opts.AssumeOnline && !s.g.racing.active() && s.app.Provider == nil {
+		savedModel, _ := s.app.Keyring.Read("OLLAMA_MODEL")
+		model, err := checkOnline(runMode, s.headless, savedModel)
+		if err != nil {
+			return s.fail(jsonout.Code(err), err), true
+		}
+		if model != "" {
+			runMode, s.opts.Model, s.opts.OllamaHost = "local", model, "local"
+		}
+	}
+	s.runMode = runMode
+	return 0, false
+}
+
+// Saves the settings given with the --set flags
+func (s *session) saveSettings() (int, bool) {
+	opts := s.opts
+	if _, err := io.GetOrInitIn(s.app.Keyring, "OLLAMA_MODEL", "llama3"); err != nil {
+		log.Printf("Error reading model: %v\n", err)
+		return exitCode(err), true
+	}
+	if opts.SetModel != "" {
+		err := s.app.Keyring.Save("OLLAMA_MODEL", opts.SetModel)
+		if err != nil {
+			log.Printf("Error saving model: %v\n", err)
+			return exitCode(err), true
+		}
+	}
+
+	// New thresholds are merged into the saved ones, categories that aren't named keep theirs
+	if opts.SetSafety != "" {
+		saved, _ := config.Get("gemini_safety")
+		thresholds, err := gemini.ParseSafety(saved + "," + opts.SetSafety)
+		if err == nil {
+			err = config.Set("gemini_safety", gemini.FormatSafety(thresholds))
+		}
+		if err != nil {
+			log.Printf("Error saving safety settings: %v\n", err)
+			return exitCode(err), true
+		}
+	}
+
+	if opts.SetLang != "" {
+		if err := config.Set("lang", opts.SetLang); err != nil {
+			log.Printf("Error saving language: %v\n", err)
+			return exitCode(err), true
+		}
+	}
+
+	if opts.SetFallback != "" {
+		if err := config.Set("fallback", opts.SetFallback); err != nil {
+			log.Printf("Error saving fallback chain: %v\n", err)
+			return exitCode(err), true
+		}
+	}
+
+	// A project means Vertex AI is wanted, the API key is kept for switching back with gemini_auth
+	if opts.SetGcpProject != "" {
+		err := config.Set("gcp_project", opts.SetGcpProject)
+		if err == nil {
+			err = config.Set("gemini_auth", "vertex")
+		}
+		if err != nil {
+			log.Printf("Error saving GCP project: %v\n", err)
+			return exitCode(err), true
+		}
+	}
+	if opts.SetGcpLocation != "" {
+		if err := config.Set("gcp_location", opts.SetGcpLocation); err != nil {
+			log.Printf("Error saving GCP location: %v\n", err)
+			return exitCode(err), true
+		}
+	}
+	return 0, false
+}
+
+// Reads what goes into the prompt besides its words: piped input, images, the conversation, attached files,
+// a template and the clipboard, then builds the user prompt from them
+func (s *session) input() (int, bool) {
+	opts := s.opts
+
+	// Repeated warnings are demoted to an indicator in the TUI instead of being printed every run
+	s.ledger = nag.Open()
+
+	// Read piped input if present, keeping the head and tail of input over the limit
+	s.pipeLimit = io.DefaultPipeLimit
+	if setting, err := config.Get("pipe_limit"); err == nil {
+		s.pipeLimit, _ = io.ParseSize(setting)
+	}
+	if opts.PipeLimit != "" {
+		var err error
+		s.pipeLimit, err = io.ParseSize(opts.PipeLimit)
+		if err != nil {
+			return s.fail(jsonout.CodeInvalid, errs.Wrap(errs.ErrUsage, fmt.Errorf("--pipe-limit: %w", err))), true
+		}
+	}
+	piped, err := io.ReadPipedInput(s.pipeLimit)
+	if opts.followUpInput != nil {
+		piped, err = *opts.followUpInput, nil
+	}
+	if errors.Is(err, io.ErrBinaryInput) {
+		return s.fail(jsonout.CodeInvalid, err), true
+	}
+	if err != nil {
+		s.warn(nag.Warning{Code: "pipe-read", Message: fmt.Sprintf("Failed to read piped input: %v", err)})
+	}
+	s.piped, s.pipedInput = piped, piped.Text
+
+	// Images from --image and a piped PNG or JPEG, a provider that only reads text refuses them before any request
+	s.images, err = readImages(opts.Images, piped.Image)
+	if err != nil {
+		return s.fail(jsonout.CodeInvalid, err), true
+	}
+	if len(s.images) > 0 && !visionProviders[s.runMode] {
+		return s.fail(jsonout.CodeInvalid, noVisionError(s.runMode)), true
+	}
+	for _, mode := range s.g.racing.modes {
+		if len(s.images) > 0 && !visionProviders[mode] {
+			return s.fail(jsonout.CodeInvalid, noVisionError(mode)), true
+		}
+	}
+	if piped.Truncated && s.headless {
+		s.warn(nag.Warning{Code: "pipe-truncated", Message: pipeTruncatedNote(piped, s.pipeLimit)})
+	}
+
+	if opts.Continue {
+		// Read previous conversation from cache if -c is present
+		s.cachedTurns, err = io.LoadConversation()
+		s.cachedConversation = io.RenderConversation(s.cachedTurns)
+		if err != nil {
+			s.warn(nag.Warning{Code: "cache-read", Message: fmt.Sprintf("Warning: Could not read cache. Starting a new conversation. Error: %v", err)})
+		}
+	}
+
+	// Arguments starting with @ attach files, a missing file fails before any request is made
+	s.words, s.fileRefs = io.SplitFileRefs(s.args)
+	attachments, err := io.ReadAttachments(s.fileRefs)
+	if err != nil {
+		return s.fail(jsonout.CodeInvalid, err), true
+	}
+
+	// -t renders a template into the prompt, piped input and files the template uses aren't attached a second time
+	var rendered string
+	if opts.Template != "" {
+		data := templates.NewData(s.words, workingDir(), s.pipedInput, attachments)
+		rendered, err = templates.Render(opts.Template, data)
+		if err != nil {
+			return s.fail(jsonout.CodeInvalid, err), true
+		}
+		if data.Uses("Pipe") {
+			s.pipedInput = ""
+		}
+		if data.Uses("Files") {
+			attachments = nil
+		}
+	}
+
+	attached := prompt.FormatAttachments(attachments)
+
+	// --paste attaches the clipboard, saving the round trip through a pipe or a file
+	if opts.Paste {
+		clip, truncated, err := io.ReadClipboard()
+		if err != nil {
+			return s.fail(jsonout.CodeUnknown, err), true
+		}
+		attached += prompt.FormatClipboard(clip, truncated)
+	}
+
+	// Secrets in piped input and attached files are masked before anything leaves the machine
+	if !opts.NoRedact {
+		var pipedCounts, attachedCounts, renderedCounts map[string]int
+		s.pipedInput, pipedCounts = redact.Text(s.pipedInput)
+		attached, attachedCounts = redact.Text(attached)
+		rendered, renderedCounts = redact.Text(rendered)
+		for name, n := range attachedCounts {
+			pipedCounts[name] += n
+		}
+		for name, n := range renderedCounts {
+			pipedCounts[name] += n
+		}
+		if total, names := redact.Total(pipedCounts); total > 0 {
+			log.Printf("Redacted %d secret(s) (%s) from the input, use --no-redact to send them as is.\n", total, strings.Join(names, ", "))
+		}
+	}
+
+	// PATH context is only gathered for binaries the user explicitly named
+	if opts.WithPath != "" {
+		for _, binary := range strings.Split(opts.WithPath, ",") {
+			pathContext, err := io.PathContext(strings.TrimSpace(binary))
+			if err != nil {
+				return s.fail(jsonout.CodeInvalid, err), true
+			}
+			attached += "\n\n" + pathContext
+		}
+	}
+	s.attached = attached
+
+	return s.buildPrompt(rendered)
+}
+
+// Builds the user prompt from the words, the input and the subcommand. Without a prompt the flags that saved a
+// setting report it, or the prompt is asked for on a terminal.
+func (s *session) buildPrompt(rendered string) (int, bool) {
+	opts := s.opts
+	var err error
+	if s.commit.enabled {
+		s.userPrompt, err = s.commit.prompt(strings.Join(s.words, " ") + s.attached)
+		if err != nil {
+			return s.fail(jsonout.CodeInvalid, err), true
+		}
+	} else if s.alias.enabled {
+		s.userPrompt = strings.Join(s.words, " ") + s.attached
+	} else if s.edit.enabled {
+		s.userPrompt = s.edit.prompt(strings.Join(s.words, " ") + s.attached)
+	} else if s.batch.enabled {
+		// The prompts are read from the file, or from stdin which then isn't attached to each of them
+		if s.batch.source == "-" {
+			err = s.batch.load(s.pipedInput)
+			s.pipedInput = ""
+		} else {
+			err = s.batch.load("")
+		}
+		if err != nil {
+			return s.fail(jsonout.CodeInvalid, err), true
+		}
+		if s.batch.output != "" && s.batch.output != "-" && !opts.Force {
+			if _, err := os.Stat(s.batch.output); err == nil {
+				return s.fail(jsonout.CodeInvalid, fmt.Errorf("%s: %w", s.batch.output, commands.ErrScriptExists)), true
+			}
+		}
+	} else {
+		text := strings.Join(s.words, " ")
+		// A lone - reads the prompt itself from stdin, for tools that compose the whole prompt, it isn't attached as well
+		if text == "-" && opts.Template == "" {
+			if strings.TrimSpace(s.pipedInput) == "" {
+				return s.fail(jsonout.CodeInvalid, errs.Usagef("- reads the prompt from stdin, but nothing was piped in")), true
+			}
+			text, s.pipedInput = s.pipedInput, ""
+			s.words = []string{strings.TrimSpace(text)}
+		}
+		if opts.Template != "" {
+			text = rendered
+		}
+		if s.fixLast {
+			text = prompt.BuildLastCommandPrompt(s.lastCommand, s.lastStatus, text)
+		}
+		if s.cnfName != "" {
+			text = prompt.BuildCommandNotFoundPrompt(s.cnfName)
+		}
+		if s.summarize {
+			if s.pipedInput == "" && s.attached == "" {
+				return s.fail(jsonout.CodeInvalid, errs.Usagef("lexido summarize needs text, pipe it in or attach a file with @path")), true
+			}
+			if strings.TrimSpace(text) == "" {
+				text = prompt.DefaultSummaryRequest
+			}
+		}
+		s.userPrompt, s.instruction, err = prompt.BuildUserPrompt(text, s.pipedInput, s.attached, opts.Continue)
+	}
+	if !errors.Is(err, prompt.ErrNoPrompt) || s.chatMode {
+		return 0, false
+	}
+
+	// Nothing to ask, so don't waste an API call
+	if opts.SetModel != "" {
+		fmt.Printf("Default model set to %s.\n", opts.SetModel)
+		return 0, true
+	}
+	if opts.SetSafety != "" {
+		saved, _ := config.Get("gemini_safety")
+		fmt.Printf("Gemini safety settings set to %s.\n", saved)
+		return 0, true
+	}
+	if opts.SetLang != "" {
+		fmt.Printf("Response language set to %s.\n", opts.SetLang)
+		return 0, true
+	}
+	if opts.SetFallback != "" {
+		saved, _ := config.Get("fallback")
+		fmt.Printf("Fallback chain set to %s.\n", saved)
+		return 0, true
+	}
+	if opts.SetGcpProject != "" || opts.SetGcpLocation != "" {
+		project, _ := config.Get("gcp_project")
+		location, err := config.Get("gcp_location")
+		if err != nil {
+			location = gemini.DefaultLocation
+		}
+		fmt.Printf("Gemini set to run through Vertex AI in project %s, location %s.\n", project, location)
+		return 0, true
+	}
+	if s.jsonMode {
+		jsonout.WriteError(os.Stderr, jsonout.CodeNoPrompt, err)
+		return errs.ExitUsage, true
+	}
+	if s.quiet {
+		log.Println(err)
+		return errs.ExitUsage, true
+	}
+	if !io.IsTerminal(os.Stdin) {
+		help.Write(os.Stdout, flag.CommandLine)
+		return errs.ExitUsage, true
+	}
+	// Started without a prompt on a terminal, so it is asked for instead of showing the help
+	text := askForPrompt()
+	if text == "" {
+		return 0, true
+	}
+	s.words = []string{text}
+	s.userPrompt, s.instruction, _ = prompt.BuildUserPrompt(text, s.pipedInput, s.attached, opts.Continue)
+	return 0, false
+}
+
+// Sets up the provider of the run and its fallbacks, and starts gathering what the prompt needs from the system
+func (s *session) provider() (int, bool) {
+	opts := s.opts
+	if opts.Tmux && !commands.InTmux() {
+		return s.fail(jsonout.CodeInvalid, errs.Usagef("--tmux only works inside a tmux session, $TMUX isn't set")), true
+	}
+
+	// With --target the commands run on another host, which has to be reachable before the model is asked about it
+	system := s.app.System
+	if opts.Target != "" {
+		if opts.RunIn != "" {
+			return s.fail(jsonout.CodeInvalid, errs.Usagef("--run-in can't be combined with --target, the commands run in the home directory of the host")), true
+		}
+		if err := ssh.Check(opts.Target); err != nil {
+			return s.fail(jsonout.CodeNetwork, err), true
+		}
+		system = remoteSystem{target: opts.Target}
+	}
+
+	// The facts about the system are gathered while the provider is set up and the TUI starts
+	factsCh := make(chan Facts, 1)
+	go func() {
+		start := time.Now()
+		factsCh <- system.Collect(opts.RefreshSysinfo)
+		logging.Infof("Gathered the system facts in %s", time.Since(start).Round(time.Millisecond))
+	}()
+
+	logging.Infof("Using %s", s.runMode)
+
+	// Set before the providers are, Setup applies it to Gemini
+	requestSampling, err := samplingOptions(opts)
+	if err != nil {
+		return s.fail(jsonout.CodeInvalid, err), true
+	}
+	for _, warning := range applySampling(requestSampling, s.runMode) {
+		log.Printf("Warning: %s\n", warning)
+	}
+
+	// The provider of the App needs no setup
+	if s.app.Provider == nil {
+		if err := s.app.setupProvider(s.runMode, opts, s.headless, len(s.images) > 0); err != nil {
+			return s.fail(jsonout.Code(err), err), true
+		}
+	}
+
+	s.g.ready[s.runMode] = true
+	for _, mode := range s.g.racing.modes {
+		if err := s.g.setupFallback(mode); err != nil {
+			return s.fail(jsonout.Code(err), fmt.Errorf("Error setting up %s: %w", providerLabel(mode), err)), true
+		}
+	}
+
+	s.auditPrompt = strings.Join(s.words, " ")
+	if s.fixLast {
+		s.auditPrompt = strings.TrimSpace("fix " + s.lastCommand + " " + s.auditPrompt)
+	}
+	audit.SetSession(s.runMode, modelName(s.runMode), s.auditPrompt)
+	if model := modelName(s.runMode); model != "" {
+		logging.Infof("Model: %s", model)
+	}
+
+	// Commands are pinned to the directory lexido was invoked from, unless --run-in says otherwise
+	s.runDir = workingDir()
+	if opts.RunIn != "" {
+		s.runDir, err = filepath.Abs(opts.RunIn)
+		if err == nil {
+			err = commands.CheckRunDir(s.runDir)
+		}
+		if err != nil {
+			log.Printf("Invalid --run-in directory: %v\n", err)
+			return errs.ExitUsage, true
+		}
+	}
+
+	// Explanations come in the language asked for with --lang, or the saved one, which follows $LANG by default
+	lang := opts.Lang
+	if lang == "" {
+		setting, _ := config.Get("lang")
+		lang = prompt.ResolveLanguage(setting)
+	}
+	preprompt, _ := config.Get("preprompt")
+
+	// Facts from the .lexido file of the project, asked about before the TUI takes over the terminal
+	var project io.ProjectContext
+	useProject := false
+	if !opts.NoProjectContext && s.cnfName == "" && !s.ownPrompt && opts.Target == "" {
+		project, useProject = loadProjectContext(s.runDir, s.headless, s.quiet)
+	}
+
+	// What the prompt is built from once the system facts are in
+	s.sources = promptSources{
+		facts:        factsCh,
+		opts:         opts,
+		runMode:      s.runMode,
+		runDir:       s.runDir,
+		lang:         lang,
+		preprompt:    preprompt,
+		user:         s.userPrompt,
+		instruction:  s.instruction,
+		images:       s.images,
+		conversation: s.cachedConversation,
+		project:      project,
+		useProject:   useProject,
+		cnf:          s.cnfName != "",
+		commit:       s.commit,
+		alias:        s.alias,
+		edit:         s.edit,
+		summarize:    s.summarize,
+		chat:         s.chatMode,
+		ownPrompt:    s.ownPrompt,
+	}
+	return 0, false
+}
+
+// Commands go into a script instead of being run
+func (s *session) saveScript(path string, cmds []string) error {
+	return commands.WriteScript(path, cmds, strings.Join(s.words, " "), s.opts.Force)
+}
+
+// -o writes the response once it is complete, - prints it to stdout, the TUI's screen is gone by then
+func (s *session) writeOutput(responseContent string) error {
+	content := commands.OutputFile(responseContent, s.opts.OutputCommands && !s.g.noCommands)
+	if s.opts.Output == "-" {
+		_, err := fmt.Print(content)
+		return err
+	}
+	return io.WriteFileAtomic(s.opts.Output, []byte(content), 0644)
+}
+
+// Asks the provider in the mode of the run: the fix loop, chat, batch, JSON, -q or the TUI. Returns the exit code,
+// and the options of a run for a question about the output of the commands when one was asked.
+func (s *session) generate(ctx context.Context) (int, *Options) {
+	opts := s.opts
+	policy := retryPolicy(opts.MaxAttempts, opts.Timeout)
+
+	if opts.FixLoop {
+		fixOpts := fixLoopOptions{maxIterations: opts.MaxIterations, tokenBudget: opts.FixBudget, auto: opts.Yes, allowRemoval: opts.YesRemovals}
+		fixCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		pre_prompt, _ := s.sources.assemble()
+		code := s.g.runFixLoop(fixCtx, fixOpts, policy, s.runMode, pre_prompt, s.cachedConversation, s.userPrompt, s.runDir)
+		s.ledger.Save()
+		return code, nil
+	}
+
+	if s.chatMode {
+		pre_prompt, _ := s.sources.assemble()
+		return s.g.runChat(s.runMode, pre_prompt, s.cachedTurns, s.userPrompt, s.runDir, policy, opts.YesRemovals), nil
+	}
+
+	// Checked now so no request is wasted on a script or output file that can't be written
+	if opts.SaveScript != "" && !opts.Force {
+		if _, err := os.Stat(opts.SaveScript); err == nil {
+			return s.fail(jsonout.CodeInvalid, fmt.Errorf("%s: %w", opts.SaveScript, commands.ErrScriptExists)), nil
+		}
+	}
+	if opts.Output != "" && opts.Output != "-" && !opts.Force {
+		if _, err := os.Stat(opts.Output); err == nil {
+			return s.fail(jsonout.CodeInvalid, fmt.Errorf("%s: %w", opts.Output, commands.ErrScriptExists)), nil
+		}
+	}
+
+	// Continued conversations, alternatives and commit messages are always asked for anew
+	caching := responseCache(opts.NoCache || opts.Continue || opts.Alternatives > 1 || s.commit.enabled)
+
+	// The same missing command comes up again and again, its suggestion is always cached to answer at once
+	if s.cnfName != "" {
+		caching = responseCache(false)
+		caching.enabled = !opts.NoCache
+	}
+
+	// Ctrl-C inside the TUI arrives as a key press, signals from outside cancel everything through this context
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if s.batch.enabled {
+		_, parts := s.sources.assemble()
+		code := s.g.runBatch(ctx, s.batch, policy, caching, s.runMode, parts, s.pipedInput, s.attached)
+		s.ledger.Save()
+		return code, nil
+	}
+	if s.jsonMode {
+		return s.generateJSON(ctx, policy, caching), nil
+	}
+	if s.quiet {
+		return s.generateQuiet(ctx, policy, caching), nil
+	}
+	return s.generateTUI(ctx, policy, caching)
+}
+
+// Prints the response as JSON, and writes it to the output file and the script when asked to
+func (s *session) generateJSON(ctx context.Context, policy retry.Policy, caching cacheSettings) int {
+	opts := s.opts
+	_, parts := s.sources.assemble()
+	responseContent, err := s.g.runJSON(ctx, policy, caching, s.runMode, s.userPrompt, parts, metadata(opts, s.runMode).Flags, opts.JSONStream)
+	if err != nil {
+		if ctx.Err() != nil {
+			return errs.ExitInterrupted
+		}
+		return exitCode(err)
+	}
+
+	s.g.recordPrompt(s.auditPrompt, responseContent, s.runMode)
+	if err := io.AppendTurns(exchange(s.userPrompt, responseContent, s.runMode, nil)...); err != nil {
+		log.Printf("Warning: Failed to cache conversation. Error: %v", err)
+	}
+	s.ledger.Save()
+	if opts.Output != "" {
+		if err := s.writeOutput(responseContent); err != nil {
+			jsonout.WriteError(os.Stderr, jsonout.CodeUnknown, err)
+			return errs.ExitFailure
+		}
+	}
+	if opts.SaveScript != "" {
+		if err := s.saveScript(opts.SaveScript, commands.ParseCommands(responseContent)); err != nil {
+			jsonout.WriteError(os.Stderr, jsonout.CodeUnknown, err)
+			return errs.ExitFailure
+		}
+	}
+	// The diff is in the result, --apply applies it as well
+	if s.edit.apply {
+		if _, err := s.edit.applyDiff(responseContent, false); err != nil {
+			jsonout.WriteError(os.Stderr, jsonout.CodeUnknown, err)
+			return errs.ExitFailure
+		}
+	}
+	return 0
+}
+
+// Only the response or its commands go to stdout with -q and --commands-only, errors and warnings go to stderr
+func (s *session) generateQuiet(ctx context.Context, policy retry.Policy, caching cacheSettings) int {
+	opts := s.opts
+	_, parts := s.sources.assemble()
+	if s.cnfName != "" {
+		responseContent, err := s.g.runQuiet(ctx, cnfPolicy(opts), caching, s.runMode, parts)
+		if err == nil {
+			err = printCommandNotFound(responseContent)
+		}
+		if err != nil {
+			log.Println(err)
+			return exitCode(err)
+		}
+		s.g.recordPrompt(s.auditPrompt, responseContent, s.runMode)
+		s.ledger.Save()
+		return 0
+	}
+
+	// Which model answered goes to stderr once, only when someone is watching it
+	if io.IsTerminal(os.Stderr) {
+		fmt.Fprintln(os.Stderr, format.Styled("\033[2m"+metadata(opts, s.runMode).String()+"\033[0m"))
+	}
+	responseContent, err := s.g.runQuiet(ctx, policy, caching, s.runMode, parts)
+	// With -o the response goes to the file instead of stdout, --commands-only still prints the commands
+	if err == nil && opts.Output != "" {
+		err = s.writeOutput(responseContent)
+	}
+	if err == nil && (opts.Output == "" || opts.CommandsOnly) {
+		err = printQuiet(responseContent, opts.CommandsOnly, opts.All)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return errs.ExitInterrupted
+		}
+		log.Println(err)
+		return exitCode(err)
+	}
+
+	s.g.recordPrompt(s.auditPrompt, responseContent, s.runMode)
+	if err := io.AppendTurns(exchange(s.userPrompt, responseContent, s.runMode, nil)...); err != nil {
+		log.Printf("Warning: Failed to cache conversation. Error: %v", err)
+	}
+	s.ledger.Save()
+	if opts.SaveScript != "" {
+		if err := s.saveScript(opts.SaveScript, commands.ParseCommands(responseContent)); err != nil {
+			log.Println(err)
+			return errs.ExitFailure
+		}
+	}
+	if s.edit.apply {
+		done, err := s.edit.applyDiff(responseContent, false)
+		if err != nil {
+			log.Printf("Not applying: %v\n", err)
+			return errs.ExitFailure
+		}
+		fmt.Fprintln(os.Stderr, done)
+	}
+	return 0
+}
+
+// What the TUI was closed with: the response, the commands picked in it and the model it returned
+type picked struct {
+	response string
+	cmds     []string
+	model    tearaw.Model
+	timedOut error // A response cut off by the timeout, still worth picking commands from
+}
+
+// Streams the response into the TUI and executes what was picked in it. It returns its exit code instead of exiting,
+// so the cleanup runs and the TUI has given the terminal back before Run returns.
+func (s *session) generateTUI(ctx context.Context, policy retry.Policy, caching cacheSettings) (int, *Options) {
+	opts := s.opts
+
+	// Generation also stops as soon as the TUI is closed
+	genCtx, cancelGeneration := context.WithCancel(ctx)
+	defer cancelGeneration()
+
+	// Bookkeeping happens on every way out, essential writes stay ordered while the rest may be abandoned on exit.
+	// The commands that run are written to the audit log by it too, after the conversation.
+	exit := shutdown.New(shutdown.DefaultGracePeriod)
+	exit.Logf = logging.Debugf
+	audit.Later = exit.Essential
+	defer func() {
+		audit.Later = nil
+		exit.Run()
+	}()
+	exit.Background("nag ledger", func(ctx context.Context) error {
+		return s.ledger.Save()
+	})
+
+	// Run the Bubble Tea program
+
+	cmds := new([]string)
+
+	// Log lines would tear up the TUI, they only go to the log file until it is closed
+	logging.SetStderr(false)
+
+	runsIn := s.runDir
+	if opts.Target != "" {
+		runsIn = "the home directory of " + opts.Target + " over SSH"
+	}
+	p := newProgram(ctx, cmds, s.runMode == "local", runsIn)
+
+	// The program's result comes back over the channel, nothing in this goroutine may exit the process
+	done := make(chan teaResult, 1)
+	go func() {
+		defer cancelGeneration()
+		model, err := p.Run()
+		logging.SetStderr(opts.Verbose || opts.Debug)
+		done <- teaResult{model: model, err: err}
+	}()
+
+	p.Send(s.g.waitingMsg(s.runMode))
+	p.Send(metadata(opts, s.runMode))
+	if s.g.noCommands {
+		p.Send(tea.NoCommandsMsg{})
+	}
+	if s.edit.enabled {
+		p.Send(tea.DiffMsg{})
+	}
+
+	if opts.Pager {
+		p.Send(tea.PagerMsg{})
+	}
+
+	// Inside tmux t sends the commands to new panes, with --tmux the run button does
+	if commands.InTmux() {
+		p.Send(tea.TmuxMsg{OnRun: opts.Tmux})
+	}
+
+	if opts.Target != "" {
+		p.Send(tea.HeaderMsg("Commands will run on " + opts.Target + " over SSH, not on this machine"))
+	}
+
+	if s.piped.Truncated {
+		p.Send(tea.InputNoteMsg(pipeTruncatedNote(s.piped, s.pipeLimit)))
+	}
+
+	if demoted := s.ledger.Demoted(); len(demoted) > 0 {
+		messages := make([]string, len(demoted))
+		for i, w := range demoted {
+			messages[i] = w.Message
+		}
+		p.Send(tea.DemotedWarningsMsg(messages))
+	}
+
+	scriptPath := opts.SaveScript
+	if scriptPath == "" {
+		scriptPath = "lexido.sh"
+	}
+	p.Send(tea.ScriptMsg{Path: scriptPath, SaveOnRun: opts.SaveScript != "", Save: s.saveScript})
+	p.Send(tea.FavoriteMsg(func(command string, tags string) error {
+		return favorites.Add(favorites.Favorite{Command: command, Prompt: s.auditPrompt, Provider: s.runMode, Model: modelName(s.runMode), Tags: favorites.ParseTags(tags)})
+	}))
+
+	// The TUI may stop the rest of the response while keeping what already arrived
+	stopCtx, stopGeneration := context.WithCancel(genCtx)
+	defer stopGeneration()
+	p.Send(tea.StopGenerationMsg(stopGeneration))
+	p.Send(s.g.explainer(s.runMode, policy.AttemptTimeout))
+
+	// The TUI shows its spinner while the rest of the prompt is put together
+	_, parts := s.sources.assemble()
+	p.Send(s.g.regenerator(policy, s.runMode, parts, p.Send))
+	responseContent, genErr := s.g.generateCached(stopCtx, policy, caching, s.runMode, parts, p.Send)
+	if errors.Is(genErr, context.Canceled) && genCtx.Err() == nil {
+		genErr = nil
+	}
+
+	var timedOut error
+	var timeoutErr *retry.TimeoutError
+	if errors.As(genErr, &timeoutErr) && responseContent != "" {
+		timedOut = genErr
+		genErr = nil
+		p.Send(tea.StatusMsg(timedOut.Error() + ", showing the partial response"))
+	}
+	if genErr != nil {
+		// The TUI shows the error and quits, restoring the terminal before anything else is printed
+		p.Send(tea.ErrorMsg{Err: genErr})
+		result := <-done
+
+		if ctx.Err() != nil || tea.Interrupted(result.model) {
+			return errs.ExitInterrupted, nil
+		}
+		if errors.Is(genErr, context.Canceled) {
+			// Closed with q before the response was complete
+			return 0, nil
+		}
+		if !tea.ShowedError(result.model) {
+			log.Println(genErr)
+		}
+
+		// A blocked prompt often goes through when worded differently
+		var safetyErr *gemini.SafetyError
+		if errors.As(genErr, &safetyErr) && !s.commit.enabled {
+			return offerRephrase(strings.Join(s.words, " "), s.fileRefs, opts), nil
+		}
+		return exitCode(genErr), nil
+	}
+
+	p.Send(tea.GenerationDoneMsg{})
+	exit.Background("stats", func(ctx context.Context) error {
+		s.g.recordPrompt(s.auditPrompt, responseContent, s.runMode)
+		return nil
+	})
+	exit.Essential("conversation cache", func() error {
+		// Runs once the TUI is closed, when the commands picked to run and the suggestion picked are known
+		ran := *cmds
+		if opts.SaveScript != "" {
+			ran = nil
+		}
+		err := io.AppendTurns(exchange(s.userPrompt, responseContent, s.runMode, ran)...)
+		if err != nil {
+			log.Printf("Warning: Failed to cache conversation. Error: %v", err)
+		}
+		return err
+	})
+
+	result := <-done
+
+	if result.err != nil && !errors.Is(result.err, tearaw.ErrProgramKilled) {
+		log.Printf("Alas, there's been a Bubble Tea error: %v\n", result.err)
+		return errs.ExitFailure, nil
+	}
+
+	// Interrupted by a signal or Ctrl-C
+	if ctx.Err() != nil || tea.Interrupted(result.model) {
+		return errs.ExitInterrupted, nil
+	}
+
+	// The conversation goes on from the suggestion that was picked
+	if regenerated, ok := tea.Regenerated(result.model); ok {
+		responseContent = regenerated
+	}
+
+	code, followUp := s.execute(picked{response: responseContent, cmds: *cmds, model: result.model, timedOut: timedOut})
+	// The conversation cache records the commands that ran, which execute may have rewritten
+	*cmds = s.ran
+	return code, followUp
+}
+
+// Does what the closed TUI asked for with the response: writes it to the output file, finishes a subcommand,
+// saves the script or runs the picked commands. Returns the exit code, and the options of a run for a question
+// about the output of the commands when one was asked.
+func (s *session) execute(p picked) (int, *Options) {
+	opts := s.opts
+	s.ran = p.cmds
+
+	if p.timedOut != nil {
+		log.Printf("Warning: %v, the response is incomplete\n", p.timedOut)
+	}
+
+	if opts.Output != "" {
+		if err := s.writeOutput(p.response); err != nil {
+			log.Printf("Failed to write the response: %v\n", err)
+			return errs.ExitFailure, nil
+		}
+	}
+
+	if s.commit.enabled {
+		return s.commit.finish(p.response), nil
+	}
+	if s.alias.enabled {
+		return s.alias.finish(s.auditPrompt, p.response), nil
+	}
+	if s.edit.enabled {
+		return s.edit.finish(p.response), nil
+	}
+
+	// With --save-script nothing is run, the selected commands end up in the script
+	if opts.SaveScript != "" {
+		if len(p.cmds) == 0 {
+			return 0, nil
+		}
+		if err := s.saveScript(opts.SaveScript, p.cmds); err != nil {
+			log.Println(err)
+			return errs.ExitFailure, nil
+		}
+		fmt.Printf("Saved %d command(s) to %s.\n", len(p.cmds), opts.SaveScript)
+		return 0, nil
+	}
+	if len(p.cmds) == 0 {
+		return 0, nil
+	}
+
+	// Refuse to run in a directory that was deleted while lexido was open, offering another one instead
+	runDir := s.runDir
+	for {
+		err := commands.CheckRunDir(runDir)
+		if err == nil {
+			break
+		}
+		fmt.Printf("Not running the selected commands: %v.\n", err)
+		fmt.Print("Enter another directory to run them in, or leave empty to cancel: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			return errs.ExitFailure, nil
+		}
+		runDir, _ = filepath.Abs(answer)
+	}
+
+	// Commands sent to tmux run in panes of their own, where they can ask what they like, lexido doesn't wait for them
+	if tea.SentToTmux(p.model) {
+		if err := commands.DispatchTmux(p.cmds, runDir, tmuxLayout()); err != nil {
+			log.Println(err)
+			return errs.ExitFailure, nil
+		}
+		fmt.Printf("Sent %d command(s) to tmux.\n", len(p.cmds))
+		return 0, nil
+	}
+
+	// Commands that ask their own questions either get their non-interactive flag or run with their prompts visible
+	s.ran = resolveInteractive(p.cmds, opts.YesRemovals)
+
+	// Their output is kept for a question about it, unless --no-capture leaves the terminal to them
+	var output *io.LimitedBuffer
+	if !opts.NoCapture && io.IsTerminal(os.Stdin) {
+		output = io.NewLimitedBuffer(s.pipeLimit)
+		commands.Capture = output
+	}
+
+	// Run the commands, a failed one decides the exit code
+	runErr := commands.RunCommands(s.ran, runDir)
+	commands.Capture = nil
+
+	var followUp *Options
+	if output != nil {
+		followUp = askAboutOutput(opts, output)
+	}
+	return exitCode(runErr), followUp
+}
+
+// Asks for the prompt on the terminal, an empty answer or Ctrl-D asks nothing
+func askForPrompt() string {
+	fmt.Print("What do you need? ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer)
+}
+
+// Offers to ask about the output of the commands that just ran, returning the options of the follow-up run
+func askAboutOutput(opts Options, output *io.LimitedBuffer) *Options {
+	input, err := output.Input()
+	if err != nil || strings.TrimSpace(input.Text) == "" {
+		return nil
+	}
+	fmt.Print("\nAsk about the output? Type a question, or press enter to finish: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	question := strings.TrimSpace(answer)
+	if question == "" {
+		return nil
+	}
+
+	followUp := opts
+	followUp.Args = []string{question}
+	followUp.Continue = true
+	followUp.followUpInput = &input
+	followUp.Template = ""
+	followUp.Paste = false
+	// The file of -o keeps the answer to the prompt, not to the question about its output
+	followUp.Output = ""
+	return &followUp
+}
+
+// Returns the saved default mode. Without one it is saved as gemini, or as local when the OLLAMA_LOCAL
+// setting of older versions says so.
+func (a *App) defaultMode() (string, error) {
+	runMode, err := a.Keyring.Read("MODE_DEFAULT")
+	if err == nil {
+		return runMode, nil
+	}
+	if !errors.Is(err, io.ErrNotFound) {
+		return "", fmt.Errorf("Error reading mode: %w", err)
+	}
+
+	// Check for deprecated ollama local
+	wasLocal := false
+	ollamaLocal, err := a.Keyring.Read("OLLAMA_LOCAL")
+	if err != nil {
+		if !errors.Is(err, io.ErrNotFound) {
+			return "", fmt.Errorf("Error reading local: %w", err)
+		}
+	} else {
+		wasLocal, err = strconv.ParseBool(ollamaLocal)
+		if err != nil {
+			return "", fmt.Errorf("Error reading local: %w", err)
+		}
+	}
+
+	runMode = "gemini"
+	if wasLocal {
+		runMode = "local"
+	}
+	if err := a.Keyring.Save("MODE_DEFAULT", runMode); err != nil {
+		return "", fmt.Errorf("Error saving model: %w", err)
+	}
+	return runMode, nil
+}
+
+// The TUI, or what stands in for it with --accessible
+type program interface {
+	Run() (tearaw.Model, error)
+	Send(msg tearaw.Msg)
+	Quit()
+}
+
+// Returns the interface the response is shown and the commands are picked in
+func newProgram(ctx context.Context, cmds *[]string, local bool, runDir string) program {
+	if tea.IsAccessible() {
+		return tea.NewAccessible(ctx, cmds, local, runDir)
+	}
+	return tearaw.NewProgram(tea.InitialModel(cmds, local, runDir), tearaw.WithContext(ctx), tearaw.WithoutSignalHandler())
+}
+
+// What the Bubble Tea program returned, sent back from its goroutine
+type teaResult struct {
+	model tearaw.Model
+	err   error
+}
+
+// Returns the context window assumed for the mode, the context_<mode> setting overrides the built-in one
+func contextWindowFor(runMode string) int {
+	contextWindow := prompt.ContextWindow(runMode, modelName(runMode))
+	if limit, err := config.Get("context_" + runMode); err == nil {
+		if n, err := strconv.Atoi(limit); err == nil && n > 0 {
+			contextWindow = n
+		}
+	}
+	return contextWindow
+}
+
+// Lets the user reword a blocked prompt and runs lexido again with it, returning the exit code to use
+// Only offered on a terminal, piped input can't be sent a second time. The flags of opts are given again.
+func offerRephrase(text string, fileRefs []string, opts Options) int {
+	if !io.IsTerminal(os.Stdin) {
+		return errs.ExitBlocked
+	}
+	fmt.Print("Try again with a rephrased prompt? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		return errs.ExitBlocked
+	}
+	rephrased, ok, err := tea.EditLine("prompt: ", text)
+	if err != nil || !ok || rephrased == "" {
+		return errs.ExitBlocked
+	}
+
+	// The same flags again, with the new prompt after -- so none of its words is taken for a flag or a subcommand
+	args := append(opts.flagArgs(flag.CommandLine), "--")
+	for _, ref := range fileRefs {
+		args = append(args, "@"+ref)
+	}
+	args = append(args, rephrased)
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		log.Println(err)
+		return errs.ExitFailure
+	}
+	return 0
+}
+
+// Counts the prompt and the commands suggested for it in the activity log of lexido stats
+func (g *generator) recordPrompt(prompt string, response string, runMode string) {
+	if err := stats.RecordPrompt(runMode, modelName(runMode), prompt, len(g.suggestedCommands(response))); err != nil {
+		logging.Warnf("Error recording usage stats: %v", err)
+	}
+}
+
+// Returns the turns an answered prompt adds to the conversation cache, an empty prompt adds only the response
+func exchange(user_prompt string, response string, runMode string, ran []string) []io.Turn {
+	var turns []io.Turn
+	if user_prompt != "" {
+		turns = append(turns, io.Turn{Role: "user", Content: user_prompt})
+	}
+	return append(turns, io.Turn{Role: "assistant", Content: response, Provider: runMode, CommandsRun: ran})
+}
+
+// Returns how many shell history entries go into the prompt, --history wins over the history setting
+func historyLength(flagValue int, flagSet bool) int {
+	if flagSet {
+		return flagValue
+	}
+	if setting, err := config.Get("history"); err == nil {
+		if n, err := strconv.Atoi(setting); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+// Asks how to handle commands that will prompt on their own, remembering the answer per command family
+func resolveInteractive(cmds []string, allowRemoval bool) []string {
+	reader := bufio.NewReader(os.Stdin)
+	resolved := make([]string, len(cmds))
+
+	for i, cmd := range cmds {
+		resolved[i] = cmd
+		interaction, ok := commands.DetectInteractive(cmd, allowRemoval)
+		if !ok {
+			continue
+		}
+
+		if interaction.Rewrite == "" {
+			fmt.Printf("Note: %q will ask its own questions, answer them below.\n", cmd)
+			continue
+		}
+
+		setting, _ := config.Get("prompt_choices")
+		choices, err := commands.ParseChoices(setting)
+		if err != nil {
+			log.Printf("Warning: Ignoring the prompt_choices setting: %v", err)
+			choices = map[string]string{}
+		}
+		choice := choices[interaction.Family]
+		if choice == "" {
+			fmt.Printf("%q will ask for confirmation itself.\n", cmd)
+			fmt.Printf("[a]dd the non-interactive flag (%s) or [p]ass its prompts through to you? Use A or P to remember for %s: ", interaction.Rewrite, interaction.Family)
+			answer, _ := reader.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+
+			switch answer {
+			case "A", "P":
+				choice = map[string]string{"A": commands.ChoiceFlag, "P": commands.ChoicePassthrough}[answer]
+				choices[interaction.Family] = choice
+				if err := config.Set("prompt_choices", commands.FormatChoices(choices)); err != nil {
+					log.Printf("Warning: Failed to remember the choice for %s: %v", interaction.Family, err)
+				}
+			case "a":
+				choice = commands.ChoiceFlag
+			default:
+				choice = commands.ChoicePassthrough
+			}
+		}
+
+		if choice == commands.ChoiceFlag {
+			resolved[i] = interaction.Rewrite
+		}
+	}
+
+	return resolved
+}
+
+// Tells how much of the piped input was left out, for the footer or stderr
+func pipeTruncatedNote(piped io.PipedInput, limit int) string {
+	return fmt.Sprintf("piped input cut to %s, %d lines (%s) in the middle left out, raise it with --pipe-limit", io.FormatSize(int64(limit)), piped.DroppedLines, io.FormatSize(piped.DroppedBytes))
+}
+
+// Reads the images of --image, followed by a piped one, and checks that together they fit into a request
+func readImages(paths []string, piped *io.Image) ([]io.Image, error) {
+	var images []io.Image
+	total := 0
+	for _, path := range paths {
+		img, err := io.ReadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	if piped != nil {
+		images = append(images, *piped)
+	}
+	for _, img := range images {
+		total += len(img.Data)
+	}
+	if total > io.MaxImageSize {
+		return nil, fmt.Errorf("the images add up to %s, a prompt can carry at most %s of them", io.FormatSize(int64(total)), io.FormatSize(io.MaxImageSize))
+	}
+	return images, nil
+}
+
+// Returns where the commands sent to tmux go, from the tmux_layout and tmux_chain settings
+func tmuxLayout() commands.TmuxLayout {
+	var layout commands.TmuxLayout
+	if setting, err := config.Get("tmux_layout"); err == nil {
+		layout.Window = setting == "window"
+	}
+	if setting, err := config.Get("tmux_chain"); err == nil {
+		layout.Chain, _ = strconv.ParseBool(setting)
+	}
+	return layout
+}
@@ -0,0 +1,793 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tearaw "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/audit"
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/jsonout"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	"github.com/micr0-dev/lexido/pkg/llms/mock"
+	"github.com/micr0-dev/lexido/pkg/nag"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/tea"
+)
+
+// Points HOME and the XDG directories at a temporary directory, so settings, caches and logs of the test
+// never touch the user's. Settings go to the credentials file there instead of the keyring.
+func isolate(t *testing.T) string {
+	t.Helper()
+	io.DisableKeyring()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, name := range []string{"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME", "XDG_STATE_HOME"} {
+		t.Setenv(name, filepath.Join(home, name))
+	}
+	return home
+}
+
+// The keyring of a test, saved settings stay in the map
+type memStore map[string]string
+
+func (s memStore) Read(field string) (string, error) {
+	value, ok := s[field]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", field, io.ErrNotFound)
+	}
+	return value, nil
+}
+
+func (s memStore) Save(field string, value string) error {
+	s[field] = value
+	return nil
+}
+
+// The facts of a made-up machine, so the prompt doesn't depend on the one the tests run on
+type fixedSystem Facts
+
+func (s fixedSystem) Collect(refresh bool) Facts {
+	return Facts(s)
+}
+
+var testFacts = fixedSystem{
+	Username:        "tester",
+	Hostname:        "testbox",
+	Cwd:             "/home/tester/project",
+	OperatingSystem: "Test Linux 1.0",
+	PackageManagers: []string{"apt"},
+}
+
+// What a run of lexido ended with
+type result struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+// Makes the runs of the test use the mock provider, replaying the responses in order
+func replay(t *testing.T, responses ...mock.Response) {
+	t.Helper()
+	t.Setenv(mock.ProviderEnv, "mock")
+	t.Setenv(mock.ScriptEnv, "")
+	mock.SetScript(mock.Script{Responses: responses})
+	t.Cleanup(func() { mock.SetScript(mock.DefaultScript) })
+}
+
+// Runs lexido headlessly in an isolated home with the mock provider, stdin is what the user types.
+// A regular file is never taken for piped input, so stdin only answers questions.
+func runApp(t *testing.T, opts Options, stdin string) result {
+	t.Helper()
+	return runAppWith(t, &App{Keyring: memStore{"MODE_DEFAULT": "gemini"}, System: testFacts}, opts, stdin)
+}
+
+// Runs lexido like runApp does with the seams of app
+func runAppWith(t *testing.T, app *App, opts Options, stdin string) result {
+	t.Helper()
+	done := redirect(t, stdin)
+	code := app.Run(context.Background(), opts)
+	stdout, stderr := done()
+	return result{code: code, stdout: stdout, stderr: stderr}
+}
+
+// Points stdin, stdout, stderr and the log at files until the returned function gives back what was written
+func redirect(t *testing.T, stdin string) func() (stdout string, stderr string) {
+	t.Helper()
+	dir := t.TempDir()
+	file := func(name string, content string) *os.File {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	in, out, errOut := file("stdin", stdin), file("stdout", ""), file("stderr", "")
+
+	stdinWas, stdoutWas, stderrWas := os.Stdin, os.Stdout, os.Stderr
+	os.Stdin, os.Stdout, os.Stderr = in, out, errOut
+	log.SetOutput(errOut)
+	return func() (string, string) {
+		os.Stdin, os.Stdout, os.Stderr = stdinWas, stdoutWas, stderrWas
+		log.SetOutput(stderrWas)
+		tea.SetAccessible(false)
+		in.Close()
+		out.Close()
+		errOut.Close()
+		stdout, _ := os.ReadFile(out.Name())
+		stderr, _ := os.ReadFile(errOut.Name())
+		return string(stdout), string(stderr)
+	}
+}
+
+func TestHistoryLength(t *testing.T) {
+	isolate(t)
+
+	// Shell history is private, none is shared unless asked for
+	if n := historyLength(0, false); n != 0 {
+		t.Errorf("historyLength() = %d by default, want 0", n)
+	}
+	if n := historyLength(10, true); n != 10 {
+		t.Errorf("historyLength(--history 10) = %d, want 10", n)
+	}
+
+	if err := config.Set("history", "5"); err != nil {
+		t.Fatal(err)
+	}
+	if n := historyLength(0, false); n != 5 {
+		t.Errorf("historyLength() = %d with the history setting at 5, want 5", n)
+	}
+	// --history 0 turns it off for one run
+	if n := historyLength(0, true); n != 0 {
+		t.Errorf("historyLength(--history 0) = %d, want 0", n)
+	}
+}
+
+// A response with two commands, streamed in chunks that split the first one
+var twoCommands = mock.Response{Chunks: []string{
+	"Show the biggest files with @run[du -ah . | sort -rh",
+	" | head -5] and the free space with @run[df -h].",
+}}
+
+func TestRunQuiet(t *testing.T) {
+	isolate(t)
+	replay(t, twoCommands)
+
+	r := runApp(t, Options{Args: []string{"find", "big", "files"}, Quiet: true}, "")
+	if r.code != 0 {
+		t.Fatalf("exit code %d, stderr %q", r.code, r.stderr)
+	}
+	if want := "Show the biggest files with @run[du -ah . | sort -rh | head -5] and the free space with @run[df -h].\n"; r.stdout != want {
+		t.Errorf("stdout = %q, want the response as is", r.stdout)
+	}
+
+	// The prompt is assembled from the words and the facts of the machine
+	prompts := mock.Prompts()
+	if len(prompts) != 1 {
+		t.Fatalf("sent %d prompts, want 1", len(prompts))
+	}
+	if prompts[0].User != "find big files" {
+		t.Errorf("user prompt = %q, want the words of the command line", prompts[0].User)
+	}
+	for _, fact := range []string{"Test Linux 1.0", "testbox", "tester", "apt"} {
+		if !strings.Contains(prompts[0].System, fact) {
+			t.Errorf("the system prompt doesn't mention %q: %q", fact, prompts[0].System)
+		}
+	}
+}
+
+func TestRunCommandsOnly(t *testing.T) {
+	isolate(t)
+	replay(t, twoCommands)
+
+	r := runApp(t, Options{Args: []string{"find", "big", "files"}, CommandsOnly: true}, "")
+	if r.code != 0 || r.stdout != "du -ah . | sort -rh | head -5\n" {
+		t.Errorf("--commands-only = %d %q, want the first command", r.code, r.stdout)
+	}
+
+	r = runApp(t, Options{Args: []string{"find", "big", "files"}, CommandsOnly: true, All: true}, "")
+	if r.code != 0 || r.stdout != "du -ah . | sort -rh | head -5\ndf -h\n" {
+		t.Errorf("--commands-only --all = %d %q, want both commands", r.code, r.stdout)
+	}
+
+	replay(t, mock.Response{Chunks: []string{"Nothing to run here."}})
+	if r := runApp(t, Options{Args: []string{"hello"}, CommandsOnly: true}, ""); r.code == 0 || r.stdout != "" {
+		t.Errorf("--commands-only without a command = %d %q, want a failure", r.code, r.stdout)
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	isolate(t)
+	replay(t, twoCommands)
+
+	r := runApp(t, Options{Args: []string{"find", "big", "files"}, JSON: true}, "")
+	if r.code != 0 {
+		t.Fatalf("exit code %d, stderr %q", r.code, r.stderr)
+	}
+	var got jsonout.Result
+	if err := json.Unmarshal([]byte(r.stdout), &got); err != nil {
+		t.Fatalf("stdout %q isn't JSON: %v", r.stdout, err)
+	}
+	if got.Provider != "mock" || got.Prompt != "find big files" {
+		t.Errorf("result = %+v, want the mock provider and the prompt", got)
+	}
+	if want := []string{"du -ah . | sort -rh | head -5", "df -h"}; !reflect.DeepEqual(got.Commands, want) {
+		t.Errorf("commands = %q, want %q", got.Commands, want)
+	}
+	if got.Usage == nil || !got.Usage.Estimated {
+		t.Errorf("usage = %+v, want it estimated, the mock reports none", got.Usage)
+	}
+}
+
+func TestRunInjectedErrors(t *testing.T) {
+	isolate(t)
+	tests := []struct {
+		name      string
+		responses []mock.Response
+		code      int
+		errCode   string
+	}{
+		{"rate limited once", []mock.Response{{Error: "rate_limit", RetryAfter: mock.Duration(10 * time.Millisecond)}, twoCommands}, 0, ""},
+		{"cut off and restarted", []mock.Response{{Chunks: twoCommands.Chunks, Error: "reset", FailAfter: 1}, twoCommands}, 0, ""},
+		{"bad key", []mock.Response{{Error: "auth"}}, errs.ExitAuth, jsonout.CodeAuth},
+		{"no network", []mock.Response{{Error: "network"}}, errs.ExitNetwork, jsonout.CodeNetwork},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replay(t, test.responses...)
+			r := runApp(t, Options{Args: []string{"find", "big", "files"}, JSON: true}, "")
+			if r.code != test.code {
+				t.Fatalf("exit code %d, want %d, stderr %q", r.code, test.code, r.stderr)
+			}
+			if test.errCode == "" {
+				var got jsonout.Result
+				if err := json.Unmarshal([]byte(r.stdout), &got); err != nil || len(got.Commands) != 2 {
+					t.Errorf("stdout = %q, want the complete response after the retry", r.stdout)
+				}
+				return
+			}
+			if !strings.Contains(r.stderr, `"`+test.errCode+`"`) {
+				t.Errorf("stderr = %q, want the error code %s", r.stderr, test.errCode)
+			}
+		})
+	}
+}
+
+func TestRunWithoutPrompt(t *testing.T) {
+	isolate(t)
+	replay(t, twoCommands)
+
+	// Nothing to ask about fails as a usage error before anything is sent
+	r := runApp(t, Options{Quiet: true}, "")
+	if r.code != errs.ExitUsage {
+		t.Errorf("exit code %d without a prompt, want %d", r.code, errs.ExitUsage)
+	}
+	if n := len(mock.Prompts()); n != 0 {
+		t.Errorf("sent %d prompts without a prompt, want none", n)
+	}
+}
+
+// The plain interface of --accessible shows the response and reads the commands to run from stdin
+func TestRunAccessibleRunsPickedCommand(t *testing.T) {
+	isolate(t)
+	runIn := t.TempDir()
+	replay(t, mock.Response{Chunks: []string{
+		"Write the date with @run[date > first.txt]",
+		" or the name with @run[echo tester > second.txt].\n",
+	}})
+
+	r := runApp(t, Options{Args: []string{"write", "a", "file"}, Accessible: true, RunIn: runIn}, "2\n")
+	if r.code != 0 {
+		t.Fatalf("exit code %d, stderr %q", r.code, r.stderr)
+	}
+	for _, want := range []string{"1. date > first.txt", "2. echo tester > second.txt", "Selected commands will run in " + runIn} {
+		if !strings.Contains(r.stdout, want) {
+			t.Errorf("stdout doesn't show %q: %q", want, r.stdout)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(runIn, "second.txt")); err != nil || string(data) != "tester\n" {
+		t.Errorf("second.txt = %q, %v, want the picked command run in --run-in", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(runIn, "first.txt")); err == nil {
+		t.Error("the command that wasn't picked ran")
+	}
+}
+
+// A failed generation is shown in the TUI, which quits with it instead of exiting the process, so Run maps the
+// error to the exit code once the writes on the way out are done
+func TestRunShowsGenerationError(t *testing.T) {
+	isolate(t)
+	var deferred bool
+	app := &App{Keyring: memStore{"MODE_DEFAULT": "gemini"}, System: testFacts}
+	app.Provider = func(ctx context.Context, runMode string, parts prompt.Parts, send func(tearaw.Msg)) (string, error) {
+		send(tea.AppendResponseMsg("Looking for the "))
+		// Handed to the shutdown coordinator as an essential write rather than written now
+		audit.Record("echo before the error", t.TempDir(), 0, 0)
+		entries, err := audit.Tail(1)
+		deferred = err == nil && len(entries) == 0
+		return "Looking for the ", errs.Wrap(errs.ErrNetwork, errors.New("connection reset by peer"))
+	}
+
+	r := runAppWith(t, app, Options{Args: []string{"find", "big", "files"}, Accessible: true}, "")
+	if r.code != errs.ExitNetwork {
+		t.Fatalf("exit code %d, want %d, stderr %q", r.code, errs.ExitNetwork, r.stderr)
+	}
+	if !strings.Contains(r.stdout, "Error: ") || !strings.Contains(r.stdout, "connection reset by peer") {
+		t.Errorf("stdout = %q, want the error shown", r.stdout)
+	}
+	if !deferred {
+		t.Error("the audit entry was written before the program quit, want it left to the essential tasks")
+	}
+	if entries, err := audit.Tail(1); err != nil || len(entries) != 1 || entries[0].Command != "echo before the error" {
+		t.Errorf("audit log after Run = %v, %v, want the essential write done before Run returned", entries, err)
+	}
+}
+
+// --save-script is a dry run, the picked commands end up in the script and nothing runs
+func TestRunSaveScriptDryRun(t *testing.T) {
+	isolate(t)
+	runIn := t.TempDir()
+	script := filepath.Join(t.TempDir(), "fix.sh")
+	replay(t, mock.Response{Chunks: []string{"Create it with @run[touch created.txt]\n"}})
+
+	r := runApp(t, Options{Args: []string{"create", "a", "file"}, Accessible: true, RunIn: runIn, SaveScript: script}, "1\n")
+	if r.code != 0 {
+		t.Fatalf("exit code %d, stderr %q", r.code, r.stderr)
+	}
+	data, err := os.ReadFile(script)
+	if err != nil || !strings.Contains(string(data), "touch created.txt") {
+		t.Errorf("the script has %q, %v, want the picked command", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(runIn, "created.txt")); err == nil {
+		t.Error("the command ran with --save-script")
+	}
+}
+
+// Starts the test in a directory of its own, which the test may delete
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	was, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "invoked-from")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(was) })
+	return dir
+}
+
+// A provider answering with the response after running before, e.g. to delete a directory while lexido is open
+func answering(response string, before func()) Provider {
+	return func(ctx context.Context, runMode string, parts prompt.Parts, send func(tearaw.Msg)) (string, error) {
+		before()
+		send(tea.AppendResponseMsg(response))
+		return response, nil
+	}
+}
+
+func TestRunInvokedDirectoryPinned(t *testing.T) {
+	isolate(t)
+	dir := chdirTemp(t)
+	app := &App{Keyring: memStore{}, System: testFacts, Provider: answering("Run @run[pwd > where.txt]\n", func() {
+		// Something in the TUI moving the process elsewhere doesn't move the commands
+		os.Chdir(os.TempDir())
+	})}
+
+	r := runAppWith(t, app, Options{Args: []string{"where", "am", "i"}, Accessible: true}, "1\n")
+	if r.code != 0 {
+		t.Fatalf("exit code %d, stderr %q", r.code, r.stderr)
+	}
+	if !strings.Contains(r.stdout, "Selected commands will run in "+dir) {
+		t.Errorf("stdout = %q, want the directory the commands run in shown", r.stdout)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "where.txt")); err != nil || strings.TrimSpace(string(data)) != dir {
+		t.Errorf("where.txt = %q, %v, want the command run in %s", data, err, dir)
+	}
+}
+
+func TestRunInvokedDirectoryDeleted(t *testing.T) {
+	isolate(t)
+	dir := chdirTemp(t)
+	other := t.TempDir()
+	response := "Run @run[pwd > where.txt]\n"
+
+	// Deleted while the response streams in, nothing runs unless another directory is given
+	app := &App{Keyring: memStore{}, System: testFacts, Provider: answering(response, func() { os.Remove(dir) })}
+	r := runAppWith(t, app, Options{Args: []string{"where", "am", "i"}, Accessible: true}, "1\n\n")
+	if r.code != errs.ExitFailure {
+		t.Errorf("exit code %d, want %d", r.code, errs.ExitFailure)
+	}
+	if want := "Not running the selected commands: the directory " + dir + " no longer exists."; !strings.Contains(r.stdout, want) {
+		t.Errorf("stdout = %q, want %q", r.stdout, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "where.txt")); err == nil {
+		t.Error("the command ran in the deleted directory")
+	}
+
+	// The directory given instead is used
+	os.Mkdir(dir, 0755)
+	r = runAppWith(t, app, Options{Args: []string{"where", "am", "i"}, Accessible: true}, "1\n"+other+"\n")
+	if r.code != 0 {
+		t.Fatalf("exit code %d, stderr %q", r.code, r.stderr)
+	}
+	if data, err := os.ReadFile(filepath.Join(other, "where.txt")); err != nil || strings.TrimSpace(string(data)) != other {
+		t.Errorf("where.txt = %q, %v, want the command run in %s", data, err, other)
+	}
+}
+
+func TestRunInOverride(t *testing.T) {
+	isolate(t)
+	chdirTemp(t)
+	runIn := t.TempDir()
+	app := &App{Keyring: memStore{}, System: testFacts, Provider: answering("Run @run[pwd > where.txt]\n", func() {})}
+
+	r := runAppWith(t, app, Options{Args: []string{"where", "am", "i"}, Accessible: true, RunIn: runIn}, "1\n")
+	if r.code != 0 {
+		t.Fatalf("exit code %d, stderr %q", r.code, r.stderr)
+	}
+	if data, err := os.ReadFile(filepath.Join(runIn, "where.txt")); err != nil || strings.TrimSpace(string(data)) != runIn {
+		t.Errorf("where.txt = %q, %v, want the command run in --run-in %s", data, err, runIn)
+	}
+
+	// A --run-in directory that doesn't exist is refused before anything is asked
+	asked := false
+	app.Provider = answering("", func() { asked = true })
+	r = runAppWith(t, app, Options{Args: []string{"where", "am", "i"}, Accessible: true, RunIn: filepath.Join(runIn, "missing")}, "")
+	if r.code != errs.ExitUsage || asked {
+		t.Errorf("exit code %d, asked %v with a missing --run-in directory, want %d before asking", r.code, asked, errs.ExitUsage)
+	}
+	if !strings.Contains(r.stderr, "Invalid --run-in directory") {
+		t.Errorf("stderr = %q, want the directory refused", r.stderr)
+	}
+}
+
+// A keyring that can't be read
+type brokenStore struct{}
+
+func (brokenStore) Read(field string) (string, error)     { return "", errors.New("the keyring is locked") }
+func (brokenStore) Save(field string, value string) error { return errors.New("the keyring is locked") }
+
+func TestDefaultMode(t *testing.T) {
+	tests := []struct {
+		name  string
+		store memStore
+		want  string
+		saved bool // The mode is saved as the default for the next runs
+		err   bool
+	}{
+		{name: "saved mode", store: memStore{"MODE_DEFAULT": "remote", "OLLAMA_LOCAL": "true"}, want: "remote"},
+		{name: "nothing saved", store: memStore{}, want: "gemini", saved: true},
+		{name: "ollama local of older versions", store: memStore{"OLLAMA_LOCAL": "true"}, want: "local", saved: true},
+		{name: "ollama local off", store: memStore{"OLLAMA_LOCAL": "false"}, want: "gemini", saved: true},
+		{name: "broken ollama local", store: memStore{"OLLAMA_LOCAL": "yes please"}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, hadDefault := test.store["MODE_DEFAULT"]
+			got, err := (&App{Keyring: test.store}).defaultMode()
+			if test.err {
+				if err == nil {
+					t.Errorf("defaultMode() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Fatalf("defaultMode() = %q, %v, want %q", got, err, test.want)
+			}
+			if test.saved && (hadDefault || test.store["MODE_DEFAULT"] != test.want) {
+				t.Errorf("MODE_DEFAULT = %q, want %q saved", test.store["MODE_DEFAULT"], test.want)
+			}
+		})
+	}
+
+	if _, err := (&App{Keyring: brokenStore{}}).defaultMode(); err == nil {
+		t.Error("defaultMode() with a locked keyring succeeded")
+	}
+}
+
+// The run mode reaches the provider, from the saved settings or the flags
+func TestRunMode(t *testing.T) {
+	tests := []struct {
+		name  string
+		store memStore
+		opts  Options
+		want  string
+	}{
+		{"ollama local of older versions", memStore{"OLLAMA_LOCAL": "true"}, Options{}, "local"},
+		{"saved default", memStore{"MODE_DEFAULT": "remote"}, Options{}, "remote"},
+		{"-l over the saved default", memStore{"MODE_DEFAULT": "gemini"}, Options{Local: true}, "local"},
+		{"--gemini over ollama local", memStore{"OLLAMA_LOCAL": "true"}, Options{Gemini: true}, "gemini"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isolate(t)
+			var modes []string
+			app := &App{Keyring: test.store, System: testFacts, Provider: func(ctx context.Context, runMode string, parts prompt.Parts, send func(tearaw.Msg)) (string, error) {
+				modes = append(modes, runMode)
+				return "ok", nil
+			}}
+			opts := test.opts
+			opts.Args = []string{"hello"}
+			opts.Quiet = true
+			if r := runAppWith(t, app, opts, ""); r.code != 0 {
+				t.Fatalf("exit code %d, stderr %q", r.code, r.stderr)
+			}
+			if len(modes) != 1 || modes[0] != test.want {
+				t.Errorf("the provider was asked with %q, want %s", modes, test.want)
+			}
+		})
+	}
+}
+
+// Nothing of one run carries over to the next run of the same App
+func TestRunsDontShareState(t *testing.T) {
+	isolate(t)
+	replay(t, twoCommands)
+	app := &App{Keyring: memStore{}, System: testFacts}
+
+	r := runAppWith(t, app, Options{Args: []string{"find", "big", "files"}, JSON: true, NoCommands: true}, "")
+	var first jsonout.Result
+	if err := json.Unmarshal([]byte(r.stdout), &first); err != nil || len(first.Commands) != 0 {
+		t.Fatalf("--no-commands gave %q, %v, want no commands", r.stdout, err)
+	}
+
+	r = runAppWith(t, app, Options{Args: []string{"find", "big", "files"}, JSON: true}, "")
+	var second jsonout.Result
+	if err := json.Unmarshal([]byte(r.stdout), &second); err != nil || len(second.Commands) != 2 {
+		t.Errorf("the next run gave %q, %v, want its commands", r.stdout, err)
+	}
+}
+
+// Whatever an earlier run left in other packages, setup starts the next run from its own options and the settings
+func TestSetupResetsPackageState(t *testing.T) {
+	isolate(t)
+	commands.Target, commands.ConfirmEach, audit.Disabled, nag.ShowAll = "old-host", true, true, true
+	tea.SetAccessible(true)
+	temperature, maxTokens := 1.5, 100
+	gemini.SetSampling(&temperature, &maxTokens)
+
+	app := &App{Keyring: memStore{}, System: testFacts, Provider: answering("ok", func() {})}
+	s := app.newSession(Options{Args: []string{"hello"}})
+	done := redirect(t, "")
+	code, finished := s.setup()
+	done()
+	if finished {
+		t.Fatalf("setup() ended the run with %d", code)
+	}
+	if commands.Target != "" || commands.ConfirmEach || audit.Disabled || nag.ShowAll || tea.IsAccessible() {
+		t.Errorf("after setup Target = %q, ConfirmEach = %v, audit off = %v, ShowAll = %v, accessible = %v, want the defaults",
+			commands.Target, commands.ConfirmEach, audit.Disabled, nag.ShowAll, tea.IsAccessible())
+	}
+	if got := gemini.Settings(); got != "temperature=0.7 max_tokens=0" {
+		t.Errorf("gemini kept %s from the earlier run", got)
+	}
+	if len(s.g.ready) != 0 {
+		t.Errorf("providers %v are ready before this run set any up", s.g.ready)
+	}
+
+	// Settings decide where the flags don't
+	config.Set("confirm_each", "true")
+	config.Set("audit", "false")
+	s = app.newSession(Options{Args: []string{"hello"}, Target: "web1"})
+	done = redirect(t, "")
+	s.setup()
+	done()
+	if commands.Target != "web1" || !commands.ConfirmEach || !audit.Disabled {
+		t.Errorf("after setup Target = %q, ConfirmEach = %v, audit off = %v, want --target and the settings", commands.Target, commands.ConfirmEach, audit.Disabled)
+	}
+	commands.Target, commands.ConfirmEach, audit.Disabled = "", false, false
+}
+
+func TestSetupSteps(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		code  int
+		done  bool
+		check func(t *testing.T, s *session, store memStore)
+	}{
+		{name: "prompt", opts: Options{Args: []string{"find", "big", "files"}}, check: func(t *testing.T, s *session, store memStore) {
+			if s.runMode != "gemini" || !reflect.DeepEqual(s.args, []string{"find", "big", "files"}) {
+				t.Errorf("run mode %q, args %q, want gemini and the words", s.runMode, s.args)
+			}
+		}},
+		{name: "-l", opts: Options{Args: []string{"hi"}, Local: true}, check: func(t *testing.T, s *session, store memStore) {
+			if s.runMode != "local" {
+				t.Errorf("run mode %q, want local", s.runMode)
+			}
+		}},
+		{name: "summarize", opts: Options{Args: []string{"summarize", "briefly"}}, check: func(t *testing.T, s *session, store memStore) {
+			if !s.summarize || !s.g.noCommands || !reflect.DeepEqual(s.args, []string{"briefly"}) {
+				t.Errorf("summarize %v, no commands %v, args %q, want a summary without commands", s.summarize, s.g.noCommands, s.args)
+			}
+		}},
+		{name: "chat", opts: Options{Args: []string{"chat", "hello"}}, check: func(t *testing.T, s *session, store memStore) {
+			if !s.chatMode || !reflect.DeepEqual(s.args, []string{"hello"}) {
+				t.Errorf("chat %v, args %q, want chat with the rest as the prompt", s.chatMode, s.args)
+			}
+		}},
+		{name: "-q is headless", opts: Options{Args: []string{"hi"}, Quiet: true}, check: func(t *testing.T, s *session, store memStore) {
+			if !s.quiet || !s.headless || s.jsonMode {
+				t.Errorf("quiet %v, headless %v, json %v, want quiet and headless", s.quiet, s.headless, s.jsonMode)
+			}
+		}},
+		{name: "--race with --compare", opts: Options{Args: []string{"hi"}, Race: "gemini,local", Compare: "gemini,local"}, code: errs.ExitUsage, done: true},
+		{name: "--alternatives 8", opts: Options{Args: []string{"hi"}, Alternatives: 8}},
+		{name: "--alternatives 9", opts: Options{Args: []string{"hi"}, Alternatives: 9}, code: errs.ExitUsage, done: true},
+		{name: "--alternatives -1", opts: Options{Args: []string{"hi"}, Alternatives: -1}, code: errs.ExitUsage, done: true},
+		{name: "--no-commands with --fix-loop", opts: Options{Args: []string{"hi"}, NoCommands: true, FixLoop: true}, code: errs.ExitUsage, done: true},
+		{name: "--set-default", opts: Options{SetDefault: "remote"}, done: true, check: func(t *testing.T, s *session, store memStore) {
+			if store["MODE_DEFAULT"] != "remote" {
+				t.Errorf("MODE_DEFAULT = %q, want remote saved", store["MODE_DEFAULT"])
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isolate(t)
+			store := memStore{"MODE_DEFAULT": "gemini"}
+			s := (&App{Keyring: store, System: testFacts, Provider: answering("ok", func() {})}).newSession(test.opts)
+			done := redirect(t, "")
+			code, finished := s.setup()
+			done()
+			if finished != test.done || code != test.code {
+				t.Fatalf("setup() = %d, %v, want %d, %v", code, finished, test.code, test.done)
+			}
+			if test.check != nil {
+				test.check(t, s, store)
+			}
+		})
+	}
+}
+
+// Runs the steps before generating, failing the test when one ends the run
+func prepare(t *testing.T, s *session, stdin string) {
+	t.Helper()
+	done := redirect(t, stdin)
+	defer done()
+	for _, step := range []func() (int, bool){s.setup, s.input, s.provider} {
+		if code, finished := step(); finished {
+			t.Fatalf("the run ended before generating with %d", code)
+		}
+	}
+}
+
+func TestInputBuildsPrompt(t *testing.T) {
+	isolate(t)
+	dir := chdirTemp(t)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("disk is full again"), 0644)
+	app := &App{Keyring: memStore{"MODE_DEFAULT": "gemini"}, System: testFacts, Provider: answering("ok", func() {})}
+
+	s := app.newSession(Options{Args: []string{"explain", "@notes.txt"}})
+	prepare(t, s, "")
+	if !reflect.DeepEqual(s.words, []string{"explain"}) || !reflect.DeepEqual(s.fileRefs, []string{"notes.txt"}) {
+		t.Errorf("words %q, files %q, want the file taken out of the prompt", s.words, s.fileRefs)
+	}
+	if !strings.HasPrefix(s.userPrompt, "explain") || !strings.Contains(s.userPrompt, "disk is full again") {
+		t.Errorf("user prompt = %q, want the words and the attached file", s.userPrompt)
+	}
+	if s.sources.user != s.userPrompt || s.auditPrompt != "explain" {
+		t.Errorf("the prompt sources have %q and the audit log %q, want the user prompt and the words", s.sources.user, s.auditPrompt)
+	}
+
+	// A missing file fails before anything is asked
+	s = app.newSession(Options{Args: []string{"explain", "@missing.txt"}})
+	done := redirect(t, "")
+	s.setup()
+	code, finished := s.input()
+	done()
+	if !finished || code != errs.ExitUsage {
+		t.Errorf("input() with a missing file = %d, %v, want %d", code, finished, errs.ExitUsage)
+	}
+
+	// So does -q without a prompt
+	s = app.newSession(Options{Quiet: true})
+	done = redirect(t, "")
+	s.setup()
+	code, finished = s.input()
+	done()
+	if !finished || code != errs.ExitUsage {
+		t.Errorf("input() without a prompt = %d, %v, want %d", code, finished, errs.ExitUsage)
+	}
+}
+
+func TestProviderStep(t *testing.T) {
+	isolate(t)
+	dir := chdirTemp(t)
+	app := &App{Keyring: memStore{"MODE_DEFAULT": "remote"}, System: testFacts, Provider: answering("ok", func() {})}
+
+	s := app.newSession(Options{Args: []string{"hello"}})
+	prepare(t, s, "")
+	if !s.g.ready["remote"] || len(s.g.ready) != 1 {
+		t.Errorf("ready providers %v, want only the one of the run", s.g.ready)
+	}
+	if s.runDir != dir || s.sources.runDir != dir {
+		t.Errorf("run directory %q, want %q where lexido was started", s.runDir, dir)
+	}
+	if _, parts := s.sources.assemble(); !strings.Contains(parts.System, "testbox") {
+		t.Errorf("the system prompt %q doesn't have the facts of the machine", parts.System)
+	}
+
+	// Commands on another host run in its home directory, not in one of this machine
+	s = app.newSession(Options{Args: []string{"hello"}, Target: "web1", RunIn: dir})
+	done := redirect(t, "")
+	s.setup()
+	s.input()
+	code, finished := s.provider()
+	done()
+	if !finished || code != errs.ExitUsage {
+		t.Errorf("provider() with --target and --run-in = %d, %v, want %d", code, finished, errs.ExitUsage)
+	}
+}
+
+// What the closed TUI picked is run, saved or written without a TUI in the test
+func TestExecute(t *testing.T) {
+	isolate(t)
+	chdirTemp(t)
+	app := &App{Keyring: memStore{"MODE_DEFAULT": "gemini"}, System: testFacts, Provider: answering("ok", func() {})}
+	execute := func(opts Options, p picked) (*session, int, string) {
+		t.Helper()
+		opts.Args = []string{"make", "files"}
+		s := app.newSession(opts)
+		prepare(t, s, "")
+		s.runDir = t.TempDir()
+		done := redirect(t, "")
+		code, followUp := s.execute(p)
+		stdout, _ := done()
+		if followUp != nil {
+			t.Errorf("execute() asked a follow-up question without a terminal")
+		}
+		return s, code, stdout
+	}
+
+	s, code, _ := execute(Options{}, picked{response: "@run[pwd > where.txt]", cmds: []string{"pwd > where.txt"}})
+	if data, err := os.ReadFile(filepath.Join(s.runDir, "where.txt")); code != 0 || err != nil || strings.TrimSpace(string(data)) != s.runDir {
+		t.Errorf("execute() = %d, where.txt = %q, %v, want the command run in %s", code, data, err, s.runDir)
+	}
+	if !reflect.DeepEqual(s.ran, []string{"pwd > where.txt"}) || commands.Capture != nil {
+		t.Errorf("ran %q with the capture %v left, want the command recorded and the capture cleared", s.ran, commands.Capture)
+	}
+
+	s, code, _ = execute(Options{}, picked{response: "@run[false]", cmds: []string{"false"}})
+	if code != errs.ExitCommand+1 {
+		t.Errorf("execute() of a failing command = %d, want %d", code, errs.ExitCommand+1)
+	}
+
+	script := filepath.Join(t.TempDir(), "make.sh")
+	s, code, stdout := execute(Options{SaveScript: script}, picked{response: "@run[touch made.txt]", cmds: []string{"touch made.txt"}})
+	if data, err := os.ReadFile(script); code != 0 || err != nil || !strings.Contains(string(data), "touch made.txt") {
+		t.Errorf("execute() with --save-script = %d, the script has %q, %v, want the command", code, data, err)
+	}
+	if _, err := os.Stat(filepath.Join(s.runDir, "made.txt")); err == nil || !strings.Contains(stdout, "Saved 1 command(s)") {
+		t.Errorf("stdout %q, want the command saved and not run", stdout)
+	}
+
+	output := filepath.Join(t.TempDir(), "answer.md")
+	if _, code, _ := execute(Options{Output: output}, picked{response: "Nothing to run."}); code != 0 {
+		t.Errorf("execute() with -o = %d, want 0", code)
+	}
+	if data, err := os.ReadFile(output); err != nil || !strings.Contains(string(data), "Nothing to run.") {
+		t.Errorf("-o wrote %q, %v, want the response", data, err)
+	}
+}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
+	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+)
+
+// Sampling of the requests of a run, nil leaves the provider's default
+type sampling struct {
+	Temperature *float64
+	MaxTokens   *int
+}
+
+// Highest values the providers accept, larger ones are clamped. Remote APIs differ too much to know theirs.
+var samplingLimits = map[string]struct {
+	temperature float64
+	maxTokens   int
+}{
+	"gemini": {2, 8192},
+	"local":  {2, math.MaxInt32},
+}
+
+// Reads --temperature and --max-tokens, the temperature and max_tokens settings fill in the ones not given
+func samplingOptions(opts Options) (sampling, error) {
+	var s sampling
+	if opts.wasSet("temperature") {
+		if opts.Temperature < 0 {
+			return s, errs.Usagef("--temperature must be 0 or more")
+		}
+		s.Temperature = &opts.Temperature
+	} else if setting, err := config.Get("temperature"); err == nil {
+		t, err := strconv.ParseFloat(setting, 64)
+		if err != nil || t < 0 {
+			return s, fmt.Errorf("invalid temperature setting %q", setting)
+		}
+		s.Temperature = &t
+	}
+
+	if opts.wasSet("max-tokens") {
+		if opts.MaxTokens <= 0 {
+			return s, errs.Usagef("--max-tokens must be a positive number")
+		}
+		s.MaxTokens = &opts.MaxTokens
+	} else if setting, err := config.Get("max_tokens"); err == nil {
+		n, err := strconv.Atoi(setting)
+		if err != nil || n <= 0 {
+			return s, fmt.Errorf("invalid max_tokens setting %q", setting)
+		}
+		s.MaxTokens = &n
+	}
+	return s, nil
+}
+
+// Returns the sampling within the limits of the provider, with a warning for every value that was lowered
+func (s sampling) clamp(mode string) (sampling, []string) {
+	limits, ok := samplingLimits[mode]
+	if !ok {
+		return s, nil
+	}
+	var warnings []string
+	if s.Temperature != nil && *s.Temperature > limits.temperature {
+		warnings = append(warnings, fmt.Sprintf("%s takes a temperature of at most %g, using %g", providerLabel(mode), limits.temperature, limits.temperature))
+		t := limits.temperature
+		s.Temperature = &t
+	}
+	if s.MaxTokens != nil && *s.MaxTokens > limits.maxTokens {
+		warnings = append(warnings, fmt.Sprintf("%s answers with at most %d tokens, using %d", providerLabel(mode), limits.maxTokens, limits.maxTokens))
+		n := limits.maxTokens
+		s.MaxTokens = &n
+	}
+	return s, warnings
+}
+
+// Hands the sampling to every provider, fallbacks included. Only the clamping of the provider lexido runs with
+// is warned about.
+func applySampling(s sampling, runMode string) []string {
+	_, warnings := s.clamp(runMode)
+	g, _ := s.clamp("gemini")
+	gemini.SetSampling(g.Temperature, g.MaxTokens)
+	l, _ := s.clamp("local")
+	ollama.SetSampling(l.Temperature, l.MaxTokens)
+	remote.SetSampling(s.Temperature, s.MaxTokens)
+	return warnings
+}
+
+// Returns an error for a sampling flag the remote config has no placeholder for, it would be silently dropped otherwise.
+// Values from the settings are meant for every provider and don't fail a config without them.
+func remoteSamplingError(cfg remote.Config, opts Options) error {
+	if opts.wasSet("temperature") && !cfg.HasPlaceholder(remote.TemperaturePlaceholder) {
+		return errs.Usagef("--temperature needs a \"%s\" value in the data_template of the remote config", remote.TemperaturePlaceholder)
+	}
+	if opts.wasSet("max-tokens") && !cfg.HasPlaceholder(remote.MaxTokensPlaceholder) {
+		return errs.Usagef("--max-tokens needs a \"%s\" value in the data_template of the remote config", remote.MaxTokensPlaceholder)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/shellinit"
+)
+
+func shellInitCommand(args []string) int {
+	flags := flag.NewFlagSet("shell-init", flag.ContinueOnError)
+	commandNotFound := flags.Bool("command-not-found", false, "Also suggest how to install commands the shell can't find")
+	if err := flags.Parse(args); err != nil {
+		return errs.ExitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Println("Usage: lexido shell-init [--command-not-found] bash|zsh|fish")
+		return errs.ExitUsage
+	}
+
+	script, err := shellinit.Generate(flags.Arg(0), *commandNotFound)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return errs.ExitUsage
+	}
+	fmt.Print(script)
+	return 0
+}
@@ -0,0 +1,378 @@
+package app
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/audit"
+	"github.com/micr0-dev/lexido/pkg/cache"
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/shellinit"
+	"github.com/micr0-dev/lexido/pkg/stats"
+)
+
+// Subcommands are recognized as the first positional argument, e.g. `lexido config list`
+var subcommands = map[string]func(args []string) int{
+	"audit":      auditCommand,
+	"auth":       authCommand,
+	"cache":      cacheCommand,
+	"config":     configCommand,
+	"fav":        favCommand,
+	"history":    historyCommand,
+	"models":     modelsCommand,
+	"remote":     remoteCommand,
+	"shell-init": shellInitCommand,
+	"stats":      statsCommand,
+	"templates":  templatesCommand,
+}
+
+// Checks of the subcommands whose name often starts a prompt, e.g. `lexido config nginx as a reverse proxy`. A
+// subcommand listed here only runs when it is given alone or with arguments the check takes, other words are a prompt.
+var promptWords = map[string]func(args []string) bool{
+	"cache": func(args []string) bool {
+		return len(args) == 1 && args[0] == "clear"
+	},
+	"config": configTakes,
+	"edit":   editTakes,
+	// Extra instructions only make it `lexido fix` after a failed command, `lexido fix the permissions of ~/.ssh` is a prompt
+	"fix": func(args []string) bool {
+		_, status, err := shellinit.LastCommand()
+		return err == nil && status != 0
+	},
+	"history": historyTakes,
+	"remote": func(args []string) bool {
+		return (args[0] == "init" || args[0] == "test") && len(args) <= 2
+	},
+	// Flags such as --since are the stats, a word other than reset starts a prompt
+	"stats": func(args []string) bool {
+		return args[0] == "reset" && len(args) == 1 || strings.HasPrefix(args[0], "-")
+	},
+}
+
+// Reports whether args are the arguments of the subcommand name, not the rest of a prompt starting with it
+func isSubcommand(name string, args []string) bool {
+	takes, ok := promptWords[name]
+	return !ok || len(args) == 0 || takes(args)
+}
+
+func configTakes(args []string) bool {
+	switch args[0] {
+	case "list":
+		return len(args) == 1
+	case "get", "unset":
+		return len(args) == 2
+	case "set":
+		return len(args) == 3
+	}
+	return false
+}
+
+func configCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("Usage: lexido config list | get <key> | set <key> <value> | unset <key>")
+		return errs.ExitUsage
+	}
+
+	switch args[0] {
+	case "list":
+		for _, key := range config.Keys {
+			val, err := config.Get(key.Name)
+			if err != nil {
+				val = "(not set)"
+			} else if key.Secret {
+				val = config.Mask(val)
+			}
+			fmt.Printf("%-16s %-24s %s\n", key.Name, val, key.Description)
+		}
+		return 0
+	case "get":
+		if len(args) != 2 {
+			fmt.Println("Usage: lexido config get <key>")
+			return errs.ExitUsage
+		}
+		key, err := config.Lookup(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return errs.ExitUsage
+		}
+		val, err := config.Get(key.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s is not set\n", key.Name)
+			return errs.ExitFailure
+		}
+		if key.Secret {
+			val = config.Mask(val)
+		}
+		fmt.Println(val)
+		return 0
+	case "set":
+		if len(args) != 3 {
+			fmt.Println("Usage: lexido config set <key> <value>")
+			return errs.ExitUsage
+		}
+		if err := config.Set(args[1], args[2]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		fmt.Printf("%s set.\n", args[1])
+		return 0
+	case "unset":
+		if len(args) != 2 {
+			fmt.Println("Usage: lexido config unset <key>")
+			return errs.ExitUsage
+		}
+		if err := config.Unset(args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCode(err)
+		}
+		fmt.Printf("%s unset.\n", args[1])
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown config command %q. Use list, get, set, or unset.\n", args[0])
+		return errs.ExitUsage
+	}
+}
+
+func cacheCommand(args []string) int {
+	if len(args) != 1 || args[0] != "clear" {
+		fmt.Println("Usage: lexido cache clear")
+		return errs.ExitUsage
+	}
+	n, err := cache.Clear()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to clear the response cache: %v\n", err)
+		return errs.ExitFailure
+	}
+	fmt.Printf("Removed %d cached response(s).\n", n)
+	return 0
+}
+
+func historyTakes(args []string) bool {
+	switch args[0] {
+	case "clear":
+		return len(args) == 1
+	case "show":
+		return len(args) == 1 || len(args) == 2 && strings.HasPrefix(args[1], "-")
+	}
+	return false
+}
+
+func historyCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("Usage: lexido history show [--json] | clear")
+		return errs.ExitUsage
+	}
+
+	switch args[0] {
+	case "clear":
+		if err := io.ClearConversationCache(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to clear the conversation cache: %v\n", err)
+			return errs.ExitFailure
+		}
+		fmt.Println("Conversation cache cleared.")
+		return 0
+	case "show":
+		flags := flag.NewFlagSet("history show", flag.ContinueOnError)
+		asJSON := flags.Bool("json", false, "Print the conversation as JSON")
+		if err := flags.Parse(args[1:]); err != nil {
+			return errs.ExitUsage
+		}
+		if flags.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, "Only the current conversation is cached, sessions are not supported.")
+			return errs.ExitUsage
+		}
+
+		turns, err := io.LoadConversation()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read the conversation cache: %v\n", err)
+			return errs.ExitFailure
+		}
+
+		if *asJSON {
+			if turns == nil {
+				turns = []io.Turn{}
+			}
+			out, _ := json.MarshalIndent(turns, "", "  ")
+			fmt.Println(string(out))
+			return 0
+		}
+
+		if len(turns) == 0 {
+			fmt.Println("The conversation cache is empty.")
+			return 0
+		}
+		for _, turn := range turns {
+			header := "[" + strings.ToUpper(turn.Role) + "]"
+			if !turn.Timestamp.IsZero() {
+				header += " " + turn.Timestamp.Local().Format("2006-01-02 15:04")
+			}
+			if turn.Provider != "" {
+				header += " " + turn.Provider
+			}
+			fmt.Printf("%s\n%s\n", header, turn.Content)
+			for _, cmd := range turn.CommandsRun {
+				fmt.Printf("  ran: %s\n", cmd)
+			}
+			fmt.Println()
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown history command %q. Use show or clear.\n", args[0])
+		return errs.ExitUsage
+	}
+}
+
+func statsCommand(args []string) int {
+	if len(args) > 0 && args[0] == "reset" {
+		if err := stats.Reset(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to reset the stats: %v\n", err)
+			return errs.ExitFailure
+		}
+		fmt.Println("Usage stats reset.")
+		return 0
+	}
+
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Print the stats as JSON")
+	sinceFlag := flags.String("since", "", "Only count the activity of this time window, e.g. 7d, 2w, 12h or 2024-05-01")
+	if err := flags.Parse(args); err != nil {
+		return errs.ExitUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Println("Usage: lexido stats [--since 7d] [--json] | reset")
+		return errs.ExitUsage
+	}
+	var since time.Time
+	if *sinceFlag != "" {
+		var err error
+		if since, err = stats.ParseSince(*sinceFlag, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return errs.ExitUsage
+		}
+	}
+
+	s, err := stats.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the stats: %v\n", err)
+		return errs.ExitFailure
+	}
+	activities, err := stats.LoadActivity(since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the activity log: %v\n", err)
+		return errs.ExitFailure
+	}
+	// Commands that ran before the stats were reset don't count either
+	from := since
+	if from.IsZero() {
+		from = s.Since
+	}
+	executed, err := audit.Since(from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the audit log: %v\n", err)
+		return errs.ExitFailure
+	}
+	report := stats.NewReport(since, activities, executed)
+
+	// The totals of stats.json go back further than the activity log, a time window can only be counted from the latter
+	entries := s.Sorted()
+	if !since.IsZero() {
+		entries = stats.Totals(activities)
+	} else {
+		report.Since = s.Since
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(struct {
+			stats.Report
+			Usage []*stats.Entry `json:"usage"`
+		}{report, entries}, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+
+	if len(entries) == 0 && len(report.Providers) == 0 {
+		fmt.Println("No requests recorded yet.")
+		return 0
+	}
+
+	var total stats.Entry
+	estimated, unpriced := false, false
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROVIDER\tMODEL\tREQUESTS\tPROMPT\tRESPONSE\tCOST")
+	for _, e := range entries {
+		cost := stats.FormatCost(e.Cost)
+		if e.Unpriced == e.Requests {
+			cost = "*"
+			unpriced = true
+		} else if e.Unpriced > 0 {
+			cost += "*"
+			unpriced = true
+		}
+		model := e.Model
+		if model == "" {
+			model = "-"
+		}
+		tokens := ""
+		if e.Estimated > 0 {
+			tokens = "~"
+			estimated = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s%s\t%s%s\t%s\n", e.Provider, model, e.Requests, tokens, stats.FormatTokens(e.PromptTokens), tokens, stats.FormatTokens(e.ResponseTokens), cost)
+		total.Requests += e.Requests
+		total.PromptTokens += e.PromptTokens
+		total.ResponseTokens += e.ResponseTokens
+		total.Cost += e.Cost
+	}
+	fmt.Fprintf(w, "total\t\t%d\t%s\t%s\t%s\n", total.Requests, stats.FormatTokens(total.PromptTokens), stats.FormatTokens(total.ResponseTokens), stats.FormatCost(total.Cost))
+	w.Flush()
+
+	// How much of what was suggested ended up running
+	if len(report.Providers) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROVIDER\tPROMPTS\tSUGGESTED\tRAN\tFAILED\tRUN RATE\tTOKENS")
+		for _, u := range append(report.Providers, &report.Total) {
+			provider := u.Provider
+			if u == &report.Total {
+				provider = "total"
+			} else if provider == "" {
+				provider = "-"
+			}
+			tokens := stats.FormatTokens(u.Tokens)
+			if u.Estimated {
+				tokens = "~" + tokens
+				estimated = true
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d%%\t%s\n", provider, u.Prompts, u.Suggestions, u.Executed, u.Failed, u.RunRate(), tokens)
+		}
+		w.Flush()
+	}
+
+	if len(report.TopPrompts) > 0 {
+		fmt.Println("\nMost common prompts:")
+		for _, p := range report.TopPrompts {
+			fmt.Printf("%4d  %s\n", p.Count, p.Prompt)
+		}
+	}
+
+	if !since.IsZero() {
+		fmt.Printf("\nSince %s.", since.Local().Format("2006-01-02 15:04"))
+	} else if !s.Since.IsZero() {
+		fmt.Printf("\nSince %s.", s.Since.Local().Format("2006-01-02"))
+	}
+	if estimated {
+		fmt.Print(" ~ marks tokens estimated from the text, the provider doesn't report them.")
+	}
+	if unpriced {
+		fmt.Print(" * marks models without a known price, set them with lexido config set prices.")
+	}
+	fmt.Println()
+	return 0
+}
@@ -0,0 +1,11 @@
+package app
+
+import "github.com/micr0-dev/lexido/pkg/commands"
+
+// Returns the commands suggested in the response, none with --no-commands
+func (g *generator) suggestedCommands(response string) []string {
+	if g.noCommands {
+		return nil
+	}
+	return commands.ParseCommands(response)
+}
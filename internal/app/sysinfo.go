@@ -0,0 +1,217 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/ssh"
+	"golang.org/x/sync/errgroup"
+)
+
+// Facts about the user's system the prompt is built with
+type Facts struct {
+	Username        string
+	Hostname        string
+	Cwd             string
+	OperatingSystem string // macOS, the Linux distribution, or the Windows version
+	PackageManagers []string
+	GNUTools        []string // GNU replacements for the BSD tools of macOS
+	Environment     io.Environment
+}
+
+// SystemInfo collects the facts, refresh skips facts cached by earlier runs
+type SystemInfo interface {
+	Collect(refresh bool) Facts
+}
+
+// How long the operating system and package managers are cached, they rarely change
+const sysinfoTTL = 24 * time.Hour
+
+// File of the cache dir the slow facts are kept in
+const sysinfoFile = "sysinfo.json"
+
+type cachedFacts struct {
+	Created         time.Time `json:"created"`
+	OperatingSystem string    `json:"operating_system"`
+	PackageManagers []string  `json:"package_managers"`
+	GNUTools        []string  `json:"gnu_tools,omitempty"`
+}
+
+// The machine lexido runs on, facts that can't be found are Unknown
+type localSystem struct{}
+
+func (localSystem) Collect(refresh bool) Facts {
+	// Reading a few files in /proc is cheap, and an SSH session changes from one run to the next, so these aren't cached
+	facts := Facts{Username: io.Username(), Cwd: workingDir(), Environment: io.DetectEnvironment()}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Println(err)
+		hostname = "Unknown"
+	}
+	facts.Hostname = hostname
+
+	if cached, ok := readCachedFacts(); ok && !refresh {
+		facts.OperatingSystem = cached.OperatingSystem
+		facts.PackageManagers = cached.PackageManagers
+		facts.GNUTools = cached.GNUTools
+		return facts
+	}
+
+	// hostnamectl and sw_vers are the slow part, the package managers and GNU tools are looked up meanwhile
+	var g errgroup.Group
+	g.Go(func() error {
+		facts.OperatingSystem = io.OperatingSystem()
+		return nil
+	})
+	g.Go(func() error {
+		facts.PackageManagers = io.DetectPackageManagers()
+		facts.GNUTools = io.DetectGNUTools()
+		return nil
+	})
+	g.Wait()
+
+	writeCachedFacts(cachedFacts{Created: time.Now(), OperatingSystem: facts.OperatingSystem, PackageManagers: facts.PackageManagers, GNUTools: facts.GNUTools})
+	return facts
+}
+
+// Returns the current working directory, Unknown when it can't be found
+func workingDir() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Println(err)
+		return "Unknown"
+	}
+	return cwd
+}
+
+func readCachedFacts() (cachedFacts, bool) {
+	var cached cachedFacts
+	path, err := io.GetFilePath(io.Cache, sysinfoFile)
+	if err != nil {
+		return cached, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cached, false
+	}
+	if err := json.Unmarshal(data, &cached); err != nil || time.Since(cached.Created) > sysinfoTTL || cached.OperatingSystem == "" {
+		return cached, false
+	}
+	return cached, true
+}
+
+func writeCachedFacts(cached cachedFacts) {
+	path, err := io.GetFilePath(io.Cache, sysinfoFile)
+	if err == nil {
+		var data []byte
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+		if err == nil {
+			data, err = json.Marshal(cached)
+		}
+		if err == nil {
+			err = os.WriteFile(path, data, 0600)
+		}
+	}
+	if err != nil {
+		logging.Warnf("Error caching the system facts: %v", err)
+	}
+}
+
+// Returns the pre-prompt describing the system, runDir is where the suggested commands will run
+func systemPrompt(facts Facts, runDir string) string {
+	pre_prompt := prompt.DefaultPrePrompt
+	pre_prompt += " The user, " + facts.Username + ", is currently running " + facts.OperatingSystem + " on " + facts.Hostname + " in " + facts.Cwd + "."
+	if runDir != facts.Cwd {
+		pre_prompt += " The suggested commands will be run in " + runDir + "."
+	}
+	pre_prompt += " The user has the following package managers installed: " + strings.Join(facts.PackageManagers, ", ") + "."
+	pre_prompt += prompt.EnvironmentContext(facts.Environment)
+	if strings.HasPrefix(facts.OperatingSystem, "macOS") {
+		pre_prompt += prompt.BSDUserland(facts.GNUTools)
+	}
+	return pre_prompt
+}
+
+// Prints the facts of a remote host as key=value lines, it runs with sh so any login shell works
+var remoteFactsScript = `echo "user=$(id -un)"
+echo "host=$(hostname 2>/dev/null || uname -n)"
+echo "cwd=$(pwd)"
+if [ "$(uname -s)" = Darwin ]; then
+	echo "os=macOS $(sw_vers -productVersion)"
+elif [ -r /etc/os-release ]; then
+	. /etc/os-release
+	echo "os=${PRETTY_NAME:-$NAME}"
+else
+	echo "os=$(uname -s)"
+fi
+for pm in ` + strings.Join(io.UnixPackageManagers, " ") + `; do
+	command -v "$pm" >/dev/null 2>&1 && echo "pm=$pm"
+done
+echo "procversion=$(cat /proc/version 2>/dev/null)"
+echo "cgroup=$(tr '\n' ' ' </proc/1/cgroup 2>/dev/null)"
+echo "init=$(cat /proc/1/comm 2>/dev/null)"
+[ -f /.dockerenv ] && echo dockerenv=1
+[ -f /run/.containerenv ] && echo containerenv=1
+exit 0`
+
+// The host of --target, its facts are gathered over ssh on every run and never cached with the local ones
+type remoteSystem struct {
+	target string
+}
+
+func (r remoteSystem) Collect(refresh bool) Facts {
+	out, err := ssh.Output(r.target, remoteFactsScript)
+	if err != nil {
+		log.Printf("Warning: Could not gather the facts of %s: %v\n", r.target, err)
+	}
+	return parseRemoteFacts(out)
+}
+
+// Parses the output of remoteFactsScript, facts that are missing are Unknown
+func parseRemoteFacts(out string) Facts {
+	facts := Facts{Username: "Unknown", Hostname: "Unknown", Cwd: "Unknown", OperatingSystem: "Unknown"}
+	var procVersion, cgroup string
+	var dockerenv, containerenv bool
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		value = strings.TrimSpace(value)
+		if !ok || value == "" {
+			continue
+		}
+		switch key {
+		case "user":
+			facts.Username = value
+		case "host":
+			facts.Hostname = value
+		case "cwd":
+			facts.Cwd = value
+		case "os":
+			facts.OperatingSystem = value
+		case "pm":
+			facts.PackageManagers = append(facts.PackageManagers, value)
+		case "procversion":
+			procVersion = value
+		case "cgroup":
+			cgroup = value
+		case "init":
+			facts.Environment.Init = io.InitSystem(value)
+		case "dockerenv":
+			dockerenv = true
+		case "containerenv":
+			containerenv = true
+		}
+	}
+	facts.Environment.WSL = io.IsWSL(procVersion, "")
+	facts.Environment.Container = io.ContainerRuntime(dockerenv, containerenv, "", "", cgroup)
+	// The commands reach the host over SSH, whatever the session there looks like
+	facts.Environment.SSH = true
+	return facts
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// Puts scripts named after commands first on PATH, so a test decides how they behave
+func fakeCommands(t *testing.T, scripts map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCollectWithSlowCommands(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the operating system is read with hostnamectl on Linux only")
+	}
+	isolate(t)
+
+	// hostnamectl hanging, e.g. on a machine where systemd-hostnamed doesn't answer
+	fakeCommands(t, map[string]string{"hostnamectl": "sleep 5"})
+	timeout := io.CommandTimeout
+	io.CommandTimeout = 200 * time.Millisecond
+	defer func() { io.CommandTimeout = timeout }()
+
+	start := time.Now()
+	facts := localSystem{}.Collect(true)
+	elapsed := time.Since(start)
+
+	if limit := io.CommandTimeout + time.Second; elapsed > limit {
+		t.Errorf("a cold start took %s with hostnamectl hanging, want at most %s", elapsed, limit)
+	}
+	if facts.OperatingSystem != "Linux" {
+		t.Errorf("OperatingSystem = %q, want the plain Linux fallback", facts.OperatingSystem)
+	}
+	if facts.Cwd == "" || facts.Hostname == "" {
+		t.Errorf("facts = %+v, want the cheap facts gathered anyway", facts)
+	}
+}
+
+func TestCollectUsesTheCache(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the operating system is read with hostnamectl on Linux only")
+	}
+	isolate(t)
+
+	fakeCommands(t, map[string]string{"hostnamectl": `echo "  Operating System: Test Linux 1.0"`})
+	first := localSystem{}.Collect(false)
+	if first.OperatingSystem != "Test Linux 1.0" {
+		t.Fatalf("OperatingSystem = %q, want the one of hostnamectl", first.OperatingSystem)
+	}
+
+	// A later run reads the cache instead of asking hostnamectl again, --refresh-sysinfo asks anyway
+	fakeCommands(t, map[string]string{"hostnamectl": `echo "  Operating System: Other Linux 2.0"`})
+	if cached := (localSystem{}).Collect(false); cached.OperatingSystem != "Test Linux 1.0" {
+		t.Errorf("OperatingSystem = %q, want the cached one", cached.OperatingSystem)
+	}
+	if refreshed := (localSystem{}).Collect(true); refreshed.OperatingSystem != "Other Linux 2.0" {
+		t.Errorf("OperatingSystem = %q with refresh, want the one hostnamectl reports now", refreshed.OperatingSystem)
+	}
+}
+
+func TestParseRemoteFacts(t *testing.T) {
+	out := "user=deploy\nhost=web1\ncwd=/home/deploy\nos=Debian GNU/Linux 12 (bookworm)\npm=apt\npm=snap\n" +
+		"procversion=Linux version 6.1.0-18-amd64\ncgroup=0::/init.scope \ninit=systemd\n"
+	facts := parseRemoteFacts(out)
+	if facts.Username != "deploy" || facts.Hostname != "web1" || facts.Cwd != "/home/deploy" || facts.OperatingSystem != "Debian GNU/Linux 12 (bookworm)" {
+		t.Errorf("facts = %+v", facts)
+	}
+	if len(facts.PackageManagers) != 2 || facts.Environment.Init != "systemd" || !facts.Environment.SSH || facts.Environment.Container != "" {
+		t.Errorf("facts = %+v", facts)
+	}
+
+	if empty := parseRemoteFacts(""); empty.OperatingSystem != "Unknown" || empty.Username != "Unknown" {
+		t.Errorf("facts of no output = %+v, want Unknown", empty)
+	}
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/templates"
+)
+
+// Names of the templates, for completion
+func templateNames() []string {
+	list, _ := templates.List()
+	var names []string
+	for _, t := range list {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func templatesCommand(args []string) int {
+	if len(args) != 1 || args[0] != "list" {
+		fmt.Println("Usage: lexido templates list")
+		return errs.ExitUsage
+	}
+
+	list, err := templates.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list the templates: %v\n", err)
+		return errs.ExitFailure
+	}
+	if len(list) == 0 {
+		dir, _ := templates.Dir()
+		fmt.Printf("No templates yet, add one as %s.\n", dir+string(os.PathSeparator)+"<name>.tmpl")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, t := range list {
+		fmt.Fprintf(w, "%s\t%s\n", t.Name, t.Description)
+	}
+	w.Flush()
+	return 0
+}
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/update"
+)
+
+// How long downloading a release may take
+const updateTimeout = 5 * time.Minute
+
+// How long -v waits for the newest version before leaving the note out
+const versionCheckTimeout = 3 * time.Second
+
+const updateUsage = "Usage: lexido update [--check]"
+
+// `lexido update` replaces the running binary with the newest release, --check only says whether there is one
+func updateCommand(version string, args []string) int {
+	flags := flag.NewFlagSet("update", flag.ContinueOnError)
+	check := flags.Bool("check", false, "Only check for a newer version")
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		fmt.Println(updateUsage)
+		return errs.ExitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+
+	release, err := update.Latest(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not look up the newest release: %v\n", err)
+		return exitCode(err)
+	}
+	if !update.Newer(release.Version, version) {
+		fmt.Printf("lexido %s is the newest version.\n", version)
+		return 0
+	}
+	if *check {
+		fmt.Printf("A newer version (%s) is available, you have %s. Run lexido update to install it.\n", release.Version, version)
+		return 0
+	}
+
+	exe, err := update.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not find the lexido binary: %v\n", err)
+		return errs.ExitFailure
+	}
+
+	// The new binary is downloaded next to the old one so it can be renamed over it, or to the temp dir
+	// when that directory needs root
+	dir := filepath.Dir(exe)
+	writable := update.Writable(dir)
+	if !writable {
+		dir = os.TempDir()
+	}
+
+	fmt.Printf("Downloading lexido %s...\n", release.Version)
+	path, err := update.Download(ctx, release, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Update failed: %v\n", err)
+		return exitCode(err)
+	}
+
+	if !writable {
+		fmt.Printf("Downloaded and verified lexido %s to %s, but %s can't be written.\n", release.Version, path, filepath.Dir(exe))
+		fmt.Printf("Install it with: sudo mv %s %s\n", path, exe)
+		return errs.ExitFailure
+	}
+	if err := update.Replace(exe, path); err != nil {
+		os.Remove(path)
+		fmt.Fprintf(os.Stderr, "Could not replace %s: %v\n", exe, err)
+		return errs.ExitFailure
+	}
+	fmt.Printf("Updated lexido from %s to %s.\n", version, release.Version)
+	return 0
+}
+
+// Returns a note about a newer release for -v when the update_check setting is on. GitHub is asked at most
+// once a day, and a failed or slow check leaves the note out.
+func newerVersionNote(version string) string {
+	setting, err := config.Get("update_check")
+	if err != nil {
+		return ""
+	}
+	if enabled, _ := strconv.ParseBool(setting); !enabled {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), versionCheckTimeout)
+	defer cancel()
+	latest, err := update.LatestCached(ctx)
+	if err != nil || !update.Newer(latest, version) {
+		return ""
+	}
+	return fmt.Sprintf("A newer version (%s) is available, run lexido update to install it.", latest)
+}
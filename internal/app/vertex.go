@@ -0,0 +1,64 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/config"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/llms/gemini"
+)
+
+// Offers Vertex AI when there is no API key but Application Default Credentials are, asking for the project and
+// location and saving them. Reports whether Gemini should be used through Vertex AI.
+func offerVertex() (bool, error) {
+	reader := bufio.NewReader(os.Stdin)
+	ask := func(question string, fallback string) (string, error) {
+		fmt.Print(question)
+		answer, err := reader.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" && err != nil {
+			return "", fmt.Errorf("error reading answer: %w", err)
+		}
+		if answer == "" {
+			return fallback, nil
+		}
+		return answer, nil
+	}
+
+	fmt.Println("No API key found, but Application Default Credentials are set up.")
+	answer, err := ask("Use Gemini through Vertex AI instead? [Y/n] ", "y")
+	if err != nil {
+		return false, err
+	}
+	if !strings.EqualFold(answer[:1], "y") {
+		return false, nil
+	}
+
+	project := gemini.ADCProject()
+	question := "GCP project: "
+	if project != "" {
+		question = fmt.Sprintf("GCP project [%s]: ", project)
+	}
+	if project, err = ask(question, project); err != nil {
+		return false, err
+	}
+	if project == "" {
+		return false, errs.Wrap(errs.ErrAuth, errors.New("a GCP project is needed for Vertex AI"))
+	}
+	location, err := ask(fmt.Sprintf("Location [%s]: ", gemini.DefaultLocation), gemini.DefaultLocation)
+	if err != nil {
+		return false, err
+	}
+
+	for _, setting := range [][2]string{{"gcp_project", project}, {"gcp_location", location}, {"gemini_auth", "vertex"}} {
+		if err := config.Set(setting[0], setting[1]); err != nil {
+			return false, fmt.Errorf("error saving %s: %w", setting[0], err)
+		}
+	}
+	fmt.Print("Gemini set to run through Vertex AI for future sessions, switch back with lexido config set gemini_auth key. \n\n")
+	return true, nil
+}
@@ -1,406 +1,147 @@
 package main
 
 import (
-	"bufio"
-	"errors"
+	"context"
 	"flag"
-	"fmt"
-	"log"
 	"os"
-	"strconv"
 	"strings"
-	"sync"
-
-	"github.com/micr0-dev/lexido/pkg/commands"
-	"github.com/micr0-dev/lexido/pkg/io"
-	gemini "github.com/micr0-dev/lexido/pkg/llms/gemini"
-	ollama "github.com/micr0-dev/lexido/pkg/llms/ollama"
-	"github.com/micr0-dev/lexido/pkg/llms/remote"
-	"github.com/micr0-dev/lexido/pkg/prompt"
-	"github.com/micr0-dev/lexido/pkg/tea"
-	"google.golang.org/api/googleapi"
-	"google.golang.org/api/iterator"
-
-	tearaw "github.com/charmbracelet/bubbletea"
-)
 
-var p *tearaw.Program
+	"github.com/micr0-dev/lexido/internal/app"
+)
 
 const version = "1.4.2" // Program version
 
 func main() {
-	helpPtr := flag.Bool("help", false, "Display help information")
-	hPtr := flag.Bool("h", false, "Display help information")
-	cPtr := flag.Bool("c", false, "Continue previous conversation")
-	vPtr := flag.Bool("v", false, "Display version information")
-	versionPtr := flag.Bool("version", false, "Display version information")
-
-	gPtr := flag.Bool("g", false, "Utilize Gemini LLM")
-
-	lPtr := flag.Bool("l", false, "Utilize a local LLM via ollama")
-	mPtr := flag.String("m", "", "Specify the model to use with ollama, only required if -l is used")
-
-	rPtr := flag.Bool("r", false, "Utilize a remote REST Api LLM as per the configuration file")
-
-	setMPtr := flag.String("setModel", "", "Set the default model to use with ollama")
-	setDPtr := flag.String("setDefault", "", "Set the default mode for lexido (gemini/local/remote)")
-
-	flag.Parse()
-
-	if *helpPtr || *hPtr {
-		io.DisplayHelp()
-		os.Exit(0)
-	}
-
-	if *vPtr || *versionPtr {
-		io.DisplayVersion(version)
-		os.Exit(0)
-	}
-
-	if *setDPtr != "" {
-		if *setDPtr != "gemini" && *setDPtr != "local" && *setDPtr != "remote" {
-			fmt.Println("Invalid default mode. Please use 'gemini', 'local', or 'remote'.")
-			os.Exit(1)
-		} else {
-			err := io.SaveToKeyring("MODE_DEFAULT", *setDPtr)
-			if err != nil {
-				log.Printf("Error saving default mode: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Printf("Default mode set to %s.\n", *setDPtr)
-			os.Exit(0)
-		}
-	}
-
-	runMode, err := io.ReadFromKeyring("MODE_DEFAULT")
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			// Check for deprecated ollama local
-			wasLocal := false
-			ollamaLocal, err := io.ReadFromKeyring("OLLAMA_LOCAL")
-
-			if err != nil {
-				if strings.Contains(err.Error(), "not found") {
-					wasLocal = false
-				} else if strings.Contains(err.Error(), "no such file or directory") {
-					wasLocal = false
-				} else {
-					log.Printf("Error reading local: %v\n", err)
-					os.Exit(1)
-				}
-			} else {
-				wasLocal, err = strconv.ParseBool(ollamaLocal)
-				if err != nil {
-					log.Printf("Error reading local: %v\n", err)
-					os.Exit(1)
-				}
-			}
-
-			if wasLocal {
-				err = io.SaveToKeyring("MODE_DEFAULT", "local")
-				runMode = "local"
-			} else {
-				err = io.SaveToKeyring("MODE_DEFAULT", "gemini")
-				runMode = "gemini"
-			}
-			if err != nil {
-				log.Printf("Error saving model: %v\n", err)
-				os.Exit(1)
-			}
-		} else if strings.Contains(err.Error(), "no such file or directory") {
-			err = io.SaveToKeyring("MODE_DEFAULT", "gemini")
-			runMode = "gemini"
-			if err != nil {
-				log.Printf("Error saving mode: %v\n", err)
-				os.Exit(1)
-			}
-		} else {
-			log.Printf("Error reading mode: %v\n", err)
-			os.Exit(1)
-		}
-	}
-
-	if *lPtr {
-		runMode = "local"
-	} else if *rPtr {
-		runMode = "remote"
-	} else if *gPtr {
-		runMode = "gemini"
-	}
-
-	_, err = io.ReadFromKeyring("OLLAMA_MODEL")
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			err = io.SaveToKeyring("OLLAMA_MODEL", "llama3")
-			if err != nil {
-				log.Printf("Error saving model: %v\n", err)
-				os.Exit(1)
-			}
-		} else if strings.Contains(err.Error(), "no such file or directory") {
-			err = io.SaveToKeyring("OLLAMA_MODEL", "llama3")
-			if err != nil {
-				log.Printf("Error saving model: %v\n", err)
-				os.Exit(1)
-			}
-		} else {
-			log.Printf("Error reading model: %v\n", err)
-			os.Exit(1)
-		}
-	}
-	if *setMPtr != "" {
-		err := io.SaveToKeyring("OLLAMA_MODEL", *setMPtr)
-		if err != nil {
-			log.Printf("Error saving model: %v\n", err)
-			os.Exit(1)
-		}
-	}
-
-	if runMode == "gemini" {
-
-		// Access your API key from keyring or environment variable (backwards compatible with previous versions)
-		apiKey := os.Getenv("GOOGLE_AI_KEY")
-
-		if apiKey == "" {
-			apiKey, _ = io.ReadFromKeyring("GOOGLE_AI_KEY")
-		}
-
-		// If no API key is found, prompt the user to enter it
-		if apiKey == "" {
-			fmt.Println("No API key found.")
-			fmt.Println("Please visit https://aistudio.google.com/app/apikey to obtain your API key.")
-			fmt.Print("Enter your API key here: ")
-
-			scanner := bufio.NewScanner(os.Stdin)
-			if scanner.Scan() {
-				apiKey = scanner.Text()
-
-				// Check if the API key is valid
-				isValid, err := gemini.IsKeyValid(apiKey)
-				if !isValid {
-					fmt.Println("Invalid API key. Please try again.")
-					os.Exit(1)
-				} else if err != nil {
-					log.Printf("Error validating API key: %v\n", err)
-					os.Exit(1)
-				}
-
-				os.Setenv("GOOGLE_AI_KEY", apiKey)
-				if err := io.SaveToKeyring("GOOGLE_AI_KEY", apiKey); err != nil {
-					fmt.Println("Failed to automatically append the API key to keyring. Please add the following line to your .bashrc, .zshrc, or equivalent file manually (replace the {API_KEY_HERE} with your API key):")
-					fmt.Println("export GOOGLE_AI_KEY={API_KEY_HERE}")
-				} else {
-					fmt.Print("API key set successfully for future sessions. \n\n")
-				}
-			} else if scanner.Err() != nil {
-				log.Printf("Error reading API key: %v\n", scanner.Err())
-				os.Exit(1)
-			}
-		}
-
-		err = gemini.Setup(apiKey)
-		if err != nil {
-			log.Printf("Error setting up gemini: %v\n", err)
-			os.Exit(1)
-		}
-	} else if runMode == "local" {
-		model := *mPtr
-		if *mPtr == "" {
-			model, err = io.ReadFromKeyring("OLLAMA_MODEL")
-			if err != nil {
-				log.Printf("Error reading model: %v\n", err)
-				os.Exit(1)
-			}
-		}
-
-		err := ollama.Init(model)
-		if err != nil {
-			log.Printf("Error initializing ollama: %v\n", err)
-			os.Exit(1)
-		}
-	}
-
-	// Read piped input if present
-	pipedInput, err := io.ReadPipedInput()
-	if err != nil {
-		log.Printf("Failed to read piped input: %v\n", err)
-		pipedInput = ""
-	}
-
-	var text_prompt string
-
-	if *cPtr {
-		// Read previous conversation from cache if -c is present
-		cachedConversation, err := io.ReadConversationCache()
-		if err != nil {
-			log.Printf("Warning: Could not read cache. Starting a new conversation. Error: %v\n", err)
-		}
-		text_prompt = cachedConversation + "\n"
-	}
-
-	text_prompt += strings.Join(flag.Args(), " ")
-
-	if text_prompt == "" {
-		text_prompt = "The user did not provide a prompt."
-	}
-
-	// Append piped input to the prompt if available
-	if pipedInput != "" {
-		text_prompt += "\n\nUser also attached via pipe the following input:\n" + pipedInput
-	}
-
-	// Get some information about the user's system
-	// Get the user's username
-	username := "Unknown"
-	userpath, err := os.UserHomeDir()
-	if err != nil {
-		log.Println(err)
-	} else {
-		username = userpath[strings.LastIndex(userpath, "/")+1:]
-	}
-
-	// Get the user's hostname
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Println(err)
-		hostname = "Unknown"
-	}
-
-	// Get the user's current working directory
-	cwd, err := os.Getwd()
-	if err != nil {
-		log.Println(err)
-		cwd = "Unknown"
-	}
-
-	// Detect Operating System (MacOS or Linux)
-	osname, err := io.RunCmd("uname", "-s")
-	if err != nil {
-		log.Println(err)
-		osname = "Unknown"
-	}
-
-	var opperatingSystem string
-
-	if strings.Contains(strings.ToLower(osname), "darwin") {
-		opperatingSystem = "macOS"
-	} else {
-		// Get the user's full operating system if not MacOS
-		opperatingSystem, err = io.ExtractHostnameCtlValue("Operating System")
-		if err != nil {
-			log.Println(err)
-			opperatingSystem = "Linux"
-		}
-	}
-
-	pre_prompt := prompt.DefaultPrePrompt
-
-	// Set the default post-prompt
-	pre_prompt += " The user, " + username + ", is currently running " + opperatingSystem + " on " + hostname + " in " + cwd + "."
-
-	// Detect all installed package managers
-	installedManagers := io.DetectPackageManagers()
-	pre_prompt += " The user has the following package managers installed: " + strings.Join(installedManagers, ", ") + "."
-	str_prompt := pre_prompt + "\n User: " + text_prompt
-
-	// Run the Bubble Tea program
-
-	wg := &sync.WaitGroup{}
-
-	cmds := new([]string)
-
-	p = tearaw.NewProgram(tea.InitialModel(cmds, runMode == "local"))
-	wg.Add(1)
-
-	// Properly close the program if something goes wrong
-	defer p.Quit()
-
-	go func() {
-		defer wg.Done()
-		if _, err := p.Run(); err != nil {
-			log.Printf("Alas, there's been a Bubble Tea error: %v\n", err)
-			os.Exit(1)
-		}
-	}()
-
-	var responseContent string
-	if runMode == "gemini" {
-		iter := gemini.Generate(str_prompt)
-		for {
-			resp, err := iter.Next()
-			if err != nil {
-				if err == iterator.Done {
-					break // End of stream
-				}
-				log.Println("An error occurred:", err)
-
-				// Check if the error is due to safety filter activation
-				if strings.Contains(err.Error(), "FinishReasonSafety") {
-					fmt.Println("The content generation was blocked for safety reasons. Please try a different prompt.")
-					fmt.Println(resp.PromptFeedback.BlockReason.String())
-					os.Exit(1)
-				}
-
-				var gerr *googleapi.Error
-				if !errors.As(err, &gerr) {
-					log.Printf("error: %s\n", err)
-					os.Exit(1)
-				} else {
-					log.Printf("error details: %s\n", gerr)
-					os.Exit(1)
-				}
-
-				log.Println(err) // For any other type of error, terminate
-				os.Exit(1)
-			}
-
-			for _, part := range resp.Candidates[0].Content.Parts {
-				p.Send(tea.AppendResponseMsg(fmt.Sprintf("%v", part)))
-
-				responseContent += fmt.Sprintf("%v", part)
-			}
-		}
-	} else if runMode == "local" {
-		outputChan, err := ollama.GenerateContentStream(str_prompt)
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			return
-		}
-
-		for line := range outputChan {
-			responseContent += line
-			p.Send(tea.AppendResponseMsg(line))
-		}
-
-	} else if runMode == "remote" {
-		outputChan, err := remote.GenerateContentStream(str_prompt)
-		if err != nil {
-			if strings.Contains(err.Error(), "file not found") {
-				log.Println(err.Error())
-				os.Exit(1)
-			}
-			log.Printf("Error generating content remotely: %v\n", err)
-			os.Exit(1)
-		}
-
-		for line := range outputChan {
-			responseContent += line
-			p.Send(tea.AppendResponseMsg(line))
-		}
-
-	} else {
-		log.Println("Invalid mode. Please use 'gemini', 'local', or 'remote'.")
-		os.Exit(1)
-	}
-
-	p.Send(tea.GenerationDoneMsg{})
-
-	err = io.CacheConversation(text_prompt + "\n" + responseContent)
-	if err != nil {
-		log.Printf("Warning: Failed to cache conversation. Error: %v", err)
-	}
-
-	wg.Wait()
-
-	// Run the commands
-	commands.RunCommands(*cmds)
+	opts := app.Options{Version: version}
+
+	flag.BoolVar(&opts.Help, "help", false, "Display help information, lexido help <topic> shows a longer one")
+	flag.BoolVar(&opts.Help, "h", false, "Display help information, lexido help <topic> shows a longer one")
+	flag.BoolVar(&opts.Continue, "c", false, "Continue with a previous prompt or add more details to it")
+	flag.BoolVar(&opts.ShowVersion, "v", false, "Display version information")
+	flag.BoolVar(&opts.ShowVersion, "version", false, "Display version information")
+
+	flag.BoolVar(&opts.Gemini, "g", false, "Temporarily run via Gemini")
+
+	flag.BoolVar(&opts.Local, "l", false, "Temporarily run locally via ollama")
+	flag.StringVar(&opts.Model, "m", "", "Temporarily run with this `model` of ollama, or of a remote config with a <MODEL> placeholder")
+	flag.StringVar(&opts.OllamaHost, "ollama-host", "", "Temporarily use another ollama `host` (host:port, or local for this machine)")
+	flag.Float64Var(&opts.Temperature, "temperature", 0, "Sampling temperature, lower is more deterministic (gemini, ollama, remote with <TEMPERATURE>)")
+	flag.IntVar(&opts.MaxTokens, "max-tokens", 0, "Longest response in tokens (gemini, ollama, remote with <MAX_TOKENS>)")
+	flag.IntVar(&opts.Ctx, "ctx", 0, "Context window in tokens ollama loads the model with (num_ctx, ollama's default is 2048)")
+	flag.IntVar(&opts.Seed, "seed", 0, "Random seed used by ollama, with --temperature 0 answers are reproducible")
+
+	flag.BoolVar(&opts.Remote, "r", false, "Temporarily run via the remote API of remoteConfig.json")
+
+	flag.StringVar(&opts.SetModel, "setModel", "", "Set the default `model` to be used by ollama")
+	flag.StringVar(&opts.SetDefault, "setDefault", "", "Set the default `mode` for lexido to run in (gemini, local, remote)")
+	flag.StringVar(&opts.SetRemotePreset, "setRemotePreset", "", "Same as lexido remote init `preset`, write the remote config of a known provider and make remote the default")
+	flag.StringVar(&opts.SetSafety, "setSafety", "", "Set Gemini safety thresholds, e.g. harassment=block_none,dangerous_content=block_only_high")
+	flag.StringVar(&opts.SetFallback, "setFallback", "", "Set the `providers` tried in order when one fails hard, e.g. gemini,ollama")
+	flag.StringVar(&opts.SetGcpProject, "setGcpProject", "", "Use Gemini through Vertex AI in this GCP `project`, with Application Default Credentials")
+	flag.StringVar(&opts.SetGcpLocation, "setGcpLocation", "", "Set the Vertex AI `location` used for Gemini (default us-central1)")
+	flag.StringVar(&opts.Lang, "lang", "", "Explain in this `language` for this prompt, e.g. es, the commands stay as they are")
+	flag.StringVar(&opts.SetLang, "setLang", "", "Set the `language` of the explanations, e.g. es, or auto to follow $LANG (default auto)")
+	flag.BoolVar(&opts.RelaxSafety, "relax-safety", false, "Temporarily turn off all Gemini safety filters")
+
+	flag.Var((*repeated)(&opts.Images), "image", "Attach the PNG or JPEG at `path` for Gemini or an ollama vision model such as llava, can be repeated")
+	flag.StringVar(&opts.WithPath, "with-path", "", "Attach PATH, resolution order, and version of the named `binaries` (comma separated)")
+
+	flag.BoolVar(&opts.YesRemovals, "yes-removals", false, "Allow adding -y style flags to package removal commands")
+
+	flag.StringVar(&opts.RunIn, "run-in", "", "Run the selected commands in this `directory` instead of the current one")
+	flag.BoolVar(&opts.Pager, "pager", false, "Open the complete response in $PAGER, then return to the TUI (o there does the same, v opens $EDITOR)")
+	flag.BoolVar(&opts.Accessible, "accessible", false, "Print the response once as plain lines and pick commands by number, for screen readers ($ACCESSIBLE does the same)")
+	flag.BoolVar(&opts.Tmux, "tmux", false, "Send the selected commands to new tmux panes (or a window, see tmux_layout) instead of running them, inside tmux only")
+	flag.StringVar(&opts.Target, "target", "", "Run the selected commands on `user@host` (or an ~/.ssh/config alias) over ssh, and describe that host to the model")
+
+	flag.BoolVar(&opts.ShowAllWarnings, "show-all-warnings", false, "Show every warning in full, even ones shown recently")
+
+	flag.IntVar(&opts.Alternatives, "alternatives", 1, "Generate this many alternative responses (at most 8), switch between them with [ and ]")
+	flag.StringVar(&opts.Race, "race", "", "Send the prompt to these `providers` at once (e.g. gemini,ollama), the first to answer is kept and the others cancelled")
+	flag.StringVar(&opts.Compare, "compare", "", "Send the prompt to these `providers` at once and switch between their answers with [ and ] to pick commands")
+
+	flag.BoolVar(&opts.Verbose, "verbose", false, "Log what lexido is doing to stderr and the log file")
+	flag.BoolVar(&opts.Debug, "debug", false, "Like --verbose, but also log request details, API keys and Authorization headers are redacted")
+	flag.StringVar(&opts.LogFile, "log-file", "", "Write the log to this `file` instead of $XDG_STATE_HOME/lexido/lexido.log (rotated at 4MB)")
+
+	flag.IntVar(&opts.MaxAttempts, "max-attempts", 0, "Give up after this many attempts when rate limited or the provider is unavailable (default 5)")
+	flag.BoolVar(&opts.AssumeOnline, "assume-online", false, "Don't probe Gemini or the remote API first, for networks where the 1s check fails wrongly")
+
+	flag.BoolVar(&opts.FixLoop, "fix-loop", false, "Run the suggestion and feed failures back to the model until a command succeeds")
+	flag.BoolVar(&opts.Yes, "y", false, "With --fix-loop, run every suggestion without asking first")
+	flag.IntVar(&opts.MaxIterations, "max-iterations", 5, "Most attempts --fix-loop makes")
+	flag.IntVar(&opts.FixBudget, "fix-budget", 50000, "Most tokens --fix-loop may spend across all attempts")
+
+	flag.BoolVar(&opts.ConfirmEach, "confirm-each", false, "Ask run? [y/N/e(dit)/q] before each selected command and summarize what ran (see confirm_each)")
+
+	flag.StringVar(&opts.SaveScript, "save-script", "", "Save the selected commands to an executable bash script at `path` instead of running them (s in the TUI saves at any time)")
+	flag.StringVar(&opts.Output, "o", "", "Write the raw response to the file at `path` once it is complete, instead of stdout with -q (- is stdout)")
+	flag.StringVar(&opts.Output, "output", "", "Write the raw response to the file at `path` once it is complete, instead of stdout with -q (- is stdout)")
+	flag.BoolVar(&opts.OutputCommands, "output-commands", false, "End the file of -o with the suggested commands in a fenced bash block")
+	flag.BoolVar(&opts.Force, "force", false, "Let --save-script and -o overwrite an existing file")
+
+	flag.BoolVar(&opts.NoRedact, "no-redact", false, "Send piped input and attached files as is, keys and passwords in them are masked by default")
+
+	flag.BoolVar(&opts.NoCache, "no-cache", false, "Ask the model again even if the response to this prompt is cached")
+
+	flag.BoolVar(&opts.RefreshSysinfo, "refresh-sysinfo", false, "Detect the operating system and package managers again, they are cached for a day")
+
+	flag.BoolVar(&opts.NoGit, "no-git", false, "Don't tell the model about the branch and state of the git repository you are in")
+
+	flag.BoolVar(&opts.NoProjectContext, "no-project-context", false, "Don't add the .lexido file of the current directory or its parents to the prompt")
+
+	flag.IntVar(&opts.History, "history", 0, "Include the last N entries of your bash, zsh or fish history, secret-looking ones are left out (off by default)")
+
+	flag.DurationVar(&opts.Timeout, "timeout", 0, "Give up on a request after this long, e.g. 90s (default 120s), the partial response is kept")
+
+	flag.BoolVar(&opts.JSON, "json", false, "Print the result as one JSON document (provider, model, prompt, response, commands, usage with cost, duration_ms), no TUI")
+	flag.BoolVar(&opts.JSONStream, "json-stream", false, "Print newline delimited JSON events (chunk, retry, reset, fallback, race, done) as the response streams in")
+
+	flag.BoolVar(&opts.NoKeyring, "no-keyring", false, "Store settings and API keys in the credentials file instead of the keyring")
+
+	flag.StringVar(&opts.Color, "color", "auto", "Color the output, `mode` is always, auto or never, auto leaves colors out with NO_COLOR, TERM=dumb or when stdout isn't a terminal")
+
+	flag.BoolVar(&opts.Quiet, "q", false, "Print only the response to stdout, no TUI, no colors and nothing is run, errors and warnings go to stderr")
+	flag.BoolVar(&opts.Quiet, "quiet", false, "Print only the response to stdout, no TUI, no colors and nothing is run, errors and warnings go to stderr")
+
+	flag.StringVar(&opts.Template, "t", "", "Render the template ~/.config/lexido/templates/`name`.tmpl into the prompt, the words after it are its {{.Args}}")
+	flag.StringVar(&opts.Template, "template", "", "Render the template ~/.config/lexido/templates/`name`.tmpl into the prompt, the words after it are its {{.Args}}")
+
+	flag.StringVar(&opts.PipeLimit, "pipe-limit", "", "Keep at most this `size` of piped input, e.g. 2M, the middle of longer input is left out (default 256K, see pipe_limit)")
+
+	flag.BoolVar(&opts.NoCapture, "no-capture", false, "Leave the terminal to the commands that run, for full-screen programs, instead of keeping their output to ask about")
+
+	flag.BoolVar(&opts.Paste, "paste", false, "Attach the clipboard like piped input (wl-paste, xclip, xsel, pbpaste, or OSC 52)")
+
+	flag.BoolVar(&opts.CommandsOnly, "commands-only", false, "Like -q, but print only the first suggested command and exit with 1 when there is none")
+	flag.BoolVar(&opts.All, "all", false, "With --commands-only, print every suggested command, one per line")
+	flag.BoolVar(&opts.NoCommands, "no-commands", false, "Only show the response, e.g. to explain piped text, no commands are taken from it or run")
+
+	// Flags typed after the prompt count as flags too, -- keeps the words after it in the prompt
+	args, literal := app.InterspersedArgs(flag.CommandLine, os.Args[1:])
+	flag.CommandLine.Parse(args)
+	opts.Literal = literal
+	opts.Args = flag.Args()
+	opts.Set = map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		opts.Set[f.Name] = true
+	})
+
+	os.Exit(app.New().Run(context.Background(), opts))
+}
+
+// A flag that can be given several times, each value is appended
+type repeated []string
+
+func (r *repeated) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *repeated) Get() any {
+	return []string(*r)
+}
+
+func (r *repeated) Set(value string) error {
+	*r = append(*r, value)
+	return nil
 }
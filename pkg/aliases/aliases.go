@@ -0,0 +1,133 @@
+package aliases
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// Starts the comment line above each definition, followed by its name and what it was generated for
+const marker = "# lexido: "
+
+var ErrNoName = errors.New("can't find the name of the alias or function in the definition")
+
+// Lines that name what they define: alias name=..., function name, name() {
+var namePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^\s*alias\s+([^\s=]+)[\s=]`),
+	regexp.MustCompile(`^\s*function\s+([^\s(;{]+)`),
+	regexp.MustCompile(`^\s*([A-Za-z_][\w.:-]*)\s*\(\)`),
+}
+
+// Returns the path of the aliases file of the shell, aliases.fish for fish and aliases.sh for the others
+func Path(shell string) (string, error) {
+	if shell == "fish" {
+		return io.GetFilePath(io.Config, "aliases.fish")
+	}
+	return io.GetFilePath(io.Config, "aliases.sh")
+}
+
+// Returns the definition in a response, without the code fence or text around it a model may have added
+func Extract(response string) string {
+	response = strings.TrimSpace(response)
+	if start := strings.Index(response, "```"); start >= 0 {
+		body := response[start+3:]
+		// The language of the fence, e.g. ```bash
+		if newline := strings.IndexByte(body, '\n'); newline >= 0 {
+			body = body[newline+1:]
+		}
+		if end := strings.Index(body, "```"); end >= 0 {
+			body = body[:end]
+		}
+		return strings.TrimSpace(body)
+	}
+	return response
+}
+
+// Returns the name the definition gives its alias or function, the first one when it defines several
+func Name(definition string) (string, error) {
+	for _, line := range strings.Split(definition, "\n") {
+		for _, pattern := range namePatterns {
+			if match := pattern.FindStringSubmatch(line); match != nil {
+				return strings.Trim(match[1], `'"`), nil
+			}
+		}
+	}
+	return "", ErrNoName
+}
+
+type block struct {
+	name string
+	text string
+}
+
+// Save writes the definition to the aliases file of the shell, replacing the one of the same name if there is one,
+// and returns the path of the file and whether a definition was replaced
+func Save(shell string, name string, description string, definition string) (string, bool, error) {
+	path, err := Path(shell)
+	if err != nil {
+		return "", false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", false, err
+	}
+
+	description = strings.Join(strings.Fields(description), " ")
+	saved := block{name: name, text: marker + name + " (" + description + ")\n" + strings.TrimSpace(definition) + "\n"}
+	blocks := parse(string(data))
+	replaced := false
+	for i, b := range blocks {
+		if b.name == name {
+			blocks[i] = saved
+			replaced = true
+		}
+	}
+	if !replaced {
+		blocks = append(blocks, saved)
+	}
+
+	var s strings.Builder
+	s.WriteString(header(path))
+	for _, b := range blocks {
+		s.WriteString("\n" + b.text)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", false, err
+	}
+	// Written next to the file and renamed over it, a shell sourcing it never sees half a definition
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(s.String()), 0600); err != nil {
+		return "", false, err
+	}
+	return path, replaced, os.Rename(tmp, path)
+}
+
+// Splits the file into its definitions, the header before the first one is written anew on every save
+func parse(text string) []block {
+	var blocks []block
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if rest, ok := strings.CutPrefix(line, marker); ok {
+			name, _, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			blocks = append(blocks, block{name: name})
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		blocks[len(blocks)-1].text += line
+	}
+	for i := range blocks {
+		blocks[i].text = strings.TrimSpace(blocks[i].text) + "\n"
+	}
+	return blocks
+}
+
+func header(path string) string {
+	return fmt.Sprintf("# Managed by lexido, do not edit: `lexido alias` rewrites this file and replaces\n"+
+		"# definitions of the same name. Load it from the rc file of your shell with:\n"+
+		"#     source %s\n", path)
+}
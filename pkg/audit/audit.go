@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+const auditFile = "audit.jsonl"
+
+// Disabled turns the audit log off, set from the audit setting
+var Disabled bool
+
+// Entry is a command lexido ran, one line of the audit log
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Dir        string    `json:"cwd"`
+	User       string    `json:"user"`
+	Provider   string    `json:"provider,omitempty"`
+	Model      string    `json:"model,omitempty"`
+	Prompt     string    `json:"prompt,omitempty"`
+	Command    string    `json:"command"`
+	ExitCode   int       `json:"exit_code"` // -1 when the command couldn't be started
+	DurationMs int64     `json:"duration_ms"`
+	Status     string    `json:"status,omitempty"` // Set for commands lexido didn't wait for, their exit code is unknown
+}
+
+// The provider, model and prompt the commands being run were suggested for
+var session struct {
+	provider string
+	model    string
+	prompt   string
+}
+
+// Later receives the writes of the entries when it is set, such as the Essential of a shutdown.Coordinator,
+// instead of them being appended right away
+var Later func(name string, write func() error)
+
+// Sets what the entries of the commands run from now on were suggested by
+func SetSession(provider string, model string, prompt string) {
+	session.provider, session.model, session.prompt = provider, model, prompt
+}
+
+// Returns the path of the audit log
+func Path() (string, error) {
+	return io.GetFilePath(io.State, auditFile)
+}
+
+// Record appends a command that ran to the audit log. A log that can't be written, e.g. on a full disk,
+// is only warned about so the commands still run.
+func Record(command string, dir string, exitCode int, duration time.Duration) {
+	record(Entry{Command: command, Dir: dir, ExitCode: exitCode, DurationMs: duration.Milliseconds()})
+}
+
+// RecordDispatched appends a command that was handed to another program to run, e.g. a tmux pane,
+// with a status saying where it went
+func RecordDispatched(command string, dir string, status string) {
+	record(Entry{Command: command, Dir: dir, Status: status})
+}
+
+// Fills in the time, user and session of entry and appends it
+func record(entry Entry) {
+	if Disabled {
+		return
+	}
+	entry.Time = time.Now()
+	entry.Provider, entry.Model, entry.Prompt = session.provider, session.model, session.prompt
+	if u, err := user.Current(); err == nil {
+		entry.User = u.Username
+	}
+	write := func() error {
+		err := appendEntry(entry)
+		if err != nil {
+			log.Printf("Warning: Could not write the audit log, the command ran anyway: %v", err)
+		}
+		return err
+	}
+	if Later != nil {
+		Later("audit log", write)
+		return
+	}
+	write()
+}
+
+func appendEntry(entry Entry) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Append only, entries are never rewritten
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Tail returns the last n entries of the audit log, oldest first. A missing log means nothing ran yet.
+func Tail(n int) ([]Entry, error) {
+	var entries []Entry
+	err := each(func(entry Entry) {
+		entries = append(entries, entry)
+		if len(entries) > n {
+			entries = entries[1:]
+		}
+	})
+	return entries, err
+}
+
+// Since returns the entries of the audit log from the given time on, oldest first
+func Since(t time.Time) ([]Entry, error) {
+	var entries []Entry
+	err := each(func(entry Entry) {
+		if !entry.Time.Before(t) {
+			entries = append(entries, entry)
+		}
+	})
+	return entries, err
+}
+
+// Calls fn with every entry of the audit log in order
+func each(fn func(Entry)) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		fn(entry)
+	}
+	return scanner.Err()
+}
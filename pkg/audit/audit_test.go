@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/shutdown"
+)
+
+func TestLaterDefersTheWrite(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path, err := Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exit := shutdown.New(time.Second)
+	Later = exit.Essential
+	defer func() { Later = nil }()
+
+	Record("ls -la", "/tmp", 0, time.Millisecond)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("the audit log was written before shutdown: %v", err)
+	}
+
+	if errs := exit.Run(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	entries, err := Tail(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Command != "ls -la" {
+		t.Errorf("the audit log has %v after shutdown, want the command", entries)
+	}
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// Responses are kept in their own directory of the cache dir, one file per prompt
+const responsesDir = "responses"
+
+// Defaults of the cache_ttl and cache_max_size settings
+const (
+	DefaultTTL     = 24 * time.Hour
+	DefaultMaxSize = 10 << 20
+)
+
+// Entry is a cached response
+type Entry struct {
+	Provider string    `json:"provider"`
+	Model    string    `json:"model"`
+	Created  time.Time `json:"created"`
+	Response string    `json:"response"`
+}
+
+// Returns the cache key of a prompt sent to a provider and model, settings describes the rest of the request
+// that changes the response, such as the temperature or the host
+func Key(provider string, model string, settings string, prompt string) string {
+	sum := sha256.Sum256([]byte(provider + "\x00" + model + "\x00" + settings + "\x00" + prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+func dir() (string, error) {
+	return io.GetFilePath(io.Cache, responsesDir)
+}
+
+// Returns the response cached under the key, expired entries are removed and reported as missing
+func Get(key string, ttl time.Duration) (Entry, bool) {
+	d, err := dir()
+	if err != nil {
+		return Entry{}, false
+	}
+	path := filepath.Join(d, key+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Entry{}, false
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil || time.Since(entry.Created) > ttl {
+		os.Remove(path)
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// Stores a response under the key, then evicts the oldest entries until the cache fits in maxSize bytes
+func Put(key string, entry Entry, maxSize int64) error {
+	d, err := dir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(d, key+".json"), data, 0600); err != nil {
+		return err
+	}
+	return evict(d, maxSize)
+}
+
+func evict(d string, maxSize int64) error {
+	dirEntries, err := os.ReadDir(d)
+	if err != nil {
+		return err
+	}
+
+	var files []os.FileInfo
+	var total int64
+	for _, dirEntry := range dirEntries {
+		if !strings.HasSuffix(dirEntry.Name(), ".json") {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, info := range files {
+		if total <= maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(d, info.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		total -= info.Size()
+	}
+	return nil
+}
+
+// Removes every cached response and returns how many there were
+func Clear() (int, error) {
+	d, err := dir()
+	if err != nil {
+		return 0, err
+	}
+	dirEntries, err := os.ReadDir(d)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, dirEntry := range dirEntries {
+		if strings.HasSuffix(dirEntry.Name(), ".json") {
+			count++
+		}
+	}
+	return count, os.RemoveAll(d)
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyCoversTheRequest(t *testing.T) {
+	base := Key("gemini", "gemini-1.5-flash", "temperature=0.7 max_tokens=0", "find big files")
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"provider", Key("local", "gemini-1.5-flash", "temperature=0.7 max_tokens=0", "find big files")},
+		{"model", Key("gemini", "gemini-1.5-pro", "temperature=0.7 max_tokens=0", "find big files")},
+		{"settings", Key("gemini", "gemini-1.5-flash", "temperature=0.2 max_tokens=0", "find big files")},
+		{"prompt", Key("gemini", "gemini-1.5-flash", "temperature=0.7 max_tokens=0", "find small files")},
+		// The parts are separated, moving text from one to the next is another request
+		{"boundary", Key("gemini", "gemini-1.5-flash", "temperature=0.7 max_tokens=0find", " big files")},
+	}
+	for _, test := range tests {
+		if test.key == base {
+			t.Errorf("a different %s gave the same key", test.name)
+		}
+	}
+	if again := Key("gemini", "gemini-1.5-flash", "temperature=0.7 max_tokens=0", "find big files"); again != base {
+		t.Error("the same request gave another key")
+	}
+}
+
+func TestSettingsChangeMisses(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	cached := Key("gemini", "gemini-1.5-flash", "temperature=0.7 max_tokens=0", "find big files")
+	if err := Put(cached, Entry{Provider: "gemini", Created: time.Now(), Response: "@run[du -ah | sort -rh]"}, DefaultMaxSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry, ok := Get(cached, DefaultTTL); !ok || entry.Response != "@run[du -ah | sort -rh]" {
+		t.Errorf("Get() = %+v, %v, want the cached response", entry, ok)
+	}
+	if _, ok := Get(Key("gemini", "gemini-1.5-flash", "temperature=0 max_tokens=0", "find big files"), DefaultTTL); ok {
+		t.Error("Get() with another temperature served the cached response")
+	}
+}
+
+func TestExpiredEntriesArentServed(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	key := Key("gemini", "gemini-1.5-flash", "", "find big files")
+	if err := Put(key, Entry{Created: time.Now().Add(-2 * time.Hour), Response: "stale"}, DefaultMaxSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := Get(key, time.Hour); ok {
+		t.Error("Get() served an entry older than the ttl")
+	}
+	// The expired entry is gone, a longer ttl later doesn't bring it back
+	if _, ok := Get(key, DefaultTTL); ok {
+		t.Error("Get() served the expired entry after it was dropped")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "lexido", responsesDir, key+".json")); !os.IsNotExist(err) {
+		t.Errorf("the expired entry's file is still there: %v", err)
+	}
+}
+
+func TestPutEvictsOldest(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	d := filepath.Join(cacheDir, "lexido", responsesDir)
+
+	old := Key("gemini", "m", "", "old")
+	if err := Put(old, Entry{Created: time.Now(), Response: "old"}, DefaultMaxSize); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(d, old+".json"), past, past); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(d, old+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Room for about one entry, the newer one stays
+	fresh := Key("gemini", "m", "", "new")
+	if err := Put(fresh, Entry{Created: time.Now(), Response: "new"}, info.Size()+10); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Get(old, DefaultTTL); ok {
+		t.Error("the oldest entry wasn't evicted")
+	}
+	if _, ok := Get(fresh, DefaultTTL); !ok {
+		t.Error("the newest entry was evicted")
+	}
+
+	if n, err := Clear(); err != nil || n != 1 {
+		t.Errorf("Clear() = %d, %v, want the one entry left", n, err)
+	}
+}
@@ -1,37 +1,30 @@
 package commands
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/audit"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/format"
 )
 
 // Regular expression to find @run[<COMMAND>]
 var commandRegex = regexp.MustCompile(`@run\[(.*?)\]`)
 
-// Function to parse commands from the response @run[<COMMAND>]
-func ParseCommands(responseContent string) []string {
-	matches := commandRegex.FindAllStringSubmatch(responseContent, -1)
-
-	var commands []string
-	for _, match := range matches {
-		// Each match is a slice where the first element is the whole match
-		// and the second element is the captured group (the command)
-		if len(match) > 1 {
-			commands = append(commands, match[1]) // Append the command
-		}
-	}
-
-	return commands
-}
-
 // Function to highlight all occurrences of @run[<COMMAND>] in the responseContent
 func HighlightCommands(responseContent string) string {
 	// ANSI color codes for highlighting
-	startHighlight := "\033[34m"
-	endHighlight := "\033[0m"
+	startHighlight := format.Code(format.Command)
+	// The response's own color goes on after the command
+	endHighlight := format.Reset + format.Code(format.Response)
 
 	// Replace matches with highlighted version
 	highlightedContent := commandRegex.ReplaceAllStringFunc(responseContent, func(match string) string {
@@ -41,20 +34,161 @@ func HighlightCommands(responseContent string) string {
 	return highlightedContent
 }
 
-// Run commands from model
-func RunCommands(commands []string) {
-	for _, cmdStr := range commands {
-		parts := strings.Fields(cmdStr)
-		cmd := exec.Command(parts[0], parts[1:]...)
+// Replaces the @run[<COMMAND>] markers of the response with the command as inline markdown code
+func MarkdownCommands(responseContent string) string {
+	return commandRegex.ReplaceAllStringFunc(responseContent, func(match string) string {
+		return "`" + match[5:len(match)-1] + "`"
+	})
+}
+
+// Checks that the directory the commands are pinned to is still usable
+func CheckRunDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("the directory %s no longer exists", dir)
+		}
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// Capture, when set, gets a copy of the stdout of the commands RunCommands runs, for a follow-up question
+// about it. The commands see a pipe instead of the terminal then, except for the ones that need it.
+var Capture io.Writer
+
+// Returns where the stdout of a command goes, the terminal and Capture when it is set
+func stdout(cmdStr string) io.Writer {
+	if Capture != nil && !NeedsTerminal(cmdStr) {
+		return io.MultiWriter(os.Stdout, Capture)
+	}
+	return os.Stdout
+}
+
+// Run commands from model inside dir, the directory lexido was invoked from unless overridden.
+// With ConfirmEach every command is confirmed on its own. Returns the error of the first command that failed.
+func RunCommands(commands []string, dir string) error {
+	if ConfirmEach {
+		return runConfirmed(commands, dir)
+	}
+	commands, notes, stopSudo := prepareSudo(commands)
+	defer stopSudo()
+
+	var failed error
+	for i, cmdStr := range commands {
+		if strings.TrimSpace(cmdStr) == "" {
+			continue
+		}
+		printSudoNote(cmdStr, notes[i])
+		cmd := newCommand(cmdStr)
+		cmd.Dir = dir
 		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = stdout(cmdStr)
 		cmd.Stderr = os.Stderr
 
-		if err := cmd.Run(); err != nil {
+		if err := runAudited(cmd, cmdStr); err != nil {
 			log.Printf("Error running command %q: %v", cmdStr, err)
+			if failed == nil {
+				failed = commandError(cmdStr, err)
+			}
+			continue
+		}
+	}
+	return failed
+}
+
+// Returns the error of a command that failed to run as an *errs.CommandError with its exit code
+func commandError(cmdStr string, err error) error {
+	return &errs.CommandError{Command: cmdStr, ExitCode: exitCode(err)}
+}
+
+// Returns the exit code of a command that ran with err, -1 when it couldn't be started
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// Runs cmd and records it in the audit log, whatever the mode it was picked in
+func runAudited(cmd *exec.Cmd, cmdStr string) error {
+	restoreTerminal()
+	start := time.Now()
+	err := cmd.Run()
+	dir := cmd.Dir
+	if Target != "" {
+		dir = Target + ":~"
+	}
+	audit.Record(cmdStr, dir, exitCode(err), time.Since(start))
+	return err
+}
+
+// Result is the outcome of a command run by RunCommandsCapture
+type Result struct {
+	Command  string
+	ExitCode int
+	Output   string // Tail of what the command printed to stdout and stderr
+}
+
+// Longest tail of output kept per command
+const maxCapturedOutput = 8192
+
+// Keeps the last bytes written to it
+type tailBuffer struct {
+	data []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.data = append(t.data, p...)
+	if len(t.data) > maxCapturedOutput {
+		t.data = t.data[len(t.data)-maxCapturedOutput:]
+	}
+	return len(p), nil
+}
+
+// Runs commands like RunCommands while keeping their exit code and the tail of their output.
+// It stops at the first command that fails, the ones after it usually depend on it.
+func RunCommandsCapture(commands []string, dir string) []Result {
+	commands, notes, stopSudo := prepareSudo(commands)
+	defer stopSudo()
+
+	var results []Result
+	for i, cmdStr := range commands {
+		if strings.TrimSpace(cmdStr) == "" {
 			continue
 		}
+		printSudoNote(cmdStr, notes[i])
+		var output tailBuffer
+		cmd := newCommand(cmdStr)
+		cmd.Dir = dir
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = io.MultiWriter(os.Stdout, &output)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+
+		result := Result{Command: cmdStr}
+		if err := runAudited(cmd, cmdStr); err != nil {
+			result.ExitCode = exitCode(err)
+			if result.ExitCode < 0 {
+				// The command didn't even start, e.g. it isn't installed
+				log.Printf("Error running command %q: %v", cmdStr, err)
+				output.Write([]byte(err.Error()))
+			}
+		}
+		result.Output = string(output.data)
+		results = append(results, result)
+
+		if result.ExitCode != 0 {
+			break
+		}
 	}
+	return results
 }
 
 // Function to detect if any of the commands are being ran as sudo
@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckRunDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckRunDir(dir); err != nil {
+		t.Errorf("CheckRunDir() = %v for an existing directory", err)
+	}
+
+	deleted := filepath.Join(dir, "deleted")
+	if err := os.Mkdir(deleted, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(deleted)
+	if err := CheckRunDir(deleted); err == nil || !strings.Contains(err.Error(), deleted+" no longer exists") {
+		t.Errorf("CheckRunDir() = %v, want the deleted directory named", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0644)
+	if err := CheckRunDir(file); err == nil || !strings.Contains(err.Error(), "is not a directory") {
+		t.Errorf("CheckRunDir() = %v, want a file refused", err)
+	}
+}
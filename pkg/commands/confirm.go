@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/format"
+)
+
+// ConfirmEach makes RunCommands ask before every command instead of running the selection as a whole
+var ConfirmEach bool
+
+// EditCommand lets the user change a command in place before it runs, returning false when they cancelled.
+// It is set by main, the line editor lives with the rest of the TUI. Without it edits are typed from scratch.
+var EditCommand func(cmd string) (string, bool, error)
+
+// What happened to a command in confirm-each mode
+type stepOutcome int
+
+const (
+	outcomeRan stepOutcome = iota
+	outcomeFailed
+	outcomeSkipped
+	outcomeNotReached
+)
+
+type step struct {
+	command string
+	edited  bool
+	note    string // What was changed about sudo in the command
+	outcome stepOutcome
+}
+
+// Runs the commands one at a time, asking before each one, followed by a summary.
+// Returns the error of the first command that failed.
+func runConfirmed(commands []string, dir string) error {
+	commands, notes, stopSudo := prepareSudo(commands)
+	defer stopSudo()
+
+	var steps []step
+	var failed error
+	quit := false
+	for i, cmdStr := range commands {
+		if strings.TrimSpace(cmdStr) == "" {
+			continue
+		}
+		s := step{command: cmdStr, note: notes[i]}
+		if quit {
+			s.outcome = outcomeNotReached
+			steps = append(steps, s)
+			continue
+		}
+
+	ask:
+		for {
+			fmt.Print(format.Styled(fmt.Sprintf("\n\033[34m%s\033[0m\nrun? [y/N/e(dit)/q] ", s.command)))
+			switch strings.ToLower(strings.TrimSpace(ReadLine())) {
+			case "y", "yes":
+				s.outcome = outcomeRan
+				if err := runOne(s.command, dir); err != nil {
+					s.outcome = outcomeFailed
+					if failed == nil {
+						failed = err
+					}
+				}
+				break ask
+			case "e", "edit":
+				if edited, ok := editCommand(s.command); ok && edited != "" && edited != s.command {
+					s.command, s.note = adjustSudo(edited)
+					s.edited = true
+				}
+			case "q", "quit":
+				quit = true
+				s.outcome = outcomeNotReached
+				break ask
+			default:
+				s.outcome = outcomeSkipped
+				break ask
+			}
+		}
+		steps = append(steps, s)
+	}
+	printSummary(steps)
+	return failed
+}
+
+// Runs a single command like RunCommands does
+func runOne(cmdStr string, dir string) error {
+	cmd := newCommand(cmdStr)
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout(cmdStr)
+	cmd.Stderr = os.Stderr
+	if err := runAudited(cmd, cmdStr); err != nil {
+		log.Printf("Error running command %q: %v", cmdStr, err)
+		return commandError(cmdStr, err)
+	}
+	return nil
+}
+
+// Edits a command with EditCommand, or by typing a replacement when it isn't set
+func editCommand(cmd string) (string, bool) {
+	if EditCommand != nil {
+		edited, ok, err := EditCommand(cmd)
+		if err == nil {
+			return edited, ok
+		}
+		log.Printf("Could not open the editor: %v", err)
+	}
+	fmt.Print("New command (empty keeps it): ")
+	edited := strings.TrimSpace(ReadLine())
+	return edited, edited != ""
+}
+
+// ReadLine reads a line from stdin a byte at a time, so nothing meant for the commands that run next is buffered away
+func ReadLine() string {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n == 0 || err != nil || buf[0] == '\n' {
+			break
+		}
+		line = append(line, buf[0])
+	}
+	return strings.TrimSuffix(string(line), "\r")
+}
+
+func printSummary(steps []step) {
+	if len(steps) == 0 {
+		return
+	}
+	fmt.Println("\nSummary:")
+	for _, s := range steps {
+		var label, color string
+		switch s.outcome {
+		case outcomeRan:
+			label, color = "ran", "\033[32m"
+		case outcomeFailed:
+			label, color = "failed", "\033[31m"
+		case outcomeSkipped:
+			label, color = "skipped", "\033[33m"
+		case outcomeNotReached:
+			label, color = "not run", "\033[33m"
+		}
+		edited := ""
+		if s.edited {
+			edited = " (edited)"
+		}
+		if s.note != "" {
+			edited += " (" + s.note + ")"
+		}
+		fmt.Print(format.Styled(fmt.Sprintf("  %s%-7s\033[0m %s%s\n", color, label, s.command, edited)))
+	}
+}
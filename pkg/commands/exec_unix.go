@@ -0,0 +1,17 @@
+//go:build !windows
+
+package commands
+
+import (
+	"os/exec"
+)
+
+// Builds the process used to run a suggested command. The model is told to write bash, so pipes, builtins
+// like read and && chains work, sh stands in where bash isn't installed.
+func shellCommand(cmdStr string) *exec.Cmd {
+	shell := "bash"
+	if _, err := exec.LookPath(shell); err != nil {
+		shell = "sh"
+	}
+	return exec.Command(shell, "-c", cmdStr)
+}
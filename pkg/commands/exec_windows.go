@@ -0,0 +1,10 @@
+//go:build windows
+
+package commands
+
+import "os/exec"
+
+// Builds the process used to run a suggested command, the model is told to emit PowerShell on Windows
+func shellCommand(cmdStr string) *exec.Cmd {
+	return exec.Command("powershell", "-NoProfile", "-Command", cmdStr)
+}
@@ -0,0 +1,296 @@
+package commands
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/micr0-dev/lexido/pkg/format"
+)
+
+// Languages of fenced code blocks that hold commands, an untagged block counts as one too
+var shellLanguages = map[string]bool{
+	"": true, "bash": true, "sh": true, "shell": true, "zsh": true, "fish": true,
+	"console": true, "shell-session": true, "terminal": true,
+	"powershell": true, "ps1": true, "pwsh": true, "cmd": true, "bat": true,
+}
+
+// Languages whose blocks mix commands with their output, only lines behind a prompt sigil are commands
+var sessionLanguages = map[string]bool{"console": true, "shell-session": true, "terminal": true}
+
+// Prompt sigils models put in front of commands, as in "$ sudo apt update"
+var promptSigils = []string{"$ ", "% ", "❯ ", "PS> "}
+
+// Words that start a command even when they aren't on PATH, shell builtins and sudo which the machine may lack
+var commandWords = map[string]bool{
+	"cd": true, "export": true, "source": true, "alias": true, "unset": true, "set": true, "ulimit": true, "umask": true,
+	"sudo": true, "doas": true,
+}
+
+var (
+	listItemRegex   = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*+])\s+(.+)$`)
+	inlineCodeRegex = regexp.MustCompile("`([^`\n]+)`")
+)
+
+// Parses the commands of a complete response: @run[...] first, then fenced shell blocks, and when the model used
+// neither, numbered or bulleted list items and inline code that start with a known command. Repeats are dropped.
+func ParseCommands(responseContent string) []string {
+	return extract(responseContent, true)
+}
+
+// Extractor finds commands in a response that is still streaming in.
+// Commands that were already found keep their position, new ones are only ever appended.
+type Extractor struct {
+	length   int
+	commands []string
+}
+
+// Update scans the accumulated text and returns all commands found so far. Until complete is set, only what can't
+// change anymore is picked up: @run commands once their closing bracket arrived, closed code blocks and whole lines.
+func (e *Extractor) Update(text string, complete bool) []string {
+	if len(text) < e.length {
+		// The text was replaced rather than appended to, start over
+		e.commands = nil
+	}
+	e.length = len(text)
+
+	for _, cmd := range extract(text, complete) {
+		if !contains(e.commands, cmd) {
+			e.commands = append(e.commands, cmd)
+		}
+	}
+	return e.commands
+}
+
+func extract(text string, complete bool) []string {
+	// A CR left at the end of a line would end up in the command and break it
+	text = format.NormalizeNewlines(text)
+	var found, fallbacks []string
+	add := func(list *[]string, cmd string) {
+		cmd = cleanCommand(cmd)
+		if cmd != "" && !contains(*list, cmd) {
+			*list = append(*list, cmd)
+		}
+	}
+
+	for _, cmd := range runCommands(text, complete) {
+		add(&found, cmd)
+	}
+
+	lines := strings.Split(text, "\n")
+	if !complete {
+		// The last line may still be growing
+		lines = lines[:len(lines)-1]
+	}
+
+	inFence, fence, language := false, []string(nil), ""
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			if !inFence {
+				inFence, fence = true, nil
+				language = strings.ToLower(strings.TrimSpace(strings.Trim(trimmed, "`~")))
+				continue
+			}
+			inFence = false
+			for _, cmd := range blockCommands(fence, language) {
+				add(&found, cmd)
+			}
+			continue
+		}
+		if inFence {
+			fence = append(fence, line)
+			continue
+		}
+		if strings.Contains(line, "@run[") {
+			continue
+		}
+
+		if match := listItemRegex.FindStringSubmatch(line); match != nil {
+			item := strings.TrimSpace(match[1])
+			if !strings.Contains(item, "`") && !strings.HasSuffix(item, ".") && !strings.HasSuffix(item, ":") && looksLikeCommand(stripSigil(item), false) {
+				add(&fallbacks, item)
+			}
+		}
+		for _, match := range inlineCodeRegex.FindAllStringSubmatch(line, -1) {
+			if looksLikeCommand(stripSigil(match[1]), true) {
+				add(&fallbacks, match[1])
+			}
+		}
+	}
+
+	// Models sometimes leave the last block open
+	if inFence && complete {
+		for _, cmd := range blockCommands(fence, language) {
+			add(&found, cmd)
+		}
+	}
+
+	if len(found) == 0 {
+		return fallbacks
+	}
+	return found
+}
+
+// Finds the @run[...] commands, matching nested brackets such as @run[echo ${list[0]}]
+func runCommands(text string, complete bool) []string {
+	var cmds []string
+	for {
+		start := strings.Index(text, "@run[")
+		if start < 0 {
+			return cmds
+		}
+		text = text[start+len("@run["):]
+
+		// A command doesn't span lines, once the line is over its closing bracket can't arrive anymore
+		line, rest, final := strings.Cut(text, "\n")
+		end := closingBracket(line)
+		if end < 0 && (final || complete) {
+			// Unbalanced brackets or quotes, such as in echo "]", end at the first closing one like older versions did
+			end = strings.Index(line, "]")
+		}
+		if end < 0 {
+			if !final && !complete {
+				// The closing bracket hasn't arrived yet
+				return cmds
+			}
+			text = rest
+			continue
+		}
+		cmds = append(cmds, line[:end])
+		text = text[end+1:]
+	}
+}
+
+// Returns the index of the bracket closing an already opened one, skipping brackets inside quotes
+func closingBracket(text string) int {
+	depth := 0
+	var quote rune
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '[':
+			depth++
+		case r == ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// Returns the commands of a fenced code block, joining lines continued with \, && or |
+func blockCommands(lines []string, language string) []string {
+	if !shellLanguages[language] {
+		return nil
+	}
+
+	// Blocks that show prompts mix commands with their output
+	session := sessionLanguages[language]
+	for _, line := range lines {
+		if hasSigil(line) {
+			session = true
+			break
+		}
+	}
+
+	var cmds []string
+	current, continued := "", false
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if !continued {
+			if line == "" || strings.HasPrefix(line, "#") || strings.Contains(line, "@run[") {
+				continue
+			}
+			if session {
+				if !hasSigil(line) {
+					continue // Output of the previous command
+				}
+				line = stripSigil(line)
+			}
+		}
+
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSpace(strings.TrimSuffix(line, "\\")) + " "
+			continued = true
+			continue
+		}
+		if strings.HasSuffix(line, "&&") || strings.HasSuffix(line, "||") || strings.HasSuffix(line, "|") {
+			current += line + " "
+			continued = true
+			continue
+		}
+		cmds = append(cmds, current+line)
+		current, continued = "", false
+	}
+	if current != "" {
+		cmds = append(cmds, strings.TrimSpace(current))
+	}
+	return cmds
+}
+
+// Trims a command and drops the prompt sigil and backticks the model put around it
+func cleanCommand(cmd string) string {
+	cmd = strings.TrimSpace(cmd)
+	if len(cmd) > 1 && strings.HasPrefix(cmd, "`") && strings.HasSuffix(cmd, "`") {
+		cmd = strings.TrimSpace(strings.Trim(cmd, "`"))
+	}
+	return strings.TrimSpace(stripSigil(cmd))
+}
+
+func hasSigil(line string) bool {
+	return stripSigil(line) != line
+}
+
+func stripSigil(line string) string {
+	trimmed := strings.TrimSpace(line)
+	for _, sigil := range promptSigils {
+		if strings.HasPrefix(trimmed, sigil) {
+			return strings.TrimSpace(trimmed[len(sigil):])
+		}
+	}
+	return line
+}
+
+// Reports whether text outside of @run and code blocks is a command, judged by its first word being
+// an executable or builtin. Inline code also needs arguments, `nginx` alone is more likely a name than a command.
+func looksLikeCommand(text string, needArgs bool) bool {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || (needArgs && len(fields) < 2) {
+		return false
+	}
+	word := fields[0]
+	if strings.HasPrefix(word, "./") || strings.HasPrefix(word, "/") || strings.HasPrefix(word, "~/") {
+		return true
+	}
+	if word != strings.ToLower(word) {
+		return false // Sentences start with a capital, commands rarely do
+	}
+	return commandWords[word] || isExecutable(word)
+}
+
+// Results of PATH lookups, the same words come up at every update of a streaming response
+var (
+	executables   = map[string]bool{}
+	executablesMu sync.Mutex
+)
+
+func isExecutable(word string) bool {
+	executablesMu.Lock()
+	defer executablesMu.Unlock()
+	found, ok := executables[word]
+	if !ok {
+		_, err := exec.LookPath(word)
+		found = err == nil
+		executables[word] = found
+	}
+	return found
+}
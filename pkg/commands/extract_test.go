@@ -0,0 +1,223 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Feeds the chunks to an Extractor one after another and returns what it had found after each of them
+func stream(chunks []string) [][]string {
+	var e Extractor
+	var text string
+	var found [][]string
+	for i, chunk := range chunks {
+		text += chunk
+		cmds := e.Update(text, i == len(chunks)-1)
+		found = append(found, append([]string(nil), cmds...))
+	}
+	return found
+}
+
+func TestExtractorFenceClosedByLaterChunk(t *testing.T) {
+	found := stream([]string{
+		"Find the big files:\n```bash\n",
+		"du -ah . | sort -rh",
+		" | head -n 20\n",
+		"```\nThat lists",
+		" the largest first.",
+	})
+
+	// Until the fence closes, the lines in it could still be continued
+	for i := 0; i < 3; i++ {
+		if len(found[i]) != 0 {
+			t.Errorf("after chunk %d found %q, want nothing before the fence closes", i, found[i])
+		}
+	}
+	want := []string{"du -ah . | sort -rh | head -n 20"}
+	for i := 3; i < len(found); i++ {
+		if !reflect.DeepEqual(found[i], want) {
+			t.Errorf("after chunk %d found %q, want %q", i, found[i], want)
+		}
+	}
+}
+
+func TestExtractorContinuedLineInOpenFence(t *testing.T) {
+	found := stream([]string{
+		"```sh\nsudo apt update && \\\n",
+		"  sudo apt upgrade -y\n",
+		"```\n",
+	})
+	if len(found[0]) != 0 || len(found[1]) != 0 {
+		t.Errorf("found %q and %q while the fence was open", found[0], found[1])
+	}
+	want := []string{"sudo apt update && sudo apt upgrade -y"}
+	if !reflect.DeepEqual(found[2], want) {
+		t.Errorf("found %q, want %q", found[2], want)
+	}
+}
+
+func TestExtractorRunBracketClosedByLaterChunk(t *testing.T) {
+	found := stream([]string{
+		"Use @run[echo ${list[0]",
+		"}] to print it, then @run[ls",
+		" -la]\n",
+	})
+	if len(found[0]) != 0 {
+		t.Errorf("found %q before the bracket closed", found[0])
+	}
+	if want := []string{"echo ${list[0]}"}; !reflect.DeepEqual(found[1], want) {
+		t.Errorf("found %q, want %q", found[1], want)
+	}
+	if want := []string{"echo ${list[0]}", "ls -la"}; !reflect.DeepEqual(found[2], want) {
+		t.Errorf("found %q, want %q", found[2], want)
+	}
+}
+
+func TestExtractorKeepsPositions(t *testing.T) {
+	// Commands found earlier keep their index so a selection made while streaming stays on the same command
+	found := stream([]string{
+		"@run[df -h]\n",
+		"```bash\nfree -m\n```\n",
+		"@run[uptime]\n",
+	})
+	for i := 1; i < len(found); i++ {
+		if !reflect.DeepEqual(found[i][:len(found[i-1])], found[i-1]) {
+			t.Errorf("after chunk %d found %q, earlier commands %q moved", i, found[i], found[i-1])
+		}
+	}
+	last := found[len(found)-1]
+	for _, cmd := range []string{"df -h", "free -m", "uptime"} {
+		if !contains(last, cmd) {
+			t.Errorf("found %q, missing %q", last, cmd)
+		}
+	}
+}
+
+func TestExtractorNoRepeats(t *testing.T) {
+	found := stream([]string{"@run[df -h]\n", "@run[df -h]\n", "done"})
+	if want := []string{"df -h"}; !reflect.DeepEqual(found[2], want) {
+		t.Errorf("found %q, want %q", found[2], want)
+	}
+}
+
+func TestExtractorOpenFenceAtTheEnd(t *testing.T) {
+	// A fence the model never closed counts once the response is complete
+	found := stream([]string{"```bash\nls -la\n", "pwd"})
+	if want := []string{"ls -la", "pwd"}; !reflect.DeepEqual(found[1], want) {
+		t.Errorf("found %q, want %q", found[1], want)
+	}
+}
+
+func TestExtractorReplacedText(t *testing.T) {
+	var e Extractor
+	e.Update("@run[df -h]\n", false)
+	got := e.Update("@run[ls]", true)
+	if want := []string{"ls"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("found %q after the text was replaced, want %q", got, want)
+	}
+}
+
+func TestExtractorMatchesParseCommands(t *testing.T) {
+	response := "Check the disk:\n\n```bash\ndf -h\n```\n\nOr per directory @run[du -sh *]\n"
+	var e Extractor
+	var got []string
+	for i := 1; i <= len(response); i++ {
+		got = e.Update(response[:i], i == len(response))
+	}
+	// The order may differ, commands are appended as they complete while ParseCommands puts @run ones first
+	want := ParseCommands(response)
+	if !sameSet(got, want) {
+		t.Errorf("streaming byte by byte found %q, ParseCommands %q", got, want)
+	}
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, s := range a {
+		if !contains(b, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Responses as Gemini, llama3 and GPT-4o write them are in testdata/responses, each .txt with the commands
+// expected from it one per line in the .commands file of the same name
+func TestParseCommandsFixtures(t *testing.T) {
+	responses, err := filepath.Glob(filepath.Join("testdata", "responses", "*.txt"))
+	if err != nil || len(responses) == 0 {
+		t.Fatalf("no fixtures found: %v", err)
+	}
+	for _, path := range responses {
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		t.Run(name, func(t *testing.T) {
+			response, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := os.ReadFile(strings.TrimSuffix(path, ".txt") + ".commands")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, line := range strings.Split(string(expected), "\n") {
+				if line != "" {
+					want = append(want, line)
+				}
+			}
+
+			got := ParseCommands(string(response))
+			if !reflect.DeepEqual(got, want) && !(len(got) == 0 && len(want) == 0) {
+				t.Errorf("ParseCommands found\n%q\nwant\n%q", got, want)
+			}
+
+			// Streaming the response in small chunks ends with the same commands
+			var e Extractor
+			var streamed []string
+			for i := 0; i < len(response); i += 7 {
+				end := min(i+7, len(response))
+				streamed = e.Update(string(response[:end]), end == len(response))
+			}
+			if !sameSet(streamed, want) {
+				t.Errorf("streaming found\n%q\nwant\n%q", streamed, want)
+			}
+		})
+	}
+}
+
+// The fixtures with Windows line endings give the same commands, without a CR left at the end of any of them
+func TestParseCommandsCRLFFixtures(t *testing.T) {
+	responses, _ := filepath.Glob(filepath.Join("testdata", "responses", "*.txt"))
+	for _, path := range responses {
+		response, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crlf := strings.ReplaceAll(string(response), "\n", "\r\n")
+		want := ParseCommands(string(response))
+		got := ParseCommands(crlf)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s with CRLF found %q, want %q", filepath.Base(path), got, want)
+		}
+
+		var e Extractor
+		var streamed []string
+		for i := 0; i < len(crlf); i += 5 {
+			end := min(i+5, len(crlf))
+			streamed = e.Update(crlf[:end], end == len(crlf))
+		}
+		for _, cmd := range streamed {
+			if strings.Contains(cmd, "\r") {
+				t.Errorf("%s streamed with CRLF found %q with a CR in it", filepath.Base(path), cmd)
+			}
+		}
+		if !sameSet(streamed, want) {
+			t.Errorf("%s streamed with CRLF found %q, want %q", filepath.Base(path), streamed, want)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// promptRule describes a command family that asks its own confirmation questions
+type promptRule struct {
+	Family      string
+	Programs    []string
+	Operations  []string // Subcommands (or pacman style operation flags) that prompt
+	Removals    []string // The prompting operations that remove things
+	YesFlags    []string // Any of these already makes the command non-interactive
+	AddFlag     string   // Flag added to make the command non-interactive, empty if there is none
+	FlagIsFirst bool     // The flag goes before the operation instead of after it (zypper)
+}
+
+// Table of known commands that prompt, extend it rather than adding special cases to the code
+var promptRules = []promptRule{
+	{
+		Family:     "apt",
+		Programs:   []string{"apt", "apt-get"},
+		Operations: []string{"install", "upgrade", "full-upgrade", "dist-upgrade", "remove", "purge", "autoremove", "reinstall"},
+		Removals:   []string{"remove", "purge", "autoremove"},
+		YesFlags:   []string{"-y", "--yes", "--assume-yes", "-qq"},
+		AddFlag:    "-y",
+	},
+	{
+		Family:     "dnf",
+		Programs:   []string{"dnf", "yum", "microdnf"},
+		Operations: []string{"install", "upgrade", "update", "remove", "erase", "autoremove", "reinstall", "downgrade"},
+		Removals:   []string{"remove", "erase", "autoremove"},
+		YesFlags:   []string{"-y", "--assumeyes"},
+		AddFlag:    "-y",
+	},
+	{
+		Family:     "pacman",
+		Programs:   []string{"pacman", "yay", "paru"},
+		Operations: []string{"-S", "-Sy", "-Syu", "-Syyu", "-Su", "-U", "-R", "-Rs", "-Rns", "-Rsc", "--sync", "--upgrade", "--remove"},
+		Removals:   []string{"-R", "-Rs", "-Rns", "-Rsc", "--remove"},
+		YesFlags:   []string{"--noconfirm"},
+		AddFlag:    "--noconfirm",
+	},
+	{
+		Family:      "zypper",
+		Programs:    []string{"zypper"},
+		Operations:  []string{"install", "in", "update", "up", "dist-upgrade", "dup", "remove", "rm"},
+		Removals:    []string{"remove", "rm"},
+		YesFlags:    []string{"-n", "--non-interactive", "-y", "--no-confirm"},
+		AddFlag:     "--non-interactive",
+		FlagIsFirst: true,
+	},
+	{
+		// rm -i and cp -i prompt on purpose, there is no flag to add, they can only be passed through
+		Family:     "interactive-flag",
+		Programs:   []string{"rm", "cp", "mv"},
+		Operations: []string{"-i", "--interactive"},
+		Removals:   []string{"-i", "--interactive"},
+	},
+}
+
+// Interaction is a command detected to ask its own questions while running
+type Interaction struct {
+	Command string
+	Family  string
+	Removal bool
+	// Rewrite is the command with the non-interactive flag added, empty when it can't or mustn't be rewritten
+	Rewrite string
+}
+
+type token struct {
+	text       string
+	start, end int
+}
+
+// Splits a command into whitespace separated tokens, keeping quoted strings together and remembering offsets
+func tokenize(cmd string) []token {
+	var tokens []token
+	start := -1
+	var quote byte
+
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			if start < 0 {
+				start = i
+			}
+		case c == ' ' || c == '\t' || c == '\n':
+			if start >= 0 {
+				tokens = append(tokens, token{cmd[start:i], start, i})
+				start = -1
+			}
+		case c == ';':
+			if start >= 0 {
+				tokens = append(tokens, token{cmd[start:i], start, i})
+			}
+			tokens = append(tokens, token{";", i, i + 1})
+			start = -1
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{cmd[start:], start, len(cmd)})
+	}
+	return tokens
+}
+
+func isSeparator(t string) bool {
+	return t == "&&" || t == "||" || t == ";" || t == "|"
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectInteractive reports whether any part of the command will stop to ask the user something.
+// Removal operations are only rewritten when allowRemoval is set.
+func DetectInteractive(cmd string, allowRemoval bool) (Interaction, bool) {
+	tokens := tokenize(cmd)
+	found := false
+	interaction := Interaction{Command: cmd}
+	// Insertions are collected first and applied back to front so offsets stay valid
+	type insertion struct {
+		at   int
+		text string
+	}
+	var insertions []insertion
+	rewritable := true
+
+	for i := 0; i < len(tokens); {
+		// Find the end of this segment of the command
+		end := i
+		for end < len(tokens) && !isSeparator(tokens[end].text) {
+			end++
+		}
+		segment := tokens[i:end]
+		i = end + 1
+
+		// Skip privilege wrappers and environment assignments to get to the program
+		p := 0
+		for p < len(segment) && (segment[p].text == "sudo" || segment[p].text == "doas" || strings.Contains(segment[p].text, "=")) {
+			p++
+		}
+		if p >= len(segment) {
+			continue
+		}
+
+		for _, rule := range promptRules {
+			if !contains(rule.Programs, segment[p].text) {
+				continue
+			}
+
+			opIndex := -1
+			hasYes := false
+			for j := p + 1; j < len(segment); j++ {
+				if opIndex < 0 && contains(rule.Operations, segment[j].text) {
+					opIndex = j
+				}
+				if contains(rule.YesFlags, segment[j].text) {
+					hasYes = true
+				}
+			}
+			if opIndex < 0 || hasYes {
+				break
+			}
+
+			found = true
+			interaction.Family = rule.Family
+			removal := contains(rule.Removals, segment[opIndex].text)
+			interaction.Removal = interaction.Removal || removal
+
+			if rule.AddFlag == "" || (removal && !allowRemoval) {
+				rewritable = false
+				break
+			}
+			if rule.FlagIsFirst {
+				insertions = append(insertions, insertion{segment[p].end, " " + rule.AddFlag})
+			} else {
+				insertions = append(insertions, insertion{segment[opIndex].end, " " + rule.AddFlag})
+			}
+			break
+		}
+	}
+
+	if !found {
+		return Interaction{}, false
+	}
+
+	if rewritable {
+		rewrite := cmd
+		for k := len(insertions) - 1; k >= 0; k-- {
+			rewrite = rewrite[:insertions[k].at] + insertions[k].text + rewrite[insertions[k].at:]
+		}
+		interaction.Rewrite = rewrite
+	}
+	return interaction, true
+}
+
+// Returns the families of the commands that will prompt on their own, used for badges in the command list
+func InteractiveFamily(cmd string) string {
+	interaction, ok := DetectInteractive(cmd, false)
+	if !ok {
+		return ""
+	}
+	return interaction.Family
+}
+
+// Programs that take over the terminal or read from it, their output is never captured
+var terminalPrograms = []string{
+	"vi", "vim", "nvim", "nano", "emacs", "micro", "hx", "visudo", "vipw", "vigr", "sudoedit",
+	"less", "more", "most", "man", "top", "htop", "btop", "atop", "iotop", "watch", "fzf", "mc", "ncdu",
+	"ssh", "mosh", "sftp", "ftp", "telnet", "tmux", "screen", "passwd", "su", "read", "select",
+}
+
+// Subcommands and flags that turn otherwise ordinary programs into interactive ones
+var terminalOperations = map[string][]string{
+	"crontab":   {"-e"},
+	"systemctl": {"edit"},
+	"kubectl":   {"edit", "-it", "-ti"},
+	"docker":    {"-it", "-ti", "attach"},
+	"podman":    {"-it", "-ti", "attach"},
+	"git":       {"-p", "--patch", "-i", "--interactive"},
+}
+
+// NeedsTerminal reports whether any part of the command takes over the terminal, like an editor or pager,
+// reads input with read, or asks its own questions. Such commands always get the terminal itself.
+func NeedsTerminal(cmd string) bool {
+	if _, ok := DetectInteractive(cmd, true); ok {
+		return true
+	}
+	tokens := tokenize(cmd)
+	for i := 0; i < len(tokens); {
+		end := i
+		for end < len(tokens) && !isSeparator(tokens[end].text) {
+			end++
+		}
+		segment := tokens[i:end]
+		i = end + 1
+
+		// Skip privilege wrappers and environment assignments to get to the program
+		p := 0
+		for p < len(segment) && (segment[p].text == "sudo" || segment[p].text == "doas" || strings.Contains(segment[p].text, "=")) {
+			p++
+		}
+		if p >= len(segment) {
+			continue
+		}
+		program := segment[p].text
+		if j := strings.LastIndexByte(program, '/'); j >= 0 {
+			program = program[j+1:]
+		}
+		if contains(terminalPrograms, program) {
+			return true
+		}
+		for _, t := range segment[p+1:] {
+			if contains(terminalOperations[program], t.text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Ways of handling a command that asks its own questions, remembered per family in the prompt_choices setting
+const (
+	ChoiceFlag        = "flag"        // Add the non-interactive flag
+	ChoicePassthrough = "passthrough" // Leave the questions to the user
+)
+
+// ParseChoices parses the prompt_choices setting, e.g. apt=flag,pacman=passthrough, into the choice per family
+func ParseChoices(val string) (map[string]string, error) {
+	choices := map[string]string{}
+	for _, pair := range strings.Split(val, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		family, choice, ok := strings.Cut(pair, "=")
+		family, choice = strings.TrimSpace(family), strings.TrimSpace(choice)
+		if !ok || family == "" {
+			return nil, fmt.Errorf("%q is not family=choice", pair)
+		}
+		if choice != ChoiceFlag && choice != ChoicePassthrough {
+			return nil, fmt.Errorf("the choice for %s must be %s or %s", family, ChoiceFlag, ChoicePassthrough)
+		}
+		choices[family] = choice
+	}
+	return choices, nil
+}
+
+// FormatChoices is the reverse of ParseChoices, with the families sorted
+func FormatChoices(choices map[string]string) string {
+	families := make([]string, 0, len(choices))
+	for family := range choices {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+	pairs := make([]string, len(families))
+	for i, family := range families {
+		pairs[i] = family + "=" + choices[family]
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestDetectInteractive(t *testing.T) {
+	tests := []struct {
+		cmd          string
+		allowRemoval bool
+		family       string // Empty when the command doesn't prompt
+		removal      bool
+		rewrite      string
+	}{
+		{cmd: "ls -la"},
+		{cmd: "sudo apt install -y nginx"},
+		{cmd: "sudo apt-get -qq install curl"},
+		{cmd: "pacman -Syu --noconfirm"},
+		{cmd: "sudo apt install nginx", family: "apt", rewrite: "sudo apt install -y nginx"},
+		{cmd: "DEBIAN_FRONTEND=noninteractive apt-get upgrade", family: "apt", rewrite: "DEBIAN_FRONTEND=noninteractive apt-get upgrade -y"},
+		{cmd: "sudo apt update && sudo apt upgrade", family: "apt", rewrite: "sudo apt update && sudo apt upgrade -y"},
+		{cmd: "sudo dnf install htop", family: "dnf", rewrite: "sudo dnf install -y htop"},
+		{cmd: "sudo pacman -S firefox", family: "pacman", rewrite: "sudo pacman -S --noconfirm firefox"},
+		{cmd: "yay -Syu", family: "pacman", rewrite: "yay -Syu --noconfirm"},
+		{cmd: "sudo zypper install vim", family: "zypper", rewrite: "sudo zypper --non-interactive install vim"},
+		{cmd: `sudo apt install "python3-pip"; echo done`, family: "apt", rewrite: `sudo apt install -y "python3-pip"; echo done`},
+
+		// Removals are only ever rewritten when allowed with --yes-removals
+		{cmd: "sudo apt remove nginx", family: "apt", removal: true},
+		{cmd: "sudo apt purge nginx", family: "apt", removal: true},
+		{cmd: "sudo apt autoremove", family: "apt", removal: true},
+		{cmd: "sudo dnf erase htop", family: "dnf", removal: true},
+		{cmd: "sudo pacman -Rns firefox", family: "pacman", removal: true},
+		{cmd: "sudo zypper rm vim", family: "zypper", removal: true},
+		{cmd: "sudo apt remove nginx", allowRemoval: true, family: "apt", removal: true, rewrite: "sudo apt remove -y nginx"},
+		{cmd: "sudo pacman -Rns firefox", allowRemoval: true, family: "pacman", removal: true, rewrite: "sudo pacman -Rns --noconfirm firefox"},
+
+		// An install chained with a removal isn't half rewritten
+		{cmd: "sudo apt install nginx && sudo apt remove apache2", family: "apt", removal: true},
+
+		// rm -i prompts on purpose, there's no flag to add
+		{cmd: "rm -i *.log", family: "interactive-flag", removal: true},
+		{cmd: "rm -i *.log", allowRemoval: true, family: "interactive-flag", removal: true},
+	}
+
+	for _, test := range tests {
+		interaction, ok := DetectInteractive(test.cmd, test.allowRemoval)
+		if ok != (test.family != "") {
+			t.Errorf("DetectInteractive(%q) found = %v, want %v", test.cmd, ok, test.family != "")
+			continue
+		}
+		if !ok {
+			continue
+		}
+		want := Interaction{Command: test.cmd, Family: test.family, Removal: test.removal, Rewrite: test.rewrite}
+		if !reflect.DeepEqual(interaction, want) {
+			t.Errorf("DetectInteractive(%q, %v) = %+v, want %+v", test.cmd, test.allowRemoval, interaction, want)
+		}
+	}
+}
+
+// Every removal operation of every family stays as it is without --yes-removals
+func TestNoYesFlagOnRemovals(t *testing.T) {
+	for _, rule := range promptRules {
+		for _, program := range rule.Programs {
+			for _, op := range rule.Removals {
+				cmd := "sudo " + program + " " + op + " somepackage"
+				interaction, ok := DetectInteractive(cmd, false)
+				if !ok {
+					t.Errorf("DetectInteractive(%q) didn't detect the removal", cmd)
+					continue
+				}
+				if !interaction.Removal || interaction.Rewrite != "" {
+					t.Errorf("DetectInteractive(%q) = %+v, want a removal without a rewrite", cmd, interaction)
+				}
+			}
+		}
+	}
+}
+
+// The rewrites are still commands a shell accepts, with nothing but the flag added
+func TestRewritesAreValidCommands(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to check the syntax with")
+	}
+	cmds := []string{
+		"sudo apt install nginx",
+		`sudo apt install "python3-pip" 'libssl-dev'`,
+		"sudo apt update && sudo apt upgrade; sudo apt install -y git",
+		"sudo zypper install vim | tee log",
+		"sudo pacman -Syu",
+		"sudo apt remove nginx",
+	}
+	for _, cmd := range cmds {
+		interaction, ok := DetectInteractive(cmd, true)
+		if !ok || interaction.Rewrite == "" {
+			t.Errorf("DetectInteractive(%q) = %+v, want a rewrite", cmd, interaction)
+			continue
+		}
+		if out, err := exec.Command(sh, "-n", "-c", interaction.Rewrite).CombinedOutput(); err != nil {
+			t.Errorf("the rewrite %q isn't valid shell: %v %s", interaction.Rewrite, err, out)
+		}
+
+		// Taking the one added flag out again gives the original tokens back
+		var before, after []string
+		for _, tok := range tokenize(cmd) {
+			before = append(before, tok.text)
+		}
+		for _, tok := range tokenize(interaction.Rewrite) {
+			after = append(after, tok.text)
+		}
+		added := -1
+		for i := range after {
+			if i >= len(before) || after[i] != before[i] {
+				added = i
+				break
+			}
+		}
+		if added < 0 || !reflect.DeepEqual(append(after[:added:added], after[added+1:]...), before) {
+			t.Errorf("the rewrite %q of %q changed more than the flag", interaction.Rewrite, cmd)
+		}
+	}
+}
+
+func TestNeedsTerminal(t *testing.T) {
+	for cmd, want := range map[string]bool{
+		"vim /etc/hosts":          true,
+		"sudo /usr/bin/nano file": true,
+		"crontab -e":              true,
+		"crontab -l":              false,
+		"docker exec -it web sh":  true,
+		"docker ps":               false,
+		"git add -p":              true,
+		"ls | less":               true,
+		"read x && echo got:$x":   true,
+		"sudo apt install nginx":  true,
+		"df -h":                   false,
+		"echo vim":                false,
+	} {
+		if got := NeedsTerminal(cmd); got != want {
+			t.Errorf("NeedsTerminal(%q) = %v, want %v", cmd, got, want)
+		}
+	}
+}
+
+func TestChoices(t *testing.T) {
+	choices, err := ParseChoices(" apt=flag, pacman=passthrough ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"apt": ChoiceFlag, "pacman": ChoicePassthrough}; !reflect.DeepEqual(choices, want) {
+		t.Errorf("ParseChoices() = %v, want %v", choices, want)
+	}
+	if got := FormatChoices(choices); got != "apt=flag,pacman=passthrough" {
+		t.Errorf("FormatChoices() = %q", got)
+	}
+	for _, bad := range []string{"apt", "=flag", "apt=yes"} {
+		if _, err := ParseChoices(bad); err == nil {
+			t.Errorf("ParseChoices(%q) succeeded, want an error", bad)
+		}
+	}
+	if choices, err := ParseChoices(""); err != nil || len(choices) != 0 {
+		t.Errorf("ParseChoices(\"\") = %v, %v, want no choices", choices, err)
+	}
+}
@@ -0,0 +1,12 @@
+package commands
+
+import "strings"
+
+// Returns the raw response as -o writes it, with withCommands followed by its commands in a fenced bash block
+func OutputFile(responseContent string, withCommands bool) string {
+	content := strings.TrimRight(responseContent, "\n") + "\n"
+	if cmds := ParseCommands(responseContent); withCommands && len(cmds) > 0 {
+		content += "\n```bash\n" + strings.Join(cmds, "\n") + "\n```\n"
+	}
+	return content
+}
@@ -0,0 +1,19 @@
+package commands
+
+import (
+	"os/exec"
+
+	"github.com/micr0-dev/lexido/pkg/ssh"
+)
+
+// Target, when set, is the user@host or ~/.ssh/config alias the commands run on over ssh instead of this machine.
+// They run in the home directory there, through the login shell of the remote user.
+var Target string
+
+// Builds the process that runs a suggested command, here or on Target
+func newCommand(cmdStr string) *exec.Cmd {
+	if Target != "" {
+		return ssh.Command(Target, true, cmdStr)
+	}
+	return shellCommand(cmdStr)
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrScriptExists means the script would overwrite a file, which needs --force
+var ErrScriptExists = errors.New("file already exists, use --force to overwrite it")
+
+// Writes the commands to an executable bash script with the prompt that produced them in its header
+func WriteScript(path string, commands []string, userPrompt string, force bool) error {
+	if len(commands) == 0 {
+		return errors.New("there are no commands to save")
+	}
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s: %w", path, ErrScriptExists)
+	}
+
+	var s strings.Builder
+	s.WriteString("#!/usr/bin/env bash\n")
+	s.WriteString("# Generated by lexido on " + time.Now().Format(time.RFC3339) + "\n")
+	if prompt := strings.TrimSpace(userPrompt); prompt != "" {
+		s.WriteString("#\n# Prompt:\n")
+		for _, line := range strings.Split(prompt, "\n") {
+			s.WriteString(strings.TrimRight("#   "+line, " ") + "\n")
+		}
+	}
+	s.WriteString("\nset -euo pipefail\n\n")
+	for _, cmd := range commands {
+		if strings.TrimSpace(cmd) == "" {
+			continue
+		}
+		s.WriteString(cmd + "\n")
+	}
+
+	if err := os.WriteFile(path, []byte(s.String()), 0755); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file it overwrites
+	return os.Chmod(path, 0755)
+}
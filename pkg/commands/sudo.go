@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/format"
+)
+
+// How often the sudo timestamp is refreshed while a batch runs, sudo forgets the password after 5 minutes by default
+const sudoRefreshInterval = time.Minute
+
+// sudo at the start of a command or of a part of it, followed by the program rather than an option of sudo
+var sudoPrefix = regexp.MustCompile(`(^|&&|\|\||;|\|)(\s*)sudo\s+([^-\s])`)
+
+// Reports whether lexido runs as root, where sudo is only in the way
+func isRoot() bool {
+	return runtime.GOOS != "windows" && os.Geteuid() == 0
+}
+
+func hasBin(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// adjustSudo fits a command using sudo to the machine: root doesn't need it, and doas stands in where sudo
+// isn't installed. The note says what was changed, or warns when neither is there.
+func adjustSudo(cmdStr string) (string, string) {
+	if !sudoPrefix.MatchString(cmdStr) {
+		return cmdStr, ""
+	}
+	switch {
+	case isRoot():
+		return sudoPrefix.ReplaceAllString(cmdStr, "$1$2$3"), "already root, sudo left out"
+	case hasBin("sudo"):
+		return cmdStr, ""
+	case hasBin("doas"):
+		return sudoPrefix.ReplaceAllString(cmdStr, "${1}${2}doas $3"), "sudo isn't installed, ran with doas"
+	}
+	return cmdStr, "sudo isn't installed, the command will likely fail"
+}
+
+// prepareSudo adjusts the commands with adjustSudo and, when some of them still use sudo, asks for the password
+// once before the first one runs and keeps it fresh until stop is called. On a Target sudo asks there itself.
+func prepareSudo(commands []string) (adjusted []string, notes []string, stop func()) {
+	if Target != "" {
+		return commands, make([]string, len(commands)), func() {}
+	}
+	needsSudo := false
+	for _, cmdStr := range commands {
+		cmdStr, note := adjustSudo(cmdStr)
+		adjusted = append(adjusted, cmdStr)
+		notes = append(notes, note)
+		needsSudo = needsSudo || sudoPrefix.MatchString(cmdStr)
+	}
+	if !needsSudo || !hasBin("sudo") {
+		return adjusted, notes, func() {}
+	}
+
+	fmt.Print(format.Styled("\033[2mSome commands use sudo, asking for the password before they start.\033[0m\n"))
+	restoreTerminal()
+	validate := exec.Command("sudo", "-v")
+	validate.Stdin, validate.Stdout, validate.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := validate.Run(); err != nil {
+		fmt.Printf("Warning: sudo -v failed (%v), the sudo commands will ask again.\n", err)
+		return adjusted, notes, func() {}
+	}
+
+	// Refresh the timestamp without asking, so a long batch doesn't stop for the password halfway
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(sudoRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				exec.Command("sudo", "-n", "-v").Run()
+			}
+		}
+	}()
+	return adjusted, notes, func() { close(done) }
+}
+
+// Prints what adjustSudo changed about a command before it runs
+func printSudoNote(cmdStr string, note string) {
+	if note != "" {
+		fmt.Print(format.Styled(fmt.Sprintf("\033[2m%s: %s\033[0m\n", cmdStr, note)))
+	}
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// The state of the terminal when lexido started
+var savedTerminal *term.State
+
+// SaveTerminal remembers the state of the terminal, so commands get it back like that even when the TUI
+// left it in raw mode. Call it before anything changes the terminal.
+func SaveTerminal() {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return
+	}
+	if state, err := term.GetState(os.Stdin.Fd()); err == nil {
+		savedTerminal = state
+	}
+}
+
+// Puts the terminal back into the state it was in when lexido started, usually cooked mode with echo
+func restoreTerminal() {
+	if savedTerminal != nil {
+		term.Restore(os.Stdin.Fd(), savedTerminal)
+	}
+}
+
+// AskYesNo prints the question and takes the answer from a single key press, without waiting for Enter: y and n
+// answer, Enter picks the default and any other key, Ctrl-C too, is a no. The answer is echoed on the line.
+// When stdin isn't a terminal a line is read instead.
+func AskYesNo(question string, defaultYes bool) bool {
+	// Raw before the question shows, so a key pressed right away isn't echoed or waits for Enter
+	state, err := term.MakeRaw(os.Stdin.Fd())
+	fmt.Print(question)
+	if err != nil {
+		switch strings.ToLower(strings.TrimSpace(ReadLine())) {
+		case "":
+			return defaultYes
+		case "y", "yes":
+			return true
+		}
+		return false
+	}
+
+	// Keys such as the arrows send several bytes at once, they are read together and taken as a no
+	buf := make([]byte, 16)
+	n, _ := os.Stdin.Read(buf)
+	term.Restore(os.Stdin.Fd(), state)
+	key := strings.ToLower(string(buf[:n]))
+	yes := key == "y" || (defaultYes && (key == "\r" || key == "\n"))
+	if yes {
+		fmt.Println("y")
+	} else {
+		fmt.Println("n")
+	}
+	return yes
+}
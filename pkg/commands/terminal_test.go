@@ -0,0 +1,184 @@
+//go:build linux
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"golang.org/x/sys/unix"
+)
+
+// Opens a pseudo terminal, the slave end stands in for the terminal lexido runs in
+func openPty(t *testing.T) (master *os.File, slave *os.File) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminals: %v", err)
+	}
+	if err := unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		t.Skipf("unlocking the pseudo terminal: %v", err)
+	}
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		t.Skipf("naming the pseudo terminal: %v", err)
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Skipf("opening the pseudo terminal: %v", err)
+	}
+	t.Cleanup(func() {
+		slave.Close()
+		master.Close()
+	})
+	return master, slave
+}
+
+// Types into the terminal like a user once the output shows the prompt, and keeps everything it showed
+type typist struct {
+	mu     sync.Mutex
+	output bytes.Buffer
+	done   chan struct{}
+}
+
+func typeAfter(master *os.File, prompt string, input string) *typist {
+	ty := &typist{done: make(chan struct{})}
+	go func() {
+		defer close(ty.done)
+		typed := false
+		buf := make([]byte, 1024)
+		for {
+			n, err := master.Read(buf)
+			ty.mu.Lock()
+			ty.output.Write(buf[:n])
+			shown := ty.output.String()
+			ty.mu.Unlock()
+			if !typed && strings.Contains(shown, prompt) {
+				master.Write([]byte(input))
+				typed = true
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ty
+}
+
+func (ty *typist) shown() string {
+	ty.mu.Lock()
+	defer ty.mu.Unlock()
+	return ty.output.String()
+}
+
+func TestRunCommandsPassesTheTerminal(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	master, slave := openPty(t)
+
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = slave, slave
+	defer func() { os.Stdin, os.Stdout = stdin, stdout }()
+	savedTerminal = nil
+	defer func() { savedTerminal = nil }()
+
+	// The TUI leaves the terminal in raw mode, the command gets it back cooked like it was at the start
+	SaveTerminal()
+	if _, err := term.MakeRaw(slave.Fd()); err != nil {
+		t.Fatal(err)
+	}
+	// Capturing the output for a follow-up question leaves commands that read the terminal alone
+	var captured bytes.Buffer
+	Capture = &captured
+	defer func() { Capture = nil }()
+
+	ty := typeAfter(master, "ready", "hello\n")
+	err := RunCommands([]string{`echo ready; read x && echo got:$x; [ -t 0 ] && [ -t 1 ] && echo on-a-tty`}, t.TempDir())
+	if err != nil {
+		t.Fatalf("RunCommands() = %v, output %q", err, ty.shown())
+	}
+
+	// Everything the command printed is read before the terminal is closed
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(ty.shown(), "on-a-tty") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	shown := ty.shown()
+	if !strings.Contains(shown, "got:hello") {
+		t.Errorf("the terminal showed %q, want the typed line read by the command", shown)
+	}
+	if !strings.Contains(shown, "on-a-tty") {
+		t.Errorf("the terminal showed %q, want the command to have the terminal as stdin and stdout", shown)
+	}
+	// Cooked mode echoes what was typed and turns the newline into \r\n
+	if !strings.Contains(shown, "hello\r\n") {
+		t.Errorf("the terminal showed %q, want the input echoed in cooked mode", shown)
+	}
+	if captured.Len() != 0 {
+		t.Errorf("captured %q from a command reading the terminal, want nothing", captured.String())
+	}
+
+	slave.Close()
+	<-ty.done
+}
+
+func TestAskYesNoTakesOneKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		defaultYes bool
+		want       bool
+	}{
+		{"y", "y", false, true},
+		{"capital Y", "Y", false, true},
+		{"n", "n", true, false},
+		{"enter picks yes", "\r", true, true},
+		{"enter picks no", "\r", false, false},
+		{"ctrl-c", "\x03", true, false},
+		{"arrow key", "\x1b[A", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			master, slave := openPty(t)
+			stdin, stdout := os.Stdin, os.Stdout
+			os.Stdin, os.Stdout = slave, slave
+			defer func() { os.Stdin, os.Stdout = stdin, stdout }()
+
+			// No newline follows the key, the answer doesn't wait for one
+			ty := typeAfter(master, "instead?", test.key)
+			if got := AskYesNo("Use the local ollama instead? [Y/n] ", test.defaultYes); got != test.want {
+				t.Errorf("AskYesNo() after %q = %v, want %v", test.key, got, test.want)
+			}
+			termios, err := unix.IoctlGetTermios(int(slave.Fd()), unix.TCGETS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if termios.Lflag&unix.ICANON == 0 || termios.Lflag&unix.ECHO == 0 {
+				t.Errorf("the terminal was left in raw mode")
+			}
+			want := "n"
+			if test.want {
+				want = "y"
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for !strings.Contains(ty.shown(), "[Y/n] "+want) && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if shown := ty.shown(); !strings.Contains(shown, "[Y/n] "+want) {
+				t.Errorf("the terminal showed %q, want the answer %q echoed", shown, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/audit"
+	"github.com/micr0-dev/lexido/pkg/ssh"
+)
+
+// Status of the commands in the audit log that were sent to tmux, lexido doesn't see how they end
+const tmuxStatus = "dispatched to tmux"
+
+// InTmux reports whether lexido runs inside a tmux session
+func InTmux() bool {
+	return os.Getenv("TMUX") != ""
+}
+
+// TmuxLayout says where DispatchTmux sends the commands
+type TmuxLayout struct {
+	Window bool // A new window instead of a pane split off the one lexido runs in
+	Chain  bool // All commands in one pane joined with &&, instead of one pane each
+}
+
+// DispatchTmux types the commands into new tmux panes or windows, each starting in dir, and returns without
+// waiting for them. The panes keep their shell, so the output of tail -f or a build stays around afterwards.
+func DispatchTmux(commands []string, dir string, layout TmuxLayout) error {
+	var lines []string
+	for _, cmdStr := range commands {
+		if strings.TrimSpace(cmdStr) == "" {
+			continue
+		}
+		// Nothing is asked for up front, sudo asks in the pane it runs in
+		cmdStr, note := adjustSudo(cmdStr)
+		printSudoNote(cmdStr, note)
+		lines = append(lines, cmdStr)
+	}
+	if layout.Chain && len(lines) > 1 {
+		lines = []string{strings.Join(lines, " && ")}
+	}
+
+	for _, line := range lines {
+		typed := line
+		if Target != "" {
+			typed = ssh.CommandLine(Target, true, line)
+		}
+		if err := sendToTmux(typed, dir, layout.Window); err != nil {
+			return err
+		}
+		auditDir := dir
+		if Target != "" {
+			auditDir = Target + ":~"
+		}
+		audit.RecordDispatched(line, auditDir, tmuxStatus)
+	}
+	return nil
+}
+
+// Opens a pane or window in dir without switching to it and types line into its shell
+func sendToTmux(line string, dir string, window bool) error {
+	open := []string{"split-window", "-d", "-P", "-F", "#{pane_id}", "-c", dir}
+	if window {
+		open = []string{"new-window", "-d", "-P", "-F", "#{pane_id}", "-c", dir}
+	}
+	out, err := exec.Command("tmux", open...).Output()
+	if err != nil {
+		return fmt.Errorf("could not open a tmux %s: %w", open[0], err)
+	}
+	pane := strings.TrimSpace(string(out))
+	// -l types the line literally, so words like Enter or C-c in it aren't read as keys
+	if err := exec.Command("tmux", "send-keys", "-t", pane, "-l", line).Run(); err != nil {
+		return fmt.Errorf("could not send the command to tmux pane %s: %w", pane, err)
+	}
+	return exec.Command("tmux", "send-keys", "-t", pane, "Enter").Run()
+}
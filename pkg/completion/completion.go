@@ -0,0 +1,287 @@
+package completion
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of values a flag takes, used to pick how the shell completes them
+const (
+	ValueNone      = ""          // Boolean flag
+	ValueAny       = "any"       // Free text, nothing to complete
+	ValueDirectory = "directory" // A directory
+	ValueCommand   = "command"   // The name of a binary on PATH
+	ValueModel     = "model"     // An installed ollama model, completed through `lexido __complete models`
+	ValueChoice    = "choice"    // One of Flag.Choices
+)
+
+// Flag describes a command line flag for the completion scripts
+type Flag struct {
+	Name        string
+	Description string
+	Value       string
+	Choices     []string
+}
+
+// Dash returns the flag as written in the help, single letter flags take one dash
+func (f Flag) Dash() string {
+	if len(f.Name) == 1 {
+		return "-" + f.Name
+	}
+	return "--" + f.Name
+}
+
+// Subcommand describes a subcommand and the words accepted at each position after it
+type Subcommand struct {
+	Name        string
+	Description string
+	Words       [][]string
+}
+
+// Spec is everything the completion scripts know about the command line
+type Spec struct {
+	Program     string
+	Flags       []Flag
+	Subcommands []Subcommand
+}
+
+// Shells that completion scripts can be generated for
+var Shells = []string{"bash", "zsh", "fish"}
+
+// Generate returns the completion script for the given shell
+func Generate(shell string, spec Spec) (string, error) {
+	sort.Slice(spec.Flags, func(i, j int) bool { return spec.Flags[i].Name < spec.Flags[j].Name })
+	sort.Slice(spec.Subcommands, func(i, j int) bool { return spec.Subcommands[i].Name < spec.Subcommands[j].Name })
+
+	switch shell {
+	case "bash":
+		return bash(spec), nil
+	case "zsh":
+		return zsh(spec), nil
+	case "fish":
+		return fish(spec), nil
+	}
+	return "", fmt.Errorf("unsupported shell %q, use one of %s", shell, strings.Join(Shells, ", "))
+}
+
+// Returns the names of the flags taking a value, in both the - and -- forms Go accepts
+func valueFlagPatterns(spec Spec) string {
+	var patterns []string
+	for _, f := range spec.Flags {
+		if f.Value != ValueNone {
+			patterns = append(patterns, "-"+f.Name, "--"+f.Name)
+		}
+	}
+	return strings.Join(patterns, "|")
+}
+
+func bash(spec Spec) string {
+	fn := "_" + spec.Program
+	var s strings.Builder
+
+	var flagWords, subcommandNames []string
+	for _, f := range spec.Flags {
+		flagWords = append(flagWords, f.Dash())
+	}
+	for _, sub := range spec.Subcommands {
+		subcommandNames = append(subcommandNames, sub.Name)
+	}
+
+	fmt.Fprintf(&s, "# bash completion for %s, generated by `%s completion bash`\n", spec.Program, spec.Program)
+	fmt.Fprintf(&s, "%s() {\n", fn)
+	s.WriteString("    local cur prev word sub subpos i\n")
+	s.WriteString("    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	s.WriteString("    prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	s.WriteString("    COMPREPLY=()\n\n")
+
+	// Values of flags
+	s.WriteString("    case \"$prev\" in\n")
+	for _, f := range spec.Flags {
+		if f.Value == ValueNone {
+			continue
+		}
+		fmt.Fprintf(&s, "        -%s|--%s)\n", f.Name, f.Name)
+		switch f.Value {
+		case ValueDirectory:
+			s.WriteString("            COMPREPLY=( $(compgen -d -- \"$cur\") )\n")
+		case ValueCommand:
+			s.WriteString("            COMPREPLY=( $(compgen -c -- \"$cur\") )\n")
+		case ValueModel:
+			fmt.Fprintf(&s, "            COMPREPLY=( $(compgen -W \"$(%s __complete models 2>/dev/null)\" -- \"$cur\") )\n", spec.Program)
+		case ValueChoice:
+			fmt.Fprintf(&s, "            COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") )\n", strings.Join(f.Choices, " "))
+		}
+		s.WriteString("            return ;;\n")
+	}
+	s.WriteString("    esac\n\n")
+
+	// Find the subcommand, skipping flags and their values
+	s.WriteString("    sub=\"\"\n    subpos=0\n")
+	s.WriteString("    for (( i = 1; i < COMP_CWORD; i++ )); do\n")
+	s.WriteString("        word=\"${COMP_WORDS[i]}\"\n")
+	s.WriteString("        case \"$word\" in\n")
+	if patterns := valueFlagPatterns(spec); patterns != "" {
+		fmt.Fprintf(&s, "            %s) (( i++ )) ;;\n", patterns)
+	}
+	s.WriteString("            -*) ;;\n")
+	s.WriteString("            *) sub=\"$word\"; subpos=$i; break ;;\n")
+	s.WriteString("        esac\n")
+	s.WriteString("    done\n\n")
+
+	// Words after a subcommand
+	s.WriteString("    case \"$sub\" in\n")
+	for _, sub := range spec.Subcommands {
+		if len(sub.Words) == 0 {
+			continue
+		}
+		fmt.Fprintf(&s, "        %s)\n", sub.Name)
+		s.WriteString("            case $(( COMP_CWORD - subpos )) in\n")
+		for i, words := range sub.Words {
+			fmt.Fprintf(&s, "                %d) COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") ) ;;\n", i+1, strings.Join(words, " "))
+		}
+		s.WriteString("            esac\n")
+		s.WriteString("            return ;;\n")
+	}
+	s.WriteString("    esac\n\n")
+
+	s.WriteString("    if [[ \"$cur\" == -* ]]; then\n")
+	fmt.Fprintf(&s, "        COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") )\n", strings.Join(flagWords, " "))
+	s.WriteString("    elif [[ -z \"$sub\" ]]; then\n")
+	fmt.Fprintf(&s, "        COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") )\n", strings.Join(subcommandNames, " "))
+	s.WriteString("    fi\n")
+	s.WriteString("}\n")
+	fmt.Fprintf(&s, "complete -o default -F %s %s\n", fn, spec.Program)
+	return s.String()
+}
+
+// Escapes a description for use inside a single quoted zsh _arguments spec
+func zshEscape(text string) string {
+	r := strings.NewReplacer("'", "'\\''", "[", "\\[", "]", "\\]", ":", "\\:")
+	return r.Replace(text)
+}
+
+func zsh(spec Spec) string {
+	fn := "_" + spec.Program
+	var s strings.Builder
+
+	fmt.Fprintf(&s, "#compdef %s\n", spec.Program)
+	fmt.Fprintf(&s, "# zsh completion for %s, generated by `%s completion zsh`\n\n", spec.Program, spec.Program)
+
+	fmt.Fprintf(&s, "%s_models() {\n", fn)
+	s.WriteString("    local -a models\n")
+	fmt.Fprintf(&s, "    models=(${(f)\"$(%s __complete models 2>/dev/null)\"})\n", spec.Program)
+	s.WriteString("    _describe 'model' models\n")
+	s.WriteString("}\n\n")
+
+	fmt.Fprintf(&s, "%s() {\n", fn)
+	s.WriteString("    local curcontext=\"$curcontext\" state line\n")
+	s.WriteString("    typeset -A opt_args\n\n")
+	s.WriteString("    _arguments -C \\\n")
+	for _, f := range spec.Flags {
+		action := ""
+		switch f.Value {
+		case ValueAny:
+			action = ":value: "
+		case ValueDirectory:
+			action = ":directory:_files -/"
+		case ValueCommand:
+			action = ":command:_command_names"
+		case ValueModel:
+			action = ":model:" + fn + "_models"
+		case ValueChoice:
+			action = ":value:(" + strings.Join(f.Choices, " ") + ")"
+		}
+		fmt.Fprintf(&s, "        '%s[%s]%s' \\\n", f.Dash(), zshEscape(f.Description), action)
+	}
+	s.WriteString("        '1: :->subcommand' \\\n")
+	s.WriteString("        '*:: :->args'\n\n")
+
+	s.WriteString("    case $state in\n")
+	s.WriteString("        subcommand)\n")
+	s.WriteString("            local -a subcommands\n")
+	s.WriteString("            subcommands=(\n")
+	for _, sub := range spec.Subcommands {
+		fmt.Fprintf(&s, "                '%s:%s'\n", sub.Name, strings.ReplaceAll(sub.Description, "'", "'\\''"))
+	}
+	s.WriteString("            )\n")
+	s.WriteString("            _describe 'subcommand' subcommands\n")
+	s.WriteString("            ;;\n")
+	s.WriteString("        args)\n")
+	s.WriteString("            case $words[1] in\n")
+	for _, sub := range spec.Subcommands {
+		if len(sub.Words) == 0 {
+			continue
+		}
+		fmt.Fprintf(&s, "                %s)\n", sub.Name)
+		s.WriteString("                    case $CURRENT in\n")
+		for i, words := range sub.Words {
+			fmt.Fprintf(&s, "                        %d) compadd -- %s ;;\n", i+2, strings.Join(words, " "))
+		}
+		s.WriteString("                    esac\n")
+		s.WriteString("                    ;;\n")
+	}
+	s.WriteString("            esac\n")
+	s.WriteString("            ;;\n")
+	s.WriteString("    esac\n")
+	s.WriteString("}\n\n")
+	fmt.Fprintf(&s, "if [[ \"$funcstack[1]\" = \"%s\" ]]; then\n", fn)
+	fmt.Fprintf(&s, "    %s \"$@\"\n", fn)
+	s.WriteString("else\n")
+	fmt.Fprintf(&s, "    compdef %s %s\n", fn, spec.Program)
+	s.WriteString("fi\n")
+	return s.String()
+}
+
+// Quotes text for fish, which only treats \ and ' specially inside single quotes
+func fishQuote(text string) string {
+	return "'" + strings.NewReplacer("\\", "\\\\", "'", "\\'").Replace(text) + "'"
+}
+
+func fish(spec Spec) string {
+	var s strings.Builder
+	p := spec.Program
+
+	fmt.Fprintf(&s, "# fish completion for %s, generated by `%s completion fish`\n", p, p)
+	fmt.Fprintf(&s, "complete -c %s -f\n\n", p)
+
+	for _, f := range spec.Flags {
+		opt := "-l " + f.Name
+		if len(f.Name) == 1 {
+			opt = "-s " + f.Name
+		}
+		line := fmt.Sprintf("complete -c %s %s -d %s", p, opt, fishQuote(f.Description))
+		switch f.Value {
+		case ValueAny:
+			line += " -x"
+		case ValueDirectory:
+			line += " -x -a '(__fish_complete_directories)'"
+		case ValueCommand:
+			line += " -x -a '(__fish_complete_command)'"
+		case ValueModel:
+			line += fmt.Sprintf(" -x -a '(%s __complete models 2>/dev/null)'", p)
+		case ValueChoice:
+			line += " -x -a " + fishQuote(strings.Join(f.Choices, " "))
+		}
+		s.WriteString(line + "\n")
+	}
+	s.WriteString("\n")
+
+	for _, sub := range spec.Subcommands {
+		fmt.Fprintf(&s, "complete -c %s -n '__fish_use_subcommand' -a %s -d %s\n", p, sub.Name, fishQuote(sub.Description))
+	}
+	for _, sub := range spec.Subcommands {
+		// Fish can't count positions easily, each level is gated on the words of the previous one instead
+		for i, words := range sub.Words {
+			condition := "__fish_seen_subcommand_from " + sub.Name
+			if i > 0 {
+				condition += "; and __fish_seen_subcommand_from " + strings.Join(sub.Words[i-1], " ")
+			}
+			if i+1 < len(sub.Words) {
+				condition += "; and not __fish_seen_subcommand_from " + strings.Join(words, " ")
+			}
+			fmt.Fprintf(&s, "complete -c %s -n %s -a %s\n", p, fishQuote(condition), fishQuote(strings.Join(words, " ")))
+		}
+	}
+	return s.String()
+}
@@ -0,0 +1,116 @@
+package completion
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A spec with the kinds of flags lexido has and descriptions with the characters each shell quotes differently
+var testSpec = Spec{
+	Program: "lexido",
+	Flags: []Flag{
+		{Name: "l", Description: "Run with ollama, the model's default"},
+		{Name: "m", Description: "Temporarily use a `model` [ollama]", Value: ValueModel},
+		{Name: "setDefault", Description: `Set the default "mode": gemini/local/remote`, Value: ValueChoice, Choices: []string{"gemini", "local", "remote"}},
+		{Name: "setModel", Description: "Set the $OLLAMA_MODEL; saved", Value: ValueModel},
+		{Name: "run-in", Description: "Run in this `directory` & not the current one", Value: ValueDirectory},
+		{Name: "with-path", Description: "Prefer this binary (e.g. 'gnu sed')", Value: ValueCommand},
+		{Name: "history", Description: "Share 100% of the last N commands", Value: ValueAny},
+	},
+	Subcommands: []Subcommand{
+		{Name: "config", Description: "Inspect and change settings", Words: [][]string{{"list", "get", "set", "unset"}, {"history", "theme"}}},
+		{Name: "completion", Description: "Print the completion script of a shell", Words: [][]string{Shells}},
+		{Name: "man", Description: "Print the man page, it's roff"},
+	},
+}
+
+func generate(t *testing.T, shell string) string {
+	t.Helper()
+	script, err := Generate(shell, testSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestScriptsParse(t *testing.T) {
+	check := map[string][]string{
+		"bash": {"-n"},
+		"zsh":  {"-n"},
+		"fish": {"--no-execute"},
+	}
+	for _, shell := range Shells {
+		t.Run(shell, func(t *testing.T) {
+			path, err := exec.LookPath(shell)
+			if err != nil {
+				t.Skipf("%s isn't installed", shell)
+			}
+			file := filepath.Join(t.TempDir(), "lexido."+shell)
+			if err := os.WriteFile(file, []byte(generate(t, shell)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := exec.Command(path, append(check[shell], file)...).CombinedOutput(); err != nil {
+				t.Errorf("%s doesn't parse the script: %v\n%s", shell, err, out)
+			}
+		})
+	}
+}
+
+// Completes the words with the bash script, the last word is the one being completed
+func bashComplete(t *testing.T, script string, words ...string) []string {
+	t.Helper()
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash isn't installed")
+	}
+	var quoted []string
+	for _, word := range words {
+		quoted = append(quoted, "'"+strings.ReplaceAll(word, "'", `'\''`)+"'")
+	}
+	cmd := exec.Command(bash, "--norc", "--noprofile", "-c", `eval "$SCRIPT"
+COMP_WORDS=(`+strings.Join(quoted, " ")+`)
+COMP_CWORD=$(( ${#COMP_WORDS[@]} - 1 ))
+_lexido
+printf '%s\n' "${COMPREPLY[@]}"`)
+	cmd.Env = append(os.Environ(), "SCRIPT="+script)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("completing %q: %v\n%s", words, err, out)
+	}
+	return strings.Fields(string(out))
+}
+
+func TestBashCompletes(t *testing.T) {
+	script := generate(t, "bash")
+	tests := []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{"lexido", "--set"}, []string{"--setDefault", "--setModel"}},
+		{[]string{"lexido", "-"}, []string{"--history", "-l", "-m", "--run-in", "--setDefault", "--setModel", "--with-path"}},
+		{[]string{"lexido", "--setDefault", ""}, []string{"gemini", "local", "remote"}},
+		{[]string{"lexido", "-setDefault", "l"}, []string{"local"}},
+		{[]string{"lexido", "co"}, []string{"completion", "config"}},
+		{[]string{"lexido", "config", ""}, []string{"list", "get", "set", "unset"}},
+		{[]string{"lexido", "config", "set", "h"}, []string{"history"}},
+		{[]string{"lexido", "completion", "f"}, []string{"fish"}},
+		// The value of a flag isn't taken for the subcommand
+		{[]string{"lexido", "--history", "5", "config", "u"}, []string{"unset"}},
+		{[]string{"lexido", "-l", "config", "l"}, []string{"list"}},
+	}
+	for _, test := range tests {
+		if got := bashComplete(t, script, test.words...); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("completing %q = %q, want %q", test.words, got, test.want)
+		}
+	}
+}
+
+func TestGenerateUnknownShell(t *testing.T) {
+	if _, err := Generate("nu", testSpec); err == nil || !strings.Contains(err.Error(), "bash, zsh, fish") {
+		t.Errorf("Generate(nu) = %v, want the supported shells listed", err)
+	}
+}
@@ -0,0 +1,417 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/format"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/stats"
+)
+
+// Key is a setting that can be inspected and changed with `lexido config`
+type Key struct {
+	Name        string
+	Field       string // Name of the field in the keyring
+	Description string
+	Secret      bool
+	Validate    func(val string) error
+}
+
+// All settings known to lexido, the order is the one used by `lexido config list`
+var Keys = []Key{
+	{
+		Name:        "mode",
+		Field:       "MODE_DEFAULT",
+		Description: "Default mode lexido runs in (gemini, local, remote)",
+		Validate:    oneOf("gemini", "local", "remote"),
+	},
+	{
+		Name:        "ollama_model",
+		Field:       "OLLAMA_MODEL",
+		Description: "Default model used with ollama",
+	},
+	{
+		Name:        "context_gemini",
+		Field:       "CONTEXT_GEMINI",
+		Description: "Context window in tokens assumed for gemini when continuing conversations",
+		Validate:    positiveInt,
+	},
+	{
+		Name:        "context_local",
+		Field:       "CONTEXT_LOCAL",
+		Description: "Context window in tokens assumed for ollama when continuing conversations",
+		Validate:    positiveInt,
+	},
+	{
+		Name:        "context_remote",
+		Field:       "CONTEXT_REMOTE",
+		Description: "Context window in tokens assumed for remote when continuing conversations",
+		Validate:    positiveInt,
+	},
+	{
+		Name:        "ollama_options",
+		Field:       "OLLAMA_OPTIONS",
+		Description: "JSON object merged into the options of ollama requests, e.g. {\"num_ctx\": 8192}",
+	},
+	{
+		Name:        "temperature",
+		Field:       "TEMPERATURE",
+		Description: "Sampling temperature of every request, lower is more deterministic, e.g. 0.2 (gemini, ollama, remote with <TEMPERATURE>)",
+		Validate:    temperature,
+	},
+	{
+		Name:        "max_tokens",
+		Field:       "MAX_TOKENS",
+		Description: "Longest response in tokens (gemini, ollama, remote with <MAX_TOKENS>)",
+		Validate:    positiveInt,
+	},
+	{
+		Name:        "gemini_safety",
+		Field:       "GEMINI_SAFETY",
+		Description: "Gemini safety thresholds per category, e.g. harassment=block_none,dangerous_content=block_only_high",
+	},
+	{
+		Name:        "gemini_auth",
+		Field:       "GEMINI_AUTH",
+		Description: "How Gemini is reached: key for an AI Studio API key or vertex for Vertex AI with Application Default Credentials",
+		Validate:    oneOf("key", "vertex"),
+	},
+	{
+		Name:        "gcp_project",
+		Field:       "GCP_PROJECT",
+		Description: "GCP project Gemini is used in through Vertex AI",
+	},
+	{
+		Name:        "gcp_location",
+		Field:       "GCP_LOCATION",
+		Description: "Vertex AI location Gemini is used in, us-central1 by default",
+	},
+	{
+		Name:        "lang",
+		Field:       "RESPONSE_LANG",
+		Description: "Language of the explanations in responses, e.g. es, or auto to follow $LANG (default auto), commands aren't translated",
+		Validate:    language,
+	},
+	{
+		Name:        "preprompt",
+		Field:       "PREPROMPT",
+		Description: "Instructions added to the system prompt of every request, e.g. prefer doas over sudo (not with commit, alias, edit or the command-not-found handler)",
+	},
+	{
+		Name:        "fallback",
+		Field:       "FALLBACK",
+		Description: "Providers tried in order when one fails with an auth, rate limit or network error, e.g. gemini,ollama",
+		Validate:    providerList,
+	},
+	{
+		Name:        "offline_local",
+		Field:       "OFFLINE_LOCAL",
+		Description: "Use the local ollama without asking when Gemini or the remote API can't be reached (true or false)",
+		Validate:    boolean,
+	},
+	{
+		Name:        "max_attempts",
+		Field:       "MAX_ATTEMPTS",
+		Description: "Attempts made when the provider is rate limited or unavailable before giving up",
+		Validate:    positiveInt,
+	},
+	{
+		Name:        "timeout",
+		Field:       "TIMEOUT",
+		Description: "How long a single request may take before giving up, e.g. 90s or 5m",
+		Validate:    positiveDuration,
+	},
+	{
+		Name:        "wait_hint",
+		Field:       "WAIT_HINT",
+		Description: "How long the TUI waits for the first token before pointing at --timeout and Ctrl-C, e.g. 20s (default 10s)",
+		Validate:    positiveDuration,
+	},
+	{
+		Name:        "history",
+		Field:       "HISTORY",
+		Description: "Number of recent shell history entries included in the prompt, unset to leave history out",
+		Validate:    positiveInt,
+	},
+	{
+		Name:        "confirm_each",
+		Field:       "CONFIRM_EACH",
+		Description: "Ask before running each selected command (true or false)",
+		Validate:    boolean,
+	},
+	{
+		Name:        "audit",
+		Field:       "AUDIT",
+		Description: "Record every command lexido runs in audit.jsonl in the state directory (true or false, default true)",
+		Validate:    boolean,
+	},
+	{
+		Name:        "tmux_layout",
+		Field:       "TMUX_LAYOUT",
+		Description: "Where --tmux sends the commands: a new pane next to lexido or a new window (pane or window, default pane)",
+		Validate:    oneOf("pane", "window"),
+	},
+	{
+		Name:        "tmux_chain",
+		Field:       "TMUX_CHAIN",
+		Description: "Send the commands --tmux runs to one pane chained with && instead of one pane each (true or false)",
+		Validate:    boolean,
+	},
+	{
+		Name:        "update_check",
+		Field:       "UPDATE_CHECK",
+		Description: "Say in lexido -v when a newer release is out, checking GitHub at most once a day (true or false)",
+		Validate:    boolean,
+	},
+	{
+		Name:        "theme",
+		Field:       "THEME",
+		Description: "Colors of the TUI: dark, light, mono, or auto to pick dark or light from $COLORFGBG (default auto)",
+		Validate:    oneOf("auto", "dark", "light", "mono"),
+	},
+	{
+		Name:        "theme_colors",
+		Field:       "THEME_COLORS",
+		Description: "Colors overriding the theme, e.g. command=#268bd2,warning=136 (roles: response, command, selected, warning, error, footer, header)",
+		Validate:    themeColors,
+	},
+	{
+		Name:        "keys",
+		Field:       "KEYS",
+		Description: "Keys of the TUI, e.g. quit=ctrl+q,down=j down",
+	},
+	{
+		Name:        "mouse",
+		Field:       "MOUSE",
+		Description: "Click and scroll in the TUI, false keeps the terminal's own text selection working (default true)",
+		Validate:    boolean,
+	},
+	{
+		Name:        "pipe_limit",
+		Field:       "PIPE_LIMIT",
+		Description: "Most piped input sent to the model, e.g. 2M, the middle of longer input is left out (default 256K)",
+		Validate:    size,
+	},
+	{
+		Name:        "cache",
+		Field:       "CACHE",
+		Description: "Reuse the response to an identical prompt instead of asking again (true or false)",
+		Validate:    boolean,
+	},
+	{
+		Name:        "cache_ttl",
+		Field:       "CACHE_TTL",
+		Description: "How long cached responses are reused, e.g. 12h (default 24h)",
+		Validate:    positiveDuration,
+	},
+	{
+		Name:        "cache_max_size",
+		Field:       "CACHE_MAX_SIZE",
+		Description: "Size in MB the response cache may grow to before the oldest responses are dropped (default 10)",
+		Validate:    positiveInt,
+	},
+	{
+		Name:        "batch_delay",
+		Field:       "BATCH_DELAY",
+		Description: "Wait between the prompts of lexido batch, to stay below rate limits, e.g. 5s or 0s (default 1s)",
+		Validate:    duration,
+	},
+	{
+		Name:        "prices",
+		Field:       "PRICES",
+		Description: "JSON object of model prices in dollars per million tokens for lexido stats, e.g. {\"gpt-4o\": {\"prompt\": 5, \"response\": 15}}",
+		Validate:    prices,
+	},
+	{
+		Name:        "prompt_choices",
+		Field:       "PROMPT_CHOICES",
+		Description: "How commands that ask for confirmation are run, remembered per family with A or P, e.g. apt=flag,pacman=passthrough",
+		Validate:    promptChoices,
+	},
+	{
+		Name:        "google_ai_key",
+		Field:       "GOOGLE_AI_KEY",
+		Description: "API key used for Gemini",
+		Secret:      true,
+	},
+}
+
+var ErrUnknownKey = errors.New("unknown config key")
+
+// Register sets how the values of a key are checked, for the settings only another package understands, such as
+// the keys of the TUI. That package registers them in its init, so config doesn't depend on it. A detail, such as
+// the values the key takes, is added to the description.
+func Register(name string, detail string, validate func(val string) error) {
+	for i := range Keys {
+		if Keys[i].Name == name {
+			if detail != "" {
+				Keys[i].Description += " (" + detail + ")"
+			}
+			Keys[i].Validate = validate
+			return
+		}
+	}
+}
+
+// Finds a key by its config name or keyring field, case insensitively
+func Lookup(name string) (Key, error) {
+	for _, key := range Keys {
+		if strings.EqualFold(key.Name, name) || strings.EqualFold(key.Field, name) {
+			return key, nil
+		}
+	}
+	return Key{}, errs.Wrap(errs.ErrUsage, fmt.Errorf("%w %q, valid keys are: %s", ErrUnknownKey, name, strings.Join(Names(), ", ")))
+}
+
+// Returns the names of all known keys
+func Names() []string {
+	names := make([]string, len(Keys))
+	for i, key := range Keys {
+		names[i] = key.Name
+	}
+	return names
+}
+
+func Get(name string) (string, error) {
+	key, err := Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return io.ReadFromKeyring(key.Field)
+}
+
+func Set(name string, val string) error {
+	key, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+	if key.Validate != nil {
+		if err := key.Validate(val); err != nil {
+			return errs.Usagef("invalid value for %s: %w", key.Name, err)
+		}
+	}
+	return io.SaveToKeyring(key.Field, val)
+}
+
+func Unset(name string) error {
+	key, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+	return io.DeleteFromKeyring(key.Field)
+}
+
+// Masks a secret so only enough of it is shown to tell keys apart
+func Mask(val string) string {
+	if len(val) <= 8 {
+		return strings.Repeat("*", len(val))
+	}
+	return val[:4] + strings.Repeat("*", len(val)-8) + val[len(val)-4:]
+}
+
+func positiveInt(val string) error {
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		return errors.New("must be a positive number")
+	}
+	return nil
+}
+
+func temperature(val string) error {
+	t, err := strconv.ParseFloat(val, 64)
+	if err != nil || t < 0 {
+		return errors.New("must be a number of 0 or more, such as 0.2")
+	}
+	return nil
+}
+
+func positiveDuration(val string) error {
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		return errors.New("must be a positive duration such as 90s or 5m")
+	}
+	return nil
+}
+
+func duration(val string) error {
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		return errors.New("must be a duration such as 2s or 1m, or 0s")
+	}
+	return nil
+}
+
+func boolean(val string) error {
+	if _, err := strconv.ParseBool(val); err != nil {
+		return errors.New("must be true or false")
+	}
+	return nil
+}
+
+func language(val string) error {
+	if val == "" {
+		return errors.New("must be a language code such as es, or auto")
+	}
+	for _, r := range val {
+		if !unicode.IsLetter(r) && r != '-' && r != '_' {
+			return fmt.Errorf("%q is not a language code such as es, or auto", val)
+		}
+	}
+	return nil
+}
+
+func themeColors(val string) error {
+	for _, override := range strings.Split(val, ",") {
+		if strings.TrimSpace(override) == "" {
+			continue
+		}
+		if _, _, err := format.ParseOverride(override); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func promptChoices(val string) error {
+	_, err := commands.ParseChoices(val)
+	return err
+}
+
+func size(val string) error {
+	_, err := io.ParseSize(val)
+	return err
+}
+
+func prices(val string) error {
+	_, err := stats.ParsePrices(val)
+	return err
+}
+
+func providerList(val string) error {
+	for _, name := range strings.Split(val, ",") {
+		switch strings.TrimSpace(name) {
+		case "gemini", "local", "ollama", "remote", "mock":
+		default:
+			return fmt.Errorf("unknown provider %q, use gemini, ollama or remote separated by commas", strings.TrimSpace(name))
+		}
+	}
+	return nil
+}
+
+func oneOf(allowed ...string) func(string) error {
+	return func(val string) error {
+		for _, a := range allowed {
+			if val == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
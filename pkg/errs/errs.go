@@ -0,0 +1,101 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of failure lexido exits with a code of their own for, errors wrap them with %w or Wrap
+var (
+	ErrUsage       = errors.New("invalid usage")
+	ErrAuth        = errors.New("missing or invalid credentials")
+	ErrRateLimited = errors.New("rate limited")
+	ErrNetwork     = errors.New("network failure")
+	ErrBlocked     = errors.New("blocked by the safety filters")
+)
+
+// ErrNotFound is returned for settings and keys that were never saved
+var ErrNotFound = errors.New("not found")
+
+// Exit codes of lexido, scripts branch on these so they must never change
+const (
+	ExitOK          = 0
+	ExitFailure     = 1
+	ExitUsage       = 2
+	ExitAuth        = 3
+	ExitRateLimited = 4
+	ExitNetwork     = 5
+	ExitBlocked     = 6
+	ExitCommand     = 10 // Plus the exit code of the selected command that failed
+	ExitInterrupted = 130
+)
+
+// Highest exit code of a failed command, the ones above have meanings of their own to shells
+const maxCommandExit = 125
+
+// CommandError is a selected command that ran and failed
+type CommandError struct {
+	Command  string
+	ExitCode int // -1 when the command couldn't be started
+}
+
+func (e *CommandError) Error() string {
+	if e.ExitCode < 0 {
+		return fmt.Sprintf("command %q could not be started", e.Command)
+	}
+	return fmt.Sprintf("command %q exited with %d", e.Command, e.ExitCode)
+}
+
+// kindError marks err as one of the kinds above without changing its message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// Wraps err so errors.Is matches kind as well, its message stays the same
+func Wrap(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// Usagef returns a usage error with the formatted message
+func Usagef(format string, args ...any) error {
+	return Wrap(ErrUsage, fmt.Errorf(format, args...))
+}
+
+// Returns the exit code for err: one of the kinds, a failed command, or ExitFailure for anything else
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrUsage):
+		return ExitUsage
+	case errors.Is(err, ErrAuth):
+		return ExitAuth
+	case errors.Is(err, ErrRateLimited):
+		return ExitRateLimited
+	case errors.Is(err, ErrNetwork):
+		return ExitNetwork
+	case errors.Is(err, ErrBlocked):
+		return ExitBlocked
+	}
+
+	var cerr *CommandError
+	if errors.As(err, &cerr) {
+		if cerr.ExitCode < 1 {
+			return ExitCommand + 1
+		}
+		return min(ExitCommand+cerr.ExitCode, maxCommandExit)
+	}
+	return ExitFailure
+}
@@ -0,0 +1,160 @@
+package favorites
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+const favoritesFile = "favorites.jsonl"
+
+// ErrExists is returned when a command is saved that already is a favorite
+var ErrExists = errors.New("already a favorite")
+
+// Favorite is a command saved with * in the TUI, one line of the favorites file
+type Favorite struct {
+	Time     time.Time `json:"time"`
+	Command  string    `json:"command"`
+	Prompt   string    `json:"prompt,omitempty"` // What the command was suggested for
+	Provider string    `json:"provider,omitempty"`
+	Model    string    `json:"model,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+}
+
+// Returns the path of the favorites file
+func Path() (string, error) {
+	return io.GetFilePath(io.Data, favoritesFile)
+}
+
+// Loads the favorites in the order they were saved. A missing file means none were saved yet.
+func Load() ([]Favorite, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var favs []Favorite
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var fav Favorite
+		if err := json.Unmarshal(scanner.Bytes(), &fav); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		favs = append(favs, fav)
+	}
+	return favs, scanner.Err()
+}
+
+// Add appends a favorite, a command that was saved before returns ErrExists
+func Add(fav Favorite) error {
+	favs, err := Load()
+	if err != nil {
+		return err
+	}
+	for _, saved := range favs {
+		if saved.Command == fav.Command {
+			return ErrExists
+		}
+	}
+	fav.Time = time.Now()
+
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(fav)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Remove deletes the favorite with the number lexido fav list shows, counting from 1, and returns it
+func Remove(n int) (Favorite, error) {
+	favs, err := Load()
+	if err != nil {
+		return Favorite{}, err
+	}
+	if n < 1 || n > len(favs) {
+		return Favorite{}, fmt.Errorf("there is no favorite %d, lexido fav list shows their numbers", n)
+	}
+	removed := favs[n-1]
+	favs = append(favs[:n-1], favs[n:]...)
+
+	var buf strings.Builder
+	for _, fav := range favs {
+		line, err := json.Marshal(fav)
+		if err != nil {
+			return Favorite{}, err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	path, err := Path()
+	if err != nil {
+		return Favorite{}, err
+	}
+	// Written next to the file and renamed over it, an interrupted write leaves the old favorites intact
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0600); err != nil {
+		return Favorite{}, err
+	}
+	return removed, os.Rename(tmp, path)
+}
+
+// Reports whether the command, prompt or a tag of the favorite contains the text, ignoring case
+func (f Favorite) Matches(text string) bool {
+	text = strings.ToLower(text)
+	if strings.Contains(strings.ToLower(f.Command), text) || strings.Contains(strings.ToLower(f.Prompt), text) {
+		return true
+	}
+	for _, tag := range f.Tags {
+		if strings.Contains(strings.ToLower(tag), strings.TrimPrefix(text, "#")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTags splits tags typed like "disk, cleanup" or "#disk #cleanup"
+func ParseTags(text string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' }) {
+		tag = strings.TrimPrefix(tag, "#")
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
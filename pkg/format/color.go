@@ -0,0 +1,45 @@
+package format
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Color is whether output keeps its ANSI color codes, SetColor decides it from --color
+var Color = true
+
+// Reports whether output should be colored when --color is auto: not with NO_COLOR set, on a dumb terminal,
+// or when stdout isn't a terminal
+func autoColor() bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Sets Color from the --color mode, always, auto or never
+func SetColor(mode string) error {
+	switch mode {
+	case "always":
+		Color = true
+	case "", "auto":
+		Color = autoColor()
+	case "never":
+		Color = false
+	default:
+		return fmt.Errorf("invalid --color %q, use always, auto or never", mode)
+	}
+	return nil
+}
+
+var colorCodes = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// Returns the text as it should be printed, without its color codes when Color is off
+func Styled(text string) string {
+	if Color {
+		return text
+	}
+	return colorCodes.ReplaceAllString(text, "")
+}
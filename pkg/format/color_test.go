@@ -0,0 +1,54 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetColor(t *testing.T) {
+	defer func(was bool) { Color = was }(Color)
+	tests := []struct {
+		mode    string
+		noColor string
+		term    string
+		want    bool
+	}{
+		{mode: "always", want: true},
+		{mode: "always", noColor: "1", term: "dumb", want: true},
+		{mode: "never", term: "xterm-256color", want: false},
+		{mode: "auto", noColor: "1", want: false},
+		{mode: "auto", term: "dumb", want: false},
+		// The output of go test isn't a terminal
+		{mode: "auto", term: "xterm-256color", want: false},
+		{mode: "", term: "xterm-256color", want: false},
+	}
+	for _, test := range tests {
+		t.Setenv("NO_COLOR", test.noColor)
+		t.Setenv("TERM", test.term)
+		Color = !test.want
+		if err := SetColor(test.mode); err != nil {
+			t.Fatalf("SetColor(%q) = %v", test.mode, err)
+		}
+		if Color != test.want {
+			t.Errorf("SetColor(%q) with NO_COLOR=%q TERM=%q: Color = %v, want %v", test.mode, test.noColor, test.term, Color, test.want)
+		}
+	}
+
+	if err := SetColor("sometimes"); err == nil || !strings.Contains(err.Error(), "always, auto or never") {
+		t.Errorf("SetColor(sometimes) = %v, want the modes listed", err)
+	}
+}
+
+func TestStyled(t *testing.T) {
+	defer func(was bool) { Color = was }(Color)
+	text := "Run " + Code(Command) + "ls -la" + Reset + " then \033[38;5;25m\033[1mdf -h\033[0m"
+
+	Color = true
+	if got := Styled(text); got != text {
+		t.Errorf("Styled() with color = %q, want the text as is", got)
+	}
+	Color = false
+	if got := Styled(text); got != "Run ls -la then df -h" {
+		t.Errorf("Styled() without color = %q, want the codes taken out", got)
+	}
+}
@@ -0,0 +1,27 @@
+package format
+
+import "strings"
+
+// NormalizeNewlines turns the CRLF line endings some providers send, especially on Windows, into LF.
+// A lone CR is dropped, it would move the cursor back to the start of the line and garble the TUI.
+func NormalizeNewlines(text string) string {
+	if !strings.Contains(text, "\r") {
+		return text
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "")
+}
+
+// NewlineStream normalizes text that arrives in chunks, where a CRLF can be split between two of them
+type NewlineStream struct {
+	pendingCR bool
+}
+
+// Chunk returns the chunk with normalized newlines. A CR at its end is held back until the next chunk shows
+// whether an LF follows.
+func (s *NewlineStream) Chunk(text string) string {
+	if s.pendingCR {
+		text = "\r" + text
+	}
+	text, s.pendingCR = strings.CutSuffix(text, "\r")
+	return NormalizeNewlines(text)
+}
@@ -0,0 +1,63 @@
+package format
+
+import "testing"
+
+func TestNormalizeNewlines(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"ls -la\n", "ls -la\n"},
+		{"ls -la\r\n", "ls -la\n"},
+		{"one\r\ntwo\r\n\r\nthree", "one\ntwo\n\nthree"},
+		{"progress 10%\rprogress 100%\n", "progress 10%progress 100%\n"},
+		{"mixed\nendings\r\n", "mixed\nendings\n"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := NormalizeNewlines(test.input); got != test.want {
+			t.Errorf("NormalizeNewlines(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestNewlineStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"whole lines", []string{"Run:\r\n", "@run[df -h]\r\n"}, "Run:\n@run[df -h]\n"},
+		{"CRLF split between chunks", []string{"Run:\r", "\n@run[df -h]\r", "\n"}, "Run:\n@run[df -h]\n"},
+		{"lone CR at a chunk end", []string{"a\r", "b"}, "ab"},
+		{"chunk of only a CR", []string{"a", "\r", "\n", "b"}, "a\nb"},
+		{"LF only", []string{"a\n", "b\n"}, "a\nb\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var s NewlineStream
+			got := ""
+			for _, chunk := range test.chunks {
+				got += s.Chunk(chunk)
+			}
+			if got != test.want {
+				t.Errorf("streamed %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// Streaming a response in chunks of any size gives the same text as normalizing it at once
+func TestNewlineStreamMatchesNormalize(t *testing.T) {
+	response := "Update the lists:\r\n```bash\r\nsudo apt update\r\n```\r\n\r\nThen @run[sudo apt upgrade]\r\n"
+	want := NormalizeNewlines(response)
+	for size := 1; size <= len(response); size++ {
+		var s NewlineStream
+		got := ""
+		for i := 0; i < len(response); i += size {
+			got += s.Chunk(response[i:min(i+size, len(response))])
+		}
+		if got != want {
+			t.Errorf("chunks of %d gave %q, want %q", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package format
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Role is a part of the TUI with a color of its own
+type Role string
+
+const (
+	Response Role = "response" // Text of the response
+	Command  Role = "command"  // Commands inside the response
+	Selected Role = "selected" // Picked commands and the run button
+	Warning  Role = "warning"
+	Error    Role = "error"
+	Footer   Role = "footer" // Notes, the status line and usage below the response
+	Header   Role = "header"
+)
+
+// Roles lists the roles in the order they are documented
+var Roles = []Role{Response, Command, Selected, Warning, Error, Footer, Header}
+
+// Theme maps roles to SGR parameters, e.g. 32 for green or 38;5;25 for a color of the 256 color palette.
+// A role without parameters keeps the terminal's own color.
+type Theme map[Role]string
+
+// Themes are the presets of the theme setting, dark is what lexido always looked like
+var Themes = map[string]Theme{
+	"dark": {Command: "34", Selected: "32", Warning: "33", Error: "31", Footer: "2", Header: "1"},
+	// Darker shades that stay readable on a white or Solarized light background, where dim text fades away
+	"light": {Command: "38;5;25", Selected: "38;5;28", Warning: "38;5;130", Error: "38;5;160", Footer: "38;5;242", Header: "1"},
+	// No colors at all, only bold, underline and dim
+	"mono": {Command: "4", Selected: "1", Warning: "1", Error: "1", Footer: "2", Header: "1"},
+}
+
+var theme = Themes["dark"]
+
+// Code returns the escape sequence that starts the color of role, empty when it has none
+func Code(role Role) string {
+	if params := theme[role]; params != "" {
+		return "\033[" + params + "m"
+	}
+	return ""
+}
+
+// Reset ends the color started with Code
+const Reset = "\033[0m"
+
+// SetTheme picks the preset by name, auto follows the background of the terminal, and applies the overrides,
+// e.g. "command=#268bd2,warning=136". Unknown names and bad colors keep the default and are returned as warnings.
+func SetTheme(name string, overrides string) []string {
+	var warnings []string
+	if name == "" || name == "auto" {
+		name = "dark"
+		if lightBackground() {
+			name = "light"
+		}
+	}
+	preset, ok := Themes[name]
+	if !ok {
+		warnings = append(warnings, fmt.Sprintf("unknown theme %q, using dark", name))
+		preset = Themes["dark"]
+	}
+
+	theme = Theme{}
+	for role, params := range preset {
+		theme[role] = params
+	}
+	for _, override := range strings.Split(overrides, ",") {
+		if strings.TrimSpace(override) == "" {
+			continue
+		}
+		role, value, err := ParseOverride(override)
+		if err != nil {
+			warnings = append(warnings, err.Error()+", keeping the default")
+			continue
+		}
+		theme[role] = value
+	}
+	return warnings
+}
+
+// ParseOverride parses role=color, returning the role and the SGR parameters of the color
+func ParseOverride(override string) (Role, string, error) {
+	name, value, ok := strings.Cut(strings.TrimSpace(override), "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid color override %q, use role=color", override)
+	}
+	role := Role(strings.TrimSpace(name))
+	known := false
+	for _, r := range Roles {
+		known = known || r == role
+	}
+	if !known {
+		return "", "", fmt.Errorf("unknown role %q in %q", name, override)
+	}
+	params, err := ParseColor(value)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", role, err)
+	}
+	return role, params, nil
+}
+
+// ParseColor turns a color into SGR parameters for the foreground: #rrggbb, a number of the 256 color palette,
+// or default for the terminal's own color
+func ParseColor(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "default" {
+		return "", nil
+	}
+	if hex, ok := strings.CutPrefix(value, "#"); ok {
+		if len(hex) != 6 {
+			return "", fmt.Errorf("invalid color %q, use #rrggbb", value)
+		}
+		rgb, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid color %q, use #rrggbb", value)
+		}
+		return fmt.Sprintf("38;2;%d;%d;%d", rgb>>16, rgb>>8&0xff, rgb&0xff), nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > 255 {
+		return "", fmt.Errorf("invalid color %q, use #rrggbb or 0-255", value)
+	}
+	return "38;5;" + value, nil
+}
+
+// Reports whether the terminal has a light background from COLORFGBG, which rxvt, Konsole and others set
+// to "foreground;background". Other terminals are taken to be dark.
+func lightBackground() bool {
+	fgbg := os.Getenv("COLORFGBG")
+	if fgbg == "" {
+		return false
+	}
+	parts := strings.Split(fgbg, ";")
+	bg, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return false
+	}
+	// 7 is light gray and 9-15 the bright colors, 8 is dark gray
+	return bg == 7 || (bg >= 9 && bg <= 15)
+}
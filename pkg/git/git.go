@@ -0,0 +1,155 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrNothingStaged means there is no staged change to write a commit message for
+var ErrNothingStaged = errors.New("nothing is staged, use git add first")
+
+// Runs git with the given arguments and returns its trimmed stdout, stderr is part of the error
+func run(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Runs git in dir, giving up when ctx is done
+func runIn(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Info describes the work tree a prompt was written in
+type Info struct {
+	Branch       string // Empty when HEAD is detached
+	Commit       string // Short hash of HEAD, empty before the first commit
+	ChangedFiles int    // Modified, staged and untracked files
+	ShortStat    string // e.g. "3 files changed, 10 insertions(+), 2 deletions(-)"
+	RemoteHost   string // Host of the origin remote, e.g. github.com
+}
+
+// All of RepoInfo's git calls together may take this long, the prompt shouldn't wait on a slow repo
+var InfoTimeout = 2 * time.Second
+
+// Gathers Info about the work tree dir is in. It reports false when dir isn't in one,
+// git isn't installed or is too slow, so callers can leave the context out without a fuss.
+func RepoInfo(dir string) (Info, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), InfoTimeout)
+	defer cancel()
+
+	var info Info
+	if inside, err := runIn(ctx, dir, "rev-parse", "--is-inside-work-tree"); err != nil || inside != "true" {
+		return info, false
+	}
+
+	// symbolic-ref also knows the branch before its first commit
+	info.Branch, _ = runIn(ctx, dir, "symbolic-ref", "--short", "-q", "HEAD")
+	info.Commit, _ = runIn(ctx, dir, "rev-parse", "--short", "HEAD")
+
+	status, err := runIn(ctx, dir, "status", "--porcelain")
+	if err != nil {
+		return info, false
+	}
+	if status != "" {
+		info.ChangedFiles = len(strings.Split(status, "\n"))
+	}
+	if info.Commit != "" {
+		info.ShortStat, _ = runIn(ctx, dir, "diff", "HEAD", "--shortstat")
+	}
+
+	if remote, err := runIn(ctx, dir, "remote", "get-url", "origin"); err == nil {
+		info.RemoteHost = RemoteHost(remote)
+	}
+	return info, ctx.Err() == nil
+}
+
+// Returns only the host of a remote URL, so no user names, tokens or paths end up in the prompt
+func RemoteHost(remote string) string {
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	// scp-like syntax, git@github.com:user/repo.git
+	if at := strings.Index(remote, "@"); at >= 0 {
+		remote = remote[at+1:]
+	}
+	if host, _, ok := strings.Cut(remote, ":"); ok && !strings.Contains(host, "/") {
+		return host
+	}
+	return ""
+}
+
+// Returns the diff of the staged changes
+func StagedDiff() (string, error) {
+	diff, err := run("diff", "--cached")
+	if err != nil {
+		return "", err
+	}
+	if diff == "" {
+		return "", ErrNothingStaged
+	}
+	return diff, nil
+}
+
+// Returns the changes introduced by the given commit, without its message
+func Show(rev string) (string, error) {
+	return run("show", "--format=", rev)
+}
+
+// Returns the message of the last commit
+func LastCommitMessage() (string, error) {
+	return run("log", "-1", "--format=%B")
+}
+
+// Strips the code fences and quotes models like to wrap commit messages in
+func CleanMessage(response string) string {
+	msg := strings.TrimSpace(response)
+	if strings.HasPrefix(msg, "```") {
+		lines := strings.Split(msg, "\n")
+		lines = lines[1:]
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "```" {
+			lines = lines[:len(lines)-1]
+		}
+		msg = strings.TrimSpace(strings.Join(lines, "\n"))
+	}
+	if len(msg) >= 2 && msg[0] == '"' && msg[len(msg)-1] == '"' && !strings.Contains(msg[1:len(msg)-1], "\"") {
+		msg = msg[1 : len(msg)-1]
+	}
+	return msg
+}
+
+// Commits the staged changes with the given message, git's own output and hooks stay visible
+func Commit(message string, amend bool) error {
+	args := []string{"commit", "--file", "-"}
+	if amend {
+		args = append(args, "--amend")
+	}
+
+	// The message goes through stdin so no quoting can break it
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(message)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,243 @@
+package help
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/config"
+)
+
+// Usage is a task and the commands that do it, listed under Usage in the help and COMMANDS in the man page
+type Usage struct {
+	Task     string
+	Commands []string
+}
+
+// Group names related flags listed under one heading, flags in no group end up under "Other options"
+type Group struct {
+	Title string
+	Flags []string // One name of each flag is enough, its aliases are listed with it
+}
+
+// Example is a real invocation with what it does
+type Example struct {
+	Description string
+	Command     string
+}
+
+// Topic is a longer text shown by `lexido help <name>` and as a section of the man page
+type Topic struct {
+	Name    string
+	Title   string
+	Summary string
+	Text    func() string
+}
+
+// Note is a closing paragraph of the help, a section of its own in the man page
+type Note struct {
+	Title string
+	Text  string
+}
+
+var Usages = []Usage{
+	{"To get command suggestions, flags may also follow the prompt and words after -- are always part of it", []string{
+		`lexido "install teamspeak via docker"`,
+		`lexido find big files -l`,
+	}},
+	{"To continue with a previous prompt", []string{`lexido -c "add more details or follow-up"`}},
+	{"To use with piping commands, a lone - sends stdin as the prompt itself instead of attaching it", []string{
+		`ls | lexido "what should I do with these files?"`,
+		`some-generator | lexido -`,
+	}},
+	{"To attach files (globs are expanded)", []string{`lexido "why does this unit fail" @/etc/systemd/system/myapp.service @*.log`}},
+	{"To run llama3 locally via ollama", []string{`lexido -l -m llama3 "install teamspeak via docker"`}},
+	{"To set up a remote provider (openai, azure, anthropic, mistral, openrouter, together, groq)", []string{
+		`lexido remote init openai`,
+		`lexido remote test`,
+	}},
+	{"To list the models of ollama or OpenRouter, and to use an OpenRouter model for a run", []string{
+		`lexido models --provider openrouter [--search claude]`,
+		`lexido -r -m anthropic/claude-3.5-haiku "find big files"`,
+	}},
+	{"To see which API keys are stored and whether they work, and to replace or remove one", []string{
+		`lexido auth status`,
+		`lexido auth set gemini|openai|...|remote`,
+		`lexido auth remove <provider>`,
+	}},
+	{"To see the last commands lexido ran, recorded in audit.jsonl (lexido config set audit false turns it off)", []string{`lexido audit tail [-n 20]`}},
+	{"To inspect and change settings (lexido help config lists them)", []string{
+		`lexido config list`,
+		`lexido config set <key> <value>`,
+	}},
+	{"To recall the commands saved with * in the TUI, without asking the model again", []string{
+		`lexido fav list [--json]`,
+		`lexido fav search <text>`,
+		`lexido fav run <n>`,
+		`lexido fav rm <n>`,
+	}},
+	{"To inspect or wipe the cached conversation", []string{
+		`lexido history show [--json]`,
+		`lexido history clear`,
+	}},
+	{"To reuse responses to identical prompts for a day (--no-cache to ask again), and to drop them", []string{
+		`lexido config set cache true`,
+		`lexido cache clear`,
+	}},
+	{"To see the tokens used and their cost, and how many suggested commands you ran, e.g. over the last week", []string{
+		`lexido stats [--since 7d] [--json]`,
+		`lexido stats reset`,
+	}},
+	{"To write a commit message for the staged changes and commit with it", []string{`lexido commit [--conventional] [--amend] [extra instructions]`}},
+	{"To write a shell alias or function and add it to aliases.sh in the config directory, for your rc file to source", []string{`lexido alias [--shell bash|zsh|fish] <what it should do>`}},
+	{"To change a file with a unified diff, shown before it is applied with a .bak of the original (--apply applies it right away)", []string{`lexido edit [--apply] <file> <what to change>`}},
+	{"To answer a file of prompts, one per line, into a markdown runbook of the suggested commands without running any", []string{`lexido batch [--delay 1s] [-o runbook.md] [tasks.txt]`}},
+	{"To summarize piped text or attached files in prose, without commands to run (--no-commands does this for any prompt)", []string{`dmesg | lexido summarize [what to look for]`}},
+	{"To keep a conversation going in one session (/reset, /save <file>, /model <name> inside it)", []string{`lexido chat [first message]`}},
+	{"To enable shell completion (bash, zsh, or fish)", []string{`source <(lexido completion bash)`}},
+	{"To turn a description on the command line into a command with Ctrl-X Ctrl-L (bash, zsh, or fish)", []string{`eval "$(lexido shell-init zsh)"`}},
+	{"To fix the command that just failed, once shell-init is loaded (or press Ctrl-X Ctrl-F)", []string{`lexido fix [extra instructions]`}},
+	{"To get an install suggestion when the shell can't find a command", []string{`eval "$(lexido shell-init --command-not-found zsh)"`}},
+	{"To update to the newest release, or only check for one (lexido config set update_check true adds it to -v)", []string{`lexido update [--check]`}},
+	{"To read a longer help topic, or install the manual page", []string{
+		`lexido help <topic>`,
+		`lexido man > lexido.1`,
+	}},
+}
+
+var Groups = []Group{
+	{"General", []string{"h", "v", "c"}},
+	{"Providers and models", []string{"g", "l", "r", "m", "ollama-host", "temperature", "max-tokens", "ctx", "seed", "lang", "relax-safety",
+		"alternatives", "race", "compare", "max-attempts", "timeout", "assume-online"}},
+	{"Saved settings", []string{"setDefault", "setModel", "setFallback", "setRemotePreset", "setSafety", "setGcpProject", "setGcpLocation", "setLang"}},
+	{"Prompt and context", []string{"t", "image", "with-path", "paste", "pipe-limit", "history", "no-git", "no-project-context", "no-redact",
+		"no-cache", "refresh-sysinfo"}},
+	{"Running commands", []string{"run-in", "target", "confirm-each", "yes-removals", "tmux", "save-script", "force", "fix-loop", "y",
+		"max-iterations", "fix-budget", "no-capture"}},
+	{"Output", []string{"q", "commands-only", "all", "no-commands", "o", "output-commands", "json", "json-stream", "pager", "accessible",
+		"color", "show-all-warnings"}},
+	{"Logging and storage", []string{"verbose", "debug", "log-file", "no-keyring"}},
+}
+
+var Examples = []Example{
+	{"Ask about the output of another command", `journalctl -u nginx --since today | lexido "why does nginx keep restarting?"`},
+	{"Follow up on the previous answer", `lexido -c "now make it run every night at 2am"`},
+	{"Ask llama3 through ollama on this machine", `lexido -l -m llama3 "find files over 1GB in my home directory"`},
+	{"Ask the API of remoteConfig.json", `lexido -r "convert every .webm file here to mp4"`},
+	{"Save the picked commands to a script instead of running them", `lexido --save-script cleanup.sh "remove docker images older than a month"`},
+	{"Prepare a runbook of several tasks without running anything", `lexido batch tasks.txt --dry-run -o runbook.md`},
+	{"Use the answer in a pipeline", `lexido -q "write a haiku about cron" > haiku.txt`},
+}
+
+var Topics = []Topic{
+	{Name: "remote", Title: "Remote configuration", Summary: "Use an OpenAI compatible or any other HTTP API with -r", Text: func() string { return remoteTopic }},
+	{Name: "shell", Title: "Shell integration", Summary: "Ctrl-X Ctrl-L, lexido fix, command-not-found, completion and aliases", Text: func() string { return shellTopic }},
+	{Name: "config", Title: "Settings", Summary: "Every setting of lexido config set", Text: configTopic},
+}
+
+var Notes = []Note{
+	{"JSON errors", "With --json and --json-stream errors are written to stderr as {\"error\": {\"code\": ..., \"message\": ...}}, where code is one of\n" +
+		"rate_limited, unavailable, auth, network, blocked, invalid_request, canceled, timeout, no_prompt, or error."},
+	{"Exit codes", "0 success, 1 other failures, 2 usage error (invalid flags, settings or prompt), 3 missing or invalid credentials,\n" +
+		"4 rate limited or the provider unavailable, 5 network failure or timeout, 6 blocked by the safety filters,\n" +
+		"10+N when a selected command failed with exit code N (at most 125), 130 interrupted."},
+	{"Credentials", "When the config directory can't be written (read-only ~/.config in containers), lexido keeps the settings in\n" +
+		"credentials.json in $XDG_DATA_HOME/lexido (~/.local/share/lexido) instead, which holds them from then on."},
+	{"Files", "Settings, keys and remoteConfig.json live in $XDG_CONFIG_HOME/lexido (~/.config/lexido), the conversation cache in\n" +
+		"$XDG_CACHE_HOME/lexido (~/.cache/lexido). macOS and Windows use their own application directories unless these are set."},
+	{"Note", "Lexido's outputs may not always be factual. User discretion is advised."},
+}
+
+// Lookup returns the topic of the name, nil when there is none
+func Lookup(name string) *Topic {
+	for i := range Topics {
+		if Topics[i].Name == name {
+			return &Topics[i]
+		}
+	}
+	return nil
+}
+
+// Returns the names of the topics, for completion and error messages
+func TopicNames() []string {
+	names := make([]string, len(Topics))
+	for i, topic := range Topics {
+		names[i] = topic.Name
+	}
+	return names
+}
+
+const remoteTopic = `-r, or lexido config set mode remote, sends the prompt to the HTTP API described by remoteConfig.json in the
+config directory (~/.config/lexido, ~/Library/Application Support/lexido on macOS).
+
+Known providers don't need a hand written config. lexido remote init <preset> asks for the API key, checks it with a
+one token request, stores it in the keyring and writes the config with streaming turned on. Without a preset it lists
+them: openai, azure, anthropic, mistral, openrouter, together and groq. An existing config is kept as
+remoteConfig.json.bak.
+
+A config of your own looks like this:
+
+    {
+      "api_config": {
+        "url": "https://api.example.com/v1/chat/completions",
+        "headers": {"Authorization": "Bearer <KEY:EXAMPLE_API_KEY>"},
+        "data_template": {
+          "model": "<MODEL>",
+          "messages": [
+            {"role": "system", "content": "<SYSTEM>"},
+            "<HISTORY>",
+            {"role": "user", "content": "<USER>"}
+          ]
+        },
+        "model": "example-model",
+        "field_to_extract": "choices.0.delta.content"
+      }
+    }
+
+<PROMPT> in data_template is replaced with the whole prompt, or <SYSTEM> and <USER> with lexido's instructions and
+your request on their own. "<HISTORY>" in a messages array is replaced with the earlier turns of -c.
+<KEY:NAME> in a header is the API key in $NAME or, when that isn't set, the keyring field NAME.
+<MODEL>, <TEMPERATURE> and <MAX_TOKENS> are filled from model, -m, --temperature and --max-tokens.
+field_to_extract names the field of the response with the text, a dotted path picks one position.
+{name} placeholders in the url are filled from a "variables" object.
+proxy, ca_cert_file and insecure_skip_verify are for endpoints behind a proxy or with a private CA.
+"stream": false is for endpoints that only answer once the whole response is ready.
+
+lexido remote test [file|preset] checks the config, sends a tiny request and prints the raw response next to the
+text taken from it. lexido models --provider openrouter lists the models of OpenRouter, -m picks one for a run.`
+
+const shellTopic = `lexido shell-init prints widgets for bash, zsh and fish to load from the rc file:
+
+    eval "$(lexido shell-init zsh)"     # in ~/.zshrc, or bash in ~/.bashrc
+    lexido shell-init fish | source     # in ~/.config/fish/config.fish
+
+Ctrl-X Ctrl-L turns the description typed on the command line into a command in place, ready to edit before enter.
+After every command the shell exports the command line and its exit status, lexido fix (or Ctrl-X Ctrl-F) sends
+them to the model and shows the corrected command in the TUI. Words after fix are extra instructions.
+
+With --command-not-found the shell's command-not-found handler is replaced with one running lexido cnf <name>,
+which prints a one-line install suggestion such as sudo apt install ripgrep. The answer is always cached, a request
+gives up after 5 seconds, and any error leaves just the usual "command not found".
+
+Completion of flags, subcommands, models and templates:
+
+    source <(lexido completion bash)    # or zsh, or lexido completion fish | source
+
+lexido alias writes aliases and functions to aliases.sh in the config directory (aliases.fish for fish), which the
+rc file sources once:
+
+    echo 'source ~/.config/lexido/aliases.sh' >> ~/.bashrc`
+
+// The settings come from the config keys, so a new one is listed without touching the help
+func configTopic() string {
+	var s strings.Builder
+	s.WriteString("lexido config set <key> <value> changes a setting, lexido config list shows them with their values.\n" +
+		"A flag given for one run wins over its setting.\n\n")
+	width := 0
+	for _, key := range config.Keys {
+		width = max(width, len(key.Name))
+	}
+	for _, key := range config.Keys {
+		fmt.Fprintf(&s, "    %-*s  %s\n", width, key.Name, key.Description)
+	}
+	return strings.TrimRight(s.String(), "\n")
+}
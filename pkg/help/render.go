@@ -0,0 +1,221 @@
+package help
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// A flag with its aliases, which share the variable they set
+type entry struct {
+	names       []string // Short names first, e.g. q and quiet
+	placeholder string   // Name of the value, empty for booleans
+	usage       string
+}
+
+// Returns -q for one letter names and --quiet for the others
+func (e entry) flags() string {
+	names := make([]string, len(e.names))
+	for i, name := range e.names {
+		if len(name) == 1 {
+			names[i] = "-" + name
+		} else {
+			names[i] = "--" + name
+		}
+	}
+	s := strings.Join(names, ", ")
+	if e.placeholder != "" {
+		s += " " + e.placeholder
+	}
+	return s
+}
+
+// Collects the flags of fs, aliases of the same variable merged into one entry
+func entries(fs *flag.FlagSet) map[string]*entry {
+	byName := map[string]*entry{}
+	byTarget := map[uintptr]*entry{}
+	fs.VisitAll(func(f *flag.Flag) {
+		target := reflect.ValueOf(f.Value).Pointer()
+		if e, ok := byTarget[target]; ok {
+			e.names = append(e.names, f.Name)
+			sort.SliceStable(e.names, func(i, j int) bool { return len(e.names[i]) < len(e.names[j]) })
+			byName[f.Name] = e
+			return
+		}
+		placeholder, usage := flag.UnquoteUsage(f)
+		if placeholder == "value" {
+			placeholder = "string"
+		}
+		if isBool(f) {
+			placeholder = ""
+		}
+		switch f.DefValue {
+		case "", "0", "false", "0s":
+		default:
+			if !strings.Contains(usage, "(default") {
+				usage += " (default " + f.DefValue + ")"
+			}
+		}
+		e := &entry{names: []string{f.Name}, placeholder: placeholder, usage: usage}
+		byTarget[target] = e
+		byName[f.Name] = e
+	})
+	return byName
+}
+
+func isBool(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// Returns the flags of fs under the headings of Groups, the ones no group names last under "Other options"
+func groups(fs *flag.FlagSet) []Group {
+	all := entries(fs)
+	listed := map[*entry]bool{}
+	var result []Group
+	add := func(title string, names []string) {
+		var list []string
+		for _, name := range names {
+			if e, ok := all[name]; ok && !listed[e] {
+				listed[e] = true
+				list = append(list, e.names[0])
+			}
+		}
+		if len(list) > 0 {
+			result = append(result, Group{Title: title, Flags: list})
+		}
+	}
+	for _, group := range Groups {
+		add(group.Title, group.Flags)
+	}
+	var rest []string
+	fs.VisitAll(func(f *flag.Flag) {
+		rest = append(rest, f.Name)
+	})
+	add("Other options", rest)
+	return result
+}
+
+// Write prints the help, with the options generated from the flags of fs
+func Write(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "Lexido Command Line Tool Usage:")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage:")
+	for _, usage := range Usages {
+		fmt.Fprintf(w, "    %s:\n", usage.Task)
+		for _, command := range usage.Commands {
+			fmt.Fprintf(w, "        %s\n", command)
+		}
+		fmt.Fprintln(w)
+	}
+
+	all := entries(fs)
+	for _, group := range groups(fs) {
+		fmt.Fprintf(w, "%s:\n", group.Title)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, name := range group.Flags {
+			e := all[name]
+			fmt.Fprintf(tw, "    %s\t%s\n", e.flags(), e.usage)
+		}
+		tw.Flush()
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "Examples:")
+	for _, example := range Examples {
+		fmt.Fprintf(w, "    # %s\n    %s\n\n", example.Description, example.Command)
+	}
+
+	fmt.Fprintln(w, "Help topics, shown with lexido help <topic>:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, topic := range Topics {
+		fmt.Fprintf(tw, "    %s\t%s\n", topic.Name, topic.Summary)
+	}
+	tw.Flush()
+
+	for _, note := range Notes {
+		fmt.Fprintf(w, "\n%s: %s\n", note.Title, note.Text)
+	}
+}
+
+// WriteTopic prints the text of a help topic under its title
+func WriteTopic(w io.Writer, topic *Topic) {
+	fmt.Fprintf(w, "%s\n\n%s\n", topic.Title, topic.Text())
+}
+
+// Man writes the help as a troff man page for section 1, from the same usages, flags, examples and topics
+func Man(w io.Writer, fs *flag.FlagSet, version string) {
+	fmt.Fprintf(w, ".TH LEXIDO 1 \"\" \"lexido %s\" \"User Commands\"\n", roff(version))
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `lexido \- command suggestions from Gemini, ollama or a remote API in the terminal`)
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintln(w, `.B lexido`)
+	fmt.Fprintln(w, `[\fIoptions\fR] [\fIprompt\fR ...] [\fB@\fIfile\fR ...]`)
+	fmt.Fprintln(w, ".br")
+	fmt.Fprintln(w, `.B lexido`)
+	fmt.Fprintln(w, `\fIcommand\fR [\fIarguments\fR]`)
+	fmt.Fprintln(w, ".SH DESCRIPTION")
+	fmt.Fprintln(w, roff("lexido asks a language model for the commands that do what the prompt describes, explains them and "+
+		"runs the ones you pick. Piped input and files named with @ are attached to the prompt."))
+
+	fmt.Fprintln(w, ".SH COMMANDS")
+	for _, usage := range Usages {
+		fmt.Fprintln(w, ".PP")
+		fmt.Fprintln(w, roff(usage.Task+":"))
+		fmt.Fprintln(w, ".RS\n.nf")
+		for _, command := range usage.Commands {
+			fmt.Fprintln(w, roff(command))
+		}
+		fmt.Fprintln(w, ".fi\n.RE")
+	}
+
+	fmt.Fprintln(w, ".SH OPTIONS")
+	all := entries(fs)
+	for _, group := range groups(fs) {
+		fmt.Fprintf(w, ".SS %s\n", roff(group.Title))
+		for _, name := range group.Flags {
+			e := all[name]
+			fmt.Fprintln(w, ".TP")
+			fmt.Fprintln(w, `\fB`+roff(e.flags())+`\fR`)
+			fmt.Fprintln(w, roff(e.usage))
+		}
+	}
+
+	fmt.Fprintln(w, ".SH EXAMPLES")
+	for _, example := range Examples {
+		fmt.Fprintln(w, ".PP")
+		fmt.Fprintln(w, roff(example.Description+":"))
+		fmt.Fprintln(w, ".RS\n.nf")
+		fmt.Fprintln(w, roff(example.Command))
+		fmt.Fprintln(w, ".fi\n.RE")
+	}
+
+	for _, topic := range Topics {
+		fmt.Fprintf(w, ".SH %s\n", roff(strings.ToUpper(topic.Title)))
+		fmt.Fprintln(w, ".nf")
+		fmt.Fprintln(w, roff(topic.Text()))
+		fmt.Fprintln(w, ".fi")
+	}
+
+	for _, note := range Notes {
+		fmt.Fprintf(w, ".SH %s\n", roff(strings.ToUpper(note.Title)))
+		fmt.Fprintln(w, roff(strings.ReplaceAll(note.Text, "\n", " ")))
+	}
+}
+
+// Escapes text for troff: backslashes and dashes, and lines that would start with a request
+func roff(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,137 @@
+package io
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits for files attached with @file
+const (
+	MaxAttachmentSize      = 256 * 1024
+	MaxTotalAttachmentSize = 1024 * 1024
+	binaryPreviewSize      = 256
+)
+
+// Attachment is a file referenced on the command line with @path
+type Attachment struct {
+	Path      string
+	Content   string
+	Binary    bool
+	Truncated bool
+}
+
+// Splits positional arguments into prompt words and @file references
+func SplitFileRefs(args []string) (words []string, refs []string) {
+	for _, arg := range args {
+		if len(arg) > 1 && strings.HasPrefix(arg, "@") {
+			refs = append(refs, arg[1:])
+		} else {
+			words = append(words, arg)
+		}
+	}
+	return words, refs
+}
+
+// Reads the referenced files, expanding globs. A reference that matches nothing is an error.
+func ReadAttachments(refs []string) ([]Attachment, error) {
+	var attachments []Attachment
+	total := 0
+
+	for _, ref := range refs {
+		paths := []string{ref}
+		if strings.ContainsAny(ref, "*?[") {
+			matches, err := filepath.Glob(ref)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern @%s: %w", ref, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("@%s did not match any files", ref)
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, fmt.Errorf("can't attach @%s: %w", path, err)
+			}
+			if info.IsDir() {
+				return nil, fmt.Errorf("can't attach @%s: it is a directory", path)
+			}
+
+			attachment, err := readAttachment(path)
+			if err != nil {
+				return nil, err
+			}
+
+			total += len(attachment.Content)
+			if total > MaxTotalAttachmentSize {
+				return nil, fmt.Errorf("attached files exceed the total limit of %d KB", MaxTotalAttachmentSize/1024)
+			}
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	return attachments, nil
+}
+
+func readAttachment(path string) (Attachment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("can't attach @%s: %w", path, err)
+	}
+	defer file.Close()
+
+	buf := make([]byte, MaxAttachmentSize+1)
+	n, err := file.Read(buf)
+	if err != nil && n == 0 {
+		if info, statErr := file.Stat(); statErr == nil && info.Size() == 0 {
+			return Attachment{Path: path}, nil
+		}
+		return Attachment{}, fmt.Errorf("can't attach @%s: %w", path, err)
+	}
+	data := buf[:n]
+
+	attachment := Attachment{Path: path}
+	if len(data) > MaxAttachmentSize {
+		data = data[:MaxAttachmentSize]
+		attachment.Truncated = true
+	}
+
+	// Binary files are only described by a short hexdump of their start
+	if IsBinary(data) {
+		attachment.Binary = true
+		preview := data
+		if len(preview) > binaryPreviewSize {
+			preview = preview[:binaryPreviewSize]
+		}
+		attachment.Content = hex.Dump(preview)
+		return attachment, nil
+	}
+
+	attachment.Content = string(data)
+	return attachment, nil
+}
+
+// Detects binary content by looking for NUL bytes or invalid UTF-8 near the start
+func IsBinary(data []byte) bool {
+	sample := data
+	if len(sample) > 8000 {
+		sample = sample[:8000]
+	}
+	for _, b := range sample {
+		if b == 0 {
+			return true
+		}
+	}
+
+	// A multi-byte character may have been cut off at the end of the sample
+	for i := 0; i < utf8.UTFMax && len(sample) > 0 && !utf8.Valid(sample); i++ {
+		sample = sample[:len(sample)-1]
+	}
+	return !utf8.Valid(sample)
+}
@@ -0,0 +1,181 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// How long a terminal gets to answer the OSC 52 clipboard query, most never do
+const osc52Timeout = time.Second
+
+// A tool that prints the clipboard
+type clipboardTool struct {
+	name string
+	args []string
+}
+
+// Returns the clipboard tools tried in order on this platform
+func clipboardTools() []clipboardTool {
+	switch runtime.GOOS {
+	case "darwin":
+		return []clipboardTool{{"pbpaste", nil}}
+	case "windows":
+		return []clipboardTool{{"powershell.exe", []string{"-NoProfile", "-Command", "Get-Clipboard -Raw"}}}
+	}
+	tools := []clipboardTool{
+		{"xclip", []string{"-selection", "clipboard", "-out"}},
+		{"xsel", []string{"--clipboard", "--output"}},
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		tools = append([]clipboardTool{{"wl-paste", []string{"--no-newline"}}}, tools...)
+	} else {
+		tools = append(tools, clipboardTool{"wl-paste", []string{"--no-newline"}})
+	}
+	return tools
+}
+
+// ClipboardError is returned when neither a clipboard tool nor the terminal could provide the clipboard
+type ClipboardError struct {
+	Tools []string
+}
+
+func (e *ClipboardError) Error() string {
+	return fmt.Sprintf("can't read the clipboard, install one of %s (or use a terminal that answers OSC 52 queries)", strings.Join(e.Tools, ", "))
+}
+
+// ReadClipboard returns the text on the clipboard, at most MaxAttachmentSize of it, and whether it was cut off.
+// The first clipboard tool installed is used, the terminal is asked with OSC 52 when there is none.
+func ReadClipboard() (string, bool, error) {
+	var names []string
+	for _, tool := range clipboardTools() {
+		names = append(names, tool.name)
+		if _, err := exec.LookPath(tool.name); err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+		data, err := exec.CommandContext(ctx, tool.name, tool.args...).Output()
+		cancel()
+		if err != nil {
+			return "", false, fmt.Errorf("reading the clipboard with %s: %w", tool.name, err)
+		}
+		return limitClipboard(data)
+	}
+
+	data, err := readOSC52()
+	if err != nil {
+		return "", false, &ClipboardError{Tools: names}
+	}
+	return limitClipboard(data)
+}
+
+// Cuts the clipboard off at MaxAttachmentSize like attached files are, binary content isn't attached at all
+func limitClipboard(data []byte) (string, bool, error) {
+	truncated := false
+	if len(data) > MaxAttachmentSize {
+		data = data[:MaxAttachmentSize]
+		truncated = true
+	}
+	if IsBinary(data) {
+		return "", false, errors.New("the clipboard holds binary data, not text")
+	}
+	return string(data), truncated, nil
+}
+
+// Asks the terminal for the clipboard with an OSC 52 query, which only some terminals answer
+func readOSC52() ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close()
+
+	state, err := term.MakeRaw(tty.Fd())
+	if err != nil {
+		return nil, err
+	}
+	defer term.Restore(tty.Fd(), state)
+
+	// Terminals that don't answer would leave the read hanging
+	if err := tty.SetReadDeadline(time.Now().Add(osc52Timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := tty.WriteString("\033]52;c;?\a"); err != nil {
+		return nil, err
+	}
+
+	// The answer is ESC ] 52 ; c ; <base64> ended by BEL or ESC \
+	var answer []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := tty.Read(buf)
+		answer = append(answer, buf[:n]...)
+		if end := bytes.IndexAny(answer, "\a\\"); end >= 0 {
+			answer = bytes.TrimSuffix(answer[:end], []byte("\033"))
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	start := bytes.LastIndexByte(answer, ';')
+	if start < 0 {
+		return nil, errors.New("unexpected OSC 52 answer")
+	}
+	return base64.StdEncoding.DecodeString(string(answer[start+1:]))
+}
+
+// Returns the clipboard tools that take text on stdin, tried in order on this platform
+func copyTools() []clipboardTool {
+	switch runtime.GOOS {
+	case "darwin":
+		return []clipboardTool{{"pbcopy", nil}}
+	case "windows":
+		return []clipboardTool{{"clip.exe", nil}}
+	}
+	tools := []clipboardTool{
+		{"xclip", []string{"-selection", "clipboard", "-in"}},
+		{"xsel", []string{"--clipboard", "--input"}},
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		return append([]clipboardTool{{"wl-copy", nil}}, tools...)
+	}
+	return append(tools, clipboardTool{"wl-copy", nil})
+}
+
+// WriteClipboard puts text on the clipboard with the first clipboard tool installed. Where there is none it is
+// sent to the terminal with OSC 52, which works over ssh in most terminals but can't be confirmed.
+func WriteClipboard(text string) error {
+	for _, tool := range copyTools() {
+		if _, err := exec.LookPath(tool.name); err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+		cmd := exec.CommandContext(ctx, tool.name, tool.args...)
+		cmd.Stdin = strings.NewReader(text)
+		err := cmd.Run()
+		cancel()
+		if err != nil {
+			return fmt.Errorf("writing the clipboard with %s: %w", tool.name, err)
+		}
+		return nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	_, err = tty.WriteString("\033]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a")
+	return err
+}
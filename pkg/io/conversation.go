@@ -0,0 +1,289 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// The conversation cache, one JSON encoded turn per line. Older versions kept the turns as text in cacheFile.
+const conversationFile = "conversation.jsonl"
+
+// Turn is a single message of a cached conversation
+type Turn struct {
+	Role        string    `json:"role"`
+	Content     string    `json:"content"`
+	Timestamp   time.Time `json:"timestamp,omitzero"`
+	Provider    string    `json:"provider,omitempty"`     // Provider that wrote an assistant turn
+	CommandsRun []string  `json:"commands_run,omitempty"` // Commands of an assistant turn the user chose to run
+}
+
+// Markers written at the start of each turn in the conversation cache
+var roleMarkers = map[string]string{
+	"user":      "User: ",
+	"assistant": "Assistant: ",
+}
+
+// Formats a turn the way it is stored in the conversation cache
+func FormatTurn(role string, content string) string {
+	return roleMarkers[role] + strings.TrimSpace(content) + "\n"
+}
+
+// Splits a cached conversation back into its turns.
+// Text cached before turns were labeled is returned with the role "unlabeled".
+func ParseConversation(conversation string) []Turn {
+	var turns []Turn
+	var current *Turn
+
+	for _, line := range strings.Split(conversation, "\n") {
+		role := ""
+		for r, marker := range roleMarkers {
+			if strings.HasPrefix(line, marker) {
+				role = r
+				line = strings.TrimPrefix(line, marker)
+				break
+			}
+		}
+
+		if role != "" {
+			turns = append(turns, Turn{Role: role, Content: line})
+			current = &turns[len(turns)-1]
+			continue
+		}
+
+		if current == nil {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			turns = append(turns, Turn{Role: "unlabeled", Content: line})
+			current = &turns[len(turns)-1]
+			continue
+		}
+		current.Content += "\n" + line
+	}
+
+	for i := range turns {
+		turns[i].Content = strings.TrimSpace(turns[i].Content)
+	}
+	return turns
+}
+
+// Renders turns back into the form stored in the conversation cache
+func RenderConversation(turns []Turn) string {
+	var conversation strings.Builder
+	for _, turn := range turns {
+		if _, ok := roleMarkers[turn.Role]; ok {
+			conversation.WriteString(FormatTurn(turn.Role, turn.Content))
+		} else {
+			conversation.WriteString(turn.Content + "\n")
+		}
+	}
+	return conversation.String()
+}
+
+// Loads every turn of the conversation cache. A cache in the plain text format of older versions is read as well,
+// it is upgraded the next time a turn is written.
+func LoadConversation() ([]Turn, error) {
+	path, err := GetFilePath(Cache, conversationFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return loadLegacyConversation()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var turns []Turn
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var turn Turn
+		if err := json.Unmarshal(scanner.Bytes(), &turn); err != nil {
+			return turns, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		turns = append(turns, turn)
+	}
+	return turns, scanner.Err()
+}
+
+// Loads the last n turns of the conversation cache
+func LastTurns(n int) ([]Turn, error) {
+	turns, err := LoadConversation()
+	if len(turns) > n {
+		turns = turns[len(turns)-n:]
+	}
+	return turns, err
+}
+
+// Reads the conversation cache rendered as text, the form prompts are assembled from
+func ReadConversationCache() (string, error) {
+	turns, err := LoadConversation()
+	return RenderConversation(turns), err
+}
+
+// Appends turns to the conversation cache, stamping those without a time
+func AppendTurns(turns ...Turn) error {
+	if err := upgradeLegacyConversation(); err != nil {
+		return err
+	}
+	path, err := GetFilePath(Cache, conversationFile)
+	if err != nil {
+		return err
+	}
+	if err := ensureDirForFile(path); err != nil {
+		return err
+	}
+
+	for i := range turns {
+		if turns[i].Timestamp.IsZero() {
+			turns[i].Timestamp = time.Now()
+		}
+	}
+	data, err := encodeTurns(turns)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Replaces the conversation cache with the given turns, as after a chat session. Turns without a time keep none,
+// such as those of an upgraded plain text cache.
+func SaveConversation(turns []Turn) error {
+	path, err := GetFilePath(Cache, conversationFile)
+	if err != nil {
+		return err
+	}
+	if err := ensureDirForFile(path); err != nil {
+		return err
+	}
+	data, err := encodeTurns(turns)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	return removeLegacyConversation()
+}
+
+func encodeTurns(turns []Turn) ([]byte, error) {
+	var data bytes.Buffer
+	for _, turn := range turns {
+		turn.Content = strings.TrimSpace(turn.Content)
+		line, err := json.Marshal(turn)
+		if err != nil {
+			return nil, err
+		}
+		data.Write(line)
+		data.WriteByte('\n')
+	}
+	return data.Bytes(), nil
+}
+
+// Wipes the conversation cache, overwriting its contents before removing it so pasted secrets don't linger on disk
+func ClearConversationCache() error {
+	path, err := GetFilePath(Cache, conversationFile)
+	if err != nil {
+		return err
+	}
+	if err := wipeFile(path); err != nil {
+		return err
+	}
+	return removeLegacyConversation()
+}
+
+// Reads a conversation cache in the plain text format of older versions
+func loadLegacyConversation() ([]Turn, error) {
+	path, err := GetFilePath(Cache, cacheFile)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Older versions cached a placeholder instead of an empty prompt, strip it so it can't poison continuations
+	conversation := string(content)
+	conversation = strings.ReplaceAll(conversation, roleMarkers["user"]+legacyNoPromptPlaceholder+"\n", "")
+	conversation = strings.ReplaceAll(conversation, legacyNoPromptPlaceholder, "")
+	return ParseConversation(conversation), nil
+}
+
+// Moves the turns of a plain text cache into the JSON lines one, before anything is appended to it
+func upgradeLegacyConversation() error {
+	path, err := GetFilePath(Cache, conversationFile)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	turns, err := loadLegacyConversation()
+	if err != nil || turns == nil {
+		return err
+	}
+	return SaveConversation(turns)
+}
+
+func removeLegacyConversation() error {
+	path, err := GetFilePath(Cache, cacheFile)
+	if err != nil {
+		return err
+	}
+	return wipeFile(path)
+}
+
+// Overwrites a file with zeros and removes it, a missing file is fine
+func wipeFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(make([]byte, info.Size())); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
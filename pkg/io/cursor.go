@@ -0,0 +1,56 @@
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// How long the terminal gets to report the cursor position
+const cursorTimeout = 500 * time.Millisecond
+
+// CursorRow asks the terminal which row the cursor is on, counting from 0 at the top of the screen
+func CursorRow() (int, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer tty.Close()
+
+	state, err := term.MakeRaw(tty.Fd())
+	if err != nil {
+		return 0, err
+	}
+	defer term.Restore(tty.Fd(), state)
+
+	if err := tty.SetReadDeadline(time.Now().Add(cursorTimeout)); err != nil {
+		return 0, err
+	}
+	if _, err := tty.WriteString("\033[6n"); err != nil {
+		return 0, err
+	}
+
+	// The answer is ESC [ row ; column R
+	var answer []byte
+	buf := make([]byte, 64)
+	for !bytes.ContainsRune(answer, 'R') {
+		n, err := tty.Read(buf)
+		answer = append(answer, buf[:n]...)
+		if err != nil {
+			return 0, err
+		}
+	}
+	start := bytes.LastIndex(answer, []byte("\033["))
+	if start < 0 {
+		return 0, errors.New("unexpected cursor position report")
+	}
+	var row, col int
+	if _, err := fmt.Sscanf(string(answer[start:]), "\033[%d;%dR", &row, &col); err != nil {
+		return 0, fmt.Errorf("unexpected cursor position report: %w", err)
+	}
+	return row - 1, nil
+}
@@ -0,0 +1,162 @@
+package io
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Purpose decides which base directory a file belongs in
+type Purpose int
+
+const (
+	Config Purpose = iota // Settings, keys and remoteConfig.json
+	Cache                 // Files that can be lost without harm, like the conversation cache
+	Data                  // Files the user created and wants to keep
+	State                 // Bookkeeping such as logs and the warning ledger
+)
+
+// Returns lexido's directory for the given purpose, following the XDG base directory spec
+// with the usual fallbacks, and the platform's own locations on macOS and Windows
+func Dir(purpose Purpose) (string, error) {
+	env, fallback := "", ""
+	switch purpose {
+	case Config:
+		env = "XDG_CONFIG_HOME"
+	case Cache:
+		env = "XDG_CACHE_HOME"
+	case Data:
+		env = "XDG_DATA_HOME"
+		fallback = filepath.Join(".local", "share")
+	case State:
+		env = "XDG_STATE_HOME"
+		fallback = filepath.Join(".local", "state")
+	default:
+		return "", fmt.Errorf("unknown purpose %d", purpose)
+	}
+
+	// An explicit XDG variable wins everywhere, also on macOS where dotfile setups often set them
+	if dir := os.Getenv(env); dir != "" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, "lexido"), nil
+	}
+
+	var base string
+	var err error
+	switch {
+	case purpose == Config:
+		base, err = os.UserConfigDir()
+	case purpose == Cache:
+		base, err = os.UserCacheDir()
+	case runtime.GOOS == "darwin":
+		base, err = os.UserConfigDir() // ~/Library/Application Support
+	case runtime.GOOS == "windows":
+		base, err = os.UserCacheDir() // %LocalAppData%
+	default:
+		var home string
+		home, err = os.UserHomeDir()
+		base = filepath.Join(home, fallback)
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "lexido"), nil
+}
+
+// Returns the path of a file in lexido's directory for the given purpose
+func GetFilePath(purpose Purpose, file string) (string, error) {
+	dir, err := Dir(purpose)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, file), nil
+}
+
+// Files older versions kept in ~/.lexido, with where they belong now
+var legacyFiles = []struct {
+	file    string
+	purpose Purpose
+}{
+	{keyringFile, Config},
+	{"remoteConfig.json", Config},
+	{cacheFile, Cache},
+	{"nag_ledger.json", State},
+}
+
+// Moves files from the locations of older versions to their XDG directories.
+// It returns a line per moved file so the caller can tell the user once, later runs find nothing to move.
+func MigrateLegacyFiles() ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	type move struct{ from, to string }
+	var moves []move
+
+	legacyDir := filepath.Join(home, ".lexido")
+	for _, legacy := range legacyFiles {
+		to, err := GetFilePath(legacy.purpose, legacy.file)
+		if err != nil {
+			return nil, err
+		}
+		moves = append(moves, move{filepath.Join(legacyDir, legacy.file), to})
+	}
+
+	// The credentials file used to be in ~/.config/lexido on every platform
+	credentials, err := GetFilePath(Config, credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	moves = append(moves, move{filepath.Join(home, ".config", "lexido", credentialsFile), credentials})
+
+	var notices []string
+	var errs []error
+	for _, m := range moves {
+		if m.from == m.to {
+			continue
+		}
+		if _, err := os.Stat(m.from); err != nil {
+			continue
+		}
+		if _, err := os.Stat(m.to); err == nil {
+			// Never overwrite a file that was already written to the new location
+			continue
+		}
+
+		if err := moveFile(m.from, m.to); err != nil {
+			errs = append(errs, fmt.Errorf("moving %s to %s: %w", m.from, m.to, err))
+			continue
+		}
+		notices = append(notices, fmt.Sprintf("Moved %s to %s", m.from, m.to))
+	}
+
+	// Only removed once empty, files lexido doesn't know about are left alone
+	os.Remove(legacyDir)
+
+	return notices, errors.Join(errs...)
+}
+
+// Moves a file, copying it when the destination is on another filesystem
+func moveFile(from string, to string) error {
+	if err := ensureDirForFile(to); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(to, content, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
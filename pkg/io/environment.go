@@ -0,0 +1,64 @@
+package io
+
+import (
+	"os"
+	"strings"
+)
+
+// Environment is where lexido runs beyond the operating system: WSL, a container, an SSH session and the init system
+type Environment struct {
+	WSL       bool
+	Container string // docker, podman, lxc, kubernetes or container, empty outside of one
+	SSH       bool
+	Init      string // Name of PID 1, e.g. systemd, init or tini
+}
+
+// DetectEnvironment runs the detectors below, each reads its own files so a false positive can be traced to one
+func DetectEnvironment() Environment {
+	procVersion, _ := os.ReadFile("/proc/version")
+	cgroup, _ := os.ReadFile("/proc/1/cgroup")
+	comm, _ := os.ReadFile("/proc/1/comm")
+	_, dockerenvErr := os.Stat("/.dockerenv")
+	_, containerenvErr := os.Stat("/run/.containerenv")
+
+	return Environment{
+		WSL:       IsWSL(string(procVersion), os.Getenv("WSL_DISTRO_NAME")),
+		Container: ContainerRuntime(dockerenvErr == nil, containerenvErr == nil, os.Getenv("container"), os.Getenv("KUBERNETES_SERVICE_HOST"), string(cgroup)),
+		SSH:       IsSSHSession(os.Getenv("SSH_CONNECTION"), os.Getenv("SSH_TTY")),
+		Init:      InitSystem(string(comm)),
+	}
+}
+
+// IsWSL reports whether /proc/version names Microsoft's kernel, or WSL exported the distribution name
+func IsWSL(procVersion string, distroName string) bool {
+	version := strings.ToLower(procVersion)
+	return distroName != "" || strings.Contains(version, "microsoft") || strings.Contains(version, "wsl")
+}
+
+// ContainerRuntime names the container lexido runs in from the marker files docker and podman leave, the container
+// variable systemd-nspawn, lxc and podman set, kubernetes' service variables and the cgroup of PID 1
+func ContainerRuntime(dockerenv bool, containerenv bool, containerVar string, kubernetesHost string, cgroup string) string {
+	switch {
+	case kubernetesHost != "" || strings.Contains(cgroup, "kubepods"):
+		return "kubernetes"
+	case dockerenv || strings.Contains(cgroup, "/docker"):
+		return "docker"
+	case containerenv || containerVar == "podman" || strings.Contains(cgroup, "libpod"):
+		return "podman"
+	case containerVar == "lxc" || strings.Contains(cgroup, "/lxc"):
+		return "lxc"
+	case containerVar != "":
+		return containerVar
+	}
+	return ""
+}
+
+// IsSSHSession reports whether the shell came in over SSH
+func IsSSHSession(connection string, tty string) bool {
+	return connection != "" || tty != ""
+}
+
+// InitSystem returns the name of PID 1 from /proc/1/comm, empty when it can't be read
+func InitSystem(comm string) string {
+	return strings.TrimSpace(comm)
+}
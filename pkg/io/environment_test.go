@@ -0,0 +1,69 @@
+package io
+
+import "testing"
+
+func TestIsWSL(t *testing.T) {
+	tests := []struct {
+		procVersion, distro string
+		want                bool
+	}{
+		{"Linux version 5.15.153.1-microsoft-standard-WSL2 (root@941d701f84f1)", "", true},
+		{"Linux version 4.4.0-19041-Microsoft (Microsoft@Microsoft.com)", "", true},
+		{"", "Ubuntu", true},
+		{"Linux version 6.8.0-45-generic (buildd@lcy02-amd64-075) (gcc 13.2.0)", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		if got := IsWSL(test.procVersion, test.distro); got != test.want {
+			t.Errorf("IsWSL(%q, %q) = %v, want %v", test.procVersion, test.distro, got, test.want)
+		}
+	}
+}
+
+func TestContainerRuntime(t *testing.T) {
+	tests := []struct {
+		name                      string
+		dockerenv, containerenv   bool
+		containerVar, k8s, cgroup string
+		want                      string
+	}{
+		{name: "bare machine", cgroup: "0::/init.scope", want: ""},
+		{name: "systemd user slice", cgroup: "0::/user.slice/user-1000.slice/session-2.scope", want: ""},
+		{name: "docker marker", dockerenv: true, want: "docker"},
+		{name: "docker cgroup v1", cgroup: "12:pids:/docker/3f2a1b\n11:cpu:/docker/3f2a1b", want: "docker"},
+		{name: "podman marker", containerenv: true, want: "podman"},
+		{name: "podman variable", containerVar: "podman", want: "podman"},
+		{name: "podman cgroup", cgroup: "0::/machine.slice/libpod-3f2a1b.scope", want: "podman"},
+		{name: "lxc variable", containerVar: "lxc", want: "lxc"},
+		{name: "lxc cgroup", cgroup: "0::/lxc/container1", want: "lxc"},
+		{name: "systemd-nspawn", containerVar: "systemd-nspawn", want: "systemd-nspawn"},
+		{name: "kubernetes variable", k8s: "10.96.0.1", dockerenv: true, want: "kubernetes"},
+		{name: "kubernetes cgroup", cgroup: "0::/kubepods/besteffort/pod1234", want: "kubernetes"},
+	}
+	for _, test := range tests {
+		got := ContainerRuntime(test.dockerenv, test.containerenv, test.containerVar, test.k8s, test.cgroup)
+		if got != test.want {
+			t.Errorf("%s: ContainerRuntime() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsSSHSession(t *testing.T) {
+	if !IsSSHSession("192.168.1.2 50022 192.168.1.3 22", "") {
+		t.Error("IsSSHSession with SSH_CONNECTION = false, want true")
+	}
+	if !IsSSHSession("", "/dev/pts/0") {
+		t.Error("IsSSHSession with SSH_TTY = false, want true")
+	}
+	if IsSSHSession("", "") {
+		t.Error("IsSSHSession without either = true, want false")
+	}
+}
+
+func TestInitSystem(t *testing.T) {
+	for comm, want := range map[string]string{"systemd\n": "systemd", "tini\n": "tini", "": ""} {
+		if got := InitSystem(comm); got != want {
+			t.Errorf("InitSystem(%q) = %q, want %q", comm, got, want)
+		}
+	}
+}
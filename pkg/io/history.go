@@ -0,0 +1,174 @@
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Only the end of a history file is read, the entries lexido wants are the latest ones
+const historyTailSize = 256 * 1024
+
+// Returns the shell the user runs, "bash", "zsh" or "fish", based on $SHELL
+func UserShell() string {
+	return filepath.Base(os.Getenv("SHELL"))
+}
+
+// Returns the history file of the given shell, honouring $HISTFILE for bash and zsh
+func HistoryFilePath(shell string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	switch shell {
+	case "bash":
+		if file := os.Getenv("HISTFILE"); file != "" {
+			return file, nil
+		}
+		return filepath.Join(home, ".bash_history"), nil
+	case "zsh":
+		if file := os.Getenv("HISTFILE"); file != "" {
+			return file, nil
+		}
+		dir := os.Getenv("ZDOTDIR")
+		if dir == "" {
+			dir = home
+		}
+		return filepath.Join(dir, ".zsh_history"), nil
+	case "fish":
+		dir := os.Getenv("XDG_DATA_HOME")
+		if dir == "" {
+			dir = filepath.Join(home, ".local", "share")
+		}
+		return filepath.Join(dir, "fish", "fish_history"), nil
+	}
+	return "", fmt.Errorf("reading the history of %q is not supported, only bash, zsh and fish", shell)
+}
+
+// Reads the latest entries of the user's shell history, oldest first
+func ReadShellHistory() ([]string, error) {
+	shell := UserShell()
+	path, err := HistoryFilePath(shell)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readTail(path, historyTailSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseHistory(shell, content), nil
+}
+
+// Reads up to size bytes from the end of a file, starting at a line boundary
+func readTail(path string, size int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - size
+	if offset < 0 {
+		offset = 0
+	}
+	content := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(content, offset); err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		// The first line was cut off
+		if i := bytes.IndexByte(content, '\n'); i >= 0 {
+			content = content[i+1:]
+		}
+	}
+	return content, nil
+}
+
+// Parses the contents of a history file in the format of the given shell into entries, oldest first
+func ParseHistory(shell string, content []byte) []string {
+	switch shell {
+	case "zsh":
+		return parseZshHistory(content)
+	case "fish":
+		return parseFishHistory(content)
+	default:
+		return parseBashHistory(content)
+	}
+}
+
+// Lines bash writes before an entry when HISTTIMEFORMAT is set
+var bashTimestamp = regexp.MustCompile(`^#\d+$`)
+
+func parseBashHistory(content []byte) []string {
+	var entries []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || bashTimestamp.MatchString(line) {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries
+}
+
+// Metadata zsh puts before entries with EXTENDED_HISTORY, ": <start>:<duration>;"
+var zshExtended = regexp.MustCompile(`^: \d+:\d+;`)
+
+func parseZshHistory(content []byte) []string {
+	var entries []string
+	var entry strings.Builder
+	for _, line := range strings.Split(string(unmetafy(content)), "\n") {
+		// Multi-line entries end every line but the last with a backslash
+		if strings.HasSuffix(line, "\\") {
+			entry.WriteString(strings.TrimSuffix(line, "\\") + "\n")
+			continue
+		}
+		entry.WriteString(line)
+
+		text := strings.TrimSpace(zshExtended.ReplaceAllString(entry.String(), ""))
+		entry.Reset()
+		if text != "" {
+			entries = append(entries, text)
+		}
+	}
+	return entries
+}
+
+// Undoes zsh's escaping of non-ASCII bytes in the history file, 0x83 followed by the byte xor 32
+func unmetafy(content []byte) []byte {
+	out := make([]byte, 0, len(content))
+	for i := 0; i < len(content); i++ {
+		if content[i] == 0x83 && i+1 < len(content) {
+			i++
+			out = append(out, content[i]^32)
+			continue
+		}
+		out = append(out, content[i])
+	}
+	return out
+}
+
+func parseFishHistory(content []byte) []string {
+	var entries []string
+	unescape := strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+	for _, line := range strings.Split(string(content), "\n") {
+		// Entries are a YAML-like list, "- cmd: <command>" followed by indented when: and paths: lines
+		cmd, ok := strings.CutPrefix(line, "- cmd: ")
+		if !ok {
+			continue
+		}
+		if cmd = strings.TrimSpace(unescape.Replace(cmd)); cmd != "" {
+			entries = append(entries, cmd)
+		}
+	}
+	return entries
+}
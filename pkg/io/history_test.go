@@ -0,0 +1,67 @@
+package io
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseHistory(t *testing.T) {
+	tests := []struct {
+		shell   string
+		content string
+		want    []string
+	}{
+		{"bash", "ls\n#1700000000\ncd /tmp\n\n  make  \n", []string{"ls", "cd /tmp", "make"}},
+		{"zsh", ": 1700000000:0;ls\n: 1700000001:2;for f in *; do\\\necho $f\\\ndone\ngit status\n", []string{"ls", "for f in *; do\necho $f\ndone", "git status"}},
+		{"zsh", "echo caf\x83\x23\n", []string{"echo caf\x03"}},
+		{"fish", "- cmd: ls\n  when: 1700000000\n- cmd: echo a\\nb\n  when: 1700000001\n  paths:\n    - a\n", []string{"ls", "echo a\nb"}},
+	}
+	for _, test := range tests {
+		if got := ParseHistory(test.shell, []byte(test.content)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseHistory(%s, %q) = %q, want %q", test.shell, test.content, got, test.want)
+		}
+	}
+}
+
+func TestHistoryFilePath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("HISTFILE", "")
+	t.Setenv("ZDOTDIR", "")
+	t.Setenv("XDG_DATA_HOME", "")
+
+	for shell, want := range map[string]string{
+		"bash": filepath.Join(home, ".bash_history"),
+		"zsh":  filepath.Join(home, ".zsh_history"),
+		"fish": filepath.Join(home, ".local", "share", "fish", "fish_history"),
+	} {
+		if got, err := HistoryFilePath(shell); err != nil || got != want {
+			t.Errorf("HistoryFilePath(%s) = %q, %v, want %q", shell, got, err, want)
+		}
+	}
+
+	t.Setenv("HISTFILE", "/tmp/histfile")
+	if got, _ := HistoryFilePath("bash"); got != "/tmp/histfile" {
+		t.Errorf("HistoryFilePath(bash) = %q, want $HISTFILE", got)
+	}
+	if _, err := HistoryFilePath("tcsh"); err == nil {
+		t.Error("HistoryFilePath(tcsh) succeeded, want an error for an unsupported shell")
+	}
+}
+
+func TestReadTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("first line\nsecond\nthird\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The cut off first line is dropped
+	got, err := readTail(path, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "third\n" {
+		t.Errorf("readTail() = %q, want the whole lines at the end", got)
+	}
+}
@@ -0,0 +1,141 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	goio "io"
+	"os"
+
+	"github.com/micr0-dev/lexido/pkg/logging"
+)
+
+// Limits of images attached with --image or piped in
+const (
+	MaxImageSize = 20 * 1024 * 1024 // Of a file, and of all images of a prompt once downscaled, Gemini takes no more inline
+	MaxImageSide = 2048             // Longest side sent, larger images are downscaled first
+)
+
+// Image is a PNG or JPEG sent along with the prompt to a provider that can read images
+type Image struct {
+	Source string // Path of the file, or stdin
+	MIME   string // image/png or image/jpeg
+	Data   []byte
+}
+
+// Returns the MIME type of a PNG or JPEG by its magic bytes, empty for anything else
+func ImageType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff}):
+		return "image/jpeg"
+	}
+	return ""
+}
+
+// ReadImage reads a PNG or JPEG for --image, downscaled when a side is longer than MaxImageSide
+func ReadImage(path string) (Image, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Image{}, fmt.Errorf("can't attach image %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return Image{}, fmt.Errorf("can't attach image %s: it is a directory", path)
+	}
+	if info.Size() > MaxImageSize {
+		return Image{}, fmt.Errorf("image %s is %s, images can be at most %s", path, FormatSize(info.Size()), FormatSize(MaxImageSize))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Image{}, fmt.Errorf("can't attach image %s: %w", path, err)
+	}
+	return newImage(path, data)
+}
+
+// Reads piped input that starts like a PNG or JPEG as an image, ok is false for any other input
+func readPipedImage(r *bufio.Reader) (img Image, ok bool, err error) {
+	magic, _ := r.Peek(8)
+	if ImageType(magic) == "" {
+		return Image{}, false, nil
+	}
+	data, err := goio.ReadAll(goio.LimitReader(r, MaxImageSize+1))
+	if err != nil {
+		return Image{}, true, err
+	}
+	if len(data) > MaxImageSize {
+		return Image{}, true, fmt.Errorf("the piped image is over %s, the limit of images", FormatSize(MaxImageSize))
+	}
+	img, err = newImage("stdin", data)
+	return img, true, err
+}
+
+func newImage(source string, data []byte) (Image, error) {
+	mime := ImageType(data)
+	if mime == "" {
+		return Image{}, fmt.Errorf("%s is not a PNG or JPEG image", source)
+	}
+	return downscale(Image{Source: source, MIME: mime, Data: data})
+}
+
+// Shrinks an image with a side longer than MaxImageSide. The providers would scale it down anyway,
+// this way less is uploaded and the request stays under their size limit.
+func downscale(img Image) (Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil {
+		return Image{}, fmt.Errorf("can't read image %s: %w", img.Source, err)
+	}
+	longest := max(cfg.Width, cfg.Height)
+	if longest <= MaxImageSide {
+		return img, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return Image{}, fmt.Errorf("can't read image %s: %w", img.Source, err)
+	}
+	width := max(1, cfg.Width*MaxImageSide/longest)
+	height := max(1, cfg.Height*MaxImageSide/longest)
+	scaled := resize(src, width, height)
+
+	var buf bytes.Buffer
+	if img.MIME == "image/png" {
+		err = png.Encode(&buf, scaled)
+	} else {
+		err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return Image{}, fmt.Errorf("can't downscale image %s: %w", img.Source, err)
+	}
+	logging.Infof("Downscaled %s from %dx%d to %dx%d", img.Source, cfg.Width, cfg.Height, width, height)
+	img.Data = buf.Bytes()
+	return img, nil
+}
+
+// Scales src to width×height, each pixel is the average of the pixels of src it covers
+func resize(src image.Image, width, height int) *image.RGBA64 {
+	bounds := src.Bounds()
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
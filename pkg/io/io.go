@@ -1,98 +1,218 @@
 package io
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/logging"
 )
 
-const cacheDir = ".lexido"
 const cacheFile = "lexido_conversation_cache.txt"
 const keyringFile = "keyring.json"
+const credentialsFile = "credentials.json"
 
-// Writes conversation to cache file
-func CacheConversation(conversation string) error {
-	filePath, err := GetFilePath(cacheFile)
-	if err != nil {
-		return err
-	}
+// How long system commands such as hostnamectl and sw_vers may take before they are given up on
+var CommandTimeout = 5 * time.Second
 
-	// Ensure the .lexido directory exists
-	err = ensureDirForFile(filePath)
+// Kept in sync with prompt.LegacyNoPromptPlaceholder, pkg/io can't import pkg/prompt
+const legacyNoPromptPlaceholder = "The user did not provide a prompt."
+
+func ensureDirForFile(filePath string) error {
+	return os.MkdirAll(filepath.Dir(filePath), 0700)
+}
+
+// Checks whether the given file is an interactive terminal rather than a pipe or file
+func IsTerminal(f *os.File) bool {
+	fileInfo, err := f.Stat()
 	if err != nil {
-		return err
+		return false
 	}
-	return os.WriteFile(filePath, []byte(conversation), 0644)
+	return fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// Forces the credentials file to be used instead of the keyring, set by --no-keyring
+var forceCredentialsFile bool
+
+// Switches all keyring reads and writes over to the credentials file
+func DisableKeyring() {
+	forceCredentialsFile = true
 }
 
-// Reads conversation from cache file
-func ReadConversationCache() (string, error) {
-	filePath, err := GetFilePath(cacheFile)
+// Returns the path of the credentials file, which holds the settings with --no-keyring. It is in the config directory,
+// or in the data directory when the config directory couldn't be written and the settings moved there.
+func GetCredentialsFilePath() (string, error) {
+	fallbackPath, err := GetFilePath(Data, credentialsFile)
 	if err != nil {
 		return "", err
 	}
+	if _, err := os.Stat(fallbackPath); err == nil {
+		return fallbackPath, nil
+	}
+	return GetFilePath(Config, credentialsFile)
+}
 
-	// Ensure the .lexido directory exists
-	err = ensureDirForFile(filePath)
+// Returns the file holding the settings: the credentials file with --no-keyring, after the settings moved to the
+// data directory, or when it is the only one of the two that exists because earlier runs used --no-keyring, and the
+// keyring otherwise. Nothing is switched over for later calls, each one decides again.
+func activeFile() (string, bool, error) {
+	credentialsPath, err := GetCredentialsFilePath()
 	if err != nil {
-		return "", err
+		return "", false, err
+	}
+	fallbackPath, err := GetFilePath(Data, credentialsFile)
+	if err != nil {
+		return "", false, err
+	}
+	if forceCredentialsFile || credentialsPath == fallbackPath {
+		return credentialsPath, true, nil
 	}
 
-	content, err := os.ReadFile(filePath)
+	keyringPath, err := GetFilePath(Config, keyringFile)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
-	return string(content), nil
+	if _, err := os.Stat(keyringPath); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(credentialsPath); err == nil {
+			return credentialsPath, true, nil
+		}
+	}
+	return keyringPath, false, nil
 }
 
-func ensureDirForFile(filePath string) error {
-	return os.MkdirAll(filepath.Dir(filePath), 0700)
+// Reports which backend currently holds lexido's settings
+func ActiveKeyring() string {
+	if _, credentials, err := activeFile(); err == nil && credentials {
+		return "credentials file"
+	}
+	return "keyring"
 }
 
-// Helper function to check and read piped input
-func ReadPipedInput() (string, error) {
-	fileInfo, err := os.Stdin.Stat()
+// Checks whether an error means the settings file can't be written at all, rather than a problem with its content
+func isKeyringUnavailable(err error) bool {
+	return errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EROFS) || errors.Is(err, syscall.ENOTDIR)
+}
+
+// Saves a value to the keyring, or to the credentials file when that holds the settings. When the config directory
+// can't be written, as with a read-only ~/.config in a container, the settings move to the credentials file in the
+// data directory, which holds them from then on.
+func SaveToKeyring(field string, val string) error {
+	filePath, _, err := activeFile()
 	if err != nil {
-		return "", err
+		return err
+	}
+	err = saveToFile(filePath, field, val)
+	if err == nil || !isKeyringUnavailable(err) {
+		return err
 	}
 
-	// Check if data is being piped into stdin
-	if fileInfo.Mode()&os.ModeNamedPipe != 0 {
-		var inputData string
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			inputData += scanner.Text() + "\n"
-		}
-		if err := scanner.Err(); err != nil {
-			return "", err
-		}
-		return inputData, nil
+	fallbackPath, pathErr := GetFilePath(Data, credentialsFile)
+	if pathErr != nil || fallbackPath == filePath {
+		return err
+	}
+	logging.Infof("%s can't be written (%v), keeping the settings in %s instead", filePath, err, fallbackPath)
+	saved, readErr := readAllFromFile(filePath)
+	if readErr != nil {
+		saved = map[string]string{}
 	}
-	return "", nil // No piped data
+	saved[field] = val
+	return writeAllToFile(fallbackPath, saved)
 }
 
-func GetFilePath(file string) (string, error) {
-	homeDir, err := os.UserHomeDir()
+// Reads a value from the keyring, or from the credentials file when that holds the settings
+func ReadFromKeyring(field string) (string, error) {
+	filePath, _, err := activeFile()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(homeDir, cacheDir, file), nil
+	return readFromFile(filePath, field)
 }
 
-func SaveToKeyring(field string, val string) error {
-	filePath, err := GetFilePath(keyringFile)
+// ErrNotFound is wrapped by the errors of ReadFromKeyring for fields that were never saved, whichever backend
+// holds them and whatever the system says about a missing file
+var ErrNotFound = errs.ErrNotFound
+
+// Store reads and saves values by field name like the keyring does
+type Store interface {
+	Read(field string) (string, error)
+	Save(field string, value string) error
+}
+
+// The keyring, or the credentials file when that holds the settings
+type keyringStore struct{}
+
+func (keyringStore) Read(field string) (string, error) {
+	return ReadFromKeyring(field)
+}
+
+func (keyringStore) Save(field string, value string) error {
+	return SaveToKeyring(field, value)
+}
+
+// Returns the saved value of field, saving and returning def when it was never saved
+func GetOrInit(field string, def string) (string, error) {
+	return GetOrInitIn(keyringStore{}, field, def)
+}
+
+// Same as GetOrInit for the values kept in store
+func GetOrInitIn(store Store, field string, def string) (string, error) {
+	val, err := store.Read(field)
+	if !errors.Is(err, ErrNotFound) {
+		return val, err
+	}
+	if err := store.Save(field, def); err != nil {
+		return "", err
+	}
+	return def, nil
+}
+
+// Removes a value from whichever backend holds it
+func DeleteFromKeyring(field string) error {
+	filePath, _, err := activeFile()
 	if err != nil {
 		return err
 	}
 
-	// Ensure the .lexido directory exists
-	err = ensureDirForFile(filePath)
+	data, err := readAllFromFile(filePath)
+	if err != nil {
+		return err
+	}
+	if _, ok := data[field]; !ok {
+		return fmt.Errorf("field %w", ErrNotFound)
+	}
+	delete(data, field)
+
+	updatedData, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, updatedData, 0600)
+}
+
+func readAllFromFile(filePath string) (map[string]string, error) {
+	file, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]string)
+	if err := json.Unmarshal(file, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func saveToFile(filePath string, field string, val string) error {
+	// Ensure the directory exists
+	err := ensureDirForFile(filePath)
 	if err != nil {
 		return err
 	}
@@ -134,21 +254,23 @@ func SaveToKeyring(field string, val string) error {
 	return os.WriteFile(filePath, updatedData, 0600)
 }
 
-func ReadFromKeyring(field string) (string, error) {
-	filePath, err := GetFilePath(keyringFile)
-	if err != nil {
-		return "", err
+// Writes the values to the file, replacing what it held
+func writeAllToFile(filePath string, data map[string]string) error {
+	if err := ensureDirForFile(filePath); err != nil {
+		return err
 	}
-
-	// Read the file
-	file, err := os.ReadFile(filePath)
+	updatedData, err := json.MarshalIndent(data, "", "    ")
 	if err != nil {
-		return "", err
+		return err
 	}
+	return os.WriteFile(filePath, updatedData, 0600)
+}
 
-	// Unmarshal the data into a map
-	data := make(map[string]string)
-	err = json.Unmarshal(file, &data)
+func readFromFile(filePath string, field string) (string, error) {
+	data, err := readAllFromFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errs.Wrap(ErrNotFound, err)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -156,7 +278,7 @@ func ReadFromKeyring(field string) (string, error) {
 	// Retrieve the value for the specified field
 	val, ok := data[field]
 	if !ok {
-		return "", errors.New("field not found")
+		return "", fmt.Errorf("field %w", errs.ErrNotFound)
 	}
 
 	return val, nil
@@ -164,23 +286,20 @@ func ReadFromKeyring(field string) (string, error) {
 
 // Helper function to run command and return trimmed output string
 func RunCmd(command string, args ...string) (string, error) {
-	cmd := exec.Command(command, args...)
+	ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	// Children of a killed shell can keep its output open, they aren't waited for either
+	cmd.WaitDelay = 100 * time.Millisecond
 	data, err := cmd.Output()
-	if err != nil {
-		return "", err
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("timed out after %s running %s", CommandTimeout, command)
 	}
-	return strings.TrimSpace(string(data)), nil
-}
-
-// Helper function to extract value from hostnamectl output
-func ExtractHostnameCtlValue(field string) (string, error) {
-	txtcmd := fmt.Sprintf("hostnamectl | grep \"%s\"", field)
-	data, err := RunCmd("bash", "-c", txtcmd)
 	if err != nil {
 		return "", err
 	}
-	// Replace field name and remove leading and trailing white spaces
-	return strings.TrimSpace(strings.ReplaceAll(data, field+":", "")), nil
+	return strings.TrimSpace(string(data)), nil
 }
 
 // checks if a given package manager is installed by looking for its executable in the system's PATH.
@@ -189,40 +308,10 @@ func IsPackageManagerInstalled(name string) bool {
 	return err == nil
 }
 
-// returns a list of installed package managers from a predefined list.
+// returns a list of installed package managers from the list known for this platform.
 func DetectPackageManagers() []string {
 	var installedManagers []string
-	packageManagers := []string{
-		"apt",          // Debian, Ubuntu
-		"dnf",          // Fedora
-		"yum",          // Older Fedora, CentOS
-		"pacman",       // Arch Linux
-		"brew",         // macOS
-		"port",         // macOS (MacPorts)
-		"zypper",       // openSUSE
-		"emerge",       // Gentoo
-		"xbps-install", // Void Linux
-		"apk",          // Alpine Linux
-		"nix",          // NixOS or multi-distro Nix package manager
-		"snap",         // Snap packages (Ubuntu and others)
-		"flatpak",      // Flatpak (universal package system)
-		"yay",          // AUR helper for Arch Linux
-		"paru",         // Another AUR helper for Arch Linux
-	}
-
-	// Detect Operating System (MacOS or Linux)
-	osname, err := RunCmd("uname", "-s")
-	if err != nil {
-		log.Println(err)
-		osname = "Unknown"
-	}
-
-	// Hard coded fix for ghost apt package manager on macOS
-	if strings.Contains(strings.ToLower(osname), "darwin") {
-		packageManagers = packageManagers[1:]
-	}
-
-	for _, manager := range packageManagers {
+	for _, manager := range packageManagers() {
 		if IsPackageManagerInstalled(manager) {
 			installedManagers = append(installedManagers, manager)
 		}
@@ -231,36 +320,6 @@ func DetectPackageManagers() []string {
 	return installedManagers
 }
 
-func DisplayHelp() {
-	fmt.Println(`Lexido Command Line Tool Usage:
-
-Usage:
-    To get command suggestions:
-        lexido "install teamspeak via docker"
-
-    To continue with a previous prompt:
-        lexido -c "add more details or follow-up"
-
-    To use with piping commands:
-        ls | lexido "what should I do with these files?"
-
-	To run llama3 locally via ollama:
-		lexido -l -m llama3 "install teamspeak via docker"
-    
-Options:
-    -h, --help          Display help information
-    -c                  Continue with a previous prompt or add more details to it
-	-v, --version       Display version information
-	-g   				Temporarily run via gemini
-	-l 					Temporarily run locally via ollama
-	-r 					Temporarily run via remote
-	-m string			Temporarily run with a model to be used by ollama
-	--setModel string	Set the default model to be used by ollama
-	--setDefault string	Set the default mode for lexido to run in (gemini, local, remote)
-
-Note: Lexido's outputs may not always be factual. User discretion is advised.`)
-}
-
 func DisplayVersion(version string) {
 	fmt.Println("Lexido Command Line Tool v" + version)
 }
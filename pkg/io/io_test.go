@@ -0,0 +1,170 @@
+package io
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A keyring backend in memory, broken makes every call fail like a keyring that can't be reached
+type fakeKeyring struct {
+	values map[string]string
+	broken error
+	saves  int
+}
+
+func (k *fakeKeyring) Read(field string) (string, error) {
+	if k.broken != nil {
+		return "", k.broken
+	}
+	value, ok := k.values[field]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (k *fakeKeyring) Save(field string, value string) error {
+	if k.broken != nil {
+		return k.broken
+	}
+	k.saves++
+	k.values[field] = value
+	return nil
+}
+
+func TestGetOrInitInMissingKey(t *testing.T) {
+	k := &fakeKeyring{values: map[string]string{}}
+	got, err := GetOrInitIn(k, "OLLAMA_MODEL", "llama3")
+	if err != nil || got != "llama3" {
+		t.Fatalf("GetOrInitIn() = %q, %v, want the default", got, err)
+	}
+	if k.values["OLLAMA_MODEL"] != "llama3" {
+		t.Errorf("the default wasn't saved, the keyring holds %v", k.values)
+	}
+}
+
+func TestGetOrInitInExistingValue(t *testing.T) {
+	k := &fakeKeyring{values: map[string]string{"OLLAMA_MODEL": "mistral"}}
+	got, err := GetOrInitIn(k, "OLLAMA_MODEL", "llama3")
+	if err != nil || got != "mistral" {
+		t.Fatalf("GetOrInitIn() = %q, %v, want the saved value", got, err)
+	}
+	if k.saves != 0 {
+		t.Errorf("the saved value was overwritten %d times", k.saves)
+	}
+}
+
+func TestGetOrInitInUnavailableBackend(t *testing.T) {
+	unavailable := errors.New("keyring: permission denied")
+	k := &fakeKeyring{values: map[string]string{}, broken: unavailable}
+	got, err := GetOrInitIn(k, "OLLAMA_MODEL", "llama3")
+	// The error is passed on rather than mistaken for a missing key and papered over with the default
+	if !errors.Is(err, unavailable) || got != "" {
+		t.Errorf("GetOrInitIn() = %q, %v, want the error of the keyring", got, err)
+	}
+	if k.saves != 0 {
+		t.Error("the default was saved to a keyring that can't be read")
+	}
+}
+
+func TestGetOrInitInSaveFails(t *testing.T) {
+	full := errors.New("disk full")
+	k := &savingFails{fakeKeyring{values: map[string]string{}}, full}
+	if _, err := GetOrInitIn(k, "OLLAMA_MODEL", "llama3"); !errors.Is(err, full) {
+		t.Errorf("GetOrInitIn() = %v, want the error of the save", err)
+	}
+}
+
+// Reads work but saving fails, e.g. on a full disk
+type savingFails struct {
+	fakeKeyring
+	err error
+}
+
+func (k *savingFails) Save(field string, value string) error {
+	return k.err
+}
+
+func TestReadFromKeyringNotFound(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	// Neither a missing file nor a missing field is mistaken for another error
+	if _, err := ReadFromKeyring("GOOGLE_AI_KEY"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadFromKeyring() without a keyring file = %v, want ErrNotFound", err)
+	}
+	if err := SaveToKeyring("OLLAMA_MODEL", "llama3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFromKeyring("GOOGLE_AI_KEY"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadFromKeyring() of a missing field = %v, want ErrNotFound", err)
+	}
+	if got, err := ReadFromKeyring("OLLAMA_MODEL"); err != nil || got != "llama3" {
+		t.Errorf("ReadFromKeyring() = %q, %v, want the saved value", got, err)
+	}
+}
+
+func TestReadFromKeyringCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	path := filepath.Join(dir, "lexido", keyringFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadFromKeyring("OLLAMA_MODEL")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadFromKeyring() of a corrupt file = %v, want an error other than ErrNotFound", err)
+	}
+}
+
+func TestSaveToKeyringFallsBackToDataDir(t *testing.T) {
+	config, data := t.TempDir(), t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("XDG_DATA_HOME", data)
+	// A file where the config directory should be can't hold the keyring, like a read-only ~/.config
+	if err := os.WriteFile(filepath.Join(config, "lexido"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveToKeyring("OLLAMA_MODEL", "llama3"); err != nil {
+		t.Fatalf("SaveToKeyring() with an unwritable config directory = %v, want the fallback", err)
+	}
+	if err := SaveToKeyring("DEFAULT_MODE", "ollama"); err != nil {
+		t.Fatal(err)
+	}
+
+	fallback := filepath.Join(data, "lexido", credentialsFile)
+	if path, err := GetCredentialsFilePath(); err != nil || path != fallback {
+		t.Errorf("GetCredentialsFilePath() = %q, %v, want %q", path, err, fallback)
+	}
+	if got := ActiveKeyring(); got != "credentials file" {
+		t.Errorf("ActiveKeyring() = %q, want the credentials file", got)
+	}
+	// The second save kept the first value
+	for field, want := range map[string]string{"OLLAMA_MODEL": "llama3", "DEFAULT_MODE": "ollama"} {
+		if got, err := ReadFromKeyring(field); err != nil || got != want {
+			t.Errorf("ReadFromKeyring(%q) = %q, %v, want %q", field, got, err, want)
+		}
+	}
+}
+
+func TestSaveToKeyringReportsOtherErrors(t *testing.T) {
+	config, data := t.TempDir(), t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("XDG_DATA_HOME", data)
+	// A directory where the keyring file should be is a problem with the keyring itself, not an unwritable directory
+	if err := os.MkdirAll(filepath.Join(config, "lexido", keyringFile), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveToKeyring("DEFAULT_MODE", "ollama"); err == nil {
+		t.Error("SaveToKeyring() onto a directory = nil, want the error")
+	}
+	if _, err := os.Stat(filepath.Join(data, "lexido", credentialsFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("credentials file in the data directory after another error: %v, want none", err)
+	}
+}
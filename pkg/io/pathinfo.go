@@ -0,0 +1,128 @@
+package io
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Binary names are passed to the user's shell, so only plain command names are accepted
+var binaryNameRegex = regexp.MustCompile(`^[A-Za-z0-9._+-]+$`)
+
+// How long the shell lookup and version check of a binary may take
+const pathInfoTimeout = 2 * time.Second
+
+// Longest value of a single section of the path context
+const maxPathInfoSection = 2000
+
+// PathContext describes where the named binary resolves from, for questions like "why does my shell find the wrong python".
+// It only ever looks at the binary it is given, never the rest of the environment.
+func PathContext(binary string) (string, error) {
+	if !binaryNameRegex.MatchString(binary) {
+		return "", fmt.Errorf("invalid binary name %q for --with-path", binary)
+	}
+
+	var s strings.Builder
+	s.WriteString(fmt.Sprintf("Environment for %q (requested with --with-path):\n", binary))
+
+	pathDirs := filepath.SplitList(os.Getenv("PATH"))
+	s.WriteString("PATH entries in order: " + bound(strings.Join(pathDirs, string(os.PathListSeparator))) + "\n")
+
+	matches := resolveAll(binary, pathDirs)
+	if len(matches) == 0 {
+		s.WriteString(binary + " was not found in any PATH directory.\n")
+	} else {
+		s.WriteString("Resolution order: " + bound(strings.Join(matches, ", ")) + "\n")
+	}
+
+	if shell, out := shellTypeOutput(binary); out != "" {
+		s.WriteString(fmt.Sprintf("Output of `type -a %s` in %s:\n%s\n", binary, shell, bound(out)))
+	}
+
+	if len(matches) > 0 {
+		if version := versionOf(matches[0]); version != "" {
+			s.WriteString("Version of " + matches[0] + ": " + bound(version) + "\n")
+		}
+	}
+
+	return s.String(), nil
+}
+
+// Lists every executable named binary in PATH order, the first one is what a shell without aliases would run
+func resolveAll(binary string, pathDirs []string) []string {
+	names := []string{binary}
+	if runtime.GOOS == "windows" {
+		for _, ext := range filepath.SplitList(os.Getenv("PATHEXT")) {
+			names = append(names, binary+strings.ToLower(ext))
+		}
+	}
+
+	var matches []string
+	seen := make(map[string]bool)
+	for _, dir := range pathDirs {
+		if dir == "" {
+			dir = "."
+		}
+		for _, name := range names {
+			candidate := filepath.Join(dir, name)
+			info, err := os.Stat(candidate)
+			if err != nil || info.IsDir() || (runtime.GOOS != "windows" && info.Mode()&0111 == 0) {
+				continue
+			}
+			if !seen[candidate] {
+				seen[candidate] = true
+				matches = append(matches, candidate)
+			}
+		}
+	}
+	return matches
+}
+
+// Asks the user's shell how it resolves the binary, which includes aliases and functions.
+// bash and zsh list every match while fish prints one description per line, both are passed along as is.
+func shellTypeOutput(binary string) (string, string) {
+	shell := os.Getenv("SHELL")
+	if shell == "" || runtime.GOOS == "windows" {
+		return "", ""
+	}
+
+	name := filepath.Base(shell)
+	switch name {
+	case "bash", "zsh", "fish", "sh", "dash", "ksh":
+	default:
+		return "", ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pathInfoTimeout)
+	defer cancel()
+
+	// Errors are expected here, e.g. bash exits 1 when nothing is found, and stderr only holds rc file noise
+	out, _ := exec.CommandContext(ctx, shell, "-c", "type -a "+binary).Output()
+	return name, strings.TrimSpace(string(out))
+}
+
+// Returns the first line of `<path> --version`, or nothing if it doesn't answer in time
+func versionOf(path string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), pathInfoTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(line)
+}
+
+func bound(s string) string {
+	if len(s) > maxPathInfoSection {
+		return s[:maxPathInfoSection] + " [...]"
+	}
+	return s
+}
@@ -0,0 +1,125 @@
+package io
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Writes an executable script into dir
+func writeScript(t *testing.T, dir string, name string, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPathContextResolutionOrder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses shell scripts")
+	}
+	first, second := t.TempDir(), t.TempDir()
+	writeScript(t, first, "mytool", `echo "mytool 2.0"`)
+	writeScript(t, second, "mytool", `echo "mytool 1.0"`)
+	t.Setenv("PATH", first+string(os.PathListSeparator)+second)
+	t.Setenv("SHELL", "")
+
+	got, err := PathContext("mytool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := "Resolution order: " + filepath.Join(first, "mytool") + ", " + filepath.Join(second, "mytool")
+	if !strings.Contains(got, order) {
+		t.Errorf("PathContext() = %q, want %q", got, order)
+	}
+	// The version is the one of the binary that wins
+	if !strings.Contains(got, "mytool 2.0") || strings.Contains(got, "mytool 1.0") {
+		t.Errorf("PathContext() = %q, want the version of the first match only", got)
+	}
+}
+
+func TestPathContextMissingBinary(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("SHELL", "")
+	got, err := PathContext("no-such-binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "no-such-binary was not found in any PATH directory") {
+		t.Errorf("PathContext() = %q, want the binary reported as missing", got)
+	}
+	if strings.Contains(got, "Resolution order") || strings.Contains(got, "Version of") {
+		t.Errorf("PathContext() = %q, want no resolution or version for a missing binary", got)
+	}
+}
+
+func TestPathContextSkipsNonExecutables(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executability is a file mode bit on Unix")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes"), []byte("text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if matches := resolveAll("notes", []string{dir}); len(matches) != 0 {
+		t.Errorf("resolveAll(notes) = %q, want a file without the executable bit skipped", matches)
+	}
+	if matches := resolveAll("subdir", []string{dir}); len(matches) != 0 {
+		t.Errorf("resolveAll(subdir) = %q, want directories skipped", matches)
+	}
+}
+
+func TestPathContextRejectsShellSyntax(t *testing.T) {
+	for _, name := range []string{"ls; rm -rf ~", "$(id)", "a b", "../bin/ls", ""} {
+		if _, err := PathContext(name); err == nil {
+			t.Errorf("PathContext(%q) succeeded, want names that aren't plain commands rejected", name)
+		}
+	}
+}
+
+func TestShellTypeOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses shell scripts")
+	}
+
+	// fish prints one description per match, unlike bash
+	shells := t.TempDir()
+	fish := writeScript(t, shells, "fish", `echo "mytool is /opt/bin/mytool"; echo "mytool is /usr/bin/mytool"`)
+	t.Setenv("SHELL", fish)
+	name, out := shellTypeOutput("mytool")
+	if name != "fish" || out != "mytool is /opt/bin/mytool\nmytool is /usr/bin/mytool" {
+		t.Errorf("shellTypeOutput() = %q, %q, want fish's output as is", name, out)
+	}
+
+	// Shells whose type output lexido doesn't know are left out
+	t.Setenv("SHELL", writeScript(t, shells, "nu", `echo anything`))
+	if name, out := shellTypeOutput("mytool"); name != "" || out != "" {
+		t.Errorf("shellTypeOutput() with nu = %q, %q, want nothing", name, out)
+	}
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash isn't installed")
+	}
+	dir := t.TempDir()
+	writeScript(t, dir, "mytool", "true")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("SHELL", bash)
+	name, out = shellTypeOutput("mytool")
+	if name != "bash" || !strings.Contains(out, "mytool is "+filepath.Join(dir, "mytool")) {
+		t.Errorf("shellTypeOutput() = %q, %q, want bash's type -a output", name, out)
+	}
+
+	// bash exits 1 for a missing binary and prints nothing on stdout
+	if _, out := shellTypeOutput("no-such-binary"); out != "" {
+		t.Errorf("shellTypeOutput() of a missing binary = %q, want nothing", out)
+	}
+}
@@ -0,0 +1,173 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// How much piped input is kept by default, the rest would only overflow the model's context window
+const DefaultPipeLimit = 256 * 1024
+
+// ErrBinaryInput is returned for piped input that isn't text
+var ErrBinaryInput = errors.New("piped input is binary data, not text; pipe a PNG or JPEG, or the output of a tool that describes it instead, e.g. file or xxd | head")
+
+// PipedInput is what was piped into lexido. Input over the limit keeps its head and tail,
+// the lines in between are replaced by a marker and counted in DroppedLines.
+type PipedInput struct {
+	Text         string
+	Image        *Image // A PNG or JPEG that was piped in instead of text
+	Truncated    bool
+	DroppedLines int
+	DroppedBytes int64
+}
+
+// Reads piped input if there is any, keeping at most limit bytes of it. A piped PNG or JPEG is read as an image.
+func ReadPipedInput(limit int) (PipedInput, error) {
+	fileInfo, err := os.Stdin.Stat()
+	if err != nil {
+		return PipedInput{}, err
+	}
+
+	// Check if data is being piped into stdin
+	if fileInfo.Mode()&os.ModeNamedPipe == 0 {
+		return PipedInput{}, nil // No piped data
+	}
+	stdin := bufio.NewReader(os.Stdin)
+	if img, ok, err := readPipedImage(stdin); ok {
+		return PipedInput{Image: &img}, err
+	}
+	return ReadLimited(stdin, limit)
+}
+
+// ReadLimited reads r keeping the first and last half of limit bytes, cut at line boundaries, so the memory
+// used doesn't grow with the input. Binary input is refused with ErrBinaryInput.
+func ReadLimited(r goio.Reader, limit int) (PipedInput, error) {
+	buf := NewLimitedBuffer(limit)
+	chunk := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(chunk)
+		buf.Write(chunk[:n])
+		// Binary input is refused as soon as it shows, not after reading all of it
+		if buf.binary {
+			return PipedInput{}, ErrBinaryInput
+		}
+		if err == goio.EOF {
+			return buf.Input()
+		}
+		if err != nil {
+			return PipedInput{}, err
+		}
+	}
+}
+
+// LimitedBuffer keeps the head and tail of what is written to it, up to its limit. Writes never fail,
+// so it can sit next to the terminal in an io.MultiWriter.
+type LimitedBuffer struct {
+	limit        int
+	head, tail   []byte
+	dropped      int64
+	droppedLines int
+	binary       bool
+}
+
+// Returns a LimitedBuffer keeping at most limit bytes, DefaultPipeLimit when limit isn't positive
+func NewLimitedBuffer(limit int) *LimitedBuffer {
+	if limit <= 0 {
+		limit = DefaultPipeLimit
+	}
+	return &LimitedBuffer{limit: limit}
+}
+
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	headSize := b.limit / 2
+	if room := headSize - len(b.head); room > 0 {
+		take := min(room, len(p))
+		b.head = append(b.head, p[:take]...)
+		p = p[take:]
+		b.binary = IsBinary(b.head)
+	}
+	if len(p) > 0 {
+		b.tail = append(b.tail, p...)
+		// Only the last limit-headSize bytes of the tail are kept
+		if over := len(b.tail) - (b.limit - headSize); over > 0 {
+			b.dropped += int64(over)
+			b.droppedLines += bytes.Count(b.tail[:over], []byte("\n"))
+			b.tail = append(b.tail[:0], b.tail[over:]...)
+		}
+	}
+	return n, nil
+}
+
+// Input returns what was kept, with a marker where lines were left out. Binary content gives ErrBinaryInput.
+func (b *LimitedBuffer) Input() (PipedInput, error) {
+	if b.binary {
+		return PipedInput{}, ErrBinaryInput
+	}
+	head, tail := b.head, b.tail
+	if b.dropped == 0 {
+		return PipedInput{Text: normalizeNewline(string(head) + string(tail))}, nil
+	}
+
+	// Cut at line boundaries so no half lines end up next to the marker
+	dropped, droppedLines := b.dropped, b.droppedLines
+	if i := bytes.LastIndexByte(head, '\n'); i >= 0 {
+		dropped += int64(len(head) - i - 1)
+		head = head[:i+1]
+	}
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+		dropped += int64(i + 1)
+		droppedLines++
+		tail = tail[i+1:]
+	}
+	text := string(head) + fmt.Sprintf("[... %d lines truncated ...]\n", droppedLines) + string(tail)
+	return PipedInput{Text: normalizeNewline(text), Truncated: true, DroppedLines: droppedLines, DroppedBytes: dropped}, nil
+}
+
+// Piped input always ends with a newline, as the line by line reading of earlier versions left it
+func normalizeNewline(text string) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+// ParseSize parses sizes such as 512K, 2M, 1G or a plain number of bytes
+func ParseSize(size string) (int, error) {
+	s := strings.TrimSpace(strings.ToUpper(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, use e.g. 512K or 2M", size)
+	}
+	return n * multiplier, nil
+}
+
+// FormatSize formats a number of bytes like 256 KB or 1.5 MB
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return strconv.FormatFloat(float64(n)/(1024*1024), 'f', 1, 64) + " MB"
+	case n >= 1024:
+		return strconv.FormatInt(n/1024, 10) + " KB"
+	}
+	return strconv.FormatInt(n, 10) + " bytes"
+}
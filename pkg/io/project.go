@@ -0,0 +1,133 @@
+package io
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Most of a .lexido file that goes into the pre-prompt
+const MaxProjectContextSize = 16 * 1024
+
+// Where the allowed project context files are remembered, with a hash of the contents that were allowed
+const allowedContextsFile = "allowed_contexts.json"
+
+// ProjectContext is a .lexido file, or .lexido/context.md, with facts about the project it sits in
+type ProjectContext struct {
+	Path      string
+	Content   string
+	Truncated bool
+}
+
+// FindProjectContext looks for a .lexido file, or .lexido/context.md, in dir and its parents, stopping
+// after the root of the git repository or at the filesystem root. It reports false when there is none.
+func FindProjectContext(dir string) (ProjectContext, bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ProjectContext{}, false, err
+	}
+	for {
+		for _, path := range []string{filepath.Join(dir, ".lexido"), filepath.Join(dir, ".lexido", "context.md")} {
+			// ~/.lexido is the directory older versions kept their files in, only a regular file counts
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				project, err := readProjectContext(path)
+				return project, err == nil, err
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ProjectContext{}, false, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ProjectContext{}, false, nil
+		}
+		dir = parent
+	}
+}
+
+func readProjectContext(path string) (ProjectContext, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ProjectContext{}, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, MaxProjectContextSize+1)
+	n, err := file.Read(buf)
+	if err != nil && n == 0 {
+		if info, statErr := file.Stat(); statErr == nil && info.Size() == 0 {
+			return ProjectContext{Path: path}, nil
+		}
+		return ProjectContext{}, err
+	}
+	data := buf[:n]
+
+	project := ProjectContext{Path: path}
+	if len(data) > MaxProjectContextSize {
+		data = data[:MaxProjectContextSize]
+		project.Truncated = true
+	}
+	if IsBinary(data) {
+		return ProjectContext{}, fmt.Errorf("%s is not a text file", path)
+	}
+	project.Content = string(data)
+	return project, nil
+}
+
+// Hash of the path and contents of a project context, so an allowed file that changed is asked about again
+func (p ProjectContext) hash() string {
+	sum := sha256.Sum256([]byte(p.Path + "\x00" + p.Content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Reads the allowed project context files, by path
+func readAllowedContexts() (map[string]string, error) {
+	path, err := GetFilePath(Data, allowedContextsFile)
+	if err != nil {
+		return nil, err
+	}
+	allowed := map[string]string{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return allowed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &allowed); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return allowed, nil
+}
+
+// IsProjectContextAllowed reports whether the project context was allowed with these exact contents
+func IsProjectContextAllowed(project ProjectContext) bool {
+	allowed, err := readAllowedContexts()
+	return err == nil && allowed[project.Path] == project.hash()
+}
+
+// AllowProjectContext remembers that the project context may go into the pre-prompt until its contents change
+func AllowProjectContext(project ProjectContext) error {
+	allowed, err := readAllowedContexts()
+	if err != nil {
+		return err
+	}
+	allowed[project.Path] = project.hash()
+
+	path, err := GetFilePath(Data, allowedContextsFile)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(allowed, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
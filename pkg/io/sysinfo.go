@@ -0,0 +1,34 @@
+package io
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Returns the name of the current user based on their home directory
+func Username() string {
+	userpath, err := os.UserHomeDir()
+	if err != nil {
+		return "Unknown"
+	}
+	return filepath.Base(userpath)
+}
+
+// Package managers looked for on Linux and macOS, on this machine and on the host of --target
+var UnixPackageManagers = []string{
+	"apt",          // Debian, Ubuntu
+	"dnf",          // Fedora
+	"yum",          // Older Fedora, CentOS
+	"pacman",       // Arch Linux
+	"brew",         // macOS
+	"port",         // macOS (MacPorts)
+	"zypper",       // openSUSE
+	"emerge",       // Gentoo
+	"xbps-install", // Void Linux
+	"apk",          // Alpine Linux
+	"nix",          // NixOS or multi-distro Nix package manager
+	"snap",         // Snap packages (Ubuntu and others)
+	"flatpak",      // Flatpak (universal package system)
+	"yay",          // AUR helper for Arch Linux
+	"paru",         // Another AUR helper for Arch Linux
+}
@@ -0,0 +1,79 @@
+//go:build !windows
+
+package io
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/logging"
+)
+
+// Detects the operating system name (macOS with its version, or the Linux distribution)
+func OperatingSystem() string {
+	// macOS has no hostnamectl, sw_vers reports its version
+	if runtime.GOOS == "darwin" {
+		version, err := RunCmd("sw_vers", "-productVersion")
+		if err != nil || version == "" {
+			logging.Infof("sw_vers failed, reporting plain macOS: %v", err)
+			return "macOS"
+		}
+		return "macOS " + version
+	}
+
+	// Get the user's full operating system if not MacOS
+	opperatingSystem, err := ExtractHostnameCtlValue("Operating System")
+	if err != nil {
+		logging.Infof("hostnamectl failed, reporting plain Linux: %v", err)
+		return "Linux"
+	}
+	return opperatingSystem
+}
+
+// Helper function to extract value from hostnamectl output
+func ExtractHostnameCtlValue(field string) (string, error) {
+	txtcmd := fmt.Sprintf("hostnamectl | grep \"%s\"", field)
+	data, err := RunCmd("bash", "-c", txtcmd)
+	if err != nil {
+		return "", err
+	}
+	// Replace field name and remove leading and trailing white spaces
+	return strings.TrimSpace(strings.ReplaceAll(data, field+":", "")), nil
+}
+
+func packageManagers() []string {
+	packageManagers := UnixPackageManagers
+
+	// Hard coded fix for ghost apt package manager on macOS
+	if runtime.GOOS == "darwin" {
+		packageManagers = packageManagers[1:]
+	}
+
+	return packageManagers
+}
+
+// GNU tools Homebrew installs with a g prefix next to the BSD ones of macOS
+var gnuTools = []string{"gsed", "gawk", "ggrep", "gfind", "gxargs", "gstat", "gdate", "gls", "greadlink", "grealpath", "gtar", "gcp", "gmv", "gdu", "gsort", "ghead", "gtail", "gtimeout"}
+
+// DetectGNUTools returns the g-prefixed GNU tools on PATH, and the plain names of the ones that come
+// before the BSD tools through coreutils' gnubin directory. Only macOS has BSD tools to replace.
+func DetectGNUTools() []string {
+	if runtime.GOOS != "darwin" {
+		return nil
+	}
+	var found []string
+	for _, tool := range gnuTools {
+		if _, err := exec.LookPath(tool); err == nil {
+			found = append(found, tool)
+		}
+	}
+	for _, tool := range []string{"sed", "grep", "find", "stat", "date", "ls", "xargs"} {
+		if path, err := exec.LookPath(tool); err == nil && strings.Contains(filepath.ToSlash(path), "/gnubin/") {
+			found = append(found, tool+" (GNU, first on PATH)")
+		}
+	}
+	return found
+}
@@ -0,0 +1,60 @@
+//go:build windows
+
+package io
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// Detects the Windows edition and version from the registry
+func OperatingSystem() string {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, registry.QUERY_VALUE)
+	if err != nil {
+		return fallbackWindowsName()
+	}
+	defer key.Close()
+
+	productName, _, err := key.GetStringValue("ProductName")
+	if err != nil {
+		return fallbackWindowsName()
+	}
+
+	// Windows 11 still reports itself as Windows 10 in ProductName, the build number tells them apart
+	build, _, _ := key.GetStringValue("CurrentBuild")
+	if buildNumber, err := strconv.Atoi(build); err == nil && buildNumber >= 22000 && strings.HasPrefix(productName, "Windows 10") {
+		productName = "Windows 11" + strings.TrimPrefix(productName, "Windows 10")
+	}
+
+	if displayVersion, _, err := key.GetStringValue("DisplayVersion"); err == nil {
+		productName += " " + displayVersion
+	}
+	if build != "" {
+		productName += " (build " + build + ")"
+	}
+
+	return productName
+}
+
+func fallbackWindowsName() string {
+	if os.Getenv("OS") != "" {
+		return os.Getenv("OS")
+	}
+	return "Windows"
+}
+
+// Windows has no BSD tools that GNU ones replace
+func DetectGNUTools() []string {
+	return nil
+}
+
+func packageManagers() []string {
+	return []string{
+		"winget", // Windows Package Manager
+		"choco",  // Chocolatey
+		"scoop",  // Scoop
+	}
+}
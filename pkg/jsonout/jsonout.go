@@ -0,0 +1,207 @@
+package jsonout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/llms/mock"
+	"github.com/micr0-dev/lexido/pkg/llms/remote"
+	"github.com/micr0-dev/lexido/pkg/network"
+	"github.com/micr0-dev/lexido/pkg/retry"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+)
+
+// Error codes written with --json, callers branch on these so they must never change
+const (
+	CodeRateLimited = "rate_limited"
+	CodeUnavailable = "unavailable"
+	CodeAuth        = "auth"
+	CodeNetwork     = "network"
+	CodeBlocked     = "blocked"
+	CodeInvalid     = "invalid_request"
+	CodeCanceled    = "canceled"
+	CodeTimeout     = "timeout"
+	CodeNoPrompt    = "no_prompt"
+	CodeUnknown     = "error"
+)
+
+// Usage is the token count reported by the provider, or estimated from the text when it doesn't report one
+type Usage struct {
+	PromptTokens   int          `json:"prompt_tokens"`
+	ResponseTokens int          `json:"response_tokens"`
+	TotalTokens    int          `json:"total_tokens"`
+	Estimated      bool         `json:"estimated"`
+	Cost           *float64     `json:"cost"` // In dollars, null when the price of the model isn't known
+	PromptCheck    *PromptCheck `json:"prompt_check,omitempty"`
+}
+
+// PromptCheck is the size of the prompt checked against the context window before it was sent
+type PromptCheck struct {
+	Tokens        int  `json:"tokens"`
+	Estimated     bool `json:"estimated"` // Counted from the text, only Gemini counts the tokens itself
+	ContextWindow int  `json:"context_window"`
+}
+
+// Result is the document written with --json once the response is complete
+type Result struct {
+	Provider   string   `json:"provider"`
+	Model      string   `json:"model"`
+	Mode       []string `json:"mode,omitempty"` // e.g. local, continued or dry run
+	Prompt     string   `json:"prompt"`
+	Response   string   `json:"response"`
+	Commands   []string `json:"commands"`
+	Usage      *Usage   `json:"usage"`
+	Cached     bool     `json:"cached"` // Reused from the response cache, Usage is null then
+	DurationMs int64    `json:"duration_ms"`
+}
+
+// Event is one line written with --json-stream
+type Event struct {
+	Type     string   `json:"type"` // start, chunk, retry, reset, fallback or done
+	Text     string   `json:"text,omitempty"`
+	Provider string   `json:"provider,omitempty"`
+	Model    string   `json:"model,omitempty"`
+	Mode     []string `json:"mode,omitempty"`
+	Attempt  int      `json:"attempt,omitempty"`
+	WaitMs   int64    `json:"wait_ms,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+	Result   *Result  `json:"result,omitempty"`
+}
+
+type errorBody struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Writes v as a single line of JSON
+func Write(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Writes err as {"error": {"code": ..., "message": ...}}
+func WriteError(w io.Writer, code string, err error) error {
+	var body errorBody
+	body.Error.Code = code
+	body.Error.Message = err.Error()
+	return Write(w, body)
+}
+
+// Code returns the stable error code for err
+func Code(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, errs.ErrUsage):
+		return CodeInvalid
+	case errors.Is(err, errs.ErrAuth):
+		return CodeAuth
+	case errors.Is(err, errs.ErrRateLimited):
+		return CodeRateLimited
+	case errors.Is(err, errs.ErrNetwork):
+		return CodeNetwork
+	case errors.Is(err, errs.ErrBlocked):
+		return CodeBlocked
+	}
+
+	var rerr *retry.Error
+	if errors.As(err, &rerr) {
+		switch {
+		case rerr.Status == http.StatusTooManyRequests:
+			return CodeRateLimited
+		case rerr.Status >= 500:
+			return CodeUnavailable
+		default:
+			return CodeNetwork
+		}
+	}
+
+	var nerr *network.Error
+	if errors.As(err, &nerr) {
+		if nerr.Kind == network.Timeout {
+			return CodeTimeout
+		}
+		return CodeNetwork
+	}
+
+	var blocked *genai.BlockedError
+	if errors.As(err, &blocked) {
+		return CodeBlocked
+	}
+
+	var apiErr *apierror.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Reason() == "API_KEY_INVALID" {
+			return CodeAuth
+		}
+		if st := apiErr.GRPCStatus(); st != nil {
+			switch st.Code() {
+			case codes.Unauthenticated, codes.PermissionDenied:
+				return CodeAuth
+			case codes.InvalidArgument, codes.NotFound, codes.FailedPrecondition:
+				return CodeInvalid
+			}
+		}
+		if code := apiErr.HTTPCode(); code > 0 {
+			return statusCode(code, apiErr.Error())
+		}
+	}
+
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return statusCode(gerr.Code, gerr.Error())
+	}
+
+	var serr *remote.StatusError
+	if errors.As(err, &serr) {
+		if serr.Filtered {
+			return CodeBlocked
+		}
+		return statusCode(serr.Status, serr.Message)
+	}
+
+	var merr *mock.StatusError
+	if errors.As(err, &merr) {
+		return statusCode(merr.Status, "")
+	}
+
+	var kerr *remote.MissingKeyError
+	if errors.As(err, &kerr) {
+		return CodeAuth
+	}
+
+	var cerr *remote.ConfigError
+	if errors.As(err, &cerr) {
+		return CodeInvalid
+	}
+
+	return CodeUnknown
+}
+
+// Maps an HTTP status to an error code, Gemini reports invalid keys as a plain 400
+func statusCode(status int, message string) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return CodeAuth
+	case status == http.StatusBadRequest && strings.Contains(message, "API key"):
+		return CodeAuth
+	case status == http.StatusTooManyRequests:
+		return CodeRateLimited
+	case status >= 500:
+		return CodeUnavailable
+	case status >= 400:
+		return CodeInvalid
+	}
+	return CodeUnknown
+}
@@ -3,10 +3,19 @@ package gemini
 import (
 	"context"
 	"errors"
-	"strings"
+	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/google/generative-ai-go/genai"
+	"github.com/googleapis/gax-go/v2/apierror"
+	lexio "github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/network"
+	"github.com/micr0-dev/lexido/pkg/retry"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var model *genai.GenerativeModel
@@ -18,11 +27,14 @@ func IsKeyValid(apiKey string) (bool, error) {
 	}
 
 	prompt := genai.Text("Say Hello World!")
-	_, err := model.GenerateContent(ctx, prompt)
+	reqCtx, cancel := context.WithTimeout(ctx, KeyCheckTimeout)
+	defer cancel()
+	_, err := model.GenerateContent(reqCtx, prompt)
 
 	if err != nil {
-		// Check if the error contains invalid API key (Error 400)
-		if strings.Contains(err.Error(), "Error 400") {
+		// Invalid API keys are answered with a plain 400
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusBadRequest {
 			return false, nil
 		}
 		return false, errors.New("Error setting up GenAI client: " + err.Error())
@@ -31,44 +43,212 @@ func IsKeyValid(apiKey string) (bool, error) {
 	return true, nil
 }
 
+var client *genai.Client
+
+// How long validating a new API key may take
+var KeyCheckTimeout = 30 * time.Second
+var modelName string
+
+// Host of the API key endpoint, named in connection errors
+const apiHost = "generativelanguage.googleapis.com"
+
+// Returns the host:port Gemini is reached at, through Vertex AI in the given location (empty for the default) or with an API key
+func Address(useVertex bool, location string) string {
+	if !useVertex {
+		return apiHost + ":443"
+	}
+	if location == "" {
+		location = DefaultLocation
+	}
+	return vertexHost(location) + ":443"
+}
+
 func Setup(apiKey string) error {
 	ctx = context.Background()
 
 	// Set up the GenAI client
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	var err error
+	client, err = genai.NewClient(ctx, option.WithAPIKey(apiKey))
 	if err != nil {
 		return err
 	}
 
 	// Call Gemini Pro with the user's prompt
-	model = client.GenerativeModel("gemini-pro")
+	SetModel("gemini-pro")
+
+	return nil
+}
+
+// Switches to another Gemini model, keeping the generation and safety settings
+func SetModel(name string) {
+	modelName = name
+	if vertex != nil {
+		return
+	}
+	model = client.GenerativeModel(name)
 
-	model.SetTemperature(0.7)
+	model.SetTemperature(temperature)
 	model.SetTopK(1)
+	if maxOutputTokens > 0 {
+		model.SetMaxOutputTokens(maxOutputTokens)
+	}
+	if candidateCount > 1 {
+		model.SetCandidateCount(candidateCount)
+	}
+
+	model.SafetySettings = safetySettings()
+}
 
-	model.SafetySettings = []*genai.SafetySetting{
-		{
-			Category:  genai.HarmCategoryHarassment,
-			Threshold: genai.HarmBlockNone,
-		},
-		{
-			Category:  genai.HarmCategoryHateSpeech,
-			Threshold: genai.HarmBlockNone,
-		},
-		{
-			Category:  genai.HarmCategorySexuallyExplicit,
-			Threshold: genai.HarmBlockNone,
-		},
-		{
-			Category:  genai.HarmCategoryDangerousContent,
-			Threshold: genai.HarmBlockNone,
-		},
+// Sampling of every request, --temperature and --max-tokens change it. No limit on the output is the model's own.
+var (
+	temperature     float32 = 0.7
+	maxOutputTokens int32
+)
+
+// Sets the temperature and the longest response in tokens, nil keeps the default
+func SetSampling(t *float64, maxTokens *int) {
+	if t != nil {
+		temperature = float32(*t)
+	}
+	if maxTokens != nil {
+		maxOutputTokens = int32(*maxTokens)
+	}
+	if model != nil && vertex == nil {
+		model.SetTemperature(temperature)
+		if maxOutputTokens > 0 {
+			model.SetMaxOutputTokens(maxOutputTokens)
+		}
 	}
+}
 
-	return nil
+// Settings describes what besides the prompt and the model shapes a response: the sampling
+func Settings() string {
+	return fmt.Sprintf("temperature=%g max_tokens=%d", temperature, maxOutputTokens)
+}
+
+// Returns the name of the model in use
+func ModelName() string {
+	return modelName
+}
+
+// Most candidates Gemini returns for one request
+const MaxCandidates = 8
+
+// Candidates asked for per request, kept when the model changes
+var candidateCount int32 = 1
+
+// Asks Gemini for several candidates per request, used for --alternatives
+func SetCandidateCount(n int) {
+	candidateCount = int32(n)
+	if vertex != nil {
+		vertex.candidateCount = int32(n)
+		return
+	}
+	model.SetCandidateCount(int32(n))
+}
+
+// Reset forgets the client, the model and the settings, the next Setup or SetupVertex starts from the defaults
+func Reset() {
+	if client != nil {
+		client.Close()
+	}
+	client, model, vertex, modelName = nil, nil, nil, ""
+	temperature, maxOutputTokens, candidateCount = 0.7, 0, 1
+	safety = relaxedSafety()
+}
+
+// Streams the response to the prompt, the images are sent along as inline data
+func Generate(reqCtx context.Context, str_prompt string, images []lexio.Image) Stream {
+	if vertex != nil {
+		return vertex.generate(reqCtx, str_prompt, images)
+	}
+	return model.GenerateContentStream(reqCtx, promptParts(str_prompt, images)...)
+}
+
+// CountTokens returns the tokens of the prompt and its images as the model counts them
+func CountTokens(reqCtx context.Context, str_prompt string, images []lexio.Image) (int, error) {
+	if vertex != nil {
+		return vertex.countTokens(reqCtx, str_prompt, images)
+	}
+	if model == nil {
+		return 0, errors.New("gemini isn't set up")
+	}
+	resp, err := model.CountTokens(reqCtx, promptParts(str_prompt, images)...)
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.TotalTokens), nil
+}
+
+// Returns the prompt followed by its images as inline data
+func promptParts(str_prompt string, images []lexio.Image) []genai.Part {
+	parts := []genai.Part{genai.Text(str_prompt)}
+	for _, img := range images {
+		parts = append(parts, genai.Blob{MIMEType: img.MIME, Data: img.Data})
+	}
+	return parts
+}
+
+// Model images are sent to when the API key client still uses gemini-pro, which only reads text
+const VisionModel = "gemini-1.5-flash"
+
+// Switches from a model that can't read images to VisionModel, returning whether it did
+func UseVision() bool {
+	if vertex != nil || modelName != "gemini-pro" {
+		return false
+	}
+	SetModel(VisionModel)
+	return true
+}
+
+// Marks rate limits and server errors from Gemini as retryable and classifies connection errors,
+// other errors are returned unchanged
+func ClassifyError(err error) error {
+	var apiErr *apierror.APIError
+	if errors.As(err, &apiErr) {
+		var after time.Duration
+		if info := apiErr.Details().RetryInfo; info != nil {
+			after = info.GetRetryDelay().AsDuration()
+		}
+		if code := apiErr.HTTPCode(); code > 0 {
+			if retry.RetryableStatus(code) {
+				return retry.Retryable(err, code, after)
+			}
+			return err
+		}
+		if st := apiErr.GRPCStatus(); st != nil {
+			if code := grpcToHTTP(st.Code()); code > 0 {
+				return retry.Retryable(err, code, after)
+			}
+		}
+		return err
+	}
+
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		if retry.RetryableStatus(gerr.Code) {
+			return retry.Retryable(err, gerr.Code, retry.ParseRetryAfter(gerr.Header.Get("Retry-After")))
+		}
+		return err
+	}
+
+	if st, ok := status.FromError(err); ok {
+		if code := grpcToHTTP(st.Code()); code > 0 {
+			return retry.Retryable(err, code, 0)
+		}
+	}
+	return network.Wrap(apiHost, err)
 }
 
-func Generate(str_prompt string) *genai.GenerateContentResponseIterator {
-	prompt := genai.Text(str_prompt)
-	return model.GenerateContentStream(ctx, prompt)
+// Maps the gRPC codes worth retrying to their HTTP equivalents
+func grpcToHTTP(code codes.Code) int {
+	switch code {
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Internal:
+		return http.StatusInternalServerError
+	}
+	return 0
 }
@@ -0,0 +1,189 @@
+package gemini
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/micr0-dev/lexido/pkg/config"
+)
+
+func init() {
+	config.Register("gemini_safety", "", func(val string) error {
+		_, err := ParseSafety(val)
+		return err
+	})
+}
+
+// Names of the harm categories as written in the gemini_safety setting
+var categoryNames = map[string]genai.HarmCategory{
+	"harassment":        genai.HarmCategoryHarassment,
+	"hate_speech":       genai.HarmCategoryHateSpeech,
+	"sexually_explicit": genai.HarmCategorySexuallyExplicit,
+	"dangerous_content": genai.HarmCategoryDangerousContent,
+}
+
+// Names of the thresholds as written in the gemini_safety setting
+var thresholdNames = map[string]genai.HarmBlockThreshold{
+	"block_low_and_above":    genai.HarmBlockLowAndAbove,
+	"block_medium_and_above": genai.HarmBlockMediumAndAbove,
+	"block_only_high":        genai.HarmBlockOnlyHigh,
+	"block_none":             genai.HarmBlockNone,
+}
+
+// Thresholds used by SetModel. Sysadmin prompts about killing and removing things trip the filters easily,
+// so nothing is blocked unless the user asks for stricter settings.
+var safety = relaxedSafety()
+
+func relaxedSafety() map[genai.HarmCategory]genai.HarmBlockThreshold {
+	thresholds := map[genai.HarmCategory]genai.HarmBlockThreshold{}
+	for _, category := range categoryNames {
+		thresholds[category] = genai.HarmBlockNone
+	}
+	return thresholds
+}
+
+// Parses settings like "harassment=block_none,dangerous_content=block_only_high"
+func ParseSafety(spec string) (map[genai.HarmCategory]genai.HarmBlockThreshold, error) {
+	thresholds := map[genai.HarmCategory]genai.HarmBlockThreshold{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected category=threshold, got %q", part)
+		}
+		category, ok := categoryNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown safety category %q, use one of %s", name, strings.Join(sortedKeys(categoryNames), ", "))
+		}
+		threshold, ok := thresholdNames[strings.ToLower(strings.TrimSpace(value))]
+		if !ok {
+			return nil, fmt.Errorf("unknown safety threshold %q, use one of %s", value, strings.Join(sortedKeys(thresholdNames), ", "))
+		}
+		thresholds[category] = threshold
+	}
+	return thresholds, nil
+}
+
+// Applies the thresholds of a gemini_safety setting, categories it doesn't name keep theirs.
+// It takes effect with the next Setup or SetModel.
+func SetSafety(spec string) error {
+	thresholds, err := ParseSafety(spec)
+	if err != nil {
+		return err
+	}
+	for category, threshold := range thresholds {
+		safety[category] = threshold
+	}
+	return nil
+}
+
+// Turns every filter off, for --relax-safety
+func RelaxSafety() {
+	safety = relaxedSafety()
+}
+
+// Formats thresholds the way ParseSafety reads them, in a stable order
+func FormatSafety(thresholds map[genai.HarmCategory]genai.HarmBlockThreshold) string {
+	var parts []string
+	for _, name := range sortedKeys(categoryNames) {
+		if threshold, ok := thresholds[categoryNames[name]]; ok {
+			parts = append(parts, name+"="+thresholdName(threshold))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func safetySettings() []*genai.SafetySetting {
+	var settings []*genai.SafetySetting
+	for _, name := range sortedKeys(categoryNames) {
+		category := categoryNames[name]
+		settings = append(settings, &genai.SafetySetting{Category: category, Threshold: safety[category]})
+	}
+	return settings
+}
+
+// SafetyError is returned when Gemini blocks a prompt or response, with the categories that triggered it
+type SafetyError struct {
+	Blocked *genai.BlockedError
+}
+
+func (e *SafetyError) Error() string {
+	return "the content generation was blocked for safety reasons, " + DescribeBlock(e.Blocked)
+}
+
+func (e *SafetyError) Unwrap() error {
+	return e.Blocked
+}
+
+// Explains a block with the categories that triggered it and the thresholds they were held to
+func DescribeBlock(blocked *genai.BlockedError) string {
+	var ratings []*genai.SafetyRating
+	reason := ""
+	if blocked.PromptFeedback != nil {
+		reason = "the prompt was blocked (" + blocked.PromptFeedback.BlockReason.String() + ")"
+		ratings = append(ratings, blocked.PromptFeedback.SafetyRatings...)
+	}
+	if blocked.Candidate != nil {
+		if reason == "" {
+			reason = "the response was stopped (" + blocked.Candidate.FinishReason.String() + ")"
+		}
+		ratings = append(ratings, blocked.Candidate.SafetyRatings...)
+	}
+
+	var triggered []string
+	for _, rating := range ratings {
+		if rating == nil || !rating.Blocked {
+			continue
+		}
+		triggered = append(triggered, describeRating(rating))
+	}
+	if len(triggered) == 0 {
+		// Not every block marks the rating responsible, the likely ones are named instead
+		for _, rating := range ratings {
+			if rating != nil && rating.Probability >= genai.HarmProbabilityMedium {
+				triggered = append(triggered, describeRating(rating))
+			}
+		}
+	}
+	if len(triggered) == 0 {
+		return reason
+	}
+	return reason + ": " + strings.Join(triggered, "; ")
+}
+
+func describeRating(rating *genai.SafetyRating) string {
+	probability := strings.ToLower(strings.TrimPrefix(rating.Probability.String(), "HarmProbability"))
+	return fmt.Sprintf("%s rated %s, the threshold is %s", categoryName(rating.Category), probability, thresholdName(safety[rating.Category]))
+}
+
+func categoryName(category genai.HarmCategory) string {
+	for name, c := range categoryNames {
+		if c == category {
+			return name
+		}
+	}
+	return category.String()
+}
+
+func thresholdName(threshold genai.HarmBlockThreshold) string {
+	for name, t := range thresholdNames {
+		if t == threshold {
+			return name
+		}
+	}
+	return "the default"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
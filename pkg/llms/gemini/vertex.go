@@ -0,0 +1,347 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"cloud.google.com/go/ai/generativelanguage/apiv1beta/generativelanguagepb"
+	"github.com/google/generative-ai-go/genai"
+	lexio "github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/network"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// DefaultLocation is the Vertex AI region used when none is configured
+const DefaultLocation = "us-central1"
+
+// Model used through Vertex AI, which doesn't serve gemini-pro anymore
+const vertexModel = "gemini-1.5-flash"
+
+// Set by SetupVertex, Gemini is then reached through Vertex AI with Application Default Credentials instead of an API key
+var vertex *vertexClient
+
+type vertexClient struct {
+	project        string
+	location       string
+	tokens         oauth2.TokenSource
+	candidateCount int32
+}
+
+// Stream is a streamed Gemini response, from the API key or the Vertex AI endpoint
+type Stream interface {
+	Next() (*genai.GenerateContentResponse, error)
+}
+
+// Reports whether Gemini is used through Vertex AI
+func UsingVertex() bool {
+	return vertex != nil
+}
+
+// Reports whether Application Default Credentials are set up, by GOOGLE_APPLICATION_CREDENTIALS
+// or gcloud auth application-default login
+func ADCAvailable() bool {
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	_, err := os.Stat(adcFile())
+	return err == nil
+}
+
+// Returns the project of the Application Default Credentials, empty when they don't name one
+func ADCProject() string {
+	creds, err := google.FindDefaultCredentials(context.Background(), vertexScope)
+	if err != nil {
+		return ""
+	}
+	if creds.ProjectID != "" {
+		return creds.ProjectID
+	}
+	var file struct {
+		QuotaProject string `json:"quota_project_id"`
+	}
+	json.Unmarshal(creds.JSON, &file)
+	return file.QuotaProject
+}
+
+// Where gcloud keeps the Application Default Credentials
+func adcFile() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("APPDATA"), "gcloud", "application_default_credentials.json")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+}
+
+const vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Sets Gemini up to go through Vertex AI in the project and location, authenticated with Application Default Credentials
+func SetupVertex(project string, location string) error {
+	ctx = context.Background()
+	if location == "" {
+		location = DefaultLocation
+	}
+	creds, err := google.FindDefaultCredentials(ctx, vertexScope)
+	if err != nil {
+		return fmt.Errorf("no Application Default Credentials found, run gcloud auth application-default login: %w", err)
+	}
+	if project == "" {
+		project = creds.ProjectID
+	}
+	if project == "" {
+		return errors.New("no GCP project configured, set one with --setGcpProject")
+	}
+
+	vertex = &vertexClient{project: project, location: location, tokens: creds.TokenSource, candidateCount: 1}
+	SetModel(vertexModel)
+	logging.Infof("Gemini through Vertex AI in project %s, location %s", project, location)
+	return nil
+}
+
+// Returns the URL of a method of the model, such as streamGenerateContent?alt=sse
+func (v *vertexClient) endpoint(method string) string {
+	return fmt.Sprintf("https://%s/v1/projects/%s/locations/%s/publishers/google/models/%s:%s", vertexHost(v.location), v.project, v.location, modelName, method)
+}
+
+// Returns the host of Vertex AI in a location
+func vertexHost(location string) string {
+	if location == "global" {
+		return "aiplatform.googleapis.com"
+	}
+	return location + "-aiplatform.googleapis.com"
+}
+
+// Returns the contents of a request with the prompt and its images
+func vertexContents(prompt string, images []lexio.Image) []interface{} {
+	parts := []interface{}{map[string]string{"text": prompt}}
+	for _, img := range images {
+		parts = append(parts, map[string]interface{}{"inlineData": map[string]string{"mimeType": img.MIME, "data": base64.StdEncoding.EncodeToString(img.Data)}})
+	}
+	return []interface{}{map[string]interface{}{"role": "user", "parts": parts}}
+}
+
+// Posts the body to a method of the model with a token of the Application Default Credentials
+func (v *vertexClient) post(reqCtx context.Context, method string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := v.tokens.Token()
+	if err != nil {
+		return nil, fmt.Errorf("getting an access token from the Application Default Credentials: %w", err)
+	}
+	req, err := http.NewRequestWithContext(reqCtx, "POST", v.endpoint(method), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token.SetAuthHeader(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, network.Wrap(req.URL.Host, err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		gerr := &googleapi.Error{Code: resp.StatusCode, Header: resp.Header, Body: string(errBody)}
+		var parsed struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(errBody, &parsed) == nil {
+			gerr.Message = parsed.Error.Message
+		}
+		return nil, gerr
+	}
+	return resp, nil
+}
+
+// Counts the tokens of the prompt with countTokens
+func (v *vertexClient) countTokens(reqCtx context.Context, prompt string, images []lexio.Image) (int, error) {
+	resp, err := v.post(reqCtx, "countTokens", map[string]interface{}{"contents": vertexContents(prompt, images)})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var counted struct {
+		TotalTokens int `json:"totalTokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&counted); err != nil {
+		return 0, fmt.Errorf("reading the token count: %w", err)
+	}
+	return counted.TotalTokens, nil
+}
+
+// Starts a streamed request with the same generation and safety settings the API key client uses
+func (v *vertexClient) generate(reqCtx context.Context, prompt string, images []lexio.Image) Stream {
+	type setting struct {
+		Category  string `json:"category"`
+		Threshold string `json:"threshold"`
+	}
+	var settings []setting
+	for _, s := range safetySettings() {
+		settings = append(settings, setting{
+			Category:  generativelanguagepb.HarmCategory_name[int32(s.Category)],
+			Threshold: generativelanguagepb.SafetySetting_HarmBlockThreshold_name[int32(s.Threshold)],
+		})
+	}
+	generationConfig := map[string]interface{}{"temperature": temperature, "topK": 1, "candidateCount": v.candidateCount}
+	if maxOutputTokens > 0 {
+		generationConfig["maxOutputTokens"] = maxOutputTokens
+	}
+	body := map[string]interface{}{
+		"contents":         vertexContents(prompt, images),
+		"generationConfig": generationConfig,
+		"safetySettings":   settings,
+	}
+	resp, err := v.post(reqCtx, "streamGenerateContent?alt=sse", body)
+	if err != nil {
+		return &vertexStream{err: err}
+	}
+	return &vertexStream{body: resp.Body, reader: bufio.NewReader(resp.Body)}
+}
+
+// vertexStream reads the server-sent events of streamGenerateContent
+type vertexStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	err    error
+}
+
+func (s *vertexStream) Next() (*genai.GenerateContentResponse, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	for {
+		line, err := s.reader.ReadString('\n')
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:"); ok {
+			resp, parseErr := parseVertexResponse([]byte(data))
+			if parseErr != nil {
+				s.fail(parseErr)
+				return nil, parseErr
+			}
+			return resp, nil
+		}
+		if err == io.EOF {
+			s.fail(iterator.Done)
+			return nil, iterator.Done
+		}
+		if err != nil {
+			s.fail(err)
+			return nil, err
+		}
+	}
+}
+
+func (s *vertexStream) fail(err error) {
+	s.err = err
+	s.body.Close()
+}
+
+// The parts of a Vertex AI response lexido uses, in its JSON form
+type vertexResponse struct {
+	Candidates []struct {
+		Index   int32 `json:"index"`
+		Content *struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason  string         `json:"finishReason"`
+		SafetyRatings []vertexRating `json:"safetyRatings"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason   string         `json:"blockReason"`
+		SafetyRatings []vertexRating `json:"safetyRatings"`
+	} `json:"promptFeedback"`
+	UsageMetadata *struct {
+		PromptTokenCount     int32 `json:"promptTokenCount"`
+		CandidatesTokenCount int32 `json:"candidatesTokenCount"`
+		TotalTokenCount      int32 `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+type vertexRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked"`
+}
+
+func (r vertexRating) rating() *genai.SafetyRating {
+	return &genai.SafetyRating{
+		Category:    genai.HarmCategory(generativelanguagepb.HarmCategory_value[r.Category]),
+		Probability: genai.HarmProbability(generativelanguagepb.SafetyRating_HarmProbability_value[r.Probability]),
+		Blocked:     r.Blocked,
+	}
+}
+
+func ratings(in []vertexRating) []*genai.SafetyRating {
+	out := make([]*genai.SafetyRating, len(in))
+	for i, r := range in {
+		out[i] = r.rating()
+	}
+	return out
+}
+
+// Turns a Vertex AI response into the response the API key client returns, blocked prompts and candidates
+// become a *genai.BlockedError as they do there
+func parseVertexResponse(data []byte) (*genai.GenerateContentResponse, error) {
+	var in vertexResponse
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("reading the Vertex AI response: %w", err)
+	}
+
+	resp := &genai.GenerateContentResponse{}
+	if in.PromptFeedback != nil {
+		resp.PromptFeedback = &genai.PromptFeedback{
+			BlockReason:   genai.BlockReason(generativelanguagepb.GenerateContentResponse_PromptFeedback_BlockReason_value[in.PromptFeedback.BlockReason]),
+			SafetyRatings: ratings(in.PromptFeedback.SafetyRatings),
+		}
+		if resp.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
+			return nil, &genai.BlockedError{PromptFeedback: resp.PromptFeedback}
+		}
+	}
+	if in.UsageMetadata != nil {
+		resp.UsageMetadata = &genai.UsageMetadata{
+			PromptTokenCount:     in.UsageMetadata.PromptTokenCount,
+			CandidatesTokenCount: in.UsageMetadata.CandidatesTokenCount,
+			TotalTokenCount:      in.UsageMetadata.TotalTokenCount,
+		}
+	}
+	for _, c := range in.Candidates {
+		candidate := &genai.Candidate{
+			Index:         c.Index,
+			FinishReason:  genai.FinishReason(generativelanguagepb.Candidate_FinishReason_value[c.FinishReason]),
+			SafetyRatings: ratings(c.SafetyRatings),
+		}
+		if c.Content != nil {
+			candidate.Content = &genai.Content{Role: "model"}
+			for _, part := range c.Content.Parts {
+				candidate.Content.Parts = append(candidate.Content.Parts, genai.Text(part.Text))
+			}
+		}
+		if candidate.FinishReason == genai.FinishReasonSafety || candidate.FinishReason == genai.FinishReasonRecitation {
+			return nil, &genai.BlockedError{Candidate: candidate}
+		}
+		resp.Candidates = append(resp.Candidates, candidate)
+	}
+	return resp, nil
+}
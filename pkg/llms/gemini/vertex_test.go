@@ -0,0 +1,103 @@
+package gemini
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+)
+
+// Reads a recorded streamGenerateContent response like the stream of a request
+func recordedStream(t *testing.T, name string) Stream {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return &vertexStream{body: f, reader: bufio.NewReader(f)}
+}
+
+func TestStreamMultipleCandidates(t *testing.T) {
+	stream := recordedStream(t, "two-candidates.sse")
+
+	// The chunks of both candidates arrive interleaved, each goes into the buffer of its index
+	var buffers [2]strings.Builder
+	var usage *genai.UsageMetadata
+	responses := 0
+	for {
+		resp, err := stream.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		responses++
+		if resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata
+		}
+		for _, candidate := range resp.Candidates {
+			if candidate.Index < 0 || int(candidate.Index) >= len(buffers) {
+				t.Fatalf("candidate index %d out of range", candidate.Index)
+			}
+			for _, part := range candidate.Content.Parts {
+				buffers[candidate.Index].WriteString(string(part.(genai.Text)))
+			}
+		}
+	}
+
+	if responses != 6 {
+		t.Errorf("read %d responses, want 6", responses)
+	}
+	want := []string{
+		"Check the disk usage per directory: @run[du -sh * | sort -h] and the free space: @run[df -h]",
+		"ncdu shows the biggest directories interactively: @run[sudo apt install ncdu] then @run[ncdu /]",
+	}
+	for i := range buffers {
+		if got := buffers[i].String(); got != want[i] {
+			t.Errorf("candidate %d = %q, want %q", i, got, want[i])
+		}
+	}
+	if usage == nil || usage.CandidatesTokenCount != 61 || usage.TotalTokenCount != 473 {
+		t.Errorf("usage = %+v, want the counts of the last response", usage)
+	}
+
+	// The stream stays done
+	if _, err := stream.Next(); err != iterator.Done {
+		t.Errorf("Next() after the end = %v, want iterator.Done", err)
+	}
+}
+
+func TestParseVertexResponseBlocked(t *testing.T) {
+	// One blocked candidate blocks the response, like the API key client does
+	_, err := parseVertexResponse([]byte(`{"candidates": [
+		{"content": {"parts": [{"text": "fine"}]}, "index": 0},
+		{"index": 1, "finishReason": "SAFETY", "safetyRatings": [{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "probability": "HIGH", "blocked": true}]}
+	]}`))
+	var blocked *genai.BlockedError
+	if !errors.As(err, &blocked) || blocked.Candidate == nil || blocked.Candidate.Index != 1 {
+		t.Fatalf("parseVertexResponse() = %v, want the second candidate blocked", err)
+	}
+	if len(blocked.Candidate.SafetyRatings) != 1 || !blocked.Candidate.SafetyRatings[0].Blocked {
+		t.Errorf("blocked candidate ratings = %v, want the blocking rating", blocked.Candidate.SafetyRatings)
+	}
+
+	_, err = parseVertexResponse([]byte(`{"promptFeedback": {"blockReason": "SAFETY"}}`))
+	if !errors.As(err, &blocked) || blocked.PromptFeedback == nil {
+		t.Errorf("parseVertexResponse() = %v, want the prompt blocked", err)
+	}
+}
+
+func TestStreamBrokenEvent(t *testing.T) {
+	body := io.NopCloser(strings.NewReader("data: {\"candidates\": [\n\n"))
+	stream := &vertexStream{body: body, reader: bufio.NewReader(body)}
+	if _, err := stream.Next(); err == nil || err == iterator.Done {
+		t.Errorf("Next() = %v, want the broken event reported", err)
+	}
+}
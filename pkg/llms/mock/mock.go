@@ -0,0 +1,180 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/network"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/retry"
+)
+
+// Environment variable selecting this provider when set to mock, it stands in for the real ones in development
+const ProviderEnv = "LEXIDO_PROVIDER"
+
+// Environment variable naming the script of responses to replay
+const ScriptEnv = "LEXIDO_MOCK_SCRIPT"
+
+// Response is one canned response. Chunks are streamed Delay apart, after FailAfter chunks Error is returned
+// instead of the rest: network, reset, rate_limit, unavailable, auth, or any other text for a plain error.
+type Response struct {
+	Chunks     []string `json:"chunks"`
+	Delay      Duration `json:"delay"`
+	Error      string   `json:"error"`
+	FailAfter  int      `json:"fail_after"`
+	RetryAfter Duration `json:"retry_after"` // Sent with rate_limit
+}
+
+// Script is the responses replayed in order, one per request. The last one is repeated once they run out,
+// so a rate_limit response followed by a normal one is rate limited once and then answers.
+type Script struct {
+	Responses []Response `json:"responses"`
+}
+
+// Duration reads "50ms" style durations from the script
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations are strings such as \"50ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// StatusError is a failed response with the status a real provider would answer with
+type StatusError struct {
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("mock responded %d %s", e.Status, http.StatusText(e.Status))
+}
+
+// Replayed when no script is given, a short answer with one command
+var DefaultScript = Script{Responses: []Response{{
+	Chunks: []string{"To list the files ", "with their sizes, run ", "@run[ls -la]", " in the directory."},
+	Delay:  Duration(20 * time.Millisecond),
+}}}
+
+var (
+	mu       sync.Mutex
+	script   = DefaultScript
+	requests int
+	prompts  []prompt.Parts
+)
+
+// Enabled reports whether the mock provider was selected through LEXIDO_PROVIDER
+func Enabled() bool {
+	return os.Getenv(ProviderEnv) == "mock"
+}
+
+// Loads the script named by LEXIDO_MOCK_SCRIPT, the default script is used without one
+func Load() error {
+	path := os.Getenv(ScriptEnv)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading the mock script: %w", err)
+	}
+	var loaded Script
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("parsing the mock script %s: %w", path, err)
+	}
+	if len(loaded.Responses) == 0 {
+		return fmt.Errorf("the mock script %s has no responses", path)
+	}
+	SetScript(loaded)
+	return nil
+}
+
+// Replaces the script and starts it over
+func SetScript(s Script) {
+	mu.Lock()
+	defer mu.Unlock()
+	script = s
+	requests = 0
+	prompts = nil
+}
+
+// Returns the prompts sent so far, in order
+func Prompts() []prompt.Parts {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]prompt.Parts(nil), prompts...)
+}
+
+// Name reported as the model
+func ModelName() string {
+	return "mock"
+}
+
+// Streams the next response of the script. The error channel receives a single value once the output channel is closed.
+func GenerateContentStream(ctx context.Context, parts prompt.Parts) (<-chan string, <-chan error, error) {
+	mu.Lock()
+	resp := script.Responses[min(requests, len(script.Responses)-1)]
+	requests++
+	prompts = append(prompts, parts)
+	mu.Unlock()
+
+	outputChan := make(chan string)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(outputChan)
+		for i, chunk := range resp.Chunks {
+			if resp.Error != "" && i == resp.FailAfter {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			case <-time.After(time.Duration(resp.Delay)):
+			}
+			select {
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			case outputChan <- chunk:
+			}
+		}
+		errChan <- injected(resp)
+	}()
+
+	return outputChan, errChan, nil
+}
+
+// The error a response is scripted to fail with, classified as the real providers' are
+func injected(resp Response) error {
+	switch strings.TrimSpace(resp.Error) {
+	case "":
+		return nil
+	case "network":
+		return &network.Error{Kind: network.Refused, Host: "mock", Err: syscall.ECONNREFUSED}
+	case "reset":
+		return retry.Retryable(fmt.Errorf("mock stream cut off: %w", syscall.ECONNRESET), 0, 0)
+	case "rate_limit":
+		return retry.Retryable(&StatusError{Status: http.StatusTooManyRequests}, http.StatusTooManyRequests, time.Duration(resp.RetryAfter))
+	case "unavailable":
+		return retry.Retryable(&StatusError{Status: http.StatusServiceUnavailable}, http.StatusServiceUnavailable, 0)
+	case "auth":
+		return &StatusError{Status: http.StatusUnauthorized}
+	}
+	return errors.New(resp.Error)
+}
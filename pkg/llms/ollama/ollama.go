@@ -2,22 +2,103 @@ package ollama
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/network"
+	"github.com/micr0-dev/lexido/pkg/retry"
 )
 
 var llmModel string
 
 var EOFThreshold = 50
 
+// Address ollama listens on when OLLAMA_HOST isn't set
+const localAddress = "127.0.0.1:11434"
+
+// How long to wait for a remote ollama host before reporting it unreachable
+var ProbeTimeout = 3 * time.Second
+
+// Points the ollama client at another host, "local" switches back to this machine
+func SetHost(host string) {
+	if host == "local" {
+		os.Unsetenv("OLLAMA_HOST")
+		return
+	}
+	os.Setenv("OLLAMA_HOST", host)
+}
+
+// Returns the host:port of the ollama server in use, following the ollama CLI's OLLAMA_HOST rules
+func HostAddress() string {
+	host := strings.TrimSpace(os.Getenv("OLLAMA_HOST"))
+	if host == "" {
+		return localAddress
+	}
+
+	port := "11434"
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err == nil {
+			if u.Scheme == "https" {
+				port = "443"
+			} else if u.Scheme == "http" {
+				port = "80"
+			}
+			host = u.Host
+		}
+	}
+
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		return net.JoinHostPort(h, p)
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Checks whether ollama is configured to talk to this machine
+func IsLocalHost() bool {
+	h, _, err := net.SplitHostPort(HostAddress())
+	if err != nil {
+		return true
+	}
+	if h == "localhost" || h == "" {
+		return true
+	}
+	ip := net.ParseIP(h)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// Reports whether an ollama daemon is installed and answering on this machine
+func LocalAvailable() bool {
+	if _, err := exec.LookPath("ollama"); err != nil {
+		return false
+	}
+	return network.Probe(localAddress, 500*time.Millisecond) == nil
+}
+
 func Init(model string) error {
+	// Fail fast with a classified error instead of waiting on the full TCP timeout of an unreachable host
+	if !IsLocalHost() {
+		if err := network.Probe(HostAddress(), ProbeTimeout); err != nil {
+			return err
+		}
+	}
+
 	llmList, err := io.RunCmd("ollama", "list")
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, exec.ErrNotFound) {
 			return errors.New("ollama not installed on system, please install it first using the guide on https://github.com/micr0-dev/lexido?tab=readme-ov-file#running-locally")
 		}
 		return err
@@ -29,27 +110,87 @@ func Init(model string) error {
 	}
 
 	llmModel = model
+	logging.Infof("ollama at %s with model %s", HostAddress(), model)
 
 	return nil
 }
 
-func GenerateContentStream(str_prompt string) (<-chan string, error) {
-	// Create a command. Replace "ollama", "run", llmModel with your actual command and arguments.
-	cmd := exec.Command("ollama", "run", llmModel, "\""+str_prompt+"\"")
+// Lists the models installed on the ollama host through its /api/tags endpoint
+func ListModels(ctx context.Context) ([]string, error) {
+	return listModels(ctx, apiURL("/api/tags"), HostAddress())
+}
+
+// Lists the models of the ollama on this machine, whichever host is configured
+func LocalModels(ctx context.Context) ([]string, error) {
+	return listModels(ctx, "http://"+localAddress+"/api/tags", localAddress)
+}
+
+func listModels(ctx context.Context, endpoint string, address string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, network.Wrap(address, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama responded %s", resp.Status)
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(tags.Models))
+	for i, m := range tags.Models {
+		names[i] = m.Name
+	}
+	return names, nil
+}
+
+// Returns the model set up by Init
+func Model() string {
+	return llmModel
+}
+
+// Messages the ollama CLI prints when the connection to its server drops, restarting the run may succeed
+var transientMessages = []string{"connection reset", "broken pipe", "unexpected EOF", "connection refused", "503", "502", "429"}
+
+// Streams the output of ollama run, or of the HTTP API once options are set or there are images, which a vision
+// model such as llava reads. The error channel receives a single value once the output channel is closed.
+func GenerateContentStream(ctx context.Context, str_prompt string, images []io.Image) (<-chan string, <-chan error, error) {
+	if len(options) > 0 || len(sampling) > 0 || len(images) > 0 {
+		return generateAPI(ctx, str_prompt, images)
+	}
+
+	// Create a command, it is killed when the context is cancelled
+	cmd := exec.CommandContext(ctx, "ollama", "run", llmModel, "\""+str_prompt+"\"")
+
+	// Keep stderr to tell dropped connections apart from other failures
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
 
 	// Get the command's standard output pipe.
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+		return nil, nil, fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
 	// Start the command.
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start command: %w", err)
+		return nil, nil, fmt.Errorf("failed to start command: %w", err)
 	}
 
 	// Create a channel to send the output.
 	outputChan := make(chan string)
+	errChan := make(chan error, 1)
 
 	// Go routine to read command's standard output.
 	go func() {
@@ -74,11 +215,37 @@ func GenerateContentStream(str_prompt string) (<-chan string, error) {
 			outputChan <- line
 		}
 
-		// Wait for the command to finish.
-		if err := cmd.Wait(); err != nil {
-			fmt.Printf("command finished with error: %v\n", err)
+		// Wait for the command to finish, a killed command is expected after cancellation
+		err := cmd.Wait()
+		switch {
+		case ctx.Err() != nil:
+			errChan <- ctx.Err()
+		case err != nil:
+			errChan <- classifyRunError(err, stderr.String())
+		default:
+			errChan <- nil
 		}
 	}()
 
-	return outputChan, nil
+	return outputChan, errChan, nil
+}
+
+// Turns a failed ollama run into an error, marking dropped connections and overloaded servers as retryable
+func classifyRunError(err error, stderr string) error {
+	msg := strings.TrimSpace(stderr)
+	if msg == "" {
+		msg = err.Error()
+	}
+	runErr := fmt.Errorf("ollama run failed: %s", msg)
+
+	for _, transient := range transientMessages {
+		if strings.Contains(msg, transient) {
+			status := 0
+			if code, convErr := strconv.Atoi(transient); convErr == nil {
+				status = code
+			}
+			return retry.Retryable(runErr, status, 0)
+		}
+	}
+	return runErr
 }
@@ -0,0 +1,80 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/network"
+)
+
+func TestHostAddress(t *testing.T) {
+	for host, want := range map[string]string{
+		"":                       "127.0.0.1:11434",
+		"desktop.lan":            "desktop.lan:11434",
+		"desktop.lan:8080":       "desktop.lan:8080",
+		"http://desktop.lan":     "desktop.lan:80",
+		"https://ollama.example": "ollama.example:443",
+		"http://10.0.0.5:11434/": "10.0.0.5:11434",
+	} {
+		t.Setenv("OLLAMA_HOST", host)
+		if got := HostAddress(); got != want {
+			t.Errorf("HostAddress() with OLLAMA_HOST=%q = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestIsLocalHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"":                  true,
+		"localhost:11434":   true,
+		"127.0.0.1":         true,
+		"0.0.0.0":           true,
+		"[::1]:11434":       true,
+		"desktop.lan":       false,
+		"192.168.1.20:8080": false,
+	} {
+		t.Setenv("OLLAMA_HOST", host)
+		if got := IsLocalHost(); got != want {
+			t.Errorf("IsLocalHost() with OLLAMA_HOST=%q = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestInitUnreachableHostFailsFast(t *testing.T) {
+	// An address of TEST-NET-1, never routed, like a desktop at home seen from elsewhere
+	t.Setenv("OLLAMA_HOST", "192.0.2.1:11434")
+	defer func(timeout time.Duration) { ProbeTimeout = timeout }(ProbeTimeout)
+	ProbeTimeout = 200 * time.Millisecond
+
+	start := time.Now()
+	err := Init("llama3")
+	if elapsed := time.Since(start); elapsed > ProbeTimeout+time.Second {
+		t.Errorf("Init() took %s, want it to give up after the probe timeout", elapsed)
+	}
+	var netErr *network.Error
+	if !errors.As(err, &netErr) {
+		t.Fatalf("Init() = %v, want a classified network error", err)
+	}
+	// Which one depends on the network the test runs in, sandboxes refuse what they don't route
+	if netErr.Kind == network.Unknown {
+		t.Errorf("Init() = %v, want the failure classified", err)
+	}
+}
+
+func TestListModelsRefused(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	_, err = listModels(context.Background(), "http://"+address+"/api/tags", address)
+	var netErr *network.Error
+	if !errors.As(err, &netErr) || netErr.Kind != network.Refused || netErr.Host != address {
+		t.Errorf("listModels() = %v, want the connection to %s refused", err, address)
+	}
+}
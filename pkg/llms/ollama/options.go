@@ -0,0 +1,250 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/config"
+	lexio "github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/network"
+	"github.com/micr0-dev/lexido/pkg/retry"
+)
+
+func init() {
+	config.Register("ollama_options", "", func(val string) error {
+		_, err := ParseOptions(val)
+		return err
+	})
+}
+
+// Generation options sent in the options object of the request, such as temperature, num_ctx or seed.
+// `ollama run` has no flags for them, so once any is set lexido talks to the HTTP API instead.
+var options = map[string]any{}
+
+// Bounds of the options lexido knows about, others are passed on unchecked
+var optionRanges = map[string]struct {
+	min, max float64
+	integer  bool
+}{
+	"temperature":    {0, 2, false},
+	"top_p":          {0, 1, false},
+	"min_p":          {0, 1, false},
+	"top_k":          {1, math.MaxInt32, true},
+	"num_ctx":        {1, math.MaxInt32, true},
+	"num_predict":    {-2, math.MaxInt32, true},
+	"seed":           {math.MinInt32, math.MaxInt32, true},
+	"repeat_penalty": {0, math.MaxFloat32, false},
+	"repeat_last_n":  {-1, math.MaxInt32, true},
+}
+
+// Parses the JSON object of the OLLAMA_OPTIONS setting and checks its values
+func ParseOptions(text string) (map[string]any, error) {
+	opts := map[string]any{}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	if err := decoder.Decode(&opts); err != nil {
+		return nil, fmt.Errorf("ollama options must be a JSON object such as {\"temperature\": 0.2}: %w", err)
+	}
+	for name, value := range opts {
+		if number, ok := value.(json.Number); ok {
+			f, err := number.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("invalid ollama option %s: %w", name, err)
+			}
+			opts[name] = f
+		}
+	}
+	if err := ValidateOptions(opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// Checks the options lexido knows about, so a typo fails before the request instead of being ignored by ollama
+func ValidateOptions(opts map[string]any) error {
+	for name, value := range opts {
+		bounds, known := optionRanges[name]
+		if !known {
+			continue
+		}
+		f, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("ollama option %s must be a number", name)
+		}
+		if bounds.integer && f != math.Trunc(f) {
+			return fmt.Errorf("ollama option %s must be a whole number", name)
+		}
+		if f < bounds.min || f > bounds.max {
+			return fmt.Errorf("ollama option %s must be between %g and %g", name, bounds.min, bounds.max)
+		}
+	}
+	return nil
+}
+
+// Merges the options into the ones sent with every request, later calls override earlier ones
+func SetOptions(opts map[string]any) error {
+	if err := ValidateOptions(opts); err != nil {
+		return err
+	}
+	for name, value := range opts {
+		options[name] = value
+	}
+	return nil
+}
+
+// Temperature and num_predict from --temperature and --max-tokens or their settings, they win over options
+var sampling = map[string]any{}
+
+// Sets the temperature and num_predict of every request, nil keeps the one of options or ollama's default
+func SetSampling(temperature *float64, maxTokens *int) {
+	sampling = map[string]any{}
+	if temperature != nil {
+		sampling["temperature"] = *temperature
+	}
+	if maxTokens != nil {
+		sampling["num_predict"] = float64(*maxTokens)
+	}
+}
+
+// Reset forgets the options and the sampling that were set
+func Reset() {
+	options, sampling = map[string]any{}, map[string]any{}
+}
+
+// Returns the options sent with a request, the sampling on top of options
+func requestOptions() map[string]any {
+	merged := map[string]any{}
+	for name, value := range options {
+		merged[name] = value
+	}
+	for name, value := range sampling {
+		merged[name] = value
+	}
+	return merged
+}
+
+// Settings describes what besides the prompt and the model shapes a response: the host and the options sent
+func Settings() string {
+	opts, _ := json.Marshal(requestOptions())
+	return HostAddress() + " " + string(opts)
+}
+
+// Returns the URL of an endpoint of the ollama API
+func apiURL(path string) string {
+	scheme := "http"
+	if strings.HasPrefix(strings.TrimSpace(os.Getenv("OLLAMA_HOST")), "https://") {
+		scheme = "https"
+	}
+	return scheme + "://" + HostAddress() + path
+}
+
+// Streams a response from /api/generate with the current options, images go base64 encoded into its images
+func generateAPI(ctx context.Context, str_prompt string, images []lexio.Image) (<-chan string, <-chan error, error) {
+	opts := requestOptions()
+	request := map[string]any{
+		"model":   llmModel,
+		"prompt":  str_prompt,
+		"stream":  true,
+		"options": opts,
+	}
+	if len(images) > 0 {
+		encoded := make([]string, len(images))
+		for i, img := range images {
+			encoded[i] = base64.StdEncoding.EncodeToString(img.Data)
+		}
+		request["images"] = encoded
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL("/api/generate"), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	logging.Debugf("POST %s with options %v", req.URL, opts)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if network.IsReset(err) {
+			return nil, nil, retry.Retryable(err, 0, 0)
+		}
+		return nil, nil, network.Wrap(HostAddress(), err)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Error != "" {
+			msg = []byte(apiErr.Error)
+		}
+		err := fmt.Errorf("ollama responded %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		if retry.RetryableStatus(resp.StatusCode) {
+			return nil, nil, retry.Retryable(err, resp.StatusCode, retry.ParseRetryAfter(resp.Header.Get("Retry-After")))
+		}
+		return nil, nil, err
+	}
+
+	outputChan := make(chan string)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(outputChan)
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var chunk struct {
+				Response string `json:"response"`
+				Done     bool   `json:"done"`
+				Error    string `json:"error"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+				logging.Warnf("Error decoding ollama response: %v", err)
+				continue
+			}
+			if chunk.Error != "" {
+				errChan <- classifyRunError(errors.New(chunk.Error), chunk.Error)
+				return
+			}
+			if chunk.Response != "" {
+				outputChan <- chunk.Response
+			}
+			if chunk.Done {
+				break
+			}
+		}
+
+		err := scanner.Err()
+		switch {
+		case ctx.Err() != nil:
+			errChan <- ctx.Err()
+		case err != nil && network.IsReset(err):
+			// The connection dropped mid-stream, the request is restarted from scratch
+			errChan <- retry.Retryable(fmt.Errorf("error reading stream: %w", err), 0, 0)
+		case err != nil:
+			errChan <- fmt.Errorf("error reading stream: %w", err)
+		default:
+			errChan <- nil
+		}
+	}()
+
+	return outputChan, errChan, nil
+}
@@ -0,0 +1,139 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Starts the test with no options set and puts back the ones before it afterwards
+func resetOptions(t *testing.T) {
+	t.Helper()
+	was, wasSampling := options, sampling
+	options, sampling = map[string]any{}, map[string]any{}
+	t.Cleanup(func() { options, sampling = was, wasSampling })
+}
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		text string
+		want map[string]any
+		err  string // Part of the error, empty when the options are valid
+	}{
+		{text: `{"temperature": 0.2, "num_ctx": 8192}`, want: map[string]any{"temperature": 0.2, "num_ctx": 8192.0}},
+		{text: `{"seed": -42, "top_p": 1}`, want: map[string]any{"seed": -42.0, "top_p": 1.0}},
+		{text: `{"stop": ["\n\n"], "mirostat": 2}`, want: map[string]any{"stop": []any{"\n\n"}, "mirostat": 2.0}},
+		{text: `{}`, want: map[string]any{}},
+		{text: `temperature=0.2`, err: "must be a JSON object"},
+		{text: `[0.2]`, err: "must be a JSON object"},
+		{text: `{"temperature": 3}`, err: "temperature must be between 0 and 2"},
+		{text: `{"temperature": "hot"}`, err: "temperature must be a number"},
+		{text: `{"num_ctx": 0}`, err: "num_ctx must be between 1 and"},
+		{text: `{"num_ctx": 2048.5}`, err: "num_ctx must be a whole number"},
+		{text: `{"seed": 1e12}`, err: "seed must be between"},
+		{text: `{"top_p": -0.1}`, err: "top_p must be between 0 and 1"},
+	}
+	for _, test := range tests {
+		got, err := ParseOptions(test.text)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseOptions(%s) = %v, want an error with %q", test.text, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseOptions(%s) = %v", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseOptions(%s) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	resetOptions(t)
+	if err := SetOptions(map[string]any{"temperature": 0.5, "num_ctx": 4096.0}); err != nil {
+		t.Fatal(err)
+	}
+	// Later calls override single options, as the flags do over the setting
+	if err := SetOptions(map[string]any{"num_ctx": 16384.0}); err != nil {
+		t.Fatal(err)
+	}
+	// An invalid value changes nothing
+	if err := SetOptions(map[string]any{"seed": 7.0, "num_ctx": -1.0}); err == nil {
+		t.Error("SetOptions() accepted num_ctx -1")
+	}
+
+	temperature := 0.0
+	SetSampling(&temperature, nil)
+	want := map[string]any{"temperature": 0.0, "num_ctx": 16384.0}
+	if got := requestOptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requestOptions() = %v, want %v", got, want)
+	}
+}
+
+func TestOptionsSentWithTheRequest(t *testing.T) {
+	resetOptions(t)
+	var request map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Write([]byte(`{"response": "ok", "done": false}` + "\n" + `{"response": "", "done": true}` + "\n"))
+	}))
+	defer server.Close()
+	t.Setenv("OLLAMA_HOST", server.URL)
+	llmModel = "llama3"
+
+	SetOptions(map[string]any{"num_ctx": 8192.0, "seed": 42.0})
+	outputChan, errChan, err := generateAPI(context.Background(), "hi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response string
+	for chunk := range outputChan {
+		response += chunk
+	}
+	if err := <-errChan; err != nil || response != "ok" {
+		t.Fatalf("generateAPI() = %q, %v", response, err)
+	}
+
+	want := map[string]any{"num_ctx": 8192.0, "seed": 42.0}
+	if !reflect.DeepEqual(request["options"], want) {
+		t.Errorf("options sent = %v, want %v", request["options"], want)
+	}
+}
+
+// Against a real model, named by LEXIDO_TEST_OLLAMA_MODEL, a seed with temperature 0 answers the same twice
+func TestSeedReproducible(t *testing.T) {
+	model := os.Getenv("LEXIDO_TEST_OLLAMA_MODEL")
+	if model == "" || !LocalAvailable() {
+		t.Skip("set LEXIDO_TEST_OLLAMA_MODEL to a model of the local ollama to run this")
+	}
+	resetOptions(t)
+	t.Setenv("OLLAMA_HOST", "")
+	llmModel = model
+	SetOptions(map[string]any{"seed": 1234.0, "temperature": 0.0, "num_predict": 40.0})
+
+	answer := func() string {
+		outputChan, errChan, err := generateAPI(context.Background(), "Name a random animal.", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var response string
+		for chunk := range outputChan {
+			response += chunk
+		}
+		if err := <-errChan; err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	if first, second := answer(), answer(); first != second {
+		t.Errorf("the same seed answered %q and %q", first, second)
+	}
+}
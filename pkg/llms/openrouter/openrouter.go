@@ -0,0 +1,84 @@
+package openrouter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/network"
+)
+
+// Endpoint listing the models OpenRouter routes to
+var ModelsURL = "https://openrouter.ai/api/v1/models"
+
+// Environment variable and keyring field of the API key, the same the openrouter preset uses
+const KeyName = "OPENROUTER_API_KEY"
+
+// Model is a model available through OpenRouter, prices are in US dollars per million tokens
+type Model struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	ContextLength int     `json:"context_length"`
+	Prompt        float64 `json:"prompt_price"`
+	Response      float64 `json:"response_price"`
+}
+
+// Lists the models with their prices, sorted by id. The list is public, the key is sent when there is one.
+func Models(ctx context.Context) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", ModelsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	key := os.Getenv(KeyName)
+	if key == "" {
+		key, _ = io.ReadFromKeyring(KeyName)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, network.Wrap(network.HostOf(ModelsURL), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("openrouter responded %s", resp.Status)
+	}
+
+	// Prices come as strings of dollars per token
+	var list struct {
+		Data []struct {
+			ID            string `json:"id"`
+			Name          string `json:"name"`
+			ContextLength int    `json:"context_length"`
+			Pricing       struct {
+				Prompt     string `json:"prompt"`
+				Completion string `json:"completion"`
+			} `json:"pricing"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("reading the openrouter model list: %w", err)
+	}
+
+	models := make([]Model, len(list.Data))
+	for i, m := range list.Data {
+		models[i] = Model{ID: m.ID, Name: m.Name, ContextLength: m.ContextLength, Prompt: perMillion(m.Pricing.Prompt), Response: perMillion(m.Pricing.Completion)}
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+func perMillion(perToken string) float64 {
+	price, err := strconv.ParseFloat(perToken, 64)
+	if err != nil {
+		return 0
+	}
+	return price * 1e6
+}
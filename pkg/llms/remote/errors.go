@@ -0,0 +1,78 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// How a content filter judged one category, as Azure reports it
+type filterResult struct {
+	Filtered bool   `json:"filtered"`
+	Severity string `json:"severity"`
+}
+
+type errorBody struct {
+	Error struct {
+		Code       interface{} `json:"code"`
+		InnerError struct {
+			Code                string                  `json:"code"`
+			ContentFilterResult map[string]filterResult `json:"content_filter_result"`
+		} `json:"innererror"`
+	} `json:"error"`
+}
+
+// Reports whether the body of a failed response says a content filter blocked the prompt
+func contentFiltered(body []byte) (categories []string, filtered bool) {
+	var parsed errorBody
+	if json.Unmarshal(body, &parsed) != nil {
+		return nil, false
+	}
+	if parsed.Error.Code != "content_filter" && parsed.Error.InnerError.Code != "ResponsibleAIPolicyViolation" {
+		return nil, false
+	}
+	for category, result := range parsed.Error.InnerError.ContentFilterResult {
+		if result.Filtered {
+			categories = append(categories, category+": "+result.Severity)
+		}
+	}
+	sort.Strings(categories)
+	return categories, true
+}
+
+// Turns the body of a failed response into a readable message, naming the categories when a content filter blocked the prompt
+func describeError(body []byte) string {
+	if categories, filtered := contentFiltered(body); filtered {
+		message := "the prompt was blocked by the provider's content filter"
+		if len(categories) > 0 {
+			message += fmt.Sprintf(" (%s)", strings.Join(categories, ", "))
+		}
+		return message + ", try wording it differently"
+	}
+	if message := errorMessage(body); message != "" {
+		return message
+	}
+	if text := strings.TrimSpace(string(body)); text != "" {
+		return text
+	}
+	return "no details given"
+}
+
+// Reports whether a chunk of the stream says the content filter stopped the response
+func filterStopped(data []byte) bool {
+	var chunk struct {
+		Choices []struct {
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(data, &chunk) != nil {
+		return false
+	}
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason == "content_filter" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	lexio "github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+)
+
+// Ready made configurations of known providers, one JSON file each
+//
+//go:embed presets/*.json
+var presetFiles embed.FS
+
+// Preset is a remoteConfig.json for a known provider, its key goes to the keyring rather than into the file
+type Preset struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	KeyName     string          `json:"key_name"` // Environment variable and keyring field of the API key
+	KeyURL      string          `json:"key_url"`  // Where the API key is created
+	Config      json.RawMessage `json:"config"`
+	// Fields merged into the data template of the request that checks the key, such as a max_tokens of 1
+	Test map[string]interface{} `json:"test,omitempty"`
+	// Values of the url its user is asked for, such as the Azure resource and deployment
+	Variables []PresetVariable `json:"variables,omitempty"`
+}
+
+// PresetVariable is a {name} placeholder of the url of a preset
+type PresetVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     string `json:"default,omitempty"`
+}
+
+// Returns the built-in presets sorted by name
+func Presets() ([]Preset, error) {
+	paths, err := presetFiles.ReadDir("presets")
+	if err != nil {
+		return nil, err
+	}
+	var presets []Preset
+	for _, entry := range paths {
+		data, err := presetFiles.ReadFile("presets/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		var preset Preset
+		if err := json.Unmarshal(data, &preset); err != nil {
+			return nil, fmt.Errorf("preset %s: %w", entry.Name(), err)
+		}
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets, nil
+}
+
+// Finds a built-in preset by name, case insensitively
+func LookupPreset(name string) (Preset, error) {
+	presets, err := Presets()
+	if err != nil {
+		return Preset{}, err
+	}
+	var names []string
+	for _, preset := range presets {
+		if strings.EqualFold(preset.Name, name) {
+			return preset, nil
+		}
+		names = append(names, preset.Name)
+	}
+	return Preset{}, fmt.Errorf("unknown remote preset %q, available presets: %s", name, strings.Join(names, ", "))
+}
+
+// Finds the built-in preset whose API key is kept under the name, for telling the user where to get it
+func PresetForKey(name string) (Preset, bool) {
+	presets, err := Presets()
+	if err != nil {
+		return Preset{}, false
+	}
+	for _, preset := range presets {
+		if preset.KeyName == name {
+			return preset, true
+		}
+	}
+	return Preset{}, false
+}
+
+// Returns the config of the preset with the values of its variables.
+// With test set, its data template also gets the fields of the test request.
+func (p Preset) RemoteConfig(variables map[string]string, test bool) (Config, error) {
+	var config Config
+	if err := json.Unmarshal(p.Config, &config); err != nil {
+		return Config{}, fmt.Errorf("preset %s: %w", p.Name, err)
+	}
+	if len(variables) > 0 {
+		config.ApiConfig.Variables = variables
+	}
+	if template, ok := config.ApiConfig.DataTemplate.(map[string]interface{}); ok && test {
+		for key, value := range p.Test {
+			template[key] = value
+		}
+	}
+	return config, nil
+}
+
+// Sends a tiny request with the preset to check that the endpoint accepts the key, returning the response text
+func TestPreset(ctx context.Context, preset Preset, variables map[string]string) (string, error) {
+	config, err := preset.RemoteConfig(variables, true)
+	if err != nil {
+		return "", err
+	}
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+
+	responses, errs, err := config.GenerateContentStream(ctx, TestPrompt)
+	if err != nil {
+		return "", err
+	}
+	var response strings.Builder
+	for text := range responses {
+		response.WriteString(text)
+	}
+	return response.String(), <-errs
+}
+
+// TestPrompt is the prompt of test requests, answered in a token or two
+var TestPrompt = prompt.Parts{System: "Answer in one word.", User: "Say ok"}
+
+// Writes the preset with the values of its variables as remoteConfig.json. An existing config is kept as
+// remoteConfig.json.bak, whose path is returned unless there was nothing to back up.
+func WritePreset(preset Preset, variables map[string]string) (path string, backup string, err error) {
+	path, err = lexio.GetFilePath(lexio.Config, "remoteConfig.json")
+	if err != nil {
+		return "", "", err
+	}
+	data := preset.Config
+	if len(variables) > 0 {
+		config, err := preset.RemoteConfig(variables, false)
+		if err != nil {
+			return "", "", err
+		}
+		var encoded bytes.Buffer
+		encoder := json.NewEncoder(&encoded)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(config); err != nil {
+			return "", "", err
+		}
+		data = encoded.Bytes()
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return "", "", err
+	}
+	data = bytes.TrimSpace(indented.Bytes())
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", "", err
+	}
+
+	if existing, err := os.ReadFile(path); err == nil && !bytes.Equal(existing, data) {
+		backup = path + ".bak"
+		if err := os.WriteFile(backup, existing, 0600); err != nil {
+			return "", "", err
+		}
+	}
+	return path, backup, os.WriteFile(path, data, 0644)
+}
@@ -2,16 +2,25 @@ package remote
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	lexio "github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/logging"
+	"github.com/micr0-dev/lexido/pkg/network"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+	"github.com/micr0-dev/lexido/pkg/retry"
 )
 
 const defaultConfig = `{
@@ -36,38 +45,264 @@ type Config struct {
 		Headers      map[string]string `json:"headers"`
 		DataTemplate interface{}       `json:"data_template"`
 		FieldOutput  string            `json:"field_to_extract"`
+		Stream       *bool             `json:"stream,omitempty"` // false reads the whole response at once, for endpoints that don't stream
+		// Transport settings for endpoints behind a corporate proxy or with a private CA
+		Proxy              string `json:"proxy,omitempty"`
+		CACertFile         string `json:"ca_cert_file,omitempty"`
+		InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+		// Values of {name} placeholders in the url, such as the deployment of an Azure endpoint
+		Variables map[string]string `json:"variables,omitempty"`
+		// Model filled into a <MODEL> placeholder of the data template, -m picks another one for a run
+		Model string `json:"model,omitempty"`
 	} `json:"api_config"`
 }
 
-// replacePrompt recursively searches for the <PROMPT> placeholder and replaces it
-func replacePrompt(data interface{}, prompt string) interface{} {
+// Returns the url with its {name} placeholders replaced by the variables
+func (c Config) URL() string {
+	url := c.ApiConfig.URL
+	for name, value := range c.ApiConfig.Variables {
+		url = strings.ReplaceAll(url, "{"+name+"}", value)
+	}
+	return url
+}
+
+// Reports whether the response is read as a stream, which is the default
+func (c Config) Streaming() bool {
+	return c.ApiConfig.Stream == nil || *c.ApiConfig.Stream
+}
+
+// Placeholder of the data template that is replaced with the messages of a continued conversation
+const historyPlaceholder = "<HISTORY>"
+
+// Model chosen with -m, it replaces the model of the config for this run
+var modelOverride string
+
+// Uses another model than the config names, through its <MODEL> placeholder or the "model" field of the data template
+func SetModel(name string) {
+	modelOverride = name
+}
+
+// Returns the model that fills <MODEL>
+func (c Config) model() string {
+	if modelOverride != "" {
+		return modelOverride
+	}
+	return c.ApiConfig.Model
+}
+
+// Placeholders of the data template filled with --temperature and --max-tokens or their settings
+const (
+	TemperaturePlaceholder = "<TEMPERATURE>"
+	MaxTokensPlaceholder   = "<MAX_TOKENS>"
+)
+
+// Values of the sampling placeholders, a field whose whole value is an unset one is left out of the request
+var sampling = map[string]interface{}{}
+
+// Fills <TEMPERATURE> and <MAX_TOKENS> as numbers, nil leaves the API's default
+func SetSampling(temperature *float64, maxTokens *int) {
+	sampling = map[string]interface{}{}
+	if temperature != nil {
+		sampling[TemperaturePlaceholder] = *temperature
+	}
+	if maxTokens != nil {
+		sampling[MaxTokensPlaceholder] = *maxTokens
+	}
+}
+
+// Reset forgets the model of SetModel and the sampling
+func Reset() {
+	modelOverride = ""
+	sampling = map[string]interface{}{}
+}
+
+// Settings describes what besides the prompt and the model shapes a response of the API at the url of c: the url
+// and the sampling
+func (c Config) Settings() string {
+	values, _ := json.Marshal(sampling)
+	return c.URL() + " " + string(values)
+}
+
+// Reports whether a string of the data template holds the placeholder
+func (c Config) HasPlaceholder(placeholder string) bool {
+	return hasString(c.ApiConfig.DataTemplate, func(s string) bool { return strings.Contains(s, placeholder) })
+}
+
+// Reports whether value is a sampling placeholder that wasn't given a value
+func unsetSampling(value interface{}) bool {
+	s, ok := value.(string)
+	if !ok || (s != TemperaturePlaceholder && s != MaxTokensPlaceholder) {
+		return false
+	}
+	_, set := sampling[s]
+	return !set
+}
+
+// Placeholders of the data template. <PROMPT> is the whole prompt, <SYSTEM> and <USER> its parts for APIs with roles.
+// Without a <HISTORY> in the template, <USER> carries the continued conversation too.
+func placeholders(parts prompt.Parts, withHistory bool, model string) map[string]string {
+	user := parts.User
+	if !withHistory {
+		user = parts.Conversation()
+	}
+	values := map[string]string{
+		"<PROMPT>":             parts.Text(),
+		"<SYSTEM>":             parts.System,
+		"<USER>":               user,
+		"<MODEL>":              model,
+		TemperaturePlaceholder: "",
+		MaxTokensPlaceholder:   "",
+	}
+	for placeholder, value := range sampling {
+		values[placeholder] = fmt.Sprint(value)
+	}
+	return values
+}
+
+// Turns the cached conversation into {role, content} messages. Text cached before turns were labeled is sent as the user's.
+func historyMessages(history string) []interface{} {
+	messages := []interface{}{}
+	for _, turn := range lexio.ParseConversation(history) {
+		role := turn.Role
+		if role != "user" && role != "assistant" {
+			role = "user"
+		}
+		messages = append(messages, map[string]interface{}{"role": role, "content": turn.Content})
+	}
+	return messages
+}
+
+// Reports whether the template has a <HISTORY> element in one of its arrays
+func hasHistory(data interface{}) bool {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for _, value := range v {
+			if hasHistory(value) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if item == historyPlaceholder || hasHistory(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// replacePlaceholders recursively replaces the placeholders in the strings of the template, also inside nested arrays of messages.
+// A <HISTORY> element of an array is replaced with the history messages in its place.
+func replacePlaceholders(data interface{}, values map[string]string, history []interface{}) interface{} {
 	switch v := data.(type) {
 	case map[string]interface{}:
 		for key, value := range v {
-			v[key] = replacePrompt(value, prompt)
+			if unsetSampling(value) {
+				delete(v, key)
+				continue
+			}
+			v[key] = replacePlaceholders(value, values, history)
 		}
 	case []interface{}:
-		for i, item := range v {
-			v[i] = replacePrompt(item, prompt)
+		replaced := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if item == historyPlaceholder {
+				replaced = append(replaced, history...)
+				continue
+			}
+			replaced = append(replaced, replacePlaceholders(item, values, history))
 		}
+		return replaced
 	case string:
-		if v == "<PROMPT>" {
-			return prompt
+		// A sampling placeholder on its own becomes a number, APIs reject "0.2"
+		if number, ok := sampling[v]; ok {
+			return number
+		}
+		if value, ok := values[v]; ok {
+			return value
 		}
+		// Placeholders inside a longer string, such as "Context: <SYSTEM>". A single pass leaves
+		// placeholders that appear in the prompt itself alone.
+		var pairs []string
+		for placeholder, value := range values {
+			pairs = append(pairs, placeholder, value)
+		}
+		return strings.NewReplacer(pairs...).Replace(v)
 	}
 	return data
 }
 
+// A <KEY:NAME> in a header is the API key kept in the environment variable or keyring field NAME,
+// so remoteConfig.json doesn't have to hold the key itself
+var keyPlaceholder = regexp.MustCompile(`<KEY:([A-Za-z0-9_]+)>`)
+
+func expandKeys(value string) (string, error) {
+	var missing string
+	value = keyPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		name := keyPlaceholder.FindStringSubmatch(placeholder)[1]
+		key := os.Getenv(name)
+		if key == "" {
+			key, _ = lexio.ReadFromKeyring(name)
+		}
+		if key == "" {
+			missing = name
+			return ""
+		}
+		logging.AddSecret(key)
+		return key
+	})
+	if missing != "" {
+		return "", &MissingKeyError{Name: missing}
+	}
+	return value, nil
+}
+
+// Returns the <KEY:NAME> names of the headers, sorted and without duplicates
+func (c Config) KeyNames() []string {
+	var names []string
+	for _, value := range c.ApiConfig.Headers {
+		for _, match := range keyPlaceholder.FindAllStringSubmatch(value, -1) {
+			if !slices.Contains(names, match[1]) {
+				names = append(names, match[1])
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the <KEY:NAME> names of the headers whose key is neither in the environment nor the keyring
+func (c Config) MissingKeys() []string {
+	var missing []string
+	for _, name := range c.KeyNames() {
+		if os.Getenv(name) != "" {
+			continue
+		}
+		if key, _ := lexio.ReadFromKeyring(name); key != "" {
+			continue
+		}
+		missing = append(missing, name)
+	}
+	return missing
+}
+
+// MissingKeyError is a <KEY:NAME> of the remote config whose key is neither in the environment nor the keyring
+type MissingKeyError struct {
+	Name string
+}
+
+func (e *MissingKeyError) Error() string {
+	return fmt.Sprintf("no API key found for the remote config, export %s or store it with lexido remote init", e.Name)
+}
+
 // LoadConfig loads the configuration from the file and returns it
 func LoadConfig() (Config, error) {
-	filepath, err := lexio.GetFilePath("remoteConfig.json")
+	filepath, err := lexio.GetFilePath(lexio.Config, "remoteConfig.json")
 	if err != nil {
 		return Config{}, err
 	}
 
-	// Load the configuration from file
-	configFile, err := os.ReadFile(filepath)
-	if err != nil {
+	if _, err := os.Stat(filepath); err != nil {
 		// Create a default configuration file if it doesn't exist
 		err := os.WriteFile(filepath, []byte(defaultConfig), 0644)
 		if err != nil {
@@ -75,24 +310,77 @@ func LoadConfig() (Config, error) {
 		}
 		return Config{}, errors.New("A remote configuration file not found. A default configuration file has been created at " + filepath)
 	}
+	return LoadConfigFile(filepath)
+}
+
+// LoadConfigFile loads a configuration from another file than the usual one
+func LoadConfigFile(path string) (Config, error) {
+	configFile, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
 
 	var config Config
 	if err := json.Unmarshal(configFile, &config); err != nil {
-		return Config{}, err
+		return Config{}, fmt.Errorf("%s isn't valid JSON: %w", path, err)
 	}
 
 	return config, nil
 }
 
+// ModelName returns the "model" field of the request template, or an empty string if there is none
+func ModelName() string {
+	config, err := LoadConfig()
+	if err != nil {
+		return ""
+	}
+	if modelOverride != "" {
+		return modelOverride
+	}
+	if template, ok := config.ApiConfig.DataTemplate.(map[string]interface{}); ok {
+		if name, ok := template["model"].(string); ok {
+			return strings.ReplaceAll(name, "<MODEL>", config.ApiConfig.Model)
+		}
+	}
+	// Azure picks the model by the deployment in the url
+	return config.ApiConfig.Variables["deployment"]
+}
+
 // ExtractOutput initiates the extraction process by unmarshaling the JSON response and calling findField recursively.
+// A dotted field such as choices.0.delta.content is a path from the top of the response instead.
 func ExtractOutput(response []byte, field string) (string, error) {
 	var output map[string]interface{}
 	if err := json.Unmarshal(response, &output); err != nil {
 		return "", err
 	}
+	if strings.Contains(field, ".") {
+		return fieldPath(output, strings.Split(field, ".")), nil
+	}
 	return findField(output, field), nil
 }
 
+// Follows a path of keys and array indexes, a missing or null value is an empty string
+func fieldPath(data interface{}, path []string) string {
+	for _, step := range path {
+		switch v := data.(type) {
+		case map[string]interface{}:
+			data = v[step]
+		case []interface{}:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(v) {
+				return ""
+			}
+			data = v[i]
+		default:
+			return ""
+		}
+	}
+	if value, ok := data.(string); ok {
+		return value
+	}
+	return ""
+}
+
 // findField recursively searches for the field within the nested JSON structure.
 func findField(data interface{}, field string) string {
 	switch v := data.(type) {
@@ -124,64 +412,238 @@ func findField(data interface{}, field string) string {
 	return ""
 }
 
-// Generate sends a POST request to the API endpoint with the prompt and returns a channel of responses
-func GenerateContentStream(prompt string) (<-chan string, error) {
-	config, err := LoadConfig()
-	if err != nil {
-		return nil, err
-	}
+// StatusError is a response the API rejected with an HTTP error status
+type StatusError struct {
+	Status   int
+	Message  string
+	Filtered bool // The provider's content filter blocked the prompt or the response
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
 
-	// Replace <PROMPT> in the DataTemplate
-	config.ApiConfig.DataTemplate = replacePrompt(config.ApiConfig.DataTemplate, prompt)
+// Builds the request for the prompt, filling the placeholders of the data template and the keys of the headers
+func (config Config) newRequest(ctx context.Context, parts prompt.Parts) (*http.Request, error) {
+	// Replace <PROMPT>, <SYSTEM>, <USER>, <HISTORY> and the sampling placeholders in the DataTemplate
+	withHistory := hasHistory(config.ApiConfig.DataTemplate)
+	if fields, ok := config.ApiConfig.DataTemplate.(map[string]interface{}); ok && modelOverride != "" {
+		if _, ok := fields["model"]; ok {
+			fields["model"] = modelOverride
+		}
+	}
+	template := replacePlaceholders(config.ApiConfig.DataTemplate, placeholders(parts, withHistory, config.model()), historyMessages(parts.History))
 
 	// Marshal the data template back into JSON for the API request
-	jsonData, err := json.Marshal(config.ApiConfig.DataTemplate)
+	jsonData, err := json.Marshal(template)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	// Create and send the API request
-	req, err := http.NewRequest("POST", config.ApiConfig.URL, strings.NewReader(string(jsonData)))
+	// Create the API request, cancelling the context aborts it
+	req, err := http.NewRequestWithContext(ctx, "POST", config.ApiConfig.URL, bytes.NewReader(jsonData))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	for key, value := range config.ApiConfig.Headers {
+		value, err := expandKeys(value)
+		if err != nil {
+			return nil, err
+		}
 		req.Header.Add(key, value)
 	}
 
-	client := &http.Client{}
+	logging.Debugf("POST %s with headers %v and body %s", config.ApiConfig.URL, logging.RedactHeaders(req.Header), jsonData)
+	return req, nil
+}
+
+// Longest error body kept from a failed response
+const maxErrorBody = 4096
+
+// Generate sends a POST request to the API endpoint with the prompt and returns a channel of responses.
+// The error channel receives a single value once the response channel is closed, nil when the stream ended cleanly.
+func GenerateContentStream(ctx context.Context, parts prompt.Parts) (<-chan string, <-chan error, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("%w, lexido remote test shows more", err)
+	}
+	return config.GenerateContentStream(ctx, parts)
+}
+
+// GenerateContentStream sends the prompt as this configuration describes, the config doesn't have to be the one on disk
+func (config Config) GenerateContentStream(ctx context.Context, parts prompt.Parts) (<-chan string, <-chan error, error) {
+	config.ApiConfig.URL = config.URL()
+	req, err := config.newRequest(ctx, parts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := config.httpClient()
+	if err != nil {
+		return nil, nil, err
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		if network.IsReset(err) {
+			return nil, nil, retry.Retryable(err, 0, 0)
+		}
+		return nil, nil, network.Wrap(network.HostOf(config.ApiConfig.URL), err)
+	}
+
+	logging.Infof("POST %s responded %s", config.ApiConfig.URL, resp.Status)
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		_, filtered := contentFiltered(body)
+		err := &StatusError{Status: resp.StatusCode, Message: fmt.Sprintf("%s responded %s: %s", network.HostOf(config.ApiConfig.URL), resp.Status, describeError(body)), Filtered: filtered}
+		if retry.RetryableStatus(resp.StatusCode) {
+			return nil, nil, retry.Retryable(err, resp.StatusCode, retry.ParseRetryAfter(resp.Header.Get("Retry-After")))
+		}
+		return nil, nil, err
 	}
 
 	// Create a channel to send responses
 	responseChan := make(chan string)
+	errChan := make(chan error, 1)
+	host := network.HostOf(config.ApiConfig.URL)
 
 	// Handle the response in a separate goroutine
 	go func() {
 		defer resp.Body.Close()
 		defer close(responseChan)
-		reader := bufio.NewReader(resp.Body)
 
+		if !config.Streaming() {
+			errChan <- readWhole(ctx, resp.Body, host, config.ApiConfig.FieldOutput, responseChan)
+			return
+		}
+
+		// Lines that weren't JSON on their own, a pretty printed response that isn't streamed is parsed whole at the end
+		var unparsed []byte
+		sent := false
+
+		reader := bufio.NewReader(resp.Body)
 		for {
 			line, err := reader.ReadBytes('\n')
-			if err == io.EOF {
-				break // End of stream
+			if err != nil && err != io.EOF {
+				switch {
+				case ctx.Err() != nil:
+					errChan <- ctx.Err()
+				case network.IsReset(err):
+					// The connection dropped mid-stream, the request is restarted from scratch
+					errChan <- retry.Retryable(fmt.Errorf("error reading stream: %w", err), 0, 0)
+				default:
+					errChan <- fmt.Errorf("error reading stream: %w", err)
+				}
+				return
 			}
-			if err != nil {
-				log.Printf("Error reading stream: %v", err)
-				break
+
+			// The last line may arrive without a newline, a response that isn't streamed is a single such line
+			data, done := streamData(line)
+			if done {
+				errChan <- nil
+				return
+			}
+			if data != nil {
+				if apiErr := errorMessage(data); apiErr != "" {
+					errChan <- fmt.Errorf("%s reported an error mid-stream: %s", host, apiErr)
+					return
+				}
+				extracted, extractErr := ExtractOutput(data, config.ApiConfig.FieldOutput)
+				if extractErr != nil {
+					unparsed = append(unparsed, line...)
+				} else if extracted != "" {
+					responseChan <- extracted
+					sent = true
+				}
+				if filterStopped(data) {
+					errChan <- &StatusError{Status: http.StatusOK, Message: host + " cut the response off with its content filter", Filtered: true}
+					return
+				}
 			}
 
-			extracted, err := ExtractOutput(line, config.ApiConfig.FieldOutput)
-			if err != nil {
-				log.Printf("Error extracting output: %v", err)
-				continue
+			if err == io.EOF {
+				if !sent && len(unparsed) > 0 {
+					errChan <- readWhole(ctx, bytes.NewReader(unparsed), host, config.ApiConfig.FieldOutput, responseChan)
+					return
+				}
+				if len(unparsed) > 0 {
+					logging.Warnf("Ignored %d bytes of the stream that weren't JSON", len(unparsed))
+				}
+				errChan <- nil
+				return
 			}
-			responseChan <- extracted
 		}
 	}()
 
-	return responseChan, nil
+	return responseChan, errChan, nil
+}
+
+// Returns the JSON of a line of the stream, unwrapping server-sent events. done is set by the [DONE] event.
+func streamData(line []byte) (data []byte, done bool) {
+	text := strings.TrimSpace(string(line))
+	switch {
+	case text == "":
+		return nil, false
+	case strings.HasPrefix(text, "data:"):
+		text = strings.TrimSpace(strings.TrimPrefix(text, "data:"))
+		if text == "[DONE]" {
+			return nil, true
+		}
+		return []byte(text), false
+	case strings.HasPrefix(text, ":"), strings.HasPrefix(text, "event:"), strings.HasPrefix(text, "id:"), strings.HasPrefix(text, "retry:"):
+		// Comments and fields of server-sent events other than data
+		return nil, false
+	}
+	return []byte(text), false
+}
+
+// Returns the message of an {"error": ...} object, as APIs send when a stream fails after it started
+func errorMessage(data []byte) string {
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(data, &body) != nil || len(body.Error) == 0 || string(body.Error) == "null" {
+		return ""
+	}
+	var message string
+	if json.Unmarshal(body.Error, &message) == nil {
+		return message
+	}
+	var object struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body.Error, &object) == nil && object.Message != "" {
+		return object.Message
+	}
+	return string(body.Error)
+}
+
+// Reads a response that isn't streamed and sends its text as one chunk
+func readWhole(ctx context.Context, body io.Reader, host string, field string, responseChan chan<- string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if network.IsReset(err) {
+			return retry.Retryable(fmt.Errorf("error reading response: %w", err), 0, 0)
+		}
+		return fmt.Errorf("error reading response: %w", err)
+	}
+	if apiErr := errorMessage(data); apiErr != "" {
+		return fmt.Errorf("%s reported an error: %s", host, apiErr)
+	}
+	extracted, err := ExtractOutput(data, field)
+	if err != nil {
+		return fmt.Errorf("%s sent a response that isn't JSON: %w", host, err)
+	}
+	if extracted == "" {
+		return fmt.Errorf("the response of %s has no %q field, check field_to_extract", host, field)
+	}
+	responseChan <- extracted
+	return nil
 }
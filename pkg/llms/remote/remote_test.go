@@ -0,0 +1,146 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/prompt"
+)
+
+// Builds the body of the request the config sends for parts, as a JSON value
+func requestBody(t *testing.T, c Config, parts prompt.Parts) interface{} {
+	t.Helper()
+	req, err := c.newRequest(context.Background(), parts)
+	if err != nil {
+		t.Fatalf("newRequest() = %v", err)
+	}
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("the body %s isn't JSON: %v", data, err)
+	}
+	return body
+}
+
+func parseJSON(t *testing.T, text string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		t.Fatalf("parsing %s: %v", text, err)
+	}
+	return v
+}
+
+func TestReplacePlaceholders(t *testing.T) {
+	parts := prompt.Parts{System: "You are lexido.", User: "list files", Label: "User: "}
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name:     "whole prompt",
+			template: `{"prompt": "<PROMPT>"}`,
+			want:     `{"prompt": "You are lexido.\n User: list files"}`,
+		},
+		{
+			name:     "system and user in messages",
+			template: `{"messages": [{"role": "system", "content": "<SYSTEM>"}, {"role": "user", "content": "<USER>"}]}`,
+			want:     `{"messages": [{"role": "system", "content": "You are lexido."}, {"role": "user", "content": "list files"}]}`,
+		},
+		{
+			name:     "nested arrays of message objects",
+			template: `{"contents": [{"role": "user", "parts": [{"text": "<SYSTEM>"}, {"text": "<USER>"}]}], "system_instruction": {"parts": [[{"text": "<SYSTEM>"}]]}}`,
+			want:     `{"contents": [{"role": "user", "parts": [{"text": "You are lexido."}, {"text": "list files"}]}], "system_instruction": {"parts": [[{"text": "You are lexido."}]]}}`,
+		},
+		{
+			name:     "placeholders inside longer strings",
+			template: `{"input": "Context: <SYSTEM>\nQuestion: <USER>"}`,
+			want:     `{"input": "Context: You are lexido.\nQuestion: list files"}`,
+		},
+		{
+			name:     "other values left alone",
+			template: `{"stream": true, "n": 1, "stop": null, "tags": ["a", 2]}`,
+			want:     `{"stream": true, "n": 1, "stop": null, "tags": ["a", 2]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := parseJSON(t, test.template)
+			got := replacePlaceholders(template, placeholders(parts, false, ""), nil)
+			if want := parseJSON(t, test.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("replacePlaceholders(%s) = %v, want %v", test.template, got, want)
+			}
+		})
+	}
+}
+
+func TestReplacePlaceholdersPromptContainingPlaceholder(t *testing.T) {
+	// A prompt that mentions <SYSTEM> itself is sent as it was typed
+	parts := prompt.Parts{System: "sys", User: "what does <SYSTEM> mean in a template"}
+	got := replacePlaceholders(parseJSON(t, `{"input": "Q: <USER>"}`), placeholders(parts, false, ""), nil)
+	want := parseJSON(t, `{"input": "Q: what does <SYSTEM> mean in a template"}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReplacePlaceholdersHistory(t *testing.T) {
+	parts := prompt.Parts{
+		System:  "sys",
+		History: "User: list files\nAssistant: Use @run[ls]\n",
+		User:    "and hidden ones?",
+	}
+	c := Config{}
+	c.ApiConfig.URL = "https://api.example.com"
+	c.ApiConfig.DataTemplate = parseJSON(t, `{"messages": [{"role": "system", "content": "<SYSTEM>"}, "<HISTORY>", {"role": "user", "content": "<USER>"}]}`)
+
+	got := requestBody(t, c, parts)
+	want := parseJSON(t, `{"messages": [
+		{"role": "system", "content": "sys"},
+		{"role": "user", "content": "list files"},
+		{"role": "assistant", "content": "Use @run[ls]"},
+		{"role": "user", "content": "and hidden ones?"}
+	]}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %v, want %v", got, want)
+	}
+
+	// Without <HISTORY> the conversation goes along in <USER>
+	c.ApiConfig.DataTemplate = parseJSON(t, `{"messages": [{"role": "user", "content": "<USER>"}]}`)
+	got = requestBody(t, c, parts)
+	want = parseJSON(t, `{"messages": [{"role": "user", "content": "User: list files\nAssistant: Use @run[ls]\n\nand hidden ones?"}]}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %v, want %v", got, want)
+	}
+}
+
+func TestReplacePlaceholdersSampling(t *testing.T) {
+	defer SetSampling(nil, nil)
+	template := `{"prompt": "<PROMPT>", "temperature": "<TEMPERATURE>", "options": {"max_tokens": "<MAX_TOKENS>"}}`
+
+	// Unset sampling placeholders are left out so the API's defaults apply
+	SetSampling(nil, nil)
+	got := replacePlaceholders(parseJSON(t, template), placeholders(prompt.Parts{User: "hi"}, false, ""), nil)
+	want := parseJSON(t, `{"prompt": "\n hi", "options": {}}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unset sampling gave %v, want %v", got, want)
+	}
+
+	// Set ones become numbers, not strings
+	temperature, maxTokens := 0.2, 256
+	SetSampling(&temperature, &maxTokens)
+	got = replacePlaceholders(parseJSON(t, template), placeholders(prompt.Parts{User: "hi"}, false, ""), nil)
+	body, _ := json.Marshal(got)
+	want = parseJSON(t, `{"prompt": "\n hi", "temperature": 0.2, "options": {"max_tokens": 256}}`)
+	if !reflect.DeepEqual(parseJSON(t, string(body)), want) {
+		t.Errorf("set sampling gave %s, want %v", body, want)
+	}
+}
@@ -0,0 +1,51 @@
+package remote
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// InsecureWarning is printed every run while insecure_skip_verify is on
+const InsecureWarning = "WARNING: insecure_skip_verify is set in the remote config, the certificate of the remote endpoint is NOT checked and anyone on the network path can read and change the traffic."
+
+// Returns the client requests are sent with. Without proxy, ca_cert_file and insecure_skip_verify it is the default
+// one, which already honors HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+func (c Config) httpClient() (*http.Client, error) {
+	api := c.ApiConfig
+	if api.Proxy == "" && api.CACertFile == "" && !api.InsecureSkipVerify {
+		return &http.Client{}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if api.Proxy != "" {
+		proxy, err := url.Parse(api.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("proxy %q isn't a URL such as http://proxy.example.com:3128", api.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: api.InsecureSkipVerify}
+	if api.CACertFile != "" {
+		pem, err := os.ReadFile(api.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca_cert_file: %w", err)
+		}
+		// The private CA is trusted on top of the system's, not instead of them
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_cert_file %s holds no PEM certificates", api.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,175 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/network"
+	"github.com/micr0-dev/lexido/pkg/prompt"
+)
+
+// ConfigError lists what is wrong with a remote config
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "the remote config is invalid: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate reports the problems that keep the config from working before any request is sent
+func (c Config) Validate() error {
+	var problems []string
+
+	if c.ApiConfig.URL == "" {
+		problems = append(problems, "url is missing")
+	} else if missing := urlVariable.FindAllString(c.URL(), -1); len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("url has %s without a value in variables", strings.Join(missing, ", ")))
+	} else if u, err := url.Parse(c.URL()); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("url %q isn't an http or https URL", c.URL()))
+	}
+
+	if c.ApiConfig.DataTemplate == nil {
+		problems = append(problems, "data_template is missing")
+	} else if !hasPrompt(c.ApiConfig.DataTemplate) {
+		problems = append(problems, "data_template has no <PROMPT> or <USER> placeholder, the prompt would never be sent")
+	}
+
+	if usesModel(c.ApiConfig.DataTemplate) && c.model() == "" {
+		problems = append(problems, "data_template has a <MODEL> placeholder but model is missing")
+	}
+
+	if c.ApiConfig.FieldOutput == "" {
+		problems = append(problems, "field_to_extract is missing, the text of the response can't be found without it")
+	}
+
+	if _, err := c.httpClient(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// A {name} placeholder of the url
+var urlVariable = regexp.MustCompile(`\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// Reports whether a string of the template carries the prompt
+func hasPrompt(data interface{}) bool {
+	return hasString(data, func(s string) bool {
+		return strings.Contains(s, "<PROMPT>") || strings.Contains(s, "<USER>")
+	})
+}
+
+func usesModel(data interface{}) bool {
+	return hasString(data, func(s string) bool { return strings.Contains(s, "<MODEL>") })
+}
+
+// Reports whether any string of the template matches
+func hasString(data interface{}, match func(string) bool) bool {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for _, value := range v {
+			if hasString(value, match) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasString(item, match) {
+				return true
+			}
+		}
+	case string:
+		return match(v)
+	}
+	return false
+}
+
+// Most of a test response that is kept
+const maxProbeBody = 64 << 10
+
+// ProbeResult is what a test request got back
+type ProbeResult struct {
+	Status    string
+	Raw       []byte // The body as it arrived, cut off at 64KB
+	Extracted string // The text field_to_extract found in it
+}
+
+// Probe sends the prompt and reads the whole response, keeping the raw body next to what was extracted from it
+func (c Config) Probe(ctx context.Context, parts prompt.Parts) (ProbeResult, error) {
+	c.ApiConfig.URL = c.URL()
+	req, err := c.newRequest(ctx, parts)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	host := network.HostOf(c.ApiConfig.URL)
+
+	client, err := c.httpClient()
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ProbeResult{}, network.Wrap(host, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	result := ProbeResult{Status: resp.Status, Raw: raw}
+	if err != nil {
+		return result, fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		_, filtered := contentFiltered(raw)
+		return result, &StatusError{Status: resp.StatusCode, Message: fmt.Sprintf("%s responded %s: %s", host, resp.Status, describeError(raw)), Filtered: filtered}
+	}
+
+	extracted, apiErr := extractAll(raw, c.ApiConfig.FieldOutput)
+	result.Extracted = extracted
+	if apiErr != "" {
+		return result, fmt.Errorf("%s reported an error: %s", host, apiErr)
+	}
+	if extracted == "" {
+		return result, fmt.Errorf("field_to_extract %q found no text in the response", c.ApiConfig.FieldOutput)
+	}
+	return result, nil
+}
+
+// Extracts the text of a complete response, streamed line by line or as a single JSON document
+func extractAll(raw []byte, field string) (text string, apiErr string) {
+	var extracted strings.Builder
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		data, done := streamData(line)
+		if done {
+			break
+		}
+		if data == nil {
+			continue
+		}
+		if message := errorMessage(data); message != "" {
+			return extracted.String(), message
+		}
+		if filterStopped(data) {
+			return extracted.String(), "the response was cut off by the content filter"
+		}
+		if value, err := ExtractOutput(data, field); err == nil {
+			extracted.WriteString(value)
+		}
+	}
+	if extracted.Len() == 0 {
+		if message := errorMessage(raw); message != "" {
+			return "", message
+		}
+		value, _ := ExtractOutput(raw, field)
+		return value, ""
+	}
+	return extracted.String(), ""
+}
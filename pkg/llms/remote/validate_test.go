@@ -0,0 +1,173 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/prompt"
+)
+
+// Parses a remoteConfig.json, failing the test when it isn't valid JSON
+func parseConfig(t *testing.T, text string) Config {
+	t.Helper()
+	var c Config
+	if err := json.Unmarshal([]byte(text), &c); err != nil {
+		t.Fatalf("parsing %s: %v", text, err)
+	}
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		problems []string // Parts of the problems reported, none for a valid config
+	}{
+		{
+			name:   "valid",
+			config: `{"api_config": {"url": "https://api.example.com/v1/chat", "data_template": {"messages": [{"role": "user", "content": "<PROMPT>"}]}, "field_to_extract": "content"}}`,
+		},
+		{
+			name:   "system and user placeholders",
+			config: `{"api_config": {"url": "http://localhost:8080/v1", "data_template": {"system": "<SYSTEM>", "prompt": "<USER>"}, "field_to_extract": "text"}}`,
+		},
+		{
+			name:     "missing url",
+			config:   `{"api_config": {"data_template": {"prompt": "<PROMPT>"}, "field_to_extract": "text"}}`,
+			problems: []string{"url is missing"},
+		},
+		{
+			name:     "url that isn't http",
+			config:   `{"api_config": {"url": "ftp://example.com", "data_template": {"prompt": "<PROMPT>"}, "field_to_extract": "text"}}`,
+			problems: []string{"isn't an http or https URL"},
+		},
+		{
+			name:     "url variable without a value",
+			config:   `{"api_config": {"url": "https://{resource}.openai.azure.com/{deployment}", "variables": {"resource": "mine"}, "data_template": {"prompt": "<PROMPT>"}, "field_to_extract": "text"}}`,
+			problems: []string{"url has {deployment} without a value"},
+		},
+		{
+			name:   "url variables filled in",
+			config: `{"api_config": {"url": "https://{resource}.openai.azure.com/", "variables": {"resource": "mine"}, "data_template": {"prompt": "<PROMPT>"}, "field_to_extract": "text"}}`,
+		},
+		{
+			name:     "missing data template",
+			config:   `{"api_config": {"url": "https://api.example.com", "field_to_extract": "text"}}`,
+			problems: []string{"data_template is missing"},
+		},
+		{
+			name:     "data template without a placeholder",
+			config:   `{"api_config": {"url": "https://api.example.com", "data_template": {"messages": [{"role": "user", "content": "hello"}]}, "field_to_extract": "text"}}`,
+			problems: []string{"no <PROMPT> or <USER> placeholder"},
+		},
+		{
+			name:     "model placeholder without a model",
+			config:   `{"api_config": {"url": "https://api.example.com", "data_template": {"model": "<MODEL>", "prompt": "<PROMPT>"}, "field_to_extract": "text"}}`,
+			problems: []string{"<MODEL> placeholder but model is missing"},
+		},
+		{
+			name:     "missing field to extract",
+			config:   `{"api_config": {"url": "https://api.example.com", "data_template": {"prompt": "<PROMPT>"}}}`,
+			problems: []string{"field_to_extract is missing"},
+		},
+		{
+			name:     "bad proxy",
+			config:   `{"api_config": {"url": "https://api.example.com", "proxy": "not a url", "data_template": {"prompt": "<PROMPT>"}, "field_to_extract": "text"}}`,
+			problems: []string{"proxy \"not a url\""},
+		},
+		{
+			name:     "everything missing",
+			config:   `{"api_config": {}}`,
+			problems: []string{"url is missing", "data_template is missing", "field_to_extract is missing"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := parseConfig(t, test.config).Validate()
+			if len(test.problems) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want no problems", err)
+				}
+				return
+			}
+
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("Validate() = %v, want a ConfigError", err)
+			}
+			if len(configErr.Problems) != len(test.problems) {
+				t.Errorf("Validate() reported %q, want %d problems", configErr.Problems, len(test.problems))
+			}
+			for _, want := range test.problems {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProbe(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"choices": [{"message": {"content": "ok"}}]}`))
+	}))
+	defer server.Close()
+
+	c := parseConfig(t, `{"api_config": {"url": "`+server.URL+`", "data_template": {"messages": [{"role": "user", "content": "<PROMPT>"}]}, "field_to_extract": "content"}}`)
+	result, err := c.Probe(context.Background(), prompt.Parts{User: "say ok"})
+	if err != nil {
+		t.Fatalf("Probe() = %v", err)
+	}
+	if result.Extracted != "ok" {
+		t.Errorf("Probe() extracted %q, want ok", result.Extracted)
+	}
+	if !strings.Contains(string(result.Raw), `"choices"`) {
+		t.Errorf("Probe() kept %q, want the raw body", result.Raw)
+	}
+	messages, _ := body["messages"].([]interface{})
+	if len(messages) != 1 || !strings.Contains(messages[0].(map[string]interface{})["content"].(string), "say ok") {
+		t.Errorf("the server got %v, want the prompt in the message", body)
+	}
+}
+
+func TestProbeWrongField(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"output": "ok"}`))
+	}))
+	defer server.Close()
+
+	c := parseConfig(t, `{"api_config": {"url": "`+server.URL+`", "data_template": {"prompt": "<PROMPT>"}, "field_to_extract": "response"}}`)
+	result, err := c.Probe(context.Background(), prompt.Parts{User: "say ok"})
+	if err == nil || !strings.Contains(err.Error(), "found no text") {
+		t.Errorf("Probe() = %v, want the field reported as finding nothing", err)
+	}
+	if string(result.Raw) != `{"output": "ok"}` {
+		t.Errorf("Probe() kept %q, want the raw body to show what the field missed", result.Raw)
+	}
+}
+
+func TestProbeErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": {"message": "invalid api key"}}`))
+	}))
+	defer server.Close()
+
+	c := parseConfig(t, `{"api_config": {"url": "`+server.URL+`", "data_template": {"prompt": "<PROMPT>"}, "field_to_extract": "response"}}`)
+	_, err := c.Probe(context.Background(), prompt.Parts{User: "say ok"})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != http.StatusUnauthorized {
+		t.Fatalf("Probe() = %v, want a StatusError with 401", err)
+	}
+	if !strings.Contains(err.Error(), "invalid api key") {
+		t.Errorf("Probe() = %v, want the message of the API", err)
+	}
+}
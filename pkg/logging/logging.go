@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log line
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelError:
+		return "ERROR"
+	case LevelWarn:
+		return "WARN"
+	case LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// The log file is rotated to <file>.1 once it grows past this size
+const MaxFileSize = 4 << 20
+
+var (
+	mu       sync.Mutex
+	level    = LevelWarn
+	path     string
+	file     *os.File
+	toStderr bool
+	secrets  []string
+)
+
+// Options configure the logger, set once at startup
+type Options struct {
+	Level Level
+	// File logs are appended to, nothing is written to disk when empty
+	File string
+	// Stderr mirrors log lines to stderr, only safe while no TUI is drawing on the terminal
+	Stderr bool
+}
+
+// Setup applies the options, the log file is only created once something is logged
+func Setup(opts Options) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if file != nil {
+		file.Close()
+		file = nil
+	}
+	level = opts.Level
+	path = opts.File
+	toStderr = opts.Stderr
+}
+
+// SetStderr turns mirroring to stderr on or off, e.g. while the TUI owns the terminal
+func SetStderr(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	toStderr = enabled
+}
+
+// Enabled reports whether lines of the given level are logged
+func Enabled(l Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return l <= level
+}
+
+// AddSecret registers a value that must never show up in the log, such as an API key
+func AddSecret(secret string) {
+	if len(secret) < 4 {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	secrets = append(secrets, secret)
+}
+
+// Patterns of secrets that are redacted even if they were never registered
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(authorization|x-api-key|api-key|x-goog-api-key)(["']?\s*[:=]\s*["'\[]?)(bearer\s+|basic\s+)?[^\s"',}\]]+`),
+	regexp.MustCompile(`(?i)([?&](?:key|api_key|access_token|token)=)[^&\s"']+`),
+	regexp.MustCompile(`AIza[0-9A-Za-z_\-]{35}`),
+	regexp.MustCompile(`\bsk-[0-9A-Za-z_\-]{16,}`),
+	regexp.MustCompile(`\bgsk_[0-9A-Za-z]{16,}`),
+}
+
+// Redact replaces registered secrets and anything that looks like a key or an Authorization header
+func Redact(text string) string {
+	mu.Lock()
+	known := secrets
+	mu.Unlock()
+
+	for _, secret := range known {
+		text = strings.ReplaceAll(text, secret, "[REDACTED]")
+	}
+	for i, pattern := range secretPatterns {
+		switch i {
+		case 0:
+			text = pattern.ReplaceAllString(text, "${1}${2}${3}[REDACTED]")
+		case 1:
+			text = pattern.ReplaceAllString(text, "${1}[REDACTED]")
+		default:
+			text = pattern.ReplaceAllString(text, "[REDACTED]")
+		}
+	}
+	return text
+}
+
+// Headers whose values are credentials
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "X-Api-Key", "Api-Key", "X-Goog-Api-Key", "Cookie"}
+
+// RedactHeaders returns a copy of the headers that is safe to log
+func RedactHeaders(headers http.Header) http.Header {
+	redacted := headers.Clone()
+	for _, name := range sensitiveHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "[REDACTED]")
+		}
+	}
+	return redacted
+}
+
+// Opens the log file, rotating it first when it has grown too big. The caller holds mu.
+func openFile() error {
+	if file != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() > MaxFileSize {
+		os.Rename(path, path+".1")
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	file = f
+	return nil
+}
+
+func logf(l Level, format string, args ...any) {
+	if !Enabled(l) {
+		return
+	}
+	msg := Redact(fmt.Sprintf(format, args...))
+	line := fmt.Sprintf("%s %-5s %s\n", time.Now().Format("2006-01-02 15:04:05.000"), l, strings.TrimRight(msg, "\n"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if path != "" {
+		if err := openFile(); err == nil {
+			file.WriteString(line)
+			if info, err := file.Stat(); err == nil && info.Size() > MaxFileSize {
+				// Rotated when the file is opened for the next write
+				file.Close()
+				file = nil
+			}
+		}
+	}
+	if toStderr {
+		fmt.Fprint(os.Stderr, line)
+	}
+}
+
+func Errorf(format string, args ...any) { logf(LevelError, format, args...) }
+func Warnf(format string, args ...any)  { logf(LevelWarn, format, args...) }
+func Infof(format string, args ...any)  { logf(LevelInfo, format, args...) }
+func Debugf(format string, args ...any) { logf(LevelDebug, format, args...) }
+
+// Close flushes and closes the log file
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if file == nil {
+		return nil
+	}
+	err := file.Close()
+	file = nil
+	return err
+}
@@ -0,0 +1,106 @@
+package nag
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+const ledgerFile = "nag_ledger.json"
+
+// How long a warning stays demoted after it was shown in full, unless it sets its own cool-down
+const DefaultCooldown = 24 * time.Hour
+
+// ShowAll disables demotion entirely, set by --show-all-warnings
+var ShowAll bool
+
+// Warning is a message lexido may show on every run, identified by a stable code
+type Warning struct {
+	Code     string
+	Message  string
+	Critical bool          // Safety and data-loss warnings are never demoted
+	Cooldown time.Duration // Zero means DefaultCooldown
+}
+
+// Ledger records when each warning was last shown in full
+type Ledger struct {
+	Shown map[string]time.Time `json:"shown"`
+
+	path    string
+	scope   string
+	demoted []Warning
+	changed bool
+}
+
+// Opens the ledger from the state directory, a missing or broken ledger starts out empty
+func Open() *Ledger {
+	l := &Ledger{Shown: make(map[string]time.Time), scope: scope()}
+
+	path, err := io.GetFilePath(io.State, ledgerFile)
+	if err != nil {
+		return l
+	}
+	l.path = path
+
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, l)
+		if l.Shown == nil {
+			l.Shown = make(map[string]time.Time)
+		}
+	}
+	return l
+}
+
+// Entries are scoped per user so accounts sharing a home directory (e.g. via sudo) see their own first-time warnings
+func scope() string {
+	u, err := user.Current()
+	if err != nil {
+		return "default"
+	}
+	return u.Username
+}
+
+// Check reports whether the warning should be shown in full now, recording it either way.
+// Warnings that are still cooling down are kept as demoted instead.
+func (l *Ledger) Check(w Warning, now time.Time) bool {
+	key := l.scope + "/" + w.Code
+	cooldown := w.Cooldown
+	if cooldown == 0 {
+		cooldown = DefaultCooldown
+	}
+
+	last, seen := l.Shown[key]
+	if ShowAll || w.Critical || !seen || now.Sub(last) >= cooldown {
+		l.Shown[key] = now
+		l.changed = true
+		return true
+	}
+
+	l.demoted = append(l.demoted, w)
+	return false
+}
+
+// Returns the warnings demoted during this run
+func (l *Ledger) Demoted() []Warning {
+	return l.demoted
+}
+
+// Writes the ledger back to the state directory if anything changed
+func (l *Ledger) Save() error {
+	if !l.changed || l.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(l, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(l.path, data, 0600)
+}
@@ -0,0 +1,123 @@
+package nag
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Points the state directory at a temporary one, so the ledger of the test is its own
+func isolate(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+}
+
+func TestCooldown(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	update := Warning{Code: "update", Message: "lexido 2.0 is available"}
+	hourly := Warning{Code: "readonly_cache", Message: "the cache directory is read-only", Cooldown: time.Hour}
+
+	tests := []struct {
+		name    string
+		warning Warning
+		after   time.Duration // Since the first time it was shown
+		full    bool
+	}{
+		{"first time", update, 0, true},
+		{"right after", update, time.Minute, false},
+		{"just before the default cool-down", update, DefaultCooldown - time.Second, false},
+		{"once the default cool-down passed", update, DefaultCooldown, true},
+		{"own cool-down, before it", hourly, 59 * time.Minute, false},
+		{"own cool-down, after it", hourly, time.Hour, true},
+		{"clock set back", update, -time.Hour, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &Ledger{Shown: map[string]time.Time{}, scope: "me"}
+			if test.after != 0 {
+				l.Check(test.warning, start)
+			}
+			if got := l.Check(test.warning, start.Add(test.after)); got != test.full {
+				t.Errorf("Check() after %s = %v, want %v", test.after, got, test.full)
+			}
+			if demoted := len(l.Demoted()) == 1; demoted == test.full {
+				t.Errorf("demoted %v, want it demoted only when it isn't shown", l.Demoted())
+			}
+		})
+	}
+}
+
+func TestCooldownRestartsWhenShown(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	w := Warning{Code: "redaction", Cooldown: time.Hour}
+	l := &Ledger{Shown: map[string]time.Time{}, scope: "me"}
+
+	l.Check(w, start)
+	// A demoted repeat doesn't push the cool-down out
+	l.Check(w, start.Add(50*time.Minute))
+	if !l.Check(w, start.Add(time.Hour)) {
+		t.Fatal("the warning wasn't shown once its cool-down passed")
+	}
+	if l.Check(w, start.Add(90*time.Minute)) {
+		t.Error("the warning was shown again before its new cool-down passed")
+	}
+}
+
+func TestCriticalAndShowAll(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := &Ledger{Shown: map[string]time.Time{}, scope: "me"}
+
+	critical := Warning{Code: "sudo", Critical: true}
+	for i := 0; i < 3; i++ {
+		if !l.Check(critical, now) {
+			t.Fatal("a critical warning was demoted")
+		}
+	}
+
+	plain := Warning{Code: "update"}
+	l.Check(plain, now)
+	ShowAll = true
+	defer func() { ShowAll = false }()
+	if !l.Check(plain, now) {
+		t.Error("--show-all-warnings didn't show a repeat")
+	}
+	if len(l.Demoted()) != 0 {
+		t.Errorf("demoted %v, want none", l.Demoted())
+	}
+}
+
+func TestScopes(t *testing.T) {
+	// Another account on the same machine gets its own first-time warnings
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	w := Warning{Code: "update"}
+	shown := map[string]time.Time{}
+	(&Ledger{Shown: shown, scope: "alice"}).Check(w, now)
+
+	if !(&Ledger{Shown: shown, scope: "bob"}).Check(w, now.Add(time.Minute)) {
+		t.Error("a warning shown to one account was demoted for another")
+	}
+	if (&Ledger{Shown: shown, scope: "alice"}).Check(w, now.Add(2*time.Minute)) {
+		t.Error("the repeat of the first account wasn't demoted")
+	}
+}
+
+func TestLedgerAcrossRuns(t *testing.T) {
+	isolate(t)
+	now := time.Now()
+	w := Warning{Code: "update"}
+
+	first := Open()
+	if !first.Check(w, now) {
+		t.Fatal("the first warning wasn't shown")
+	}
+	if err := first.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next run reads what the first one saved
+	if Open().Check(w, now.Add(time.Minute)) {
+		t.Error("the warning of the previous run was shown in full again")
+	}
+}
@@ -0,0 +1,168 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+)
+
+// FailureKind describes why a connection to a provider could not be made
+type FailureKind int
+
+const (
+	Unknown FailureKind = iota
+	DNS
+	Refused
+	Unreachable
+	Timeout
+	TLS
+)
+
+func (k FailureKind) String() string {
+	switch k {
+	case DNS:
+		return "dns"
+	case Refused:
+		return "connection refused"
+	case Unreachable:
+		return "host unreachable"
+	case Timeout:
+		return "timeout"
+	case TLS:
+		return "tls"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is a connection failure with the host it happened on and its classification
+type Error struct {
+	Kind FailureKind
+	Host string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	switch e.Kind {
+	case DNS:
+		return fmt.Sprintf("could not resolve %s — check the hostname and your DNS or network connection", e.Host)
+	case Refused:
+		return fmt.Sprintf("connection to %s refused — the host is reachable but nothing is listening, is the service running?", e.Host)
+	case Unreachable:
+		return fmt.Sprintf("host %s unreachable — are you on the right network?", e.Host)
+	case Timeout:
+		return fmt.Sprintf("timed out connecting to %s — host unreachable, are you on the right network?", e.Host)
+	case TLS:
+		return fmt.Sprintf("TLS handshake with %s failed — check the certificate or whether the endpoint expects http instead of https: %v", e.Host, e.Err)
+	default:
+		return fmt.Sprintf("could not connect to %s: %v", e.Host, e.Err)
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify inspects a dial or HTTP error and reports which kind of failure it is
+func Classify(err error) FailureKind {
+	if err == nil {
+		return Unknown
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return Timeout
+		}
+		return DNS
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return Refused
+	}
+	if errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) {
+		return Unreachable
+	}
+
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &recordErr) || errors.As(err, &verifyErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return TLS
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return Timeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return Timeout
+	}
+
+	return Unknown
+}
+
+// Wrap classifies a connection error, leaving errors that aren't network related untouched
+func Wrap(host string, err error) error {
+	if err == nil {
+		return nil
+	}
+	kind := Classify(err)
+	if kind == Unknown {
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) {
+			return err
+		}
+	}
+	return &Error{Kind: kind, Host: host, Err: err}
+}
+
+// Reports whether a stream was cut off by the other side, so restarting the request may succeed
+func IsReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Probe dials the given host:port and returns a classified error if it can't be reached in time
+func Probe(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return Wrap(address, err)
+	}
+	return conn.Close()
+}
+
+// AddressOf returns the host:port a URL connects to, the port following from the scheme when it has none
+func AddressOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "443"
+	if u.Scheme == "http" {
+		port = "80"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// HostOf returns the host part of a URL for use in error messages, or the input when it isn't a URL
+func HostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
@@ -0,0 +1,153 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Errors a dialer returns for each kind of failure, as net.Dial wraps them
+func dialErrors() map[string]struct {
+	err  error
+	kind FailureKind
+} {
+	dial := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: err}}
+	}
+	return map[string]struct {
+		err  error
+		kind FailureKind
+	}{
+		"no such host":     {&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "desktop.lan", IsNotFound: true}}, DNS},
+		"dns timeout":      {&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "i/o timeout", Name: "desktop.lan", IsTimeout: true}}, Timeout},
+		"refused":          {dial(syscall.ECONNREFUSED), Refused},
+		"host unreachable": {dial(syscall.EHOSTUNREACH), Unreachable},
+		"no route":         {dial(syscall.ENETUNREACH), Unreachable},
+		"dial timeout":     {&net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, Timeout},
+		"context deadline": {context.DeadlineExceeded, Timeout},
+		"not tls":          {tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, TLS},
+		"unknown ca":       {&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, TLS},
+		"wrong hostname":   {x509.HostnameError{Certificate: &x509.Certificate{}, Host: "desktop.lan"}, TLS},
+		"expired":          {x509.CertificateInvalidError{Reason: x509.Expired}, TLS},
+		"other dial error": {dial(syscall.EACCES), Unknown},
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for name, test := range dialErrors() {
+		if got := Classify(test.err); got != test.kind {
+			t.Errorf("%s: Classify(%v) = %s, want %s", name, test.err, got, test.kind)
+		}
+	}
+	if got := Classify(nil); got != Unknown {
+		t.Errorf("Classify(nil) = %s, want unknown", got)
+	}
+}
+
+// The errors come out of an HTTP request the way the ollama and remote clients see them
+func TestWrapThroughHTTPClient(t *testing.T) {
+	for name, test := range dialErrors() {
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return nil, test.err
+			},
+		}}
+		_, err := client.Get("http://desktop.lan:11434/api/tags")
+		if err == nil {
+			t.Fatalf("%s: the request succeeded", name)
+		}
+
+		wrapped := Wrap("desktop.lan:11434", err)
+		var netErr *Error
+		if !errors.As(wrapped, &netErr) {
+			t.Errorf("%s: Wrap() = %v, want a *Error", name, wrapped)
+			continue
+		}
+		if netErr.Kind != test.kind {
+			t.Errorf("%s: Wrap() kind = %s, want %s", name, netErr.Kind, test.kind)
+		}
+		if !strings.Contains(wrapped.Error(), "desktop.lan:11434") {
+			t.Errorf("%s: %q doesn't name the host", name, wrapped)
+		}
+		if !errors.Is(wrapped, test.err) {
+			t.Errorf("%s: Wrap() doesn't unwrap to the dial error", name)
+		}
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	for kind, want := range map[FailureKind]string{
+		DNS:         "could not resolve desktop.lan",
+		Refused:     "is the service running?",
+		Unreachable: "are you on the right network?",
+		Timeout:     "timed out connecting to desktop.lan",
+		TLS:         "expects http instead of https",
+		Unknown:     "could not connect to desktop.lan",
+	} {
+		err := &Error{Kind: kind, Host: "desktop.lan", Err: errors.New("cause")}
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: %q, want it to contain %q", kind, err, want)
+		}
+	}
+}
+
+func TestWrapLeavesOtherErrors(t *testing.T) {
+	if Wrap("host", nil) != nil {
+		t.Error("Wrap(nil) isn't nil")
+	}
+	other := errors.New("model not found")
+	if got := Wrap("host", other); got != other {
+		t.Errorf("Wrap() = %v, want an error that isn't network related left alone", got)
+	}
+}
+
+func TestProbeRefused(t *testing.T) {
+	// A port that was just free, nothing listens on it anymore
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	address := l.Addr().String()
+	if err := Probe(address, time.Second); err != nil {
+		t.Fatalf("Probe() with a listener = %v", err)
+	}
+	l.Close()
+
+	var netErr *Error
+	if err := Probe(address, time.Second); !errors.As(err, &netErr) || netErr.Kind != Refused {
+		t.Errorf("Probe() = %v, want the connection refused", err)
+	}
+}
+
+func TestIsReset(t *testing.T) {
+	if !IsReset(&net.OpError{Op: "read", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}) {
+		t.Error("a reset connection isn't reported as reset")
+	}
+	if IsReset(syscall.ECONNREFUSED) {
+		t.Error("a refused connection is reported as reset")
+	}
+}
+
+func TestAddressOf(t *testing.T) {
+	for in, want := range map[string]string{
+		"https://api.openai.com/v1/chat": "api.openai.com:443",
+		"http://localhost/api":           "localhost:80",
+		"http://10.0.0.5:8080/v1":        "10.0.0.5:8080",
+		"not a url":                      "",
+	} {
+		if got := AddressOf(in); got != want {
+			t.Errorf("AddressOf(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := HostOf("https://api.openai.com:8443/v1"); got != "api.openai.com:8443" {
+		t.Errorf("HostOf() = %q", got)
+	}
+}
@@ -0,0 +1,240 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/format"
+)
+
+var ErrNoDiff = errors.New("the response is not a unified diff")
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Hunk is one @@ section of a diff, its lines keep their ' ', '-' or '+' prefix
+type Hunk struct {
+	OldStart int
+	NewStart int
+	Lines    []string
+}
+
+// Diff is a unified diff of a single file
+type Diff struct {
+	OldName string
+	NewName string
+	Hunks   []Hunk
+}
+
+// Returns the diff in a response, without the code fence or text around it a model may have added
+func Extract(response string) string {
+	if start := strings.Index(response, "```"); start >= 0 {
+		body := response[start+3:]
+		// The language of the fence, e.g. ```diff
+		if newline := strings.IndexByte(body, '\n'); newline >= 0 {
+			body = body[newline+1:]
+		}
+		if end := strings.Index(body, "```"); end >= 0 {
+			body = body[:end]
+		}
+		return body
+	}
+	return response
+}
+
+// Parse reads a unified diff of one file. The line counts of the hunk headers are not trusted, models often get
+// them wrong, the lines of each hunk are what is applied.
+func Parse(text string) (*Diff, error) {
+	lines := strings.Split(strings.ReplaceAll(Extract(text), "\r\n", "\n"), "\n")
+	d := &Diff{}
+	i := 0
+	for ; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			d.OldName = fileName(lines[i])
+			d.NewName = fileName(lines[i+1])
+			i += 2
+			break
+		}
+	}
+	if d.NewName == "" {
+		return nil, fmt.Errorf("%w: it has no --- and +++ lines", ErrNoDiff)
+	}
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if match := hunkHeader.FindStringSubmatch(line); match != nil {
+			oldStart, _ := strconv.Atoi(match[1])
+			newStart, _ := strconv.Atoi(match[3])
+			d.Hunks = append(d.Hunks, Hunk{OldStart: oldStart, NewStart: newStart})
+			continue
+		}
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			return nil, fmt.Errorf("%w of one file, it changes several", ErrNoDiff)
+		}
+		if len(d.Hunks) == 0 {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			return nil, fmt.Errorf("%w: line %q is outside of a hunk", ErrNoDiff, line)
+		}
+		hunk := &d.Hunks[len(d.Hunks)-1]
+		switch {
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file", the file keeps the end it has
+		case line == "":
+			// An empty line of context whose space was lost
+			hunk.Lines = append(hunk.Lines, " ")
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			hunk.Lines = append(hunk.Lines, line)
+		default:
+			return nil, fmt.Errorf("%w: line %q of a hunk starts with neither a space, - nor +", ErrNoDiff, line)
+		}
+	}
+
+	// Trailing empty lines of the response aren't context
+	for h := range d.Hunks {
+		hunk := &d.Hunks[h]
+		for len(hunk.Lines) > 0 && hunk.Lines[len(hunk.Lines)-1] == " " {
+			hunk.Lines = hunk.Lines[:len(hunk.Lines)-1]
+		}
+	}
+	if len(d.Hunks) == 0 {
+		return nil, fmt.Errorf("%w: it has no @@ hunks", ErrNoDiff)
+	}
+	for _, hunk := range d.Hunks {
+		if !hunk.changes() {
+			return nil, fmt.Errorf("%w: a hunk changes nothing", ErrNoDiff)
+		}
+	}
+	return d, nil
+}
+
+// Returns the name of a --- or +++ line without its a/ or b/ prefix and the timestamp some tools add
+func fileName(line string) string {
+	name := strings.TrimSpace(line[4:])
+	if tab := strings.IndexByte(name, '\t'); tab >= 0 {
+		name = name[:tab]
+	}
+	if strings.HasPrefix(name, "a/") || strings.HasPrefix(name, "b/") {
+		name = name[2:]
+	}
+	return name
+}
+
+func (h Hunk) changes() bool {
+	for _, line := range h.Lines {
+		if line[0] != ' ' {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the lines the hunk expects in the file and the lines it leaves there
+func (h Hunk) sides() (old []string, new []string) {
+	for _, line := range h.Lines {
+		switch line[0] {
+		case ' ':
+			old = append(old, line[1:])
+			new = append(new, line[1:])
+		case '-':
+			old = append(old, line[1:])
+		case '+':
+			new = append(new, line[1:])
+		}
+	}
+	return old, new
+}
+
+// Apply returns the content with the diff applied. Each hunk is looked for nearest to the line its header names,
+// so hunks whose line numbers are off still apply, a hunk whose lines aren't in the content fails.
+func (d *Diff) Apply(content string) (string, error) {
+	trailingNewline := strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	from := 0   // Hunks apply in order, each one after the previous
+	offset := 0 // Lines added minus lines removed by the hunks so far
+	for n, hunk := range d.Hunks {
+		old, new := hunk.sides()
+		at := find(lines, old, from, hunk.OldStart-1+offset)
+		if at < 0 {
+			return "", fmt.Errorf("hunk %d doesn't match the file around line %d", n+1, hunk.OldStart)
+		}
+		lines = append(lines[:at], append(append([]string{}, new...), lines[at+len(old):]...)...)
+		from = at + len(new)
+		offset += len(new) - len(old)
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline || content == "" {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// Returns where old starts in lines at or after from, the match closest to near, or -1. Lines that only differ
+// in trailing whitespace match when nothing matches exactly.
+func find(lines []string, old []string, from int, near int) int {
+	if len(old) == 0 {
+		return min(max(near, from), len(lines))
+	}
+	for _, compare := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+	} {
+		best := -1
+		for at := from; at+len(old) <= len(lines); at++ {
+			if matches(lines[at:at+len(old)], old, compare) && (best < 0 || abs(at-near) < abs(best-near)) {
+				best = at
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	return -1
+}
+
+func matches(lines []string, old []string, compare func(a, b string) bool) bool {
+	for i := range old {
+		if !compare(lines[i], old[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Highlight colors the lines of a diff, removed lines like errors, added ones like picked commands
+// and hunk headers like commands
+func Highlight(diff string) string {
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		var role format.Role
+		switch {
+		case strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- "):
+			role = format.Header
+		case strings.HasPrefix(line, "@@"):
+			role = format.Command
+		case strings.HasPrefix(line, "+"):
+			role = format.Selected
+		case strings.HasPrefix(line, "-"):
+			role = format.Error
+		default:
+			continue
+		}
+		lines[i] = format.Code(role) + line + format.Reset + format.Code(format.Response)
+	}
+	return strings.Join(lines, "\n")
+}
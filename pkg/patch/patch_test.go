@@ -0,0 +1,128 @@
+package patch
+
+import (
+	"errors"
+	"testing"
+)
+
+const config = `listen 80
+server_name example.com
+root /var/www
+index index.html
+access_log /var/log/access.log
+error_log /var/log/error.log
+gzip on
+`
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		diff    string
+		want    string
+	}{
+		{
+			"multiple hunks",
+			config,
+			"--- a/site.conf\n+++ b/site.conf\n" +
+				"@@ -1,2 +1,2 @@\n-listen 80\n+listen 443\n server_name example.com\n" +
+				"@@ -6,2 +6,3 @@\n error_log /var/log/error.log\n+gzip_types text/css\n gzip on\n",
+			"listen 443\nserver_name example.com\nroot /var/www\nindex index.html\naccess_log /var/log/access.log\n" +
+				"error_log /var/log/error.log\ngzip_types text/css\ngzip on\n",
+		},
+		{
+			// Models often count the lines wrong, the context is what places the hunk
+			"offset line numbers",
+			config,
+			"--- site.conf\n+++ site.conf\n@@ -12,3 +12,3 @@\n root /var/www\n-index index.html\n+index index.php\n access_log /var/log/access.log\n",
+			"listen 80\nserver_name example.com\nroot /var/www\nindex index.php\naccess_log /var/log/access.log\n" +
+				"error_log /var/log/error.log\ngzip on\n",
+		},
+		{
+			"context with trailing whitespace",
+			config,
+			"--- site.conf\n+++ site.conf\n@@ -7 +7 @@\n-gzip on  \n+gzip off\n",
+			"listen 80\nserver_name example.com\nroot /var/www\nindex index.html\naccess_log /var/log/access.log\n" +
+				"error_log /var/log/error.log\ngzip off\n",
+		},
+		{
+			"no newline at end of file",
+			"PORT=80\nHOST=localhost",
+			"--- .env\n+++ .env\n@@ -1,2 +1,2 @@\n PORT=80\n-HOST=localhost\n\\ No newline at end of file\n+HOST=0.0.0.0\n\\ No newline at end of file\n",
+			"PORT=80\nHOST=0.0.0.0",
+		},
+		{
+			"fenced in a response",
+			"a\nb\n",
+			"Change b:\n```diff\n--- f\n+++ f\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n```\nThat's it.",
+			"a\nc\n",
+		},
+		{
+			"new file",
+			"",
+			"--- /dev/null\n+++ b/notes.txt\n@@ -0,0 +1,2 @@\n+first\n+second\n",
+			"first\nsecond\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := Parse(test.diff)
+			if err != nil {
+				t.Fatalf("Parse() = %v", err)
+			}
+			got, err := d.Apply(test.content)
+			if err != nil {
+				t.Fatalf("Apply() = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Apply() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// A hunk that isn't in the file fails the whole diff, none of the hunks before it are kept
+func TestApplyRefusesMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+	}{
+		{"only hunk", "--- f\n+++ f\n@@ -1 +1 @@\n-listen 8080\n+listen 443\n"},
+		{"second hunk", "--- f\n+++ f\n@@ -1 +1 @@\n-listen 80\n+listen 443\n@@ -7 +7 @@\n-gzip off\n+gzip on\n"},
+		{"hunks out of order", "--- f\n+++ f\n@@ -7 +7 @@\n-gzip on\n+gzip off\n@@ -1 +1 @@\n-listen 80\n+listen 443\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := Parse(test.diff)
+			if err != nil {
+				t.Fatalf("Parse() = %v", err)
+			}
+			if got, err := d.Apply(config); err == nil || got != "" {
+				t.Errorf("Apply() = %q, %v, want an error and nothing applied", got, err)
+			}
+		})
+	}
+}
+
+// Responses that aren't one file's diff are never offered to apply
+func TestParseRejectsNonDiffs(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{"prose", "Set listen to 443 and restart nginx with @run[sudo systemctl restart nginx]."},
+		{"code without a diff", "```nginx\nlisten 443;\n```"},
+		{"headers without hunks", "--- a/site.conf\n+++ b/site.conf\n"},
+		{"text inside a hunk", "--- f\n+++ f\n@@ -1 +1 @@\n-listen 80\nthen restart it\n"},
+		{"hunk that changes nothing", "--- f\n+++ f\n@@ -1 +1 @@\n listen 80\n"},
+		{"several files", "--- a\n+++ a\n@@ -1 +1 @@\n-x\n+y\n--- b\n+++ b\n@@ -1 +1 @@\n-x\n+y\n"},
+		{"empty", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if d, err := Parse(test.response); !errors.Is(err, ErrNoDiff) {
+				t.Errorf("Parse() = %+v, %v, want ErrNoDiff", d, err)
+			}
+		})
+	}
+}
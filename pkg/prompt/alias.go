@@ -0,0 +1,15 @@
+package prompt
+
+const aliasPrePrompt = "You are lexido, writing a reusable shell alias or function for what the user describes, to be pasted into their rc file. Answer with the definition only, no explanations, no @run commands, no markdown and no code fences. Use an alias for a fixed command and a function when it takes arguments or needs several steps. Give it a short lowercase name that doesn't shadow a common command, and define a single alias or function."
+
+// Syntax each shell expects, fish has no name() { } functions
+var aliasSyntax = map[string]string{
+	"bash": " Write it for bash: alias name='...' or name() { ...; } using \"$@\" and \"$1\" for the arguments.",
+	"zsh":  " Write it for zsh: alias name='...' or name() { ...; } using \"$@\" and \"$1\" for the arguments.",
+	"fish": " Write it for fish: alias name '...' or function name ... end using $argv for the arguments, no bash syntax.",
+}
+
+// Returns the pre-prompt used by `lexido alias` for the given shell
+func AliasPrePrompt(shell string, operatingSystem string) string {
+	return aliasPrePrompt + aliasSyntax[shell] + " The user runs " + operatingSystem + "."
+}
@@ -0,0 +1,70 @@
+package prompt
+
+import (
+	"unicode/utf8"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// Number of most recent turns that are kept even when they don't fit the budget
+const DefaultKeepTurns = 2
+
+// Approximate context windows in tokens of the default models per mode
+var contextWindows = map[string]int{
+	"gemini": 30720, // gemini-pro
+	"local":  2048,  // ollama's default num_ctx
+	"remote": 8192,
+}
+
+// Context windows of models that differ from the one of their mode
+var modelContextWindows = map[string]int{
+	"gemini-1.5-flash": 1048576,
+	"gemini-1.5-pro":   2097152,
+}
+
+// Returns the context window assumed for a mode and model when none is configured
+func ContextWindow(mode string, model string) int {
+	if n, ok := modelContextWindows[model]; ok {
+		return n
+	}
+	if n, ok := contextWindows[mode]; ok {
+		return n
+	}
+	return 4096
+}
+
+// Rough token estimate, about four characters per token for English text and code
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// Tokens an image is estimated at, what Gemini counts for one
+const ImageTokens = 258
+
+// Returns how many tokens the conversation history may use, leaving a quarter of the window for the response
+func HistoryBudget(contextWindow int, rest string) int {
+	return contextWindow - contextWindow/4 - EstimateTokens(rest)
+}
+
+// TrimConversation drops the oldest turns until the conversation fits the token budget,
+// always keeping the most recent keep turns. It returns the trimmed conversation and how many turns were dropped.
+func TrimConversation(conversation string, budget int, keep int) (string, int) {
+	if EstimateTokens(conversation) <= budget {
+		return conversation, 0
+	}
+
+	turns := io.ParseConversation(conversation)
+	total := 0
+	for _, turn := range turns {
+		total += EstimateTokens(turn.Content)
+	}
+
+	dropped := 0
+	for len(turns) > keep && total > budget {
+		total -= EstimateTokens(turns[0].Content)
+		turns = turns[1:]
+		dropped++
+	}
+
+	return io.RenderConversation(turns), dropped
+}
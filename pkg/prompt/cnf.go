@@ -0,0 +1,19 @@
+package prompt
+
+import "strings"
+
+const commandNotFoundPrePrompt = "You are lexido, helping a " + Platform + " user whose shell could not find a command. Answer with a single line and nothing else: the command that installs the package providing it with one of the user's package managers, such as sudo apt install ripgrep. No explanations, no @run commands, no markdown and no code fences. If the name is most likely a typo of a well known command, answer with: did you mean <command>? If you don't know, answer with an empty line."
+
+// Returns the pre-prompt of the command-not-found handler, kept short so the answer comes back quickly
+func CommandNotFoundPrePrompt(operatingSystem string, packageManagers []string) string {
+	pre_prompt := commandNotFoundPrePrompt + " The user runs " + operatingSystem + "."
+	if len(packageManagers) > 0 {
+		pre_prompt += " Their package managers are: " + strings.Join(packageManagers, ", ") + "."
+	}
+	return pre_prompt
+}
+
+// BuildCommandNotFoundPrompt asks which package provides the command the shell couldn't find
+func BuildCommandNotFoundPrompt(name string) string {
+	return "command not found: " + name
+}
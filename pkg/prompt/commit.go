@@ -0,0 +1,29 @@
+package prompt
+
+import "strings"
+
+const commitPrePrompt = "You are lexido, writing a git commit message for the staged changes below. Answer with the commit message only, no explanations, no @run commands, no markdown and no code fences. Start with a summary line of at most 72 characters in the imperative mood, then a blank line and a short body explaining what changed and why, wrapped at 72 characters. Leave the body out when the summary says it all."
+
+const conventionalInstruction = " The summary line must follow the Conventional Commits format: type(optional scope): description, where type is one of feat, fix, docs, style, refactor, perf, test, build, ci, chore or revert, and breaking changes are marked with ! and a BREAKING CHANGE: footer."
+
+// Returns the pre-prompt used by `lexido commit`
+func CommitPrePrompt(conventional bool) string {
+	if conventional {
+		return commitPrePrompt + conventionalInstruction
+	}
+	return commitPrePrompt
+}
+
+// BuildCommitPrompt assembles the request for a commit message from the staged diff,
+// the message being amended (if any) and extra instructions from the user
+func BuildCommitPrompt(diff string, previous string, extra string) string {
+	var s strings.Builder
+	if extra = strings.TrimSpace(extra); extra != "" {
+		s.WriteString(extra + "\n\n")
+	}
+	if previous = strings.TrimSpace(previous); previous != "" {
+		s.WriteString("The commit is being amended, its current message is:\n" + previous + "\n\nUpdate it to cover the changes below.\n\n")
+	}
+	s.WriteString("Staged diff:\n" + diff)
+	return s.String()
+}
@@ -0,0 +1,13 @@
+package prompt
+
+const editPrePrompt = "You are lexido, changing a file the way the user asks. Answer with a unified diff of the file only, no explanations, no @run commands, no markdown and no code fences. Start with the lines --- a/<file> and +++ b/<file>, followed by hunks with headers like @@ -12,7 +12,9 @@ whose line numbers and counts are exact. Give every hunk three unchanged lines of context before and after the change, start unchanged lines with a space, removed lines with - and added lines with +, and copy the lines of the file exactly, including their indentation. Change only what the user asked for."
+
+// Returns the pre-prompt used by `lexido edit`
+func EditPrePrompt() string {
+	return editPrePrompt
+}
+
+// BuildEditPrompt asks for the change to the file with the given name and content
+func BuildEditPrompt(name string, content string, instructions string) string {
+	return "Change " + name + ": " + instructions + "\n\nThe file " + name + ":\n" + content
+}
@@ -0,0 +1,30 @@
+package prompt
+
+import (
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// Describes WSL, containers, SSH sessions and an init system other than systemd in one line, nothing for a plain machine
+func EnvironmentContext(env io.Environment) string {
+	var where []string
+	if env.WSL {
+		where = append(where, "inside WSL on Windows")
+	}
+	if env.Container != "" {
+		where = append(where, "inside a "+env.Container+" container, where sudo may be missing and the userland is minimal")
+	}
+	if env.SSH {
+		where = append(where, "on a remote host the user reached over SSH")
+	}
+
+	s := ""
+	if len(where) > 0 {
+		s = " The shell runs " + strings.Join(where, ", ") + "."
+	}
+	if env.Init != "" && env.Init != "systemd" {
+		s += " PID 1 is " + env.Init + ", not systemd, so systemctl and journalctl won't work."
+	}
+	return s
+}
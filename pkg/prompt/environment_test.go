@@ -0,0 +1,21 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+func TestEnvironmentContext(t *testing.T) {
+	if got := EnvironmentContext(io.Environment{Init: "systemd"}); got != "" {
+		t.Errorf("EnvironmentContext() of a plain machine = %q, want nothing", got)
+	}
+
+	got := EnvironmentContext(io.Environment{WSL: true, Container: "docker", SSH: true, Init: "tini"})
+	for _, want := range []string{"inside WSL", "inside a docker container", "over SSH", "PID 1 is tini"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("EnvironmentContext() = %q, want it to mention %q", got, want)
+		}
+	}
+}
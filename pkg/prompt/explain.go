@@ -0,0 +1,9 @@
+package prompt
+
+// Pre-prompt of the explanation asked for when a suggested command is explained in the TUI
+const ExplainPrePrompt = "You are lexido, explaining a command of the " + Platform + " command line to the user, who is about to run it in " + Shell + ". In at most three short sentences, say what the command does and what its flags and arguments mean. Answer in plain text, no @run commands, no markdown and no code fences."
+
+// Returns the prompt asking what the command does
+func ExplainPrompt(command string) Parts {
+	return Parts{System: ExplainPrePrompt, User: "Explain this command: " + command}
+}
@@ -0,0 +1,46 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+)
+
+// Added to the pre-prompt in --fix-loop, where suggestions are run and failures come back automatically
+const FixLoopInstruction = " You are in a loop working towards the user's goal: your suggested commands are run, and if one fails its exit code and output are sent back to you. Suggest the single next step as one @run command, and when you are told a command failed, try something different instead of repeating it."
+
+// FixFeedback describes the results of an iteration so the model can suggest the next step
+func FixFeedback(results []commands.Result) string {
+	var s strings.Builder
+	for _, r := range results {
+		if r.ExitCode == 0 {
+			fmt.Fprintf(&s, "I ran `%s`, it succeeded.\n", r.Command)
+			continue
+		}
+		fmt.Fprintf(&s, "I ran `%s`, it failed with exit code %d", r.Command, r.ExitCode)
+		if output := strings.TrimSpace(r.Output); output != "" {
+			s.WriteString(" and printed:\n" + output + "\n")
+		} else {
+			s.WriteString(" without printing anything.\n")
+		}
+	}
+	s.WriteString("Suggest the next thing to try.")
+	return s.String()
+}
+
+// BuildLastCommandPrompt asks for a corrected version of the command the user just ran in their shell,
+// followed by extra instructions from the user
+func BuildLastCommandPrompt(command string, status int, extra string) string {
+	var s strings.Builder
+	if status == 0 {
+		fmt.Fprintf(&s, "I just ran `%s`, it didn't do what I wanted.", command)
+	} else {
+		fmt.Fprintf(&s, "I just ran `%s` and it failed with exit code %d.", command, status)
+	}
+	s.WriteString(" Explain in one sentence what most likely went wrong and suggest the corrected command as a single @run command.")
+	if extra = strings.TrimSpace(extra); extra != "" {
+		s.WriteString("\n\n" + extra)
+	}
+	return s.String()
+}
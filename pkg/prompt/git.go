@@ -0,0 +1,39 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/git"
+)
+
+// Describes the git work tree for the pre-prompt
+func GitContext(info git.Info) string {
+	var parts []string
+	switch {
+	case info.Branch != "" && info.Commit == "":
+		parts = append(parts, "on branch "+info.Branch+" with no commits yet")
+	case info.Branch != "":
+		parts = append(parts, "on branch "+info.Branch+" at "+info.Commit)
+	case info.Commit != "":
+		parts = append(parts, "with a detached HEAD at "+info.Commit)
+	}
+
+	files := fmt.Sprintf("%d files have", info.ChangedFiles)
+	if info.ChangedFiles == 1 {
+		files = "1 file has"
+	}
+	switch {
+	case info.ChangedFiles == 0:
+		parts = append(parts, "the work tree is clean")
+	case info.ShortStat != "":
+		parts = append(parts, files+" uncommitted changes ("+info.ShortStat+")")
+	default:
+		parts = append(parts, files+" uncommitted changes")
+	}
+
+	if info.RemoteHost != "" {
+		parts = append(parts, "origin is hosted on "+info.RemoteHost)
+	}
+	return " The current directory is inside a git repository, " + strings.Join(parts, ", ") + "."
+}
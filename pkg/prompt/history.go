@@ -0,0 +1,72 @@
+package prompt
+
+import (
+	"regexp"
+	"strings"
+)
+
+// History entries matching any of these are never sent to the model
+var secretHistoryPatterns = []*regexp.Regexp{
+	// Exporting or assigning a credential, e.g. export OPENAI_API_KEY=... or GITHUB_TOKEN=... make
+	regexp.MustCompile(`(?i)\b\w*(key|token|secret|passw(or)?d|pwd|credential|auth)\w*\s*=`),
+	// Passwords and tokens given as flags or in option strings
+	regexp.MustCompile(`(?i)(passw(or)?d|passwd|token|secret|api[-_]?key)\s*[:=]`),
+	regexp.MustCompile(`(?i)--?(pass|password|token|secret|api-key|apikey)[ =]\S+`),
+	// Credentials in headers and URLs
+	regexp.MustCompile(`(?i)(authorization|x-api-key)\s*:`),
+	regexp.MustCompile(`(?i)bearer\s+\S+`),
+	regexp.MustCompile(`://[^/\s:@]+:[^/\s@]+@`),
+	// Well known key formats
+	regexp.MustCompile(`AIza[0-9A-Za-z_\-]{35}`),
+	regexp.MustCompile(`\b(sk|gsk|ghp|gho|github_pat|xox[abp])[-_][0-9A-Za-z_\-]{10,}`),
+	regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	// Commands that are about secrets even without one on the line
+	regexp.MustCompile(`^\s*(sudo\s+)?(pass|gpg|op|vault|security\s+find-generic-password)\b`),
+}
+
+// Reports whether a history entry looks like it contains a secret
+func IsSecretHistoryEntry(entry string) bool {
+	for _, pattern := range secretHistoryPatterns {
+		if pattern.MatchString(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the last n entries after dropping the ones that look like they contain secrets,
+// lexido's own invocations and repeats of the previous entry
+func FilterHistory(entries []string, n int) []string {
+	var filtered []string
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || IsSecretHistoryEntry(entry) {
+			continue
+		}
+		if fields := strings.Fields(entry); fields[0] == "lexido" {
+			continue
+		}
+		if len(filtered) > 0 && filtered[len(filtered)-1] == entry {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	if len(filtered) > n {
+		filtered = filtered[len(filtered)-n:]
+	}
+	return filtered
+}
+
+// Formats history entries for the pre-prompt under a heading, empty when there are none
+func FormatHistory(entries []string) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	var s strings.Builder
+	s.WriteString("\n\nRecent shell history of the user, oldest first, for context only, these commands were already run:\n")
+	for _, entry := range entries {
+		s.WriteString("$ " + strings.ReplaceAll(entry, "\n", "\n  ") + "\n")
+	}
+	return s.String()
+}
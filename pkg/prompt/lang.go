@@ -0,0 +1,54 @@
+package prompt
+
+import (
+	"os"
+	"strings"
+)
+
+// Names of common languages by code, other codes are passed to the model as they are
+var languageNames = map[string]string{
+	"ar": "Arabic", "cs": "Czech", "da": "Danish", "de": "German", "el": "Greek", "en": "English",
+	"es": "Spanish", "fa": "Persian", "fi": "Finnish", "fr": "French", "he": "Hebrew", "hi": "Hindi",
+	"hu": "Hungarian", "id": "Indonesian", "it": "Italian", "ja": "Japanese", "ko": "Korean", "nb": "Norwegian",
+	"nl": "Dutch", "pl": "Polish", "pt": "Portuguese", "ro": "Romanian", "ru": "Russian", "sv": "Swedish",
+	"th": "Thai", "tr": "Turkish", "uk": "Ukrainian", "vi": "Vietnamese", "zh": "Chinese",
+}
+
+// ResolveLanguage turns the lang setting into a language code. "auto" follows the locale in LC_ALL,
+// LC_MESSAGES or LANG, e.g. es_ES.UTF-8 is es, and the C and POSIX locales give no language.
+func ResolveLanguage(setting string) string {
+	setting = strings.TrimSpace(setting)
+	if setting != "" && setting != "auto" {
+		return setting
+	}
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := os.Getenv(env)
+		if locale == "" {
+			continue
+		}
+		if locale == "C" || locale == "POSIX" || strings.HasPrefix(locale, "C.") {
+			return ""
+		}
+		// language[_territory][.codeset][@modifier]
+		code, _, _ := strings.Cut(locale, ".")
+		code, _, _ = strings.Cut(code, "@")
+		code, _, _ = strings.Cut(code, "_")
+		return strings.ToLower(code)
+	}
+	return ""
+}
+
+// Instruction that asks for the explanations in the given language, English needs none.
+// The commands stay as they are, they are found by their @run markers in any language.
+func LanguageInstruction(lang string) string {
+	lang = strings.TrimSpace(lang)
+	code := strings.ToLower(lang)
+	if code == "" || code == "en" || strings.HasPrefix(code, "en-") || strings.HasPrefix(code, "en_") {
+		return ""
+	}
+	name := lang
+	if known, ok := languageNames[code]; ok {
+		name = known + " (" + code + ")"
+	}
+	return " Write your explanations in " + name + ". Keep the @run[...] syntax and the commands, flags, paths and code inside it exactly as they would be in English, only the text around them is translated."
+}
@@ -0,0 +1,53 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveLanguage(t *testing.T) {
+	tests := []struct {
+		setting string
+		env     map[string]string
+		want    string
+	}{
+		{setting: "de", want: "de"},
+		{setting: " fr ", want: "fr"},
+		{setting: "auto", env: map[string]string{"LANG": "es_ES.UTF-8"}, want: "es"},
+		{setting: "", env: map[string]string{"LANG": "pt_BR"}, want: "pt"},
+		{setting: "auto", env: map[string]string{"LANG": "ja_JP.UTF-8", "LC_MESSAGES": "de_DE@euro"}, want: "de"},
+		{setting: "auto", env: map[string]string{"LANG": "ja_JP.UTF-8", "LC_ALL": "sv_SE"}, want: "sv"},
+		{setting: "auto", env: map[string]string{"LANG": "C.UTF-8"}, want: ""},
+		{setting: "auto", env: map[string]string{"LANG": "POSIX"}, want: ""},
+		{setting: "auto", want: ""},
+	}
+	for _, test := range tests {
+		for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+			t.Setenv(name, test.env[name])
+		}
+		if got := ResolveLanguage(test.setting); got != test.want {
+			t.Errorf("ResolveLanguage(%q) with %v = %q, want %q", test.setting, test.env, got, test.want)
+		}
+	}
+}
+
+func TestLanguageInstruction(t *testing.T) {
+	for _, lang := range []string{"", "en", "EN", "en-GB", "en_US"} {
+		if got := LanguageInstruction(lang); got != "" {
+			t.Errorf("LanguageInstruction(%q) = %q, want none for English", lang, got)
+		}
+	}
+
+	got := LanguageInstruction("de")
+	if !strings.Contains(got, "German (de)") {
+		t.Errorf("LanguageInstruction(de) = %q, want the name of the language", got)
+	}
+	// The commands are found by their markers, which must not be translated
+	if !strings.Contains(got, "@run[...]") {
+		t.Errorf("LanguageInstruction(de) = %q, want it to keep the @run syntax", got)
+	}
+
+	if got := LanguageInstruction("Klingon"); !strings.Contains(got, "in Klingon.") {
+		t.Errorf("LanguageInstruction(Klingon) = %q, want unknown languages passed on as they are", got)
+	}
+}
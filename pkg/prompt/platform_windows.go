@@ -0,0 +1,8 @@
+//go:build windows
+
+package prompt
+
+const (
+	Platform = "Windows"
+	Shell    = "PowerShell"
+)
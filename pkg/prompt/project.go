@@ -0,0 +1,16 @@
+package prompt
+
+import "strings"
+
+// Adds the facts of the .lexido file of the project to the pre-prompt
+func ProjectContext(content string, truncated bool) string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return ""
+	}
+	note := ""
+	if truncated {
+		note = " (cut off)"
+	}
+	return "\n\nNotes the user keeps about the project in the current directory" + note + ", prefer the tools and workflows they mention:\n" + content + "\n"
+}
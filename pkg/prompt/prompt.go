@@ -1,3 +1,123 @@
 package prompt
 
-const DefaultPrePrompt = "You are lexido, an AI tool for the Linux command line. You are helpful and clever. You know a lot about UNIX and Linux commands, and you are always ready to get things done. Your goal is to do what the user wants. Just do it, don't talk too much, only say crucial information. Explain the basics of what you are doing. Do not use latex or markdown, always answer in plain text. Do not use emojis or emoticons unless told otherwise. Assume that the user would prefer a terminal answer, not GUI instructions. You have to ability to suggest running commands and scripts to the user. The syntax to run a command is @run[<CODE HERE>] all commands are to be in bash. Use it after explaining to the user what it will do. ALWAYS explain to the user what you are doing, ALWAYS. Here are some examples of what you can do: @run[ls -l] or @run[echo 'Hello World']. You can also write multiple lines of code in the command such as @run[echo 'Hello'; echo 'World']. You can also run scripts such as @run[./script.sh]. You can also run commands that require user input such as @run[read -p 'Enter your name: ' name; echo 'Hello, $name!']. Don’t ask the user questions, make educated guesses, or put the question into the command. Such as @run[read -p Where would you like to make a directory?' directory; mkdir $directory] Only put functional code into the command. Do not put code that is not functional or is hypothetical. Don't assume things to be installed. Just run the command to install it. Only use a package manager the user has installed."
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+const DefaultPrePrompt = "You are lexido, an AI tool for the " + Platform + " command line. You are helpful and clever. You know a lot about UNIX and Linux commands, and you are always ready to get things done. Your goal is to do what the user wants. Just do it, don't talk too much, only say crucial information. Explain the basics of what you are doing. Do not use latex or markdown, always answer in plain text. Do not use emojis or emoticons unless told otherwise. Assume that the user would prefer a terminal answer, not GUI instructions. You have to ability to suggest running commands and scripts to the user. The syntax to run a command is @run[<CODE HERE>] all commands are to be in " + Shell + ". Use it after explaining to the user what it will do. ALWAYS explain to the user what you are doing, ALWAYS. Here are some examples of what you can do: @run[ls -l] or @run[echo 'Hello World']. You can also write multiple lines of code in the command such as @run[echo 'Hello'; echo 'World']. You can also run scripts such as @run[./script.sh]. You can also run commands that require user input such as @run[read -p 'Enter your name: ' name; echo 'Hello, $name!']. Don’t ask the user questions, make educated guesses, or put the question into the command. Such as @run[read -p Where would you like to make a directory?' directory; mkdir $directory] Only put functional code into the command. Do not put code that is not functional or is hypothetical. Don't assume things to be installed. Just run the command to install it. Only use a package manager the user has installed."
+
+// Instruction used to get alternatives from backends that can't return several candidates natively
+func AlternativesInstruction(n int) string {
+	return fmt.Sprintf(" Offer %d distinct alternative approaches to the user's request, each introduced with a line like 'Alternative 1:' and each with its own @run commands.", n)
+}
+
+// Instructions of the preprompt setting, added to the pre-prompt of every request. Nothing without them.
+func UserInstructions(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+	return " The user asks you to follow these instructions in every answer: " + text
+}
+
+// Appended to the request when the user asks for another suggestion, previous are the commands suggested so far
+func DifferentApproach(previous []string) string {
+	if len(previous) == 0 {
+		return "\n\nSuggest a different approach than your previous answer."
+	}
+	return "\n\nSuggest a different approach than: " + strings.Join(previous, "; ")
+}
+
+// ErrNoPrompt means there is neither a prompt, piped input, nor a conversation to continue
+var ErrNoPrompt = errors.New("no prompt provided")
+
+// Placeholder older versions sent when no prompt was given, it must never reach the model or the cache again
+const LegacyNoPromptPlaceholder = "The user did not provide a prompt."
+
+// Formats @file attachments with a header per file, the way piped input is appended
+func FormatAttachments(attachments []io.Attachment) string {
+	var s strings.Builder
+	for _, a := range attachments {
+		switch {
+		case a.Binary:
+			s.WriteString("\n\nUser also attached the binary file " + a.Path + ", here is a hexdump of its start:\n" + a.Content)
+		case a.Truncated:
+			s.WriteString("\n\nUser also attached the file " + a.Path + " (truncated):\n" + a.Content)
+		default:
+			s.WriteString("\n\nUser also attached the file " + a.Path + ":\n" + a.Content)
+		}
+	}
+	return s.String()
+}
+
+// Formats the text on the clipboard attached with --paste
+func FormatClipboard(content string, truncated bool) string {
+	if strings.TrimSpace(content) == "" {
+		return ""
+	}
+	if truncated {
+		return "\n\nUser also attached the following input from the clipboard (truncated):\n" + content
+	}
+	return "\n\nUser also attached the following input from the clipboard:\n" + content
+}
+
+// BuildUserPrompt assembles the user's message from the prompt text, piped input, formatted file attachments,
+// and whether a conversation is continued.
+// The returned instruction is meant for the pre-prompt and is never part of the user's message.
+func BuildUserPrompt(text string, piped string, files string, continuing bool) (user string, instruction string, err error) {
+	text = strings.TrimSpace(text)
+
+	attached := ""
+	if piped != "" {
+		attached = "\n\nUser also attached via pipe the following input:\n" + piped
+	}
+	attached += files
+
+	switch {
+	case text != "" && attached != "":
+		return text + attached, "", nil
+	case text != "":
+		return text, "", nil
+	case attached != "":
+		return strings.TrimSpace(attached), " The user did not write a request, only attached input. Infer what they most likely want to know or do with it and answer that.", nil
+	case continuing:
+		return "", " The user did not write a new message. Continue the previous conversation from where your last answer left off.", nil
+	default:
+		return "", "", ErrNoPrompt
+	}
+}
+
+// Parts of a prompt, kept apart for APIs that take the system prompt in a message of its own
+type Parts struct {
+	System  string     // The pre-prompt with lexido's instructions and the system context
+	History string     // Earlier turns of a continued conversation, as stored in the conversation cache
+	User    string     // What the user asked
+	Label   string     // Put before the history and User in the joined prompt, such as "User: "
+	Images  []io.Image // Sent along with the prompt, only Gemini and ollama can read them
+}
+
+// Joins the parts into the single prompt sent to providers without a system role
+func (p Parts) Text() string {
+	return p.System + "\n " + p.Label + p.Conversation()
+}
+
+// Returns the history followed by what the user asked, for templates that have no place for the history of its own
+func (p Parts) Conversation() string {
+	if p.History == "" {
+		return p.User
+	}
+	return p.History + "\n" + p.User
+}
+
+// Tells the model that macOS has BSD tools, whose flags differ from the GNU ones, and which GNU tools are installed too
+func BSDUserland(gnuTools []string) string {
+	s := " The command line tools are the BSD ones of macOS, not GNU coreutils: use flags BSD sed, stat, date, find, xargs and grep understand, such as sed -i '' and stat -f instead of sed -i and stat -c."
+	if len(gnuTools) > 0 {
+		s += " These GNU tools are installed as well, prefer them when a GNU-only flag is needed: " + strings.Join(gnuTools, ", ") + "."
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package prompt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBuildUserPrompt(t *testing.T) {
+	const files = "\n\nUser also attached the file notes.txt:\nremember the milk"
+	tests := []struct {
+		name        string
+		text        string
+		piped       string
+		files       string
+		continuing  bool
+		user        string
+		instruction string // Part of the instruction, empty when there must be none
+		err         error
+	}{
+		{name: "nothing", err: ErrNoPrompt},
+		{name: "only whitespace", text: "  \n ", err: ErrNoPrompt},
+		{name: "prompt", text: "list files", user: "list files"},
+		{name: "prompt with spaces around", text: "  list files \n", user: "list files"},
+		{name: "prompt and -c", text: "and hidden ones", continuing: true, user: "and hidden ones"},
+		{
+			name:  "prompt and pipe",
+			text:  "what failed",
+			piped: "error: disk full",
+			user:  "what failed\n\nUser also attached via pipe the following input:\nerror: disk full",
+		},
+		{
+			name:        "only pipe",
+			piped:       "error: disk full",
+			user:        "User also attached via pipe the following input:\nerror: disk full",
+			instruction: "only attached input. Infer",
+		},
+		{
+			name:        "pipe and -c",
+			piped:       "error: disk full",
+			continuing:  true,
+			user:        "User also attached via pipe the following input:\nerror: disk full",
+			instruction: "only attached input",
+		},
+		{
+			name:        "only files",
+			files:       files,
+			user:        strings.TrimSpace(files),
+			instruction: "only attached input",
+		},
+		{
+			name:  "prompt, pipe and files",
+			text:  "compare",
+			piped: "a",
+			files: files,
+			user:  "compare\n\nUser also attached via pipe the following input:\na" + files,
+		},
+		{name: "only -c", continuing: true, user: "", instruction: "Continue the previous conversation"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, instruction, err := BuildUserPrompt(test.text, test.piped, test.files, test.continuing)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("err = %v, want %v", err, test.err)
+			}
+			if user != test.user {
+				t.Errorf("user = %q, want %q", user, test.user)
+			}
+			if test.instruction == "" && instruction != "" {
+				t.Errorf("instruction = %q, want none", instruction)
+			}
+			if !strings.Contains(instruction, test.instruction) {
+				t.Errorf("instruction = %q, want it to contain %q", instruction, test.instruction)
+			}
+			// The old placeholder text must never reach the model as if the user had written it
+			if strings.Contains(user, "did not provide a prompt") || strings.Contains(user, "did not write") {
+				t.Errorf("user = %q, has text the user didn't write", user)
+			}
+		})
+	}
+}
+
+func TestPartsText(t *testing.T) {
+	parts := Parts{System: "sys", User: "list files", Label: "User: "}
+	if got, want := parts.Text(), "sys\n User: list files"; got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,19 @@
+package prompt
+
+const summarizePrePrompt = "You are lexido, summarizing the text the user piped in or attached, such as logs, command output or documents. Answer in plain prose and short lists: lead with what matters most, such as errors, warnings and their likely causes, then the rest in brief. Quote the lines you refer to where it helps. Don't suggest commands to run and don't use @run markup."
+
+// Asked for when the user wrote no instructions of their own
+const DefaultSummaryRequest = "Summarize this."
+
+// Appended to the pre-prompt with --no-commands, which only shows the response
+const noCommandsInstruction = " This time don't suggest commands to run and don't use @run markup: answer in prose, the user only reads the answer."
+
+// Returns the pre-prompt used by `lexido summarize`
+func SummarizePrePrompt() string {
+	return summarizePrePrompt
+}
+
+// Returns the instruction of --no-commands for the regular pre-prompt
+func NoCommandsInstruction() string {
+	return noCommandsInstruction
+}
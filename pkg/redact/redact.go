@@ -0,0 +1,134 @@
+package redact
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule masks one kind of secret. Group is the submatch holding the secret itself, 0 masks the whole match.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Group   int
+	// Check, when set, has to accept the secret too, for patterns that would also match harmless text
+	Check func(secret string) bool
+}
+
+// The rules applied by Text, most specific first so a key gets its own name rather than a generic one
+var Rules = []Rule{
+	{Name: "private_key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`)},
+	{Name: "aws_key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "aws_secret", Pattern: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`), Group: 1},
+	{Name: "google_api_key", Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`)},
+	{Name: "api_key", Pattern: regexp.MustCompile(`\b(?:sk|gsk|sk-ant)[-_][0-9A-Za-z_\-]{16,}`)},
+	{Name: "github_token", Pattern: regexp.MustCompile(`\b(?:ghp|gho|ghu|ghs|ghr)_[0-9A-Za-z]{36}\b|\bgithub_pat_[0-9A-Za-z_]{22,}`)},
+	{Name: "slack_token", Pattern: regexp.MustCompile(`\bxox[abprs]-[0-9A-Za-z\-]{10,}`)},
+	{Name: "bearer_token", Pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{8,}=*)`), Group: 1},
+	{Name: "url_password", Pattern: regexp.MustCompile(`://[^/\s:@]+:([^/\s@]+)@`), Group: 1},
+	{Name: "password", Pattern: regexp.MustCompile(`(?i)\b\w*(?:passw(?:or)?d|passwd|pwd)\w*["']?\s*[=:]\s*["']?([^\s"',;]+)`), Group: 1, Check: literal},
+	{Name: "secret", Pattern: regexp.MustCompile(`(?i)\b\w*(?:secret|token|api_?key|private_?key|credentials?)\w*["']?\s*[=:]\s*["']?([^\s"',;]+)`), Group: 1, Check: longLiteral},
+	{Name: "high_entropy", Pattern: regexp.MustCompile(`[=:]\s*["']?([A-Za-z0-9+/_\-]{20,}={0,2})`), Group: 1, Check: highEntropy},
+}
+
+// Placeholder the secret of a rule is replaced with
+func Placeholder(name string) string {
+	return "<REDACTED:" + name + ">"
+}
+
+// Text replaces everything matching a rule with its placeholder.
+// It returns the redacted text and how many secrets each rule replaced.
+func Text(text string) (string, map[string]int) {
+	counts := map[string]int{}
+	for _, rule := range Rules {
+		var s strings.Builder
+		last := 0
+		for _, match := range rule.Pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := match[2*rule.Group], match[2*rule.Group+1]
+			if start < 0 {
+				continue
+			}
+			secret := text[start:end]
+			// Already masked by an earlier rule
+			if strings.HasPrefix(secret, "<REDACTED:") {
+				continue
+			}
+			if rule.Check != nil && !rule.Check(secret) {
+				continue
+			}
+			s.WriteString(text[last:start])
+			s.WriteString(Placeholder(rule.Name))
+			last = end
+			counts[rule.Name]++
+		}
+		if last > 0 {
+			s.WriteString(text[last:])
+			text = s.String()
+		}
+	}
+	return text, counts
+}
+
+// Total returns the number of redactions in counts and the names of the rules involved, sorted
+func Total(counts map[string]int) (int, []string) {
+	total := 0
+	var names []string
+	for name, n := range counts {
+		total += n
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return total, names
+}
+
+// Values referring to a variable, like $DB_PASSWORD or ${TOKEN}, aren't secrets themselves
+func literal(value string) bool {
+	return !strings.HasPrefix(value, "$") && !strings.HasPrefix(value, "%")
+}
+
+// Like literal, but short values after names like max_tokens are settings rather than secrets
+func longLiteral(value string) bool {
+	return literal(value) && len(value) >= 8
+}
+
+// Reports whether a value looks random enough to be a key rather than a word, path or version
+func highEntropy(value string) bool {
+	var lower, upper, digit bool
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit} {
+		if present {
+			classes++
+		}
+	}
+	if classes < 2 {
+		return false
+	}
+	return entropy(value) >= 4.0
+}
+
+// Shannon entropy of the string in bits per character
+func entropy(value string) float64 {
+	freq := map[rune]float64{}
+	n := 0.0
+	for _, r := range value {
+		freq[r]++
+		n++
+	}
+	bits := 0.0
+	for _, count := range freq {
+		p := count / n
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
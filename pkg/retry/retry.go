@@ -0,0 +1,172 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error marks a provider failure as transient, such as a rate limit or a 5xx response
+type Error struct {
+	Err        error
+	Status     int           // HTTP status, zero for connection failures
+	RetryAfter time.Duration // Delay requested by the provider, zero if none
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Reason describes the failure for the status line
+func (e *Error) Reason() string {
+	switch {
+	case e.Status == http.StatusTooManyRequests:
+		return "rate limited"
+	case e.Status >= 500:
+		return fmt.Sprintf("server error %d", e.Status)
+	default:
+		return "connection lost"
+	}
+}
+
+// Wraps err as retryable with the given status and Retry-After hint
+func Retryable(err error, status int, retryAfter time.Duration) error {
+	return &Error{Err: err, Status: status, RetryAfter: retryAfter}
+}
+
+// Reports whether a status code is worth retrying
+func RetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// Parses a Retry-After header, either in seconds or as an HTTP date
+func ParseRetryAfter(header string) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// Policy controls how often and how long failed requests are retried
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// AttemptTimeout bounds each attempt, zero means attempts may take forever
+	AttemptTimeout time.Duration
+}
+
+var DefaultPolicy = Policy{
+	MaxAttempts:    5,
+	BaseDelay:      2 * time.Second,
+	MaxDelay:       60 * time.Second,
+	AttemptTimeout: 120 * time.Second,
+}
+
+// Returns how long to wait before the given attempt (starting at 2), honoring the provider's hint when present
+func (p Policy) Delay(attempt int, hint time.Duration) time.Duration {
+	if hint > 0 {
+		if hint > p.MaxDelay {
+			return p.MaxDelay
+		}
+		return hint
+	}
+
+	delay := p.BaseDelay << (attempt - 2)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// Full jitter on the upper half so concurrent clients spread out
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Do runs fn until it succeeds, fails with an error that isn't retryable, or runs out of attempts.
+// onRetry is called before each wait so the wait can be shown to the user.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context, attempt int) error, onRetry func(attempt int, wait time.Duration, err *Error)) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := attemptWithTimeout(ctx, p.AttemptTimeout, attempt, fn)
+		if err == nil {
+			return nil
+		}
+
+		var rerr *Error
+		if !errors.As(err, &rerr) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= maxAttempts {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+
+		wait := p.Delay(attempt+1, rerr.RetryAfter)
+		if onRetry != nil {
+			onRetry(attempt+1, wait, rerr)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Runs a single attempt, cancelling it once the timeout has passed
+func attemptWithTimeout(ctx context.Context, timeout time.Duration, attempt int, fn func(ctx context.Context, attempt int) error) error {
+	if timeout <= 0 {
+		return fn(ctx, attempt)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(attemptCtx, attempt)
+	if err != nil && attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		// Providers report the deadline in their own words, make it recognizable
+		return &TimeoutError{After: timeout, Err: err}
+	}
+	return err
+}
+
+// TimeoutError means an attempt took longer than the policy allows
+type TimeoutError struct {
+	After    time.Duration
+	Provider string // Set by the caller for the message, may be empty
+	Err      error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Provider != "" {
+		return fmt.Sprintf("timed out after %s talking to %s", e.After, e.Provider)
+	}
+	return fmt.Sprintf("timed out after %s", e.After)
+}
+
+func (e *TimeoutError) Unwrap() []error {
+	return []error{context.DeadlineExceeded, e.Err}
+}
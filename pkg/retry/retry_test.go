@@ -0,0 +1,152 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDelayJitterBounds(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		full    time.Duration
+	}{
+		{2, 100 * time.Millisecond},
+		{3, 200 * time.Millisecond},
+		{4, 400 * time.Millisecond},
+		{5, 800 * time.Millisecond},
+		{6, time.Second},  // Capped at MaxDelay
+		{70, time.Second}, // The shift overflows
+	}
+	for _, test := range tests {
+		seen := map[time.Duration]bool{}
+		for i := 0; i < 200; i++ {
+			d := p.Delay(test.attempt, 0)
+			if d < test.full/2 || d > test.full {
+				t.Fatalf("Delay(%d) = %s, want between %s and %s", test.attempt, d, test.full/2, test.full)
+			}
+			seen[d] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("Delay(%d) was always %v, want jitter", test.attempt, seen)
+		}
+	}
+}
+
+func TestRetryAfterTakesPriority(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: 10 * time.Second, MaxDelay: time.Minute}
+	if d := p.Delay(2, 3*time.Second); d != 3*time.Second {
+		t.Errorf("Delay() with a Retry-After of 3s = %s, want it exactly", d)
+	}
+	if d := p.Delay(2, time.Hour); d != time.Minute {
+		t.Errorf("Delay() with a Retry-After of an hour = %s, want MaxDelay", d)
+	}
+
+	// Do waits what the provider asked for and reports it
+	p = Policy{MaxAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	var waited time.Duration
+	err := Do(context.Background(), p, func(ctx context.Context, attempt int) error {
+		if attempt == 1 {
+			return Retryable(errors.New("slow down"), http.StatusTooManyRequests, 10*time.Millisecond)
+		}
+		return nil
+	}, func(attempt int, wait time.Duration, err *Error) { waited = wait })
+	if err != nil || waited != 10*time.Millisecond {
+		t.Errorf("Do() = %v after waiting %s, want success after the 10ms of Retry-After", err, waited)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := ParseRetryAfter("7"); d != 7*time.Second {
+		t.Errorf("ParseRetryAfter(7) = %s", d)
+	}
+	if d := ParseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d <= 50*time.Second || d > time.Minute {
+		t.Errorf("ParseRetryAfter(a date in a minute) = %s", d)
+	}
+	for _, header := range []string{"", "-1", "soon", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)} {
+		if d := ParseRetryAfter(header); d != 0 {
+			t.Errorf("ParseRetryAfter(%q) = %s, want 0", header, d)
+		}
+	}
+}
+
+func TestDoStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	attempts := 0
+	start := time.Now()
+	err := Do(ctx, p, func(ctx context.Context, attempt int) error {
+		attempts++
+		return Retryable(errors.New("unavailable"), http.StatusServiceUnavailable, 0)
+	}, func(attempt int, wait time.Duration, err *Error) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() = %v, want context.Canceled", err)
+	}
+	if attempts != 1 || time.Since(start) > time.Second {
+		t.Errorf("Do() made %d attempts in %s, want one and no wait", attempts, time.Since(start))
+	}
+
+	// An attempt failing because the context was cancelled isn't tried again
+	ctx, cancel = context.WithCancel(context.Background())
+	attempts = 0
+	err = Do(ctx, p, func(ctx context.Context, attempt int) error {
+		attempts++
+		cancel()
+		return Retryable(ctx.Err(), 0, 0)
+	}, nil)
+	if attempts != 1 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() = %v after %d attempts, want the cancellation after one", err, attempts)
+	}
+}
+
+// Requests to the server the way providers make them, only statuses worth retrying are wrapped as retryable
+func TestDoRetriesOnlyRetryableStatuses(t *testing.T) {
+	tests := []struct {
+		status   int
+		attempts int
+	}{
+		{http.StatusBadRequest, 1},
+		{http.StatusUnauthorized, 1},
+		{http.StatusForbidden, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusTooManyRequests, 3},
+		{http.StatusInternalServerError, 3},
+		{http.StatusServiceUnavailable, 3},
+	}
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			p := Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+			err := Do(context.Background(), p, func(ctx context.Context, attempt int) error {
+				resp, err := http.Get(server.URL)
+				if err != nil {
+					return Retryable(err, 0, 0)
+				}
+				resp.Body.Close()
+				err = fmt.Errorf("status %d", resp.StatusCode)
+				if RetryableStatus(resp.StatusCode) {
+					return Retryable(err, resp.StatusCode, ParseRetryAfter(resp.Header.Get("Retry-After")))
+				}
+				return err
+			}, nil)
+			if err == nil {
+				t.Fatal("Do() = nil, want the failure")
+			}
+			if requests != test.attempts {
+				t.Errorf("%d requests, want %d", requests, test.attempts)
+			}
+		})
+	}
+}
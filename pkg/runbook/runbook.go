@@ -0,0 +1,46 @@
+package runbook
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/commands"
+)
+
+// Section is the answer to one prompt of a batch
+type Section struct {
+	Prompt   string
+	Response string
+	Commands []string
+	Err      error // Why the prompt got no answer, the response may hold what arrived before
+}
+
+// Markdown renders the sections as a runbook with a section per prompt, source names where the prompts came from
+// and provider what answered them
+func Markdown(source string, provider string, sections []Section, now time.Time) string {
+	var s strings.Builder
+	s.WriteString("# Runbook: " + source + "\n\n")
+	s.WriteString(fmt.Sprintf("Generated by lexido with %s on %s. The commands were not run.\n", provider, now.Format("2006-01-02 15:04")))
+
+	for i, section := range sections {
+		s.WriteString(fmt.Sprintf("\n## %d. %s\n\n", i+1, oneLine(section.Prompt)))
+		if response := strings.TrimSpace(section.Response); response != "" {
+			s.WriteString(commands.MarkdownCommands(response) + "\n")
+		}
+		if section.Err != nil {
+			if section.Response != "" {
+				s.WriteString("\n")
+			}
+			s.WriteString(fmt.Sprintf("> **Failed:** %s\n", oneLine(section.Err.Error())))
+		}
+		if len(section.Commands) > 0 {
+			s.WriteString("\n```bash\n" + strings.Join(section.Commands, "\n") + "\n```\n")
+		}
+	}
+	return s.String()
+}
+
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
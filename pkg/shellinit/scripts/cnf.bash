@@ -0,0 +1,7 @@
+# Commands that aren't found get an install suggestion from lexido, silence when it has none or fails
+command_not_found_handle() {
+    printf 'bash: %s: command not found\n' "$1" >&2
+    local suggestion
+    suggestion=$(lexido cnf "$1" </dev/null 2>/dev/null) && [[ -n "$suggestion" ]] && printf '%s\n' "$suggestion" >&2
+    return 127
+}
@@ -0,0 +1,7 @@
+# Commands that aren't found get an install suggestion from lexido, silence when it has none or fails
+function fish_command_not_found
+    printf 'fish: Unknown command: %s\n' $argv[1] >&2
+    set -l suggestion (lexido cnf $argv[1] </dev/null 2>/dev/null)
+    and test -n "$suggestion"
+    and printf '%s\n' $suggestion >&2
+end
@@ -0,0 +1,35 @@
+# bash integration for lexido, load it with: eval "$(lexido shell-init bash)"
+
+# Ctrl-X Ctrl-L turns the description typed on the command line into the suggested command, ready to edit
+_lexido_suggest() {
+    [[ -z "$READLINE_LINE" ]] && return
+    local cmd
+    cmd=$(lexido --commands-only -- "$READLINE_LINE" </dev/null 2>/dev/null)
+    if [[ $? -ne 0 || -z "$cmd" ]]; then
+        echo "lexido: no command suggested" >&2
+        return 1
+    fi
+    READLINE_LINE=$cmd
+    READLINE_POINT=${#READLINE_LINE}
+}
+bind -x '"\C-x\C-l": _lexido_suggest'
+
+# The last command line and its exit status are exported for `lexido fix`, which is left out itself.
+# It runs first in PROMPT_COMMAND to see the status of the command and hands it on to the rest.
+_lexido_prompt_command() {
+    local last_status=$? entry
+    entry=$(HISTTIMEFORMAT= builtin history 1)
+    if [[ -n "$entry" && "$entry" != "$_lexido_entry" ]]; then
+        _lexido_entry=$entry
+        entry=$(sed 's/^ *[0-9]*[* ] *//' <<<"$entry")
+        if [[ "$entry" != "lexido fix"* ]]; then
+            export LEXIDO_LAST_COMMAND=$entry LEXIDO_LAST_STATUS=$last_status
+        fi
+    fi
+    return $last_status
+}
+_lexido_entry=$(HISTTIMEFORMAT= builtin history 1)
+PROMPT_COMMAND="_lexido_prompt_command${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+
+# Ctrl-X Ctrl-F asks for a fix of the last command
+bind '"\C-x\C-f": "\C-a\C-klexido fix\C-m"'
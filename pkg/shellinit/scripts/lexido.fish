@@ -0,0 +1,27 @@
+# fish integration for lexido, load it with: lexido shell-init fish | source
+
+# Ctrl-X Ctrl-L turns the description typed on the command line into the suggested command, ready to edit
+function _lexido_suggest
+    set -l description (commandline)
+    test -n "$description"; or return
+    set -l cmd (lexido --commands-only -- "$description" </dev/null 2>/dev/null)
+    if test $status -ne 0; or test -z "$cmd"
+        echo "lexido: no command suggested" >&2
+        commandline -f repaint
+        return 1
+    end
+    commandline -r -- (string join \n -- $cmd)
+    commandline -f repaint
+end
+bind \cx\cl _lexido_suggest
+
+# The last command line and its exit status are exported for `lexido fix`, which is left out itself
+function _lexido_postexec --on-event fish_postexec
+    set -l last_status $status
+    string match -q -- 'lexido fix*' $argv[1]; and return
+    set -gx LEXIDO_LAST_COMMAND $argv[1]
+    set -gx LEXIDO_LAST_STATUS $last_status
+end
+
+# Ctrl-X Ctrl-F asks for a fix of the last command
+bind \cx\cf 'commandline -r "lexido fix"; commandline -f execute'
@@ -0,0 +1,56 @@
+package shellinit
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Widgets and hooks for each shell, one file per shell
+//
+//go:embed scripts/*
+var scripts embed.FS
+
+// Shells that `lexido shell-init` has a script for
+var Shells = []string{"bash", "zsh", "fish"}
+
+// Generate returns the script that is eval'd from the rc file of the given shell.
+// With commandNotFound it also replaces the shell's command-not-found handler with one asking lexido.
+func Generate(shell string, commandNotFound bool) (string, error) {
+	data, err := scripts.ReadFile("scripts/lexido." + shell)
+	if err != nil {
+		return "", fmt.Errorf("unsupported shell %q, use one of %s", shell, strings.Join(Shells, ", "))
+	}
+	if commandNotFound {
+		handler, err := scripts.ReadFile("scripts/cnf." + shell)
+		if err != nil {
+			return "", err
+		}
+		data = append(append(data, '\n'), handler...)
+	}
+	return string(data), nil
+}
+
+// Environment variables the hooks of the scripts export after every command, for `lexido fix`
+const (
+	LastCommandEnv = "LEXIDO_LAST_COMMAND"
+	LastStatusEnv  = "LEXIDO_LAST_STATUS"
+)
+
+var ErrNoLastCommand = errors.New("no previous command to fix, load the shell integration first with: eval \"$(lexido shell-init bash)\" (or zsh, or lexido shell-init fish | source)")
+
+// Returns the command line run last in the shell and its exit status, as exported by the hooks
+func LastCommand() (string, int, error) {
+	command := strings.TrimSpace(os.Getenv(LastCommandEnv))
+	if command == "" {
+		return "", 0, ErrNoLastCommand
+	}
+	status, err := strconv.Atoi(os.Getenv(LastStatusEnv))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid %s %q", LastStatusEnv, os.Getenv(LastStatusEnv))
+	}
+	return command, status, nil
+}
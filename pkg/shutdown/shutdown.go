@@ -0,0 +1,107 @@
+package shutdown
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Default amount of time background tasks get before lexido exits without them
+const DefaultGracePeriod = 500 * time.Millisecond
+
+type task struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Coordinator collects the work that has to happen before lexido exits.
+// Essential tasks run synchronously in the order they were registered, while
+// background tasks run concurrently and are abandoned once the grace period is over.
+type Coordinator struct {
+	GracePeriod time.Duration
+	// Logf receives notes about failed or abandoned tasks, it is silent when nil
+	Logf func(format string, args ...any)
+
+	mu         sync.Mutex
+	essential  []task
+	background []task
+}
+
+func New(grace time.Duration) *Coordinator {
+	return &Coordinator{GracePeriod: grace}
+}
+
+// Essential registers a task that must complete before exit, such as the conversation cache write
+func (c *Coordinator) Essential(name string, fn func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.essential = append(c.essential, task{name: name, fn: func(context.Context) error { return fn() }})
+}
+
+// Background registers a non-essential task, its context is cancelled when the grace period runs out
+func (c *Coordinator) Background(name string, fn func(ctx context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.background = append(c.background, task{name: name, fn: fn})
+}
+
+// Run executes all registered tasks and returns the errors of the essential ones.
+// The grace period starts with Run, so it returns once the essential tasks finished and the grace period has
+// elapsed at the latest, and right after slow essential tasks that already used it up.
+func (c *Coordinator) Run() []error {
+	c.mu.Lock()
+	essential, background := c.essential, c.background
+	c.essential, c.background = nil, nil
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timer := time.NewTimer(c.GracePeriod)
+	defer timer.Stop()
+
+	// Start the background tasks first so they overlap with the essential writes
+	done := make(chan string, len(background))
+	for _, t := range background {
+		go func(t task) {
+			if err := t.fn(ctx); err != nil {
+				c.logf("shutdown: background task %q failed: %v", t.name, err)
+			}
+			done <- t.name
+		}(t)
+	}
+
+	var errs []error
+	for _, t := range essential {
+		if err := t.fn(ctx); err != nil {
+			c.logf("shutdown: essential task %q failed: %v", t.name, err)
+			errs = append(errs, err)
+		}
+	}
+
+	pending := make(map[string]int)
+	for _, t := range background {
+		pending[t.name]++
+	}
+
+	for remaining := len(background); remaining > 0; remaining-- {
+		select {
+		case name := <-done:
+			pending[name]--
+		case <-timer.C:
+			for name, n := range pending {
+				if n > 0 {
+					c.logf("shutdown: abandoned background task %q after %v", name, c.GracePeriod)
+				}
+			}
+			return errs
+		}
+	}
+
+	return errs
+}
+
+func (c *Coordinator) logf(format string, args ...any) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
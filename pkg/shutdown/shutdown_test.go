@@ -0,0 +1,229 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records the order tasks ran in, from any goroutine
+type recorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *recorder) add(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.order = append(r.order, name)
+}
+
+func (r *recorder) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.order...)
+}
+
+func TestEssentialOrder(t *testing.T) {
+	var r recorder
+	c := New(time.Second)
+	for _, name := range []string{"conversation cache", "title", "bookmark"} {
+		c.Essential(name, func() error {
+			r.add(name)
+			return nil
+		})
+	}
+	if errs := c.Run(); len(errs) != 0 {
+		t.Fatalf("Run() = %v, want no errors", errs)
+	}
+	if want := []string{"conversation cache", "title", "bookmark"}; !reflect.DeepEqual(r.names(), want) {
+		t.Errorf("essential tasks ran as %q, want %q", r.names(), want)
+	}
+}
+
+func TestEssentialErrors(t *testing.T) {
+	var r recorder
+	first, second := errors.New("disk full"), errors.New("read-only")
+	c := New(time.Second)
+	c.Essential("a", func() error { r.add("a"); return first })
+	c.Essential("b", func() error { r.add("b"); return nil })
+	c.Essential("c", func() error { r.add("c"); return second })
+
+	errs := c.Run()
+	if !reflect.DeepEqual(errs, []error{first, second}) {
+		t.Errorf("Run() = %v, want the errors of a and c in order", errs)
+	}
+	// A failed task doesn't keep the ones after it from running
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(r.names(), want) {
+		t.Errorf("essential tasks ran as %q, want %q", r.names(), want)
+	}
+}
+
+func TestBackgroundOverlapsEssential(t *testing.T) {
+	// The background task is started before the essential ones run, so it can be waiting for them
+	started := make(chan struct{})
+	c := New(time.Second)
+	c.Background("stats", func(ctx context.Context) error {
+		close(started)
+		return nil
+	})
+	c.Essential("conversation cache", func() error {
+		select {
+		case <-started:
+			return nil
+		case <-time.After(time.Second):
+			return errors.New("the background task didn't start before the essential one")
+		}
+	})
+	if errs := c.Run(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+}
+
+func TestRunWaitsForFastBackgroundTasks(t *testing.T) {
+	var r recorder
+	c := New(time.Second)
+	c.Background("stats", func(ctx context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		r.add("stats")
+		return nil
+	})
+	c.Essential("conversation cache", func() error { r.add("conversation cache"); return nil })
+	c.Run()
+
+	// Run returned only after the background task was done, both ran
+	if want := []string{"conversation cache", "stats"}; !reflect.DeepEqual(r.names(), want) {
+		t.Errorf("tasks ran as %q, want %q", r.names(), want)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	runs := 0
+	c := New(time.Second)
+	c.Essential("a", func() error { runs++; return nil })
+	c.Run()
+	c.Run()
+	if runs != 1 {
+		t.Errorf("the task ran %d times, want once", runs)
+	}
+}
+
+func TestBackgroundErrorsAreLogged(t *testing.T) {
+	var logged []string
+	var mu sync.Mutex
+	c := New(time.Second)
+	c.Logf = func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, format)
+	}
+	c.Background("stats", func(ctx context.Context) error { return errors.New("locked") })
+	if errs := c.Run(); len(errs) != 0 {
+		t.Errorf("Run() = %v, background errors aren't returned", errs)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logged) != 1 {
+		t.Errorf("logged %q, want the failed background task", logged)
+	}
+}
+
+func TestSlowBackgroundTaskDoesNotDelayExit(t *testing.T) {
+	grace := 100 * time.Millisecond
+	c := New(grace)
+
+	// A title or stats write that hangs, e.g. on a slow network file system
+	cancelled := make(chan struct{})
+	c.Background("stats", func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			close(cancelled)
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+			return nil
+		}
+	})
+	written := false
+	c.Essential("conversation cache", func() error {
+		time.Sleep(20 * time.Millisecond)
+		written = true
+		return nil
+	})
+
+	start := time.Now()
+	c.Run()
+	elapsed := time.Since(start)
+
+	if !written {
+		t.Error("the conversation cache wasn't written before Run returned")
+	}
+	// The essential write plus the grace period, with some room for a busy machine
+	if limit := 20*time.Millisecond + grace + 200*time.Millisecond; elapsed > limit {
+		t.Errorf("Run took %s with a hanging background task, want at most %s", elapsed, limit)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("the context of the abandoned task wasn't cancelled")
+	}
+}
+
+func TestSlowEssentialTaskCompletes(t *testing.T) {
+	// Essential tasks aren't bound by the grace period, a slow cache write still finishes
+	c := New(10 * time.Millisecond)
+	written := false
+	c.Essential("conversation cache", func() error {
+		time.Sleep(100 * time.Millisecond)
+		written = true
+		return nil
+	})
+	c.Run()
+	if !written {
+		t.Error("Run returned before the essential task finished")
+	}
+}
+
+func TestAbandonedTaskIsLogged(t *testing.T) {
+	var mu sync.Mutex
+	var logged []any
+	c := New(10 * time.Millisecond)
+	c.Logf = func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, args...)
+	}
+	c.Background("nag ledger", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	c.Run()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logged) == 0 || logged[0] != "nag ledger" {
+		t.Errorf("logged %v, want the abandoned task named", logged)
+	}
+}
+
+func TestGracePeriodStartsWithRun(t *testing.T) {
+	grace := 100 * time.Millisecond
+	c := New(grace)
+	c.Background("stats", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	// The essential write uses up the grace period, the background task gets no more time after it
+	c.Essential("conversation cache", func() error {
+		time.Sleep(grace)
+		return nil
+	})
+
+	start := time.Now()
+	c.Run()
+	if elapsed, limit := time.Since(start), grace+50*time.Millisecond; elapsed > limit {
+		t.Errorf("Run took %s, want at most %s as the grace period counts from its start", elapsed, limit)
+	}
+}
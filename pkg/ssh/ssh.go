@@ -0,0 +1,92 @@
+// Package ssh runs commands on the host given with --target through the ssh client, so ~/.ssh/config applies
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/logging"
+)
+
+// Seconds ssh waits for the host before giving up
+const connectTimeout = 10
+
+// How long the shared connection stays open after the last command, so selecting commands doesn't ask for the password again
+const controlPersist = "10m"
+
+// Returns the arguments of ssh running command on target. The connection is shared between the calls of one
+// run through a control socket in the state directory, Windows' OpenSSH has no control sockets.
+func args(target string, tty bool, command string) []string {
+	args := []string{"-o", fmt.Sprintf("ConnectTimeout=%d", connectTimeout)}
+	if runtime.GOOS != "windows" {
+		if dir, err := io.GetFilePath(io.State, "ssh"); err == nil && os.MkdirAll(dir, 0700) == nil {
+			// %C is a hash of the connection, short enough for the length limit of socket paths
+			args = append(args, "-o", "ControlMaster=auto", "-o", "ControlPath="+filepath.Join(dir, "%C"), "-o", "ControlPersist="+controlPersist)
+		}
+	}
+	if tty {
+		args = append(args, "-t")
+	}
+	// -- keeps a target starting with - from being read as an option
+	return append(args, "--", target, command)
+}
+
+// Command returns the ssh process running command on target through the login shell of the remote user.
+// tty asks for a terminal on the remote side, for commands that prompt or draw on the screen.
+func Command(target string, tty bool, command string) *exec.Cmd {
+	return exec.Command("ssh", args(target, tty, command)...)
+}
+
+// Check connects to target once, asking for the password or passphrase if the host needs one, and returns a
+// network error when it can't be reached, before lexido asks the model about it
+func Check(target string) error {
+	if _, err := exec.LookPath("ssh"); err != nil {
+		return errs.Usagef("--target needs the ssh client, which isn't installed")
+	}
+	cmd := Command(target, false, "true")
+	var stderr bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return errs.Wrap(errs.ErrNetwork, fmt.Errorf("could not reach %s over ssh: %s", target, msg))
+	}
+	return nil
+}
+
+// Output runs a shell script on target with sh and returns its stdout
+func Output(target string, script string) (string, error) {
+	cmd := Command(target, false, "sh -c "+Quote(script))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		logging.Warnf("ssh %s failed: %v: %s", target, err, strings.TrimSpace(stderr.String()))
+		return string(out), err
+	}
+	return string(out), nil
+}
+
+// Quote quotes s for a POSIX shell
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// CommandLine returns Command as a line for a shell, for running it somewhere else such as a tmux pane
+func CommandLine(target string, tty bool, command string) string {
+	line := "ssh"
+	for _, arg := range args(target, tty, command) {
+		line += " " + Quote(arg)
+	}
+	return line
+}
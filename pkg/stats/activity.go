@@ -0,0 +1,118 @@
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+const activityFile = "activity.jsonl"
+
+// Kinds of activity
+const (
+	RequestActivity = "request" // A request to a provider, with its tokens
+	PromptActivity  = "prompt"  // A prompt that was answered, with the number of commands suggested
+)
+
+// Activity is one line of the activity log. The totals of stats.json can't be narrowed down to a time window,
+// the activity log keeps every request and prompt with its time for that.
+type Activity struct {
+	Time           time.Time `json:"time"`
+	Kind           string    `json:"kind"`
+	Provider       string    `json:"provider"`
+	Model          string    `json:"model,omitempty"`
+	Prompt         string    `json:"prompt,omitempty"`
+	Suggestions    int       `json:"suggestions,omitempty"`
+	PromptTokens   int       `json:"prompt_tokens,omitempty"`
+	ResponseTokens int       `json:"response_tokens,omitempty"`
+	Estimated      bool      `json:"estimated,omitempty"`
+	Cost           float64   `json:"cost,omitempty"`
+	Unpriced       bool      `json:"unpriced,omitempty"`
+}
+
+// Returns the path of the activity log
+func ActivityPath() (string, error) {
+	return io.GetFilePath(io.State, activityFile)
+}
+
+// Records a prompt that was answered with the given number of suggested commands
+func RecordPrompt(provider string, model string, prompt string, suggestions int) error {
+	return appendActivity(Activity{Kind: PromptActivity, Provider: provider, Model: model, Prompt: prompt, Suggestions: suggestions})
+}
+
+func appendActivity(activity Activity) error {
+	activity.Time = time.Now()
+	path, err := ActivityPath()
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Loads the activity since the given time, all of it for the zero time. A missing log means nothing was recorded yet,
+// lines that can't be read are skipped.
+func LoadActivity(since time.Time) ([]Activity, error) {
+	path, err := ActivityPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var activities []Activity
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var activity Activity
+		if err := json.Unmarshal(scanner.Bytes(), &activity); err != nil || activity.Time.Before(since) {
+			continue
+		}
+		activities = append(activities, activity)
+	}
+	return activities, scanner.Err()
+}
+
+// ParseSince parses the start of a time window such as 7d, 2w, 12h or 2024-05-01, relative to now
+func ParseSince(text string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", text, time.Local); err == nil {
+		return t, nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.Atoi(strings.TrimSuffix(text, suffix)); err == nil && strings.HasSuffix(text, suffix) && n > 0 {
+			return now.Add(-time.Duration(n) * unit), nil
+		}
+	}
+	if d, err := time.ParseDuration(text); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time window %q, use e.g. 7d, 2w, 12h or 2024-05-01", text)
+}
@@ -0,0 +1,136 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/audit"
+)
+
+// Number of prompts listed in Report.TopPrompts
+const topPrompts = 5
+
+// Usage is what one provider did in a time window
+type Usage struct {
+	Provider    string `json:"provider,omitempty"`
+	Prompts     int    `json:"prompts"`     // Prompts it answered
+	Suggestions int    `json:"suggestions"` // Commands it suggested in them
+	Executed    int    `json:"executed"`    // Commands that ran, from the audit log
+	Failed      int    `json:"failed"`      // Of those, the ones that exited with an error or couldn't start
+	Tokens      int    `json:"tokens"`      // Of the prompts and responses of all its requests
+	Estimated   bool   `json:"estimated"`   // Whether some of the tokens were estimated
+}
+
+// PromptCount is a prompt and how often it was asked
+type PromptCount struct {
+	Prompt string `json:"prompt"`
+	Count  int    `json:"count"`
+}
+
+// Report is the activity of a time window by provider, with the prompts asked most
+type Report struct {
+	Since      time.Time     `json:"since"`
+	Providers  []*Usage      `json:"providers"`
+	Total      Usage         `json:"total"`
+	TopPrompts []PromptCount `json:"top_prompts"`
+}
+
+// Returns the totals of the requests among the activities by provider and model, like the ones of stats.json
+func Totals(activities []Activity) []*Entry {
+	s := &Stats{Entries: map[string]*Entry{}}
+	for _, a := range activities {
+		if a.Kind != RequestActivity {
+			continue
+		}
+		key := a.Provider + "/" + a.Model
+		entry, ok := s.Entries[key]
+		if !ok {
+			entry = &Entry{Provider: a.Provider, Model: a.Model}
+			s.Entries[key] = entry
+		}
+		entry.Requests++
+		entry.PromptTokens += a.PromptTokens
+		entry.ResponseTokens += a.ResponseTokens
+		if a.Estimated {
+			entry.Estimated++
+		}
+		if a.Unpriced {
+			entry.Unpriced++
+		} else {
+			entry.Cost += a.Cost
+		}
+	}
+	return s.Sorted()
+}
+
+// Builds the report of the activity log and the commands of the audit log since the given time
+func NewReport(since time.Time, activities []Activity, executed []audit.Entry) Report {
+	report := Report{Since: since, Providers: []*Usage{}, TopPrompts: []PromptCount{}}
+	byProvider := map[string]*Usage{}
+	usage := func(provider string) *Usage {
+		if byProvider[provider] == nil {
+			byProvider[provider] = &Usage{Provider: provider}
+			report.Providers = append(report.Providers, byProvider[provider])
+		}
+		return byProvider[provider]
+	}
+
+	prompts := map[string]int{}
+	for _, a := range activities {
+		u := usage(a.Provider)
+		switch a.Kind {
+		case PromptActivity:
+			u.Prompts++
+			u.Suggestions += a.Suggestions
+			if prompt := strings.TrimSpace(a.Prompt); prompt != "" {
+				prompts[prompt]++
+			}
+		case RequestActivity:
+			u.Tokens += a.PromptTokens + a.ResponseTokens
+			u.Estimated = u.Estimated || a.Estimated
+		}
+	}
+	for _, entry := range executed {
+		u := usage(entry.Provider)
+		u.Executed++
+		// Commands handed to tmux have no exit code, they count as run
+		if entry.Status == "" && entry.ExitCode != 0 {
+			u.Failed++
+		}
+	}
+
+	sort.Slice(report.Providers, func(i, j int) bool {
+		return report.Providers[i].Provider < report.Providers[j].Provider
+	})
+	for _, u := range report.Providers {
+		report.Total.Prompts += u.Prompts
+		report.Total.Suggestions += u.Suggestions
+		report.Total.Executed += u.Executed
+		report.Total.Failed += u.Failed
+		report.Total.Tokens += u.Tokens
+		report.Total.Estimated = report.Total.Estimated || u.Estimated
+	}
+
+	for prompt, count := range prompts {
+		report.TopPrompts = append(report.TopPrompts, PromptCount{Prompt: prompt, Count: count})
+	}
+	sort.Slice(report.TopPrompts, func(i, j int) bool {
+		if report.TopPrompts[i].Count != report.TopPrompts[j].Count {
+			return report.TopPrompts[i].Count > report.TopPrompts[j].Count
+		}
+		return report.TopPrompts[i].Prompt < report.TopPrompts[j].Prompt
+	})
+	if len(report.TopPrompts) > topPrompts {
+		report.TopPrompts = report.TopPrompts[:topPrompts]
+	}
+	return report
+}
+
+// Returns the share of suggested commands that ran, as a whole percentage
+func (u Usage) RunRate() int {
+	if u.Suggestions == 0 {
+		return 0
+	}
+	return min(100, u.Executed*100/u.Suggestions)
+}
@@ -0,0 +1,201 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+const statsFile = "stats.json"
+
+// Price of a model in US dollars per million tokens
+type Price struct {
+	Prompt   float64 `json:"prompt"`
+	Response float64 `json:"response"`
+}
+
+// Known list prices, the prices setting adds to and overrides these. Ollama runs on the user's own hardware.
+var DefaultPrices = map[string]Price{
+	"gemini-pro":       {Prompt: 0.50, Response: 1.50},
+	"gemini-1.0-pro":   {Prompt: 0.50, Response: 1.50},
+	"gemini-1.5-flash": {Prompt: 0.35, Response: 1.05},
+	"gemini-1.5-pro":   {Prompt: 3.50, Response: 10.50},
+}
+
+// Parses the prices setting, a JSON object of model names to prices such as {"gpt-4o": {"prompt": 5, "response": 15}}
+func ParsePrices(text string) (map[string]Price, error) {
+	prices := map[string]Price{}
+	if err := json.Unmarshal([]byte(text), &prices); err != nil {
+		return nil, fmt.Errorf("prices must be a JSON object such as {\"gpt-4o\": {\"prompt\": 5, \"response\": 15}}: %w", err)
+	}
+	for model, price := range prices {
+		if price.Prompt < 0 || price.Response < 0 {
+			return nil, fmt.Errorf("the price of %s can't be negative", model)
+		}
+	}
+	return prices, nil
+}
+
+// Returns the cost in dollars of a request, false when the price of the model isn't known
+func Cost(provider string, model string, promptTokens int, responseTokens int, prices map[string]Price) (float64, bool) {
+	if provider == "local" {
+		return 0, true
+	}
+	price, ok := prices[model]
+	if !ok {
+		price, ok = DefaultPrices[model]
+	}
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*price.Prompt + float64(responseTokens)*price.Response) / 1e6, true
+}
+
+// Entry accumulates the usage of one provider and model
+type Entry struct {
+	Provider       string  `json:"provider"`
+	Model          string  `json:"model"`
+	Requests       int     `json:"requests"`
+	PromptTokens   int     `json:"prompt_tokens"`
+	ResponseTokens int     `json:"response_tokens"`
+	Estimated      int     `json:"estimated"` // Requests whose tokens were estimated rather than reported
+	Cost           float64 `json:"cost"`
+	Unpriced       int     `json:"unpriced"` // Requests to models without a known price, not part of Cost
+}
+
+// Stats are the totals kept in the state directory
+type Stats struct {
+	Since   time.Time         `json:"since"`
+	Entries map[string]*Entry `json:"entries"`
+}
+
+// Returns the path of the stats file
+func Path() (string, error) {
+	return io.GetFilePath(io.State, statsFile)
+}
+
+// Loads the totals, a missing file means nothing was recorded yet
+func Load() (*Stats, error) {
+	s := &Stats{Entries: map[string]*Entry{}}
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if s.Entries == nil {
+		s.Entries = map[string]*Entry{}
+	}
+	return s, nil
+}
+
+// Adds a request to the totals and writes them back, and appends it to the activity log
+func Record(provider string, model string, promptTokens int, responseTokens int, estimated bool, prices map[string]Price) error {
+	s, err := Load()
+	if err != nil {
+		return err
+	}
+	if s.Since.IsZero() {
+		s.Since = time.Now()
+	}
+
+	key := provider + "/" + model
+	entry, ok := s.Entries[key]
+	if !ok {
+		entry = &Entry{Provider: provider, Model: model}
+		s.Entries[key] = entry
+	}
+	entry.Requests++
+	entry.PromptTokens += promptTokens
+	entry.ResponseTokens += responseTokens
+	if estimated {
+		entry.Estimated++
+	}
+	cost, priced := Cost(provider, model, promptTokens, responseTokens, prices)
+	if priced {
+		entry.Cost += cost
+	} else {
+		entry.Unpriced++
+	}
+	if err := s.save(); err != nil {
+		return err
+	}
+	return appendActivity(Activity{Kind: RequestActivity, Provider: provider, Model: model, PromptTokens: promptTokens, ResponseTokens: responseTokens, Estimated: estimated, Cost: cost, Unpriced: !priced})
+}
+
+// Removes all recorded totals and the activity log
+func Reset() error {
+	for _, pathOf := range []func() (string, error){Path, ActivityPath} {
+		path, err := pathOf()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the entries sorted by provider and model
+func (s *Stats) Sorted() []*Entry {
+	entries := make([]*Entry, 0, len(s.Entries))
+	for _, entry := range s.Entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Provider != entries[j].Provider {
+			return entries[i].Provider < entries[j].Provider
+		}
+		return entries[i].Model < entries[j].Model
+	})
+	return entries
+}
+
+func (s *Stats) save() error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Formats a token count compactly, 1234 becomes 1.2k
+func FormatTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+// Formats a cost in dollars, keeping the digits that matter for fractions of a cent
+func FormatCost(cost float64) string {
+	if cost < 0.01 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
@@ -0,0 +1,648 @@
+package tea
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/format"
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// Whether the screen reader friendly interface of --accessible replaces the TUI
+var accessible bool
+
+// SetAccessible switches the TUI, its line editors and the chat to plain text printed once and read from stdin,
+// for screen readers that can't follow a view that is redrawn all the time. The mouse is turned off with it.
+func SetAccessible(enabled bool) {
+	accessible = enabled
+	if enabled {
+		mouse = false
+	}
+}
+
+// IsAccessible reports whether SetAccessible turned the accessible interface on
+func IsAccessible() bool {
+	return accessible
+}
+
+// Accessible stands in for the tea program of InitialModel with --accessible. It takes the same messages,
+// prints the response line by line as it streams in and asks for the commands to run in a numbered menu.
+// Run ends with a model the accessors such as Interrupted work on.
+type Accessible struct {
+	ctx       context.Context
+	msgs      chan tea.Msg
+	done      chan struct{}
+	m         model
+	streaming int               // Candidate printed while it streams in
+	printed   int               // Bytes of it printed so far
+	shown     map[int]bool      // Candidates printed in full
+	edits     map[[2]int]string // Commands changed in the menu by candidate and index
+}
+
+// NewAccessible returns the accessible interface, it stops with the given context like the tea program does
+func NewAccessible(ctx context.Context, cmds *[]string, local bool, runDir string) *Accessible {
+	return &Accessible{
+		ctx:   ctx,
+		msgs:  make(chan tea.Msg, 64),
+		done:  make(chan struct{}),
+		m:     InitialModel(cmds, local, runDir),
+		shown: map[int]bool{},
+		edits: map[[2]int]string{},
+	}
+}
+
+// Send hands a message to the interface, it is dropped once Run returned
+func (a *Accessible) Send(msg tea.Msg) {
+	select {
+	case a.msgs <- msg:
+	case <-a.done:
+	}
+}
+
+// Quit ends Run without running anything
+func (a *Accessible) Quit() {
+	a.Send(tea.QuitMsg{})
+}
+
+// Run prints the response and asks for the commands until the response is complete and answered
+func (a *Accessible) Run() (tea.Model, error) {
+	defer close(a.done)
+	for {
+		select {
+		case <-a.ctx.Done():
+			a.m.interrupted = true
+			return a.m, nil
+		case msg := <-a.msgs:
+			if a.handle(msg) {
+				return a.m, nil
+			}
+		}
+	}
+}
+
+// Handles a message like model.Update does, reporting whether the interface is done
+func (a *Accessible) handle(msg tea.Msg) bool {
+	switch msg := msg.(type) {
+	case tea.QuitMsg:
+		return true
+	case AppendResponseMsg:
+		a.m.appendCandidate(0, string(msg))
+		a.printStreamed(false)
+	case AppendCandidateMsg:
+		a.m.appendCandidate(msg.Index, msg.Text)
+		if msg.Index == a.streaming {
+			a.printStreamed(false)
+		}
+	case GenerationDoneMsg:
+		a.m.isDone = true
+		a.m.took = time.Since(a.m.started)
+		a.m.showCandidate(a.m.current)
+		a.printStreamed(true)
+		return a.menu()
+	case regeneratedMsg:
+		final, _ := a.m.finishRegeneration(msg)
+		a.m = final.(model)
+		a.m.runQueued = false
+		a.printStreamed(true)
+		if a.m.status != "" {
+			a.println(a.m.status)
+		}
+		return a.menu()
+	case ErrorMsg:
+		// A cancelled generation needs no explanation, the user closed the program or asked to stop
+		if !errors.Is(msg.Err, context.Canceled) {
+			a.m.err = msg.Err
+			a.printStreamed(true)
+			a.println("Error: " + msg.Err.Error())
+		}
+		return true
+	case ResetResponseMsg:
+		a.update(msg)
+		a.printed = 0
+		a.println("The request is sent again, the response starts over.")
+	case ResetCandidateMsg:
+		a.update(msg)
+		if msg.Index == a.streaming {
+			a.printed = 0
+			a.println("The request is sent again, the response starts over.")
+		}
+	case PagerMsg:
+		// The response is printed in full anyway
+	case RetryingMsg, StatusMsg:
+		a.update(msg)
+		a.println(a.m.status)
+	case HeaderMsg:
+		a.println(string(msg))
+	case FellBackMsg, RaceWonMsg:
+		a.update(msg)
+		a.println(a.m.fellBack + ".")
+	case CandidateLabelsMsg:
+		// The streamed candidate is named like the alternatives printed after it
+		a.update(msg)
+		a.println(fmt.Sprintf("Alternative %d%s:", a.streaming+1, a.m.candidateSource(a.streaming)))
+	case WaitingMsg:
+		a.update(msg)
+		if msg.Model != "" {
+			a.println("Waiting for " + msg.Model + "…")
+		}
+	default:
+		a.update(msg)
+	}
+	return false
+}
+
+// Keeps the state of a message that prints nothing, as the TUI does
+func (a *Accessible) update(msg tea.Msg) {
+	updated, _ := a.m.Update(msg)
+	a.m = updated.(model)
+}
+
+func (a *Accessible) println(line string) {
+	fmt.Println(format.Styled(line))
+}
+
+// Prints the lines of the streaming candidate that are complete, and with final the rest of it
+func (a *Accessible) printStreamed(final bool) {
+	text := a.m.candidates[a.streaming]
+	if a.printed > len(text) {
+		a.printed = 0
+	}
+	rest := text[a.printed:]
+	if !final {
+		end := strings.LastIndexByte(rest, '\n')
+		if end < 0 {
+			return
+		}
+		rest = rest[:end+1]
+	}
+	a.printed += len(rest)
+	if final {
+		a.shown[a.streaming] = true
+	}
+	if rest == "" {
+		return
+	}
+	// Markers of commands may only be taken out of whole lines
+	fmt.Print(format.Styled(a.m.highlight(rest)))
+	if final {
+		if !strings.HasSuffix(rest, "\n") {
+			fmt.Println()
+		}
+	}
+}
+
+// A command of the menu
+type menuEntry struct {
+	candidate int
+	index     int
+	command   string
+}
+
+// Lists the commands of every suggestion and reads what to do with them, reporting whether the interface is done
+func (a *Accessible) menu() bool {
+	// Suggestions generated alongside the streamed one are printed once they are complete
+	for c, text := range a.m.candidates {
+		if !a.shown[c] && strings.TrimSpace(text) != "" {
+			a.println(fmt.Sprintf("\nAlternative %d%s:", c+1, a.m.candidateSource(c)))
+			a.println(commands.HighlightCommands(format.TrimWhitespace(text)))
+			a.shown[c] = true
+		}
+	}
+	if footer := a.m.footer(); footer != "" {
+		a.println(footer)
+	}
+	for _, warning := range a.m.demoted {
+		a.println("Warning: " + warning)
+	}
+
+	entries := a.entries()
+	if len(entries) == 0 {
+		a.m.commandless = true
+		return true
+	}
+
+	a.println("\nCommands:")
+	for i, e := range entries {
+		line := fmt.Sprintf("%d. %s", i+1, e.command)
+		if commands.InteractiveFamily(e.command) != "" {
+			line += " (asks questions)"
+		}
+		a.println(line)
+	}
+	var cmds []string
+	for _, e := range entries {
+		cmds = append(cmds, e.command)
+	}
+	if commands.ContainsSudo(cmds) {
+		a.println("Warning: some commands use sudo, review them thoroughly before running them.")
+	}
+	if a.m.runDir != "" {
+		a.println("Selected commands will run in " + a.m.runDir + ".")
+	}
+	a.println(a.menuHelp())
+
+	for {
+		fmt.Print("> ")
+		line, ok := a.readLine()
+		if !ok {
+			a.m.interrupted = true
+			return true
+		}
+		word, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch strings.ToLower(word) {
+		case "", "q", "quit":
+			return true
+		case "all":
+			return a.finish(entries, allNumbers(len(entries)))
+		case "explain":
+			a.explainEntry(entries, rest)
+		case "edit":
+			if n, ok := a.number(rest, len(entries)); ok {
+				fmt.Printf("Command %d is: %s\nNew command, or press enter to keep it: ", n, entries[n-1].command)
+				if edited, ok := a.readLine(); ok && strings.TrimSpace(edited) != "" {
+					e := &entries[n-1]
+					e.command = strings.TrimSpace(edited)
+					a.edits[[2]int{e.candidate, e.index}] = e.command
+					a.println(fmt.Sprintf("Command %d is now: %s", n, entries[n-1].command))
+				}
+			}
+		case "save":
+			a.save(entries, rest)
+		case "fav":
+			a.saveFavorite(entries, rest)
+		case "tmux":
+			if a.m.tmux == nil {
+				a.println("tmux is only available inside tmux.")
+				continue
+			}
+			if numbers, ok := a.numbers(rest, len(entries)); ok {
+				a.m.toTmux = true
+				return a.finish(entries, numbers)
+			}
+		case "again":
+			if a.m.regenerate == nil {
+				a.println("No other suggestion can be asked for.")
+				continue
+			}
+			a.println("Asking for a different suggestion…")
+			return a.startRegeneration()
+		default:
+			if numbers, ok := a.numbers(line, len(entries)); ok {
+				return a.finish(entries, numbers)
+			}
+		}
+	}
+}
+
+// Returns the commands of every suggestion in order, with the edits made in the menu
+func (a *Accessible) entries() []menuEntry {
+	var entries []menuEntry
+	if a.m.noCommands {
+		return nil
+	}
+	for c := range a.m.candidates {
+		for i, cmd := range a.m.extractors[c].Update(a.m.candidates[c], true) {
+			if edited, ok := a.edits[[2]int{c, i}]; ok {
+				cmd = edited
+			}
+			entries = append(entries, menuEntry{candidate: c, index: i, command: cmd})
+		}
+	}
+	return entries
+}
+
+// Explains what the words of the menu do, only naming what is available
+func (a *Accessible) menuHelp() string {
+	action := "run"
+	if a.m.script.SaveOnRun {
+		action = "save to " + a.m.script.Path
+	} else if a.m.toTmux {
+		action = "run in tmux"
+	}
+	help := "Enter numbers to " + action + ", separated by commas, or all. explain and a number explains a command, edit and a number changes it"
+	if a.m.script.Save != nil && !a.m.script.SaveOnRun {
+		help += ", save and numbers saves them as a script"
+	}
+	if a.m.favorite != nil {
+		help += ", fav and a number saves it as a favorite"
+	}
+	if a.m.tmux != nil && !a.m.toTmux {
+		help += ", tmux and numbers runs them in tmux"
+	}
+	if a.m.regenerate != nil {
+		help += ", again asks for a different suggestion"
+	}
+	return help + ". Press enter to quit."
+}
+
+// Hands the chosen commands over like the run button of the TUI
+func (a *Accessible) finish(entries []menuEntry, numbers []int) bool {
+	for _, n := range numbers {
+		*a.m.commands = append(*a.m.commands, entries[n-1].command)
+	}
+	return true
+}
+
+// Saves the chosen commands, or all of them, to a script named at the prompt
+func (a *Accessible) save(entries []menuEntry, rest string) {
+	if a.m.script.Save == nil {
+		a.println("Saving a script isn't available here.")
+		return
+	}
+	numbers := allNumbers(len(entries))
+	if strings.TrimSpace(rest) != "" {
+		var ok bool
+		if numbers, ok = a.numbers(rest, len(entries)); !ok {
+			return
+		}
+	}
+	fmt.Printf("Save the script to (enter for %s): ", a.m.script.Path)
+	path, ok := a.readLine()
+	if !ok {
+		return
+	}
+	if path = strings.TrimSpace(path); path == "" {
+		path = a.m.script.Path
+	}
+	var cmds []string
+	for _, n := range numbers {
+		cmds = append(cmds, entries[n-1].command)
+	}
+	if err := a.m.script.Save(path, cmds); err != nil {
+		a.println(fmt.Sprintf("Could not save the script: %v", err))
+		return
+	}
+	a.println(fmt.Sprintf("Saved %d command(s) to %s.", len(cmds), path))
+}
+
+// Saves the command with the given number as a favorite, with the tags typed at the prompt
+func (a *Accessible) saveFavorite(entries []menuEntry, rest string) {
+	if a.m.favorite == nil {
+		a.println("Favorites aren't available here.")
+		return
+	}
+	n, ok := a.number(rest, len(entries))
+	if !ok {
+		return
+	}
+	fmt.Print("Tags, separated by commas (enter for none): ")
+	tags, ok := a.readLine()
+	if !ok {
+		return
+	}
+	if err := a.m.favorite(entries[n-1].command, tags); err != nil {
+		a.println(fmt.Sprintf("Could not save the favorite: %v", err))
+		return
+	}
+	a.println(fmt.Sprintf("Saved command %d as a favorite.", n))
+}
+
+// Prints the explanation of the command with the given number, waiting for it
+func (a *Accessible) explainEntry(entries []menuEntry, rest string) {
+	if a.m.explain == nil {
+		a.println("Explanations aren't available here.")
+		return
+	}
+	n, ok := a.number(rest, len(entries))
+	if !ok {
+		return
+	}
+	a.println("Explaining…")
+	explanation, err := a.m.explain(a.ctx, entries[n-1].command)
+	if err != nil || explanation == "" {
+		a.println("Could not explain the command.")
+		return
+	}
+	a.println(explanation)
+}
+
+// Asks for another suggestion, which is printed as it streams in like the first one
+func (a *Accessible) startRegeneration() bool {
+	started, cmd := a.m.startRegeneration()
+	a.m = started.(model)
+	a.streaming = a.m.current
+	a.printed = 0
+	go func() {
+		a.Send(cmd())
+	}()
+	return false
+}
+
+// Parses a single command number
+func (a *Accessible) number(text string, count int) (int, bool) {
+	numbers, ok := a.numbers(text, count)
+	if !ok {
+		return 0, false
+	}
+	if len(numbers) != 1 {
+		a.println("Enter a single number.")
+		return 0, false
+	}
+	return numbers[0], true
+}
+
+// Parses numbers separated by commas or spaces, saying what is wrong with them
+func (a *Accessible) numbers(text string, count int) ([]int, bool) {
+	fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 {
+		a.println(fmt.Sprintf("Enter a number from 1 to %d.", count))
+		return nil, false
+	}
+	var numbers []int
+	for _, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 || n > count {
+			a.println(fmt.Sprintf("%q isn't a command, enter numbers from 1 to %d.", field, count))
+			return nil, false
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, true
+}
+
+func allNumbers(count int) []int {
+	numbers := make([]int, count)
+	for i := range numbers {
+		numbers[i] = i + 1
+	}
+	return numbers
+}
+
+// Reads a line from stdin, false when the context ended first
+func (a *Accessible) readLine() (string, bool) {
+	line := make(chan string, 1)
+	go func() {
+		line <- commands.ReadLine()
+	}()
+	select {
+	case l := <-line:
+		return l, true
+	case <-a.ctx.Done():
+		return "", false
+	}
+}
+
+// Asks for a replacement of a line in the accessible interface, enter keeps it
+func editLineAccessible(prompt string, text string) (string, bool, error) {
+	fmt.Printf("%s%s\nType a replacement, or press enter to keep it: ", prompt, text)
+	edited := strings.TrimSpace(commands.ReadLine())
+	if edited == "" {
+		return text, true, nil
+	}
+	return edited, true, nil
+}
+
+// Shows a text in the accessible interface and offers to edit it in $EDITOR, which the screen reader can follow
+func editTextAccessible(title string, text string) (string, bool, error) {
+	fmt.Printf("%s\n%s\n", title, text)
+	for {
+		fmt.Print("Press enter to use it, e to edit it in your editor, or n to cancel: ")
+		switch strings.ToLower(strings.TrimSpace(commands.ReadLine())) {
+		case "":
+			return text, true, nil
+		case "n":
+			return "", false, nil
+		case "e":
+			edited, err := editInEditor(text)
+			if err != nil {
+				return "", false, err
+			}
+			text = edited
+			fmt.Printf("%s\n", text)
+		}
+	}
+}
+
+// Opens text in the editor of $VISUAL or $EDITOR, returning it as saved
+func editInEditor(text string) (string, error) {
+	file, err := os.CreateTemp("", "lexido-*.txt")
+	if err != nil {
+		return "", err
+	}
+	path := file.Name()
+	defer os.Remove(path)
+	_, err = file.WriteString(text)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	cmd := openCommand(editor(), path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	saved, err := os.ReadFile(path)
+	return string(saved), err
+}
+
+// Runs the chat as lines typed on stdin, replies are printed as they stream in and their commands picked by number
+func runChatAccessible(opts ChatOptions) ([]io.Turn, error) {
+	m := newChatModel(opts)
+	fmt.Println("Chat with lexido. Type a message, or /reset, /save <file>, /model <name> and /exit. Ctrl-C quits.")
+	if initial := strings.TrimSpace(opts.Initial); initial != "" {
+		m.replyAccessible(initial)
+	}
+	for {
+		fmt.Print("\nYou: ")
+		text := strings.TrimSpace(commands.ReadLine())
+		switch {
+		case text == "":
+			continue
+		case text == "/exit" || text == "/quit":
+			return m.turns, nil
+		case strings.HasPrefix(text, "/"):
+			m.slashCommand(text)
+			fmt.Println(m.notice)
+		default:
+			m.replyAccessible(text)
+		}
+	}
+}
+
+// Asks for the reply to text, prints it and offers to run its commands
+func (m *chatModel) replyAccessible(text string) {
+	m.turns = append(m.turns, io.Turn{Role: "user", Content: text, Timestamp: time.Now()})
+	fmt.Println("lexido:")
+	printed := 0
+	reply := ""
+	printLines := func(final bool) {
+		rest := reply[min(printed, len(reply)):]
+		if !final {
+			end := strings.LastIndexByte(rest, '\n')
+			if end < 0 {
+				return
+			}
+			rest = rest[:end+1]
+		}
+		printed += len(rest)
+		fmt.Print(format.Styled(commands.HighlightCommands(rest)))
+	}
+	response, err := m.opts.Generate(context.Background(), io.RenderConversation(m.turns), func(msg tea.Msg) {
+		switch msg := msg.(type) {
+		case AppendResponseMsg:
+			reply += string(msg)
+		case AppendCandidateMsg:
+			if msg.Index == 0 {
+				reply += msg.Text
+			}
+		case ResetResponseMsg:
+			reply, printed = "", 0
+			fmt.Println("The request is sent again, the reply starts over.")
+		case FellBackMsg:
+			fmt.Println(msg.String() + ".")
+		}
+		printLines(false)
+	})
+	printLines(true)
+	fmt.Println()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Println("Error: " + err.Error())
+	}
+	if strings.TrimSpace(response) == "" {
+		// Nothing came back, drop the question so it isn't left unanswered in the history
+		m.turns = m.turns[:len(m.turns)-1]
+		return
+	}
+	m.turns = append(m.turns, io.Turn{Role: "assistant", Content: response, Timestamp: time.Now(), Provider: m.opts.Provider})
+
+	choices := commands.ParseCommands(response)
+	if len(choices) == 0 {
+		return
+	}
+	fmt.Println("Commands:")
+	for i, choice := range choices {
+		fmt.Printf("%d. %s\n", i+1, choice)
+	}
+	for {
+		fmt.Print("Enter numbers to run, separated by commas, or press enter to skip: ")
+		line := commands.ReadLine()
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+		var picked []string
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' }) {
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 1 || n > len(choices) {
+				fmt.Printf("%q isn't a command, enter numbers from 1 to %d.\n", field, len(choices))
+				picked = nil
+				break
+			}
+			picked = append(picked, choices[n-1])
+		}
+		if len(picked) == 0 {
+			continue
+		}
+		m.turns[len(m.turns)-1].CommandsRun = append(m.turns[len(m.turns)-1].CommandsRun, picked...)
+		m.opts.Run(picked)
+		return
+	}
+}
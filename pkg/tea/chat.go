@@ -0,0 +1,454 @@
+package tea
+
+import (
+	"context"
+	"fmt"
+	goio "io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/commands"
+	"github.com/micr0-dev/lexido/pkg/format"
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// ChatOptions connects a chat session to the provider and command runner set up by main
+type ChatOptions struct {
+	Turns    []io.Turn // Earlier turns of the conversation cache, continued with -c
+	Initial  string    // First message, sent as soon as the session starts
+	Provider string    // Recorded with the replies in the conversation cache
+	// Generate streams the reply to the conversation through send and returns it in full
+	Generate func(ctx context.Context, conversation string, send func(tea.Msg)) (string, error)
+	// Run executes the selected commands while the TUI has released the terminal
+	Run func(cmds []string)
+	// SetModel switches the model used for the following turns
+	SetModel func(name string) error
+	RunDir   string
+}
+
+type chatModel struct {
+	opts     ChatOptions
+	input    textinput.Model
+	viewport viewport.Model
+	spinner  spinner.Model
+	turns    []io.Turn
+	reply    string
+	status   string
+	notice   string
+	choices  []string
+	selected []bool
+	cursor   int
+	picking  bool
+	cancel   context.CancelFunc
+	width    int
+	ready    bool
+}
+
+// Messages of a reply that is being generated, relayed from the generating goroutine
+type chatStreamMsg struct {
+	msg tea.Msg
+	ch  <-chan tea.Msg
+}
+
+type chatDoneMsg struct {
+	response string
+	err      error
+}
+
+type chatRanMsg struct {
+	count int
+	err   error
+}
+
+// Waits for the next message of the reply being generated
+func waitForChat(ch <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-ch
+		if !ok {
+			return nil
+		}
+		if done, ok := msg.(chatDoneMsg); ok {
+			return done
+		}
+		return chatStreamMsg{msg: msg, ch: ch}
+	}
+}
+
+// Runs the selected commands of a chat turn, implementing tea.ExecCommand so the terminal is released meanwhile
+type chatRunner struct {
+	run  func(cmds []string)
+	cmds []string
+}
+
+func (r chatRunner) Run() error {
+	r.run(r.cmds)
+	fmt.Print("\nPress enter to return to the chat...")
+	var line string
+	fmt.Scanln(&line)
+	return nil
+}
+
+func (r chatRunner) SetStdin(goio.Reader)  {}
+func (r chatRunner) SetStdout(goio.Writer) {}
+func (r chatRunner) SetStderr(goio.Writer) {}
+
+func newChatModel(opts ChatOptions) chatModel {
+	input := textinput.New()
+	input.Placeholder = "Ask lexido something, or /reset, /save <file>, /model <name>"
+	input.Prompt = "> "
+	input.Focus()
+
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+
+	return chatModel{
+		opts:    opts,
+		input:   input,
+		spinner: s,
+		turns:   opts.Turns,
+	}
+}
+
+func (m chatModel) Init() tea.Cmd {
+	cmds := []tea.Cmd{textinput.Blink, m.spinner.Tick}
+	if strings.TrimSpace(m.opts.Initial) != "" {
+		cmds = append(cmds, func() tea.Msg {
+			return chatSubmitMsg(m.opts.Initial)
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+// Sends a message as if it was typed into the input box
+type chatSubmitMsg string
+
+func (m chatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = min(msg.Width, maxWidth)
+		m.input.Width = m.width - 3
+		if !m.ready {
+			m.viewport = viewport.New(m.width, max(msg.Height-4, 3))
+			m.ready = true
+		} else {
+			m.viewport.Width = m.width
+			m.viewport.Height = max(msg.Height-4, 3)
+		}
+		m.refresh()
+		return m, nil
+	case chatSubmitMsg:
+		return m.submit(string(msg))
+	case chatStreamMsg:
+		switch inner := msg.msg.(type) {
+		case AppendResponseMsg:
+			m.reply += string(inner)
+			m.status = ""
+		case AppendCandidateMsg:
+			if inner.Index == 0 {
+				m.reply += inner.Text
+				m.status = ""
+			}
+		case RetryingMsg:
+			m.status = fmt.Sprintf("%s, retrying in %s… (attempt %d/%d)", inner.Reason, inner.Wait.Round(time.Second), inner.Attempt, inner.Max)
+		case ResetResponseMsg:
+			m.reply = ""
+		case FellBackMsg:
+			m.notice = inner.String()
+		}
+		m.refresh()
+		return m, waitForChat(msg.ch)
+	case chatDoneMsg:
+		m.cancel = nil
+		m.status = ""
+		response := msg.response
+		if msg.err != nil && msg.err != context.Canceled {
+			m.notice = "Error: " + msg.err.Error()
+		}
+		if strings.TrimSpace(response) != "" {
+			m.turns = append(m.turns, io.Turn{Role: "assistant", Content: response, Timestamp: time.Now(), Provider: m.opts.Provider})
+		} else {
+			// Nothing came back, drop the question so it isn't left unanswered in the history
+			m.turns = m.turns[:len(m.turns)-1]
+		}
+		m.reply = ""
+
+		m.choices = commands.ParseCommands(response)
+		m.selected = make([]bool, len(m.choices))
+		m.cursor = 0
+		m.picking = len(m.choices) > 0
+		if m.picking {
+			m.input.Blur()
+		}
+		m.refresh()
+		return m, nil
+	case chatRanMsg:
+		if msg.err != nil {
+			m.notice = "Error running commands: " + msg.err.Error()
+		} else {
+			m.notice = fmt.Sprintf("Ran %d command(s).", msg.count)
+		}
+		m.stopPicking()
+		m.refresh()
+		return m, nil
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			if m.cancel != nil {
+				m.cancel()
+			}
+			return m, tea.Quit
+		}
+		if m.cancel != nil {
+			// Only stopping is possible while a reply is being generated
+			if msg.String() == "esc" {
+				m.cancel()
+			}
+			return m, nil
+		}
+		if m.picking {
+			return m.updatePicking(msg)
+		}
+		switch msg.String() {
+		case "enter":
+			text := m.input.Value()
+			m.input.SetValue("")
+			return m.submit(text)
+		case "pgup", "pgdown":
+			var cmd tea.Cmd
+			m.viewport, cmd = m.viewport.Update(msg)
+			return m, cmd
+		}
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+
+	var cmds []tea.Cmd
+	var cmd tea.Cmd
+	m.spinner, cmd = m.spinner.Update(msg)
+	cmds = append(cmds, cmd)
+	m.input, cmd = m.input.Update(msg)
+	cmds = append(cmds, cmd)
+	return m, tea.Batch(cmds...)
+}
+
+// Handles keys while the commands of the last reply are being picked
+func (m chatModel) updatePicking(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	onCommand := m.cursor < len(m.choices)
+	switch {
+	case key.Matches(msg, keys.Quit):
+		m.stopPicking()
+	case key.Matches(msg, keys.Down):
+		if m.cursor < len(m.choices) {
+			m.cursor++
+		}
+	case key.Matches(msg, keys.Up):
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case key.Matches(msg, keys.Select) && onCommand:
+		m.selected[m.cursor] = !m.selected[m.cursor]
+	case key.Matches(msg, keys.Run):
+		var picked []string
+		for i, selected := range m.selected {
+			if selected {
+				picked = append(picked, m.choices[i])
+			}
+		}
+		if len(picked) == 0 {
+			m.stopPicking()
+			break
+		}
+		if last := len(m.turns) - 1; last >= 0 && m.turns[last].Role == "assistant" {
+			m.turns[last].CommandsRun = append(m.turns[last].CommandsRun, picked...)
+		}
+		return m, tea.Exec(chatRunner{run: m.opts.Run, cmds: picked}, func(err error) tea.Msg {
+			return chatRanMsg{count: len(picked), err: err}
+		})
+	}
+	m.refresh()
+	return m, nil
+}
+
+func (m *chatModel) stopPicking() {
+	m.picking = false
+	m.choices = nil
+	m.selected = nil
+	m.input.Focus()
+}
+
+// Handles a line typed into the input box, either a slash command or a message for the model
+func (m chatModel) submit(text string) (tea.Model, tea.Cmd) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return m, nil
+	}
+	m.notice = ""
+
+	if strings.HasPrefix(text, "/") {
+		m.slashCommand(text)
+		m.refresh()
+		return m, nil
+	}
+
+	m.turns = append(m.turns, io.Turn{Role: "user", Content: text, Timestamp: time.Now()})
+	conversation := io.RenderConversation(m.turns)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+
+	ch := make(chan tea.Msg, 64)
+	generate := m.opts.Generate
+	go func() {
+		response, err := generate(ctx, conversation, func(msg tea.Msg) { ch <- msg })
+		ch <- chatDoneMsg{response: response, err: err}
+		close(ch)
+	}()
+
+	m.refresh()
+	return m, waitForChat(ch)
+}
+
+// Runs one of the slash commands understood by the chat
+func (m *chatModel) slashCommand(text string) {
+	name, arg, _ := strings.Cut(text, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "/reset":
+		m.turns = nil
+		m.notice = "Conversation reset."
+	case "/save":
+		if arg == "" {
+			m.notice = "Usage: /save <file>"
+			return
+		}
+		if err := os.WriteFile(arg, []byte(io.RenderConversation(m.turns)), 0644); err != nil {
+			m.notice = "Error saving transcript: " + err.Error()
+			return
+		}
+		m.notice = "Transcript saved to " + arg + "."
+	case "/model":
+		if arg == "" {
+			m.notice = "Usage: /model <name>"
+			return
+		}
+		if err := m.opts.SetModel(arg); err != nil {
+			m.notice = "Error switching model: " + err.Error()
+			return
+		}
+		m.notice = "Now using " + arg + "."
+	case "/exit", "/quit":
+		m.notice = "Press ctrl+c to leave the chat."
+	default:
+		m.notice = "Unknown command " + name + ", try /reset, /save <file> or /model <name>."
+	}
+}
+
+// Re-renders the conversation into the viewport, keeping it scrolled to the latest message
+func (m *chatModel) refresh() {
+	if !m.ready {
+		return
+	}
+
+	var s strings.Builder
+	for _, turn := range m.turns {
+		s.WriteString(m.renderTurn(turn.Role, turn.Content))
+	}
+	if m.cancel != nil {
+		if m.reply == "" {
+			status := m.status
+			if status == "" {
+				status = "Thinking..."
+			}
+			s.WriteString(m.spinner.View() + status + "\n")
+		} else {
+			s.WriteString(m.renderTurn("assistant", m.reply))
+		}
+	}
+
+	if m.picking {
+		s.WriteString("Command List:\n")
+		for i, choice := range m.choices {
+			mark, color := " ", format.Reset
+			if m.selected[i] {
+				mark, color = "x", format.Code(format.Selected)
+			}
+			cursor := "  "
+			if m.cursor == i {
+				cursor = "> "
+			}
+			s.WriteString(cursor + color + "[" + mark + "] " + choice + format.Reset + "\n")
+		}
+		if m.cursor == len(m.choices) {
+			s.WriteString(">   " + format.Code(format.Selected) + "[RUN]" + format.Reset + "\n")
+		} else {
+			s.WriteString("    [RUN]\n")
+		}
+	}
+
+	m.viewport.SetContent(s.String())
+	m.viewport.GotoBottom()
+}
+
+func (m chatModel) renderTurn(role string, content string) string {
+	label := format.Code(format.Header) + "You:" + format.Reset + " "
+	if role == "assistant" {
+		label = format.Code(format.Header) + "lexido:" + format.Reset + " "
+	}
+	return format.WrapText(label+commands.HighlightCommands(format.TrimWhitespace(content)), m.width) + "\n\n"
+}
+
+func (m chatModel) View() string {
+	return format.Styled(m.view())
+}
+
+func (m chatModel) view() string {
+	if !m.ready {
+		return m.spinner.View() + "Starting chat..."
+	}
+
+	var help string
+	switch {
+	case m.cancel != nil:
+		help = "esc to stop generating, ctrl+c to quit"
+	case m.picking:
+		help = fmt.Sprintf("%s/%s to select, %s to toggle or run, %s to skip", keyName(keys.Up), keyName(keys.Down), keyName(keys.Select), keyName(keys.Quit))
+	default:
+		help = "enter to send, pgup/pgdown to scroll, ctrl+c to quit"
+	}
+	if m.notice != "" {
+		help = m.notice + "  " + help
+	}
+	if m.opts.RunDir != "" && m.picking {
+		help += "  (commands run in " + m.opts.RunDir + ")"
+	}
+
+	return m.viewport.View() + "\n" + m.input.View() + "\n" + format.Code(format.Footer) + help + format.Reset
+}
+
+// RunChat runs an interactive chat session and returns the turns of the whole conversation
+func RunChat(opts ChatOptions) ([]io.Turn, error) {
+	if accessible {
+		return runChatAccessible(opts)
+	}
+	options := []tea.ProgramOption{tea.WithAltScreen()}
+	if mouse {
+		// The wheel scrolls the conversation
+		options = append(options, tea.WithMouseCellMotion())
+	}
+	final, err := tea.NewProgram(newChatModel(opts), options...).Run()
+	if err != nil {
+		return nil, err
+	}
+	return final.(chatModel).turns, nil
+}
@@ -0,0 +1,111 @@
+package tea
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/format"
+)
+
+type editorModel struct {
+	title     string
+	textarea  textarea.Model
+	confirmed bool
+}
+
+func (m editorModel) Init() tea.Cmd {
+	return textarea.Blink
+}
+
+func (m editorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+s":
+			m.confirmed = true
+			return m, tea.Quit
+		case "esc", "ctrl+c":
+			return m, tea.Quit
+		}
+	case tea.WindowSizeMsg:
+		m.textarea.SetWidth(min(msg.Width, maxWidth))
+		m.textarea.SetHeight(max(msg.Height-4, 3))
+	}
+
+	var cmd tea.Cmd
+	m.textarea, cmd = m.textarea.Update(msg)
+	return m, cmd
+}
+
+func (m editorModel) View() string {
+	return format.Styled(m.title + "\n\n" + m.textarea.View() + "\n\nctrl+s to confirm, esc to cancel")
+}
+
+// EditText lets the user edit text before it is used, returning false if they cancelled
+func EditText(title string, text string) (string, bool, error) {
+	if accessible {
+		return editTextAccessible(title, text)
+	}
+	ta := textarea.New()
+	ta.ShowLineNumbers = false
+	ta.CharLimit = 0
+	ta.SetValue(text)
+	ta.Focus()
+
+	final, err := tea.NewProgram(editorModel{title: title, textarea: ta}).Run()
+	if err != nil {
+		return "", false, err
+	}
+	m := final.(editorModel)
+	return strings.TrimSpace(m.textarea.Value()), m.confirmed, nil
+}
+
+type lineModel struct {
+	input     textinput.Model
+	confirmed bool
+}
+
+func (m lineModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m lineModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter":
+			m.confirmed = true
+			return m, tea.Quit
+		case "esc", "ctrl+c":
+			return m, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m lineModel) View() string {
+	return format.Styled(m.input.View())
+}
+
+// EditLine lets the user edit a single line in place, returning false if they cancelled with esc
+func EditLine(prompt string, text string) (string, bool, error) {
+	if accessible {
+		return editLineAccessible(prompt, text)
+	}
+	input := textinput.New()
+	input.Prompt = prompt
+	input.SetValue(text)
+	input.CursorEnd()
+	input.Focus()
+
+	final, err := tea.NewProgram(lineModel{input: input}).Run()
+	if err != nil {
+		return "", false, err
+	}
+	m := final.(lineModel)
+	return strings.TrimSpace(m.input.Value()), m.confirmed, nil
+}
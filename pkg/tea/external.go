@@ -0,0 +1,96 @@
+package tea
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/commands"
+)
+
+// PagerMsg opens the response in $PAGER as soon as it is complete, for --pager
+type PagerMsg struct{}
+
+// Sent when the pager or editor the response was opened in exits. Edited is the saved file when it differs
+// from the response.
+type externalDoneMsg struct {
+	edited string
+	err    error
+}
+
+// Returns the pager from $PAGER, less or more where it isn't set
+func pager() string {
+	if p := os.Getenv("PAGER"); p != "" {
+		return p
+	}
+	if runtime.GOOS == "windows" {
+		return "more"
+	}
+	return "less"
+}
+
+// Returns the editor from $VISUAL or $EDITOR, vi or notepad where neither is set
+func editor() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if e := os.Getenv(env); e != "" {
+			return e
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// Builds the process of program opening path. The variables may hold arguments, e.g. "code --wait" or
+// "less -R", so they are run through the shell.
+func openCommand(program string, path string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/c", program, path)
+	}
+	return exec.Command("sh", "-c", program+` "$1"`, "sh", path)
+}
+
+// Writes the response to a temporary markdown file and opens it with program, the TUI is suspended
+// and gets the terminal back once it exits. With edit the saved file comes back as the new response.
+func openExternal(program string, response string, edit bool) tea.Cmd {
+	file, err := os.CreateTemp("", "lexido-*.md")
+	if err != nil {
+		return func() tea.Msg { return externalDoneMsg{err: err} }
+	}
+	path := file.Name()
+	_, err = file.WriteString(response)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return func() tea.Msg { return externalDoneMsg{err: err} }
+	}
+
+	return tea.ExecProcess(openCommand(program, path), func(err error) tea.Msg {
+		defer os.Remove(path)
+		if err != nil || !edit {
+			return externalDoneMsg{err: err}
+		}
+		saved, err := os.ReadFile(path)
+		if err != nil {
+			return externalDoneMsg{err: err}
+		}
+		if string(saved) == response {
+			return externalDoneMsg{}
+		}
+		return externalDoneMsg{edited: string(saved)}
+	})
+}
+
+// Replaces the response shown with the one saved in the editor, its commands are extracted again
+func (m *model) replaceResponse(edited string) {
+	m.candidates[m.current] = edited
+	m.extractors[m.current] = &commands.Extractor{}
+	m.picked[m.current] = nil
+	m.displayedContentLength = len(edited)
+	m.showCandidate(m.current)
+	m.status = "Using the edited response"
+}
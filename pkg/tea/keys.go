@@ -0,0 +1,217 @@
+package tea
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/micr0-dev/lexido/pkg/config"
+)
+
+func init() {
+	config.Register("keys", "actions: "+strings.Join(Actions(), ", "), func(val string) error {
+		keys := DefaultKeyMap()
+		return errors.Join(ParseKeys(&keys, val)...)
+	})
+}
+
+// KeyMap holds the keys of every action of the TUI, Ctrl-C always quits on top of them
+type KeyMap struct {
+	Up         key.Binding
+	Down       key.Binding
+	Select     key.Binding
+	Run        key.Binding
+	Quit       key.Binding
+	Explain    key.Binding
+	Copy       key.Binding
+	Favorite   key.Binding
+	Save       key.Binding
+	Tmux       key.Binding
+	Pager      key.Binding
+	Edit       key.Binding
+	Regenerate key.Binding
+	Stop       key.Binding
+	Next       key.Binding
+	Previous   key.Binding
+	Warnings   key.Binding
+	Help       key.Binding
+}
+
+// DefaultKeyMap returns the keys lexido uses unless the keys setting changes them
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Up:         key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "move up")),
+		Down:       key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "move down")),
+		Select:     key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "pick the command")),
+		Run:        key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "run the picked commands on [RUN]")),
+		Quit:       key.NewBinding(key.WithKeys("q", "esc"), key.WithHelp("q/esc", "quit")),
+		Explain:    key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "explain the command")),
+		Copy:       key.NewBinding(key.WithKeys("c"), key.WithHelp("c", "copy the command")),
+		Favorite:   key.NewBinding(key.WithKeys("*"), key.WithHelp("*", "save the command as a favorite")),
+		Save:       key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "save as a script")),
+		Tmux:       key.NewBinding(key.WithKeys("t"), key.WithHelp("t", "run in tmux")),
+		Pager:      key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "read in $PAGER")),
+		Edit:       key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "edit in $EDITOR")),
+		Regenerate: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "a different suggestion")),
+		Stop:       key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "stop generating")),
+		Next:       key.NewBinding(key.WithKeys("]"), key.WithHelp("]", "next alternative")),
+		Previous:   key.NewBinding(key.WithKeys("["), key.WithHelp("[", "previous alternative")),
+		Warnings:   key.NewBinding(key.WithKeys("w"), key.WithHelp("w", "show repeated warnings")),
+		Help:       key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "all keys")),
+	}
+}
+
+// Returns the bindings by the action names of the keys setting
+func (k *KeyMap) actions() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"up":         &k.Up,
+		"down":       &k.Down,
+		"select":     &k.Select,
+		"run":        &k.Run,
+		"quit":       &k.Quit,
+		"explain":    &k.Explain,
+		"copy":       &k.Copy,
+		"favorite":   &k.Favorite,
+		"save":       &k.Save,
+		"tmux":       &k.Tmux,
+		"pager":      &k.Pager,
+		"edit":       &k.Edit,
+		"regenerate": &k.Regenerate,
+		"stop":       &k.Stop,
+		"next":       &k.Next,
+		"previous":   &k.Previous,
+		"warnings":   &k.Warnings,
+		"help":       &k.Help,
+	}
+}
+
+// Actions lists the action names the keys setting accepts, sorted
+func Actions() []string {
+	var k KeyMap
+	var names []string
+	for name := range k.actions() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ShortHelp returns the three bindings of the hint line below the command list, the rest are behind help
+func (k KeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Select, k.Quit, k.Help}
+}
+
+// ResponseHelp returns the bindings of the hint line below a response that has no commands to pick
+func (k KeyMap) ResponseHelp() []key.Binding {
+	return []key.Binding{k.Stop, k.Quit}
+}
+
+// FinishedResponseHelp returns the bindings of the hint line below a complete response without commands,
+// regenerate only when a different suggestion can be asked for
+func (k KeyMap) FinishedResponseHelp(regenerate bool) []key.Binding {
+	if regenerate {
+		return []key.Binding{k.Regenerate, k.Pager, k.Edit, k.Quit}
+	}
+	return []key.Binding{k.Pager, k.Edit, k.Quit}
+}
+
+// Titles of the groups of FullHelp
+var helpSections = []string{"Navigation", "Selection", "Actions"}
+
+// FullHelp returns the bindings of the help overlay grouped like helpSections
+func (k KeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.Next, k.Previous},
+		{k.Select, k.Run, k.Explain, k.Copy, k.Favorite},
+		{k.Save, k.Tmux, k.Pager, k.Edit, k.Regenerate, k.Stop, k.Warnings, k.Help, k.Quit},
+	}
+}
+
+// Select and run share enter by default, select acts on a command and run on [RUN]
+var sharedActions = map[[2]string]bool{{"run", "select"}: true}
+
+// ParseKeys applies overrides like "quit=ctrl+q,down=j down" to keys, several keys of one action are
+// separated by spaces. It returns the unknown actions and the keys bound to more than one action as errors.
+func ParseKeys(keys *KeyMap, overrides string) []error {
+	var errs []error
+	actions := keys.actions()
+	for _, override := range strings.Split(overrides, ",") {
+		if strings.TrimSpace(override) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(override, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || len(strings.Fields(value)) == 0 {
+			errs = append(errs, fmt.Errorf("invalid key override %q, use action=key", strings.TrimSpace(override)))
+			continue
+		}
+		binding, ok := actions[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown action %q, valid actions are %s", name, strings.Join(Actions(), ", ")))
+			continue
+		}
+		fields := strings.Fields(value)
+		names := make([]string, len(fields))
+		for i, f := range fields {
+			// A space can't be written between the keys, bubbletea names the space bar " "
+			names[i] = f
+			if f == "space" {
+				names[i] = " "
+			}
+		}
+		binding.SetKeys(names...)
+		binding.SetHelp(strings.Join(fields, "/"), binding.Help().Desc)
+	}
+	return append(errs, conflicts(actions)...)
+}
+
+// Returns an error for every key bound to two actions that can't share it
+func conflicts(actions map[string]*key.Binding) []error {
+	owners := map[string][]string{}
+	for name, binding := range actions {
+		for _, k := range binding.Keys() {
+			owners[k] = append(owners[k], name)
+		}
+	}
+	var errs []error
+	for k, names := range owners {
+		sort.Strings(names)
+		if len(names) < 2 || (len(names) == 2 && sharedActions[[2]string{names[0], names[1]}]) {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s is bound to %s", k, strings.Join(names, " and ")))
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+var keys = DefaultKeyMap()
+
+// SetKeys applies the keys setting to the TUI. A bad override is left out and a conflicting setting is dropped
+// for the default keys, both are returned as warnings.
+func SetKeys(overrides string) []string {
+	custom := DefaultKeyMap()
+	var warnings []string
+	for _, err := range ParseKeys(&custom, overrides) {
+		warnings = append(warnings, err.Error())
+	}
+	if len(conflicts(custom.actions())) > 0 {
+		keys = DefaultKeyMap()
+		return append(warnings, "the keys setting has conflicts, using the default keys")
+	}
+	keys = custom
+	return warnings
+}
+
+// Returns the first key of a binding for the hints of the TUI
+func keyName(b key.Binding) string {
+	if len(b.Keys()) == 0 {
+		return ""
+	}
+	if b.Keys()[0] == " " {
+		return "space"
+	}
+	return b.Keys()[0]
+}
@@ -0,0 +1,104 @@
+package tea
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// Whether the TUI takes clicks and the scroll wheel, the terminal's own text selection doesn't work meanwhile
+var mouse = true
+
+// SetMouse turns the mouse support of the TUI on or off, from the mouse setting
+func SetMouse(enabled bool) {
+	mouse = enabled
+}
+
+// Returns the command that turns on mouse reporting, nil when the mouse is off
+func enableMouse() tea.Cmd {
+	if !mouse {
+		return nil
+	}
+	return tea.EnableMouseCellMotion
+}
+
+// How soon a second click on the same line counts as a double-click
+const doubleClickInterval = 400 * time.Millisecond
+
+// Where the view was drawn, for finding the command under a click. The TUI isn't drawn on the alternate screen,
+// so the rows of the terminal have to be worked out from where it started and how tall it got.
+type mouseLayout struct {
+	top       int         // Row of the terminal the first line of the view is on, negative while only its end fits
+	rows      map[int]int // Line of the view a command is on, [RUN] is len(choices)
+	lastClick time.Time
+	lastIndex int
+}
+
+func newMouseLayout() *mouseLayout {
+	top, err := io.CursorRow()
+	if err != nil {
+		// A terminal that doesn't report the cursor has most likely scrolled, the view then ends at the bottom
+		top = math.MaxInt32
+	}
+	return &mouseLayout{top: top, rows: map[int]int{}}
+}
+
+// Records the height of a view that was drawn. The view starts on the row of the cursor, the terminal scrolls
+// up when it grows past the bottom and never back down, and of a view taller than the terminal only the end is drawn.
+func (l *mouseLayout) drawn(view string, height int) {
+	if height > 0 {
+		l.top = min(l.top, height-(strings.Count(view, "\n")+1))
+	}
+}
+
+// Returns the command on row y of the terminal
+func (l *mouseLayout) at(y int) (int, bool) {
+	index, ok := l.rows[y-l.top]
+	return index, ok
+}
+
+// Notes that the line the view continues with shows the command with the given index
+func (m model) recordRow(s *strings.Builder, index int) {
+	if m.layout != nil {
+		m.layout.rows[strings.Count(s.String(), "\n")] = index
+	}
+}
+
+// Moves the cursor with the wheel and to the command clicked, a double-click picks it or runs on [RUN]
+func (m model) updateMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	if m.layout == nil || m.naming || m.showHelp || m.commandless || msg.Action != tea.MouseActionPress {
+		return m, nil
+	}
+	switch msg.Button {
+	case tea.MouseButtonWheelUp:
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case tea.MouseButtonWheelDown:
+		if m.cursor < len(m.choices) {
+			m.cursor++
+		}
+	case tea.MouseButtonLeft:
+		index, ok := m.layout.at(msg.Y)
+		if !ok {
+			return m, nil
+		}
+		double := index == m.layout.lastIndex && time.Since(m.layout.lastClick) < doubleClickInterval
+		m.cursor = index
+		m.layout.lastIndex, m.layout.lastClick = index, time.Now()
+		if !double {
+			return m, nil
+		}
+		// A third click starts over instead of toggling back
+		m.layout.lastClick = time.Time{}
+		if index < len(m.choices) {
+			m.selected[index] = !m.selected[index]
+			return m, nil
+		}
+		return m.run()
+	}
+	return m, nil
+}
@@ -1,16 +1,25 @@
 package tea
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
 	"strings"
 	"time"
 
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/micr0-dev/lexido/pkg/commands"
 	"github.com/micr0-dev/lexido/pkg/format"
+	"github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/patch"
+	"github.com/micr0-dev/lexido/pkg/stats"
 )
 
 const maxWidth = 200
@@ -19,6 +28,10 @@ type model struct {
 	spinner                spinner.Model
 	commands               *[]string
 	response               string
+	candidates             []string
+	extractors             []*commands.Extractor
+	picked                 [][]bool
+	current                int
 	choices                []string
 	selected               []bool
 	cursor                 int
@@ -26,23 +39,256 @@ type model struct {
 	height                 int
 	displayedContentLength int
 	commandless            bool
+	noCommands             bool // Only the response is shown, nothing is taken from it to run
+	diff                   bool // The response is a diff, colored as one
 	isDone                 bool
 	hasSudo                bool
 	isLocal                bool
+	runDir                 string
+	demoted                []string
+	inputNote              string
+	showWarnings           bool
+	showHelp               bool
+	layout                 *mouseLayout
+	interrupted            bool
+	runQueued              bool
+	stopped                bool
+	stopGeneration         func()
+	lastExtract            time.Time
+	extractPending         bool
+	status                 string
+	header                 string
+	script                 ScriptMsg
+	tmux                   *TmuxMsg
+	toTmux                 bool
+	pagerOnDone            bool
+	metadata               *SetMetadataMsg
+	naming                 bool
+	pathInput              textinput.Model
+	favorite               FavoriteMsg
+	favoring               string // Command whose tags are typed before it is saved as a favorite
+	tagInput               textinput.Model
+	usage                  *UsageMsg
+	cachedAt               time.Time
+	fellBack               string
+	labels                 []string
+	started                time.Time
+	waitingFor             string
+	hintAfter              time.Duration
+	took                   time.Duration
+	explain                ExplainerMsg
+	explanations           map[string]string
+	explaining             string
+	cancelExplain          func()
+	regenerate             RegenerateMsg
+	firstRegenerated       int
+	err                    error
 }
 
+// How often commands are extracted from a response that is still streaming in
+const extractInterval = 150 * time.Millisecond
+
 type (
 	AppendResponseMsg string
 	GenerationDoneMsg struct{}
 )
 
-func InitialModel(commmands *[]string, local bool) model {
+// StopGenerationMsg hands the TUI a function that stops the rest of the generation when called
+type StopGenerationMsg func()
+
+// DemotedWarningsMsg lists warnings that were shown recently and are only hinted at in the footer
+type DemotedWarningsMsg []string
+
+// RetryingMsg reports that a failed request is retried after a wait
+type RetryingMsg struct {
+	Attempt int
+	Max     int
+	Wait    time.Duration
+	Reason  string
+}
+
+// UsageMsg reports the tokens used by the request. Estimated is set when the provider doesn't report them
+// and they were counted from the text, Priced when Cost is known.
+type UsageMsg struct {
+	PromptTokens   int
+	ResponseTokens int
+	TotalTokens    int
+	Estimated      bool
+	Cost           float64
+	Priced         bool
+}
+
+// PromptSizeMsg reports the tokens of the prompt counted before it was sent, and the context window they had to fit.
+// Estimated is set when they were estimated from the text rather than counted by the provider.
+type PromptSizeMsg struct {
+	Tokens        int
+	ContextWindow int
+	Estimated     bool
+}
+
+// ErrorMsg ends the program with the error shown below what arrived of the response
+type ErrorMsg struct {
+	Err error
+}
+
+// CachedMsg marks the response as reused from the response cache, Created is when it was generated
+type CachedMsg struct {
+	Created time.Time
+}
+
+// HeaderMsg shows a line above the response, such as the attempt of the fix loop
+type HeaderMsg string
+
+// InputNoteMsg shows a note about the input in the footer, such as how much of the piped input was left out
+type InputNoteMsg string
+
+// StatusMsg shows a note below the response, such as why it is incomplete
+type StatusMsg string
+
+// ScriptMsg lets s save the commands to a script, Path is the suggested file.
+// With SaveOnRun the run button saves the selected commands instead of running them.
+type ScriptMsg struct {
+	Path      string
+	SaveOnRun bool
+	Save      func(path string, cmds []string) error
+}
+
+// NoCommandsMsg shows the response only, without extracting commands from it, for --no-commands and summaries
+type NoCommandsMsg struct{}
+
+// DiffMsg colors the response as a unified diff, for lexido edit
+type DiffMsg struct{}
+
+// FavoriteMsg lets * save the command under the cursor as a favorite with the tags typed for it
+type FavoriteMsg func(command string, tags string) error
+
+// TmuxMsg lets t send the selected commands to new tmux panes instead of running them.
+// With OnRun the run button sends them as well.
+type TmuxMsg struct {
+	OnRun bool
+}
+
+// SetMetadataMsg names the provider and model the response comes from, and how it was asked for (a continued
+// conversation, a dry run, ...), for the status line that stays below the response
+type SetMetadataMsg struct {
+	Provider string
+	Model    string
+	Flags    []string
+}
+
+// Line like "ollama · llama3 · local · continued"
+func (msg SetMetadataMsg) String() string {
+	parts := []string{msg.Provider}
+	if msg.Model != "" && msg.Model != msg.Provider {
+		parts = append(parts, msg.Model)
+	}
+	return strings.Join(append(parts, msg.Flags...), " · ")
+}
+
+// FellBackMsg reports that the provider failed and the prompt was started over with the next one of the fallback chain,
+// Provider is its run mode
+type FellBackMsg struct {
+	Provider string
+	Model    string
+}
+
+// Line shown for the fallback, like "fell back to ollama (llama3)"
+func (msg FellBackMsg) String() string {
+	provider := msg.provider()
+	if msg.Model == "" {
+		return "fell back to " + provider
+	}
+	return fmt.Sprintf("fell back to %s (%s)", provider, msg.Model)
+}
+
+// Returns the name of the provider fallen back to, its run mode except for ollama
+func (msg FellBackMsg) provider() string {
+	if msg.Provider == "local" {
+		return "ollama"
+	}
+	return msg.Provider
+}
+
+// RaceWonMsg reports the provider of --race that produced text first, the others were cancelled
+type RaceWonMsg struct {
+	Provider  string
+	Model     string
+	Cancelled []string
+}
+
+// Line shown for the race, like "ollama (llama3) answered first, gemini was cancelled"
+func (msg RaceWonMsg) String() string {
+	winner := FellBackMsg{Provider: msg.Provider, Model: msg.Model}
+	line := winner.provider()
+	if msg.Model != "" {
+		line = fmt.Sprintf("%s (%s)", line, msg.Model)
+	}
+	line += " answered first"
+	if len(msg.Cancelled) > 0 {
+		verb := " was"
+		if len(msg.Cancelled) > 1 {
+			verb = " were"
+		}
+		line += ", " + strings.Join(msg.Cancelled, " and ") + verb + " cancelled"
+	}
+	return line
+}
+
+// CandidateLabelsMsg names where each candidate came from, such as the providers of --compare
+type CandidateLabelsMsg []string
+
+// WaitingMsg names the model the TUI waits on until the first chunk arrives. After HintAfter without one
+// a hint about --timeout and Ctrl-C is shown, zero leaves the hint out.
+type WaitingMsg struct {
+	Model     string
+	HintAfter time.Duration
+}
+
+// ExplainerMsg hands the TUI a function explaining a suggested command, e on a command calls it
+type ExplainerMsg func(ctx context.Context, command string) (string, error)
+
+// explainedMsg carries the explanation of a command back to the TUI, empty when it failed
+type explainedMsg struct {
+	Command     string
+	Explanation string
+}
+
+// RegenerateMsg hands the TUI a function that asks for another suggestion, r calls it once the response is complete.
+// It streams the new response into the given candidate and returns once it is complete, previous are the commands
+// suggested so far.
+type RegenerateMsg func(ctx context.Context, candidate int, previous []string) error
+
+// regeneratedMsg reports that the suggestion asked for with r is complete
+type regeneratedMsg struct {
+	Candidate int
+	Err       error
+}
+
+// ResetCandidateMsg discards what was streamed into one candidate because its request is restarted
+type ResetCandidateMsg struct {
+	Index int
+}
+
+// ResetResponseMsg discards what was streamed so far because the request is restarted
+type ResetResponseMsg struct{}
+
+// AppendCandidateMsg carries a chunk of one of several alternative responses generated in a single request
+type AppendCandidateMsg struct {
+	Index int
+	Text  string
+}
+
+func InitialModel(commmands *[]string, local bool, runDir string) model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
-	return model{
+	m := model{
 		spinner:                s,
 		commands:               commmands,
 		response:               "",
+		candidates:             make([]string, 1),
+		extractors:             []*commands.Extractor{{}},
+		picked:                 make([][]bool, 1),
+		current:                0,
 		choices:                make([]string, 0),
 		selected:               make([]bool, 0),
 		cursor:                 0,
@@ -53,7 +299,14 @@ func InitialModel(commmands *[]string, local bool) model {
 		isDone:                 false,
 		hasSudo:                false,
 		isLocal:                local,
+		runDir:                 runDir,
+		started:                time.Now(),
+		explanations:           map[string]string{},
 	}
+	if mouse {
+		m.layout = newMouseLayout()
+	}
+	return m
 }
 
 func tickCmd(interval time.Duration) tea.Cmd {
@@ -65,24 +318,129 @@ func tickCmd(interval time.Duration) tea.Cmd {
 type tickMsg time.Time
 
 func (m model) Init() tea.Cmd {
-	return tea.Batch(tickCmd(100*time.Millisecond), m.spinner.Tick)
+	return tea.Batch(tickCmd(100*time.Millisecond), m.spinner.Tick, enableMouse())
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	if m.displayedContentLength >= len(m.response) && len(m.response) > 0 && m.commandless && m.isDone {
-		return m.Close(false)
-	}
-
 	switch msg := msg.(type) {
 	case AppendResponseMsg:
-		m.response += string(msg)
-		m.choices = commands.ParseCommands(m.response)
-		m.selected = make([]bool, len(m.choices)+1)
-		m.commandless = m.choices == nil || len(m.choices) == 0
-		m.hasSudo = commands.ContainsSudo(m.choices)
+		m.appendCandidate(0, string(msg))
+	case AppendCandidateMsg:
+		m.appendCandidate(msg.Index, msg.Text)
 	case GenerationDoneMsg:
 		m.isDone = true
+		m.took = time.Since(m.started)
+		m.showCandidate(m.current)
+		if m.runQueued {
+			return m.Close(true)
+		}
+		if m.pagerOnDone {
+			m.pagerOnDone = false
+			return m, openExternal(pager(), m.response, false)
+		}
+	case RetryingMsg:
+		m.status = fmt.Sprintf("%s, retrying in %s… (attempt %d/%d)", msg.Reason, msg.Wait.Round(time.Second), msg.Attempt, msg.Max)
+	case ResetResponseMsg:
+		m.resetResponse()
+	case ResetCandidateMsg:
+		if msg.Index < len(m.candidates) {
+			m.candidates[msg.Index] = ""
+			m.extractors[msg.Index] = &commands.Extractor{}
+			m.picked[msg.Index] = nil
+			if msg.Index == m.current {
+				m.displayedContentLength = 0
+				m.showCandidate(msg.Index)
+			}
+		}
+	case RegenerateMsg:
+		m.regenerate = msg
+	case regeneratedMsg:
+		return m.finishRegeneration(msg)
+	case WaitingMsg:
+		m.waitingFor = msg.Model
+		m.hintAfter = msg.HintAfter
+	case SetMetadataMsg:
+		m.metadata = &msg
+	case RaceWonMsg:
+		m.fellBack = msg.String()
+		if m.metadata != nil {
+			m.metadata.Provider, m.metadata.Model = FellBackMsg{Provider: msg.Provider}.provider(), msg.Model
+		}
+	case CandidateLabelsMsg:
+		m.labels = msg
+	case FellBackMsg:
+		m.fellBack = msg.String()
+		if m.metadata != nil {
+			m.metadata.Provider, m.metadata.Model = msg.provider(), msg.Model
+		}
+		m.waitingFor = msg.Model
+		if msg.Model == "" {
+			m.waitingFor = msg.Provider
+		}
+		m.status = ""
+	case StatusMsg:
+		m.status = string(msg)
+	case HeaderMsg:
+		m.header = string(msg)
+	case ScriptMsg:
+		m.script = msg
+	case FavoriteMsg:
+		m.favorite = msg
+	case NoCommandsMsg:
+		m.noCommands = true
+		m.showCandidate(m.current)
+	case DiffMsg:
+		m.diff = true
+	case PagerMsg:
+		if m.isDone {
+			return m, openExternal(pager(), m.response, false)
+		}
+		m.pagerOnDone = true
+	case copiedMsg:
+		m.status = msg.String()
+	case externalDoneMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("Could not open the response: %v", msg.err)
+		} else if msg.edited != "" {
+			m.replaceResponse(msg.edited)
+		}
+		// Giving the terminal to the pager or editor turned mouse reporting off
+		return m, enableMouse()
+	case TmuxMsg:
+		m.tmux = &msg
+		m.toTmux = msg.OnRun
+	case UsageMsg:
+		m.usage = &msg
+	case CachedMsg:
+		m.cachedAt = msg.Created
+	case ErrorMsg:
+		// A cancelled generation needs no explanation, the user closed the program or asked to stop
+		if !errors.Is(msg.Err, context.Canceled) {
+			m.err = msg.Err
+		}
+		return m.Close(false)
+	case StopGenerationMsg:
+		m.stopGeneration = msg
+	case ExplainerMsg:
+		m.explain = msg
+	case explainedMsg:
+		if msg.Command == m.explaining {
+			m.explaining = ""
+			m.cancelExplain = nil
+		}
+		if msg.Explanation != "" {
+			m.explanations[msg.Command] = msg.Explanation
+		}
+	case DemotedWarningsMsg:
+		m.demoted = append(m.demoted, msg...)
+	case InputNoteMsg:
+		m.inputNote = string(msg)
 	case tickMsg:
+		// Catch up on extraction that was debounced while chunks were arriving
+		if m.extractPending && time.Since(m.lastExtract) >= extractInterval {
+			m.showCandidate(m.current)
+		}
+
 		totalResponseLength := len(m.response)
 		// Logic to increment displayedContentLength
 		chunkSize := rand.Intn(7) + 2 // Random chunk size between 1 and 5
@@ -99,30 +457,100 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		return m, tickCmd(interval)
 	case tea.KeyMsg:
-		if msg.String() == "ctrl+c" || msg.String() == "q" || msg.String() == "esc" {
+		if msg.String() == "ctrl+c" {
+			m.interrupted = true
 			return m.Close(false)
 		}
+		if m.naming {
+			return m.updateNaming(msg)
+		}
+		if m.favoring != "" {
+			return m.updateTagging(msg)
+		}
+		if m.showHelp {
+			// Any key closes the overlay and does nothing else, so a stray key doesn't act on a hidden command
+			m.showHelp = false
+			return m, nil
+		}
+		switch {
+		case key.Matches(msg, keys.Quit):
+			return m.Close(false)
+		case key.Matches(msg, keys.Help):
+			m.showHelp = true
+			return m, nil
+		case key.Matches(msg, keys.Warnings) && len(m.demoted) > 0:
+			m.showWarnings = !m.showWarnings
+			return m, nil
+		case key.Matches(msg, keys.Next, keys.Previous) && len(m.candidates) > 1:
+			step := 1
+			if key.Matches(msg, keys.Previous) {
+				step = len(m.candidates) - 1
+			}
+			m.showCandidate((m.current + step) % len(m.candidates))
+			return m, nil
+		case key.Matches(msg, keys.Stop) && !m.isDone && m.stopGeneration != nil:
+			// Keep what arrived so far and stop the rest of the response
+			m.stopGeneration()
+			m.stopped = true
+			return m, nil
+		case key.Matches(msg, keys.Regenerate) && m.isDone && m.regenerate != nil:
+			return m.startRegeneration()
+		case key.Matches(msg, keys.Pager) && m.isDone:
+			return m, openExternal(pager(), m.response, false)
+		case key.Matches(msg, keys.Edit) && m.isDone:
+			return m, openExternal(editor(), m.response, true)
+		}
 		if m.commandless {
 			return m, nil
 		}
 
-		switch msg.String() {
-		case "enter":
-			if m.cursor != len(m.choices) {
-				m.selected[m.cursor] = !m.selected[m.cursor]
-			} else {
+		onCommand := m.cursor < len(m.choices)
+		switch {
+		case key.Matches(msg, keys.Tmux):
+			if m.tmux != nil && m.isDone {
+				m.toTmux = true
 				return m.Close(true)
 			}
-		case "j", "down":
+		case key.Matches(msg, keys.Save):
+			if m.script.Save != nil {
+				m.naming = true
+				m.pathInput = textinput.New()
+				m.pathInput.Prompt = "Save script to: "
+				m.pathInput.SetValue(m.script.Path)
+				m.pathInput.CursorEnd()
+				return m, m.pathInput.Focus()
+			}
+		// Select and run may share a key, it picks the command under the cursor and runs on [RUN]
+		case key.Matches(msg, keys.Select) && onCommand:
+			m.selected[m.cursor] = !m.selected[m.cursor]
+		case key.Matches(msg, keys.Run):
+			return m.run()
+		case key.Matches(msg, keys.Explain):
+			if onCommand && m.explain != nil {
+				return m.toggleExplanation(m.choices[m.cursor])
+			}
+		case key.Matches(msg, keys.Copy):
+			if onCommand {
+				return m, copyCommand(m.choices[m.cursor])
+			}
+		case key.Matches(msg, keys.Favorite):
+			if onCommand && m.favorite != nil {
+				m.favoring = m.choices[m.cursor]
+				m.tagInput = textinput.New()
+				m.tagInput.Prompt = "Tags (optional): "
+				return m, m.tagInput.Focus()
+			}
+		case key.Matches(msg, keys.Down):
 			if m.cursor < len(m.choices) {
 				m.cursor++
 			}
-		case "k", "up":
+		case key.Matches(msg, keys.Up):
 			if m.cursor > 0 {
 				m.cursor--
 			}
-
 		}
+	case tea.MouseMsg:
+		return m.updateMouse(msg)
 	case tea.WindowSizeMsg:
 		// Optionally store the new dimensions
 		m.width = msg.Width
@@ -136,14 +564,331 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-func (m model) Close(exec bool) (tea.Model, tea.Cmd) {
-	// Collect the selected commands
-	if exec {
-		for i, selected := range m.selected {
-			if selected {
-				*m.commands = append(*m.commands, m.choices[i])
+// Narrowest width long commands are wrapped to, narrower terminals get them cut off
+const minWrapWidth = 10
+
+// Splits a command into lines of at most width characters, breaking after a space where that doesn't leave
+// the line half empty. Joined together the lines are the command again.
+func wrapCommand(command string, width int) []string {
+	if width < minWrapWidth {
+		return []string{command}
+	}
+	var lines []string
+	runes := []rune(command)
+	for len(runes) > width {
+		cut := width
+		for i := width - 1; i >= width/2; i-- {
+			if runes[i] == ' ' {
+				cut = i + 1
+				break
 			}
 		}
+		lines = append(lines, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+	return append(lines, string(runes))
+}
+
+// Runs the selected commands, or queues running them until the response is complete
+func (m model) run() (tea.Model, tea.Cmd) {
+	if m.isDone {
+		return m.Close(true)
+	}
+	m.runQueued = !m.runQueued
+	return m, nil
+}
+
+// Handles keys while the tags of a new favorite are typed
+func (m model) updateTagging(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.favoring = ""
+		return m, nil
+	case "enter":
+		if err := m.favorite(m.favoring, m.tagInput.Value()); err != nil {
+			m.status = fmt.Sprintf("Could not save the favorite: %v", err)
+		} else {
+			m.status = "Saved " + m.favoring + " as a favorite, lexido fav list shows it"
+		}
+		m.favoring = ""
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.tagInput, cmd = m.tagInput.Update(msg)
+	return m, cmd
+}
+
+// Handles keys while the file name of the script is typed
+func (m model) updateNaming(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.naming = false
+		return m, nil
+	case "enter":
+		m.naming = false
+		path := strings.TrimSpace(m.pathInput.Value())
+		if path == "" {
+			return m, nil
+		}
+		cmds := m.selectedCommands()
+		if len(cmds) == 0 {
+			// Nothing picked yet, save every command of the response shown
+			cmds = m.choices
+		}
+		if err := m.script.Save(path, cmds); err != nil {
+			m.status = fmt.Sprintf("Could not save the script: %v", err)
+		} else {
+			m.status = fmt.Sprintf("Saved %d command(s) to %s", len(cmds), path)
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.pathInput, cmd = m.pathInput.Update(msg)
+	return m, cmd
+}
+
+// Shows the explanation of the command, asking for it first. Pressed again it hides the explanation,
+// or cancels the request while it is still running.
+func (m model) toggleExplanation(command string) (tea.Model, tea.Cmd) {
+	if _, ok := m.explanations[command]; ok {
+		delete(m.explanations, command)
+		return m, nil
+	}
+	if m.cancelExplain != nil {
+		m.cancelExplain()
+		m.cancelExplain = nil
+	}
+	if m.explaining == command {
+		m.explaining = ""
+		return m, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.explaining = command
+	m.cancelExplain = cancel
+	explain := m.explain
+	return m, func() tea.Msg {
+		defer cancel()
+		// A failed explanation is left out, the error was logged
+		explanation, _ := explain(ctx, command)
+		return explainedMsg{Command: command, Explanation: explanation}
+	}
+}
+
+// copiedMsg reports whether the command under the cursor made it to the clipboard
+type copiedMsg struct {
+	Command string
+	Err     error
+}
+
+func (msg copiedMsg) String() string {
+	if msg.Err != nil {
+		return fmt.Sprintf("Could not copy the command: %v", msg.Err)
+	}
+	return "Copied " + msg.Command
+}
+
+// Puts the command on the clipboard, the clipboard tool may take a moment
+func copyCommand(command string) tea.Cmd {
+	return func() tea.Msg {
+		return copiedMsg{Command: command, Err: io.WriteClipboard(command)}
+	}
+}
+
+// Asks for another suggestion into a new candidate and shows it, the earlier ones stay a [ away
+func (m model) startRegeneration() (tea.Model, tea.Cmd) {
+	var previous []string
+	for c := range m.candidates {
+		previous = append(previous, m.extractors[c].Update(m.candidates[c], true)...)
+	}
+
+	index := len(m.candidates)
+	if m.firstRegenerated == 0 {
+		m.firstRegenerated = index
+	}
+	m.isDone = false
+	m.stopped = false
+	m.runQueued = false
+	m.status = ""
+	m.usage = nil
+	m.cachedAt = time.Time{}
+	m.started = time.Now()
+	m.took = 0
+	m.appendCandidate(index, "")
+	m.displayedContentLength = 0
+	m.cursor = 0
+	m.showCandidate(index)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.stopGeneration = cancel
+	regenerate := m.regenerate
+	return m, func() tea.Msg {
+		defer cancel()
+		return regeneratedMsg{Candidate: index, Err: regenerate(ctx, index, previous)}
+	}
+}
+
+// Completes the candidate asked for with r. A failure is shown as a note, so the earlier suggestions can still be run.
+func (m model) finishRegeneration(msg regeneratedMsg) (tea.Model, tea.Cmd) {
+	m.isDone = true
+	m.took = time.Since(m.started)
+	if msg.Err != nil && !errors.Is(msg.Err, context.Canceled) {
+		m.status = "Could not get another suggestion: " + msg.Err.Error()
+	}
+	if m.candidates[msg.Candidate] == "" && msg.Candidate == len(m.candidates)-1 {
+		// Nothing arrived, go back to the previous suggestion
+		m.candidates = m.candidates[:msg.Candidate]
+		m.extractors = m.extractors[:msg.Candidate]
+		m.picked = m.picked[:msg.Candidate]
+		if m.firstRegenerated == msg.Candidate {
+			m.firstRegenerated = 0
+		}
+		if m.current == msg.Candidate {
+			m.current = msg.Candidate - 1
+		}
+	}
+	m.showCandidate(m.current)
+	if m.runQueued {
+		return m.Close(true)
+	}
+	return m, nil
+}
+
+// Appends a chunk to the candidate with the given index, creating the buffers for new candidates as they appear
+func (m *model) appendCandidate(index int, text string) {
+	for len(m.candidates) <= index {
+		m.candidates = append(m.candidates, "")
+		m.extractors = append(m.extractors, &commands.Extractor{})
+		m.picked = append(m.picked, nil)
+	}
+	m.candidates[index] += text
+	m.status = ""
+
+	if index != m.current {
+		return
+	}
+
+	// Extraction is debounced while chunks are streaming in, the next tick catches up
+	if time.Since(m.lastExtract) < extractInterval {
+		m.response = m.candidates[index]
+		m.extractPending = true
+		return
+	}
+	m.showCandidate(index)
+}
+
+// Drops the partial response of a failed attempt so the retried one starts from scratch
+func (m *model) resetResponse() {
+	m.response = ""
+	m.candidates = make([]string, 1)
+	m.extractors = []*commands.Extractor{{}}
+	m.picked = make([][]bool, 1)
+	m.current = 0
+	m.choices = make([]string, 0)
+	m.selected = make([]bool, 0)
+	m.cursor = 0
+	m.displayedContentLength = 0
+	m.commandless = true
+	m.hasSudo = false
+	m.extractPending = false
+}
+
+// Colors the commands of the response, or its lines as a diff
+func (m model) highlight(text string) string {
+	if m.diff {
+		return patch.Highlight(text)
+	}
+	return commands.HighlightCommands(text)
+}
+
+// Returns where the candidate came from like " from ollama (llama3)", empty when it has no label
+func (m model) candidateSource(index int) string {
+	if index < len(m.labels) && m.labels[index] != "" {
+		return " from " + m.labels[index]
+	}
+	return ""
+}
+
+// Switches the displayed response to the given candidate, keeping what was picked in each of them
+func (m *model) showCandidate(index int) {
+	// Keep the highlight on [RUN] when new commands are appended above it
+	onRun := m.cursor == len(m.choices) && m.current == index
+
+	m.current = index
+	m.response = m.candidates[index]
+	m.choices = nil
+	if !m.noCommands {
+		m.choices = m.extractors[index].Update(m.response, m.isDone)
+	}
+	m.lastExtract = time.Now()
+	m.extractPending = false
+
+	// Keep the existing picks while the candidate is still streaming in
+	picked := make([]bool, len(m.choices)+1)
+	copy(picked, m.picked[index])
+	m.picked[index] = picked
+	m.selected = picked
+
+	m.commandless = m.choices == nil || len(m.choices) == 0
+	m.hasSudo = commands.ContainsSudo(m.choices)
+	if m.cursor > len(m.choices) || onRun {
+		m.cursor = len(m.choices)
+	}
+}
+
+// Reports whether the program ended by showing an error, so it needn't be printed again
+func ShowedError(m tea.Model) bool {
+	final, ok := m.(model)
+	return ok && final.err != nil
+}
+
+// Reports whether the program was left with Ctrl-C
+func Interrupted(m tea.Model) bool {
+	final, ok := m.(model)
+	return ok && final.interrupted
+}
+
+// Reports whether the selected commands are meant for tmux, by t or the run button of --tmux
+func SentToTmux(m tea.Model) bool {
+	final, ok := m.(model)
+	return ok && final.toTmux
+}
+
+// Returns the response shown when the program ended if it is one asked for with r, it replaces the first one
+// in the conversation cache
+func Regenerated(m tea.Model) (string, bool) {
+	final, ok := m.(model)
+	if !ok || final.firstRegenerated == 0 || final.current < final.firstRegenerated {
+		return "", false
+	}
+	return final.candidates[final.current], true
+}
+
+// Returns the selected commands of every candidate, in candidate order
+func (m model) selectedCommands() []string {
+	var cmds []string
+	for c, picked := range m.picked {
+		choices := m.extractors[c].Update(m.candidates[c], m.isDone)
+		for i, selected := range picked {
+			if selected && i < len(choices) {
+				cmds = append(cmds, choices[i])
+			}
+		}
+	}
+	return cmds
+}
+
+func (m model) Close(exec bool) (tea.Model, tea.Cmd) {
+	// The last frame stays in the terminal, it should be the response rather than the keys
+	m.showHelp = false
+	if m.cancelExplain != nil {
+		m.cancelExplain()
+	}
+	if !m.isDone && m.stopGeneration != nil {
+		m.stopGeneration()
+	}
+	if exec {
+		*m.commands = append(*m.commands, m.selectedCommands()...)
 		fmt.Print("\n")
 	}
 	fmt.Print("\n")
@@ -151,63 +896,294 @@ func (m model) Close(exec bool) (tea.Model, tea.Cmd) {
 }
 
 func (m model) View() string {
+	view := format.Styled(m.view())
+	if m.layout != nil {
+		m.layout.drawn(view, m.height)
+	}
+	return view
+}
+
+func (m model) view() string {
 	var s strings.Builder
 
-	s.WriteString("\033[0m")
+	s.WriteString(format.Reset)
+
+	if m.header != "" {
+		s.WriteString(format.Code(format.Header) + m.header + format.Reset + "\n\n")
+	}
+	if m.fellBack != "" {
+		s.WriteString(format.Code(format.Footer) + m.fellBack + format.Reset + "\n\n")
+	}
+
+	if m.layout != nil {
+		m.layout.rows = map[int]int{}
+	}
+
+	if m.showHelp {
+		s.WriteString(m.helpView())
+		return s.String()
+	}
+
+	if m.err != nil {
+		if m.response != "" {
+			s.WriteString(format.WrapText(format.TrimWhitespace(m.response), min(m.width, maxWidth)) + "\n\n")
+		}
+		s.WriteString(format.WrapText(format.Code(format.Error)+"Error: "+m.err.Error()+format.Reset, min(m.width, maxWidth)) + "\n")
+		return s.String()
+	}
 
 	if m.response == "" {
-		if m.isLocal {
-			s.WriteString(fmt.Sprintf("%sInitializing...", m.spinner.View()))
-		} else {
-			s.WriteString(fmt.Sprintf("%sConnecting...", m.spinner.View()))
+		if m.status != "" {
+			s.WriteString(fmt.Sprintf("%s%s", m.spinner.View(), m.status))
+			return s.String()
+		}
+
+		// Counting up from the launch shows lexido is alive while the provider takes its time with the first token
+		waiting := "Connecting"
+		if m.waitingFor != "" {
+			waiting = "waiting for " + m.waitingFor
+		} else if m.isLocal {
+			waiting = "Initializing"
+		}
+		elapsed := time.Since(m.started)
+		s.WriteString(fmt.Sprintf("%s%s… %.1fs", m.spinner.View(), waiting, elapsed.Seconds()))
+		if m.hintAfter > 0 && elapsed >= m.hintAfter {
+			s.WriteString(format.WrapText("\n\n"+format.Code(format.Footer)+"Nothing yet, the provider may be busy. Ctrl-C quits, --timeout gives up on slow requests sooner."+format.Reset, min(m.width, maxWidth)))
 		}
 		return s.String()
 	}
 
+	if len(m.candidates) > 1 {
+		s.WriteString(fmt.Sprintf("Alternative %d/%d%s (%s and %s to switch, picks are kept across alternatives)\n\n", m.current+1, len(m.candidates), m.candidateSource(m.current), keyName(keys.Previous), keyName(keys.Next)))
+	}
+
 	displayContent := format.TrimWhitespace(m.response)
 	if len(displayContent) > m.displayedContentLength {
 		displayContent = displayContent[:m.displayedContentLength]
 	}
 
-	wrappedResponse := format.WrapText(commands.HighlightCommands(displayContent), min(m.width, maxWidth))
-	s.WriteString(wrappedResponse)
+	wrappedResponse := format.WrapText(m.highlight(displayContent), min(m.width, maxWidth))
+	s.WriteString(format.Code(format.Response) + wrappedResponse + format.Reset)
+
+	if m.status != "" {
+		s.WriteString(format.WrapText("\n\n"+format.Code(format.Warning)+m.status+format.Reset, min(m.width, maxWidth)))
+	}
 
 	if m.commandless {
+		// Without commands only stopping and quitting apply while the response streams in, once it is complete
+		// it stays open to be read, edited or asked again
+		if m.noCommands && !m.isDone {
+			s.WriteString(format.WrapText("\n\n"+newHelp().ShortHelpView(keys.ResponseHelp()), min(m.width, maxWidth)))
+		} else if m.isDone {
+			s.WriteString(format.WrapText("\n\n"+newHelp().ShortHelpView(keys.FinishedResponseHelp(m.regenerate != nil)), min(m.width, maxWidth)))
+		}
+		if footer := m.footer(); footer != "" {
+			s.WriteString("\n\n" + footer)
+		}
 		return s.String()
 	}
 
 	s.WriteString("\n—————————————————————\n")
 
+	if m.showWarnings {
+		s.WriteString("Warnings:\n")
+		for _, w := range m.demoted {
+			s.WriteString(format.WrapText(format.Code(format.Warning)+w+format.Reset, min(m.width, maxWidth)) + "\n")
+		}
+		s.WriteString("\n")
+	}
+
 	s.WriteString("Command List:\n\n")
+	// Room for a command behind "> [x] "
+	listWidth := min(m.width, maxWidth) - 6
 	for i, todo := range m.choices {
 		var selected, color string
 
 		if m.selected[i] {
 			selected = "x"
-			color = "\033[32m"
+			color = format.Code(format.Selected)
 		} else {
 			selected = " "
-			color = "\033[0m"
+			color = format.Reset
+		}
+		badge := ""
+		if commands.InteractiveFamily(todo) != "" {
+			badge = " " + format.Code(format.Warning) + "[asks questions]" + format.Reset
 		}
+
+		pointer := "  "
 		if m.cursor == i {
-			s.WriteString(fmt.Sprintf("> "+color+"["+selected+"] %s\n", todo))
-		} else {
-			s.WriteString(fmt.Sprintf("  "+color+"["+selected+"] %s\n", todo))
+			pointer = "> "
+		}
+		// Long commands continue on the next lines instead of being cut off at the edge of the terminal
+		lines := wrapCommand(todo, listWidth)
+		for l, line := range lines {
+			m.recordRow(&s, i)
+			if l == 0 {
+				s.WriteString(pointer + color + "[" + selected + "] " + line)
+			} else {
+				s.WriteString("    " + format.Code(format.Footer) + "↪" + format.Reset + color + " " + line)
+			}
+			if l == len(lines)-1 && badge != "" {
+				if listWidth >= minWrapWidth && len([]rune(line))+len(" [asks questions]") > listWidth {
+					s.WriteString(format.Reset + "\n     ")
+				}
+				s.WriteString(badge)
+			}
+			s.WriteString(format.Reset + "\n")
+		}
+
+		if explanation, ok := m.explanations[todo]; ok {
+			wrapped := format.WrapText(explanation, max(min(m.width, maxWidth)-6, 20))
+			s.WriteString(format.Code(format.Footer) + "      " + strings.ReplaceAll(wrapped, "\n", "\n      ") + format.Reset + "\n")
+		} else if m.explaining == todo {
+			s.WriteString("      " + m.spinner.View() + "explaining…\n")
 		}
-		s.WriteString("\033[0m")
 	}
 
+	run := "RUN"
+	if m.script.SaveOnRun {
+		run = "SAVE to " + m.script.Path
+	} else if m.toTmux {
+		run = "RUN in tmux"
+	}
+	if !m.isDone && m.runQueued {
+		run += " when done"
+	}
+	run = "[" + run + "]"
+	m.recordRow(&s, len(m.choices))
 	if m.cursor == len(m.choices) {
-		s.WriteString(">   \033[32m[RUN]\033[0m\n")
+		s.WriteString(">   " + format.Code(format.Selected) + run + format.Reset + "\n")
 	} else {
-		s.WriteString("    [RUN]\n")
+		s.WriteString("    " + run + "\n")
+	}
+
+	if !m.isDone {
+		s.WriteString(m.spinner.View() + "Still generating, more commands may appear. " + keyName(keys.Stop) + " to stop generating\n")
+	}
+
+	// The command under the cursor in one piece, without the marks of the wrapped list
+	if m.cursor < len(m.choices) && len(wrapCommand(m.choices[m.cursor], listWidth)) > 1 {
+		lines := wrapCommand(m.choices[m.cursor], min(m.width, maxWidth))
+		s.WriteString("\n" + format.Code(format.Footer) + "Highlighted command:" + format.Reset + "\n" + format.Code(format.Command) + strings.Join(lines, "\n") + format.Reset + "\n")
+	}
+
+	if m.runDir != "" {
+		s.WriteString(format.WrapText("\nSelected commands will run in "+m.runDir+"\n", min(m.width, maxWidth)))
 	}
 
 	if m.hasSudo {
-		s.WriteString(format.WrapText("\n\033[31mWarning: This response contains sudo commands. Please thoroughly review the commands before running them.\033[0m\n", min(m.width, maxWidth)))
+		s.WriteString(format.WrapText("\n"+format.Code(format.Error)+"Warning: This response contains sudo commands. Please thoroughly review the commands before running them."+format.Reset+"\n", min(m.width, maxWidth)))
 	}
 
-	s.WriteString(format.WrapText("\nPlease select the tasks to run. q to quit. up/down to select", min(m.width, maxWidth)))
+	if m.naming {
+		s.WriteString("\n" + m.pathInput.View() + "\n(enter to save, esc to cancel)\n")
+	}
+	if m.favoring != "" {
+		s.WriteString("\n" + m.tagInput.View() + "\n(separated by commas, enter to save, esc to cancel)\n")
+	}
+
+	// Wrapped rather than cut off by the help, so ? stays visible on narrow terminals
+	hint := "\nPlease select the tasks to run. " + newHelp().ShortHelpView(keys.ShortHelp())
+	s.WriteString(format.WrapText(hint, min(m.width, maxWidth)))
+
+	if len(m.demoted) > 0 && !m.showWarnings {
+		s.WriteString(fmt.Sprintf(" %s!%s %s to show %d repeated warning(s)", format.Code(format.Warning), format.Reset, keyName(keys.Warnings), len(m.demoted)))
+	}
+
+	if footer := m.footer(); footer != "" {
+		s.WriteString("\n" + footer)
+	}
 
 	return s.String()
 }
+
+// Returns the help of bubbles without its own colors, the theme colors the TUI
+func newHelp() help.Model {
+	h := help.New()
+	h.Styles = help.Styles{}
+	return h
+}
+
+// Lists the active keys by section, in place of the response until any key is pressed. The sections stand
+// side by side where they fit and below each other on narrow terminals.
+func (m model) helpView() string {
+	h := newHelp()
+	gap := lipgloss.NewStyle().PaddingRight(4)
+	var sections, padded []string
+	for i, group := range keys.FullHelp() {
+		section := format.Code(format.Header) + helpSections[i] + format.Reset + "\n" + h.FullHelpView([][]key.Binding{group})
+		sections = append(sections, section)
+		if i < len(keys.FullHelp())-1 {
+			section = gap.Render(section)
+		}
+		padded = append(padded, section)
+	}
+	overlay := lipgloss.JoinHorizontal(lipgloss.Top, padded...)
+	if m.width > 0 && lipgloss.Width(overlay) > min(m.width, maxWidth) {
+		overlay = strings.Join(sections, "\n\n")
+	}
+	return overlay + "\n\n" + format.Code(format.Footer) + "Any key closes this, ctrl+c quits" + format.Reset
+}
+
+// Returns the dimmed lines below a complete response, telling where it came from, what it cost and what was left out
+func (m model) footer() string {
+	// The provider and model stay in view while the response streams in
+	line := ""
+	if m.metadata != nil {
+		line = format.Code(format.Footer) + m.metadata.String() + format.Reset
+	}
+	if !m.isDone {
+		return line
+	}
+	if source := m.sourceLine(); source != "" {
+		if line != "" {
+			line += "\n"
+		}
+		line += source
+	}
+	if m.inputNote != "" {
+		if line != "" {
+			line += "\n"
+		}
+		line += format.Code(format.Footer) + m.inputNote + format.Reset
+	}
+	return line
+}
+
+// Returns where the response came from and what it cost
+func (m model) sourceLine() string {
+	if !m.cachedAt.IsZero() {
+		age := "less than a minute"
+		switch since := time.Since(m.cachedAt); {
+		case since >= time.Hour:
+			age = fmt.Sprintf("%dh", int(since.Hours()))
+		case since >= time.Minute:
+			age = fmt.Sprintf("%d min", int(since.Minutes()))
+		}
+		return format.Code(format.Footer) + "cached response from " + age + " ago, --no-cache to ask again" + format.Reset
+	}
+	if m.usage != nil {
+		return format.Code(format.Footer) + m.usageLine() + fmt.Sprintf(", took %.1fs", m.took.Seconds()) + format.Reset
+	}
+	if m.took > 0 {
+		return format.Code(format.Footer) + fmt.Sprintf("took %.1fs", m.took.Seconds()) + format.Reset
+	}
+	return ""
+}
+
+// Formats the tokens and cost of the request, like "prompt 1.2k / response 300 tokens"
+func (m model) usageLine() string {
+	approx := ""
+	if m.usage.Estimated {
+		approx = "~"
+	}
+	line := fmt.Sprintf("prompt %s%s / response %s%s tokens", approx, stats.FormatTokens(m.usage.PromptTokens), approx, stats.FormatTokens(m.usage.ResponseTokens))
+	if m.usage.Estimated {
+		line += " (estimated)"
+	}
+	if m.usage.Priced && m.usage.Cost > 0 {
+		line += fmt.Sprintf(", about %s", stats.FormatCost(m.usage.Cost))
+	}
+	return line
+}
@@ -0,0 +1,322 @@
+package tea
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/micr0-dev/lexido/pkg/format"
+)
+
+// Sends the messages to the model one after the other, like the program does
+func update(m model, msgs ...tea.Msg) model {
+	for _, msg := range msgs {
+		next, _ := m.Update(msg)
+		m = next.(model)
+	}
+	return m
+}
+
+func keyMsg(k string) tea.Msg {
+	switch k {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "up":
+		return tea.KeyMsg{Type: tea.KeyUp}
+	case "down":
+		return tea.KeyMsg{Type: tea.KeyDown}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+}
+
+// The chunks of a recorded two candidate Gemini response, in the order they arrived
+var twoCandidates = []tea.Msg{
+	AppendCandidateMsg{Index: 0, Text: "Check the disk usage per"},
+	AppendCandidateMsg{Index: 1, Text: "ncdu shows the biggest"},
+	AppendCandidateMsg{Index: 0, Text: " directory: @run[du -sh * | sort"},
+	AppendCandidateMsg{Index: 1, Text: " directories interactively: @run[sudo apt install ncdu]"},
+	AppendCandidateMsg{Index: 0, Text: " -h]"},
+	AppendCandidateMsg{Index: 1, Text: " then @run[ncdu /]"},
+	AppendCandidateMsg{Index: 0, Text: " and the free space: @run[df -h]"},
+	GenerationDoneMsg{},
+}
+
+func TestCandidatesStreamIntoSeparateBuffers(t *testing.T) {
+	var cmds []string
+	m := update(InitialModel(&cmds, false, ""), twoCandidates...)
+
+	want := []string{
+		"Check the disk usage per directory: @run[du -sh * | sort -h] and the free space: @run[df -h]",
+		"ncdu shows the biggest directories interactively: @run[sudo apt install ncdu] then @run[ncdu /]",
+	}
+	if !reflect.DeepEqual(m.candidates, want) {
+		t.Fatalf("candidates = %q, want %q", m.candidates, want)
+	}
+
+	// Each candidate has its own commands, the first one is shown
+	if want := []string{"du -sh * | sort -h", "df -h"}; !reflect.DeepEqual(m.choices, want) {
+		t.Errorf("choices of the first candidate = %q, want %q", m.choices, want)
+	}
+	m = update(m, keyMsg("]"))
+	if m.current != 1 || m.response != want[1] {
+		t.Errorf("] showed candidate %d %q, want the second one", m.current, m.response)
+	}
+	if want := []string{"sudo apt install ncdu", "ncdu /"}; !reflect.DeepEqual(m.choices, want) {
+		t.Errorf("choices of the second candidate = %q, want %q", m.choices, want)
+	}
+	// Switching wraps around in both directions
+	if m = update(m, keyMsg("]")); m.current != 0 {
+		t.Errorf("] on the last candidate showed %d, want the first", m.current)
+	}
+	if m = update(m, keyMsg("[")); m.current != 1 {
+		t.Errorf("[ on the first candidate showed %d, want the last", m.current)
+	}
+}
+
+func TestCherryPickAcrossCandidates(t *testing.T) {
+	var cmds []string
+	m := update(InitialModel(&cmds, false, ""), twoCandidates...)
+
+	// The cursor starts on [RUN], below the commands
+	if m.cursor != len(m.choices) {
+		t.Fatalf("cursor = %d, want [RUN] at %d", m.cursor, len(m.choices))
+	}
+
+	// The second command of the first candidate and both of the second one, picked in the second one first
+	m = update(m,
+		keyMsg("]"), keyMsg("up"), keyMsg("up"), keyMsg("enter"), keyMsg("down"), keyMsg("enter"),
+		keyMsg("["), keyMsg("enter"),
+	)
+	if want := []bool{false, true, false}; !reflect.DeepEqual(m.selected, want) {
+		t.Errorf("picks of the first candidate = %v, want %v", m.selected, want)
+	}
+
+	// The picks of the second candidate were kept while the first one was shown
+	if m = update(m, keyMsg("]")); !reflect.DeepEqual(m.selected, []bool{true, true, false}) {
+		t.Errorf("picks of the second candidate = %v, want both commands", m.selected)
+	}
+
+	// The basket has them in candidate order
+	want := []string{"df -h", "sudo apt install ncdu", "ncdu /"}
+	if got := m.selectedCommands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("selectedCommands() = %q, want %q", got, want)
+	}
+}
+
+func TestResetCandidate(t *testing.T) {
+	var cmds []string
+	m := update(InitialModel(&cmds, false, ""), twoCandidates[:6]...)
+	m = update(m, keyMsg("]"), keyMsg("up"), keyMsg("enter"))
+	if len(m.selectedCommands()) != 1 {
+		t.Fatalf("picked %q before the reset, want one command", m.selectedCommands())
+	}
+	m = update(m, ResetCandidateMsg{Index: 1})
+
+	// Only the restarted candidate starts over, with its picks
+	if m.candidates[1] != "" || len(m.choices) != 0 {
+		t.Errorf("reset candidate = %q with %q, want it empty", m.candidates[1], m.choices)
+	}
+	if m.candidates[0] == "" {
+		t.Error("resetting the second candidate emptied the first")
+	}
+	m = update(m, AppendCandidateMsg{Index: 1, Text: "Try @run[duf]"}, GenerationDoneMsg{})
+	if !reflect.DeepEqual(m.choices, []string{"duf"}) || m.selected[0] {
+		t.Errorf("restarted candidate has %q picked %v, want duf unpicked", m.choices, m.selected)
+	}
+}
+
+// Models in the states the view draws differently: streaming, with picked commands, with the keys and with an error
+func viewStates() map[string]model {
+	var cmds []string
+	streaming := update(InitialModel(&cmds, false, "/srv"), tea.WindowSizeMsg{Width: 80, Height: 24}, AppendResponseMsg("Clean up with @run[sudo apt autoremove]"))
+	done := update(streaming, AppendResponseMsg(" and check @run[df -h]\n"), GenerationDoneMsg{}, StatusMsg("Copied"), keyMsg("up"), keyMsg("enter"))
+	done.displayedContentLength = len(done.response)
+	help := update(done, keyMsg("?"))
+	failed := done
+	failed.err = errors.New("the quota is used up")
+	return map[string]model{"streaming": streaming, "done": done, "help": help, "error": failed}
+}
+
+func TestViewWithoutColor(t *testing.T) {
+	defer func(was bool) { format.Color = was }(format.Color)
+
+	for name, m := range viewStates() {
+		format.Color = true
+		if !strings.Contains(m.View(), "\033[") && name != "help" {
+			t.Errorf("%s: the view has no colors with color on, the test checks nothing", name)
+		}
+		format.Color = false
+		if view := m.View(); strings.Contains(view, "\033") {
+			t.Errorf("%s: the view has escape sequences with color off: %q", name, view)
+		}
+	}
+}
+
+// Puts the command back together from the rows of the list in the view, failing when a row is wider than width
+func listedCommand(t *testing.T, view string, width int) string {
+	t.Helper()
+	var command string
+	for _, line := range strings.Split(view, "\n") {
+		var rest string
+		if strings.HasPrefix(line, "> [") || strings.HasPrefix(line, "  [") {
+			rest = line[len("> [ ] "):]
+		} else if after, ok := strings.CutPrefix(line, "    ↪ "); ok {
+			rest = after
+		} else {
+			continue
+		}
+		if n := len([]rune(line)); n > width {
+			t.Errorf("the row %q is %d wide, more than %d", line, n, width)
+		}
+		command += rest
+	}
+	return command
+}
+
+func TestLongCommandAtNarrowWidth(t *testing.T) {
+	defer func(was bool) { format.Color = was }(format.Color)
+	format.Color = false
+
+	command := `awk -F: '{ if ($3 >= 1000) print $1 " " $6 }' /etc/passwd | sort | column -t`
+	var cmds []string
+	m := update(InitialModel(&cmds, false, ""), tea.WindowSizeMsg{Width: 30, Height: 24}, AppendResponseMsg("Users with their homes: @run["+command+"]"), GenerationDoneMsg{})
+	m.displayedContentLength = len(m.response)
+
+	for _, width := range []int{30, 45, 24, 120} {
+		m = update(m, tea.WindowSizeMsg{Width: width, Height: 24})
+		view := m.View()
+		if got := listedCommand(t, view, width); got != command {
+			t.Errorf("width %d: the list shows %q, want %q", width, got, command)
+		}
+		if width < len(command) && !strings.Contains(view, "↪") {
+			t.Errorf("width %d: the command isn't wrapped with a continuation mark", width)
+		}
+	}
+
+	// With the cursor on it the whole command is shown once more, only broken at the width
+	m = update(m, tea.WindowSizeMsg{Width: 30, Height: 24}, keyMsg("up"))
+	view := m.View()
+	_, detail, ok := strings.Cut(view, "Highlighted command:\n")
+	if !ok {
+		t.Fatalf("no highlighted command in %q", view)
+	}
+	var joined string
+	for _, line := range strings.Split(detail, "\n") {
+		if len([]rune(line)) > 30 {
+			t.Errorf("the highlighted line %q is wider than 30", line)
+		}
+		joined += line
+		if strings.HasSuffix(joined, command) {
+			break
+		}
+	}
+	if !strings.HasSuffix(joined, command) {
+		t.Errorf("the highlighted command is %q, want %q", detail, command)
+	}
+}
+
+func TestWrapCommand(t *testing.T) {
+	command := "find / -xdev -type f -size +100M -exec ls -lh {} + 2>/dev/null"
+	for width := minWrapWidth; width <= len(command)+1; width++ {
+		lines := wrapCommand(command, width)
+		if got := strings.Join(lines, ""); got != command {
+			t.Errorf("wrapCommand(%d) = %q, joined %q, want the command", width, lines, got)
+		}
+		for _, line := range lines {
+			if len([]rune(line)) > width {
+				t.Errorf("wrapCommand(%d) has the line %q, longer than the width", width, line)
+			}
+		}
+	}
+	if lines := wrapCommand(command, minWrapWidth-1); len(lines) != 1 {
+		t.Errorf("wrapCommand(%d) = %q, want the command unwrapped below the minimum width", minWrapWidth-1, lines)
+	}
+}
+
+// An error ends the program with the error shown, the caller gets the final model back and decides the exit code
+func TestErrorMsgQuitsWithResult(t *testing.T) {
+	var cmds []string
+	m := update(InitialModel(&cmds, false, ""), tea.WindowSizeMsg{Width: 80, Height: 24}, AppendResponseMsg("Looking for the "))
+	next, cmd := m.Update(ErrorMsg{Err: errors.New("connection reset by peer")})
+	if cmd == nil {
+		t.Fatal("ErrorMsg returned no command, want the program to quit")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Errorf("ErrorMsg returned %T, want tea.Quit", cmd())
+	}
+	view := next.(model).view()
+	for _, want := range []string{"Looking for the", "Error: connection reset by peer"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view %q doesn't show %q", view, want)
+		}
+	}
+
+	// Through a whole program Run returns, with the error in the model, rather than the process exiting
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var out bytes.Buffer
+	p := tea.NewProgram(InitialModel(&cmds, false, ""), tea.WithContext(ctx), tea.WithInput(nil), tea.WithOutput(&out), tea.WithoutSignalHandler())
+	go func() {
+		p.Send(AppendResponseMsg("Looking for the "))
+		p.Send(ErrorMsg{Err: errors.New("connection reset by peer")})
+	}()
+	final, err := p.Run()
+	if err != nil {
+		t.Fatalf("Run() = %v, want the program to quit on its own", err)
+	}
+	if !ShowedError(final) || Interrupted(final) {
+		t.Errorf("final model showed the error %v, interrupted %v, want only the error", ShowedError(final), Interrupted(final))
+	}
+	if len(cmds) != 0 {
+		t.Errorf("commands after an error = %q, want none", cmds)
+	}
+
+	// A cancelled generation quits without an error to show
+	next, _ = m.Update(ErrorMsg{Err: context.Canceled})
+	if ShowedError(next) {
+		t.Error("a cancelled generation showed an error")
+	}
+}
+
+// A complete response without commands stays open, so it can be read in the pager, edited or asked again
+func TestProseResponseStaysOpen(t *testing.T) {
+	var cmds []string
+	var asked int
+	regenerate := RegenerateMsg(func(ctx context.Context, candidate int, previous []string) error {
+		asked++
+		return nil
+	})
+	m := update(InitialModel(&cmds, false, ""), tea.WindowSizeMsg{Width: 80, Height: 24}, regenerate,
+		AppendResponseMsg("The load average is the number of processes waiting for the CPU."), GenerationDoneMsg{})
+	// All of it is on screen, the next message used to close the program
+	m.displayedContentLength = len(m.response)
+	next, cmd := m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	if m = next.(model); cmd != nil {
+		t.Fatal("the program quit once the response was shown, want it to stay open")
+	}
+
+	view := m.view()
+	for _, want := range []string{"a different suggestion", "read in $PAGER", "edit in $EDITOR", "quit"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view %q doesn't offer %q", view, want)
+		}
+	}
+	next, cmd = m.Update(keyMsg("r"))
+	if m = next.(model); m.isDone || cmd == nil {
+		t.Fatal("r didn't ask for a different suggestion")
+	}
+	if cmd(); asked != 1 {
+		t.Errorf("asked for %d suggestions, want one", asked)
+	}
+
+	// Without a regenerator the hint leaves r out
+	m = update(InitialModel(&cmds, false, ""), tea.WindowSizeMsg{Width: 80, Height: 24}, AppendResponseMsg("Done."), GenerationDoneMsg{})
+	if view := m.view(); strings.Contains(view, "a different suggestion") || !strings.Contains(view, "read in $PAGER") {
+		t.Errorf("view without a regenerator = %q, want the pager and no r", view)
+	}
+}
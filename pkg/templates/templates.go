@@ -0,0 +1,175 @@
+// Package templates renders the prompt templates of lexido -t from the templates directory
+package templates
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/micr0-dev/lexido/pkg/errs"
+	"github.com/micr0-dev/lexido/pkg/io"
+)
+
+// Extension of template files
+const ext = ".tmpl"
+
+// Template is a file in the templates directory
+type Template struct {
+	Name        string
+	Description string // The first line, without comment delimiters
+}
+
+// File is a file attached with @path, as templates see it
+type File struct {
+	Path    string
+	Content string
+}
+
+// Data is what a template is rendered against: {{.Args}}, {{.Pipe}}, {{.CWD}} and {{.Files}}
+type Data struct {
+	Args []string // Words after the template name
+	CWD  string
+
+	pipe  string
+	files []File
+	used  map[string]bool
+}
+
+// Returns the data of a template with the prompt words, the working directory, piped input and attached files
+func NewData(args []string, cwd string, pipe string, attachments []io.Attachment) *Data {
+	data := &Data{Args: args, CWD: cwd, pipe: pipe, used: map[string]bool{}}
+	for _, attachment := range attachments {
+		data.files = append(data.files, File{Path: attachment.Path, Content: attachment.Content})
+	}
+	return data
+}
+
+// Pipe is the piped input
+func (d *Data) Pipe() string {
+	d.used["Pipe"] = true
+	return d.pipe
+}
+
+// Files are the files attached with @path
+func (d *Data) Files() []File {
+	d.used["Files"] = true
+	return d.files
+}
+
+// Uses reports whether the rendered template referred to Pipe or Files, which then aren't attached again
+func (d *Data) Uses(name string) bool {
+	return d.used[name]
+}
+
+// Returns the directory templates are kept in, inside the config directory
+func Dir() (string, error) {
+	return io.GetFilePath(io.Config, "templates")
+}
+
+// Returned by required for a value that wasn't given
+type missingError string
+
+func (e missingError) Error() string {
+	return "missing " + string(e)
+}
+
+// Functions templates can use besides the built-in ones
+var funcs = template.FuncMap{
+	// {{arg .Args 0}} is the first word after the template name, or nothing
+	"arg": func(args []string, i int) string {
+		if i < 0 || i >= len(args) {
+			return ""
+		}
+		return args[i]
+	},
+	// {{required "a service name" (arg .Args 0)}} stops rendering when the value is empty
+	"required": func(what string, value any) (any, error) {
+		if value == nil || fmt.Sprint(value) == "" {
+			return nil, missingError(what)
+		}
+		return value, nil
+	},
+	"join": strings.Join,
+}
+
+// Render renders the named template. A missing template or a required value that wasn't given is a usage error.
+func Render(name string, data *Data) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", errs.Usagef("invalid template name %q", name)
+	}
+	path := filepath.Join(dir, name+ext)
+	text, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errs.Usagef("no template %s in %s, lexido templates list shows the ones there are", name, dir)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return "", errs.Usagef("template %s: %v", name, err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		var missing missingError
+		if errors.As(err, &missing) {
+			return "", errs.Usagef("template %s needs %s", name, string(missing))
+		}
+		// The error names the template, line and column, the cause is at the end
+		return "", errs.Usagef("template %s: %v", name, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// List returns the templates in the templates directory by name. A missing directory means there are none.
+func List() ([]Template, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Template
+	for _, path := range paths {
+		list = append(list, Template{
+			Name:        strings.TrimSuffix(filepath.Base(path), ext),
+			Description: firstLine(path),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Returns the first line of a template, a {{/* comment */}} there is shown without its delimiters
+func firstLine(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return ""
+	}
+	line := strings.TrimSpace(scanner.Text())
+	if strings.HasPrefix(line, "{{/*") || strings.HasPrefix(line, "{{- /*") {
+		line = strings.TrimLeft(line, "{- ")
+		line = strings.TrimRight(line, "}- ")
+		line = strings.TrimSuffix(strings.TrimPrefix(line, "/*"), "*/")
+	}
+	return strings.TrimSpace(line)
+}
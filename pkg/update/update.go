@@ -0,0 +1,358 @@
+// Package update finds newer releases of lexido on GitHub and replaces the running binary with a verified one
+package update
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	lexidoio "github.com/micr0-dev/lexido/pkg/io"
+	"github.com/micr0-dev/lexido/pkg/network"
+)
+
+// Endpoint of the newest release
+var LatestURL = "https://api.github.com/repos/micr0-dev/lexido/releases/latest"
+
+// SigningKey is the base64 ed25519 public key the checksum files of releases are signed with. While it is
+// empty releases aren't signed and only their checksums are verified.
+var SigningKey = ""
+
+// Names the checksum file of a release may have
+var checksumNames = []string{"checksums.txt", "SHA256SUMS", "sha256sums.txt"}
+
+// Release is a published release of lexido
+type Release struct {
+	Version string // Without the leading v
+	Assets  []Asset
+}
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Latest returns the newest release that isn't a draft or prerelease
+func Latest(ctx context.Context) (Release, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", LatestURL, nil)
+	if err != nil {
+		return Release{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Release{}, network.Wrap(network.HostOf(LatestURL), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Release{}, fmt.Errorf("github responded %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string  `json:"tag_name"`
+		Assets  []Asset `json:"assets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return Release{}, fmt.Errorf("reading the release: %w", err)
+	}
+	return Release{Version: strings.TrimPrefix(release.TagName, "v"), Assets: release.Assets}, nil
+}
+
+// Newer reports whether version a comes after b, both major.minor.patch with missing parts read as 0. A pre-release
+// such as 1.2.0-rc1 comes before its release, pre-releases of one version are ordered like semver orders them.
+func Newer(a string, b string) bool {
+	pa, preA := parseVersion(a)
+	pb, preB := parseVersion(b)
+	for i := range pa {
+		if pa[i] != pb[i] {
+			return pa[i] > pb[i]
+		}
+	}
+	return comparePrerelease(preA, preB) > 0
+}
+
+// Returns the numbers of a version and its pre-release suffix, build metadata after a + is dropped
+func parseVersion(v string) ([3]int, string) {
+	var parts [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, _ := strings.Cut(v, "-")
+	for i, field := range strings.SplitN(v, ".", 3) {
+		parts[i], _ = strconv.Atoi(field)
+	}
+	return parts, pre
+}
+
+// Compares two pre-release suffixes like semver: no suffix comes last, dot separated identifiers are compared in
+// turn, numeric ones as numbers and before the others, and a shorter list comes first when all else is equal
+func comparePrerelease(a string, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	fieldsA, fieldsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(fieldsA) && i < len(fieldsB); i++ {
+		na, errA := strconv.Atoi(fieldsA[i])
+		nb, errB := strconv.Atoi(fieldsB[i])
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			return cmp.Compare(na, nb)
+		case errA == nil && errB != nil:
+			return -1
+		case errA != nil && errB == nil:
+			return 1
+		case errA != nil && fieldsA[i] != fieldsB[i]:
+			return strings.Compare(fieldsA[i], fieldsB[i])
+		}
+	}
+	return cmp.Compare(len(fieldsA), len(fieldsB))
+}
+
+// AssetName returns the name of the binary built for goos and goarch, as build-all.sh names them
+func AssetName(goos string, goarch string) string {
+	name := "lexido-" + goos + "-" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Returns the asset of the release with the given name
+func (r Release) asset(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// Download fetches the binary of this platform from the release into dir and verifies it against the
+// checksum file of the release, and its signature when releases are signed. It returns the path of the file.
+func Download(ctx context.Context, release Release, dir string) (string, error) {
+	name := AssetName(runtime.GOOS, runtime.GOARCH)
+	binary, ok := release.asset(name)
+	if !ok {
+		return "", fmt.Errorf("release %s has no binary for %s/%s", release.Version, runtime.GOOS, runtime.GOARCH)
+	}
+
+	var sums Asset
+	for _, candidate := range checksumNames {
+		if sums, ok = release.asset(candidate); ok {
+			break
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("release %s has no checksum file, not installing an unverified binary", release.Version)
+	}
+	sumsData, err := fetch(ctx, sums.URL)
+	if err != nil {
+		return "", err
+	}
+	if err := verifySignature(ctx, release, sums.Name, sumsData); err != nil {
+		return "", err
+	}
+	want, err := checksumOf(sumsData, name)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(dir, ".lexido-update-*")
+	if err != nil {
+		return "", err
+	}
+	path := file.Name()
+	hash := sha256.New()
+	err = download(ctx, binary.URL, io.MultiWriter(file, hash))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(hash.Sum(nil)) != want {
+		err = fmt.Errorf("the checksum of %s doesn't match the checksum file, the download may be corrupted or tampered with", name)
+	}
+	if err == nil {
+		err = os.Chmod(path, 0755)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// Checks the signature of the checksum file when there is a signing key, a signed release needs a valid one
+func verifySignature(ctx context.Context, release Release, sumsName string, sums []byte) error {
+	if SigningKey == "" {
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(SigningKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("the compiled-in signing key is invalid")
+	}
+	sigAsset, ok := release.asset(sumsName + ".sig")
+	if !ok {
+		return fmt.Errorf("release %s isn't signed, not installing it", release.Version)
+	}
+	sig, err := fetch(ctx, sigAsset.URL)
+	if err != nil {
+		return err
+	}
+	// The signature is attached as base64 text or as the raw bytes
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err == nil {
+		sig = decoded
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), sums, sig) {
+		return fmt.Errorf("the signature of release %s is invalid, not installing it", release.Version)
+	}
+	return nil
+}
+
+// Returns the sha256 the checksum file lists for name, in the format of sha256sum
+func checksumOf(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(string(sums)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// sha256sum marks binary mode with a * before the name
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("the checksum file doesn't list %s", name)
+}
+
+// Largest checksum or signature file read
+const maxSmallFile = 1 << 20
+
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	body, err := get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(io.LimitReader(body, maxSmallFile))
+}
+
+func download(ctx context.Context, url string, w io.Writer) error {
+	body, err := get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// Returns the body of a GET request to url, anything but 200 OK is an error
+func get(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, network.Wrap(network.HostOf(url), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Replace puts the downloaded binary at newPath in place of exe in one rename, so lexido is never half written.
+// Windows can't overwrite a running binary, so there it is moved aside first.
+func Replace(exe string, newPath string) error {
+	return replace(exe, newPath, runtime.GOOS == "windows")
+}
+
+// Renames newPath to exe, with moveAside exe is renamed to exe.old first and put back when that fails
+func replace(exe string, newPath string, moveAside bool) error {
+	if !moveAside {
+		return os.Rename(newPath, exe)
+	}
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		os.Rename(old, exe)
+		return err
+	}
+	return nil
+}
+
+// Executable returns the path of the running binary with symlinks resolved, e.g. the one Homebrew links to
+func Executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// Reports whether a file can be created in dir, to replace the binary there
+func Writable(dir string) bool {
+	file, err := os.CreateTemp(dir, ".lexido-write-test-*")
+	if err != nil {
+		return false
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return true
+}
+
+// How often -v looks for a newer release
+const checkTTL = 24 * time.Hour
+
+// File of the cache dir the result of the last check is kept in
+const checkFile = "update_check.json"
+
+type cachedCheck struct {
+	Checked time.Time `json:"checked"`
+	Latest  string    `json:"latest"`
+}
+
+// LatestCached returns the version of the newest release, asking GitHub at most once a day
+func LatestCached(ctx context.Context) (string, error) {
+	path, err := lexidoio.GetFilePath(lexidoio.Cache, checkFile)
+	if err != nil {
+		return "", err
+	}
+	var cached cachedCheck
+	if data, err := os.ReadFile(path); err == nil {
+		if json.Unmarshal(data, &cached) == nil && time.Since(cached.Checked) < checkTTL && cached.Latest != "" {
+			return cached.Latest, nil
+		}
+	}
+
+	release, err := Latest(ctx)
+	if err != nil {
+		return "", err
+	}
+	cached = cachedCheck{Checked: time.Now(), Latest: release.Version}
+	if data, err := json.Marshal(cached); err == nil && os.MkdirAll(filepath.Dir(path), 0700) == nil {
+		os.WriteFile(path, data, 0600)
+	}
+	return release.Version, nil
+}
@@ -0,0 +1,178 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1.2.0", "1.1.9", true},
+		{"v1.10.0", "1.9.0", true},
+		{"1.2", "1.2.0", false},
+		{"1.2.0", "1.2.0", false},
+		{"1.1.9", "1.2.0", false},
+		// A release comes after its pre-releases, not the other way around
+		{"1.2.0", "1.2.0-rc1", true},
+		{"1.2.0-rc1", "1.2.0", false},
+		{"1.2.0-rc1", "1.1.9", true},
+		{"1.2.0-rc.2", "1.2.0-rc.1", true},
+		{"1.2.0-rc.10", "1.2.0-rc.2", true},
+		{"1.2.0-beta", "1.2.0-alpha", true},
+		{"1.2.0-alpha.1", "1.2.0-alpha", true},
+		{"1.2.0-alpha", "1.2.0-1", true},
+		{"1.2.0+build5", "1.2.0", false},
+	}
+	for _, test := range tests {
+		if got := Newer(test.a, test.b); got != test.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+// A release server with the binary of this platform and whatever files the test adds
+type releaseServer struct {
+	*httptest.Server
+	files map[string][]byte
+}
+
+func newReleaseServer(t *testing.T, binary []byte) *releaseServer {
+	t.Helper()
+	s := &releaseServer{files: map[string][]byte{AssetName(runtime.GOOS, runtime.GOARCH): binary}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := s.files[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Returns the release listing every file of the server
+func (s *releaseServer) release() Release {
+	r := Release{Version: "9.9.9"}
+	for name := range s.files {
+		r.Assets = append(r.Assets, Asset{Name: name, URL: s.URL + "/" + name})
+	}
+	return r
+}
+
+func sumsOf(name string, data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return []byte(hex.EncodeToString(sum[:]) + "  " + name + "\n")
+}
+
+// Sets SigningKey to a new key for the test and returns its private half
+func signingKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	was := SigningKey
+	SigningKey = base64.StdEncoding.EncodeToString(public)
+	t.Cleanup(func() { SigningKey = was })
+	return private
+}
+
+func TestDownload(t *testing.T) {
+	name := AssetName(runtime.GOOS, runtime.GOARCH)
+	binary := []byte("#!/bin/sh\necho lexido 9.9.9\n")
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, s *releaseServer)
+		wantErr string
+	}{
+		{"verified", func(t *testing.T, s *releaseServer) {
+			s.files["checksums.txt"] = sumsOf(name, binary)
+		}, ""},
+		{"checksum mismatch", func(t *testing.T, s *releaseServer) {
+			s.files["checksums.txt"] = sumsOf(name, []byte("something else"))
+		}, "doesn't match the checksum file"},
+		{"no checksum file", func(t *testing.T, s *releaseServer) {}, "has no checksum file"},
+		{"binary not in the checksum file", func(t *testing.T, s *releaseServer) {
+			s.files["SHA256SUMS"] = sumsOf("lexido-plan9-mips", binary)
+		}, "doesn't list " + name},
+		{"valid signature", func(t *testing.T, s *releaseServer) {
+			private := signingKey(t)
+			s.files["checksums.txt"] = sumsOf(name, binary)
+			s.files["checksums.txt.sig"] = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, s.files["checksums.txt"])))
+		}, ""},
+		{"bad signature", func(t *testing.T, s *releaseServer) {
+			private := signingKey(t)
+			s.files["checksums.txt"] = sumsOf(name, binary)
+			s.files["checksums.txt.sig"] = ed25519.Sign(private, []byte("other checksums"))
+		}, "signature of release 9.9.9 is invalid"},
+		{"unsigned with a signing key", func(t *testing.T, s *releaseServer) {
+			signingKey(t)
+			s.files["checksums.txt"] = sumsOf(name, binary)
+		}, "isn't signed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newReleaseServer(t, binary)
+			test.prepare(t, s)
+			dir := t.TempDir()
+
+			path, err := Download(context.Background(), s.release(), dir)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Download() = %q, %v, want an error containing %q", path, err, test.wantErr)
+				}
+				// Nothing unverified is left behind
+				if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+					t.Errorf("Download() left %v in the directory", entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download() = %v", err)
+			}
+			if data, err := os.ReadFile(path); err != nil || string(data) != string(binary) {
+				t.Errorf("downloaded %q, %v, want the binary", data, err)
+			}
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	for _, moveAside := range []bool{false, true} {
+		dir := t.TempDir()
+		exe, newPath := filepath.Join(dir, "lexido"), filepath.Join(dir, ".lexido-update-1")
+		os.WriteFile(exe, []byte("old"), 0755)
+		os.WriteFile(newPath, []byte("new"), 0755)
+		if err := replace(exe, newPath, moveAside); err != nil {
+			t.Fatalf("replace() moving aside %v = %v", moveAside, err)
+		}
+		if data, _ := os.ReadFile(exe); string(data) != "new" {
+			t.Errorf("moving aside %v the binary is %q, want the new one", moveAside, data)
+		}
+	}
+
+	// When the new binary can't be moved in, the old one is put back
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "lexido")
+	os.WriteFile(exe, []byte("old"), 0755)
+	if err := replace(exe, filepath.Join(dir, "missing"), true); err == nil {
+		t.Fatal("replace() of a missing file = nil, want the error")
+	}
+	if data, err := os.ReadFile(exe); err != nil || string(data) != "old" {
+		t.Errorf("after a failed replace the binary is %q, %v, want the old one back", data, err)
+	}
+}